@@ -0,0 +1,73 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionType is a string naming the aspect of a resource's state that
+// a Condition describes.
+type ConditionType string
+
+const (
+	// ConditionDegraded indicates that the operator could not fully
+	// realize the desired state of the resource.
+	ConditionDegraded = ConditionType("Degraded")
+	// ConditionDomainJoined indicates if the servers hosting a share have
+	// joined the active directory domain.
+	ConditionDomainJoined = ConditionType("DomainJoined")
+	// ConditionProgressing indicates that the resources of a share are
+	// being set up and are expected to become ready without any change.
+	ConditionProgressing = ConditionType("Progressing")
+	// ConditionSuspended indicates if a share is suspended, and no longer
+	// served, by request of its spec.
+	ConditionSuspended = ConditionType("Suspended")
+	// ConditionPaused indicates if the operator has paused the
+	// reconciliation of a share, making no changes to its resources.
+	ConditionPaused = ConditionType("Paused")
+)
+
+// Condition describes the state of one aspect of a resource at a certain
+// point in time.
+type Condition struct {
+	// Type of the condition.
+	Type ConditionType `json:"type"`
+
+	// Status of the condition, one of True, False, Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+
+	// ObservedGeneration is the generation of the resource that the
+	// condition was set based upon.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastTransitionTime is the last time the condition changed from one
+	// status to another.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a brief CamelCase string describing the cause of the
+	// condition's last transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable description of the condition.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,102 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SmbUserSpec defines the desired state of SmbUser
+type SmbUserSpec struct {
+	// SecurityConfig is the name of the SmbSecurityConfig, in the namespace
+	// of the SmbUser, whose shares the user can access. The security config
+	// must use user security and get its users from SmbUsers.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	SecurityConfig string `json:"securityConfig"`
+
+	// Username is the name the user logs in with. Defaults to the name of
+	// the SmbUser.
+	// +kubebuilder:validation:MaxLength:=32
+	// +kubebuilder:validation:Pattern:=`^[a-zA-Z0-9_.][a-zA-Z0-9_.-]*$`
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// UID of the user. The samba container picks one if it is not set.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	UID int32 `json:"uid,omitempty"`
+
+	// GID of the primary group of the user. The samba container picks one
+	// if it is not set.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	GID int32 `json:"gid,omitempty"`
+
+	// Password identifies the Secret holding the password of the user.
+	// +kubebuilder:validation:Required
+	Password SmbUserPasswordSpec `json:"password"`
+
+	// Groups are the names of the local groups of the security config the
+	// user is a member of.
+	// +optional
+	Groups []string `json:"groups,omitempty"`
+}
+
+// SmbUserPasswordSpec names the Secret, in the namespace of the SmbUser,
+// holding the password of a user.
+type SmbUserPasswordSpec struct {
+	// Secret is the name of the Secret.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	Secret string `json:"secret"`
+
+	// Key is the key of the Secret holding the password.
+	// +kubebuilder:default:=password
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// SmbUserStatus defines the observed state of SmbUser
+type SmbUserStatus struct {
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+
+// SmbUser is the Schema for the smbusers API
+type SmbUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SmbUserSpec   `json:"spec,omitempty"`
+	Status SmbUserStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SmbUserList contains a list of SmbUser
+type SmbUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SmbUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SmbUser{}, &SmbUserList{})
+}
@@ -23,14 +23,46 @@ package v1alpha1
 import (
 	"k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Condition) DeepCopyInto(out *Condition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
+func (in *Condition) DeepCopy() *Condition {
+	if in == nil {
+		return nil
+	}
+	out := new(Condition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbCSISecretVolumeSpec) DeepCopyInto(out *SmbCSISecretVolumeSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbCSISecretVolumeSpec.
+func (in *SmbCSISecretVolumeSpec) DeepCopy() *SmbCSISecretVolumeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbCSISecretVolumeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SmbCommonConfig) DeepCopyInto(out *SmbCommonConfig) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	out.Status = in.Status
 }
 
@@ -87,7 +119,69 @@ func (in *SmbCommonConfigList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SmbCommonConfigSpec) DeepCopyInto(out *SmbCommonConfigSpec) {
 	*out = *in
-	out.Network = in.Network
+	in.Network.DeepCopyInto(&out.Network)
+	if in.PodSettings != nil {
+		in, out := &in.PodSettings, &out.PodSettings
+		*out = new(SmbCommonPodSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UpdateStrategy != nil {
+		in, out := &in.UpdateStrategy, &out.UpdateStrategy
+		*out = new(SmbUpdateStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DisruptionBudget != nil {
+		in, out := &in.DisruptionBudget, &out.DisruptionBudget
+		*out = new(SmbDisruptionBudgetSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = new(SmbCommonImages)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxSmbdProcesses != nil {
+		in, out := &in.MaxSmbdProcesses, &out.MaxSmbdProcesses
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CustomConfig != nil {
+		in, out := &in.CustomConfig, &out.CustomConfig
+		*out = new(SmbCustomConfig)
+		**out = **in
+	}
+	if in.Debug != nil {
+		in, out := &in.Debug, &out.Debug
+		*out = new(SmbDebugSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Performance != nil {
+		in, out := &in.Performance, &out.Performance
+		*out = new(SmbPerformanceSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Sessions != nil {
+		in, out := &in.Sessions, &out.Sessions
+		*out = new(SmbSessionsSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Maintenance != nil {
+		in, out := &in.Maintenance, &out.Maintenance
+		*out = new(SmbMaintenanceSpec)
+		**out = **in
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = new(SmbMetricsSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CommonLabels != nil {
+		in, out := &in.CommonLabels, &out.CommonLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbCommonConfigSpec.
@@ -116,310 +210,1734 @@ func (in *SmbCommonConfigStatus) DeepCopy() *SmbCommonConfigStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbCommonNetworkSpec) DeepCopyInto(out *SmbCommonNetworkSpec) {
+func (in *SmbCommonImages) DeepCopyInto(out *SmbCommonImages) {
 	*out = *in
+	if in.Samba != nil {
+		in, out := &in.Samba, &out.Samba
+		*out = new(SmbContainerImage)
+		**out = **in
+	}
+	if in.DNSRegister != nil {
+		in, out := &in.DNSRegister, &out.DNSRegister
+		*out = new(SmbContainerImage)
+		**out = **in
+	}
+	if in.SvcWatch != nil {
+		in, out := &in.SvcWatch, &out.SvcWatch
+		*out = new(SmbContainerImage)
+		**out = **in
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = new(SmbContainerImage)
+		**out = **in
+	}
+	if in.ClamAV != nil {
+		in, out := &in.ClamAV, &out.ClamAV
+		*out = new(SmbContainerImage)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbCommonNetworkSpec.
-func (in *SmbCommonNetworkSpec) DeepCopy() *SmbCommonNetworkSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbCommonImages.
+func (in *SmbCommonImages) DeepCopy() *SmbCommonImages {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbCommonNetworkSpec)
+	out := new(SmbCommonImages)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbSecurityConfig) DeepCopyInto(out *SmbSecurityConfig) {
+func (in *SmbCommonNetworkSpec) DeepCopyInto(out *SmbCommonNetworkSpec) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityConfig.
-func (in *SmbSecurityConfig) DeepCopy() *SmbSecurityConfig {
-	if in == nil {
-		return nil
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(int32)
+		**out = **in
 	}
-	out := new(SmbSecurityConfig)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *SmbSecurityConfig) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
+	if in.IPFamilies != nil {
+		in, out := &in.IPFamilies, &out.IPFamilies
+		*out = make([]SmbIPFamily, len(*in))
+		copy(*out, *in)
 	}
-	return nil
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbSecurityConfigList) DeepCopyInto(out *SmbSecurityConfigList) {
-	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]SmbSecurityConfig, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	if in.Interfaces != nil {
+		in, out := &in.Interfaces, &out.Interfaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SocketOptions != nil {
+		in, out := &in.SocketOptions, &out.SocketOptions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceSessionAffinity != nil {
+		in, out := &in.ServiceSessionAffinity, &out.ServiceSessionAffinity
+		*out = new(SmbServiceSessionAffinity)
+		(*in).DeepCopyInto(*out)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityConfigList.
-func (in *SmbSecurityConfigList) DeepCopy() *SmbSecurityConfigList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbCommonNetworkSpec.
+func (in *SmbCommonNetworkSpec) DeepCopy() *SmbCommonNetworkSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbSecurityConfigList)
+	out := new(SmbCommonNetworkSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *SmbSecurityConfigList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbSecurityConfigSpec) DeepCopyInto(out *SmbSecurityConfigSpec) {
+func (in *SmbCommonPodSettings) DeepCopyInto(out *SmbCommonPodSettings) {
 	*out = *in
-	if in.Users != nil {
-		in, out := &in.Users, &out.Users
-		*out = new(SmbSecurityUsersSpec)
+	in.SmbPodSchedulingSettings.DeepCopyInto(&out.SmbPodSchedulingSettings)
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]v1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(SmbPodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TerminationGracePeriodSeconds != nil {
+		in, out := &in.TerminationGracePeriodSeconds, &out.TerminationGracePeriodSeconds
+		*out = new(int64)
 		**out = **in
 	}
-	if in.JoinSources != nil {
-		in, out := &in.JoinSources, &out.JoinSources
-		*out = make([]SmbSecurityJoinSpec, len(*in))
+	if in.StartupTimeoutSeconds != nil {
+		in, out := &in.StartupTimeoutSeconds, &out.StartupTimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SELinuxOptions != nil {
+		in, out := &in.SELinuxOptions, &out.SELinuxOptions
+		*out = new(SmbSELinuxOptions)
+		**out = **in
+	}
+	if in.ExtraMounts != nil {
+		in, out := &in.ExtraMounts, &out.ExtraMounts
+		*out = make([]SmbExtraMount, len(*in))
+		copy(*out, *in)
+	}
+	if in.NetworkAttachments != nil {
+		in, out := &in.NetworkAttachments, &out.NetworkAttachments
+		*out = make([]SmbNetworkAttachment, len(*in))
+		copy(*out, *in)
+	}
+	if in.Probes != nil {
+		in, out := &in.Probes, &out.Probes
+		*out = new(SmbProbesSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExtraEnv != nil {
+		in, out := &in.ExtraEnv, &out.ExtraEnv
+		*out = make([]SmbEnvVar, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExtraContainers != nil {
+		in, out := &in.ExtraContainers, &out.ExtraContainers
+		*out = make([]v1.Container, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
-	if in.Domains != nil {
-		in, out := &in.Domains, &out.Domains
-		*out = make([]SmbSecurityDomainSpec, len(*in))
+	if in.ContainerArgs != nil {
+		in, out := &in.ContainerArgs, &out.ContainerArgs
+		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
-	if in.DNS != nil {
-		in, out := &in.DNS, &out.DNS
-		*out = new(SmbSecurityDNSSpec)
-		**out = **in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityConfigSpec.
-func (in *SmbSecurityConfigSpec) DeepCopy() *SmbSecurityConfigSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbCommonPodSettings.
+func (in *SmbCommonPodSettings) DeepCopy() *SmbCommonPodSettings {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbSecurityConfigSpec)
+	out := new(SmbCommonPodSettings)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbSecurityConfigStatus) DeepCopyInto(out *SmbSecurityConfigStatus) {
+func (in *SmbContainerImage) DeepCopyInto(out *SmbContainerImage) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityConfigStatus.
-func (in *SmbSecurityConfigStatus) DeepCopy() *SmbSecurityConfigStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbContainerImage.
+func (in *SmbContainerImage) DeepCopy() *SmbContainerImage {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbSecurityConfigStatus)
+	out := new(SmbContainerImage)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbSecurityDNSSpec) DeepCopyInto(out *SmbSecurityDNSSpec) {
+func (in *SmbCustomConfig) DeepCopyInto(out *SmbCustomConfig) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityDNSSpec.
-func (in *SmbSecurityDNSSpec) DeepCopy() *SmbSecurityDNSSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbCustomConfig.
+func (in *SmbCustomConfig) DeepCopy() *SmbCustomConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbSecurityDNSSpec)
+	out := new(SmbCustomConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbSecurityDomainSpec) DeepCopyInto(out *SmbSecurityDomainSpec) {
+func (in *SmbDebugSpec) DeepCopyInto(out *SmbDebugSpec) {
 	*out = *in
+	if in.MaxLogSize != nil {
+		in, out := &in.MaxLogSize, &out.MaxLogSize
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CoresSizeLimit != nil {
+		in, out := &in.CoresSizeLimit, &out.CoresSizeLimit
+		x := (*in).DeepCopy()
+		*out = &x
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityDomainSpec.
-func (in *SmbSecurityDomainSpec) DeepCopy() *SmbSecurityDomainSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbDebugSpec.
+func (in *SmbDebugSpec) DeepCopy() *SmbDebugSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbSecurityDomainSpec)
+	out := new(SmbDebugSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbSecurityJoinSpec) DeepCopyInto(out *SmbSecurityJoinSpec) {
+func (in *SmbDisruptionBudgetSpec) DeepCopyInto(out *SmbDisruptionBudgetSpec) {
 	*out = *in
-	if in.UserJoin != nil {
-		in, out := &in.UserJoin, &out.UserJoin
-		*out = new(SmbSecurityUserJoinSpec)
+	if in.MinAvailable != nil {
+		in, out := &in.MinAvailable, &out.MinAvailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
 		**out = **in
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityJoinSpec.
-func (in *SmbSecurityJoinSpec) DeepCopy() *SmbSecurityJoinSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbDisruptionBudgetSpec.
+func (in *SmbDisruptionBudgetSpec) DeepCopy() *SmbDisruptionBudgetSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbSecurityJoinSpec)
+	out := new(SmbDisruptionBudgetSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbSecurityUserJoinSpec) DeepCopyInto(out *SmbSecurityUserJoinSpec) {
+func (in *SmbEnvVar) DeepCopyInto(out *SmbEnvVar) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityUserJoinSpec.
-func (in *SmbSecurityUserJoinSpec) DeepCopy() *SmbSecurityUserJoinSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbEnvVar.
+func (in *SmbEnvVar) DeepCopy() *SmbEnvVar {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbSecurityUserJoinSpec)
+	out := new(SmbEnvVar)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbSecurityUsersSpec) DeepCopyInto(out *SmbSecurityUsersSpec) {
+func (in *SmbExtraMount) DeepCopyInto(out *SmbExtraMount) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityUsersSpec.
-func (in *SmbSecurityUsersSpec) DeepCopy() *SmbSecurityUsersSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbExtraMount.
+func (in *SmbExtraMount) DeepCopy() *SmbExtraMount {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbSecurityUsersSpec)
+	out := new(SmbExtraMount)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbShare) DeepCopyInto(out *SmbShare) {
+func (in *SmbMaintenanceSpec) DeepCopyInto(out *SmbMaintenanceSpec) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShare.
-func (in *SmbShare) DeepCopy() *SmbShare {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbMaintenanceSpec.
+func (in *SmbMaintenanceSpec) DeepCopy() *SmbMaintenanceSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbShare)
+	out := new(SmbMaintenanceSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *SmbShare) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbShareList) DeepCopyInto(out *SmbShareList) {
+func (in *SmbMetricsSpec) DeepCopyInto(out *SmbMetricsSpec) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]SmbShare, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	if in.ServiceMonitor != nil {
+		in, out := &in.ServiceMonitor, &out.ServiceMonitor
+		*out = new(SmbServiceMonitorSpec)
+		(*in).DeepCopyInto(*out)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareList.
-func (in *SmbShareList) DeepCopy() *SmbShareList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbMetricsSpec.
+func (in *SmbMetricsSpec) DeepCopy() *SmbMetricsSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbShareList)
+	out := new(SmbMetricsSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *SmbShareList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbSharePvcSpec) DeepCopyInto(out *SmbSharePvcSpec) {
+func (in *SmbNetworkAttachment) DeepCopyInto(out *SmbNetworkAttachment) {
 	*out = *in
-	if in.Spec != nil {
-		in, out := &in.Spec, &out.Spec
-		*out = new(v1.PersistentVolumeClaimSpec)
-		(*in).DeepCopyInto(*out)
-	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSharePvcSpec.
-func (in *SmbSharePvcSpec) DeepCopy() *SmbSharePvcSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbNetworkAttachment.
+func (in *SmbNetworkAttachment) DeepCopy() *SmbNetworkAttachment {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbSharePvcSpec)
+	out := new(SmbNetworkAttachment)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbShareSpec) DeepCopyInto(out *SmbShareSpec) {
+func (in *SmbPerformanceSpec) DeepCopyInto(out *SmbPerformanceSpec) {
 	*out = *in
-	in.Storage.DeepCopyInto(&out.Storage)
+	if in.AioReadSize != nil {
+		in, out := &in.AioReadSize, &out.AioReadSize
+		*out = new(int64)
+		**out = **in
+	}
+	if in.AioWriteSize != nil {
+		in, out := &in.AioWriteSize, &out.AioWriteSize
+		*out = new(int64)
+		**out = **in
+	}
+	if in.AioMaxThreads != nil {
+		in, out := &in.AioMaxThreads, &out.AioMaxThreads
+		*out = new(int32)
+		**out = **in
+	}
+	if in.UseSendfile != nil {
+		in, out := &in.UseSendfile, &out.UseSendfile
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ReadRaw != nil {
+		in, out := &in.ReadRaw, &out.ReadRaw
+		*out = new(bool)
+		**out = **in
+	}
+	if in.WriteRaw != nil {
+		in, out := &in.WriteRaw, &out.WriteRaw
+		*out = new(bool)
+		**out = **in
+	}
+	if in.SMB2MaxRead != nil {
+		in, out := &in.SMB2MaxRead, &out.SMB2MaxRead
+		*out = new(int64)
+		**out = **in
+	}
+	if in.SMB2MaxWrite != nil {
+		in, out := &in.SMB2MaxWrite, &out.SMB2MaxWrite
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MinReceivefileSize != nil {
+		in, out := &in.MinReceivefileSize, &out.MinReceivefileSize
+		*out = new(int64)
+		**out = **in
+	}
+	if in.AioWriteBehind != nil {
+		in, out := &in.AioWriteBehind, &out.AioWriteBehind
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareSpec.
-func (in *SmbShareSpec) DeepCopy() *SmbShareSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbPerformanceSpec.
+func (in *SmbPerformanceSpec) DeepCopy() *SmbPerformanceSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(SmbShareSpec)
+	out := new(SmbPerformanceSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SmbShareStatus) DeepCopyInto(out *SmbShareStatus) {
+func (in *SmbPodSchedulingSettings) DeepCopyInto(out *SmbPodSchedulingSettings) {
 	*out = *in
-}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(v1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TopologySpreadConstraints != nil {
+		in, out := &in.TopologySpreadConstraints, &out.TopologySpreadConstraints
+		*out = make([]v1.TopologySpreadConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SupportedArchitectures != nil {
+		in, out := &in.SupportedArchitectures, &out.SupportedArchitectures
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbPodSchedulingSettings.
+func (in *SmbPodSchedulingSettings) DeepCopy() *SmbPodSchedulingSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbPodSchedulingSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbPodSecurityContext) DeepCopyInto(out *SmbPodSecurityContext) {
+	*out = *in
+	if in.RunAsUser != nil {
+		in, out := &in.RunAsUser, &out.RunAsUser
+		*out = new(int64)
+		**out = **in
+	}
+	if in.RunAsGroup != nil {
+		in, out := &in.RunAsGroup, &out.RunAsGroup
+		*out = new(int64)
+		**out = **in
+	}
+	if in.FSGroup != nil {
+		in, out := &in.FSGroup, &out.FSGroup
+		*out = new(int64)
+		**out = **in
+	}
+	if in.SeccompProfile != nil {
+		in, out := &in.SeccompProfile, &out.SeccompProfile
+		*out = new(SmbSeccompProfile)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbPodSecurityContext.
+func (in *SmbPodSecurityContext) DeepCopy() *SmbPodSecurityContext {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbPodSecurityContext)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbProbeSettings) DeepCopyInto(out *SmbProbeSettings) {
+	*out = *in
+	if in.PeriodSeconds != nil {
+		in, out := &in.PeriodSeconds, &out.PeriodSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailureThreshold != nil {
+		in, out := &in.FailureThreshold, &out.FailureThreshold
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbProbeSettings.
+func (in *SmbProbeSettings) DeepCopy() *SmbProbeSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbProbeSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbProbesSettings) DeepCopyInto(out *SmbProbesSettings) {
+	*out = *in
+	if in.Startup != nil {
+		in, out := &in.Startup, &out.Startup
+		*out = new(SmbProbeSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Liveness != nil {
+		in, out := &in.Liveness, &out.Liveness
+		*out = new(SmbProbeSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Readiness != nil {
+		in, out := &in.Readiness, &out.Readiness
+		*out = new(SmbProbeSettings)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbProbesSettings.
+func (in *SmbProbesSettings) DeepCopy() *SmbProbesSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbProbesSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSELinuxOptions) DeepCopyInto(out *SmbSELinuxOptions) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSELinuxOptions.
+func (in *SmbSELinuxOptions) DeepCopy() *SmbSELinuxOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSELinuxOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSeccompProfile) DeepCopyInto(out *SmbSeccompProfile) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSeccompProfile.
+func (in *SmbSeccompProfile) DeepCopy() *SmbSeccompProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSeccompProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityAuthenticationSpec) DeepCopyInto(out *SmbSecurityAuthenticationSpec) {
+	*out = *in
+	if in.ClientNTLMv2Auth != nil {
+		in, out := &in.ClientNTLMv2Auth, &out.ClientNTLMv2Auth
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityAuthenticationSpec.
+func (in *SmbSecurityAuthenticationSpec) DeepCopy() *SmbSecurityAuthenticationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityAuthenticationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityClientSpec) DeepCopyInto(out *SmbSecurityClientSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityClientSpec.
+func (in *SmbSecurityClientSpec) DeepCopy() *SmbSecurityClientSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityClientSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityConfig) DeepCopyInto(out *SmbSecurityConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityConfig.
+func (in *SmbSecurityConfig) DeepCopy() *SmbSecurityConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SmbSecurityConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityConfigList) DeepCopyInto(out *SmbSecurityConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SmbSecurityConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityConfigList.
+func (in *SmbSecurityConfigList) DeepCopy() *SmbSecurityConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SmbSecurityConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityConfigSpec) DeepCopyInto(out *SmbSecurityConfigSpec) {
+	*out = *in
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = new(SmbSecurityUsersSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.JoinSources != nil {
+		in, out := &in.JoinSources, &out.JoinSources
+		*out = make([]SmbSecurityJoinSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Kerberos != nil {
+		in, out := &in.Kerberos, &out.Kerberos
+		*out = new(SmbSecurityKerberosSpec)
+		**out = **in
+	}
+	if in.JoinRetry != nil {
+		in, out := &in.JoinRetry, &out.JoinRetry
+		*out = new(SmbSecurityJoinRetrySpec)
+		**out = **in
+	}
+	if in.Domains != nil {
+		in, out := &in.Domains, &out.Domains
+		*out = make([]SmbSecurityDomainSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = new(SmbSecurityDNSSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Authentication != nil {
+		in, out := &in.Authentication, &out.Authentication
+		*out = new(SmbSecurityAuthenticationSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PassdbBackend != nil {
+		in, out := &in.PassdbBackend, &out.PassdbBackend
+		*out = new(SmbSecurityPassdbSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Client != nil {
+		in, out := &in.Client, &out.Client
+		*out = new(SmbSecurityClientSpec)
+		**out = **in
+	}
+	if in.Winbind != nil {
+		in, out := &in.Winbind, &out.Winbind
+		*out = new(SmbSecurityWinbindSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityConfigSpec.
+func (in *SmbSecurityConfigSpec) DeepCopy() *SmbSecurityConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityConfigStatus) DeepCopyInto(out *SmbSecurityConfigStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityConfigStatus.
+func (in *SmbSecurityConfigStatus) DeepCopy() *SmbSecurityConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityDNSKeySpec) DeepCopyInto(out *SmbSecurityDNSKeySpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityDNSKeySpec.
+func (in *SmbSecurityDNSKeySpec) DeepCopy() *SmbSecurityDNSKeySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityDNSKeySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityDNSSpec) DeepCopyInto(out *SmbSecurityDNSSpec) {
+	*out = *in
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TSIGKey != nil {
+		in, out := &in.TSIGKey, &out.TSIGKey
+		*out = new(SmbSecurityDNSKeySpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityDNSSpec.
+func (in *SmbSecurityDNSSpec) DeepCopy() *SmbSecurityDNSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityDNSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityDomainSpec) DeepCopyInto(out *SmbSecurityDomainSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityDomainSpec.
+func (in *SmbSecurityDomainSpec) DeepCopy() *SmbSecurityDomainSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityDomainSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityJoinRetrySpec) DeepCopyInto(out *SmbSecurityJoinRetrySpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityJoinRetrySpec.
+func (in *SmbSecurityJoinRetrySpec) DeepCopy() *SmbSecurityJoinRetrySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityJoinRetrySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityJoinSpec) DeepCopyInto(out *SmbSecurityJoinSpec) {
+	*out = *in
+	if in.UserJoin != nil {
+		in, out := &in.UserJoin, &out.UserJoin
+		*out = new(SmbSecurityUserJoinSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityJoinSpec.
+func (in *SmbSecurityJoinSpec) DeepCopy() *SmbSecurityJoinSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityJoinSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityKerberosSpec) DeepCopyInto(out *SmbSecurityKerberosSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityKerberosSpec.
+func (in *SmbSecurityKerberosSpec) DeepCopy() *SmbSecurityKerberosSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityKerberosSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityLDAPSpec) DeepCopyInto(out *SmbSecurityLDAPSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityLDAPSpec.
+func (in *SmbSecurityLDAPSpec) DeepCopy() *SmbSecurityLDAPSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityLDAPSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityLocalGroupSpec) DeepCopyInto(out *SmbSecurityLocalGroupSpec) {
+	*out = *in
+	if in.Members != nil {
+		in, out := &in.Members, &out.Members
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityLocalGroupSpec.
+func (in *SmbSecurityLocalGroupSpec) DeepCopy() *SmbSecurityLocalGroupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityLocalGroupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityPassdbSpec) DeepCopyInto(out *SmbSecurityPassdbSpec) {
+	*out = *in
+	if in.LDAP != nil {
+		in, out := &in.LDAP, &out.LDAP
+		*out = new(SmbSecurityLDAPSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityPassdbSpec.
+func (in *SmbSecurityPassdbSpec) DeepCopy() *SmbSecurityPassdbSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityPassdbSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityUserJoinSpec) DeepCopyInto(out *SmbSecurityUserJoinSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityUserJoinSpec.
+func (in *SmbSecurityUserJoinSpec) DeepCopy() *SmbSecurityUserJoinSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityUserJoinSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityUsersImportSpec) DeepCopyInto(out *SmbSecurityUsersImportSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityUsersImportSpec.
+func (in *SmbSecurityUsersImportSpec) DeepCopy() *SmbSecurityUsersImportSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityUsersImportSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityUsersSpec) DeepCopyInto(out *SmbSecurityUsersSpec) {
+	*out = *in
+	if in.CSISecretVolume != nil {
+		in, out := &in.CSISecretVolume, &out.CSISecretVolume
+		*out = new(SmbCSISecretVolumeSpec)
+		**out = **in
+	}
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]SmbSecurityLocalGroupSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Import != nil {
+		in, out := &in.Import, &out.Import
+		*out = new(SmbSecurityUsersImportSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityUsersSpec.
+func (in *SmbSecurityUsersSpec) DeepCopy() *SmbSecurityUsersSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityUsersSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSecurityWinbindSpec) DeepCopyInto(out *SmbSecurityWinbindSpec) {
+	*out = *in
+	if in.RequestTimeout != nil {
+		in, out := &in.RequestTimeout, &out.RequestTimeout
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxClients != nil {
+		in, out := &in.MaxClients, &out.MaxClients
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxDomainConnections != nil {
+		in, out := &in.MaxDomainConnections, &out.MaxDomainConnections
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSecurityWinbindSpec.
+func (in *SmbSecurityWinbindSpec) DeepCopy() *SmbSecurityWinbindSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSecurityWinbindSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbServiceMonitorSpec) DeepCopyInto(out *SmbServiceMonitorSpec) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbServiceMonitorSpec.
+func (in *SmbServiceMonitorSpec) DeepCopy() *SmbServiceMonitorSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbServiceMonitorSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbServiceSessionAffinity) DeepCopyInto(out *SmbServiceSessionAffinity) {
+	*out = *in
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbServiceSessionAffinity.
+func (in *SmbServiceSessionAffinity) DeepCopy() *SmbServiceSessionAffinity {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbServiceSessionAffinity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSessionsSpec) DeepCopyInto(out *SmbSessionsSpec) {
+	*out = *in
+	if in.Deadtime != nil {
+		in, out := &in.Deadtime, &out.Deadtime
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Keepalive != nil {
+		in, out := &in.Keepalive, &out.Keepalive
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SMB2MaxCredits != nil {
+		in, out := &in.SMB2MaxCredits, &out.SMB2MaxCredits
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSessionsSpec.
+func (in *SmbSessionsSpec) DeepCopy() *SmbSessionsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSessionsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShare) DeepCopyInto(out *SmbShare) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShare.
+func (in *SmbShare) DeepCopy() *SmbShare {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShare)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SmbShare) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareACLSpec) DeepCopyInto(out *SmbShareACLSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareACLSpec.
+func (in *SmbShareACLSpec) DeepCopy() *SmbShareACLSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareACLSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareAccessControl) DeepCopyInto(out *SmbShareAccessControl) {
+	*out = *in
+	if in.ValidUsers != nil {
+		in, out := &in.ValidUsers, &out.ValidUsers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.InvalidUsers != nil {
+		in, out := &in.InvalidUsers, &out.InvalidUsers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReadList != nil {
+		in, out := &in.ReadList, &out.ReadList
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.WriteList != nil {
+		in, out := &in.WriteList, &out.WriteList
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareAccessControl.
+func (in *SmbShareAccessControl) DeepCopy() *SmbShareAccessControl {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareAccessControl)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareAntivirusSpec) DeepCopyInto(out *SmbShareAntivirusSpec) {
+	*out = *in
+	if in.ScanOnOpen != nil {
+		in, out := &in.ScanOnOpen, &out.ScanOnOpen
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareAntivirusSpec.
+func (in *SmbShareAntivirusSpec) DeepCopy() *SmbShareAntivirusSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareAntivirusSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareCephFSSpec) DeepCopyInto(out *SmbShareCephFSSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareCephFSSpec.
+func (in *SmbShareCephFSSpec) DeepCopy() *SmbShareCephFSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareCephFSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareDosAttributeMappingSpec) DeepCopyInto(out *SmbShareDosAttributeMappingSpec) {
+	*out = *in
+	if in.Archive != nil {
+		in, out := &in.Archive, &out.Archive
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Hidden != nil {
+		in, out := &in.Hidden, &out.Hidden
+		*out = new(bool)
+		**out = **in
+	}
+	if in.System != nil {
+		in, out := &in.System, &out.System
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareDosAttributeMappingSpec.
+func (in *SmbShareDosAttributeMappingSpec) DeepCopy() *SmbShareDosAttributeMappingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareDosAttributeMappingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareEncryptionStatus) DeepCopyInto(out *SmbShareEncryptionStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareEncryptionStatus.
+func (in *SmbShareEncryptionStatus) DeepCopy() *SmbShareEncryptionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareEncryptionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareGlusterFSSpec) DeepCopyInto(out *SmbShareGlusterFSSpec) {
+	*out = *in
+	if in.Servers != nil {
+		in, out := &in.Servers, &out.Servers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareGlusterFSSpec.
+func (in *SmbShareGlusterFSSpec) DeepCopy() *SmbShareGlusterFSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareGlusterFSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareHealthCheckSpec) DeepCopyInto(out *SmbShareHealthCheckSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareHealthCheckSpec.
+func (in *SmbShareHealthCheckSpec) DeepCopy() *SmbShareHealthCheckSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareHealthCheckSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareHealthStatus) DeepCopyInto(out *SmbShareHealthStatus) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareHealthStatus.
+func (in *SmbShareHealthStatus) DeepCopy() *SmbShareHealthStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareHealthStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareHomeDirectoriesSpec) DeepCopyInto(out *SmbShareHomeDirectoriesSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareHomeDirectoriesSpec.
+func (in *SmbShareHomeDirectoriesSpec) DeepCopy() *SmbShareHomeDirectoriesSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareHomeDirectoriesSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareInitPermissionsSpec) DeepCopyInto(out *SmbShareInitPermissionsSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareInitPermissionsSpec.
+func (in *SmbShareInitPermissionsSpec) DeepCopy() *SmbShareInitPermissionsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareInitPermissionsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareList) DeepCopyInto(out *SmbShareList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SmbShare, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareList.
+func (in *SmbShareList) DeepCopy() *SmbShareList {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SmbShareList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareMSDFSLinkSpec) DeepCopyInto(out *SmbShareMSDFSLinkSpec) {
+	*out = *in
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareMSDFSLinkSpec.
+func (in *SmbShareMSDFSLinkSpec) DeepCopy() *SmbShareMSDFSLinkSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareMSDFSLinkSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareMSDFSSpec) DeepCopyInto(out *SmbShareMSDFSSpec) {
+	*out = *in
+	if in.Links != nil {
+		in, out := &in.Links, &out.Links
+		*out = make([]SmbShareMSDFSLinkSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareMSDFSSpec.
+func (in *SmbShareMSDFSSpec) DeepCopy() *SmbShareMSDFSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareMSDFSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareMacOSSpec) DeepCopyInto(out *SmbShareMacOSSpec) {
+	*out = *in
+	if in.Elasticsearch != nil {
+		in, out := &in.Elasticsearch, &out.Elasticsearch
+		*out = new(SmbSpotlightElasticsearch)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareMacOSSpec.
+func (in *SmbShareMacOSSpec) DeepCopy() *SmbShareMacOSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareMacOSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSharePodSettings) DeepCopyInto(out *SmbSharePodSettings) {
+	*out = *in
+	in.SmbPodSchedulingSettings.DeepCopyInto(&out.SmbPodSchedulingSettings)
+	if in.NetworkAttachments != nil {
+		in, out := &in.NetworkAttachments, &out.NetworkAttachments
+		*out = make([]SmbNetworkAttachment, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSharePodSettings.
+func (in *SmbSharePodSettings) DeepCopy() *SmbSharePodSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSharePodSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSharePvcSpec) DeepCopyInto(out *SmbSharePvcSpec) {
+	*out = *in
+	if in.Spec != nil {
+		in, out := &in.Spec, &out.Spec
+		*out = new(v1.PersistentVolumeClaimSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AccessModes != nil {
+		in, out := &in.AccessModes, &out.AccessModes
+		*out = make([]v1.PersistentVolumeAccessMode, len(*in))
+		copy(*out, *in)
+	}
+	if in.VolumeMode != nil {
+		in, out := &in.VolumeMode, &out.VolumeMode
+		*out = new(v1.PersistentVolumeMode)
+		**out = **in
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSharePvcSpec.
+func (in *SmbSharePvcSpec) DeepCopy() *SmbSharePvcSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSharePvcSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareQuotaSpec) DeepCopyInto(out *SmbShareQuotaSpec) {
+	*out = *in
+	out.Size = in.Size.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareQuotaSpec.
+func (in *SmbShareQuotaSpec) DeepCopy() *SmbShareQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareQuotaStatus) DeepCopyInto(out *SmbShareQuotaStatus) {
+	*out = *in
+	if in.Used != nil {
+		in, out := &in.Used, &out.Used
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareQuotaStatus.
+func (in *SmbShareQuotaStatus) DeepCopy() *SmbShareQuotaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareQuotaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareResourceRef) DeepCopyInto(out *SmbShareResourceRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareResourceRef.
+func (in *SmbShareResourceRef) DeepCopy() *SmbShareResourceRef {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareResourceRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareSpec) DeepCopyInto(out *SmbShareSpec) {
+	*out = *in
+	in.Storage.DeepCopyInto(&out.Storage)
+	if in.VetoFiles != nil {
+		in, out := &in.VetoFiles, &out.VetoFiles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.HideFiles != nil {
+		in, out := &in.HideFiles, &out.HideFiles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ACLCheckPermissions != nil {
+		in, out := &in.ACLCheckPermissions, &out.ACLCheckPermissions
+		*out = new(bool)
+		**out = **in
+	}
+	if in.HostsAllow != nil {
+		in, out := &in.HostsAllow, &out.HostsAllow
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.HostsDeny != nil {
+		in, out := &in.HostsDeny, &out.HostsDeny
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PreserveCase != nil {
+		in, out := &in.PreserveCase, &out.PreserveCase
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ShortPreserveCase != nil {
+		in, out := &in.ShortPreserveCase, &out.ShortPreserveCase
+		*out = new(bool)
+		**out = **in
+	}
+	if in.FollowSymlinks != nil {
+		in, out := &in.FollowSymlinks, &out.FollowSymlinks
+		*out = new(bool)
+		**out = **in
+	}
+	if in.MSDFS != nil {
+		in, out := &in.MSDFS, &out.MSDFS
+		*out = new(SmbShareMSDFSSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Oplocks != nil {
+		in, out := &in.Oplocks, &out.Oplocks
+		*out = new(bool)
+		**out = **in
+	}
+	if in.KernelOplocks != nil {
+		in, out := &in.KernelOplocks, &out.KernelOplocks
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Level2Oplocks != nil {
+		in, out := &in.Level2Oplocks, &out.Level2Oplocks
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Leases != nil {
+		in, out := &in.Leases, &out.Leases
+		*out = new(bool)
+		**out = **in
+	}
+	if in.StrictSync != nil {
+		in, out := &in.StrictSync, &out.StrictSync
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Interfaces != nil {
+		in, out := &in.Interfaces, &out.Interfaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = new(SmbShareUsersSpec)
+		**out = **in
+	}
+	if in.DNSAliases != nil {
+		in, out := &in.DNSAliases, &out.DNSAliases
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AccessControl != nil {
+		in, out := &in.AccessControl, &out.AccessControl
+		*out = new(SmbShareAccessControl)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HomeDirectories != nil {
+		in, out := &in.HomeDirectories, &out.HomeDirectories
+		*out = new(SmbShareHomeDirectoriesSpec)
+		**out = **in
+	}
+	if in.ACLs != nil {
+		in, out := &in.ACLs, &out.ACLs
+		*out = new(SmbShareACLSpec)
+		**out = **in
+	}
+	if in.StoreDosAttributes != nil {
+		in, out := &in.StoreDosAttributes, &out.StoreDosAttributes
+		*out = new(bool)
+		**out = **in
+	}
+	if in.DosAttributeMapping != nil {
+		in, out := &in.DosAttributeMapping, &out.DosAttributeMapping
+		*out = new(SmbShareDosAttributeMappingSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MacOS != nil {
+		in, out := &in.MacOS, &out.MacOS
+		*out = new(SmbShareMacOSSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VfsObjects != nil {
+		in, out := &in.VfsObjects, &out.VfsObjects
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodSettings != nil {
+		in, out := &in.PodSettings, &out.PodSettings
+		*out = new(SmbSharePodSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxConnections != nil {
+		in, out := &in.MaxConnections, &out.MaxConnections
+		*out = new(int32)
+		**out = **in
+	}
+	if in.DeletionProtection != nil {
+		in, out := &in.DeletionProtection, &out.DeletionProtection
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Quota != nil {
+		in, out := &in.Quota, &out.Quota
+		*out = new(SmbShareQuotaSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HealthCheck != nil {
+		in, out := &in.HealthCheck, &out.HealthCheck
+		*out = new(SmbShareHealthCheckSpec)
+		**out = **in
+	}
+	if in.Antivirus != nil {
+		in, out := &in.Antivirus, &out.Antivirus
+		*out = new(SmbShareAntivirusSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareSpec.
+func (in *SmbShareSpec) DeepCopy() *SmbShareSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareStatus) DeepCopyInto(out *SmbShareStatus) {
+	*out = *in
+	if in.Quota != nil {
+		in, out := &in.Quota, &out.Quota
+		*out = new(SmbShareQuotaStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ActiveConnections != nil {
+		in, out := &in.ActiveConnections, &out.ActiveConnections
+		*out = new(int32)
+		**out = **in
+	}
+	if in.EncryptionInEffect != nil {
+		in, out := &in.EncryptionInEffect, &out.EncryptionInEffect
+		*out = new(SmbShareEncryptionStatus)
+		**out = **in
+	}
+	if in.ProfileCounters != nil {
+		in, out := &in.ProfileCounters, &out.ProfileCounters
+		*out = make(map[string]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.NetworkAddresses != nil {
+		in, out := &in.NetworkAddresses, &out.NetworkAddresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]SmbShareResourceRef, len(*in))
+		copy(*out, *in)
+	}
+	if in.SelfTestPassed != nil {
+		in, out := &in.SelfTestPassed, &out.SelfTestPassed
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Health != nil {
+		in, out := &in.Health, &out.Health
+		*out = new(SmbShareHealthStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InfectedFiles != nil {
+		in, out := &in.InfectedFiles, &out.InfectedFiles
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareStatus.
 func (in *SmbShareStatus) DeepCopy() *SmbShareStatus {
@@ -439,6 +1957,21 @@ func (in *SmbShareStorageSpec) DeepCopyInto(out *SmbShareStorageSpec) {
 		*out = new(SmbSharePvcSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.CephFS != nil {
+		in, out := &in.CephFS, &out.CephFS
+		*out = new(SmbShareCephFSSpec)
+		**out = **in
+	}
+	if in.GlusterFS != nil {
+		in, out := &in.GlusterFS, &out.GlusterFS
+		*out = new(SmbShareGlusterFSSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InitPermissions != nil {
+		in, out := &in.InitPermissions, &out.InitPermissions
+		*out = new(SmbShareInitPermissionsSpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareStorageSpec.
@@ -450,3 +1983,173 @@ func (in *SmbShareStorageSpec) DeepCopy() *SmbShareStorageSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbShareUsersSpec) DeepCopyInto(out *SmbShareUsersSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbShareUsersSpec.
+func (in *SmbShareUsersSpec) DeepCopy() *SmbShareUsersSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbShareUsersSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbSpotlightElasticsearch) DeepCopyInto(out *SmbSpotlightElasticsearch) {
+	*out = *in
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbSpotlightElasticsearch.
+func (in *SmbSpotlightElasticsearch) DeepCopy() *SmbSpotlightElasticsearch {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbSpotlightElasticsearch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbUpdateStrategy) DeepCopyInto(out *SmbUpdateStrategy) {
+	*out = *in
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxSurge != nil {
+		in, out := &in.MaxSurge, &out.MaxSurge
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbUpdateStrategy.
+func (in *SmbUpdateStrategy) DeepCopy() *SmbUpdateStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbUpdateStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbUser) DeepCopyInto(out *SmbUser) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbUser.
+func (in *SmbUser) DeepCopy() *SmbUser {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbUser)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SmbUser) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbUserList) DeepCopyInto(out *SmbUserList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SmbUser, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbUserList.
+func (in *SmbUserList) DeepCopy() *SmbUserList {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbUserList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SmbUserList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbUserPasswordSpec) DeepCopyInto(out *SmbUserPasswordSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbUserPasswordSpec.
+func (in *SmbUserPasswordSpec) DeepCopy() *SmbUserPasswordSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbUserPasswordSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbUserSpec) DeepCopyInto(out *SmbUserSpec) {
+	*out = *in
+	out.Password = in.Password
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbUserSpec.
+func (in *SmbUserSpec) DeepCopy() *SmbUserSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbUserSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SmbUserStatus) DeepCopyInto(out *SmbUserStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SmbUserStatus.
+func (in *SmbUserStatus) DeepCopy() *SmbUserStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SmbUserStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,201 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// The types of v1beta1 are converted to and from the v1alpha1 hub. Most
+// fields have the same JSON form in both versions and are converted by
+// round-tripping through JSON. The fields that were restructured, the PVC
+// storage and network settings of SmbShare, are converted explicitly.
+
+// convertJSON converts src to dst through their JSON form. Fields of src
+// unknown to dst are dropped.
+func convertJSON(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// copyStringMap returns a copy of m, or nil if m is empty.
+func copyStringMap(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// ConvertTo converts this SmbShare to the hub version.
+func (s *SmbShare) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.SmbShare)
+	s.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	if err := convertJSON(&s.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	if err := convertJSON(&s.Status, &dst.Status); err != nil {
+		return err
+	}
+
+	if pvc := s.Spec.Storage.Pvc; pvc != nil {
+		dpvc := dst.Spec.Storage.Pvc
+		dpvc.Name = pvc.ClaimName
+		if t := pvc.Template; t != nil {
+			dpvc.Spec = t.Spec.DeepCopy()
+			dpvc.StorageClassName = t.StorageClassName
+			dpvc.AccessModes = append(
+				[]corev1.PersistentVolumeAccessMode(nil),
+				t.AccessModes...)
+			if t.VolumeMode != nil {
+				mode := *t.VolumeMode
+				dpvc.VolumeMode = &mode
+			}
+			dpvc.Annotations = copyStringMap(t.Annotations)
+		}
+	}
+	if n := s.Spec.Network; n != nil {
+		if n.Port != nil {
+			port := *n.Port
+			dst.Spec.Port = &port
+		}
+		dst.Spec.PublishDNSName = n.PublishDNSName
+		dst.Spec.DNSAliases = append([]string(nil), n.DNSAliases...)
+	}
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this SmbShare.
+func (s *SmbShare) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.SmbShare)
+	src.ObjectMeta.DeepCopyInto(&s.ObjectMeta)
+	if err := convertJSON(&src.Spec, &s.Spec); err != nil {
+		return err
+	}
+	if err := convertJSON(&src.Status, &s.Status); err != nil {
+		return err
+	}
+
+	if pvc := src.Spec.Storage.Pvc; pvc != nil {
+		spvc := s.Spec.Storage.Pvc
+		spvc.ClaimName = pvc.Name
+		if pvc.Spec != nil ||
+			pvc.StorageClassName != "" ||
+			len(pvc.AccessModes) != 0 ||
+			pvc.VolumeMode != nil ||
+			len(pvc.Annotations) != 0 {
+			// ---
+			spvc.Template = &SmbSharePvcTemplate{
+				Spec:             pvc.Spec.DeepCopy(),
+				StorageClassName: pvc.StorageClassName,
+				AccessModes: append(
+					[]corev1.PersistentVolumeAccessMode(nil),
+					pvc.AccessModes...),
+			}
+			if pvc.VolumeMode != nil {
+				mode := *pvc.VolumeMode
+				spvc.Template.VolumeMode = &mode
+			}
+			spvc.Template.Annotations = copyStringMap(pvc.Annotations)
+		}
+	}
+	if src.Spec.Port != nil ||
+		src.Spec.PublishDNSName != "" ||
+		len(src.Spec.DNSAliases) != 0 {
+		// ---
+		s.Spec.Network = &SmbShareNetworkSpec{
+			PublishDNSName: src.Spec.PublishDNSName,
+			DNSAliases:     append([]string(nil), src.Spec.DNSAliases...),
+		}
+		if src.Spec.Port != nil {
+			port := *src.Spec.Port
+			s.Spec.Network.Port = &port
+		}
+	}
+	return nil
+}
+
+// ConvertTo converts this SmbSecurityConfig to the hub version.
+func (c *SmbSecurityConfig) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.SmbSecurityConfig)
+	c.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	if err := convertJSON(&c.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	return convertJSON(&c.Status, &dst.Status)
+}
+
+// ConvertFrom converts from the hub version to this SmbSecurityConfig.
+func (c *SmbSecurityConfig) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.SmbSecurityConfig)
+	src.ObjectMeta.DeepCopyInto(&c.ObjectMeta)
+	if err := convertJSON(&src.Spec, &c.Spec); err != nil {
+		return err
+	}
+	return convertJSON(&src.Status, &c.Status)
+}
+
+// ConvertTo converts this SmbCommonConfig to the hub version.
+func (c *SmbCommonConfig) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.SmbCommonConfig)
+	c.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	if err := convertJSON(&c.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	return convertJSON(&c.Status, &dst.Status)
+}
+
+// ConvertFrom converts from the hub version to this SmbCommonConfig.
+func (c *SmbCommonConfig) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.SmbCommonConfig)
+	src.ObjectMeta.DeepCopyInto(&c.ObjectMeta)
+	if err := convertJSON(&src.Spec, &c.Spec); err != nil {
+		return err
+	}
+	return convertJSON(&src.Status, &c.Status)
+}
+
+// ConvertTo converts this SmbUser to the hub version.
+func (u *SmbUser) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.SmbUser)
+	u.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	if err := convertJSON(&u.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	return convertJSON(&u.Status, &dst.Status)
+}
+
+// ConvertFrom converts from the hub version to this SmbUser.
+func (u *SmbUser) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.SmbUser)
+	src.ObjectMeta.DeepCopyInto(&u.ObjectMeta)
+	if err := convertJSON(&src.Spec, &u.Spec); err != nil {
+		return err
+	}
+	return convertJSON(&src.Status, &u.Status)
+}
@@ -0,0 +1,273 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+	"github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+const fuzzIterations = 200
+
+// newFuzzer returns a fuzzer filling objects with values that survive
+// being serialized, as all objects stored by the API server are.
+func newFuzzer() *fuzz.Fuzzer {
+	return fuzz.New().NilChance(0.3).NumElements(0, 3).Funcs(
+		func(q *resource.Quantity, c fuzz.Continue) {
+			*q = *resource.NewQuantity(c.Int63n(1<<40), resource.BinarySI)
+		},
+		func(t *metav1.Time, c fuzz.Continue) {
+			*t = metav1.Unix(c.Int63n(1<<32), 0)
+		},
+		func(v *intstr.IntOrString, c fuzz.Continue) {
+			if c.RandBool() {
+				*v = intstr.FromInt(c.Intn(100))
+			} else {
+				*v = intstr.FromString(c.RandString())
+			}
+		},
+	)
+}
+
+func assertSemanticEqual(t *testing.T, expected, actual interface{}) {
+	assert.True(t,
+		apiequality.Semantic.DeepEqual(expected, actual),
+		diff.ObjectReflectDiff(expected, actual))
+}
+
+func TestIsConvertible(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	require.NoError(t, AddToScheme(scheme))
+	for _, obj := range []runtime.Object{
+		&SmbShare{},
+		&SmbSecurityConfig{},
+		&SmbCommonConfig{},
+		&SmbUser{},
+	} {
+		ok, err := conversion.IsConvertible(scheme, obj)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+}
+
+func TestSmbShareRoundTrip(t *testing.T) {
+	f := newFuzzer()
+	for i := 0; i < fuzzIterations; i++ {
+		src := &v1alpha1.SmbShare{}
+		src.Name = "myshare"
+		f.Fuzz(&src.Spec)
+		f.Fuzz(&src.Status)
+
+		beta := &SmbShare{}
+		require.NoError(t, beta.ConvertFrom(src))
+		dst := &v1alpha1.SmbShare{}
+		require.NoError(t, beta.ConvertTo(dst))
+		assertSemanticEqual(t, src, dst)
+	}
+}
+
+func TestSmbSecurityConfigRoundTrip(t *testing.T) {
+	f := newFuzzer()
+	for i := 0; i < fuzzIterations; i++ {
+		src := &v1alpha1.SmbSecurityConfig{}
+		src.Name = "mysec"
+		f.Fuzz(&src.Spec)
+		f.Fuzz(&src.Status)
+
+		beta := &SmbSecurityConfig{}
+		require.NoError(t, beta.ConvertFrom(src))
+		dst := &v1alpha1.SmbSecurityConfig{}
+		require.NoError(t, beta.ConvertTo(dst))
+		assertSemanticEqual(t, src, dst)
+	}
+}
+
+func TestSmbCommonConfigRoundTrip(t *testing.T) {
+	f := newFuzzer()
+	for i := 0; i < fuzzIterations; i++ {
+		src := &v1alpha1.SmbCommonConfig{}
+		src.Name = "mycommon"
+		f.Fuzz(&src.Spec)
+		f.Fuzz(&src.Status)
+
+		beta := &SmbCommonConfig{}
+		require.NoError(t, beta.ConvertFrom(src))
+		dst := &v1alpha1.SmbCommonConfig{}
+		require.NoError(t, beta.ConvertTo(dst))
+		assertSemanticEqual(t, src, dst)
+	}
+}
+
+func TestSmbUserRoundTrip(t *testing.T) {
+	f := newFuzzer()
+	for i := 0; i < fuzzIterations; i++ {
+		src := &v1alpha1.SmbUser{}
+		src.Name = "myuser"
+		f.Fuzz(&src.Spec)
+		f.Fuzz(&src.Status)
+
+		beta := &SmbUser{}
+		require.NoError(t, beta.ConvertFrom(src))
+		dst := &v1alpha1.SmbUser{}
+		require.NoError(t, beta.ConvertTo(dst))
+		assertSemanticEqual(t, src, dst)
+	}
+}
+
+func TestSmbShareConvertFrom(t *testing.T) {
+	port := int32(4450)
+	storageClass := "fast"
+	filesystem := corev1.PersistentVolumeFilesystem
+	src := &v1alpha1.SmbShare{}
+	src.Name = "myshare"
+	src.Namespace = "default"
+	src.Spec.ShareName = "My Share"
+	src.Spec.ReadOnly = true
+	src.Spec.Port = &port
+	src.Spec.PublishDNSName = "share.example.com"
+	src.Spec.DNSAliases = []string{"files"}
+	src.Spec.Storage.Pvc = &v1alpha1.SmbSharePvcSpec{
+		Spec: &corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &storageClass,
+		},
+		StorageClassName: "faster",
+		AccessModes: []corev1.PersistentVolumeAccessMode{
+			corev1.ReadWriteMany,
+		},
+		VolumeMode:   &filesystem,
+		Annotations:  map[string]string{"backup.example.com/include": "true"},
+		RetainPolicy: "Retain",
+	}
+	src.Status.ServerGroup = "myshare"
+	src.Status.Port = 4450
+
+	dst := &SmbShare{}
+	require.NoError(t, dst.ConvertFrom(src))
+	assert.Equal(t, "myshare", dst.Name)
+	assert.Equal(t, "default", dst.Namespace)
+	assert.Equal(t, "My Share", dst.Spec.ShareName)
+	assert.True(t, dst.Spec.ReadOnly)
+	if assert.NotNil(t, dst.Spec.Network) {
+		if assert.NotNil(t, dst.Spec.Network.Port) {
+			assert.Equal(t, int32(4450), *dst.Spec.Network.Port)
+		}
+		assert.Equal(t,
+			"share.example.com", dst.Spec.Network.PublishDNSName)
+		assert.Equal(t, []string{"files"}, dst.Spec.Network.DNSAliases)
+	}
+	if assert.NotNil(t, dst.Spec.Storage.Pvc) {
+		pvc := dst.Spec.Storage.Pvc
+		assert.Equal(t, "", pvc.ClaimName)
+		assert.Equal(t, "Retain", pvc.RetainPolicy)
+		if assert.NotNil(t, pvc.Template) {
+			assert.Equal(t, src.Spec.Storage.Pvc.Spec, pvc.Template.Spec)
+			assert.Equal(t, "faster", pvc.Template.StorageClassName)
+			assert.Equal(t,
+				[]corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+				pvc.Template.AccessModes)
+			assert.Equal(t, &filesystem, pvc.Template.VolumeMode)
+			assert.Equal(t,
+				map[string]string{"backup.example.com/include": "true"},
+				pvc.Template.Annotations)
+		}
+	}
+	assert.Equal(t, "myshare", dst.Status.ServerGroup)
+	assert.Equal(t, int32(4450), dst.Status.Port)
+
+	// an existing PVC has no template, and shares without network
+	// settings no network section
+	src = &v1alpha1.SmbShare{}
+	src.Spec.Storage.Pvc = &v1alpha1.SmbSharePvcSpec{Name: "mypvc"}
+	dst = &SmbShare{}
+	require.NoError(t, dst.ConvertFrom(src))
+	assert.Nil(t, dst.Spec.Network)
+	if assert.NotNil(t, dst.Spec.Storage.Pvc) {
+		assert.Equal(t, "mypvc", dst.Spec.Storage.Pvc.ClaimName)
+		assert.Nil(t, dst.Spec.Storage.Pvc.Template)
+	}
+}
+
+func TestSmbShareConvertTo(t *testing.T) {
+	port := int32(8445)
+	filesystem := corev1.PersistentVolumeFilesystem
+	src := &SmbShare{}
+	src.Name = "myshare"
+	src.Spec.Browseable = true
+	src.Spec.Network = &SmbShareNetworkSpec{
+		Port:           &port,
+		PublishDNSName: "share.example.com",
+	}
+	src.Spec.Storage.Pvc = &SmbSharePvcSpec{
+		Template: &SmbSharePvcTemplate{
+			Spec: &corev1.PersistentVolumeClaimSpec{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse("1Gi"),
+					},
+				},
+			},
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteOnce,
+			},
+			VolumeMode:  &filesystem,
+			Annotations: map[string]string{"backup.example.com/exclude": "true"},
+		},
+		RetainPolicy: "Delete",
+	}
+
+	dst := &v1alpha1.SmbShare{}
+	require.NoError(t, src.ConvertTo(dst))
+	assert.Equal(t, "myshare", dst.Name)
+	assert.True(t, dst.Spec.Browseable)
+	if assert.NotNil(t, dst.Spec.Port) {
+		assert.Equal(t, int32(8445), *dst.Spec.Port)
+	}
+	assert.Equal(t, "share.example.com", dst.Spec.PublishDNSName)
+	assert.Len(t, dst.Spec.DNSAliases, 0)
+	if assert.NotNil(t, dst.Spec.Storage.Pvc) {
+		pvc := dst.Spec.Storage.Pvc
+		assert.Equal(t, "", pvc.Name)
+		assert.Equal(t, src.Spec.Storage.Pvc.Template.Spec, pvc.Spec)
+		assert.Equal(t,
+			[]corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			pvc.AccessModes)
+		assert.Equal(t, &filesystem, pvc.VolumeMode)
+		assert.Equal(t,
+			map[string]string{"backup.example.com/exclude": "true"},
+			pvc.Annotations)
+		assert.Equal(t, "Delete", pvc.RetainPolicy)
+	}
+
+	// converting back gives the original share
+	back := &SmbShare{}
+	require.NoError(t, back.ConvertFrom(dst))
+	assertSemanticEqual(t, src, back)
+}
@@ -0,0 +1,854 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// SmbCommonConfigSpec values act as a template for properties of the services
+// that will host shares.
+type SmbCommonConfigSpec struct {
+	// Network specifies what kind of networking shares associated with
+	// this config will use.
+	// +kubebuilder:validation:Required
+	Network SmbCommonNetworkSpec `json:"network,omitempty"`
+
+	// PodSettings are configuration values that are applied to pods that
+	// the operator may create in order to host shares.
+	// +optional
+	PodSettings *SmbCommonPodSettings `json:"podSettings,omitempty"`
+
+	// WorkloadType is the kind of workload running the pods hosting shares,
+	// "deployment", the default, or "statefulset". The pods of a
+	// StatefulSet have a stable name, such as "myshare-0", resolving in DNS
+	// through a headless service. StatefulSets do not support the update
+	// strategy or the scheduled restarts of the pods.
+	// +kubebuilder:validation:Enum:=deployment;statefulset
+	// +optional
+	WorkloadType string `json:"workloadType,omitempty"`
+
+	// UpdateStrategy controls how the pods hosting shares are replaced
+	// when their configuration changes. If unset, the Kubernetes default
+	// rolling update is used.
+	// +optional
+	UpdateStrategy *SmbUpdateStrategy `json:"updateStrategy,omitempty"`
+
+	// DisruptionBudget configures the PodDisruptionBudgets that protect the
+	// pods hosting shares from voluntary disruptions, such as node drains.
+	// +optional
+	DisruptionBudget *SmbDisruptionBudgetSpec `json:"disruptionBudget,omitempty"`
+
+	// Images overrides the container images used by pods that host
+	// shares. If unset, the operator's configured images are used.
+	// +optional
+	Images *SmbCommonImages `json:"images,omitempty"`
+
+	// MaxSmbdProcesses limits the number of smbd processes, and so the
+	// number of connected clients, of each pod hosting shares. Clients are
+	// refused once the limit is reached. No limit applies if unset.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	MaxSmbdProcesses *int32 `json:"maxSmbdProcesses,omitempty"`
+
+	// DeletionProtection refuses to delete the shares using this
+	// SmbCommonConfig while clients are connected to them, unless an
+	// SmbShare is annotated with samba-operator.samba.org/force-delete:
+	// "true".
+	// +optional
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+
+	// PrintServices shares the printers of a CUPS server reachable by the
+	// samba servers, through a [printers] share. By default printing is
+	// disabled: printers are not loaded, no printer shares are defined and
+	// the spoolss service is turned off.
+	// +optional
+	PrintServices bool `json:"printServices,omitempty"`
+
+	// Profiling turns on the profiling of smbd, which counts and times
+	// the system calls and SMB requests of the samba servers. The counters
+	// are reported in the status of the shares. Profiling adds to the work
+	// of the servers, so it is off by default.
+	// +optional
+	Profiling bool `json:"profiling,omitempty"`
+
+	// CustomConfig supplies a complete smb.conf for the samba servers of
+	// the shares using this SmbCommonConfig. The operator then only manages
+	// the pods, services and storage of the shares: the configuration it
+	// generates from the SmbShares is replaced by the supplied file, which
+	// must define the shares and the security settings itself.
+	// +optional
+	CustomConfig *SmbCustomConfig `json:"customConfig,omitempty"`
+
+	// Debug settings help investigating problems of the samba servers of
+	// the shares using this SmbCommonConfig.
+	// +optional
+	Debug *SmbDebugSpec `json:"debug,omitempty"`
+
+	// ServerString is the description of the samba servers shown to
+	// clients, for example in network discovery.
+	// +kubebuilder:validation:MaxLength:=256
+	// +optional
+	ServerString string `json:"serverString,omitempty"`
+
+	// NetbiosName is the NetBIOS name of the samba servers. It defaults to
+	// the name of the server group of the shares.
+	// +kubebuilder:validation:MaxLength:=15
+	// +kubebuilder:validation:Pattern=`^[A-Z0-9][A-Z0-9_-]*$`
+	// +optional
+	NetbiosName string `json:"netbiosName,omitempty"`
+
+	// Workgroup is the workgroup of shares using user security. The
+	// workgroup of domain members is derived from the realm of their
+	// SmbSecurityConfig, and may only be set to the same name.
+	// +kubebuilder:validation:MaxLength:=15
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9][A-Za-z0-9_-]*$`
+	// +optional
+	Workgroup string `json:"workgroup,omitempty"`
+
+	// Performance tunes the I/O of the samba servers. Unset values use the
+	// defaults of samba.
+	// +optional
+	Performance *SmbPerformanceSpec `json:"performance,omitempty"`
+
+	// Sessions controls how long idle client sessions are kept by the
+	// samba servers. Unset values use the defaults of samba.
+	// +optional
+	Sessions *SmbSessionsSpec `json:"sessions,omitempty"`
+
+	// Maintenance schedules maintenance of the pods hosting shares.
+	// +optional
+	Maintenance *SmbMaintenanceSpec `json:"maintenance,omitempty"`
+
+	// Metrics runs a metrics exporter next to the samba servers of the
+	// shares using this SmbCommonConfig, serving Prometheus metrics on the
+	// "metrics" port of a Service named after the server group with a
+	// "-metrics" suffix.
+	// +optional
+	Metrics *SmbMetricsSpec `json:"metrics,omitempty"`
+
+	// CommonLabels are added to the resources the operator creates for the
+	// shares using this SmbCommonConfig, such as their Deployments,
+	// Services, PVCs and ConfigMaps. The labels the operator relies on,
+	// those prefixed with samba-operator.samba.org/ and the
+	// app.kubernetes.io labels it sets, can not be overridden. Labels
+	// removed from CommonLabels are removed from the resources.
+	// +optional
+	CommonLabels map[string]string `json:"commonLabels,omitempty"`
+}
+
+// SmbMetricsSpec configures the metrics exporter of the pods hosting
+// shares.
+type SmbMetricsSpec struct {
+	// ServiceMonitor makes the operator create a Prometheus Operator
+	// ServiceMonitor scraping the metrics of the servers. It is ignored if
+	// the ServiceMonitor API is not available in the cluster.
+	// +optional
+	ServiceMonitor *SmbServiceMonitorSpec `json:"serviceMonitor,omitempty"`
+}
+
+// SmbServiceMonitorSpec configures the ServiceMonitor of the metrics
+// exporters.
+type SmbServiceMonitorSpec struct {
+	// Interval is how often Prometheus scrapes the metrics, for example
+	// "30s". The interval configured in Prometheus is used if unset.
+	// +kubebuilder:validation:Pattern=`^([0-9]+(ms|s|m|h))+$`
+	// +optional
+	Interval string `json:"interval,omitempty"`
+
+	// Labels are added to the ServiceMonitor, such as the labels the
+	// serviceMonitorSelector of a Prometheus resource matches.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// SmbPerformanceSpec tunes the I/O of the samba servers. The settings apply
+// to all the shares of the servers.
+type SmbPerformanceSpec struct {
+	// AioReadSize is the size, in bytes, from which reads are served
+	// asynchronously, letting smbd serve other requests of the client
+	// meanwhile. Zero serves all reads synchronously. Samba's default of 1
+	// serves all reads asynchronously.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	AioReadSize *int64 `json:"aioReadSize,omitempty"`
+
+	// AioWriteSize is the size, in bytes, from which writes are made
+	// asynchronously. Zero makes all writes synchronously. Samba's default
+	// of 1 makes all writes asynchronously.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	AioWriteSize *int64 `json:"aioWriteSize,omitempty"`
+
+	// AioMaxThreads is the maximum number of threads of each smbd process
+	// serving asynchronous I/O. Samba's default is 100.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	AioMaxThreads *int32 `json:"aioMaxThreads,omitempty"`
+
+	// UseSendfile lets the kernel send the data of reads to the clients
+	// directly from the files, which saves copies on local file systems.
+	// Samba's default is false.
+	// +optional
+	UseSendfile *bool `json:"useSendfile,omitempty"`
+
+	// ReadRaw allows the raw reads of SMB1 clients. Samba's default is
+	// true.
+	// +optional
+	ReadRaw *bool `json:"readRaw,omitempty"`
+
+	// WriteRaw allows the raw writes of SMB1 clients. Samba's default is
+	// true.
+	// +optional
+	WriteRaw *bool `json:"writeRaw,omitempty"`
+
+	// SMB2MaxRead is the largest read, in bytes, that SMB2 clients are
+	// allowed to request. Samba's default is 8 MiB.
+	// +kubebuilder:validation:Minimum:=65536
+	// +optional
+	SMB2MaxRead *int64 `json:"smb2MaxRead,omitempty"`
+
+	// SMB2MaxWrite is the largest write, in bytes, that SMB2 clients are
+	// allowed to request. Samba's default is 8 MiB.
+	// +kubebuilder:validation:Minimum:=65536
+	// +optional
+	SMB2MaxWrite *int64 `json:"smb2MaxWrite,omitempty"`
+
+	// MinReceivefileSize is the size, in bytes, from which the data of the
+	// writes of SMB2 clients is received straight into the files, without
+	// being copied through the buffers of smbd. It has no effect on signed
+	// or encrypted connections. It must not be larger than the largest
+	// write the servers allow. Zero, samba's default, disables the zero-copy
+	// receive path.
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:validation:Maximum:=16777216
+	// +optional
+	MinReceivefileSize *int64 `json:"minReceivefileSize,omitempty"`
+
+	// AioWriteBehind lists the patterns of the names of files whose writes
+	// are acknowledged to the clients before they reach the storage, such
+	// as "*.tmp". Data written to these files may be lost if the servers
+	// fail. Patterns may not contain "/".
+	// +optional
+	AioWriteBehind []string `json:"aioWriteBehind,omitempty"`
+}
+
+// SmbSessionsSpec controls how long the samba servers keep idle client
+// sessions. The settings apply to all the shares of the servers.
+type SmbSessionsSpec struct {
+	// Deadtime is the number of minutes after which the sessions of
+	// clients without open files are closed. Clients reconnect without
+	// notice when they are used again. Zero, samba's default, keeps idle
+	// sessions open.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	Deadtime *int32 `json:"deadtime,omitempty"`
+
+	// Keepalive is the number of seconds between the checks that the
+	// clients of the sessions are still reachable, which close the
+	// sessions of vanished clients. Zero disables the checks. Samba's
+	// default is 300.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	Keepalive *int32 `json:"keepalive,omitempty"`
+
+	// SMB2MaxCredits is the number of credits, bounding the requests an
+	// SMB2 client may have outstanding, that the servers grant to each
+	// client. Samba's default is 8192.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	SMB2MaxCredits *int32 `json:"smb2MaxCredits,omitempty"`
+}
+
+// SmbMaintenanceSpec schedules maintenance of the pods hosting shares.
+type SmbMaintenanceSpec struct {
+	// RestartSchedule is a cron schedule, in UTC, of the rolling restarts
+	// of the pods hosting shares, for example "0 3 * * 0" for every Sunday
+	// at 3:00. The pods are replaced following the update strategy, and
+	// clients are given the termination grace period to finish their
+	// work. A restart is skipped while the pods are being replaced.
+	// +kubebuilder:validation:MinLength:=1
+	// +optional
+	RestartSchedule string `json:"restartSchedule,omitempty"`
+}
+
+// SmbDebugSpec configures the debugging aids of the samba servers.
+type SmbDebugSpec struct {
+	// LogLevel sets the debug level, from 0 to 10, of the samba servers,
+	// overriding the level configured for the operator.
+	// +kubebuilder:validation:Pattern=`^([0-9]|10)$`
+	// +optional
+	LogLevel string `json:"logLevel,omitempty"`
+
+	// LogTo selects where the samba servers write their logs. With
+	// "stdout" the logs are written to the output of the containers,
+	// leaving their rotation to Kubernetes, and with "file" samba writes a
+	// log file per client in /var/log/samba, which it rotates once it
+	// reaches MaxLogSize. The containers log to stdout when unset.
+	// +kubebuilder:validation:Enum:=stdout;file
+	// +optional
+	LogTo string `json:"logTo,omitempty"`
+
+	// MaxLogSize is the size, in kilobytes, at which samba rotates a log
+	// file, keeping the previous file as a .old file. Zero disables the
+	// rotation. Only used when logging to files, and defaults to samba's
+	// 5000.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	MaxLogSize *int32 `json:"maxLogSize,omitempty"`
+
+	// CollectCores makes the samba servers write core dumps, and a log of
+	// their panics, to a volume of their pod, where they are kept across
+	// restarts of the containers. Off by default, as core dumps use a lot
+	// of disk space.
+	// +optional
+	CollectCores bool `json:"collectCores,omitempty"`
+
+	// CoresSizeLimit limits the size of the volume holding the core dumps.
+	// Defaults to 1Gi.
+	// +optional
+	CoresSizeLimit *resource.Quantity `json:"coresSizeLimit,omitempty"`
+}
+
+// SmbCustomConfig names the ConfigMap holding a smb.conf supplied by the
+// user.
+type SmbCustomConfig struct {
+	// ConfigMap is the name of the ConfigMap, in the operator's working
+	// namespace, holding the smb.conf.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	ConfigMap string `json:"configMap"`
+
+	// Key is the key of the ConfigMap holding the smb.conf.
+	// +kubebuilder:default:=smb.conf
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// SmbUpdateStrategy configures the update strategy of the workloads that
+// run the pods hosting shares.
+type SmbUpdateStrategy struct {
+	// Type is either RollingUpdate, replacing pods gradually, or Recreate,
+	// stopping all existing pods before new pods are started.
+	// +kubebuilder:validation:Enum:=RollingUpdate;Recreate
+	// +kubebuilder:default:=RollingUpdate
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// MaxUnavailable is the number, or percentage, of pods that may be
+	// unavailable during a rolling update.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// MaxSurge is the number, or percentage, of pods that may be created
+	// above the desired number of pods during a rolling update.
+	// +optional
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+}
+
+// SmbDisruptionBudgetSpec configures the PodDisruptionBudgets created for
+// the pods hosting shares. A PodDisruptionBudget is always created for
+// shares with more than one replica. If neither MinAvailable nor
+// MaxUnavailable are set, one pod of such shares may be unavailable.
+type SmbDisruptionBudgetSpec struct {
+	// MinAvailable is the number, or percentage, of a share's pods that
+	// must remain available during voluntary disruptions. If set,
+	// MaxUnavailable is ignored.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable is the number, or percentage, of a share's pods
+	// that may be unavailable during voluntary disruptions.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// SingleReplica creates PodDisruptionBudgets for shares with a single
+	// replica as well. Unless MinAvailable or MaxUnavailable are set, the
+	// pod of such a share may not be evicted, forcing it to be removed
+	// explicitly.
+	// +optional
+	SingleReplica bool `json:"singleReplica,omitempty"`
+}
+
+// SmbCommonImages specifies alternate container images for the pods that
+// host shares.
+type SmbCommonImages struct {
+	// Samba specifies the image running the samba server components.
+	// +optional
+	Samba *SmbContainerImage `json:"samba,omitempty"`
+
+	// DNSRegister specifies the image running the dns-register sidecar.
+	// +optional
+	DNSRegister *SmbContainerImage `json:"dnsRegister,omitempty"`
+
+	// SvcWatch specifies the image running the svc-watch sidecar.
+	// +optional
+	SvcWatch *SmbContainerImage `json:"svcWatch,omitempty"`
+
+	// Metrics specifies the image running the metrics exporter sidecar.
+	// +optional
+	Metrics *SmbContainerImage `json:"metrics,omitempty"`
+
+	// ClamAV specifies the image running the ClamAV sidecar of the shares
+	// scanned for viruses.
+	// +optional
+	ClamAV *SmbContainerImage `json:"clamav,omitempty"`
+}
+
+// SmbContainerImage identifies a container image.
+type SmbContainerImage struct {
+	// Repository is the image repository, including the registry host,
+	// for example: registry.example.com/samba/samba-server
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	Repository string `json:"repository"`
+
+	// Tag of the image. If unset, the container runtime's default tag is
+	// used.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+}
+
+// SmbCommonNetworkSpec values define networking properties for the services
+// that will host shares.
+type SmbCommonNetworkSpec struct {
+	// Publish broadly specifies what kind of networking shares associated with
+	// this config are expected to use. Shares published with "route" are
+	// exposed on the ports of the cluster nodes, for clusters, such as
+	// OpenShift, where Routes are used instead of cloud load balancers.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum:=cluster;external;route
+	Publish string `json:"publish,omitempty"`
+
+	// Port is the TCP port shares are served on, instead of the standard
+	// SMB port 445.
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=65535
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+
+	// IPFamilyPolicy selects if the Services of shares are single-stack or
+	// dual-stack. If unset, the cluster's default, SingleStack, is used.
+	// Requires Kubernetes 1.20 or later.
+	// +kubebuilder:validation:Enum:=SingleStack;PreferDualStack;RequireDualStack
+	// +optional
+	IPFamilyPolicy string `json:"ipFamilyPolicy,omitempty"`
+
+	// IPFamilies lists the IP families of the Services of shares in order
+	// of preference. The first family is the primary family of a Service and
+	// can not be changed once the Service exists. If unset, the cluster's
+	// default family is used. Requires Kubernetes 1.20 or later.
+	// +kubebuilder:validation:MaxItems:=2
+	// +optional
+	IPFamilies []SmbIPFamily `json:"ipFamilies,omitempty"`
+
+	// Interfaces lists the network interfaces, by name or by CIDR, that
+	// the samba servers of the shares listen on, such as the interface of
+	// a secondary storage network. If unset, the servers listen on all the
+	// interfaces of their pods.
+	// +optional
+	Interfaces []string `json:"interfaces,omitempty"`
+
+	// MultiChannel turns on SMB3 multichannel, letting clients spread the
+	// traffic of a session over several connections to the network
+	// interfaces the samba servers advertise: those listed by Interfaces,
+	// or all the interfaces of the pods. Multichannel is only of use to pods
+	// with several interfaces, such as secondary networks attached with
+	// NetworkAttachments, that clients can reach directly. Samba considers
+	// multichannel experimental on some platforms, so it is off by default.
+	// +optional
+	MultiChannel bool `json:"multiChannel,omitempty"`
+
+	// SocketOptions lists the options samba sets on the TCP connections of
+	// the clients, as NAME or NAME=value, such as SO_KEEPALIVE and
+	// TCP_KEEPIDLE=60 to keep idle connections alive through load
+	// balancers that drop them. Only the options samba knows are accepted.
+	// +optional
+	SocketOptions []string `json:"socketOptions,omitempty"`
+
+	// ServiceSessionAffinity configures the session affinity of the
+	// Services of shares served by more than one pod, which must send all
+	// the connections of a client to the same pod. Defaults to ClientIP
+	// affinity. It has no effect on shares served by a single pod.
+	// +optional
+	ServiceSessionAffinity *SmbServiceSessionAffinity `json:"serviceSessionAffinity,omitempty"`
+}
+
+// SmbServiceSessionAffinity configures the session affinity of a Service.
+type SmbServiceSessionAffinity struct {
+	// Type is either ClientIP, sending the connections of a client to the
+	// same pod, or None.
+	// +kubebuilder:validation:Enum:=ClientIP;None
+	// +kubebuilder:default:=ClientIP
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// TimeoutSeconds is the time the connections of a client are sent to
+	// the same pod after its last connection with ClientIP affinity.
+	// Defaults to 10800 seconds, three hours.
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=86400
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// SmbIPFamily is an IP family.
+// +kubebuilder:validation:Enum:=IPv4;IPv6
+type SmbIPFamily string
+
+// SmbCommonPodSettings contains values pertaining to the customization
+// of pods that host shares.
+type SmbCommonPodSettings struct {
+	SmbPodSchedulingSettings `json:",inline"`
+
+	// ImagePullSecrets lists secrets, in the operator's working namespace,
+	// used to pull the images of the pods.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// SecurityContext specifies security settings for the pods that host
+	// shares.
+	// +optional
+	SecurityContext *SmbPodSecurityContext `json:"securityContext,omitempty"`
+
+	// ReadOnlyRootFilesystem mounts the root file systems of the containers
+	// read-only. The paths samba writes to are mounted from emptyDir
+	// volumes, and the accounts files of the samba containers are copied
+	// to a volume by an init container.
+	// +optional
+	ReadOnlyRootFilesystem bool `json:"readOnlyRootFilesystem,omitempty"`
+
+	// PriorityClassName is the name of the PriorityClass of the pods that
+	// host shares.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// TerminationGracePeriodSeconds is the time a stopping pod is given to
+	// let the clients of the share finish their work, before the samba
+	// server is stopped. Defaults to 60 seconds.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// StartupTimeoutSeconds is the time a pod that hosts shares may take
+	// to become ready, pulling its images, joining the domain and waiting
+	// for its storage, before the shares are reported as degraded. While
+	// the pod starts the shares are marked as progressing. Defaults to the
+	// operator's startup timeout.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	StartupTimeoutSeconds *int32 `json:"startupTimeoutSeconds,omitempty"`
+
+	// SELinuxOptions sets the SELinux context of the pods that host shares.
+	// Volumes that support SELinux relabeling, such as most PVCs, are
+	// labeled to match this context. Unset fields use the container
+	// runtime's defaults, which the samba container image works with.
+	// +optional
+	SELinuxOptions *SmbSELinuxOptions `json:"seLinuxOptions,omitempty"`
+
+	// ExtraMounts lists ConfigMaps and Secrets, in the operator's working
+	// namespace, that are mounted into the samba server containers of the
+	// pods that host shares.
+	// +optional
+	ExtraMounts []SmbExtraMount `json:"extraMounts,omitempty"`
+
+	// NetworkAttachments lists the Multus NetworkAttachmentDefinitions the
+	// pods that host shares are attached to, in addition to the cluster
+	// network.
+	// +optional
+	NetworkAttachments []SmbNetworkAttachment `json:"networkAttachments,omitempty"`
+
+	// Probes tunes the health checks of the smbd containers of the pods
+	// that host shares. Unset values use the operator's defaults.
+	// +optional
+	Probes *SmbProbesSettings `json:"probes,omitempty"`
+
+	// ExtraEnv lists environment variables set in the samba server
+	// containers of the pods that host shares, such as variables enabling
+	// features of the samba container image. Variables the operator
+	// manages, like SAMBA_CONTAINER_ID and those prefixed with SAMBACC_,
+	// can not be set.
+	// +optional
+	ExtraEnv []SmbEnvVar `json:"extraEnv,omitempty"`
+
+	// ExtraContainers lists sidecar containers added to the pods that host
+	// shares, such as metrics agents, file synchronization daemons or virus
+	// scanners. The containers are added as they are, after those of the
+	// operator, whose names they can not take. Their volume mounts refer
+	// to the volumes of the pods by name; the "share-data" volume is the
+	// PVC of the share.
+	// +optional
+	ExtraContainers []corev1.Container `json:"extraContainers,omitempty"`
+
+	// ContainerArgs lists arguments passed to the samba-container command
+	// of the samba server containers, ahead of the command running the
+	// server.
+	// +optional
+	ContainerArgs []string `json:"containerArgs,omitempty"`
+
+	// Resources sets the compute resource requests and limits of the smbd
+	// containers of the pods that host shares. Each request and limit
+	// overrides the same one of the operator's defaults and, for shares
+	// referring to another common config, of the default common config of
+	// the namespace.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// SmbEnvVar is an environment variable of the samba server containers.
+type SmbEnvVar struct {
+	// Name is the name of the variable.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern:=`^[A-Za-z_][A-Za-z0-9_]*$`
+	Name string `json:"name"`
+
+	// Value is the value of the variable.
+	// +optional
+	Value string `json:"value,omitempty"`
+}
+
+// SmbProbesSettings tunes the startup, liveness and readiness probes of the
+// smbd containers.
+type SmbProbesSettings struct {
+	// Startup tunes the probe that delays the liveness and readiness
+	// probes until smbd listens. It defaults to checking every 10 seconds
+	// for up to 5 minutes, which leaves time for joining a domain.
+	// +optional
+	Startup *SmbProbeSettings `json:"startup,omitempty"`
+
+	// Liveness tunes the probe restarting an smbd that no longer accepts
+	// connections. It defaults to 3 failed checks, 10 seconds apart.
+	// +optional
+	Liveness *SmbProbeSettings `json:"liveness,omitempty"`
+
+	// Readiness tunes the probe removing a pod, whose smbd does not accept
+	// connections or whose domain trust is broken, from its service. It
+	// defaults to 3 failed checks, 10 seconds apart.
+	// +optional
+	Readiness *SmbProbeSettings `json:"readiness,omitempty"`
+
+	// DomainCheck selects how the readiness probe of domain members checks
+	// their membership, on top of smbd accepting connections. With
+	// "trust", the default, the trust with the domain is verified, with
+	// "ping-dc" only the connection to a domain controller is checked, and
+	// with "none" the membership is not checked.
+	// +kubebuilder:validation:Enum:=trust;ping-dc;none
+	// +optional
+	DomainCheck string `json:"domainCheck,omitempty"`
+}
+
+// SmbProbeSettings tunes the timings of a probe.
+type SmbProbeSettings struct {
+	// PeriodSeconds is the time between two checks of the probe.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+
+	// TimeoutSeconds is the time after which a check of the probe fails.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// FailureThreshold is the number of consecutive failed checks after
+	// which the probe fails.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+}
+
+// SmbNetworkAttachment attaches the pods to a secondary network defined by a
+// Multus NetworkAttachmentDefinition.
+type SmbNetworkAttachment struct {
+	// Name is the name of the NetworkAttachmentDefinition.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern:=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the NetworkAttachmentDefinition. If
+	// unset, the namespace of the pods is used.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Interface is the name of the network interface of the pods attached
+	// to the network, which can be listed in the interfaces the samba
+	// servers listen on. If unset, Multus names the interface.
+	// +kubebuilder:validation:MaxLength:=15
+	// +optional
+	Interface string `json:"interface,omitempty"`
+}
+
+// SmbExtraMount mounts a ConfigMap or a Secret into the samba server
+// containers. Exactly one of ConfigMap and Secret must be set.
+type SmbExtraMount struct {
+	// Name identifies the mount among the extra mounts.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern:=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength:=50
+	Name string `json:"name"`
+
+	// MountPath is the absolute path of the directory the files of the
+	// ConfigMap or Secret appear in. It may not overlap with the paths
+	// the operator mounts volumes on.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern:=`^/`
+	MountPath string `json:"mountPath"`
+
+	// ConfigMap is the name of the ConfigMap to mount.
+	// +optional
+	ConfigMap string `json:"configMap,omitempty"`
+
+	// Secret is the name of the Secret to mount.
+	// +optional
+	Secret string `json:"secret,omitempty"`
+
+	// Include names a file of the mount that is included into the smb.conf
+	// of the samba servers, for settings the operator does not provide.
+	// Only one extra mount may set Include.
+	// +optional
+	Include string `json:"include,omitempty"`
+}
+
+// SmbSELinuxOptions is an SELinux context.
+type SmbSELinuxOptions struct {
+	// User is the SELinux user of the context.
+	// +optional
+	User string `json:"user,omitempty"`
+
+	// Role is the SELinux role of the context.
+	// +optional
+	Role string `json:"role,omitempty"`
+
+	// Type is the SELinux type of the context, for example spc_t.
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Level is the SELinux MCS level of the context, for example
+	// s0:c123,c456.
+	// +optional
+	Level string `json:"level,omitempty"`
+}
+
+// SmbPodSchedulingSettings values control where the pods that host shares
+// may be scheduled.
+type SmbPodSchedulingSettings struct {
+	// NodeSelector values are used to select the nodes on which the pods
+	// may be scheduled.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations allow the pods to be scheduled onto nodes with matching
+	// taints.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity specifies node affinity and pod (anti-)affinity rules for
+	// the pods.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// SpreadReplicas selects how the replicas of a share served by more
+	// than one pod are spread across failure domains. "node", the default,
+	// prefers running the replicas on different nodes, "zone" also spreads
+	// them across the zones of the cluster, and "off" leaves their
+	// placement to the scheduler. The default pod anti-affinity is not
+	// added when the affinity sets one.
+	// +kubebuilder:validation:Enum:=node;zone;off
+	// +optional
+	SpreadReplicas string `json:"spreadReplicas,omitempty"`
+
+	// TopologySpreadConstraints control how the pods are spread across
+	// topology domains. They replace the constraints generated for
+	// SpreadReplicas.
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// SupportedArchitectures lists the CPU architectures, as named by the
+	// kubernetes.io/arch node label, that the pods may be scheduled on.
+	// Defaults to the architectures of the samba server image configured
+	// for the operator.
+	// +optional
+	SupportedArchitectures []string `json:"supportedArchitectures,omitempty"`
+}
+
+// SmbPodSecurityContext values define the security context of pods that
+// host shares. Unset values use the operator's defaults.
+type SmbPodSecurityContext struct {
+	// RunAsUser is the UID used to run the entrypoint of the containers.
+	// +optional
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+
+	// RunAsGroup is the GID used to run the entrypoint of the containers.
+	// +optional
+	RunAsGroup *int64 `json:"runAsGroup,omitempty"`
+
+	// FSGroup is a supplemental group applied to all containers in the pod.
+	// Volumes that support ownership management, such as the share's PVC,
+	// will be owned and writable by this group.
+	// +optional
+	FSGroup *int64 `json:"fsGroup,omitempty"`
+
+	// SeccompProfile selects the seccomp profile applied to the pod.
+	// Defaults to the container runtime's default profile.
+	// +optional
+	SeccompProfile *SmbSeccompProfile `json:"seccompProfile,omitempty"`
+}
+
+// SmbSeccompProfile selects a seccomp profile.
+type SmbSeccompProfile struct {
+	// Type of seccomp profile.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum:=RuntimeDefault;Unconfined;Localhost
+	Type string `json:"type"`
+
+	// LocalhostProfile is the path to a profile on the node, relative to
+	// the kubelet's seccomp profile directory. Only valid when Type is
+	// Localhost.
+	// +optional
+	LocalhostProfile string `json:"localhostProfile,omitempty"`
+}
+
+// SmbCommonConfigStatus defines the observed state of SmbCommonConfig
+type SmbCommonConfigStatus struct {
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// SmbCommonConfig is the Schema for the smbcommonconfigs API
+type SmbCommonConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SmbCommonConfigSpec   `json:"spec,omitempty"`
+	Status SmbCommonConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SmbCommonConfigList contains a list of SmbCommonConfig
+type SmbCommonConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SmbCommonConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SmbCommonConfig{}, &SmbCommonConfigList{})
+}
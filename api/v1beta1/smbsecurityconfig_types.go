@@ -0,0 +1,534 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SmbSecurityConfigSpec defines the desired state of SmbSecurityConfig
+type SmbSecurityConfigSpec struct {
+	// Mode specifies what approach to security is being used.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum:=user;active-directory
+	Mode string `json:"mode,omitempty"`
+
+	// Users is used to configure "local" user and group based security.
+	Users *SmbSecurityUsersSpec `json:"users,omitempty"`
+
+	// Realm specifies the active directory domain to use.
+	Realm string `json:"realm,omitempty"`
+
+	// JoinSources holds a list of sources for domain join data for
+	// this configuration.
+	JoinSources []SmbSecurityJoinSpec `json:"joinSources,omitempty"`
+
+	// MachineAccountOU is the distinguished name of the Organizational Unit
+	// where the computer accounts of the samba instances will be created
+	// when joining the domain. For example:
+	// OU=Servers,OU=Samba,DC=example,DC=com
+	// If unset, the domain's default Computers container is used.
+	// +kubebuilder:validation:Pattern:=`^([Oo][Uu]=[^,]+,)*[Oo][Uu]=[^,]+(,[Dd][Cc]=[^,]+)*$`
+	// +optional
+	MachineAccountOU string `json:"machineAccountOU,omitempty"`
+
+	// Kerberos configures the use of kerberos by the samba servers.
+	// +optional
+	Kerberos *SmbSecurityKerberosSpec `json:"kerberos,omitempty"`
+
+	// JoinRetry controls how joining the domain is retried when a join
+	// attempt fails, for example because the domain controllers are
+	// briefly unreachable.
+	// +optional
+	JoinRetry *SmbSecurityJoinRetrySpec `json:"joinRetry,omitempty"`
+
+	// JoinCheck selects how the join sources are checked before the pods
+	// joining the domain are rolled out. With "secret", the default, the
+	// secrets of the join sources must hold a username and a password.
+	// With "credentials", the operator also binds to a domain controller
+	// of the realm with them, over LDAPS, when the pods are first rolled
+	// out. With "none", the join sources are not checked, and the join
+	// containers report and retry the failed joins.
+	// +kubebuilder:validation:Enum:=none;secret;credentials
+	// +optional
+	JoinCheck string `json:"joinCheck,omitempty"`
+
+	// Domains holds a list of primary & trusted domain configurations.
+	// If left empty a simple default that automatically works with
+	// trusted domains will be used.
+	// +optional
+	Domains []SmbSecurityDomainSpec `json:"domains,omitempty"`
+
+	// AllowTrustedDomains lets the users of the domains trusted by the
+	// domain of the realm, including the domains of trusted forests,
+	// access the shares, and has winbind enumerate the trusted domains.
+	// Their IDs are mapped by the "*" domain, with the autorid backend, or
+	// by the domains listed for them. If unset, samba's defaults apply.
+	// +optional
+	AllowTrustedDomains bool `json:"allowTrustedDomains,omitempty"`
+
+	// DNS is used to configure properties related to the DNS services
+	// of the domain.
+	// +optional
+	DNS *SmbSecurityDNSSpec `json:"dns,omitempty"`
+
+	// Authentication hardens the ways clients may authenticate to the
+	// samba servers. If unset, only NTLMv2 and kerberos are accepted.
+	// +optional
+	Authentication *SmbSecurityAuthenticationSpec `json:"authentication,omitempty"`
+
+	// PassdbBackend selects where the samba servers of a security config
+	// in user mode store the accounts of the users. If unset, the users are
+	// stored by each samba server, as with the tdbsam backend.
+	// +optional
+	PassdbBackend *SmbSecurityPassdbSpec `json:"passdbBackend,omitempty"`
+
+	// Client configures the connections to the domain controllers of a
+	// security config in active-directory mode, made by the samba servers
+	// and by the containers joining the domain and registering DNS names.
+	// If unset, the connections are signed.
+	// +optional
+	Client *SmbSecurityClientSpec `json:"client,omitempty"`
+
+	// Winbind tunes the winbind daemons of a security config in
+	// active-directory mode, for example to tolerate slow or overloaded
+	// domain controllers. Samba's defaults are used if unset.
+	// +optional
+	Winbind *SmbSecurityWinbindSpec `json:"winbind,omitempty"`
+}
+
+// SmbSecurityClientSpec configures the security of the client connections
+// to the domain controllers.
+type SmbSecurityClientSpec struct {
+	// Signing selects if the client connections are signed. With
+	// mandatory, connections to servers refusing to sign fail.
+	// +kubebuilder:validation:Enum:=mandatory;desired;if_required;disabled
+	// +kubebuilder:default:=mandatory
+	// +optional
+	Signing string `json:"signing,omitempty"`
+
+	// Encryption selects if the client connections are encrypted. With
+	// required, connections to servers not supporting SMB3 encryption
+	// fail. Samba's default is used if unset.
+	// +kubebuilder:validation:Enum:=off;if_required;desired;required
+	// +optional
+	Encryption string `json:"encryption,omitempty"`
+
+	// MaxProtocol is the highest protocol version the client connections
+	// negotiate. Samba's default, the highest supported, is used if unset.
+	// +kubebuilder:validation:Enum:=NT1;SMB2;SMB2_02;SMB2_10;SMB3;SMB3_00;SMB3_02;SMB3_11
+	// +optional
+	MaxProtocol string `json:"maxProtocol,omitempty"`
+
+	// IPCMaxProtocol is the highest protocol version of the IPC
+	// connections, such as those of winbind to the domain controllers.
+	// Samba's default is used if unset.
+	// +kubebuilder:validation:Enum:=NT1;SMB2;SMB2_02;SMB2_10;SMB3;SMB3_00;SMB3_02;SMB3_11
+	// +optional
+	IPCMaxProtocol string `json:"ipcMaxProtocol,omitempty"`
+}
+
+// SmbSecurityWinbindSpec tunes the winbind daemons resolving the users and
+// groups of the domain.
+type SmbSecurityWinbindSpec struct {
+	// RequestTimeout is the number of seconds winbind waits for a client
+	// request before closing its connection. Samba's default is 60.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	RequestTimeout *int32 `json:"requestTimeout,omitempty"`
+
+	// MaxClients is the number of clients winbind serves at once. Samba's
+	// default is 200.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	MaxClients *int32 `json:"maxClients,omitempty"`
+
+	// MaxDomainConnections is the number of connections winbind opens to
+	// the domain controllers of each domain. Samba's default is 1.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	MaxDomainConnections *int32 `json:"maxDomainConnections,omitempty"`
+}
+
+// SmbSecurityPassdbSpec configures the passdb backend of the samba servers.
+type SmbSecurityPassdbSpec struct {
+	// Type of the backend. With tdbsam, the users of the security config
+	// are added to a database local to each samba server. With ldapsam,
+	// the users are looked up on an LDAP server, and the security config
+	// may not define users.
+	// +kubebuilder:validation:Enum:=tdbsam;ldapsam
+	// +kubebuilder:default:=tdbsam
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// LDAP configures the connection to the LDAP server of the ldapsam
+	// backend. Required with ldapsam.
+	// +optional
+	LDAP *SmbSecurityLDAPSpec `json:"ldap,omitempty"`
+}
+
+// SmbSecurityLDAPSpec configures the connection of the samba servers to an
+// LDAP server holding the accounts of the users.
+type SmbSecurityLDAPSpec struct {
+	// URL of the LDAP server, such as ldap://ldap.example.com or
+	// ldaps://ldap.example.com:636.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern:=`^ldaps?://\S+$`
+	URL string `json:"url"`
+
+	// Suffix is the base DN of the samba entries on the LDAP server, such
+	// as dc=example,dc=com.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	Suffix string `json:"suffix"`
+
+	// UserSuffix is the DN, relative to Suffix, below which the users are
+	// stored, such as ou=People.
+	// +optional
+	UserSuffix string `json:"userSuffix,omitempty"`
+
+	// GroupSuffix is the DN, relative to Suffix, below which the groups
+	// are stored, such as ou=Groups.
+	// +optional
+	GroupSuffix string `json:"groupSuffix,omitempty"`
+
+	// AdminDN is the DN the samba servers bind to the LDAP server as.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	AdminDN string `json:"adminDN"`
+
+	// AdminPasswordSecret is the name of a secret, in the operator's
+	// working namespace, holding the password of AdminDN.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	AdminPasswordSecret string `json:"adminPasswordSecret"`
+
+	// AdminPasswordKey is the key of the secret holding the password.
+	// Defaults to password.
+	// +optional
+	AdminPasswordKey string `json:"adminPasswordKey,omitempty"`
+
+	// SSL selects if the samba servers use StartTLS on ldap:// URLs.
+	// Connections to ldaps:// URLs always use TLS. Defaults to start tls.
+	// +kubebuilder:validation:Enum:=off;start tls
+	// +optional
+	SSL string `json:"ssl,omitempty"`
+}
+
+// SmbSecurityUsersSpec configures user level security. The users are
+// defined by SmbUsers referring to the security config, unless a secret
+// storing the user and group configuration json is given.
+type SmbSecurityUsersSpec struct {
+	// Secret identifies the name of the secret storing user and group
+	// configuration json. SmbUsers are ignored if it is set. It may not be
+	// set along with CSISecretVolume.
+	// +kubebuilder:validation:MinLength:=1
+	// +optional
+	Secret string `json:"secret,omitempty"`
+
+	// Key identifies the key within the secret that stores the user and
+	// group configuration json. Required if Secret is set.
+	// +kubebuilder:validation:MinLength:=1
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// CSISecretVolume mounts the user and group configuration json from a
+	// volume of the Secrets Store CSI driver, backed by an external secret
+	// store such as Vault, rather than from a Secret. SmbUsers are ignored
+	// if it is set.
+	// +optional
+	CSISecretVolume *SmbCSISecretVolumeSpec `json:"csiSecretVolume,omitempty"`
+
+	// Groups defines local groups and the users that are members of them.
+	// Shares grant access to the members of a group by listing it as
+	// @name in their access control lists. Groups may only be defined
+	// here or in the users secret, not in both.
+	// +optional
+	Groups []SmbSecurityLocalGroupSpec `json:"groups,omitempty"`
+
+	// Import seeds the users with the accounts of an smbpasswd file, such
+	// as one exported from the passdb of an existing samba server with
+	// "pdbedit -e smbpasswd:FILE". The accounts keep their passwords, as
+	// NT hashes, and uids. The imported users are generated along with the
+	// SmbUsers of the security config, so Import may not be set along with
+	// Secret or CSISecretVolume.
+	// +optional
+	Import *SmbSecurityUsersImportSpec `json:"import,omitempty"`
+}
+
+// SmbSecurityUsersImportSpec identifies the key of a Secret holding the
+// smbpasswd file the users are imported from.
+type SmbSecurityUsersImportSpec struct {
+	// Secret is the name of the Secret, in the namespace of the security
+	// config, holding the smbpasswd file.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	Secret string `json:"secret"`
+
+	// Key is the key of the Secret holding the smbpasswd file. Defaults to
+	// smbpasswd.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// SmbCSISecretVolumeSpec identifies the file of a Secrets Store CSI driver
+// volume holding the user and group configuration json.
+type SmbCSISecretVolumeSpec struct {
+	// SecretProviderClass is the name of the SecretProviderClass, in the
+	// namespace of the pods hosting shares, that fetches the secrets of
+	// the volume.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	SecretProviderClass string `json:"secretProviderClass"`
+
+	// Path is the path, within the volume, of the file holding the user
+	// and group configuration json. It is the object name, or alias, of
+	// the secret in the SecretProviderClass.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	// +kubebuilder:validation:Pattern:=`^[^/.][^/]*(/[^/.][^/]*)*$`
+	Path string `json:"path"`
+
+	// Driver is the name of the CSI driver. Defaults to
+	// secrets-store.csi.k8s.io.
+	// +optional
+	Driver string `json:"driver,omitempty"`
+}
+
+// SmbSecurityLocalGroupSpec defines a local group of the samba servers.
+type SmbSecurityLocalGroupSpec struct {
+	// Name of the group.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	// +kubebuilder:validation:Pattern:=`^[a-zA-Z0-9_.][a-zA-Z0-9_.-]*$`
+	Name string `json:"name"`
+
+	// GID of the group. The samba container picks one if it is not set.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	GID int32 `json:"gid,omitempty"`
+
+	// Members are the names of the users of the users secret that are
+	// members of the group.
+	// +optional
+	Members []string `json:"members,omitempty"`
+}
+
+// SmbSecurityJoinSpec configures how samba instances are allowed to
+// join to active directory if needed.
+type SmbSecurityJoinSpec struct {
+	UserJoin *SmbSecurityUserJoinSpec `json:"userJoin,omitempty"`
+}
+
+// SmbSecurityKerberosSpec configures kerberos for domain member servers.
+type SmbSecurityKerberosSpec struct {
+	// KeytabSecret is the name of a secret, in the operator's working
+	// namespace, with a krb5.keytab key containing a pre-provisioned keytab.
+	// When set, smbd uses this keytab for kerberos authentication rather than
+	// only relying on the machine account password.
+	// +kubebuilder:validation:MinLength:=1
+	// +optional
+	KeytabSecret string `json:"keytabSecret,omitempty"`
+
+	// Krb5ConfConfigMap is the name of a ConfigMap, in the operator's
+	// working namespace, with a krb5.conf key holding the kerberos
+	// configuration of the samba containers. When set, samba no longer
+	// generates its own krb5.conf, which is useful when the domain
+	// controllers it would choose are not the right ones.
+	// +kubebuilder:validation:MinLength:=1
+	// +optional
+	Krb5ConfConfigMap string `json:"krb5ConfConfigMap,omitempty"`
+}
+
+// SmbSecurityJoinRetrySpec configures the exponential backoff used when
+// retrying a failed domain join.
+type SmbSecurityJoinRetrySpec struct {
+	// MaxAttempts is the number of join attempts made before the join is
+	// considered to have failed.
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:default:=5
+	// +optional
+	MaxAttempts int32 `json:"maxAttempts,omitempty"`
+
+	// InitialDelaySeconds is the time to wait after the first failed
+	// attempt. The delay doubles after each subsequent failure.
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:default:=5
+	// +optional
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+
+	// MaxDelaySeconds limits the time to wait between attempts.
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:default:=120
+	// +optional
+	MaxDelaySeconds int32 `json:"maxDelaySeconds,omitempty"`
+}
+
+// SmbSecurityUserJoinSpec configures samba container instances to
+// use a secret containing a username and password.
+type SmbSecurityUserJoinSpec struct {
+	// Secret that contains the username and password.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	Secret string `json:"secret,omitempty"`
+	// Key within the secret containing the username and password.
+	// +kubebuilder:default:=join.json
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// SmbSecurityDomainSpec configures samba's domain management and ID mapping
+// behavior for the specified domain.
+type SmbSecurityDomainSpec struct {
+	// Name of the domain.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	Name string `json:"name,omitempty"`
+
+	// Mode specifies what approach to security is being used.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum:=autorid;ad-rfc2307
+	Backend string `json:"backend,omitempty"`
+
+	// Range is the range of IDs, as low-high, the users and groups of the
+	// domain are mapped to. If unset, ranges of 10000 IDs are assigned to
+	// the domains in the order they are listed.
+	// +kubebuilder:validation:Pattern:=`^[0-9]+-[0-9]+$`
+	// +optional
+	Range string `json:"range,omitempty"`
+}
+
+// SmbSecurityDNSSpec configures the relationship between systems managed
+// via this SmbSecurityConfig and the domain. Ignored by user mode.
+type SmbSecurityDNSSpec struct {
+	// Register a specified member server's address with the domain's DNS or
+	// disabled when set to "never".
+	// NOTE: cluster-ip is not generally supported, it is only for testing.
+	// +kubebuilder:validation:Enum:=never;external-ip;cluster-ip
+	Register string `json:"register,omitempty"`
+
+	// TTL is the time to live, in seconds, of the registered DNS records.
+	// A short TTL lets clients find the share quickly after a failover.
+	// If unset, the default of the registration tool is used.
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=86400
+	// +optional
+	TTL *int32 `json:"ttl,omitempty"`
+
+	// RegisterPTR also registers the reverse (PTR) record of the member
+	// server's address, which kerberos clients may rely on to find the
+	// server's name, and removes it along with the other records. The
+	// reverse zone of the address must exist and accept updates from
+	// the member server.
+	// +optional
+	RegisterPTR bool `json:"registerPTR,omitempty"`
+
+	// UpdateMethod selects how the DNS updates are authenticated:
+	// "gss-tsig" signs them with the kerberos credentials of the member
+	// server's machine account, "tsig" with the shared key of TSIGKey, and
+	// "unauthenticated" sends unsigned updates, for zones that accept them.
+	// +kubebuilder:validation:Enum:=gss-tsig;tsig;unauthenticated
+	// +kubebuilder:default:=gss-tsig
+	// +optional
+	UpdateMethod string `json:"updateMethod,omitempty"`
+
+	// TSIGKey names the Secret holding the key the DNS updates are signed
+	// with. Required by, and only allowed with, the "tsig" update method.
+	// +optional
+	TSIGKey *SmbSecurityDNSKeySpec `json:"tsigKey,omitempty"`
+
+	// Server is the address of the DNS server the updates are sent to. If
+	// unset the DNS servers of the domain are used.
+	// +optional
+	Server string `json:"server,omitempty"`
+}
+
+// SmbSecurityDNSKeySpec names the Secret holding a TSIG key, in the key
+// file format of nsupdate.
+type SmbSecurityDNSKeySpec struct {
+	// Secret is the name of the Secret, in the namespace of the shares'
+	// pods.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	Secret string `json:"secret"`
+
+	// Key is the key of the Secret holding the TSIG key.
+	// +kubebuilder:default:=tsig.key
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// SmbSecurityAuthenticationSpec configures the authentication protocols
+// accepted by, and used by, the samba servers. The defaults refuse the
+// legacy LANMAN and NTLMv1 protocols.
+type SmbSecurityAuthenticationSpec struct {
+	// NTLMAuth selects which NTLM protocols clients may authenticate with.
+	// "ntlmv2-only" refuses NTLMv1, "mschapv2-and-ntlmv2-only" also allows
+	// NTLMv1 for MS-CHAPv2 authentication, "ntlmv1-permitted" allows
+	// NTLMv1 and "disabled" refuses NTLM altogether, leaving only kerberos.
+	// Disabling NTLM requires active-directory mode.
+	// +kubebuilder:validation:Enum:=ntlmv1-permitted;ntlmv2-only;mschapv2-and-ntlmv2-only;disabled
+	// +kubebuilder:default:=ntlmv2-only
+	// +optional
+	NTLMAuth string `json:"ntlmAuth,omitempty"`
+
+	// LanmanAuth allows clients to authenticate with the LANMAN protocol.
+	// It requires ntlmAuth to be "ntlmv1-permitted".
+	// +optional
+	LanmanAuth bool `json:"lanmanAuth,omitempty"`
+
+	// RawNTLMv2Auth allows clients to authenticate with NTLMv2 without the
+	// protection of NTLMSSP.
+	// +optional
+	RawNTLMv2Auth bool `json:"rawNTLMv2Auth,omitempty"`
+
+	// ClientNTLMv2Auth makes the samba servers use NTLMv2 when they
+	// authenticate to other servers, such as the domain controllers, with
+	// NTLM. If false, NTLMv1 may be used.
+	// +kubebuilder:default:=true
+	// +optional
+	ClientNTLMv2Auth *bool `json:"clientNTLMv2Auth,omitempty"`
+}
+
+// SmbSecurityConfigStatus defines the observed state of SmbSecurityConfig
+type SmbSecurityConfigStatus struct {
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// SmbSecurityConfig is the Schema for the smbsecurityconfigs API
+type SmbSecurityConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SmbSecurityConfigSpec   `json:"spec,omitempty"`
+	Status SmbSecurityConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SmbSecurityConfigList contains a list of SmbSecurityConfig
+type SmbSecurityConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SmbSecurityConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SmbSecurityConfig{}, &SmbSecurityConfigList{})
+}
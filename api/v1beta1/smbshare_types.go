@@ -0,0 +1,1090 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SmbShareSpec defines the desired state of SmbShare
+type SmbShareSpec struct {
+	// ShareName is an optional string that lets you define an SMB compliant
+	// name for the share. If unset, the name will be derived automatically.
+	// +optional
+	ShareName string `json:"shareName,omitempty"`
+
+	// Storage defines the type and location of the storage that backs this
+	// share.
+	Storage SmbShareStorageSpec `json:"storage"`
+
+	// Comment is a description of the share that is shown to clients that
+	// list the shares of a server.
+	// +kubebuilder:validation:MaxLength:=256
+	// +kubebuilder:validation:Pattern:=`^[^\r\n]*$`
+	// +optional
+	Comment string `json:"comment,omitempty"`
+
+	// Suspended takes the share offline without deleting it. The servers of
+	// a suspended share are scaled to zero pods, while its volume and
+	// configuration are kept. A share sharing its servers with other shares
+	// is no longer served by them, and the servers are scaled to zero once
+	// all of their shares are suspended. Clearing the field serves the share
+	// again.
+	// +optional
+	Suspended bool `json:"suspended,omitempty"`
+
+	// ReadOnly controls if this share is to be read-only or not.
+	// +kubebuilder:default:=false
+	// +optional
+	ReadOnly bool `json:"readOnly"`
+
+	// Browseable controls if the share will be browseable. A browseable share
+	// is visible in listings.
+	// +kubebuilder:default:=true
+	// +optional
+	Browseable bool `json:"browseable"`
+
+	// CreateMask is an octal mode, such as "0664", that is bitwise ANDed
+	// with the permissions of files created on the share.
+	// +kubebuilder:validation:Pattern:=`^0?[0-7]{3,4}$`
+	// +optional
+	CreateMask string `json:"createMask,omitempty"`
+
+	// DirectoryMask is an octal mode, such as "0775", that is bitwise ANDed
+	// with the permissions of directories created on the share.
+	// +kubebuilder:validation:Pattern:=`^0?[0-7]{3,4}$`
+	// +optional
+	DirectoryMask string `json:"directoryMask,omitempty"`
+
+	// ForceCreateMode is an octal mode whose bits are always set on the
+	// permissions of files created on the share.
+	// +kubebuilder:validation:Pattern:=`^0?[0-7]{3,4}$`
+	// +optional
+	ForceCreateMode string `json:"forceCreateMode,omitempty"`
+
+	// ForceDirectoryMode is an octal mode whose bits are always set on the
+	// permissions of directories created on the share.
+	// +kubebuilder:validation:Pattern:=`^0?[0-7]{3,4}$`
+	// +optional
+	ForceDirectoryMode string `json:"forceDirectoryMode,omitempty"`
+
+	// InheritOwner makes new files and directories owned by the owner of
+	// the directory they are created in, rather than by the user creating
+	// them. It also applies to the ownership the clients set.
+	// +optional
+	InheritOwner bool `json:"inheritOwner,omitempty"`
+
+	// InheritPermissions makes new files and directories take the
+	// permissions of the directory they are created in. The setgid bit of
+	// the directory is inherited by new directories. CreateMask,
+	// DirectoryMask, ForceCreateMode and ForceDirectoryMode are ignored
+	// when it is set.
+	// +optional
+	InheritPermissions bool `json:"inheritPermissions,omitempty"`
+
+	// GuestAccess lets clients use the share anonymously, as the guest
+	// user, without logging in. With "read" guests may read the share's
+	// files. With "dropbox" guests may add files to the share, but can not
+	// list or read any files, including the ones they added. Guest access
+	// requires a SmbSecurityConfig in user mode.
+	// +kubebuilder:validation:Enum:=read;dropbox
+	// +optional
+	GuestAccess string `json:"guestAccess,omitempty"`
+
+	// GuestAccount is the user guests are mapped to, who owns the files
+	// guests create. It must be a user of the users of the security config.
+	// Samba's default is "nobody". It requires GuestAccess, and applies to
+	// all the shares of the server group, which must not set another
+	// guest account.
+	// +optional
+	GuestAccount string `json:"guestAccount,omitempty"`
+
+	// VetoFiles are patterns of file and directory names that can neither
+	// be seen nor created on the share, such as "Thumbs.db" or "*.tmp".
+	// The wildcards "*" and "?" may be used. Patterns can not contain "/".
+	// Directories holding only vetoed files may still be deleted, removing
+	// the vetoed files too.
+	// +optional
+	VetoFiles []string `json:"vetoFiles,omitempty"`
+
+	// HideFiles are patterns of file and directory names that are hidden
+	// from clients, but can still be opened or created. The patterns take
+	// the same form as those of VetoFiles.
+	// +optional
+	HideFiles []string `json:"hideFiles,omitempty"`
+
+	// DeleteReadonly lets clients delete the files of the share that have
+	// the read-only attribute, as the owner of the file may on the file
+	// system, rather than the deletion being denied. It has no effect on a
+	// read-only share, whose files can not be deleted at all.
+	// +optional
+	DeleteReadonly bool `json:"deleteReadonly,omitempty"`
+
+	// ACLCheckPermissions controls if the server checks the access control
+	// list of a file before a client opens it for deletion. Defaults to
+	// true. When false, the deletion is left to the permissions of the
+	// file system, which may allow deleting files whose access control
+	// list denies it.
+	// +optional
+	ACLCheckPermissions *bool `json:"aclCheckPermissions,omitempty"`
+
+	// ForceUnknownACLUser lets clients set access control lists naming
+	// users or groups unknown to the server, such as those of files copied
+	// from another domain, rather than the change failing. Unknown owners
+	// are replaced by the connected user and unknown group owners by its
+	// primary group.
+	// +optional
+	ForceUnknownACLUser bool `json:"forceUnknownACLUser,omitempty"`
+
+	// HostsAllow lists the clients allowed to connect to the share, as IP
+	// addresses, CIDR networks such as "10.0.0.0/8" or host names. If set,
+	// other clients are refused, unless HostsDeny is set too: clients
+	// listed by neither are then allowed. Clients listed by HostsAllow are
+	// allowed even if HostsDeny lists them.
+	// +optional
+	HostsAllow []string `json:"hostsAllow,omitempty"`
+
+	// HostsDeny lists the clients refused by the share, as IP addresses,
+	// CIDR networks or host names, unless HostsAllow lists them.
+	// +optional
+	HostsDeny []string `json:"hostsDeny,omitempty"`
+
+	// Encryption selects if the connections to the share are encrypted.
+	// With desired, encryption is offered to the clients supporting it;
+	// with required, clients that can not encrypt are refused. Samba's
+	// default, encrypting only if the client asks for it, is used if unset.
+	// +kubebuilder:validation:Enum:=off;if_required;desired;required
+	// +optional
+	Encryption string `json:"encryption,omitempty"`
+
+	// CaseSensitive controls if file names are matched with regard to
+	// case. With "auto", the default, names are matched without regard to
+	// case, as Windows clients expect, unless the client announces that it
+	// is case sensitive. With "no", names differing only by case, such as
+	// those of files created on the volume by Linux programs, can not all
+	// be accessed over SMB. With "yes", clients expecting names to be
+	// matched without regard to case may not find files, and directory
+	// lookups are faster.
+	// +kubebuilder:validation:Enum:=auto;yes;no
+	// +optional
+	CaseSensitive string `json:"caseSensitive,omitempty"`
+
+	// PreserveCase controls if new files keep the case of the names
+	// given by clients. If false, names are stored in lower case. Defaults
+	// to true.
+	// +optional
+	PreserveCase *bool `json:"preserveCase,omitempty"`
+
+	// ShortPreserveCase controls if new files with names fitting the 8.3
+	// format keep the case of the names given by clients. If false, such
+	// names are stored in lower case. Defaults to true.
+	// +optional
+	ShortPreserveCase *bool `json:"shortPreserveCase,omitempty"`
+
+	// MangledNames controls if clients are shown 8.3 names for files
+	// whose names they may not be able to use. With "illegal", the
+	// default, only names containing characters not allowed by Windows
+	// are mangled. With "yes", all names not fitting the 8.3 format are
+	// mangled as well, for very old clients. With "no", names are never
+	// mangled, and files with names not allowed by Windows can not be
+	// accessed by Windows clients.
+	// +kubebuilder:validation:Enum:=yes;no;illegal
+	// +optional
+	MangledNames string `json:"mangledNames,omitempty"`
+
+	// UnicodeNormalization renames the files and directories of the share
+	// whose names are not in the given Unicode normalization form, "nfc"
+	// or "nfd", when the pods hosting the share start. It keeps names
+	// written in the other form consistent, such as the decomposed names
+	// of files copied from macOS file systems, which Windows clients, using
+	// composed names, can not match. Samba itself does not normalize the
+	// names given by clients. With "none", the default, names are left as
+	// they are. Requires PVC storage.
+	// +kubebuilder:validation:Enum:=none;nfc;nfd
+	// +optional
+	UnicodeNormalization string `json:"unicodeNormalization,omitempty"`
+
+	// FollowSymlinks controls if clients may follow the symbolic links
+	// stored on the share. Defaults to true. Unless WideLinks is set, only
+	// links to files within the share may be followed.
+	// +optional
+	FollowSymlinks *bool `json:"followSymlinks,omitempty"`
+
+	// WideLinks lets clients follow symbolic links to files outside of the
+	// share, which requires FollowSymlinks. As clients able to create links
+	// may then reach any file the server can read, wide links are also
+	// enabled for links created by clients; use them with care.
+	// +optional
+	WideLinks bool `json:"wideLinks,omitempty"`
+
+	// PosixExtensions enables the SMB3 POSIX extensions for Linux clients
+	// requesting them, giving them POSIX semantics such as symbolic links,
+	// permissions and special files. The extensions are advertised by the
+	// server, so they apply to all the shares of the server group. Unless
+	// CreateMask and DirectoryMask are set, the share keeps the permissions
+	// clients give new files and directories.
+	// +optional
+	PosixExtensions bool `json:"posixExtensions,omitempty"`
+
+	// MSDFS makes the share the root of a DFS namespace, whose links refer
+	// clients to other shares, on the same or other servers. DFS is also
+	// turned on for the samba server, for all the shares of the server
+	// group.
+	// +optional
+	MSDFS *SmbShareMSDFSSpec `json:"msdfs,omitempty"`
+
+	// Oplocks lets clients cache the files of the share locally while no
+	// other client opens them. Defaults to true.
+	// +optional
+	Oplocks *bool `json:"oplocks,omitempty"`
+
+	// KernelOplocks breaks the oplocks of clients when processes other
+	// than samba access the files of the share, on volumes shared with
+	// other pods. Defaults to false.
+	// +optional
+	KernelOplocks *bool `json:"kernelOplocks,omitempty"`
+
+	// Level2Oplocks lets several clients cache the files of the share they
+	// only read. Defaults to true.
+	// +optional
+	Level2Oplocks *bool `json:"level2Oplocks,omitempty"`
+
+	// Leases lets SMB2 clients cache files with leases, which require
+	// oplocks. Leases are a setting of the samba server: they are turned
+	// off for all the shares of the server group if a share turns them
+	// off. Defaults to true.
+	// +optional
+	Leases *bool `json:"leases,omitempty"`
+
+	// DurableHandles lets clients reopen the files of the share after a
+	// brief disconnection, such as a network glitch, keeping their locks.
+	// Durable handles turn leases on for the server group, and turn off
+	// the kernel share modes and POSIX locks of the share, so the files of
+	// the share must only be locked through samba. They can not be used
+	// with KernelOplocks.
+	// +optional
+	DurableHandles bool `json:"durableHandles,omitempty"`
+
+	// PersistentHandles keeps the handles of clients across the failover
+	// of the share to another server of its cluster, for continuously
+	// available shares. They imply DurableHandles and require a clustered
+	// share.
+	// +optional
+	PersistentHandles bool `json:"persistentHandles,omitempty"`
+
+	// StrictSync makes samba flush the files of the share to disk when a
+	// client asks it to, instead of ignoring the requests. Defaults to
+	// samba's default, true.
+	// +optional
+	StrictSync *bool `json:"strictSync,omitempty"`
+
+	// SyncAlways makes samba flush every write to the share to disk before
+	// it replies to the client, which is durable but much slower. It
+	// requires StrictSync and a share that can be written to.
+	// +optional
+	SyncAlways bool `json:"syncAlways,omitempty"`
+
+	// Interfaces lists the network interfaces, by name or by CIDR, that
+	// the samba server listens on, instead of all the interfaces of the
+	// pod. Interfaces override those of the common config. They are a
+	// setting of the samba server: all the shares of a server group must
+	// list the same interfaces.
+	// +optional
+	Interfaces []string `json:"interfaces,omitempty"`
+
+	// ForceUser names the user that all files of the share are accessed
+	// as, whichever user connected to the share. Shares of a security
+	// config in active-directory mode may name a domain user, as
+	// DOMAIN\user. In user mode the user must be one of the users of the
+	// security config.
+	// +optional
+	ForceUser string `json:"forceUser,omitempty"`
+
+	// ForceGroup names the primary group that all files of the share are
+	// accessed as. Shares of a security config in active-directory mode may
+	// name a domain group, as DOMAIN\group.
+	// +optional
+	ForceGroup string `json:"forceGroup,omitempty"`
+
+	// SecurityConfig specifies which SmbSecurityConfig CR is to be used
+	// for this share. If left blank, the operator's default will be
+	// used.
+	// +kubebuilder:validation:MinLength:=1
+	// +optional
+	SecurityConfig string `json:"securityConfig,omitempty"`
+
+	// Users adds the users of a users secret to those of the share's
+	// security config, in user mode. A user of the secret replaces the
+	// user of the same name of the security config. The users are a
+	// setting of the samba server: the users of all the shares of a server
+	// group are available to each of its shares, and the shares may not
+	// define the same user differently. AccessControl restricts which of
+	// the users may access the share.
+	// +optional
+	Users *SmbShareUsersSpec `json:"users,omitempty"`
+
+	// CommonConfig specifies which SmbCommonConfig CR is to be used
+	// for this share. If left blank, the operator's default will be
+	// used.
+	// +kubebuilder:validation:MinLength:=1
+	// +optional
+	CommonConfig string `json:"commonConfig,omitempty"`
+
+	// ServerGroup names a group of SmbShares that are served by the same
+	// pods. All SmbShares in a namespace with the same ServerGroup must use
+	// the same SmbSecurityConfig, SmbCommonConfig and PodSettings. If unset,
+	// the share is served by pods of its own. The ServerGroup of an
+	// existing SmbShare can not be changed.
+	// +kubebuilder:validation:MaxLength:=63
+	// +kubebuilder:validation:Pattern:=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +optional
+	ServerGroup string `json:"serverGroup,omitempty"`
+
+	// Network configures how clients reach the share.
+	// +optional
+	Network *SmbShareNetworkSpec `json:"network,omitempty"`
+
+	// AccessControl restricts which users and groups may access the share.
+	// +optional
+	AccessControl *SmbShareAccessControl `json:"accessControl,omitempty"`
+
+	// HomeDirectories, when set, turns the share into a home directories
+	// share. Each user connecting to the server is given a share, named
+	// after the user, of their own directory on the volume. The ShareName
+	// is ignored as home directories are always provided by the "homes"
+	// share.
+	// +optional
+	HomeDirectories *SmbShareHomeDirectoriesSpec `json:"homeDirectories,omitempty"`
+
+	// ACLs configures how file system ACLs are handled by the share.
+	// +optional
+	ACLs *SmbShareACLSpec `json:"acls,omitempty"`
+
+	// StoreDosAttributes stores the DOS attributes of files, such as
+	// hidden, archive and read-only, in extended attributes, along with
+	// the extended attributes set by clients. The backing volume must
+	// support user extended attributes. Defaults to true. If false, some
+	// DOS attributes are mapped to the permissions of the files instead.
+	// +optional
+	StoreDosAttributes *bool `json:"storeDosAttributes,omitempty"`
+
+	// DosAttributeMapping maps DOS attributes to the permissions of the
+	// files. Mapping an attribute requires StoreDosAttributes to be false.
+	// When StoreDosAttributes is true, no attribute is mapped, so that they
+	// are only read from, and written to, extended attributes.
+	// +optional
+	DosAttributeMapping *SmbShareDosAttributeMappingSpec `json:"dosAttributeMapping,omitempty"`
+
+	// MacOS configures the share for macOS clients.
+	// +optional
+	MacOS *SmbShareMacOSSpec `json:"macos,omitempty"`
+
+	// VfsObjects lists VFS modules of the share, in the order they are
+	// stacked, the first being called first. The modules the operator
+	// loads for the other settings of the share are merged into the list,
+	// unless VfsObjectsMode is "override".
+	// +optional
+	VfsObjects []string `json:"vfsObjects,omitempty"`
+
+	// VfsObjectsMode selects how VfsObjects is combined with the modules
+	// the operator loads. With "merge", the default, the operator's modules
+	// missing from the list are added after the listed modules, the module
+	// of the storage backend always coming last. With "override" the share
+	// loads the listed modules only.
+	// +kubebuilder:validation:Enum:=merge;override
+	// +optional
+	VfsObjectsMode string `json:"vfsObjectsMode,omitempty"`
+
+	// PodSettings override the scheduling settings of the SmbCommonConfig
+	// for the pods hosting this share.
+	// +optional
+	PodSettings *SmbSharePodSettings `json:"podSettings,omitempty"`
+
+	// MaxConnections limits the number of clients connected to the share
+	// at the same time. Further connections are refused until a client
+	// disconnects. No limit applies if unset.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	MaxConnections *int32 `json:"maxConnections,omitempty"`
+
+	// DeletionProtection refuses to delete the share while clients are
+	// connected to it, unless the SmbShare is annotated with
+	// samba-operator.samba.org/force-delete: "true". It overrides the
+	// deletionProtection of the share's common config.
+	// +optional
+	DeletionProtection *bool `json:"deletionProtection,omitempty"`
+
+	// Quota limits the amount of data stored on the share. Clients are
+	// shown the quota as the size of the share.
+	// +optional
+	Quota *SmbShareQuotaSpec `json:"quota,omitempty"`
+
+	// SelfTest makes the operator check the share end to end once it is
+	// served: a Job logs in to the share with smbclient, as one of its
+	// users or as a guest, writes a canary file and reads it back, and the
+	// result is reported in the SelfTestPassed status. The test is rerun
+	// when the SmbShare changes. It is meant for CI and smoke tests, not
+	// for production shares, and is ignored unless the operator is run
+	// with self-test-enabled.
+	// +optional
+	SelfTest bool `json:"selfTest,omitempty"`
+
+	// HealthCheck makes the share's server reachable by external health
+	// checks: the Service of the server group is annotated with how to
+	// probe it, and the operator probes it itself, without credentials,
+	// reporting the result in the Health status.
+	// +optional
+	HealthCheck *SmbShareHealthCheckSpec `json:"healthCheck,omitempty"`
+
+	// Antivirus scans the files of the share for viruses with samba's
+	// virusfilter VFS module. Clients are denied access to infected files,
+	// which are quarantined by default, and the infected files found are
+	// recorded as events of the SmbShare and counted in its status.
+	// +optional
+	Antivirus *SmbShareAntivirusSpec `json:"antivirus,omitempty"`
+}
+
+// SmbShareNetworkSpec configures the network names and port of a share.
+type SmbShareNetworkSpec struct {
+	// Port is the TCP port the share is served on, instead of the standard
+	// SMB port 445. It overrides the port of the share's common config. All
+	// shares of a server group must use the same port.
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=65535
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+
+	// PublishDNSName is a DNS hostname under which the share's Service is
+	// published through ExternalDNS. The Service is annotated with the name
+	// so that ExternalDNS creates the DNS records for it.
+	// +kubebuilder:validation:MaxLength:=253
+	// +kubebuilder:validation:Pattern:=`^([a-z0-9]([-a-z0-9]*[a-z0-9])?\.)*[a-z0-9]([-a-z0-9]*[a-z0-9])?\.?$`
+	// +optional
+	PublishDNSName string `json:"publishDNSName,omitempty"`
+
+	// DNSAliases lists additional host names, within the domain, that are
+	// registered as aliases of the share's server in the domain's DNS. The
+	// aliases are only registered if the SmbSecurityConfig enables DNS
+	// registration.
+	// +kubebuilder:validation:MaxItems:=16
+	// +optional
+	DNSAliases []string `json:"dnsAliases,omitempty"`
+}
+
+// SmbShareMSDFSSpec defines the DFS namespace of a share.
+type SmbShareMSDFSSpec struct {
+	// Links lists the DFS links of the root directory of the share. The
+	// operator creates the links on the share's volume when the samba
+	// servers start, and removes the DFS links that are no longer
+	// listed.
+	// +kubebuilder:validation:MaxItems:=256
+	// +optional
+	Links []SmbShareMSDFSLinkSpec `json:"links,omitempty"`
+}
+
+// SmbShareMSDFSLinkSpec defines a DFS link.
+type SmbShareMSDFSLinkSpec struct {
+	// Name is the name of the link in the root directory of the share.
+	// +kubebuilder:validation:MinLength:=1
+	// +kubebuilder:validation:MaxLength:=255
+	Name string `json:"name"`
+
+	// Targets lists the UNC paths, as \\server\share or
+	// \\server\share\path, that clients following the link are referred
+	// to. Clients try them in order.
+	// +kubebuilder:validation:MinItems:=1
+	Targets []string `json:"targets"`
+}
+
+// SmbShareUsersSpec identifies the users secret of a share.
+type SmbShareUsersSpec struct {
+	// Secret names the secret storing the user configuration json. It is
+	// looked up alongside the users secret of the security config.
+	// +kubebuilder:validation:MinLength:=1
+	Secret string `json:"secret"`
+
+	// Key identifies the key within the secret that stores the user
+	// configuration json.
+	// +kubebuilder:validation:MinLength:=1
+	Key string `json:"key"`
+}
+
+// SmbShareAccessControl lists the users and groups permitted or denied
+// access to a share. Groups are given with a leading "@", for example
+// "@staff". For shares using Active Directory, domain users and groups are
+// given as DOMAIN\name.
+type SmbShareAccessControl struct {
+	// ValidUsers are the only users and groups allowed to connect to the
+	// share. If empty, all users may connect.
+	// +optional
+	ValidUsers []string `json:"validUsers,omitempty"`
+
+	// InvalidUsers are users and groups never allowed to connect to the
+	// share.
+	// +optional
+	InvalidUsers []string `json:"invalidUsers,omitempty"`
+
+	// ReadList are users and groups given read-only access to the share.
+	// +optional
+	ReadList []string `json:"readList,omitempty"`
+
+	// WriteList are users and groups given read-write access to the share,
+	// even if the share is read-only. Names may not also appear in ReadList.
+	// +optional
+	WriteList []string `json:"writeList,omitempty"`
+}
+
+// SmbShareQuotaSpec configures the quota of a share.
+type SmbShareQuotaSpec struct {
+	// Size is the amount of data that may be stored on the share. Once
+	// the share holds more data it only accepts reads until the quota is
+	// raised or data is removed by an administrator.
+	// +kubebuilder:validation:Required
+	Size resource.Quantity `json:"size"`
+
+	// Disabled turns off the quota while keeping its settings.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// SmbShareHomeDirectoriesSpec configures a share providing per-user home
+// directories.
+type SmbShareHomeDirectoriesSpec struct {
+	// BaseDir is the directory, relative to the root of the volume, that
+	// contains the home directories of the users. It is created if needed.
+	// +kubebuilder:validation:Pattern:=`^[A-Za-z0-9_-][A-Za-z0-9._-]*(/[A-Za-z0-9_-][A-Za-z0-9._-]*)*$`
+	// +kubebuilder:default:=homes
+	// +optional
+	BaseDir string `json:"baseDir,omitempty"`
+
+	// CreateUserDirs creates the home directory of a user, owned by the
+	// user, the first time they connect. If unset, users without an
+	// existing directory under BaseDir can not connect.
+	// +optional
+	CreateUserDirs bool `json:"createUserDirs,omitempty"`
+}
+
+// SmbShareDosAttributeMappingSpec selects the DOS attributes mapped to the
+// permissions of the files of a share. Unset fields keep samba's defaults.
+type SmbShareDosAttributeMappingSpec struct {
+	// Archive maps the archive attribute to the owner execute bit.
+	// +optional
+	Archive *bool `json:"archive,omitempty"`
+
+	// Hidden maps the hidden attribute to the other execute bit.
+	// +optional
+	Hidden *bool `json:"hidden,omitempty"`
+
+	// System maps the system attribute to the group execute bit.
+	// +optional
+	System *bool `json:"system,omitempty"`
+
+	// ReadOnly selects how the read-only attribute is mapped. With "yes"
+	// it is mapped to the owner write bit, with "permissions" it is
+	// derived from the permissions of the connected user and with "no"
+	// it is not mapped.
+	// +kubebuilder:validation:Enum:=yes;no;permissions
+	// +optional
+	ReadOnly string `json:"readOnly,omitempty"`
+}
+
+// SmbShareMacOSSpec configures the support of a share for macOS clients.
+type SmbShareMacOSSpec struct {
+	// Fruit loads the fruit module, which provides the SMB extensions of
+	// macOS clients, into the share. Finder metadata and resource forks are
+	// stored as streams in extended attributes, which the backing volume
+	// must support.
+	// +optional
+	Fruit bool `json:"fruit,omitempty"`
+
+	// Spotlight lets macOS clients search the share with Spotlight. It
+	// requires Fruit. Searches are answered from the Elasticsearch index of
+	// the share, and return no results if no Elasticsearch server is set.
+	// +optional
+	Spotlight bool `json:"spotlight,omitempty"`
+
+	// Elasticsearch is the server holding the index of the share that
+	// Spotlight searches are answered from.
+	// +optional
+	Elasticsearch *SmbSpotlightElasticsearch `json:"elasticsearch,omitempty"`
+}
+
+// SmbSpotlightElasticsearch is the Elasticsearch server indexing the files
+// of a share.
+type SmbSpotlightElasticsearch struct {
+	// Address is the host name or IP address of the Elasticsearch server.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	Address string `json:"address"`
+
+	// Port is the port of the Elasticsearch server. Defaults to 9200.
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=65535
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+
+	// Index is the name of the Elasticsearch index of the share. Defaults
+	// to _all.
+	// +optional
+	Index string `json:"index,omitempty"`
+}
+
+// SmbShareACLSpec configures the handling of ACLs on a share.
+type SmbShareACLSpec struct {
+	// Mode selects the ACL semantics of the share. With "posix" the ACLs
+	// set by clients are mapped to POSIX ACLs on the file system. With
+	// "windows" the full Windows NT ACLs are stored in extended attributes
+	// and the POSIX ACLs of the file system are ignored. The "windows" mode
+	// requires a volume that supports extended attributes.
+	// +kubebuilder:validation:Enum:=posix;windows
+	// +kubebuilder:default:=posix
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// Inherit enables the inheritance of ACLs by new files and directories
+	// from their parent directory.
+	// +optional
+	Inherit bool `json:"inherit,omitempty"`
+
+	// WindowsEditing lets Windows clients manage the permissions of the
+	// share from the Security tab of the file properties, as on a Windows
+	// server: users with write access to a file may change its permissions
+	// and members of the group owning a file may change its ACL. Requires
+	// the "windows" mode.
+	// +optional
+	WindowsEditing bool `json:"windowsEditing,omitempty"`
+}
+
+// SmbSharePodSettings contains per-share customizations of the pods that
+// host the share.
+type SmbSharePodSettings struct {
+	SmbPodSchedulingSettings `json:",inline"`
+
+	// NetworkAttachments lists the Multus NetworkAttachmentDefinitions the
+	// pods that host the share are attached to. They override those of the
+	// common config.
+	// +optional
+	NetworkAttachments []SmbNetworkAttachment `json:"networkAttachments,omitempty"`
+
+	// Resources sets the compute resource requests and limits of the smbd
+	// containers of the pods that host the share. Each request and limit
+	// overrides the same one of the common config.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// SmbShareStorageSpec defines how storage is associated with a share.
+type SmbShareStorageSpec struct {
+	// Backend selects how the samba servers reach the storage of the
+	// share. With "pvc", the default, the PVC is mounted into the pods.
+	// With "cephfs" or "glusterfs" samba accesses the file system through
+	// its own VFS module, configured by the section of the same name, and
+	// no volume is mounted.
+	// +kubebuilder:validation:Enum:=pvc;cephfs;glusterfs
+	// +optional
+	Backend string `json:"backend,omitempty"`
+
+	// Pvc defines PVC backed storage for this share.
+	// +optional
+	Pvc *SmbSharePvcSpec `json:"pvc,omitempty"`
+
+	// CephFS defines how to connect to the CephFS file system of a share
+	// using the cephfs backend.
+	// +optional
+	CephFS *SmbShareCephFSSpec `json:"cephfs,omitempty"`
+
+	// GlusterFS defines how to connect to the Gluster volume of a share
+	// using the glusterfs backend.
+	// +optional
+	GlusterFS *SmbShareGlusterFSSpec `json:"glusterfs,omitempty"`
+
+	// InitPermissions sets the owner and mode of the share's directory
+	// before the samba server starts. This lets a server that does not run
+	// as root write to freshly provisioned volumes owned by root.
+	// +optional
+	InitPermissions *SmbShareInitPermissionsSpec `json:"initPermissions,omitempty"`
+
+	// Path is the directory of the PVC that is shared, relative to the
+	// root of the volume, such as "projects/current". Missing directories
+	// are created before the samba server starts, unless RequirePathExists
+	// is set. Defaults to the root of
+	// the volume. With the cephfs and glusterfs backends it is relative to
+	// the root of the file system and must exist. The path may refer to
+	// the name and namespace of the SmbShare as {{ .Name }} and
+	// {{ .Namespace }}, as in "teams/{{ .Name }}", so that the shares of a
+	// volume each get a directory of their own.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// RequirePathExists makes the samba server wait for the directory of
+	// Path to exist on the PVC, rather than creating the missing
+	// directories. The share is marked Degraded while the directory is
+	// missing.
+	// +optional
+	RequirePathExists bool `json:"requirePathExists,omitempty"`
+}
+
+// SmbShareCephFSSpec defines the connection to a CephFS file system.
+type SmbShareCephFSSpec struct {
+	// Secret is the name of a Secret, in the namespace of the pods, holding
+	// the ceph.conf of the cluster, in key "ceph.conf", and the keyring of
+	// the user. It is mounted at /etc/ceph/<secret name>, where ceph.conf
+	// should look for the keyring.
+	// +kubebuilder:validation:MinLength:=1
+	// +kubebuilder:validation:Required
+	Secret string `json:"secret"`
+
+	// UserID is the ceph user the samba servers connect as, without the
+	// "client." prefix.
+	// +kubebuilder:validation:MinLength:=1
+	// +kubebuilder:validation:Required
+	UserID string `json:"userID"`
+
+	// FileSystem is the name of the file system to use, when the cluster
+	// has more than one.
+	// +optional
+	FileSystem string `json:"fileSystem,omitempty"`
+}
+
+// SmbShareGlusterFSSpec defines the connection to a Gluster volume.
+type SmbShareGlusterFSSpec struct {
+	// Volume is the name of the Gluster volume.
+	// +kubebuilder:validation:MinLength:=1
+	// +kubebuilder:validation:Required
+	Volume string `json:"volume"`
+
+	// Servers lists the servers the volume file is fetched from, tried in
+	// order, optionally with a "tcp+" or "unix+" prefix and a port.
+	// +kubebuilder:validation:MinItems:=1
+	// +kubebuilder:validation:Required
+	Servers []string `json:"servers"`
+}
+
+// SmbShareInitPermissionsSpec defines the owner and mode given to the
+// share's directory. The directory is left alone if it already has them,
+// and the contents of the directory are never changed.
+type SmbShareInitPermissionsSpec struct {
+	// UID is the user that will own the share's directory.
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:validation:Required
+	UID int64 `json:"uid"`
+
+	// GID is the group that will own the share's directory.
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:validation:Required
+	GID int64 `json:"gid"`
+
+	// Mode is an octal mode, such as "0770", given to the share's
+	// directory. Defaults to "0775".
+	// +kubebuilder:validation:Pattern:=`^0?[0-7]{3,4}$`
+	// +optional
+	Mode string `json:"mode,omitempty"`
+}
+
+// SmbSharePvcSpec defines how a PVC may be associated with a share. Either
+// an existing PVC is named by ClaimName, or a new PVC is described by
+// Template.
+type SmbSharePvcSpec struct {
+	// ClaimName is the name of an existing PVC to use for the share.
+	// +optional
+	ClaimName string `json:"claimName,omitempty"`
+
+	// Template defines a new PVC that the operator creates for the share.
+	// +optional
+	Template *SmbSharePvcTemplate `json:"template,omitempty"`
+
+	// RetainPolicy controls if a PVC created from the Template is deleted
+	// along with the SmbShare. PVCs that are not created by the operator
+	// are never deleted.
+	// +kubebuilder:validation:Enum:=Delete;Retain
+	// +kubebuilder:default:=Delete
+	// +optional
+	RetainPolicy string `json:"retainPolicy,omitempty"`
+
+	// ReadOnlyMount mounts the PVC read-only in the containers of the
+	// share's pods, so that nothing can write to it, as for the replica of
+	// a volume serving a disaster recovery standby. It implies ReadOnly,
+	// and may not be used with settings that write to the volume.
+	// +optional
+	ReadOnlyMount bool `json:"readOnlyMount,omitempty"`
+}
+
+// SmbSharePvcTemplate describes a PVC created for a share.
+type SmbSharePvcTemplate struct {
+	// Spec of the PVC. Behaves similar to the embedded PVC spec for pods.
+	// +optional
+	Spec *corev1.PersistentVolumeClaimSpec `json:"spec,omitempty"`
+
+	// StorageClassName selects the storage class of the PVC. It takes
+	// precedence over any storage class specified within Spec. If unset,
+	// and Spec does not specify a storage class, the cluster's default
+	// storage class will be used.
+	// +kubebuilder:validation:MinLength:=1
+	// +optional
+	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// AccessModes overrides the access modes of the PVC given in Spec.
+	// Shares served by more than one replica require ReadWriteMany.
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+
+	// VolumeMode overrides the volume mode of the PVC given in Spec.
+	// Defaults to Filesystem, which samba requires to serve files: shares
+	// whose PVC has volume mode Block are rejected.
+	// +kubebuilder:validation:Enum:=Filesystem;Block
+	// +optional
+	VolumeMode *corev1.PersistentVolumeMode `json:"volumeMode,omitempty"`
+
+	// Annotations are set on the PVC, such as those selecting the
+	// volumes backed up by a backup tool. Unlike the spec of the PVC, the
+	// annotations are reconciled after the PVC is created: annotations
+	// removed from the share are removed from the PVC, while annotations
+	// set on the PVC by others are left alone.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// SmbShareStatus defines the observed state of SmbShare
+type SmbShareStatus struct {
+	// ServerGroup is a string indicating a name for the smb server or group of
+	// servers hosting this share. The name is assigned by the operator but is
+	// frequently the same as the SmbShare resource's name.
+	ServerGroup string `json:"serverGroup,omitempty"`
+
+	// PublishedDNSName is the DNS hostname that the share's Service was
+	// annotated with for ExternalDNS.
+	// +optional
+	PublishedDNSName string `json:"publishedDNSName,omitempty"`
+
+	// Port is the TCP port the share is served on.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// Quota reports the usage of the share's quota.
+	// +optional
+	Quota *SmbShareQuotaStatus `json:"quota,omitempty"`
+
+	// SmbConfConfigMap names the ConfigMap, in the namespace of the
+	// SmbShare, holding the smb.conf generated for the share's server
+	// group under the key "smb.conf".
+	// +optional
+	SmbConfConfigMap string `json:"smbConfConfigMap,omitempty"`
+
+	// ConfigMode is "Unmanaged" if the samba servers of the share load the
+	// smb.conf supplied by the customConfig of the SmbCommonConfig rather
+	// than the configuration the operator generates, and "Managed"
+	// otherwise.
+	// +optional
+	ConfigMode string `json:"configMode,omitempty"`
+
+	// ActiveConnections is the number of client connections to the share,
+	// across the pods serving it, when they were last counted. It is unset
+	// while no pod serving the share is ready.
+	// +optional
+	ActiveConnections *int32 `json:"activeConnections,omitempty"`
+
+	// EncryptionInEffect counts the client connections to the share that
+	// are, and are not, encrypted, when the connections were last counted,
+	// so that the clients unable to encrypt can be found before Encryption
+	// is set to required. It is unset along with ActiveConnections.
+	// +optional
+	EncryptionInEffect *SmbShareEncryptionStatus `json:"encryptionInEffect,omitempty"`
+
+	// ProfileCounters holds the non-zero profiling counters of the samba
+	// servers of the share, summed across the pods serving it, when they
+	// were last read. It is only set while profiling is turned on by the
+	// common config of the share.
+	// +optional
+	ProfileCounters map[string]int64 `json:"profileCounters,omitempty"`
+
+	// NetworkAddresses lists the addresses of the pods serving the share on
+	// the secondary networks they are attached to, as reported by Multus.
+	// It is unset if the pods are not attached to secondary networks.
+	// +optional
+	NetworkAddresses []string `json:"networkAddresses,omitempty"`
+
+	// Resources lists the resources, existing at the time of the last
+	// reconcile, that the operator manages for the share, including those
+	// shared with the other shares of its server group.
+	// +optional
+	Resources []SmbShareResourceRef `json:"resources,omitempty"`
+
+	// SelfTestPassed is the result of the last self test of the share. It
+	// is unset while the share is not self tested, or while its test has
+	// not finished.
+	// +optional
+	SelfTestPassed *bool `json:"selfTestPassed,omitempty"`
+
+	// Health is the result of the last health probe of the share's
+	// Service. It is unset if the share has no health check.
+	// +optional
+	Health *SmbShareHealthStatus `json:"health,omitempty"`
+
+	// InfectedFiles is the number of infected files the virus scanners of
+	// the pods serving the share have found since the pods started, when
+	// they were last counted. It is only set while the share is scanned for
+	// viruses.
+	// +optional
+	InfectedFiles *int32 `json:"infectedFiles,omitempty"`
+
+	// Conditions describe the current state of the SmbShare.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// SmbShareResourceRef refers to a resource managed by the operator for a
+// share.
+type SmbShareResourceRef struct {
+	// Kind of the resource, such as "Deployment".
+	Kind string `json:"kind"`
+
+	// Name of the resource.
+	Name string `json:"name"`
+
+	// Namespace of the resource.
+	Namespace string `json:"namespace"`
+}
+
+// SmbShareQuotaStatus reports the usage of a share's quota.
+type SmbShareQuotaStatus struct {
+	// Used is the amount of data stored on the share when it was last
+	// measured.
+	// +optional
+	Used *resource.Quantity `json:"used,omitempty"`
+
+	// Exceeded is true if the share holds more data than its quota allows.
+	// While exceeded, the share is read-only.
+	// +optional
+	Exceeded bool `json:"exceeded,omitempty"`
+}
+
+// SmbShareHealthCheckSpec configures the health check of a share.
+type SmbShareHealthCheckSpec struct {
+	// Negotiate checks that the samba server answers an anonymous SMB2
+	// negotiate request, rather than only that its port accepts TCP
+	// connections.
+	// +optional
+	Negotiate bool `json:"negotiate,omitempty"`
+}
+
+// SmbShareAntivirusSpec configures the virus scanning of a share.
+type SmbShareAntivirusSpec struct {
+	// Scanner selects the ClamAV daemon scanning the files. With
+	// "sidecar", the default, the operator runs clamd in a sidecar of the
+	// pods serving the share. With "external", clamd is run by an extra
+	// container of the share's common config, which mounts the "antivirus"
+	// volume of the pods and creates its socket there. clamd is given the
+	// paths of the files to scan, so it must see the share at the path the
+	// samba server does.
+	// +kubebuilder:validation:Enum:=sidecar;external
+	// +optional
+	Scanner string `json:"scanner,omitempty"`
+
+	// Socket is the name of the clamd socket in the antivirus volume.
+	// Defaults to "clamd.sock".
+	// +kubebuilder:validation:Pattern:=`^[^/]+$`
+	// +optional
+	Socket string `json:"socket,omitempty"`
+
+	// ScanOnOpen scans files when clients open them. Defaults to true.
+	// +optional
+	ScanOnOpen *bool `json:"scanOnOpen,omitempty"`
+
+	// ScanOnClose scans files when clients close them after writing to
+	// them, so that infected uploads are caught as they are made rather
+	// than when they are next opened.
+	// +optional
+	ScanOnClose bool `json:"scanOnClose,omitempty"`
+
+	// InfectedFileAction is what is done with the infected files found.
+	// With "quarantine", the default, they are moved to the quarantine
+	// directory. With "delete", they are deleted. With "nothing", they are
+	// left in place; clients are denied access to them all the same.
+	// +kubebuilder:validation:Enum:=quarantine;delete;nothing
+	// +optional
+	InfectedFileAction string `json:"infectedFileAction,omitempty"`
+
+	// QuarantineDirectory is the name of the directory, at the root of the
+	// share, that infected files are moved to. It is hidden from clients.
+	// Defaults to ".quarantine".
+	// +kubebuilder:validation:Pattern:=`^[^/]+$`
+	// +optional
+	QuarantineDirectory string `json:"quarantineDirectory,omitempty"`
+
+	// BlockOnError denies clients access to the files that could not be
+	// scanned, such as while the scanner is unavailable, rather than
+	// allowing it.
+	// +optional
+	BlockOnError bool `json:"blockOnError,omitempty"`
+}
+
+// SmbShareHealthStatus reports the result of the health probes of a share.
+type SmbShareHealthStatus struct {
+	// Reachable is true if the last health probe succeeded.
+	Reachable bool `json:"reachable"`
+
+	// Message tells why the last health probe failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// LastTransitionTime is the last time Reachable changed.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// SmbShareEncryptionStatus counts the encrypted client connections to a
+// share.
+type SmbShareEncryptionStatus struct {
+	// Encrypted is the number of encrypted connections.
+	Encrypted int32 `json:"encrypted"`
+
+	// Unencrypted is the number of connections that are not encrypted.
+	Unencrypted int32 `json:"unencrypted"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Connections",type=integer,JSONPath=`.status.activeConnections`
+// +kubebuilder:printcolumn:name="Config",type=string,JSONPath=`.status.configMode`,priority=1
+// +kubebuilder:printcolumn:name="Suspended",type=boolean,JSONPath=`.spec.suspended`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SmbShare is the Schema for the smbshares API
+type SmbShare struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SmbShareSpec   `json:"spec,omitempty"`
+	Status SmbShareStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SmbShareList contains a list of SmbShare
+type SmbShareList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SmbShare `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SmbShare{}, &SmbShareList{})
+}
@@ -0,0 +1,121 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// WatchedNamespaces returns the namespaces the manager is to watch, given
+// the namespaces requested on the command line and the working namespace
+// of the operator. The working namespace, where the operator creates the
+// resources for shares, is always watched. An empty result means all
+// namespaces are watched.
+func WatchedNamespaces(requested []string, workingNamespace string) []string {
+	namespaces := []string{}
+	seen := map[string]bool{}
+	for _, ns := range requested {
+		if ns == "" || seen[ns] {
+			continue
+		}
+		seen[ns] = true
+		namespaces = append(namespaces, ns)
+	}
+	if len(namespaces) > 0 && !seen[workingNamespace] {
+		namespaces = append(namespaces, workingNamespace)
+	}
+	return namespaces
+}
+
+// NamespacedCacheOptions sets up the manager options to only watch the
+// given namespaces. Reads of cluster scoped resources, and of resources in
+// other namespaces, are passed directly to the API server as the cache can
+// not serve them.
+func NamespacedCacheOptions(opts *manager.Options, namespaces []string) {
+	opts.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	opts.NewClient = func(
+		c cache.Cache,
+		config *rest.Config,
+		options client.Options) (client.Client, error) {
+		// ---
+		direct, err := client.New(config, options)
+		if err != nil {
+			return nil, err
+		}
+		return &client.DelegatingClient{
+			Reader:       newScopedReader(c, direct, namespaces),
+			Writer:       direct,
+			StatusClient: direct,
+		}, nil
+	}
+}
+
+// scopedReader reads from the cache for the watched namespaces, and from
+// the API server for everything else.
+type scopedReader struct {
+	cache      client.Reader
+	direct     client.Reader
+	namespaces map[string]bool
+}
+
+func newScopedReader(
+	cache, direct client.Reader, namespaces []string) *scopedReader {
+	// ---
+	r := &scopedReader{
+		cache:      cache,
+		direct:     direct,
+		namespaces: map[string]bool{},
+	}
+	for _, ns := range namespaces {
+		r.namespaces[ns] = true
+	}
+	return r
+}
+
+func (r *scopedReader) reader(ns string) client.Reader {
+	if r.namespaces[ns] {
+		return r.cache
+	}
+	return r.direct
+}
+
+// Get retrieves an obj for the given object key. Unstructured objects are
+// always read from the API server, as by the manager's default client.
+func (r *scopedReader) Get(
+	ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	// ---
+	if _, ok := obj.(*unstructured.Unstructured); ok {
+		return r.direct.Get(ctx, key, obj)
+	}
+	return r.reader(key.Namespace).Get(ctx, key, obj)
+}
+
+// List retrieves a list of objects for the given list options.
+func (r *scopedReader) List(
+	ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	// ---
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	return r.reader(listOpts.Namespace).List(ctx, list, opts...)
+}
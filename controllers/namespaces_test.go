@@ -0,0 +1,77 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestWatchedNamespaces(t *testing.T) {
+	assert.Empty(t, WatchedNamespaces(nil, "samba"))
+	assert.Empty(t, WatchedNamespaces([]string{""}, "samba"))
+	assert.Equal(t,
+		[]string{"tenant1", "samba"},
+		WatchedNamespaces([]string{"tenant1"}, "samba"))
+	assert.Equal(t,
+		[]string{"tenant1", "samba", "tenant2"},
+		WatchedNamespaces([]string{"tenant1", "samba", "tenant2", "tenant1"}, "samba"))
+}
+
+func TestScopedReader(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	// the cache only holds objects of the watched namespace, the API
+	// server all of them.
+	cached := fake.NewFakeClientWithScheme(scheme,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name: "cfg", Namespace: "tenant1"}},
+	)
+	direct := fake.NewFakeClientWithScheme(scheme,
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fast"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name: "other", Namespace: "tenant2"}},
+	)
+	r := newScopedReader(cached, direct, []string{"tenant1"})
+	ctx := context.TODO()
+
+	assert.NoError(t, r.Get(ctx,
+		types.NamespacedName{Name: "cfg", Namespace: "tenant1"},
+		&corev1.ConfigMap{}))
+	assert.NoError(t, r.Get(ctx,
+		types.NamespacedName{Name: "fast"},
+		&storagev1.StorageClass{}))
+	assert.NoError(t, r.Get(ctx,
+		types.NamespacedName{Name: "other", Namespace: "tenant2"},
+		&corev1.ConfigMap{}))
+
+	l := &corev1.ConfigMapList{}
+	assert.NoError(t, r.List(ctx, l, client.InNamespace("tenant1")))
+	if assert.Len(t, l.Items, 1) {
+		assert.Equal(t, "cfg", l.Items[0].Name)
+	}
+}
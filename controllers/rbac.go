@@ -0,0 +1,154 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// the verbs of the RBAC rules of the reconcilers
+var (
+	readVerbs   = []string{"get", "list", "watch"}
+	manageVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete"}
+	statusVerbs = []string{"get", "update", "patch"}
+)
+
+// NamespacedRules returns the RBAC rules the reconcilers need on the
+// namespaced resources of a namespace they manage shares in. They match
+// the kubebuilder:rbac markers of the reconcilers, from which the
+// ClusterRole of cluster wide installs is generated.
+func NamespacedRules() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		rule("samba-operator.samba.org", "smbshares", manageVerbs...),
+		rule("samba-operator.samba.org", "smbshares/finalizers", statusVerbs...),
+		rule("samba-operator.samba.org", "smbshares/status", statusVerbs...),
+		rule("samba-operator.samba.org", "smbsecurityconfigs", manageVerbs...),
+		rule("samba-operator.samba.org", "smbsecurityconfigs/status", statusVerbs...),
+		rule("samba-operator.samba.org", "smbcommonconfigs", manageVerbs...),
+		rule("samba-operator.samba.org", "smbcommonconfigs/status", statusVerbs...),
+		rule("samba-operator.samba.org", "smbusers", readVerbs...),
+		rule("apps", "deployments", manageVerbs...),
+		rule("apps", "statefulsets", manageVerbs...),
+		rule("batch", "jobs", manageVerbs...),
+		rule("", "pods", "get", "list", "watch", "patch"),
+		rule("", "pods/exec", "create"),
+		rule("", "persistentvolumeclaims", manageVerbs...),
+		rule("", "configmaps", manageVerbs...),
+		rule("", "services", manageVerbs...),
+		rule("", "events", "create", "list"),
+		rule("", "secrets", "get", "list", "watch", "create", "update", "patch"),
+		rule("policy", "poddisruptionbudgets", manageVerbs...),
+		rule("monitoring.coreos.com", "servicemonitors", manageVerbs...),
+		rule("secrets-store.csi.x-k8s.io", "secretproviderclasses", "get"),
+		// the Certificate of the webhook server, see internal/certs.
+		rule("cert-manager.io", "certificates", "get", "create"),
+	}
+}
+
+// ClusterScopedRules returns the RBAC rules the reconcilers need on cluster
+// scoped resources, which namespaced Roles can not grant.
+func ClusterScopedRules() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		rule("", "nodes/proxy", "get"),
+		rule("", "persistentvolumes", readVerbs...),
+		rule("scheduling.k8s.io", "priorityclasses", readVerbs...),
+		rule("storage.k8s.io", "storageclasses", readVerbs...),
+	}
+}
+
+func rule(group, resource string, verbs ...string) rbacv1.PolicyRule {
+	return rbacv1.PolicyRule{
+		APIGroups: []string{group},
+		Resources: []string{resource},
+		Verbs:     verbs,
+	}
+}
+
+// RBACConfig configures the RBAC resources generated for an operator
+// watching some namespaces.
+type RBACConfig struct {
+	// Name is the name of the generated Roles, ClusterRole and bindings.
+	Name string
+	// Namespaces are the namespaces the operator watches.
+	Namespaces []string
+	// WorkingNamespace is the working namespace of the operator, which it
+	// always watches.
+	WorkingNamespace string
+	// ServiceAccount is the name of the ServiceAccount the operator runs
+	// as.
+	ServiceAccount string
+	// ServiceAccountNamespace is the namespace of the ServiceAccount.
+	ServiceAccountNamespace string
+}
+
+// NamespacedRBAC returns the RBAC resources an operator watching the
+// namespaces of the config needs: a Role and RoleBinding in each watched
+// namespace, including the working namespace, and a ClusterRole and
+// ClusterRoleBinding for the cluster scoped resources it reads.
+func NamespacedRBAC(cfg RBACConfig) []runtime.Object {
+	subjects := []rbacv1.Subject{{
+		Kind:      rbacv1.ServiceAccountKind,
+		Name:      cfg.ServiceAccount,
+		Namespace: cfg.ServiceAccountNamespace,
+	}}
+	typeMeta := func(kind string) metav1.TypeMeta {
+		return metav1.TypeMeta{
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+			Kind:       kind,
+		}
+	}
+	objs := []runtime.Object{}
+	for _, ns := range WatchedNamespaces(cfg.Namespaces, cfg.WorkingNamespace) {
+		meta := metav1.ObjectMeta{Name: cfg.Name, Namespace: ns}
+		objs = append(objs,
+			&rbacv1.Role{
+				TypeMeta:   typeMeta("Role"),
+				ObjectMeta: meta,
+				Rules:      NamespacedRules(),
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   typeMeta("RoleBinding"),
+				ObjectMeta: meta,
+				RoleRef: rbacv1.RoleRef{
+					APIGroup: rbacv1.GroupName,
+					Kind:     "Role",
+					Name:     cfg.Name,
+				},
+				Subjects: subjects,
+			})
+	}
+	meta := metav1.ObjectMeta{Name: cfg.Name}
+	objs = append(objs,
+		&rbacv1.ClusterRole{
+			TypeMeta:   typeMeta("ClusterRole"),
+			ObjectMeta: meta,
+			Rules:      ClusterScopedRules(),
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   typeMeta("ClusterRoleBinding"),
+			ObjectMeta: meta,
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     cfg.Name,
+			},
+			Subjects: subjects,
+		})
+	return objs
+}
@@ -0,0 +1,133 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ruleVerbs returns the sorted verbs of the rules, by group and resource.
+func ruleVerbs(rules []rbacv1.PolicyRule) map[string][]string {
+	verbs := map[string][]string{}
+	for _, r := range rules {
+		for _, g := range r.APIGroups {
+			for _, res := range r.Resources {
+				key := g + "/" + res
+				verbs[key] = append(verbs[key], r.Verbs...)
+				sort.Strings(verbs[key])
+			}
+		}
+	}
+	return verbs
+}
+
+func TestRBACRulesMatchClusterRole(t *testing.T) {
+	// the ClusterRole is generated from the kubebuilder:rbac markers of the
+	// reconcilers
+	data, err := ioutil.ReadFile("../config/rbac/role.yaml")
+	require.NoError(t, err)
+	role := &rbacv1.ClusterRole{}
+	require.NoError(t, yaml.Unmarshal(data, role))
+	rules := append(NamespacedRules(), ClusterScopedRules()...)
+	assert.Equal(t, ruleVerbs(role.Rules), ruleVerbs(rules))
+}
+
+func TestNamespacedRulesCoverAPICalls(t *testing.T) {
+	// the calls of the reconcilers, by group/resource
+	calls := map[string][]string{
+		"samba-operator.samba.org/smbshares":               {"get", "list", "watch", "update"},
+		"samba-operator.samba.org/smbshares/status":        {"update"},
+		"samba-operator.samba.org/smbsecurityconfigs":      {"get", "list", "watch"},
+		"samba-operator.samba.org/smbcommonconfigs":        {"get", "list", "watch"},
+		"samba-operator.samba.org/smbusers":                {"get", "list", "watch"},
+		"apps/deployments":                                 {"get", "list", "watch", "create", "update", "patch", "delete"},
+		"apps/statefulsets":                                {"get", "list", "watch", "create", "update", "delete"},
+		"/pods":                                            {"get", "list", "watch", "patch"},
+		"/pods/exec":                                       {"create"},
+		"/persistentvolumeclaims":                          {"get", "list", "watch", "create", "update", "delete"},
+		"/configmaps":                                      {"get", "list", "watch", "create", "update", "delete"},
+		"/services":                                        {"get", "list", "watch", "create", "update", "delete"},
+		"/events":                                          {"create", "list"},
+		"/secrets":                                         {"get", "list", "watch", "create", "update"},
+		"policy/poddisruptionbudgets":                      {"get", "list", "watch", "create", "update", "delete"},
+		"monitoring.coreos.com/servicemonitors":            {"get", "list", "watch", "create", "update", "delete"},
+		"secrets-store.csi.x-k8s.io/secretproviderclasses": {"get"},
+		"cert-manager.io/certificates":                     {"get", "create"},
+	}
+	clusterCalls := map[string][]string{
+		"/nodes/proxy":                      {"get"},
+		"/persistentvolumes":                {"get"},
+		"scheduling.k8s.io/priorityclasses": {"get"},
+		"storage.k8s.io/storageclasses":     {"get"},
+	}
+	check := func(calls map[string][]string, rules []rbacv1.PolicyRule) {
+		t.Helper()
+		allowed := ruleVerbs(rules)
+		for resource, verbs := range calls {
+			for _, v := range verbs {
+				assert.Contains(t, allowed[resource], v, resource)
+			}
+		}
+	}
+	check(calls, NamespacedRules())
+	check(clusterCalls, ClusterScopedRules())
+	// namespaced Roles can not grant access to cluster scoped resources
+	for resource := range ruleVerbs(NamespacedRules()) {
+		_, found := clusterCalls[resource]
+		assert.False(t, found, resource)
+	}
+}
+
+func TestNamespacedRBAC(t *testing.T) {
+	objs := NamespacedRBAC(RBACConfig{
+		Name:                    "samba-operator-manager",
+		Namespaces:              []string{"tenant1", "tenant2", "tenant1"},
+		WorkingNamespace:        "samba-operator-system",
+		ServiceAccount:          "default",
+		ServiceAccountNamespace: "samba-operator-system",
+	})
+	// a Role and RoleBinding per watched namespace, and a ClusterRole and
+	// ClusterRoleBinding
+	require.Len(t, objs, 8)
+	for i, ns := range []string{"tenant1", "tenant2", "samba-operator-system"} {
+		role := objs[2*i].(*rbacv1.Role)
+		binding := objs[2*i+1].(*rbacv1.RoleBinding)
+		assert.Equal(t, "Role", role.Kind)
+		assert.Equal(t, ns, role.Namespace)
+		assert.Equal(t, NamespacedRules(), role.Rules)
+		assert.Equal(t, ns, binding.Namespace)
+		assert.Equal(t, "Role", binding.RoleRef.Kind)
+		assert.Equal(t, "samba-operator-manager", binding.RoleRef.Name)
+		if assert.Len(t, binding.Subjects, 1) {
+			assert.Equal(t, "default", binding.Subjects[0].Name)
+			assert.Equal(t, "samba-operator-system", binding.Subjects[0].Namespace)
+		}
+	}
+	clusterRole := objs[6].(*rbacv1.ClusterRole)
+	assert.Equal(t, "ClusterRole", clusterRole.Kind)
+	assert.Equal(t, ClusterScopedRules(), clusterRole.Rules)
+	clusterBinding := objs[7].(*rbacv1.ClusterRoleBinding)
+	assert.Equal(t, "ClusterRole", clusterBinding.RoleRef.Kind)
+	assert.Equal(t, "rbac.authorization.k8s.io/v1", clusterBinding.APIVersion)
+}
@@ -18,14 +18,27 @@ package controllers
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
 	"github.com/samba-in-kubernetes/samba-operator/internal/resources"
@@ -34,53 +47,330 @@ import (
 // SmbShareReconciler reconciles a SmbShare object
 type SmbShareReconciler struct {
 	client.Client
-	Log      logr.Logger
-	Scheme   *runtime.Scheme
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// MaxConcurrentReconciles is the number of SmbShares that may be
+	// reconciled at the same time. Defaults to 1.
+	MaxConcurrentReconciles int
+	// RateLimiter limits how quickly failed and requeued SmbShares are
+	// reconciled again. Defaults to NewRateLimiter with the default
+	// delays.
+	RateLimiter ratelimiter.RateLimiter
+	// VolumeUsage measures the usage of shares with a quota. Quota usage
+	// is not reported if unset.
+	VolumeUsage resources.VolumeUsageGetter
+	// Connections counts the clients connected to shares. Connections are
+	// not reported if unset.
+	Connections resources.ConnectionCounter
+	// Profiles reads the profiling counters of the samba servers. The
+	// counters are not reported if unset.
+	Profiles resources.ProfileReader
+	// InfectedFiles reads the infected files found on the shares scanned
+	// for viruses. The infected files are not reported if unset.
+	InfectedFiles resources.InfectedFileReader
+	// Health probes the shares with a health check. Their health is not
+	// reported if unset.
+	Health resources.HealthProber
+	// Groups resolves the domain groups granted access to shares. The
+	// groups are not checked if unset.
+	Groups resources.GroupResolver
+	// Joins checks the credentials of the join sources of security configs
+	// before the pods joining the domain are rolled out. The credentials
+	// are not checked if unset.
+	Joins resources.JoinChecker
+	// Capabilities lists the optional APIs available in the cluster.
+	Capabilities resources.Capabilities
+	// EventReader reads the events explaining why the PVC of a share can
+	// not be bound. The events are not looked up if unset.
+	EventReader client.Reader
+	// Reloader makes the samba servers reload the changes of their
+	// configuration that need no restart. Such changes only apply once the
+	// pods restart if unset.
+	Reloader resources.ConfigReloader
 	recorder record.EventRecorder
 }
 
+const (
+	// DefaultRetryBaseDelay is the default delay before a SmbShare is
+	// reconciled again after a first failure.
+	DefaultRetryBaseDelay = 100 * time.Millisecond
+	// DefaultRetryMaxDelay is the default upper bound of the delay before
+	// a SmbShare is reconciled again after repeated failures.
+	DefaultRetryMaxDelay = 5 * time.Minute
+)
+
+// NewRateLimiter returns a rate limiter that delays the retries of an item
+// exponentially, starting with baseDelay and up to maxDelay, while also
+// limiting the overall rate of retries.
+func NewRateLimiter(baseDelay, maxDelay time.Duration) ratelimiter.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		// 10 qps, 100 bucket size, as used by default
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	)
+}
+
+// NamespacedRules and ClusterScopedRules, used to generate the RBAC of
+// namespaced installs, must grant the permissions of these markers.
 //revive:disable kubebuilder directives
 
 // +kubebuilder:rbac:groups=samba-operator.samba.org,resources=smbshares,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=samba-operator.samba.org,resources=smbshares/finalizers,verbs=get;update;patch
 // +kubebuilder:rbac:groups=samba-operator.samba.org,resources=smbshares/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=core,resources=pods/exec,verbs=create
+// +kubebuilder:rbac:groups=core,resources=nodes/proxy,verbs=get
 // +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=persistentvolumes,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=core,resources=events,verbs=create
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;list
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=samba-operator.samba.org,resources=smbusers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=scheduling.k8s.io,resources=priorityclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=secrets-store.csi.x-k8s.io,resources=secretproviderclasses,verbs=get
 
 //revive:enable
 
 // Reconcile SmbShare resources.
 func (r *SmbShareReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
-	reqLogger := r.Log.WithValues("smbshare", req.NamespacedName)
+	// the reconcile ID correlates the log lines of a single reconcile
+	reqLogger := r.Log.WithValues(
+		"smbshare", req.NamespacedName,
+		"reconcileID", uuid.NewUUID())
 	reqLogger.Info("Reconciling SmbShare")
 
 	smbShareManager := resources.NewSmbShareManager(
 		r, r.Scheme, r.recorder, reqLogger)
+	smbShareManager.SetVolumeUsage(r.VolumeUsage)
+	smbShareManager.SetConnectionCounter(r.Connections)
+	smbShareManager.SetProfileReader(r.Profiles)
+	smbShareManager.SetInfectedFileReader(r.InfectedFiles)
+	smbShareManager.SetHealthProber(r.Health)
+	smbShareManager.SetGroupResolver(r.Groups)
+	smbShareManager.SetJoinChecker(r.Joins)
+	smbShareManager.SetCapabilities(r.Capabilities)
+	smbShareManager.SetConfigReloader(r.Reloader)
+	if r.EventReader != nil {
+		smbShareManager.SetEventReader(r.EventReader)
+	}
 	res := smbShareManager.Process(ctx, req.NamespacedName)
 	err := res.Err()
 	if res.Requeue() {
 		return ctrl.Result{Requeue: true}, err
 	}
-	return ctrl.Result{}, err
+	return ctrl.Result{RequeueAfter: res.RequeueAfter()}, err
 }
 
 func (r *SmbShareReconciler) setRecorder(mgr ctrl.Manager) {
 	if r.recorder == nil {
-		r.recorder = mgr.GetEventRecorderFor("smbshare-controller")
+		// stuck shares record the same warnings on every reconcile
+		r.recorder = resources.NewDedupRecorder(
+			mgr.GetEventRecorderFor("smbshare-controller"),
+			resources.DefaultEventInterval)
+	}
+}
+
+// sharesForCommonConfig maps a SmbCommonConfig to reconcile requests for
+// all the SmbShares in the same namespace that refer to it, or for all of
+// them if it is the default common config of the namespace, as its compute
+// resources apply to the shares referring to other common configs too.
+func (r *SmbShareReconciler) sharesForCommonConfig(
+	o handler.MapObject) []reconcile.Request {
+	// ---
+	isDefault := resources.IsDefaultCommonConfig(o.Meta)
+	return r.sharesReferring(
+		o.Meta.GetNamespace(), o.Meta.GetName(),
+		func(s *sambaoperatorv1alpha1.SmbShare) string {
+			if isDefault {
+				return o.Meta.GetName()
+			}
+			return s.Spec.CommonConfig
+		})
+}
+
+// sharesForSecurityConfig maps a SmbSecurityConfig to reconcile requests
+// for all the SmbShares in the same namespace that refer to it, so that a
+// change of the security config is rolled out to the shares' pods.
+func (r *SmbShareReconciler) sharesForSecurityConfig(
+	o handler.MapObject) []reconcile.Request {
+	// ---
+	return r.sharesReferring(
+		o.Meta.GetNamespace(), o.Meta.GetName(), shareSecurityConfig)
+}
+
+// shareSecurityConfig returns the name of the security config of the share.
+func shareSecurityConfig(s *sambaoperatorv1alpha1.SmbShare) string {
+	return s.Spec.SecurityConfig
+}
+
+// sharesForSmbUser maps a SmbUser to reconcile requests for all the
+// SmbShares using its security config, so that the users secret generated
+// for the security config is updated.
+func (r *SmbShareReconciler) sharesForSmbUser(
+	o handler.MapObject) []reconcile.Request {
+	// ---
+	u, ok := o.Object.(*sambaoperatorv1alpha1.SmbUser)
+	if !ok {
+		return nil
 	}
+	return r.sharesReferring(
+		u.Namespace, u.Spec.SecurityConfig, shareSecurityConfig)
+}
+
+// sharesForPasswordSecret maps a Secret to reconcile requests for all the
+// SmbShares using the security config of a SmbUser whose password the
+// Secret holds, a security config importing users from the Secret, or a
+// security config joining the domain with the Secret.
+func (r *SmbShareReconciler) sharesForPasswordSecret(
+	o handler.MapObject) []reconcile.Request {
+	// ---
+	configs := map[string]bool{}
+	requests := []reconcile.Request{}
+	scs := &sambaoperatorv1alpha1.SmbSecurityConfigList{}
+	err := r.List(
+		context.Background(), scs, client.InNamespace(o.Meta.GetNamespace()))
+	if err != nil {
+		r.Log.Error(err, "failed to list SmbSecurityConfigs",
+			"namespace", o.Meta.GetNamespace())
+		return nil
+	}
+	for _, sc := range scs.Items {
+		if !securityConfigUsesSecret(&sc, o.Meta.GetName()) {
+			continue
+		}
+		configs[sc.Name] = true
+		requests = append(requests, r.sharesReferring(
+			sc.Namespace, sc.Name, shareSecurityConfig)...)
+	}
+	users := &sambaoperatorv1alpha1.SmbUserList{}
+	err = r.List(
+		context.Background(), users, client.InNamespace(o.Meta.GetNamespace()))
+	if err != nil {
+		r.Log.Error(err, "failed to list SmbUsers",
+			"namespace", o.Meta.GetNamespace())
+		return nil
+	}
+	for _, u := range users.Items {
+		if u.Spec.Password.Secret != o.Meta.GetName() ||
+			configs[u.Spec.SecurityConfig] {
+			// ---
+			continue
+		}
+		configs[u.Spec.SecurityConfig] = true
+		requests = append(requests, r.sharesReferring(
+			u.Namespace, u.Spec.SecurityConfig, shareSecurityConfig)...)
+	}
+	return requests
+}
+
+// securityConfigUsesSecret returns true if the security config imports its
+// users from, or joins the domain with, the named Secret.
+func securityConfigUsesSecret(
+	sc *sambaoperatorv1alpha1.SmbSecurityConfig, name string) bool {
+	// ---
+	users := sc.Spec.Users
+	if users != nil && users.Import != nil && users.Import.Secret == name {
+		return true
+	}
+	for _, js := range sc.Spec.JoinSources {
+		if js.UserJoin != nil && js.UserJoin.Secret == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sharesForStorageClass maps a StorageClass to reconcile requests for all
+// the SmbShares whose new PVC requests it, so that shares waiting for the
+// storage class are set up once it is created.
+func (r *SmbShareReconciler) sharesForStorageClass(
+	o handler.MapObject) []reconcile.Request {
+	// ---
+	// storage classes are not namespaced: the shares of all namespaces
+	// may request them
+	return r.sharesReferring("", o.Meta.GetName(), resources.StorageClassOf)
+}
+
+// sharesReferring returns reconcile requests for the SmbShares in the
+// namespace ns, or in all namespaces if ns is empty, whose reference, as
+// returned by ref, is name.
+func (r *SmbShareReconciler) sharesReferring(
+	ns, name string,
+	ref func(*sambaoperatorv1alpha1.SmbShare) string) []reconcile.Request {
+	// ---
+	shares := &sambaoperatorv1alpha1.SmbShareList{}
+	err := r.List(context.Background(), shares, client.InNamespace(ns))
+	if err != nil {
+		r.Log.Error(err, "failed to list SmbShares", "namespace", ns)
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for i := range shares.Items {
+		share := &shares.Items[i]
+		if ref(share) != name {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      share.Name,
+				Namespace: share.Namespace,
+			},
+		})
+	}
+	return requests
 }
 
 // SetupWithManager sets up resource management.
 func (r *SmbShareReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.setRecorder(mgr)
+	rateLimiter := r.RateLimiter
+	if rateLimiter == nil {
+		rateLimiter = NewRateLimiter(DefaultRetryBaseDelay, DefaultRetryMaxDelay)
+	}
 	return ctrl.NewControllerManagedBy(mgr).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			RateLimiter:             rateLimiter,
+		}).
 		For(&sambaoperatorv1alpha1.SmbShare{}).
+		Owns(&corev1.ConfigMap{}).
 		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&batchv1.Job{}).
+		Owns(&policyv1beta1.PodDisruptionBudget{}).
+		Watches(
+			&source.Kind{Type: &sambaoperatorv1alpha1.SmbCommonConfig{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.sharesForCommonConfig),
+			}).
+		Watches(
+			&source.Kind{Type: &sambaoperatorv1alpha1.SmbSecurityConfig{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.sharesForSecurityConfig),
+			}).
+		Watches(
+			&source.Kind{Type: &sambaoperatorv1alpha1.SmbUser{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.sharesForSmbUser),
+			}).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.sharesForPasswordSecret),
+			}).
+		Watches(
+			&source.Kind{Type: &storagev1.StorageClass{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.sharesForStorageClass),
+			}).
 		Complete(r)
 }
@@ -0,0 +1,292 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/logging"
+)
+
+func TestSharesForSecurityConfig(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = sambaoperatorv1alpha1.AddToScheme(scheme)
+	share := func(name, ns, security, common string) *sambaoperatorv1alpha1.SmbShare {
+		s := &sambaoperatorv1alpha1.SmbShare{}
+		s.Name = name
+		s.Namespace = ns
+		s.Spec.SecurityConfig = security
+		s.Spec.CommonConfig = common
+		return s
+	}
+	r := &SmbShareReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme,
+			share("one", "default", "ad", "common"),
+			share("two", "default", "ad", ""),
+			share("three", "default", "users", "common"),
+			share("four", "other", "ad", "common"),
+			share("five", "default", "users", "other"),
+		),
+		Log: ctrl.Log,
+	}
+	mapObject := func(obj metav1.Object) handler.MapObject {
+		return handler.MapObject{Meta: obj}
+	}
+	names := func(reqs []ctrl.Request) []types.NamespacedName {
+		out := []types.NamespacedName{}
+		for _, req := range reqs {
+			out = append(out, req.NamespacedName)
+		}
+		return out
+	}
+
+	security := &sambaoperatorv1alpha1.SmbSecurityConfig{}
+	security.Name = "ad"
+	security.Namespace = "default"
+	assert.ElementsMatch(t,
+		[]types.NamespacedName{
+			{Namespace: "default", Name: "one"},
+			{Namespace: "default", Name: "two"},
+		},
+		names(r.sharesForSecurityConfig(mapObject(security))))
+
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Name = "common"
+	common.Namespace = "default"
+	assert.ElementsMatch(t,
+		[]types.NamespacedName{
+			{Namespace: "default", Name: "one"},
+			{Namespace: "default", Name: "three"},
+		},
+		names(r.sharesForCommonConfig(mapObject(common))))
+
+	// the default common config applies to the shares referring to none,
+	// and its compute resources to all of the shares of the namespace
+	common.Labels = map[string]string{
+		"samba-operator.samba.org/default-common-config": "true",
+	}
+	assert.ElementsMatch(t,
+		[]types.NamespacedName{
+			{Namespace: "default", Name: "one"},
+			{Namespace: "default", Name: "two"},
+			{Namespace: "default", Name: "three"},
+			{Namespace: "default", Name: "five"},
+		},
+		names(r.sharesForCommonConfig(mapObject(common))))
+
+	security.Name = "unused"
+	assert.Empty(t, r.sharesForSecurityConfig(mapObject(security)))
+}
+
+func TestSharesForStorageClass(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = sambaoperatorv1alpha1.AddToScheme(scheme)
+	share := func(name, ns, class string) *sambaoperatorv1alpha1.SmbShare {
+		s := &sambaoperatorv1alpha1.SmbShare{}
+		s.Name = name
+		s.Namespace = ns
+		s.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{
+			Spec:             &corev1.PersistentVolumeClaimSpec{},
+			StorageClassName: class,
+		}
+		return s
+	}
+	existing := share("existing", "default", "")
+	existing.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{
+		Name: "data",
+	}
+	r := &SmbShareReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme,
+			share("one", "default", "fast"),
+			share("two", "other", "fast"),
+			share("three", "default", "slow"),
+			share("four", "default", ""),
+			existing,
+		),
+		Log: ctrl.Log,
+	}
+
+	sc := &storagev1.StorageClass{}
+	sc.Name = "fast"
+	reqs := r.sharesForStorageClass(handler.MapObject{Meta: sc})
+	names := []types.NamespacedName{}
+	for _, req := range reqs {
+		names = append(names, req.NamespacedName)
+	}
+	assert.ElementsMatch(t,
+		[]types.NamespacedName{
+			{Namespace: "default", Name: "one"},
+			{Namespace: "other", Name: "two"},
+		},
+		names)
+
+	sc.Name = "unused"
+	assert.Empty(t, r.sharesForStorageClass(handler.MapObject{Meta: sc}))
+}
+
+func TestSharesForSmbUser(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = sambaoperatorv1alpha1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	share := func(name, security string) *sambaoperatorv1alpha1.SmbShare {
+		s := &sambaoperatorv1alpha1.SmbShare{}
+		s.Name = name
+		s.Namespace = "default"
+		s.Spec.SecurityConfig = security
+		return s
+	}
+	user := func(name, security, secret string) *sambaoperatorv1alpha1.SmbUser {
+		u := &sambaoperatorv1alpha1.SmbUser{}
+		u.Name = name
+		u.Namespace = "default"
+		u.Spec.SecurityConfig = security
+		u.Spec.Password.Secret = secret
+		return u
+	}
+	alice := user("alice", "users", "passwords")
+	r := &SmbShareReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme,
+			share("one", "users"),
+			share("two", "users"),
+			share("three", "other"),
+			share("four", "domain"),
+			alice,
+			user("bob", "users", "passwords"),
+			user("carol", "other", "carol"),
+			&sambaoperatorv1alpha1.SmbSecurityConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "users", Namespace: "default"},
+				Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+					Users: &sambaoperatorv1alpha1.SmbSecurityUsersSpec{
+						Import: &sambaoperatorv1alpha1.SmbSecurityUsersImportSpec{
+							Secret: "legacy",
+						},
+					},
+				},
+			},
+			&sambaoperatorv1alpha1.SmbSecurityConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "domain", Namespace: "default"},
+				Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+					Mode: "active-directory",
+					JoinSources: []sambaoperatorv1alpha1.SmbSecurityJoinSpec{{
+						UserJoin: &sambaoperatorv1alpha1.SmbSecurityUserJoinSpec{
+							Secret: "join",
+						},
+					}},
+				},
+			},
+		),
+		Log: ctrl.Log,
+	}
+	names := func(reqs []ctrl.Request) []string {
+		out := []string{}
+		for _, req := range reqs {
+			out = append(out, req.Name)
+		}
+		return out
+	}
+
+	assert.ElementsMatch(t, []string{"one", "two"},
+		names(r.sharesForSmbUser(handler.MapObject{Meta: alice, Object: alice})))
+
+	// shares are requested once per security config
+	secret := &corev1.Secret{}
+	secret.Name = "passwords"
+	secret.Namespace = "default"
+	assert.ElementsMatch(t, []string{"one", "two"},
+		names(r.sharesForPasswordSecret(handler.MapObject{Meta: secret})))
+
+	secret.Name = "carol"
+	assert.ElementsMatch(t, []string{"three"},
+		names(r.sharesForPasswordSecret(handler.MapObject{Meta: secret})))
+
+	// users imported from the secret
+	secret.Name = "legacy"
+	assert.ElementsMatch(t, []string{"one", "two"},
+		names(r.sharesForPasswordSecret(handler.MapObject{Meta: secret})))
+
+	// domain joined with the secret
+	secret.Name = "join"
+	assert.ElementsMatch(t, []string{"four"},
+		names(r.sharesForPasswordSecret(handler.MapObject{Meta: secret})))
+
+	secret.Namespace = "other"
+	assert.Empty(t, r.sharesForPasswordSecret(handler.MapObject{Meta: secret}))
+}
+
+func TestReconcileLogFields(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = sambaoperatorv1alpha1.AddToScheme(scheme)
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	out := &bytes.Buffer{}
+	logger, err := logging.New(logging.FormatJSON, out)
+	require.NoError(t, err)
+	r := &SmbShareReconciler{
+		Client:   fake.NewFakeClientWithScheme(scheme, share),
+		Log:      logger,
+		Scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{
+		Namespace: "default",
+		Name:      "myshare",
+	}}
+
+	ids := map[interface{}]bool{}
+	for i := 0; i < 2; i++ {
+		out.Reset()
+		_, err = r.Reconcile(req)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		// both the reconciler and the share manager log lines
+		require.True(t, len(lines) > 1, out.String())
+		id := ""
+		for _, l := range lines {
+			line := map[string]interface{}{}
+			require.NoError(t, json.Unmarshal([]byte(l), &line), l)
+			assert.Equal(t, "default/myshare", line["smbshare"])
+			lineID, _ := line["reconcileID"].(string)
+			assert.NotEmpty(t, lineID)
+			if id == "" {
+				id = lineID
+			}
+			assert.Equal(t, id, lineID)
+		}
+		ids[id] = true
+	}
+	// each reconcile has its own ID
+	assert.Len(t, ids, 2)
+}
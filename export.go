@@ -0,0 +1,63 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	flag "github.com/spf13/pflag"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/samba-in-kubernetes/samba-operator/internal/resources"
+)
+
+// exportCommand is the name of the subcommand exporting the operator's
+// resources of a namespace.
+const exportCommand = "export"
+
+// runExport writes the SmbCommonConfigs, SmbSecurityConfigs, SmbUsers and
+// SmbShares of a namespace, read from the cluster of the current
+// kubeconfig, to out as YAML ready to be applied again. Nothing is changed
+// in the cluster.
+func runExport(args []string, out io.Writer) error {
+	fset := flag.NewFlagSet(exportCommand, flag.ContinueOnError)
+	var namespace string
+	fset.StringVarP(
+		&namespace,
+		"namespace",
+		"n",
+		"default",
+		"Namespace of the resources to export.")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fset.Args())
+	}
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return err
+	}
+	cl, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	return resources.WriteExport(context.Background(), cl, namespace, out)
+}
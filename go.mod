@@ -4,11 +4,16 @@ go 1.13
 
 require (
 	github.com/go-logr/logr v0.1.0
+	github.com/google/gofuzz v1.1.0
+	github.com/prometheus/client_golang v1.0.0
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.1
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
 	k8s.io/api v0.18.6
 	k8s.io/apimachinery v0.18.6
 	k8s.io/client-go v0.18.6
 	sigs.k8s.io/controller-runtime v0.6.2
+	sigs.k8s.io/structured-merge-diff/v3 v3.0.0
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,390 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package certs provides the TLS certificate of the webhook and metrics
+// servers of the operator. The certificate is read from a directory
+// populated by the deployment, or from a Secret, which cert-manager may be
+// asked to issue. Certificates read from a Secret are written to the
+// directory the webhook server watches, so that a rotated certificate is
+// served without restarting the operator.
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;create
+
+const (
+	// SourceFiles reads the certificate from files mounted into the
+	// directory of the certificate, for example from the Secret of a
+	// Certificate of the deployment.
+	SourceFiles = "files"
+	// SourceSecret reads the certificate from a Secret provided by the
+	// administrator.
+	SourceSecret = "secret"
+	// SourceCertManager reads the certificate from the Secret of a
+	// Certificate, which is created if it does not exist.
+	SourceCertManager = "cert-manager"
+
+	// CertFile is the file name of the certificate in the directory.
+	CertFile = corev1.TLSCertKey
+	// KeyFile is the file name of the private key in the directory.
+	KeyFile = corev1.TLSPrivateKeyKey
+
+	// DefaultRefreshInterval is the default time between checks for a
+	// rotated certificate.
+	DefaultRefreshInterval = time.Minute
+	// DefaultIssuerKind is the default kind of the issuer of the
+	// Certificate.
+	DefaultIssuerKind = "Issuer"
+
+	setupPollInterval = 2 * time.Second
+	setupTimeout      = 5 * time.Minute
+	shutdownTimeout   = 5 * time.Second
+)
+
+// ErrNoCertificate is returned when serving TLS before a certificate was
+// loaded.
+var ErrNoCertificate = errors.New("no TLS certificate loaded")
+
+// CertificateResource is the cert-manager resource of Certificates.
+var CertificateResource = schema.GroupVersionResource{
+	Group:    "cert-manager.io",
+	Version:  "v1",
+	Resource: "certificates",
+}
+
+// Config selects where the certificate is read from.
+type Config struct {
+	// Source of the certificate: files, secret or cert-manager.
+	Source string
+	// Dir is the directory of the certificate files, which the webhook
+	// server watches.
+	Dir string
+	// Namespace of the Secret and Certificate.
+	Namespace string
+	// SecretName is the name of the Secret holding the certificate. With
+	// cert-manager, it is also the name of the Certificate.
+	SecretName string
+	// Issuer is the name of the cert-manager issuer of the Certificate.
+	Issuer string
+	// IssuerKind is the kind of the issuer, Issuer or ClusterIssuer.
+	IssuerKind string
+	// DNSNames are the names the Certificate is issued for.
+	DNSNames []string
+	// RefreshInterval is the time between checks for a rotated
+	// certificate.
+	RefreshInterval time.Duration
+}
+
+// Validate returns an error if the config can not be used.
+func (c Config) Validate() error {
+	switch c.Source {
+	case SourceFiles:
+	case SourceSecret, SourceCertManager:
+		if c.Namespace == "" || c.SecretName == "" {
+			return fmt.Errorf(
+				"certificate source %s requires a Secret name and namespace",
+				c.Source)
+		}
+	default:
+		return fmt.Errorf("certificate source [%s] invalid", c.Source)
+	}
+	if c.Dir == "" {
+		return fmt.Errorf("certificate directory must be set")
+	}
+	if c.Source == SourceCertManager {
+		if c.Issuer == "" {
+			return fmt.Errorf("certificate source %s requires an issuer",
+				c.Source)
+		}
+		if len(c.DNSNames) == 0 {
+			return fmt.Errorf("certificate source %s requires DNS names",
+				c.Source)
+		}
+	}
+	if c.RefreshInterval <= 0 {
+		return fmt.Errorf(
+			"RefreshInterval value [%s] invalid", c.RefreshInterval)
+	}
+	return nil
+}
+
+// Store holds the current certificate and keeps the certificate files up
+// to date.
+type Store struct {
+	cfg     Config
+	client  kubernetes.Interface
+	dynamic dynamic.Interface
+	log     logr.Logger
+
+	lock    sync.RWMutex
+	cert    *tls.Certificate
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// NewStore returns a Store for the config. The dynamic client is only
+// used with cert-manager.
+func NewStore(
+	cfg Config,
+	client kubernetes.Interface,
+	dyn dynamic.Interface,
+	log logr.Logger) *Store {
+	// ---
+	return &Store{cfg: cfg, client: client, dynamic: dyn, log: log}
+}
+
+// Setup creates the Certificate, with cert-manager, and waits until the
+// certificate is loaded. It must be called before the webhook server
+// starts, which fails without certificate files.
+func (s *Store) Setup(ctx context.Context) error {
+	if s.cfg.Source == SourceCertManager {
+		if err := s.ensureCertificate(ctx); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, setupTimeout)
+	defer cancel()
+	var lastErr error
+	err := wait.PollImmediateUntil(setupPollInterval, func() (bool, error) {
+		_, lastErr = s.Sync(ctx)
+		if lastErr != nil {
+			s.log.Info("Waiting for the TLS certificate", "reason", lastErr)
+		}
+		return lastErr == nil, nil
+	}, ctx.Done())
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
+
+// ensureCertificate creates the Certificate issuing the Secret of the
+// certificate unless it exists. An existing Certificate is left alone, so
+// that it can be managed by the deployment.
+func (s *Store) ensureCertificate(ctx context.Context) error {
+	certs := s.dynamic.Resource(CertificateResource).Namespace(s.cfg.Namespace)
+	_, err := certs.Get(ctx, s.cfg.SecretName, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	} else if !kerrors.IsNotFound(err) {
+		return err
+	}
+	s.log.Info("Creating a new Certificate",
+		"Certificate.Namespace", s.cfg.Namespace,
+		"Certificate.Name", s.cfg.SecretName)
+	_, err = certs.Create(ctx, s.certificate(), metav1.CreateOptions{})
+	if kerrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// certificate returns the Certificate issuing the Secret.
+func (s *Store) certificate() *unstructured.Unstructured {
+	dnsNames := make([]interface{}, 0, len(s.cfg.DNSNames))
+	for _, n := range s.cfg.DNSNames {
+		dnsNames = append(dnsNames, n)
+	}
+	kind := s.cfg.IssuerKind
+	if kind == "" {
+		kind = DefaultIssuerKind
+	}
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"secretName": s.cfg.SecretName,
+			"dnsNames":   dnsNames,
+			"issuerRef": map[string]interface{}{
+				"name": s.cfg.Issuer,
+				"kind": kind,
+			},
+		},
+	}}
+	u.SetAPIVersion(CertificateResource.GroupVersion().String())
+	u.SetKind("Certificate")
+	u.SetName(s.cfg.SecretName)
+	u.SetNamespace(s.cfg.Namespace)
+	u.SetLabels(map[string]string{
+		"app.kubernetes.io/managed-by": "samba-operator",
+	})
+	return u
+}
+
+// Sync loads the certificate from its source. A certificate read from a
+// Secret is also written to the directory of the certificate. It returns
+// true if the certificate changed.
+func (s *Store) Sync(ctx context.Context) (bool, error) {
+	certPEM, keyPEM, err := s.read(ctx)
+	if err != nil {
+		return false, err
+	}
+	s.lock.RLock()
+	unchanged := bytes.Equal(certPEM, s.certPEM) && bytes.Equal(keyPEM, s.keyPEM)
+	s.lock.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("invalid TLS certificate: %w", err)
+	}
+	if s.cfg.Source != SourceFiles {
+		if err := s.writeFiles(certPEM, keyPEM); err != nil {
+			return false, err
+		}
+	}
+	s.lock.Lock()
+	s.cert, s.certPEM, s.keyPEM = &cert, certPEM, keyPEM
+	s.lock.Unlock()
+	s.log.Info("Loaded TLS certificate", "source", s.cfg.Source)
+	return true, nil
+}
+
+// read returns the certificate and key of the source, in PEM format.
+func (s *Store) read(ctx context.Context) ([]byte, []byte, error) {
+	if s.cfg.Source == SourceFiles {
+		certPEM, err := ioutil.ReadFile(filepath.Join(s.cfg.Dir, CertFile))
+		if err != nil {
+			return nil, nil, err
+		}
+		keyPEM, err := ioutil.ReadFile(filepath.Join(s.cfg.Dir, KeyFile))
+		if err != nil {
+			return nil, nil, err
+		}
+		return certPEM, keyPEM, nil
+	}
+	secret, err := s.client.CoreV1().Secrets(s.cfg.Namespace).Get(
+		ctx, s.cfg.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM, keyPEM := secret.Data[CertFile], secret.Data[KeyFile]
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return nil, nil, fmt.Errorf("secret %s has no %s and %s keys",
+			s.cfg.SecretName, CertFile, KeyFile)
+	}
+	return certPEM, keyPEM, nil
+}
+
+// writeFiles replaces the certificate files of the directory. Each file is
+// renamed into place, so that the webhook server never reads a partially
+// written file.
+func (s *Store) writeFiles(certPEM, keyPEM []byte) error {
+	if err := os.MkdirAll(s.cfg.Dir, 0700); err != nil {
+		return err
+	}
+	files := []struct {
+		name string
+		data []byte
+	}{{KeyFile, keyPEM}, {CertFile, certPEM}}
+	for _, f := range files {
+		tmp, err := ioutil.TempFile(s.cfg.Dir, "."+f.name)
+		if err != nil {
+			return err
+		}
+		_, err = tmp.Write(f.data)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), filepath.Join(s.cfg.Dir, f.name))
+		}
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+			return err
+		}
+	}
+	return nil
+}
+
+// Start checks the source for a rotated certificate until stop is closed.
+// It implements manager.Runnable.
+func (s *Store) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	wait.Until(func() {
+		if _, err := s.Sync(ctx); err != nil && ctx.Err() == nil {
+			s.log.Error(err, "Failed to refresh the TLS certificate")
+		}
+	}, s.cfg.RefreshInterval, stop)
+	return nil
+}
+
+// GetCertificate returns the current certificate. It is meant to be used
+// as the GetCertificate function of a tls.Config.
+func (s *Store) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.cert == nil {
+		return nil, ErrNoCertificate
+	}
+	return s.cert, nil
+}
+
+// ServeTLS serves handler over TLS, with the current certificate, on addr
+// until stop is closed.
+func (s *Store) ServeTLS(
+	stop <-chan struct{}, addr string, handler http.Handler) error {
+	// ---
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler: handler,
+		TLSConfig: &tls.Config{
+			GetCertificate: s.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		},
+	}
+	go func() {
+		<-stop
+		ctx, cancel := context.WithTimeout(
+			context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+	if err := server.ServeTLS(l, "", ""); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// selfSigned returns a self signed certificate and its key, in PEM format,
+// whose common name is name.
+func selfSigned(t *testing.T, name string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func tlsSecret(t *testing.T, name string) *corev1.Secret {
+	t.Helper()
+	certPEM, keyPEM := selfSigned(t, name)
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "webhook-server-cert",
+			Namespace: "samba-operator-system",
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{CertFile: certPEM, KeyFile: keyPEM},
+	}
+}
+
+// testConfig returns a config of the source with a temporary directory,
+// and a function removing the directory.
+func testConfig(t *testing.T, source string) (Config, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "certs")
+	require.NoError(t, err)
+	return Config{
+		Source:          source,
+		Dir:             dir,
+		Namespace:       "samba-operator-system",
+		SecretName:      "webhook-server-cert",
+		RefreshInterval: 10 * time.Millisecond,
+	}, func() { os.RemoveAll(dir) }
+}
+
+// freePort returns a port of the loopback address that is not in use.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// servedName returns the common name of the certificate served on addr.
+func servedName(addr string) (string, error) {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := Config{
+		Source:          SourceFiles,
+		Dir:             "/tmp/k8s-webhook-server/serving-certs",
+		RefreshInterval: DefaultRefreshInterval,
+	}
+	assert.NoError(t, cfg.Validate())
+	cfg.Source = "vault"
+	assert.Error(t, cfg.Validate())
+	cfg.Source = SourceSecret
+	assert.Error(t, cfg.Validate())
+	cfg.Namespace, cfg.SecretName = "samba-operator-system", "webhook-server-cert"
+	assert.NoError(t, cfg.Validate())
+	cfg.Source = SourceCertManager
+	assert.Error(t, cfg.Validate())
+	cfg.Issuer = "selfsigned-issuer"
+	assert.Error(t, cfg.Validate())
+	cfg.DNSNames = []string{"webhook-service.samba-operator-system.svc"}
+	assert.NoError(t, cfg.Validate())
+	cfg.RefreshInterval = 0
+	assert.Error(t, cfg.Validate())
+}
+
+func TestSyncSecret(t *testing.T) {
+	cfg, cleanup := testConfig(t, SourceSecret)
+	defer cleanup()
+	secret := tlsSecret(t, "first")
+	client := fake.NewSimpleClientset(secret)
+	s := NewStore(cfg, client, nil, ctrl.Log)
+	ctx := context.TODO()
+
+	_, err := s.GetCertificate(nil)
+	assert.Equal(t, ErrNoCertificate, err)
+	changed, err := s.Sync(ctx)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	data, err := ioutil.ReadFile(filepath.Join(cfg.Dir, CertFile))
+	require.NoError(t, err)
+	assert.Equal(t, secret.Data[CertFile], data)
+	data, err = ioutil.ReadFile(filepath.Join(cfg.Dir, KeyFile))
+	require.NoError(t, err)
+	assert.Equal(t, secret.Data[KeyFile], data)
+	cert, err := s.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.NotNil(t, cert)
+
+	changed, err = s.Sync(ctx)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// an invalid certificate is not loaded
+	secret.Data[KeyFile] = tlsSecret(t, "other").Data[KeyFile]
+	_, err = client.CoreV1().Secrets(cfg.Namespace).Update(
+		ctx, secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	_, err = s.Sync(ctx)
+	assert.Error(t, err)
+	current, err := s.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, cert, current)
+
+	// a missing secret fails
+	s = NewStore(cfg, fake.NewSimpleClientset(), nil, ctrl.Log)
+	_, err = s.Sync(ctx)
+	assert.Error(t, err)
+}
+
+func TestWebhookServerLoadsSecret(t *testing.T) {
+	cfg, cleanup := testConfig(t, SourceSecret)
+	defer cleanup()
+	client := fake.NewSimpleClientset(tlsSecret(t, "first"))
+	s := NewStore(cfg, client, nil, ctrl.Log)
+	ctx := context.TODO()
+	require.NoError(t, s.Setup(ctx))
+
+	server := &webhook.Server{
+		Host:    "127.0.0.1",
+		Port:    freePort(t),
+		CertDir: cfg.Dir,
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		assert.NoError(t, server.Start(stop))
+	}()
+	go func() {
+		assert.NoError(t, s.Start(stop))
+	}()
+	addr := net.JoinHostPort(server.Host, fmt.Sprint(server.Port))
+	assert.Eventually(t, func() bool {
+		name, err := servedName(addr)
+		return err == nil && name == "first"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the rotated certificate is served without restarting the server
+	_, err := client.CoreV1().Secrets(cfg.Namespace).Update(
+		ctx, tlsSecret(t, "second"), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		name, err := servedName(addr)
+		return err == nil && name == "second"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSetupCertManager(t *testing.T) {
+	cfg, cleanup := testConfig(t, SourceCertManager)
+	defer cleanup()
+	cfg.Issuer = "selfsigned-issuer"
+	cfg.DNSNames = []string{"webhook-service.samba-operator-system.svc"}
+	client := fake.NewSimpleClientset(tlsSecret(t, "issued"))
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	s := NewStore(cfg, client, dyn, ctrl.Log)
+	ctx := context.TODO()
+	require.NoError(t, s.Setup(ctx))
+
+	u, err := dyn.Resource(CertificateResource).Namespace(cfg.Namespace).Get(
+		ctx, cfg.SecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Certificate", u.GetKind())
+	spec := u.Object["spec"].(map[string]interface{})
+	assert.Equal(t, cfg.SecretName, spec["secretName"])
+	assert.Equal(t, []interface{}{"webhook-service.samba-operator-system.svc"},
+		spec["dnsNames"])
+	assert.Equal(t, map[string]interface{}{
+		"name": "selfsigned-issuer",
+		"kind": "Issuer",
+	}, spec["issuerRef"])
+	_, err = ioutil.ReadFile(filepath.Join(cfg.Dir, CertFile))
+	assert.NoError(t, err)
+
+	// an existing Certificate is left alone
+	require.NoError(t, s.Setup(ctx))
+}
+
+func TestServeTLS(t *testing.T) {
+	cfg, cleanup := testConfig(t, SourceFiles)
+	defer cleanup()
+	secret := tlsSecret(t, "metrics")
+	for name, data := range secret.Data {
+		require.NoError(t, ioutil.WriteFile(
+			filepath.Join(cfg.Dir, name), data, 0600))
+	}
+	s := NewStore(cfg, nil, nil, ctrl.Log)
+	require.NoError(t, s.Setup(context.TODO()))
+
+	addr := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		assert.NoError(t, s.ServeTLS(stop, addr, http.NotFoundHandler()))
+	}()
+	assert.Eventually(t, func() bool {
+		name, err := servedName(addr)
+		return err == nil && name == "metrics"
+	}, 5*time.Second, 10*time.Millisecond)
+}
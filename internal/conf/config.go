@@ -3,9 +3,12 @@ package conf
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // OperatorConfig is a type holding general configuration values.
@@ -17,6 +20,16 @@ type OperatorConfig struct {
 	// SvcWatchContainerImage can be used to select alternate container image
 	// for the service watch utility.
 	SvcWatchContainerImage string `mapstructure:"svc-watch-container-image"`
+	// DNSRegisterContainerImage can be used to select alternate container
+	// image for the dns-register sidecar. If unset the SmbdContainerImage is
+	// used.
+	DNSRegisterContainerImage string `mapstructure:"dns-register-container-image"`
+	// MetricsContainerImage can be used to select alternate container image
+	// for the metrics exporter sidecar.
+	MetricsContainerImage string `mapstructure:"metrics-container-image"`
+	// ClamAVContainerImage can be used to select alternate container image
+	// for the ClamAV sidecar of the shares scanned for viruses.
+	ClamAVContainerImage string `mapstructure:"clamav-container-image"`
 	// SmbdContainerName can be used to set the name of the primary container,
 	// the one running smbd, in the pod.
 	SmbdContainerName string `mapstructure:"smbd-container-name"`
@@ -26,6 +39,47 @@ type OperatorConfig struct {
 	// SambaDebugLevel can be used to set debugging level for samba
 	// components in deployed containers.
 	SambaDebugLevel string `mapstructure:"samba-debug-level"`
+	// ConnectionsCheckInterval is how often the clients connected to
+	// shares are counted. A zero interval turns off the count.
+	ConnectionsCheckInterval time.Duration `mapstructure:"connections-check-interval"`
+	// HealthCheckInterval is how often the Services of shares with a
+	// health check are probed. A zero interval turns off the probes.
+	HealthCheckInterval time.Duration `mapstructure:"health-check-interval"`
+	// ResyncInterval is how often SmbShares are reconciled even if
+	// nothing changed, correcting the changes made to their resources
+	// behind the operator's back. A zero interval turns off the resyncs.
+	ResyncInterval time.Duration `mapstructure:"resync-interval"`
+	// StorageBindTimeout is how long the PVC of a share may wait to be
+	// bound before the share is reported as degraded.
+	StorageBindTimeout time.Duration `mapstructure:"storage-bind-timeout"`
+	// StartupTimeout is how long the pods of a share may take to become
+	// ready before the share is reported as degraded. Common configs may
+	// set their own timeout.
+	StartupTimeout time.Duration `mapstructure:"startup-timeout"`
+	// SupportedArchitectures is a comma separated list of the CPU
+	// architectures the samba server image is built for. Share pods are
+	// only scheduled on nodes of these architectures, unless the shares
+	// name others. An empty list places no constraint on the nodes.
+	SupportedArchitectures string `mapstructure:"supported-architectures"`
+	// Paused stops the operator from changing the SmbShares and their
+	// resources, for example during a cluster upgrade. The SmbShares are
+	// still watched, and report the pause in their Paused condition.
+	Paused bool `mapstructure:"paused"`
+	// SmbdResourceRequests is a comma separated list of name=quantity
+	// pairs, like "cpu=100m,memory=128Mi", giving the default compute
+	// resource requests of the smbd containers.
+	SmbdResourceRequests string `mapstructure:"smbd-resource-requests"`
+	// SmbdResourceLimits is a comma separated list of name=quantity pairs
+	// giving the default compute resource limits of the smbd containers.
+	SmbdResourceLimits string `mapstructure:"smbd-resource-limits"`
+	// SmbdResourceMax is a comma separated list of name=quantity pairs
+	// capping the compute resource requests and limits of the smbd
+	// containers, whichever config sets them.
+	SmbdResourceMax string `mapstructure:"smbd-resource-max"`
+	// SelfTestEnabled lets SmbShares request self tests, run as Jobs
+	// logging in to the shares. It is meant for CI and smoke test
+	// clusters, and is off by default.
+	SelfTestEnabled bool `mapstructure:"self-test-enabled"`
 }
 
 // Validate the OperatorConfig returning an error if the config is not
@@ -38,9 +92,92 @@ func (oc *OperatorConfig) Validate() error {
 		return fmt.Errorf(
 			"WorkingNamespace value [%s] invalid", oc.WorkingNamespace)
 	}
+	if oc.ConnectionsCheckInterval < 0 {
+		return fmt.Errorf(
+			"ConnectionsCheckInterval value [%s] invalid",
+			oc.ConnectionsCheckInterval)
+	}
+	if oc.HealthCheckInterval < 0 {
+		return fmt.Errorf(
+			"HealthCheckInterval value [%s] invalid",
+			oc.HealthCheckInterval)
+	}
+	if oc.ResyncInterval < 0 {
+		return fmt.Errorf(
+			"ResyncInterval value [%s] invalid", oc.ResyncInterval)
+	}
+	if oc.StorageBindTimeout < 0 {
+		return fmt.Errorf(
+			"StorageBindTimeout value [%s] invalid", oc.StorageBindTimeout)
+	}
+	if oc.StartupTimeout < 0 {
+		return fmt.Errorf(
+			"StartupTimeout value [%s] invalid", oc.StartupTimeout)
+	}
+	resourceLists := []struct{ name, value string }{
+		{"SmbdResourceRequests", oc.SmbdResourceRequests},
+		{"SmbdResourceLimits", oc.SmbdResourceLimits},
+		{"SmbdResourceMax", oc.SmbdResourceMax},
+	}
+	for _, l := range resourceLists {
+		if _, err := parseResourceList(l.value); err != nil {
+			return fmt.Errorf("%s value [%s] invalid: %w", l.name, l.value, err)
+		}
+	}
 	return nil
 }
 
+// SmbdResources returns the default compute resource requirements of the
+// smbd containers. Invalid values, rejected by Validate, are ignored.
+func (oc *OperatorConfig) SmbdResources() corev1.ResourceRequirements {
+	requests, _ := parseResourceList(oc.SmbdResourceRequests)
+	limits, _ := parseResourceList(oc.SmbdResourceLimits)
+	return corev1.ResourceRequirements{Requests: requests, Limits: limits}
+}
+
+// SmbdResourceMaximums returns the highest compute resource requests and
+// limits of the smbd containers, or nil if they are not capped.
+func (oc *OperatorConfig) SmbdResourceMaximums() corev1.ResourceList {
+	max, _ := parseResourceList(oc.SmbdResourceMax)
+	return max
+}
+
+// parseResourceList parses a comma separated list of name=quantity pairs.
+// An empty list returns nil.
+func parseResourceList(value string) (corev1.ResourceList, error) {
+	var rl corev1.ResourceList
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("expected name=quantity, got %q", item)
+		}
+		q, err := resource.ParseQuantity(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("resource %s: %w", name, err)
+		}
+		if rl == nil {
+			rl = corev1.ResourceList{}
+		}
+		rl[corev1.ResourceName(name)] = q
+	}
+	return rl, nil
+}
+
+// Architectures returns the names of the SupportedArchitectures.
+func (oc *OperatorConfig) Architectures() []string {
+	archs := []string{}
+	for _, a := range strings.Split(oc.SupportedArchitectures, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			archs = append(archs, a)
+		}
+	}
+	return archs
+}
+
 // Source is how external configuration sources populate the operator config.
 type Source struct {
 	v    *viper.Viper
@@ -58,7 +195,25 @@ func NewSource() *Source {
 	v.SetDefault(
 		"svc-watch-container-image",
 		"quay.io/samba.org/svcwatch:latest")
+	v.SetDefault("dns-register-container-image", "")
+	v.SetDefault(
+		"metrics-container-image",
+		"quay.io/samba.org/samba-metrics:latest")
+	v.SetDefault(
+		"clamav-container-image",
+		"docker.io/clamav/clamav:stable")
 	v.SetDefault("samba-debug-level", "")
+	v.SetDefault("connections-check-interval", "1m")
+	v.SetDefault("health-check-interval", "1m")
+	v.SetDefault("resync-interval", "0")
+	v.SetDefault("storage-bind-timeout", "5m")
+	v.SetDefault("startup-timeout", "10m")
+	v.SetDefault("supported-architectures", "amd64,arm64")
+	v.SetDefault("paused", "false")
+	v.SetDefault("smbd-resource-requests", "")
+	v.SetDefault("smbd-resource-limits", "")
+	v.SetDefault("smbd-resource-max", "")
+	v.SetDefault("self-test-enabled", "false")
 	return &Source{v: v}
 }
 
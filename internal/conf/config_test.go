@@ -0,0 +1,38 @@
+package conf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSmbdResources(t *testing.T) {
+	oc := &OperatorConfig{WorkingNamespace: "default"}
+	assert.NoError(t, oc.Validate())
+	assert.Equal(t, corev1.ResourceRequirements{}, oc.SmbdResources())
+	assert.Nil(t, oc.SmbdResourceMaximums())
+
+	oc.SmbdResourceRequests = "cpu=100m, memory=128Mi,"
+	oc.SmbdResourceLimits = "memory=1Gi"
+	oc.SmbdResourceMax = "cpu=4"
+	assert.NoError(t, oc.Validate())
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+	}, oc.SmbdResources())
+	assert.Equal(t, corev1.ResourceList{
+		corev1.ResourceCPU: resource.MustParse("4"),
+	}, oc.SmbdResourceMaximums())
+
+	for _, invalid := range []string{"cpu", "=1", "memory=lots"} {
+		oc.SmbdResourceLimits = invalid
+		assert.Error(t, oc.Validate(), invalid)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health serves the liveness and readiness endpoints of the
+// operator. The endpoints are served apart from the manager so that they
+// are available while a replica waits to become the leader.
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+const (
+	// LivenessPath is the path of the liveness endpoint.
+	LivenessPath = "/healthz"
+	// ReadinessPath is the path of the readiness endpoint.
+	ReadinessPath = "/readyz"
+
+	shutdownTimeout = 5 * time.Second
+)
+
+// ErrCacheNotSynced is returned by the cache sync check until the caches
+// of the manager have synced.
+var ErrCacheNotSynced = errors.New("caches not synced")
+
+// Probes holds the checks of the liveness and readiness endpoints.
+type Probes struct {
+	healthz healthz.Handler
+	readyz  healthz.Handler
+}
+
+// NewProbes returns Probes with a ping check for liveness and no
+// readiness checks.
+func NewProbes() *Probes {
+	p := &Probes{
+		healthz: healthz.Handler{Checks: map[string]healthz.Checker{}},
+		readyz:  healthz.Handler{Checks: map[string]healthz.Checker{}},
+	}
+	p.AddHealthzCheck("ping", healthz.Ping)
+	return p
+}
+
+// AddHealthzCheck adds a named check to the liveness endpoint.
+func (p *Probes) AddHealthzCheck(name string, check healthz.Checker) {
+	p.healthz.Checks[name] = check
+}
+
+// AddReadyzCheck adds a named check to the readiness endpoint.
+func (p *Probes) AddReadyzCheck(name string, check healthz.Checker) {
+	p.readyz.Checks[name] = check
+}
+
+// Handler returns an http.Handler serving the liveness and readiness
+// endpoints. Individual checks are served below the endpoint paths, for
+// example /readyz/cache.
+func (p *Probes) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(LivenessPath, http.StripPrefix(LivenessPath, &p.healthz))
+	mux.Handle(LivenessPath+"/",
+		http.StripPrefix(LivenessPath, &p.healthz))
+	mux.Handle(ReadinessPath, http.StripPrefix(ReadinessPath, &p.readyz))
+	mux.Handle(ReadinessPath+"/",
+		http.StripPrefix(ReadinessPath, &p.readyz))
+	return mux
+}
+
+// Serve serves the endpoints on addr until stop is closed.
+func (p *Probes) Serve(stop <-chan struct{}, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: p.Handler()}
+	go func() {
+		<-stop
+		ctx, cancel := context.WithTimeout(
+			context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+	if err := server.Serve(l); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// CacheSync records whether the caches of a manager have synced. It is
+// meant to be added to the manager as a Runnable.
+type CacheSync struct {
+	cache  cache.Cache
+	synced int32
+}
+
+// NewCacheSync returns a CacheSync for the given cache.
+func NewCacheSync(c cache.Cache) *CacheSync {
+	return &CacheSync{cache: c}
+}
+
+// Start waits for the caches to sync. It implements manager.Runnable.
+func (c *CacheSync) Start(stop <-chan struct{}) error {
+	if c.cache.WaitForCacheSync(stop) {
+		atomic.StoreInt32(&c.synced, 1)
+	}
+	return nil
+}
+
+// Check fails until the caches have synced. It is a healthz.Checker.
+func (c *CacheSync) Check(_ *http.Request) error {
+	if atomic.LoadInt32(&c.synced) == 0 {
+		return ErrCacheNotSynced
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+)
+
+func get(t *testing.T, url string) int {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestProbesEndpoints(t *testing.T) {
+	synced := false
+	cs := NewCacheSync(&informertest.FakeInformers{Synced: &synced})
+	p := NewProbes()
+	p.AddReadyzCheck("cache", cs.Check)
+	srv := httptest.NewServer(p.Handler())
+	defer srv.Close()
+
+	assert.Equal(t, http.StatusOK, get(t, srv.URL+"/healthz"))
+	assert.Equal(t, http.StatusOK, get(t, srv.URL+"/healthz/ping"))
+	assert.Equal(t,
+		http.StatusInternalServerError, get(t, srv.URL+"/readyz"))
+	assert.Equal(t,
+		http.StatusInternalServerError, get(t, srv.URL+"/readyz/cache"))
+
+	// the cache never syncs if stopped first
+	stop := make(chan struct{})
+	close(stop)
+	assert.NoError(t, cs.Start(stop))
+	assert.Equal(t,
+		http.StatusInternalServerError, get(t, srv.URL+"/readyz"))
+
+	synced = true
+	assert.NoError(t, cs.Start(make(chan struct{})))
+	assert.Equal(t, http.StatusOK, get(t, srv.URL+"/readyz"))
+	assert.Equal(t, http.StatusOK, get(t, srv.URL+"/readyz/cache"))
+	assert.Equal(t, http.StatusNotFound, get(t, srv.URL+"/readyz/nope"))
+}
+
+func TestProbesServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	p := NewProbes()
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- p.Serve(stop, addr)
+	}()
+
+	var code int
+	for i := 0; i < 50; i++ {
+		resp, err := http.Get("http://" + addr + "/readyz")
+		if err == nil {
+			code = resp.StatusCode
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Equal(t, http.StatusOK, code)
+
+	close(stop)
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+}
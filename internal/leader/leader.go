@@ -0,0 +1,142 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package leader runs a function only while the process holds a Lease
+// based leader election lock, so that only one of several operator
+// replicas is active at a time.
+package leader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// ErrLeadershipLost is returned by Run if the lock was lost before the
+// process was asked to stop.
+var ErrLeadershipLost = errors.New("leader election lost")
+
+// Config selects the Lease used for leader election and the timing of
+// the election.
+type Config struct {
+	// Namespace of the Lease.
+	Namespace string
+	// Name of the Lease.
+	Name string
+	// Identity of this candidate. If empty, a unique identity is
+	// derived from the host name.
+	Identity string
+	// LeaseDuration is how long candidates wait before they may take over
+	// a lock that is no longer renewed.
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader retries renewing the lock
+	// before giving up leadership.
+	RenewDeadline time.Duration
+	// RetryPeriod is how long candidates wait between attempts to acquire
+	// or renew the lock.
+	RetryPeriod time.Duration
+}
+
+// Run blocks until the lock described by cfg is acquired and then calls
+// run. The stop channel given to run is closed if stop is closed or the
+// lock is lost. Run returns the result of run, or ErrLeadershipLost if
+// the lock was lost while run was active.
+func Run(
+	stop <-chan struct{},
+	client kubernetes.Interface,
+	cfg Config,
+	log logr.Logger,
+	run func(stop <-chan struct{}) error) error {
+	// ---
+	id := cfg.Identity
+	if id == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		id = host + "_" + string(uuid.NewUUID())
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: cfg.Namespace,
+			Name:      cfg.Name,
+		},
+		Client:     client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: id},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	started := make(chan struct{})
+	result := make(chan error, 1)
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   cfg.LeaseDuration,
+		RenewDeadline:   cfg.RenewDeadline,
+		RetryPeriod:     cfg.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            cfg.Name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				log.Info("Acquired leader lock", "identity", id)
+				close(started)
+				result <- run(leaderCtx.Done())
+				// release the lock once run is done
+				cancel()
+			},
+			OnStoppedLeading: func() {
+				log.Info("Stopped leading", "identity", id)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("Waiting for leader lock",
+		"Lease.Namespace", cfg.Namespace,
+		"Lease.Name", cfg.Name)
+	le.Run(ctx)
+	// the election only ends without being cancelled if the lock could
+	// not be renewed.
+	lost := ctx.Err() == nil
+
+	select {
+	case <-started:
+	default:
+		// stopped before the lock was acquired
+		return nil
+	}
+	err = <-result
+	if err == nil && lost {
+		err = ErrLeadershipLost
+	}
+	return err
+}
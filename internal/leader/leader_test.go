@@ -0,0 +1,108 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func testConfig(id string) Config {
+	return Config{
+		Namespace:     "samba-operator-system",
+		Name:          "test-lock",
+		Identity:      id,
+		LeaseDuration: 2 * time.Second,
+		RenewDeadline: time.Second,
+		RetryPeriod:   100 * time.Millisecond,
+	}
+}
+
+func TestRunHoldsLease(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	stop := make(chan struct{})
+	errRun := errors.New("done")
+	err := Run(stop, client, testConfig("one"), ctrllog.NullLogger{},
+		func(<-chan struct{}) error {
+			lease, err := client.CoordinationV1().Leases(
+				"samba-operator-system").Get(
+				context.TODO(), "test-lock", metav1.GetOptions{})
+			if assert.NoError(t, err) {
+				assert.Equal(t, "one", *lease.Spec.HolderIdentity)
+			}
+			return errRun
+		})
+	assert.Equal(t, errRun, err)
+}
+
+func TestRunStopped(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	stop := make(chan struct{})
+	running := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- Run(stop, client, testConfig("one"), ctrllog.NullLogger{},
+			func(s <-chan struct{}) error {
+				close(running)
+				<-s
+				return nil
+			})
+	}()
+	<-running
+	close(stop)
+	assert.NoError(t, <-done)
+}
+
+func TestRunWaitsForLeader(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	stopOne := make(chan struct{})
+	running := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- Run(stopOne, client, testConfig("one"), ctrllog.NullLogger{},
+			func(s <-chan struct{}) error {
+				close(running)
+				<-s
+				return nil
+			})
+	}()
+	<-running
+
+	// a second candidate does not run while the first holds the lease
+	stopTwo := make(chan struct{})
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		close(stopTwo)
+	}()
+	ran := false
+	err := Run(stopTwo, client, testConfig("two"), ctrllog.NullLogger{},
+		func(<-chan struct{}) error {
+			ran = true
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.False(t, ran)
+
+	close(stopOne)
+	assert.NoError(t, <-done)
+}
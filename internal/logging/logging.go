@@ -0,0 +1,48 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logging builds the logger of the operator in the format its log
+// lines are to be written in.
+package logging
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+const (
+	// FormatConsole writes human readable log lines, including debug
+	// messages.
+	FormatConsole = "console"
+	// FormatJSON writes a JSON object per log line, for log pipelines to
+	// parse.
+	FormatJSON = "json"
+)
+
+// New returns a logger writing log lines of the given format to out.
+func New(format string, out io.Writer) (logr.Logger, error) {
+	switch format {
+	case FormatConsole:
+		return zap.New(zap.UseDevMode(true), zap.WriteTo(out)), nil
+	case FormatJSON:
+		return zap.New(zap.UseDevMode(false), zap.WriteTo(out)), nil
+	}
+	return nil, fmt.Errorf(
+		"invalid log format %q: must be %s or %s",
+		format, FormatJSON, FormatConsole)
+}
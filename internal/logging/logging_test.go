@@ -0,0 +1,62 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestNewJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := New(FormatJSON, out)
+	require.NoError(t, err)
+	logger.WithName("controllers").WithValues(
+		"smbshare", types.NamespacedName{Namespace: "default", Name: "myshare"},
+		"reconcileID", "abc123").Info("Reconciling SmbShare", "attempt", 2)
+
+	line := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &line), out.String())
+	assert.Equal(t, "info", line["level"])
+	assert.Equal(t, "controllers", line["logger"])
+	assert.Equal(t, "Reconciling SmbShare", line["msg"])
+	assert.Contains(t, line, "ts")
+	assert.Equal(t, "abc123", line["reconcileID"])
+	assert.Equal(t, "default/myshare", line["smbshare"])
+	assert.Equal(t, float64(2), line["attempt"])
+}
+
+func TestNewConsole(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := New(FormatConsole, out)
+	require.NoError(t, err)
+	logger.Info("Reconciling SmbShare", "reconcileID", "abc123")
+	assert.Contains(t, out.String(), "Reconciling SmbShare")
+	assert.Contains(t, out.String(), `"reconcileID": "abc123"`)
+	assert.False(t, strings.HasPrefix(out.String(), "{"))
+}
+
+func TestNewInvalidFormat(t *testing.T) {
+	_, err := New("xml", &bytes.Buffer{})
+	assert.EqualError(t, err,
+		`invalid log format "xml": must be json or console`)
+}
@@ -0,0 +1,137 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	sambaoperatorv1beta1 "github.com/samba-in-kubernetes/samba-operator/api/v1beta1"
+)
+
+// ShareValidatorPath is the path the SmbShare validating webhook is served
+// on.
+const ShareValidatorPath = "/validate-samba-operator-samba-org-smbshare"
+
+//revive:disable kubebuilder directives
+
+// +kubebuilder:webhook:path=/validate-samba-operator-samba-org-smbshare,mutating=false,failurePolicy=ignore,groups=samba-operator.samba.org,resources=smbshares,verbs=create;update,versions=v1alpha1;v1beta1,name=vsmbshare.samba-operator.samba.org
+
+//revive:enable
+
+// ShareValidator is an admission handler rejecting SmbShares that use the
+// share name of another SmbShare of the same server group, as samba would
+// only serve one of them, and SmbShares whose names, or server group, would
+// derive resource names Kubernetes rejects.
+type ShareValidator struct {
+	client rtclient.Reader
+}
+
+// NewShareValidator returns a ShareValidator looking up the other SmbShares
+// with the given client.
+func NewShareValidator(client rtclient.Reader) *ShareValidator {
+	return &ShareValidator{client: client}
+}
+
+// Handle implements admission.Handler.
+func (v *ShareValidator) Handle(
+	ctx context.Context, req admission.Request) admission.Response {
+	// ---
+	s, err := decodeShare(req)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if s.Namespace == "" {
+		s.Namespace = req.Namespace
+	}
+	// the names of existing shares can not change, and rejecting their
+	// updates would keep their finalizer from being removed
+	if req.Operation == admissionv1beta1.Create {
+		if msg := shareNameError(s); msg != "" {
+			return admission.Denied(msg)
+		}
+	}
+	l := &sambaoperatorv1alpha1.SmbShareList{}
+	if err := v.client.List(ctx, l, rtclient.InNamespace(s.Namespace)); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if other := shareNameConflict(s, l.Items); other != nil {
+		return admission.Denied(fmt.Sprintf(
+			"share name %q is already used by SmbShare %s of server group %s",
+			shareNameOf(s), other.Name, shareServerGroup(other)))
+	}
+	return admission.Allowed("")
+}
+
+// decodeShare returns the SmbShare of an admission request, converted to
+// the hub version.
+func decodeShare(req admission.Request) (*sambaoperatorv1alpha1.SmbShare, error) {
+	s := &sambaoperatorv1alpha1.SmbShare{}
+	if req.Kind.Version != sambaoperatorv1beta1.GroupVersion.Version {
+		return s, json.Unmarshal(req.Object.Raw, s)
+	}
+	src := &sambaoperatorv1beta1.SmbShare{}
+	if err := json.Unmarshal(req.Object.Raw, src); err != nil {
+		return nil, err
+	}
+	return s, src.ConvertTo(s)
+}
+
+// shareServerGroup returns the server group of the share: the one it was
+// assigned, or the one it asks for if it has not been assigned one yet.
+func shareServerGroup(s *sambaoperatorv1alpha1.SmbShare) string {
+	if s.Status.ServerGroup != "" {
+		return s.Status.ServerGroup
+	}
+	return desiredServerGroup(s)
+}
+
+// sameShareName returns true if two SmbShares have the same share name.
+// Share names are compared without regard to case, as they are by samba.
+func sameShareName(a, b *sambaoperatorv1alpha1.SmbShare) bool {
+	return strings.EqualFold(shareNameOf(a), shareNameOf(b))
+}
+
+// shareNameConflict returns the first of others, in the namespace and
+// server group of s, that has the share name of s. SmbShares being deleted
+// are ignored. Nil is returned if the share name is free.
+func shareNameConflict(
+	s *sambaoperatorv1alpha1.SmbShare,
+	others []sambaoperatorv1alpha1.SmbShare) *sambaoperatorv1alpha1.SmbShare {
+	// ---
+	group := desiredServerGroup(s)
+	for i := range others {
+		other := &others[i]
+		if other.Name == s.Name || other.Namespace != s.Namespace ||
+			other.GetDeletionTimestamp() != nil ||
+			shareServerGroup(other) != group {
+			// ---
+			continue
+		}
+		if sameShareName(other, s) {
+			return other
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	sambaoperatorv1beta1 "github.com/samba-in-kubernetes/samba-operator/api/v1beta1"
+)
+
+func TestShareNameConflict(t *testing.T) {
+	one := groupShare("one", "grp")
+	two := groupShare("two", "grp")
+	two.Spec.ShareName = "ONE"
+	// the share of another group does not conflict
+	other := groupShare("other", "other")
+	other.Spec.ShareName = "one"
+	// nor does a share being deleted
+	gone := groupShare("gone", "grp")
+	gone.Spec.ShareName = "one"
+	now := metav1.NewTime(time.Now())
+	gone.DeletionTimestamp = &now
+	others := []sambaoperatorv1alpha1.SmbShare{*one, *gone, *other}
+
+	assert.Nil(t, shareNameConflict(one, others))
+	if conflict := shareNameConflict(two, others); assert.NotNil(t, conflict) {
+		assert.Equal(t, "one", conflict.Name)
+	}
+
+	// a new share is not assigned a server group yet
+	three := groupShare("three", "grp")
+	three.Status.ServerGroup = ""
+	three.Spec.ShareName = "One"
+	assert.NotNil(t, shareNameConflict(three, others))
+	three.Spec.ServerGroup = ""
+	assert.Nil(t, shareNameConflict(three, others))
+}
+
+// admissionRequest returns a request to create the share in the given API
+// version.
+func admissionRequest(
+	t *testing.T, version string, obj runtime.Object) admission.Request {
+	// ---
+	raw, err := json.Marshal(obj)
+	require.NoError(t, err)
+	req := admission.Request{}
+	req.AdmissionRequest = admissionv1beta1.AdmissionRequest{
+		Kind: metav1.GroupVersionKind{
+			Group:   sambaoperatorv1alpha1.GroupVersion.Group,
+			Version: version,
+			Kind:    "SmbShare",
+		},
+		Namespace: "default",
+		Operation: admissionv1beta1.Create,
+	}
+	req.Object.Raw = raw
+	return req
+}
+
+func TestShareValidator(t *testing.T) {
+	one := groupShare("one", "grp")
+	m, _ := newTestManager(one)
+	v := NewShareValidator(m.client)
+
+	two := groupShare("two", "grp")
+	two.Status = sambaoperatorv1alpha1.SmbShareStatus{}
+	res := v.Handle(context.TODO(), admissionRequest(t, "v1alpha1", two))
+	assert.True(t, res.Allowed)
+
+	two.Spec.ShareName = "one"
+	res = v.Handle(context.TODO(), admissionRequest(t, "v1alpha1", two))
+	assert.False(t, res.Allowed)
+	assert.Equal(t,
+		`share name "one" is already used by SmbShare one of server group grp`,
+		string(res.Result.Reason))
+
+	share := &sambaoperatorv1beta1.SmbShare{}
+	share.Name = "three"
+	share.Spec.ServerGroup = "grp"
+	share.Spec.ShareName = "One"
+	res = v.Handle(context.TODO(), admissionRequest(t, "v1beta1", share))
+	assert.False(t, res.Allowed)
+
+	// a server group too long to name a Service is rejected on creation
+	long := groupShare("long", strings.Repeat("g", 64))
+	long.Status = sambaoperatorv1alpha1.SmbShareStatus{}
+	req := admissionRequest(t, "v1alpha1", long)
+	res = v.Handle(context.TODO(), req)
+	assert.False(t, res.Allowed)
+	assert.Contains(t, string(res.Result.Reason), "The Service name")
+	req.Operation = admissionv1beta1.Update
+	res = v.Handle(context.TODO(), req)
+	assert.True(t, res.Allowed)
+}
+
+func TestWarnShareNameInUse(t *testing.T) {
+	one := groupShare("one", "grp")
+	two := groupShare("two", "grp")
+	other := groupShare("other", "other")
+	other.Spec.ShareName = "one"
+	planner := testPlanner(one, nil)
+	m, recorder := newTestManager(one, two, other)
+
+	assert.NoError(t, m.warnShareNameInUse(context.TODO(), planner))
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonShareNameInUse)
+		assert.Contains(t, event, "SmbShare other of server group other")
+	}
+
+	planner = testPlanner(two, nil)
+	assert.NoError(t, m.warnShareNameInUse(context.TODO(), planner))
+	assert.Len(t, recorder.Events, 0)
+}
@@ -0,0 +1,440 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+const (
+	// antivirusSidecar runs clamd in a sidecar of the pods.
+	antivirusSidecar = "sidecar"
+	// antivirusExternal uses the clamd of an extra container of the common
+	// config.
+	antivirusExternal = "external"
+
+	// antivirusVolName is the name of the volume holding the clamd socket
+	// and the logs of the infected files found.
+	antivirusVolName = "antivirus"
+	// antivirusDir is the directory the antivirus volume is mounted at in
+	// the samba containers.
+	antivirusDir = "/run/antivirus"
+	// clamavContainerName is the name of the ClamAV sidecar.
+	clamavContainerName = "clamav"
+	// clamavSocketDir is the directory the antivirus volume is mounted at
+	// in the ClamAV sidecar, where the image's clamd creates its socket.
+	clamavSocketDir = "/run/clamav"
+
+	defaultClamdSocket         = "clamd.sock"
+	defaultQuarantineDirectory = ".quarantine"
+	defaultInfectedFileAction  = "quarantine"
+
+	// maxInfectedFilesEvent is the number of the most recently found
+	// infected files that an event lists.
+	maxInfectedFilesEvent = 5
+)
+
+// shareInfectedFiles reports the number of infected files found on the
+// shares by the virus scanners of their pods.
+var shareInfectedFiles = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "samba_share_infected_files",
+		Help: "The number of infected files found on the SmbShare by " +
+			"the virus scanners of the pods serving it since they started.",
+	},
+	[]string{"namespace", "name"})
+
+func init() {
+	metrics.Registry.MustRegister(shareInfectedFiles)
+}
+
+// antivirus returns the virus scanning settings of the share, or nil if
+// the share is not scanned for viruses.
+func (sp *sharePlanner) antivirus() *sambaoperatorv1alpha1.SmbShareAntivirusSpec {
+	return sp.SmbShare.Spec.Antivirus
+}
+
+// antivirusScanner returns the scanner of the share: sidecar or external.
+func antivirusScanner(av *sambaoperatorv1alpha1.SmbShareAntivirusSpec) string {
+	if av.Scanner == antivirusExternal {
+		return antivirusExternal
+	}
+	return antivirusSidecar
+}
+
+// groupAntivirus returns true if any share of the server group is scanned
+// for viruses, and runs the ClamAV sidecar if any of them scans with it.
+func (sp *sharePlanner) groupAntivirus() (scanned, sidecar bool) {
+	shares := sp.groupShares()
+	for i := range shares {
+		if av := shares[i].Spec.Antivirus; av != nil {
+			scanned = true
+			if antivirusScanner(av) == antivirusSidecar {
+				sidecar = true
+			}
+		}
+	}
+	return scanned, sidecar
+}
+
+// antivirusSocketPath returns the path of the clamd socket in the samba
+// containers.
+func (sp *sharePlanner) antivirusSocketPath() string {
+	socket := sp.antivirus().Socket
+	if socket == "" {
+		socket = defaultClamdSocket
+	}
+	return path.Join(antivirusDir, socket)
+}
+
+// quarantineDirectory returns the name of the directory, at the root of
+// the share, infected files are moved to.
+func (sp *sharePlanner) quarantineDirectory() string {
+	if d := sp.antivirus().QuarantineDirectory; d != "" {
+		return d
+	}
+	return defaultQuarantineDirectory
+}
+
+// infectedFileAction returns what is done with the infected files found.
+func (sp *sharePlanner) infectedFileAction() string {
+	if a := sp.antivirus().InfectedFileAction; a != "" {
+		return a
+	}
+	return defaultInfectedFileAction
+}
+
+// infectedFilesLogPath returns the path of the file, in the samba
+// containers, the infected files found on the share are logged to, one per
+// line. Each share of the server group has its own log.
+func (sp *sharePlanner) infectedFilesLogPath() string {
+	return path.Join(antivirusDir, sp.SmbShare.Name+".infected")
+}
+
+// infectedFileCommand returns the command virusfilter runs, with a shell,
+// for each infected file found. It logs the file and the virus found in it
+// for the operator to read.
+func (sp *sharePlanner) infectedFileCommand() string {
+	return fmt.Sprintf(
+		`echo "$VIRUSFILTER_INFECTED_SERVICE_FILE_PATH: $VIRUSFILTER_INFECTED_FILE_REPORT" >> %s`,
+		sp.infectedFilesLogPath())
+}
+
+// antivirusOptions returns the options of the virusfilter VFS module of
+// the share, or nil if the share is not scanned for viruses.
+func (sp *sharePlanner) antivirusOptions() smbcc.SmbOptions {
+	av := sp.antivirus()
+	if av == nil {
+		return nil
+	}
+	opts := smbcc.SmbOptions{
+		smbcc.VirusFilterScannerParam:             "clamav",
+		smbcc.VirusFilterSocketPathParam:          sp.antivirusSocketPath(),
+		smbcc.VirusFilterScanOnOpenParam:          smbcc.Yes,
+		smbcc.VirusFilterScanOnCloseParam:         smbcc.No,
+		smbcc.VirusFilterInfectedFileActionParam:  sp.infectedFileAction(),
+		smbcc.VirusFilterInfectedFileCommandParam: sp.infectedFileCommand(),
+	}
+	setBool(opts, smbcc.VirusFilterScanOnOpenParam, av.ScanOnOpen)
+	if av.ScanOnClose {
+		opts[smbcc.VirusFilterScanOnCloseParam] = smbcc.Yes
+	}
+	if sp.infectedFileAction() == defaultInfectedFileAction {
+		opts[smbcc.VirusFilterQuarantineDirectoryParam] = path.Join(
+			sp.sharePath(), sp.quarantineDirectory())
+	}
+	if av.BlockOnError {
+		opts[smbcc.VirusFilterBlockAccessOnErrorParam] = smbcc.Yes
+	}
+	return opts
+}
+
+// clamavImage returns the image used for the ClamAV sidecar.
+func (sp *sharePlanner) clamavImage() string {
+	return imageName(
+		sp.imageOverrides().ClamAV,
+		sp.GlobalConfig.ClamAVContainerImage)
+}
+
+// addAntivirusContainers mounts the antivirus volume in the containers
+// running samba, if a share of the server group is scanned for viruses,
+// and adds the ClamAV sidecar if one of them scans with it. clamd is given
+// the paths of the files to scan, so the sidecar mounts the shares at the
+// paths the samba containers do, read-only.
+func addAntivirusContainers(
+	planner *sharePlanner, podSpec *corev1.PodSpec, pvcName string) {
+	// ---
+	scanned, sidecar := planner.groupAntivirus()
+	if !scanned {
+		return
+	}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: antivirusVolName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+	for i := range podSpec.Containers {
+		c := &podSpec.Containers[i]
+		if planner.runsSamba(c) {
+			c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+				Name:      antivirusVolName,
+				MountPath: antivirusDir,
+			})
+		}
+	}
+	if !sidecar {
+		return
+	}
+	mounts := []corev1.VolumeMount{{
+		Name:      antivirusVolName,
+		MountPath: clamavSocketDir,
+	}}
+	shareVols, shareMounts := shareVolumesAndMounts(planner, pvcName)
+	pvcs := map[string]bool{}
+	for _, v := range shareVols {
+		pvcs[v.Name] = v.PersistentVolumeClaim != nil
+	}
+	for _, m := range shareMounts {
+		if pvcs[m.Name] {
+			m.ReadOnly = true
+			mounts = append(mounts, m)
+		}
+	}
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{
+		Image:        planner.clamavImage(),
+		Name:         clamavContainerName,
+		VolumeMounts: mounts,
+	})
+}
+
+// validateAntivirus checks that a share scanned for viruses has PVC
+// storage, that clamd can see, a valid socket and quarantine directory, and
+// that the VFS modules listed by the share load virusfilter if they
+// override those of the operator. An external scanner must be run by an
+// extra container of the common config mounting the antivirus volume. If
+// not, the Degraded condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateAntivirus(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	av := planner.antivirus()
+	if av == nil {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidAntivirus, msg)
+	}
+	if planner.SmbShare.Spec.Storage.Pvc == nil {
+		return degraded("Antivirus scanning requires PVC storage")
+	}
+	if s := av.Socket; s == "." || s == ".." || strings.Contains(s, "/") {
+		return degraded(fmt.Sprintf("Invalid antivirus socket name: %q", s))
+	}
+	d := planner.quarantineDirectory()
+	if d == "." || d == ".." || len(invalidPatterns([]string{d})) > 0 {
+		return degraded(fmt.Sprintf("Invalid quarantine directory: %q", d))
+	}
+	if planner.vfsObjectsMode() == vfsObjectsOverride {
+		found := false
+		for _, n := range planner.SmbShare.Spec.VfsObjects {
+			found = found || n == "virusfilter"
+		}
+		if !found {
+			return degraded(
+				"vfsObjects must list the VFS module virusfilter of antivirus scanning")
+		}
+	}
+	if antivirusScanner(av) != antivirusExternal {
+		return true, nil
+	}
+	for _, c := range planner.extraContainerSpecs() {
+		for _, vm := range c.VolumeMounts {
+			if vm.Name == antivirusVolName {
+				return true, nil
+			}
+		}
+	}
+	return degraded(fmt.Sprintf(
+		"The external antivirus scanner requires an extra container "+
+			"of the common config mounting the %s volume", antivirusVolName))
+}
+
+// InfectedFileReader reads the infected files found by the virus scanners
+// of pods.
+type InfectedFileReader interface {
+	// InfectedFiles returns the lines of the log of infected files at the
+	// given path in the container of the pod, or nil if the log does not
+	// exist.
+	InfectedFiles(
+		ctx context.Context,
+		pod *corev1.Pod,
+		container, logPath string) ([]string, error)
+}
+
+// podInfectedFiles reads the logs of infected files by running cat in the
+// samba container of the pods.
+type podInfectedFiles struct {
+	client kubernetes.Interface
+	config *rest.Config
+}
+
+// NewPodInfectedFiles returns an InfectedFileReader reading the logs in the
+// pods, through the API server's pod exec subresource.
+func NewPodInfectedFiles(
+	client kubernetes.Interface, config *rest.Config) InfectedFileReader {
+	// ---
+	return &podInfectedFiles{client: client, config: config}
+}
+
+// InfectedFiles implements InfectedFileReader.
+func (r *podInfectedFiles) InfectedFiles(
+	ctx context.Context,
+	pod *corev1.Pod,
+	container, logPath string) ([]string, error) {
+	// ---
+	// the log is only created when the first infected file is found
+	out, err := podExec(r.client, r.config, pod, container,
+		"sh", "-c", `test ! -e "$0" || cat "$0"`, logPath)
+	if err != nil {
+		return nil, err
+	}
+	return infectedFilesFromLog(out), nil
+}
+
+// infectedFilesFromLog returns the non-empty lines of a log of infected
+// files.
+func infectedFilesFromLog(out string) []string {
+	var files []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files
+}
+
+// readInfectedFiles returns the infected files logged by the ready pods
+// serving the share. Pods that can not be queried are skipped; nil is
+// returned, with found false, if no pod could be queried.
+func (m *SmbShareManager) readInfectedFiles(
+	ctx context.Context, planner *sharePlanner, ns string) (
+	files []string, found bool, err error) {
+	// ---
+	pods := &corev1.PodList{}
+	err = m.client.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{
+			svcSelectorKey: labelValue(planner.instanceName()),
+		})
+	if err != nil {
+		m.logger.Error(err, "Failed to list pods", "namespace", ns)
+		return nil, false, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || !podReady(pod) {
+			continue
+		}
+		f, err := m.infections.InfectedFiles(
+			ctx, pod, m.cfg.SmbdContainerName, planner.infectedFilesLogPath())
+		if err != nil {
+			// the files are reported from the pods that could be read
+			m.logger.Error(err, "Failed to read infected files",
+				"Pod.Namespace", ns, "Pod.Name", pod.Name)
+			continue
+		}
+		found = true
+		files = append(files, f...)
+	}
+	return files, found, nil
+}
+
+// updateInfectedFilesStatus counts the infected files found on the share
+// by the virus scanners of the pods serving it, records the count in the
+// status of the SmbShare and in the samba_share_infected_files metric, and
+// records a warning event listing the most recent files when new ones are
+// found. The count is cleared once the share is no longer scanned. The
+// files are read as often as the connections are counted. Returns true if
+// the status was changed.
+func (m *SmbShareManager) updateInfectedFilesStatus(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	var count *int32
+	files := []string{}
+	if planner.antivirus() != nil {
+		if m.infections == nil || m.cfg.ConnectionsCheckInterval == 0 {
+			return false, nil
+		}
+		f, found, err := m.readInfectedFiles(ctx, planner, ns)
+		if err != nil {
+			return false, err
+		}
+		if found {
+			files = f
+			count = new(int32)
+			*count = int32(len(files))
+		}
+	}
+	gauge := shareInfectedFiles.WithLabelValues(s.Namespace, s.Name)
+	if count != nil {
+		gauge.Set(float64(*count))
+	} else {
+		gauge.Set(0)
+	}
+	prev := s.Status.InfectedFiles
+	if (prev == nil && count == nil) ||
+		(prev != nil && count != nil && *prev == *count) {
+		// ---
+		return false, nil
+	}
+	if count != nil && (prev == nil || *count > *prev) {
+		found := int(*count)
+		if prev != nil {
+			found -= int(*prev)
+		}
+		latest := files
+		if found < len(latest) {
+			latest = latest[len(latest)-found:]
+		}
+		if len(latest) > maxInfectedFilesEvent {
+			latest = latest[len(latest)-maxInfectedFilesEvent:]
+		}
+		if found > 0 {
+			m.recorder.Eventf(s,
+				EventWarning,
+				ReasonInfectedFiles,
+				"Found %d infected files on the share: %s",
+				found, strings.Join(latest, "; "))
+		}
+	}
+	s.Status.InfectedFiles = count
+	return true, m.client.Status().Update(ctx, s)
+}
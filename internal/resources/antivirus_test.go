@@ -0,0 +1,334 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// antivirusShare returns a share on a PVC scanned for viruses.
+func antivirusShare(
+	av *sambaoperatorv1alpha1.SmbShareAntivirusSpec) *sambaoperatorv1alpha1.SmbShare {
+	// ---
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.Antivirus = av
+	return share
+}
+
+func TestPlannerAntivirus(t *testing.T) {
+	share := antivirusShare(&sambaoperatorv1alpha1.SmbShareAntivirusSpec{})
+	planner := testPlanner(share, nil)
+	planner.ConfigState = smbcc.New()
+	_, err := planner.update()
+	assert.NoError(t, err)
+	cfg, err := planner.ConfigState.SmbConf("myshare")
+	assert.NoError(t, err)
+	for _, line := range []string{
+		"vfs objects = virusfilter",
+		"virusfilter:scanner = clamav",
+		"virusfilter:socket path = /run/antivirus/clamd.sock",
+		"virusfilter:scan on open = yes",
+		"virusfilter:scan on close = no",
+		"virusfilter:infected file action = quarantine",
+		"virusfilter:quarantine directory = /mnt/.quarantine",
+		"hide files = /.quarantine/",
+		`virusfilter:infected file command = echo "$VIRUSFILTER_INFECTED_SERVICE_FILE_PATH: $VIRUSFILTER_INFECTED_FILE_REPORT" >> /run/antivirus/myshare.infected`,
+	} {
+		assert.Contains(t, cfg, "\t"+line+"\n")
+	}
+	assert.NotContains(t, cfg, smbcc.VirusFilterBlockAccessOnErrorParam)
+
+	no := false
+	share.Spec.HideFiles = []string{"*.tmp"}
+	share.Spec.Antivirus = &sambaoperatorv1alpha1.SmbShareAntivirusSpec{
+		Socket:             "scanner.sock",
+		ScanOnOpen:         &no,
+		ScanOnClose:        true,
+		InfectedFileAction: "delete",
+		BlockOnError:       true,
+	}
+	opts := planner.shareOptions()
+	assert.Equal(t, "/run/antivirus/scanner.sock",
+		opts[smbcc.VirusFilterSocketPathParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.VirusFilterScanOnOpenParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.VirusFilterScanOnCloseParam])
+	assert.Equal(t, "delete", opts[smbcc.VirusFilterInfectedFileActionParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.VirusFilterBlockAccessOnErrorParam])
+	// deleted files are not quarantined
+	assert.NotContains(t, opts, smbcc.VirusFilterQuarantineDirectoryParam)
+	assert.Equal(t, "/*.tmp/", opts[smbcc.HideFilesParam])
+
+	share.Spec.Antivirus.InfectedFileAction = ""
+	share.Spec.Antivirus.QuarantineDirectory = "infected"
+	opts = planner.shareOptions()
+	assert.Equal(t, "/mnt/infected",
+		opts[smbcc.VirusFilterQuarantineDirectoryParam])
+	assert.Equal(t, "/*.tmp/infected/", opts[smbcc.HideFilesParam])
+	assert.Equal(t, []string{"*.tmp"}, share.Spec.HideFiles)
+
+	share.Spec.Antivirus = nil
+	opts = planner.shareOptions()
+	assert.NotContains(t, opts, smbcc.VirusFilterScannerParam)
+	assert.NotContains(t, opts, smbcc.VfsObjectsParam)
+}
+
+func TestBuildPodSpecAntivirus(t *testing.T) {
+	share := antivirusShare(&sambaoperatorv1alpha1.SmbShareAntivirusSpec{})
+	planner := testPlanner(share, nil)
+	planner.GlobalConfig = &conf.OperatorConfig{
+		SmbdContainerImage:   "samba-server",
+		ClamAVContainerImage: "clamav",
+	}
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	podSpec := buildPodSpec(planner, cfg, "mypvc")
+
+	found := false
+	for _, v := range podSpec.Volumes {
+		if v.Name == antivirusVolName {
+			found = true
+			assert.NotNil(t, v.EmptyDir)
+		}
+	}
+	assert.True(t, found)
+	var clamav, smbd *corev1.Container
+	for i := range podSpec.Containers {
+		switch podSpec.Containers[i].Name {
+		case clamavContainerName:
+			clamav = &podSpec.Containers[i]
+		case "samba":
+			smbd = &podSpec.Containers[i]
+		}
+	}
+	if assert.NotNil(t, smbd) {
+		assert.Contains(t, smbd.VolumeMounts, corev1.VolumeMount{
+			Name:      antivirusVolName,
+			MountPath: "/run/antivirus",
+		})
+	}
+	if assert.NotNil(t, clamav) {
+		assert.Equal(t, "clamav", clamav.Image)
+		// clamd sees the share at the path smbd does
+		assert.Equal(t, []corev1.VolumeMount{
+			{Name: antivirusVolName, MountPath: "/run/clamav"},
+			{Name: "mypvc-smb", MountPath: "/mnt", ReadOnly: true},
+		}, clamav.VolumeMounts)
+	}
+
+	// an external scanner only gets the volume
+	share.Spec.Antivirus.Scanner = "external"
+	podSpec = buildPodSpec(planner, cfg, "mypvc")
+	for _, c := range podSpec.Containers {
+		assert.NotEqual(t, clamavContainerName, c.Name)
+	}
+	found = false
+	for _, v := range podSpec.Volumes {
+		found = found || v.Name == antivirusVolName
+	}
+	assert.True(t, found)
+
+	share.Spec.Antivirus = nil
+	podSpec = buildPodSpec(planner, cfg, "mypvc")
+	for _, v := range podSpec.Volumes {
+		assert.NotEqual(t, antivirusVolName, v.Name)
+	}
+}
+
+func TestValidateAntivirus(t *testing.T) {
+	share := antivirusShare(&sambaoperatorv1alpha1.SmbShareAntivirusSpec{})
+	m, recorder := newTestManager(share)
+	valid, err := m.validateAntivirus(context.TODO(), testPlanner(share, nil))
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+
+	scanner := corev1.Container{
+		Name:  "clamd",
+		Image: "registry.example.com/clamd:1",
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: antivirusVolName, MountPath: "/run/clamav"},
+		},
+	}
+	share.Spec.Antivirus.Scanner = "external"
+	valid, err = m.validateAntivirus(
+		context.TODO(), testPlanner(share, sidecarCommonConfig(scanner)))
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	check := func(
+		msg string,
+		common *sambaoperatorv1alpha1.SmbCommonConfig,
+		edit func(s *sambaoperatorv1alpha1.SmbShare)) {
+		// ---
+		t.Helper()
+		s := antivirusShare(&sambaoperatorv1alpha1.SmbShareAntivirusSpec{})
+		edit(s)
+		m, recorder := newTestManager(s)
+		valid, err := m.validateAntivirus(context.TODO(), testPlanner(s, common))
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidAntivirus)
+			assert.Contains(t, event, msg)
+		}
+	}
+	check("The external antivirus scanner requires an extra container of "+
+		"the common config mounting the antivirus volume",
+		sidecarCommonConfig(scannerContainer()),
+		func(s *sambaoperatorv1alpha1.SmbShare) {
+			s.Spec.Antivirus.Scanner = "external"
+		})
+	check("Antivirus scanning requires PVC storage", nil,
+		func(s *sambaoperatorv1alpha1.SmbShare) {
+			s.Spec.Storage.Pvc = nil
+		})
+	check(`Invalid quarantine directory: ".."`, nil,
+		func(s *sambaoperatorv1alpha1.SmbShare) {
+			s.Spec.Antivirus.QuarantineDirectory = ".."
+		})
+	check(`Invalid antivirus socket name: "run/clamd.sock"`, nil,
+		func(s *sambaoperatorv1alpha1.SmbShare) {
+			s.Spec.Antivirus.Socket = "run/clamd.sock"
+		})
+	check("vfsObjects must list the VFS module virusfilter", nil,
+		func(s *sambaoperatorv1alpha1.SmbShare) {
+			s.Spec.VfsObjectsMode = vfsObjectsOverride
+			s.Spec.VfsObjects = []string{"acl_xattr"}
+		})
+}
+
+func TestInfectedFilesFromLog(t *testing.T) {
+	assert.Equal(t,
+		[]string{
+			"/mnt/myshare/infected-1.jpeg: Eicar-Test-Signature",
+			"/mnt/myshare/a b.doc: Mock-Test-Signature",
+		},
+		infectedFilesFromLog(
+			"/mnt/myshare/infected-1.jpeg: Eicar-Test-Signature\n"+
+				"\n/mnt/myshare/a b.doc: Mock-Test-Signature\n"))
+	assert.Empty(t, infectedFilesFromLog(""))
+}
+
+// fakeScanners stands in for the virus scanners of the pods, returning
+// the infected files they logged.
+type fakeScanners struct {
+	logs map[string][]string
+}
+
+func (f *fakeScanners) InfectedFiles(
+	_ context.Context, pod *corev1.Pod, _, logPath string) ([]string, error) {
+	// ---
+	files, found := f.logs[pod.Name+":"+logPath]
+	if !found {
+		return nil, fmt.Errorf("pod %s not reachable", pod.Name)
+	}
+	return files, nil
+}
+
+func TestUpdateInfectedFilesStatus(t *testing.T) {
+	share := antivirusShare(&sambaoperatorv1alpha1.SmbShareAntivirusSpec{})
+	planner := testPlanner(share, nil)
+	pod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{svcSelectorKey: "myshare"},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				Conditions: []corev1.PodCondition{{
+					Type:   corev1.PodReady,
+					Status: corev1.ConditionTrue,
+				}},
+			},
+		}
+	}
+	m, recorder := newTestManager(share, pod("myshare-a"), pod("myshare-b"))
+	m.cfg.ConnectionsCheckInterval = time.Minute
+	ctx := context.TODO()
+	gauge := shareInfectedFiles.WithLabelValues("default", "myshare")
+
+	// nothing is reported without a reader
+	changed, err := m.updateInfectedFilesStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	log := "/run/antivirus/myshare.infected"
+	scanners := &fakeScanners{logs: map[string][]string{
+		"myshare-a:" + log: {"/mnt/myshare/infected-1.jpeg: Mock-Test-Signature"},
+		"myshare-b:" + log: nil,
+	}}
+	m.SetInfectedFileReader(scanners)
+	changed, err = m.updateInfectedFilesStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	if assert.NotNil(t, share.Status.InfectedFiles) {
+		assert.Equal(t, int32(1), *share.Status.InfectedFiles)
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(gauge))
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonInfectedFiles)
+		assert.Contains(t, event,
+			"Found 1 infected files on the share: "+
+				"/mnt/myshare/infected-1.jpeg: Mock-Test-Signature")
+	}
+	changed, err = m.updateInfectedFilesStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Len(t, recorder.Events, 0)
+
+	// only the files found since are listed
+	scanners.logs["myshare-b:"+log] = []string{
+		"/mnt/myshare/infected-2.jpeg: Mock-Test-Signature",
+		"/mnt/myshare/infected-3.jpeg: Mock-Test-Signature",
+	}
+	changed, err = m.updateInfectedFilesStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, int32(3), *share.Status.InfectedFiles)
+	assert.Equal(t, 3.0, testutil.ToFloat64(gauge))
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, "Found 2 infected files on the share")
+		assert.Contains(t, event, "infected-3.jpeg")
+		assert.False(t, strings.Contains(event, "infected-1.jpeg"))
+	}
+
+	// the count is cleared once the share is no longer scanned
+	share.Spec.Antivirus = nil
+	changed, err = m.updateInfectedFilesStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Nil(t, share.Status.InfectedFiles)
+	assert.Equal(t, 0.0, testutil.ToFloat64(gauge))
+}
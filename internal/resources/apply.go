@@ -0,0 +1,186 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/structured-merge-diff/v3/fieldpath"
+)
+
+// fieldManager is the name under which the operator owns the fields it
+// sets on the resources it manages.
+const fieldManager = "samba-operator"
+
+// legacyFieldManagers are the field managers of the updates made by the
+// operator. Before the operator named itself, the field manager was
+// derived from the name of its binary.
+var legacyFieldManagers = map[string]bool{
+	fieldManager: true,
+	"manager":    true,
+}
+
+// writeChild stores the changes made to a resource managed for a share,
+// such as its Deployment or Service. If the API server supports
+// server-side apply, desired is applied, so that the operator only takes
+// ownership of the fields it sets and leaves fields set by other
+// controllers alone. Otherwise current, to which the caller has made the
+// changes, is updated.
+func (m *SmbShareManager) writeChild(
+	ctx context.Context, current, desired runtime.Object) error {
+	// ---
+	if m.caps.ServerSideApply {
+		err := m.upgradeManagedFields(ctx, current)
+		if err != nil {
+			return err
+		}
+		err = m.apply(ctx, desired)
+		if !errors.IsUnsupportedMediaType(err) {
+			return err
+		}
+		m.logger.Info("Server-side apply is not supported, updating instead")
+	}
+	return m.client.Update(ctx, current, rtclient.FieldOwner(fieldManager))
+}
+
+// apply applies obj with the operator as field manager.
+func (m *SmbShareManager) apply(ctx context.Context, obj runtime.Object) error {
+	obj = obj.DeepCopyObject()
+	// apply requests must name the kind of the object
+	gvk, err := apiutil.GVKForObject(obj, m.scheme)
+	if err != nil {
+		return err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	// the owner references are left to the writes that set them, as the
+	// controller of the resources of a server group may be another share
+	// of the group.
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	accessor.SetOwnerReferences(nil)
+	return m.client.Patch(
+		ctx,
+		obj,
+		rtclient.Apply,
+		rtclient.FieldOwner(fieldManager),
+		rtclient.ForceOwnership)
+}
+
+// upgradeManagedFields hands the fields of obj that the operator owns
+// through updates over to its apply entry. Only fields owned by the apply
+// entry are removed by later applies that no longer set them, so without
+// this, settings made before the operator used server-side apply could
+// never be removed.
+func (m *SmbShareManager) upgradeManagedFields(
+	ctx context.Context, obj runtime.Object) error {
+	// ---
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	entries, changed, err := mergeUpdateEntries(accessor.GetManagedFields())
+	if err != nil || !changed {
+		return err
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": accessor.GetResourceVersion(),
+			"managedFields":   entries,
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	return m.client.Patch(
+		ctx,
+		obj.DeepCopyObject(),
+		rtclient.RawPatch(types.MergePatchType, data))
+}
+
+// ownerReferencesPath is the path of the owner references of a resource.
+var ownerReferencesPath = fieldpath.MakePathOrDie("metadata", "ownerReferences")
+
+// mergeUpdateEntries merges the update entries of the operator's field
+// managers into its apply entry. It returns true if there were update
+// entries to merge. The owner references are kept out of the apply entry:
+// apply does not send them, and owning fields it does not send would make
+// the next apply remove them.
+func mergeUpdateEntries(entries []metav1.ManagedFieldsEntry) (
+	[]metav1.ManagedFieldsEntry, bool, error) {
+	// ---
+	var merged *metav1.ManagedFieldsEntry
+	fields := &fieldpath.Set{}
+	result := []metav1.ManagedFieldsEntry{}
+	found := false
+	for i := range entries {
+		e := entries[i]
+		isUpdate := e.Operation == metav1.ManagedFieldsOperationUpdate &&
+			legacyFieldManagers[e.Manager]
+		isApply := e.Operation == metav1.ManagedFieldsOperationApply &&
+			e.Manager == fieldManager
+		if !isUpdate && !isApply {
+			result = append(result, e)
+			continue
+		}
+		found = found || isUpdate
+		if merged == nil {
+			merged = e.DeepCopy()
+		}
+		if e.FieldsV1 == nil {
+			continue
+		}
+		s := &fieldpath.Set{}
+		if err := s.FromJSON(bytes.NewReader(e.FieldsV1.Raw)); err != nil {
+			return nil, false, err
+		}
+		fields = fields.Union(s)
+	}
+	if !found {
+		return entries, false, nil
+	}
+	data, err := withoutPrefix(fields, ownerReferencesPath).ToJSON()
+	if err != nil {
+		return nil, false, err
+	}
+	merged.Manager = fieldManager
+	merged.Operation = metav1.ManagedFieldsOperationApply
+	merged.FieldsType = "FieldsV1"
+	merged.FieldsV1 = &metav1.FieldsV1{Raw: data}
+	return append(result, *merged), true, nil
+}
+
+// withoutPrefix returns the fields of s that are not prefix or below it.
+func withoutPrefix(s *fieldpath.Set, prefix fieldpath.Path) *fieldpath.Set {
+	excluded := fieldpath.NewSet()
+	s.Iterate(func(p fieldpath.Path) {
+		if len(p) >= len(prefix) && p[:len(prefix)].Equals(prefix) {
+			excluded.Insert(p.Copy())
+		}
+	})
+	return s.Difference(excluded)
+}
@@ -0,0 +1,263 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// applyClient records the objects applied through it, as the fake client
+// does not support server-side apply.
+type applyClient struct {
+	rtclient.Client
+	applied  []runtime.Object
+	opts     *rtclient.PatchOptions
+	applyErr error
+}
+
+func (c *applyClient) Patch(
+	ctx context.Context,
+	obj runtime.Object,
+	patch rtclient.Patch,
+	opts ...rtclient.PatchOption) error {
+	// ---
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	if c.applyErr != nil {
+		return c.applyErr
+	}
+	c.applied = append(c.applied, obj)
+	c.opts = &rtclient.PatchOptions{}
+	c.opts.ApplyOptions(opts)
+	return nil
+}
+
+const meshAnnotation = "mesh.example.com/inject"
+
+// externalService returns the Service of the share, created by the operator
+// and then annotated by another controller.
+func externalService(
+	t *testing.T,
+	m *SmbShareManager,
+	planner *sharePlanner) *corev1.Service {
+	// ---
+	svc, created, err := m.getOrCreateService(
+		context.TODO(), planner, "default")
+	require.NoError(t, err)
+	require.True(t, created)
+	svc.Annotations = map[string]string{meshAnnotation: "true"}
+	require.NoError(t, m.client.Update(context.TODO(), svc))
+	return svc
+}
+
+func TestUpdateServiceKeepsAnnotations(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := testPlanner(share, nil)
+	m, _ := newTestManager(share)
+	svc := externalService(t, m, planner)
+
+	share.Spec.PublishDNSName = "share.example.com"
+	changed, err := m.updateService(context.TODO(), planner, svc, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	found := &corev1.Service{}
+	require.NoError(t, m.client.Get(context.TODO(),
+		types.NamespacedName{Namespace: "default", Name: "myshare"}, found))
+	assert.Equal(t, "true", found.Annotations[meshAnnotation])
+	assert.Equal(t,
+		"share.example.com", found.Annotations[externalDNSHostnameKey])
+}
+
+func TestUpdateServiceApply(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := testPlanner(share, nil)
+	m, _ := newTestManager(share)
+	svc := externalService(t, m, planner)
+	client := &applyClient{Client: m.client}
+	m.client = client
+	m.SetCapabilities(Capabilities{ServerSideApply: true})
+
+	share.Spec.PublishDNSName = "share.example.com"
+	changed, err := m.updateService(context.TODO(), planner, svc, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	// only the fields set by the operator are applied, leaving the
+	// annotation of the other controller alone
+	require.Len(t, client.applied, 1)
+	applied := client.applied[0].(*corev1.Service)
+	assert.Equal(t, "Service", applied.Kind)
+	assert.Equal(t, "v1", applied.APIVersion)
+	assert.Nil(t, applied.OwnerReferences)
+	assert.Equal(t,
+		map[string]string{externalDNSHostnameKey: "share.example.com"},
+		applied.Annotations)
+	assert.Equal(t, fieldManager, client.opts.FieldManager)
+	if assert.NotNil(t, client.opts.Force) {
+		assert.True(t, *client.opts.Force)
+	}
+}
+
+func TestUpdateServiceApplyUnsupported(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := testPlanner(share, nil)
+	m, _ := newTestManager(share)
+	svc := externalService(t, m, planner)
+	m.client = &applyClient{
+		Client: m.client,
+		applyErr: errors.NewGenericServerResponse(
+			http.StatusUnsupportedMediaType,
+			"patch",
+			schema.GroupResource{Resource: "services"},
+			"myshare",
+			"",
+			0,
+			false),
+	}
+	m.SetCapabilities(Capabilities{ServerSideApply: true})
+
+	share.Spec.PublishDNSName = "share.example.com"
+	changed, err := m.updateService(context.TODO(), planner, svc, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	// the Service is updated instead
+	found := &corev1.Service{}
+	require.NoError(t, m.client.Get(context.TODO(),
+		types.NamespacedName{Namespace: "default", Name: "myshare"}, found))
+	assert.Equal(t, "true", found.Annotations[meshAnnotation])
+	assert.Equal(t,
+		"share.example.com", found.Annotations[externalDNSHostnameKey])
+}
+
+func TestUpdateDeploymentKeepsAnnotations(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Namespace = "default"
+	planner := testPlanner(share, nil)
+	m, _ := newTestManager(share)
+	m.cfg.SmbdContainerName = "samba"
+	dep, created, err := m.getOrCreateDeployment(
+		context.TODO(), planner, "default")
+	require.NoError(t, err)
+	require.True(t, created)
+	dep.Annotations = map[string]string{meshAnnotation: "true"}
+	dep.Spec.Template.Annotations[meshAnnotation] = "true"
+	require.NoError(t, m.client.Update(context.TODO(), dep))
+
+	port := int32(4450)
+	share.Spec.Port = &port
+	changed, err := m.updateDeploymentPodSettings(
+		context.TODO(), planner, dep, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	found := &appsv1.Deployment{}
+	require.NoError(t, m.client.Get(context.TODO(),
+		types.NamespacedName{Namespace: "default", Name: "myshare"}, found))
+	assert.Equal(t, "true", found.Annotations[meshAnnotation])
+	assert.Equal(t, "true", found.Spec.Template.Annotations[meshAnnotation])
+	assert.Equal(t,
+		int32(4450), found.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort)
+}
+
+func fieldsV1(raw string) *metav1.FieldsV1 {
+	return &metav1.FieldsV1{Raw: []byte(raw)}
+}
+
+func TestMergeUpdateEntries(t *testing.T) {
+	entries := []metav1.ManagedFieldsEntry{
+		{
+			Manager:   "manager",
+			Operation: metav1.ManagedFieldsOperationUpdate,
+			FieldsV1:  fieldsV1(`{"f:spec":{"f:type":{}}}`),
+		},
+		{
+			Manager:   "mesh-injector",
+			Operation: metav1.ManagedFieldsOperationUpdate,
+			FieldsV1: fieldsV1(
+				`{"f:metadata":{"f:annotations":{"f:mesh":{}}}}`),
+		},
+		{
+			Manager:   fieldManager,
+			Operation: metav1.ManagedFieldsOperationApply,
+			FieldsV1:  fieldsV1(`{"f:spec":{"f:selector":{}}}`),
+		},
+	}
+	merged, changed, err := mergeUpdateEntries(entries)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	require.Len(t, merged, 2)
+	assert.Equal(t, entries[1], merged[0])
+	assert.Equal(t, fieldManager, merged[1].Manager)
+	assert.Equal(t,
+		metav1.ManagedFieldsOperationApply, merged[1].Operation)
+	assert.JSONEq(t,
+		`{"f:spec":{"f:selector":{},"f:type":{}}}`,
+		string(merged[1].FieldsV1.Raw))
+
+	// once merged, there is nothing left to do
+	_, changed, err = mergeUpdateEntries(merged)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestMergeUpdateEntriesOwnerReferences(t *testing.T) {
+	entries := []metav1.ManagedFieldsEntry{
+		{
+			Manager:   fieldManager,
+			Operation: metav1.ManagedFieldsOperationUpdate,
+			FieldsV1: fieldsV1(`{"f:metadata":{"f:ownerReferences":{
+				".":{},
+				"k:{\"uid\":\"1234\"}":{".":{},"f:uid":{}}},
+				"f:labels":{"f:app":{}}},
+				"f:spec":{"f:type":{}}}`),
+		},
+		{
+			Manager:   fieldManager,
+			Operation: metav1.ManagedFieldsOperationApply,
+			FieldsV1: fieldsV1(`{"f:metadata":{"f:ownerReferences":{
+				"k:{\"uid\":\"5678\"}":{".":{}}}}}`),
+		},
+	}
+	merged, changed, err := mergeUpdateEntries(entries)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	require.Len(t, merged, 1)
+	assert.JSONEq(t,
+		`{"f:metadata":{"f:labels":{"f:app":{}}},"f:spec":{"f:type":{}}}`,
+		string(merged[0].FieldsV1.Raw))
+	assert.NotContains(t, string(merged[0].FieldsV1.Raw), "ownerReferences")
+}
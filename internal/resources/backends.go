@@ -0,0 +1,197 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+type storageBackend string
+
+const (
+	pvcBackend       = storageBackend("pvc")
+	cephFSBackend    = storageBackend("cephfs")
+	glusterFSBackend = storageBackend("glusterfs")
+)
+
+// cephConfigKey is the key of the ceph.conf in the Secret of a share using
+// the cephfs backend.
+const cephConfigKey = "ceph.conf"
+
+// storageBackend returns the backend the samba servers use to access the
+// storage of the share.
+func (sp *sharePlanner) storageBackend() storageBackend {
+	return storageBackendOf(sp.SmbShare)
+}
+
+func storageBackendOf(s *sambaoperatorv1alpha1.SmbShare) storageBackend {
+	if s.Spec.Storage.Backend == "" {
+		return pvcBackend
+	}
+	return storageBackend(s.Spec.Storage.Backend)
+}
+
+// nativeStorage returns true if samba accesses the storage of the share
+// through the VFS module of its file system, rather than a mounted volume.
+func nativeStorage(s *sambaoperatorv1alpha1.SmbShare) bool {
+	return storageBackendOf(s) != pvcBackend
+}
+
+// cephSecretOf returns the name of the Secret holding the ceph config of
+// the share, or an empty string if the share does not use the cephfs
+// backend.
+func cephSecretOf(s *sambaoperatorv1alpha1.SmbShare) string {
+	if storageBackendOf(s) != cephFSBackend || s.Spec.Storage.CephFS == nil {
+		return ""
+	}
+	return s.Spec.Storage.CephFS.Secret
+}
+
+func cephConfigDir(secret string) string {
+	return path.Join("/etc/ceph", secret)
+}
+
+// backendOptions returns the share options loading and configuring the
+// VFS module of the share's storage backend. Nothing is returned for shares
+// using a PVC.
+func (sp *sharePlanner) backendOptions() smbcc.SmbOptions {
+	opts := smbcc.SmbOptions{}
+	storage := sp.SmbShare.Spec.Storage
+	switch sp.storageBackend() {
+	case cephFSBackend:
+		if storage.CephFS == nil {
+			return opts
+		}
+		opts[smbcc.VfsObjectsParam] = "ceph"
+		opts[smbcc.CephConfigFileParam] = path.Join(
+			cephConfigDir(storage.CephFS.Secret), cephConfigKey)
+		opts[smbcc.CephUserIDParam] = storage.CephFS.UserID
+		if fs := storage.CephFS.FileSystem; fs != "" {
+			opts[smbcc.CephFileSystemParam] = fs
+		}
+	case glusterFSBackend:
+		if storage.GlusterFS == nil {
+			return opts
+		}
+		opts[smbcc.VfsObjectsParam] = "glusterfs"
+		opts[smbcc.GlusterFSVolumeParam] = storage.GlusterFS.Volume
+		opts[smbcc.GlusterFSVolfileServerParam] = strings.Join(
+			storage.GlusterFS.Servers, " ")
+	default:
+		return opts
+	}
+	// the file locks of the VFS module are not known to the kernel.
+	opts[smbcc.KernelShareModesParam] = smbcc.No
+	return opts
+}
+
+func cephVolName(secret string) string {
+	return fmt.Sprintf("ceph-%x", sha256.Sum256([]byte(secret)))[:17]
+}
+
+func cephVolumeAndMount(secret string) (corev1.Volume, corev1.VolumeMount) {
+	// volume
+	volume := corev1.Volume{
+		Name: cephVolName(secret),
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secret,
+			},
+		},
+	}
+	// mount
+	mount := corev1.VolumeMount{
+		MountPath: cephConfigDir(secret),
+		Name:      cephVolName(secret),
+		ReadOnly:  true,
+	}
+	return volume, mount
+}
+
+// validateStorageBackend checks that a share using the cephfs or glusterfs
+// backend has the connection settings of its file system, and none of the
+// settings that need a mounted volume. The Secret of the cephfs backend
+// must hold a ceph.conf. If not, the Degraded condition is set on the
+// SmbShare and false is returned.
+func (m *SmbShareManager) validateStorageBackend(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	backend := planner.storageBackend()
+	if backend == pvcBackend {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(ctx, s, ReasonInvalidStorageBackend, msg)
+	}
+	storage := s.Spec.Storage
+	if storage.Pvc != nil {
+		return degraded(fmt.Sprintf(
+			"Storage backend %s does not use a PVC", backend))
+	}
+	if storage.InitPermissions != nil {
+		return degraded(fmt.Sprintf(
+			"Storage backend %s does not support initPermissions", backend))
+	}
+	if hd := s.Spec.HomeDirectories; hd != nil && hd.CreateUserDirs {
+		return degraded(fmt.Sprintf(
+			"Storage backend %s does not support creating user directories",
+			backend))
+	}
+	switch backend {
+	case cephFSBackend:
+		cephfs := storage.CephFS
+		if cephfs == nil || cephfs.Secret == "" || cephfs.UserID == "" {
+			return degraded(
+				"Storage backend cephfs needs the secret and userID of the cephfs section")
+		}
+		secret := &corev1.Secret{}
+		err := m.client.Get(
+			ctx,
+			types.NamespacedName{Name: cephfs.Secret, Namespace: ns},
+			secret)
+		if errors.IsNotFound(err) {
+			return degraded(fmt.Sprintf(
+				"Ceph secret %s not found", cephfs.Secret))
+		} else if err != nil {
+			m.logger.Error(err, "Failed to get ceph secret",
+				"Secret.Namespace", ns, "Secret.Name", cephfs.Secret)
+			return false, err
+		}
+		if len(secret.Data[cephConfigKey]) == 0 {
+			return degraded(fmt.Sprintf(
+				"Ceph secret %s has no %s", cephfs.Secret, cephConfigKey))
+		}
+	case glusterFSBackend:
+		gluster := storage.GlusterFS
+		if gluster == nil || gluster.Volume == "" || len(gluster.Servers) == 0 {
+			return degraded(
+				"Storage backend glusterfs needs the volume and servers of the glusterfs section")
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,168 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func cephFSShare() *sambaoperatorv1alpha1.SmbShare {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.Browseable = true
+	share.Spec.Storage.Backend = string(cephFSBackend)
+	share.Spec.Storage.CephFS = &sambaoperatorv1alpha1.SmbShareCephFSSpec{
+		Secret: "ceph-config",
+		UserID: "samba",
+	}
+	share.Spec.Storage.Path = "volumes/projects"
+	return share
+}
+
+func TestPlannerCephFSBackend(t *testing.T) {
+	share := cephFSShare()
+	share.Spec.ACLs = &sambaoperatorv1alpha1.SmbShareACLSpec{Mode: "windows"}
+	planner := testPlanner(share, nil)
+	opts := planner.shareOptions()
+	assert.Equal(t, "/volumes/projects", opts["path"])
+	// the ceph module is stacked below acl_xattr
+	assert.Equal(t, "acl_xattr ceph", opts[smbcc.VfsObjectsParam])
+	assert.Equal(t, "/etc/ceph/ceph-config/ceph.conf",
+		opts[smbcc.CephConfigFileParam])
+	assert.Equal(t, "samba", opts[smbcc.CephUserIDParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.KernelShareModesParam])
+	_, found := opts[smbcc.CephFileSystemParam]
+	assert.False(t, found)
+
+	share.Spec.Storage.CephFS.FileSystem = "fs2"
+	assert.Equal(t, "fs2", planner.shareOptions()[smbcc.CephFileSystemParam])
+
+	// the ceph config is mounted instead of a volume of the share
+	dep := buildDeployment(&conf.OperatorConfig{}, planner, "", "default")
+	smbd := dep.Spec.Template.Spec.Containers[0]
+	paths := mountPaths(dep.Spec.Template.Spec.Containers)
+	assert.Equal(t, "/etc/ceph/ceph-config",
+		paths[smbd.Name][cephVolName("ceph-config")])
+	for _, v := range dep.Spec.Template.Spec.Volumes {
+		assert.Nil(t, v.PersistentVolumeClaim)
+		if v.Name == cephVolName("ceph-config") {
+			assert.Equal(t, "ceph-config", v.Secret.SecretName)
+		}
+	}
+	if assert.Len(t, dep.Spec.Template.Spec.InitContainers, 1) {
+		assert.Equal(t, checkConfigContainerName,
+			dep.Spec.Template.Spec.InitContainers[0].Name)
+	}
+}
+
+func TestPlannerGlusterFSBackend(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Storage.Backend = string(glusterFSBackend)
+	share.Spec.Storage.GlusterFS = &sambaoperatorv1alpha1.SmbShareGlusterFSSpec{
+		Volume:  "gv0",
+		Servers: []string{"gluster1", "tcp+gluster2:24007"},
+	}
+	planner := testPlanner(share, nil)
+	opts := planner.shareOptions()
+	assert.Equal(t, "/", opts["path"])
+	assert.Equal(t, "glusterfs", opts[smbcc.VfsObjectsParam])
+	assert.Equal(t, "gv0", opts[smbcc.GlusterFSVolumeParam])
+	assert.Equal(t, "gluster1 tcp+gluster2:24007",
+		opts[smbcc.GlusterFSVolfileServerParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.KernelShareModesParam])
+
+	// shares using a PVC load no backend module
+	share.Spec.Storage.Backend = string(pvcBackend)
+	opts = planner.shareOptions()
+	_, found := opts[smbcc.VfsObjectsParam]
+	assert.False(t, found)
+	_, found = opts[smbcc.GlusterFSVolumeParam]
+	assert.False(t, found)
+}
+
+func TestValidateStorageBackend(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ceph-config", Namespace: "default"},
+		Data: map[string][]byte{
+			"ceph.conf": []byte("[global]\nmon_host = 10.0.0.1\n"),
+		},
+	}
+	ctx := context.TODO()
+
+	share := cephFSShare()
+	m, recorder := newTestManager(share, secret)
+	valid, err := m.validateStorageBackend(ctx, testPlanner(share, nil), "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+
+	check := func(msg string, share *sambaoperatorv1alpha1.SmbShare) {
+		t.Helper()
+		m, recorder := newTestManager(share, secret)
+		valid, err := m.validateStorageBackend(
+			ctx, testPlanner(share, nil), "default")
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidStorageBackend)
+			assert.Contains(t, event, msg)
+		}
+	}
+	share = cephFSShare()
+	share.Spec.Storage.CephFS.UserID = ""
+	check("Storage backend cephfs needs the secret and userID", share)
+	share = cephFSShare()
+	share.Spec.Storage.CephFS.Secret = "missing"
+	check("Ceph secret missing not found", share)
+	share = cephFSShare()
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{Name: "data"}
+	check("Storage backend cephfs does not use a PVC", share)
+	share = cephFSShare()
+	share.Spec.Storage.InitPermissions = &sambaoperatorv1alpha1.SmbShareInitPermissionsSpec{}
+	check("Storage backend cephfs does not support initPermissions", share)
+
+	share = &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.Storage.Backend = string(glusterFSBackend)
+	share.Spec.Storage.GlusterFS = &sambaoperatorv1alpha1.SmbShareGlusterFSSpec{
+		Volume: "gv0",
+	}
+	check("Storage backend glusterfs needs the volume and servers", share)
+
+	// the ceph config must be in the secret
+	secret.Data = map[string][]byte{"keyring": []byte("[client.samba]")}
+	check("Ceph secret ceph-config has no ceph.conf", cephFSShare())
+
+	// shares using a PVC are not checked
+	share = &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{Name: "data"}
+	m, _ = newTestManager(share)
+	valid, err = m.validateStorageBackend(ctx, testPlanner(share, nil), "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
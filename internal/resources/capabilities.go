@@ -0,0 +1,126 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+)
+
+const (
+	routeGroup        = "route.openshift.io"
+	routeGroupVersion = routeGroup + "/v1"
+
+	monitoringGroup        = "monitoring.coreos.com"
+	monitoringGroupVersion = monitoringGroup + "/v1"
+)
+
+// Capabilities lists the optional APIs found in the cluster.
+type Capabilities struct {
+	// Routes is true if the OpenShift Route API is available.
+	Routes bool
+	// IPFamilyPolicy is true if Services accept an IP family policy and a
+	// list of IP families, as in Kubernetes 1.20 and later.
+	IPFamilyPolicy bool
+	// ServerSideApply is true if the API server supports server-side
+	// apply, which is enabled by default since Kubernetes 1.16.
+	ServerSideApply bool
+	// ServiceMonitors is true if the ServiceMonitor API of the Prometheus
+	// Operator is available.
+	ServiceMonitors bool
+}
+
+// DetectCapabilities uses the discovery API to find the optional APIs
+// available in the cluster.
+func DetectCapabilities(d discovery.DiscoveryInterface) (Capabilities, error) {
+	caps := Capabilities{}
+	info, err := d.ServerVersion()
+	if err != nil {
+		return caps, err
+	}
+	caps.IPFamilyPolicy = atLeastVersion(info, 1, 20)
+	caps.ServerSideApply = atLeastVersion(info, 1, 16)
+	groups, err := d.ServerGroups()
+	if err != nil {
+		return caps, err
+	}
+	caps.Routes, err = hasResource(
+		d, groups.Groups, routeGroup, routeGroupVersion, "routes")
+	if err != nil {
+		return caps, err
+	}
+	caps.ServiceMonitors, err = hasResource(
+		d, groups.Groups, monitoringGroup, monitoringGroupVersion,
+		"servicemonitors")
+	if err != nil {
+		return caps, err
+	}
+	return caps, nil
+}
+
+// hasResource returns true if the resource of the given name is served in
+// the group version gv of group.
+func hasResource(
+	d discovery.DiscoveryInterface,
+	groups []metav1.APIGroup,
+	group, gv, name string) (bool, error) {
+	// ---
+	if !hasGroupVersion(groups, group, gv) {
+		return false, nil
+	}
+	resources, err := d.ServerResourcesForGroupVersion(gv)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func hasGroupVersion(groups []metav1.APIGroup, group, gv string) bool {
+	for _, g := range groups {
+		if g.Name != group {
+			continue
+		}
+		for _, v := range g.Versions {
+			if v.GroupVersion == gv {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// atLeastVersion returns true if the server version is major.minor or later.
+func atLeastVersion(v *version.Info, major, minor int) bool {
+	// the minor version of some distributions has a suffix, such as "20+"
+	vMajor, err := strconv.Atoi(strings.TrimRight(v.Major, "+"))
+	if err != nil {
+		return false
+	}
+	vMinor, err := strconv.Atoi(strings.TrimRight(v.Minor, "+"))
+	if err != nil {
+		return false
+	}
+	return vMajor > major || (vMajor == major && vMinor >= minor)
+}
@@ -0,0 +1,69 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestDetectCapabilities(t *testing.T) {
+	d := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+	d.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "apps/v1",
+		APIResources: []metav1.APIResource{{Name: "deployments"}},
+	}}
+	caps, err := DetectCapabilities(d)
+	assert.NoError(t, err)
+	assert.False(t, caps.Routes)
+
+	d.Resources = append(d.Resources, &metav1.APIResourceList{
+		GroupVersion: "route.openshift.io/v1",
+		APIResources: []metav1.APIResource{{Name: "routes"}},
+	})
+	caps, err = DetectCapabilities(d)
+	assert.NoError(t, err)
+	assert.True(t, caps.Routes)
+	assert.False(t, caps.ServiceMonitors)
+	assert.False(t, caps.IPFamilyPolicy)
+	assert.False(t, caps.ServerSideApply)
+
+	d.Resources = append(d.Resources, &metav1.APIResourceList{
+		GroupVersion: "monitoring.coreos.com/v1",
+		APIResources: []metav1.APIResource{{Name: "servicemonitors"}},
+	})
+	caps, err = DetectCapabilities(d)
+	assert.NoError(t, err)
+	assert.True(t, caps.ServiceMonitors)
+
+	d.FakedServerVersion = &version.Info{Major: "1", Minor: "20+"}
+	caps, err = DetectCapabilities(d)
+	assert.NoError(t, err)
+	assert.True(t, caps.IPFamilyPolicy)
+	assert.True(t, caps.ServerSideApply)
+}
+
+func TestAtLeastVersion(t *testing.T) {
+	assert.True(t, atLeastVersion(&version.Info{Major: "1", Minor: "20"}, 1, 20))
+	assert.True(t, atLeastVersion(&version.Info{Major: "2", Minor: "0"}, 1, 20))
+	assert.False(t, atLeastVersion(&version.Info{Major: "1", Minor: "18"}, 1, 20))
+	assert.False(t, atLeastVersion(&version.Info{}, 1, 20))
+}
@@ -0,0 +1,125 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// commonConfigResources returns the compute resources the common config
+// sets for the smbd containers, or nil if it sets none.
+func commonConfigResources(
+	cc *sambaoperatorv1alpha1.SmbCommonConfig) *corev1.ResourceRequirements {
+	// ---
+	if cc == nil || cc.Spec.PodSettings == nil {
+		return nil
+	}
+	return cc.Spec.PodSettings.Resources
+}
+
+// smbdResources returns the compute resources of the smbd containers. Each
+// request and limit is taken from the last of the operator's defaults, the
+// default common config of the namespace, the common config of the share
+// and the share itself to set it. The result is capped by the operator's
+// maximums.
+func (sp *sharePlanner) smbdResources() corev1.ResourceRequirements {
+	defaults := sp.GlobalConfig.SmbdResources()
+	layers := []*corev1.ResourceRequirements{
+		&defaults,
+		commonConfigResources(sp.DefaultCommonConfig),
+		commonConfigResources(sp.CommonConfig),
+	}
+	if s := sp.SmbShare; s != nil && s.Spec.PodSettings != nil {
+		layers = append(layers, s.Spec.PodSettings.Resources)
+	}
+	resources := corev1.ResourceRequirements{}
+	for _, l := range layers {
+		if l == nil {
+			continue
+		}
+		resources.Requests = mergeResourceList(resources.Requests, l.Requests)
+		resources.Limits = mergeResourceList(resources.Limits, l.Limits)
+	}
+	max := sp.GlobalConfig.SmbdResourceMaximums()
+	resources.Requests = capResourceList(resources.Requests, max)
+	resources.Limits = capResourceList(resources.Limits, max)
+	return resources
+}
+
+// mergeResourceList returns a copy of the resource list with the
+// quantities of override replacing those of the same resources.
+func mergeResourceList(rl, override corev1.ResourceList) corev1.ResourceList {
+	if len(override) == 0 {
+		return rl
+	}
+	merged := corev1.ResourceList{}
+	for name, q := range rl {
+		merged[name] = q
+	}
+	for name, q := range override {
+		merged[name] = q
+	}
+	return merged
+}
+
+// capResourceList returns a copy of the resource list with the quantities
+// above the maximum of the same resource lowered to the maximum.
+func capResourceList(rl, max corev1.ResourceList) corev1.ResourceList {
+	if len(rl) == 0 || len(max) == 0 {
+		return rl
+	}
+	capped := corev1.ResourceList{}
+	for name, q := range rl {
+		if m, found := max[name]; found && q.Cmp(m) > 0 {
+			q = m
+		}
+		capped[name] = q
+	}
+	return capped
+}
+
+// validateResources checks that the requests of the merged compute
+// resources of the smbd containers do not exceed their limits, which the
+// API server would reject the share's pods for. If they do, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateResources(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	resources := planner.smbdResources()
+	names := make([]string, 0, len(resources.Requests))
+	for name := range resources.Requests {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		request := resources.Requests[corev1.ResourceName(name)]
+		limit, found := resources.Limits[corev1.ResourceName(name)]
+		if found && request.Cmp(limit) > 0 {
+			return false, m.setDegraded(ctx, planner.SmbShare,
+				ReasonInvalidResources,
+				fmt.Sprintf(
+					"Request %s of resource %s is above its limit %s",
+					request.String(), name, limit.String()))
+		}
+	}
+	return true, nil
+}
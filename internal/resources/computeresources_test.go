@@ -0,0 +1,252 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+)
+
+// resourceList builds a resource list from pairs of resource names and
+// quantities.
+func resourceList(pairs ...string) corev1.ResourceList {
+	rl := corev1.ResourceList{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		rl[corev1.ResourceName(pairs[i])] = resource.MustParse(pairs[i+1])
+	}
+	return rl
+}
+
+func resourcesCommonConfig(
+	name string, requests, limits corev1.ResourceList) *sambaoperatorv1alpha1.SmbCommonConfig {
+	// ---
+	cc := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	cc.Name = name
+	cc.Namespace = "default"
+	cc.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		Resources: &corev1.ResourceRequirements{
+			Requests: requests,
+			Limits:   limits,
+		},
+	}
+	return cc
+}
+
+func TestSmbdResourcesPrecedence(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	assert.Equal(t, corev1.ResourceRequirements{}, planner.smbdResources())
+
+	// operator defaults
+	planner.GlobalConfig = &conf.OperatorConfig{
+		SmbdResourceRequests: "cpu=100m, memory=128Mi",
+		SmbdResourceLimits:   "memory=512Mi",
+	}
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: resourceList("cpu", "100m", "memory", "128Mi"),
+		Limits:   resourceList("memory", "512Mi"),
+	}, planner.smbdResources())
+
+	// the default common config overrides the operator defaults
+	planner.DefaultCommonConfig = resourcesCommonConfig("default",
+		resourceList("memory", "256Mi"),
+		resourceList("memory", "1Gi", "cpu", "2"))
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: resourceList("cpu", "100m", "memory", "256Mi"),
+		Limits:   resourceList("cpu", "2", "memory", "1Gi"),
+	}, planner.smbdResources())
+
+	// the common config of the share overrides the default common config
+	planner.CommonConfig = resourcesCommonConfig("common",
+		resourceList("cpu", "500m"), nil)
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: resourceList("cpu", "500m", "memory", "256Mi"),
+		Limits:   resourceList("cpu", "2", "memory", "1Gi"),
+	}, planner.smbdResources())
+
+	// a common config without pod settings or resources changes nothing
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	assert.Equal(t, "100m", quantity(planner.smbdResources().Requests, "cpu"))
+	planner.CommonConfig.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{}
+	assert.Equal(t, "100m", quantity(planner.smbdResources().Requests, "cpu"))
+	planner.CommonConfig = resourcesCommonConfig("common",
+		resourceList("cpu", "500m"), nil)
+
+	// the share overrides its common config
+	share.Spec.PodSettings = &sambaoperatorv1alpha1.SmbSharePodSettings{
+		Resources: &corev1.ResourceRequirements{
+			Requests: resourceList("cpu", "1", "ephemeral-storage", "1Gi"),
+			Limits:   resourceList("memory", "2Gi"),
+		},
+	}
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: resourceList(
+			"cpu", "1", "memory", "256Mi", "ephemeral-storage", "1Gi"),
+		Limits: resourceList("cpu", "2", "memory", "2Gi"),
+	}, planner.smbdResources())
+
+	// the layers themselves are left alone
+	assert.Equal(t,
+		resourceList("memory", "256Mi"),
+		planner.DefaultCommonConfig.Spec.PodSettings.Resources.Requests)
+	assert.Equal(t,
+		resourceList("cpu", "500m"),
+		planner.CommonConfig.Spec.PodSettings.Resources.Requests)
+}
+
+func quantity(rl corev1.ResourceList, name string) string {
+	q, found := rl[corev1.ResourceName(name)]
+	if !found {
+		return ""
+	}
+	return q.String()
+}
+
+func TestSmbdResourcesMaximums(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.PodSettings = &sambaoperatorv1alpha1.SmbSharePodSettings{
+		Resources: &corev1.ResourceRequirements{
+			Requests: resourceList("cpu", "4", "memory", "1Gi"),
+			Limits:   resourceList("cpu", "8", "memory", "16Gi"),
+		},
+	}
+	planner := testPlanner(share, nil)
+	planner.GlobalConfig = &conf.OperatorConfig{
+		SmbdResourceRequests: "cpu=100m",
+		SmbdResourceMax:      "cpu=2,memory=4Gi",
+	}
+	// the maximums cap requests and limits whichever layer sets them
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: resourceList("cpu", "2", "memory", "1Gi"),
+		Limits:   resourceList("cpu", "2", "memory", "4Gi"),
+	}, planner.smbdResources())
+
+	// resources without a maximum are not capped
+	planner.GlobalConfig.SmbdResourceMax = "memory=4Gi"
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: resourceList("cpu", "4", "memory", "1Gi"),
+		Limits:   resourceList("cpu", "8", "memory", "4Gi"),
+	}, planner.smbdResources())
+
+	// the maximums do not set requests or limits
+	share.Spec.PodSettings = nil
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: resourceList("cpu", "100m"),
+	}, planner.smbdResources())
+}
+
+func TestValidateResources(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	common := resourcesCommonConfig("common",
+		resourceList("memory", "256Mi"), resourceList("memory", "512Mi"))
+	planner := testPlanner(share, common)
+	ctx := context.TODO()
+
+	m, recorder := newTestManager(share)
+	valid, err := m.validateResources(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+
+	// raising a request above an inherited limit
+	share.Spec.PodSettings = &sambaoperatorv1alpha1.SmbSharePodSettings{
+		Resources: &corev1.ResourceRequirements{
+			Requests: resourceList("memory", "1Gi"),
+		},
+	}
+	m, recorder = newTestManager(share)
+	valid, err = m.validateResources(ctx, planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonInvalidResources)
+		assert.Contains(t, event,
+			"Request 1Gi of resource memory is above its limit 512Mi")
+	}
+
+	// unless the maximum caps it
+	planner.GlobalConfig = &conf.OperatorConfig{SmbdResourceMax: "memory=512Mi"}
+	m, _ = newTestManager(share)
+	valid, err = m.validateResources(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestNewPlannerDefaultCommonConfig(t *testing.T) {
+	dflt := resourcesCommonConfig("dflt", resourceList("cpu", "1"), nil)
+	dflt.Labels = map[string]string{DefaultCommonConfigLabelKey: "true"}
+	common := resourcesCommonConfig("common", resourceList("memory", "1Gi"), nil)
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.CommonConfig = "common"
+	m, _ := newTestManager(share, dflt, common)
+	ctx := context.TODO()
+
+	planner, err := m.newPlanner(ctx, nil, share)
+	require.NoError(t, err)
+	assert.Equal(t, "common", planner.CommonConfig.Name)
+	assert.Equal(t, "dflt", planner.DefaultCommonConfig.Name)
+	assert.Equal(t,
+		resourceList("cpu", "1", "memory", "1Gi"),
+		planner.smbdResources().Requests)
+
+	// a share referring to no common config uses the default one once
+	share.Spec.CommonConfig = ""
+	planner, err = m.newPlanner(ctx, nil, share)
+	require.NoError(t, err)
+	assert.Equal(t, "dflt", planner.CommonConfig.Name)
+	assert.Nil(t, planner.DefaultCommonConfig)
+}
+
+func TestSmbdContainerResources(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := resourcesCommonConfig("common",
+		resourceList("cpu", "250m"), resourceList("memory", "1Gi"))
+	planner := testPlanner(share, common)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	current := buildDeployment(cfg, planner, "mypvc", "default")
+	for _, ctr := range current.Spec.Template.Spec.Containers {
+		if ctr.Name == "samba" {
+			assert.Equal(t, planner.smbdResources(), ctr.Resources)
+		} else {
+			assert.Equal(t, corev1.ResourceRequirements{}, ctr.Resources, ctr.Name)
+		}
+	}
+	assert.False(t, updatePodTemplateSettings(current, current.DeepCopy()))
+
+	share.Spec.PodSettings = &sambaoperatorv1alpha1.SmbSharePodSettings{
+		Resources: &corev1.ResourceRequirements{
+			Limits: resourceList("memory", "2Gi"),
+		},
+	}
+	desired := buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t, "2Gi",
+		quantity(current.Spec.Template.Spec.Containers[0].Resources.Limits, "memory"))
+	assert.False(t, updatePodTemplateSettings(current, desired))
+}
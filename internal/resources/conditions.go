@@ -0,0 +1,146 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// findCondition returns a pointer to the condition of the given type or
+// nil if no such condition is present.
+func findCondition(
+	conds []sambaoperatorv1alpha1.Condition,
+	ctype sambaoperatorv1alpha1.ConditionType) *sambaoperatorv1alpha1.Condition {
+	// ---
+	for i := range conds {
+		if conds[i].Type == ctype {
+			return &conds[i]
+		}
+	}
+	return nil
+}
+
+// setCondition adds or updates a condition in the list of conditions.
+// The transition time is only changed when the status changes. It returns
+// true if the list was modified.
+func setCondition(
+	conds *[]sambaoperatorv1alpha1.Condition,
+	newCond sambaoperatorv1alpha1.Condition) bool {
+	// ---
+	existing := findCondition(*conds, newCond.Type)
+	if existing == nil {
+		if newCond.LastTransitionTime.IsZero() {
+			newCond.LastTransitionTime = metav1.Now()
+		}
+		*conds = append(*conds, newCond)
+		return true
+	}
+	if existing.Status == newCond.Status &&
+		existing.Reason == newCond.Reason &&
+		existing.Message == newCond.Message &&
+		existing.ObservedGeneration == newCond.ObservedGeneration {
+		return false
+	}
+	if existing.Status != newCond.Status {
+		existing.Status = newCond.Status
+		existing.LastTransitionTime = metav1.Now()
+	}
+	existing.Reason = newCond.Reason
+	existing.Message = newCond.Message
+	existing.ObservedGeneration = newCond.ObservedGeneration
+	return true
+}
+
+func degradedCondition(
+	generation int64, reason, msg string) sambaoperatorv1alpha1.Condition {
+	// ---
+	return sambaoperatorv1alpha1.Condition{
+		Type:               sambaoperatorv1alpha1.ConditionDegraded,
+		Status:             corev1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            msg,
+	}
+}
+
+func notDegradedCondition(generation int64) sambaoperatorv1alpha1.Condition {
+	return sambaoperatorv1alpha1.Condition{
+		Type:               sambaoperatorv1alpha1.ConditionDegraded,
+		Status:             corev1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             ReasonReconciled,
+	}
+}
+
+func progressingCondition(
+	generation int64, reason, msg string) sambaoperatorv1alpha1.Condition {
+	// ---
+	return sambaoperatorv1alpha1.Condition{
+		Type:               sambaoperatorv1alpha1.ConditionProgressing,
+		Status:             corev1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            msg,
+	}
+}
+
+func notProgressingCondition(
+	generation int64, reason string) sambaoperatorv1alpha1.Condition {
+	// ---
+	return sambaoperatorv1alpha1.Condition{
+		Type:               sambaoperatorv1alpha1.ConditionProgressing,
+		Status:             corev1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             reason,
+	}
+}
+
+func pausedCondition(
+	generation int64, paused bool, msg string) sambaoperatorv1alpha1.Condition {
+	// ---
+	cond := sambaoperatorv1alpha1.Condition{
+		Type:               sambaoperatorv1alpha1.ConditionPaused,
+		Status:             corev1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             ReasonUnpaused,
+	}
+	if paused {
+		cond.Status = corev1.ConditionTrue
+		cond.Reason = ReasonPaused
+		cond.Message = msg
+	}
+	return cond
+}
+
+func suspendedCondition(
+	generation int64, suspended bool) sambaoperatorv1alpha1.Condition {
+	// ---
+	cond := sambaoperatorv1alpha1.Condition{
+		Type:               sambaoperatorv1alpha1.ConditionSuspended,
+		Status:             corev1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             ReasonResumed,
+	}
+	if suspended {
+		cond.Status = corev1.ConditionTrue
+		cond.Reason = ReasonSuspended
+		cond.Message = "The share is suspended and not served"
+	}
+	return cond
+}
@@ -0,0 +1,50 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+func TestSetCondition(t *testing.T) {
+	var conds []sambaoperatorv1alpha1.Condition
+
+	changed := setCondition(&conds, degradedCondition(1, "Oops", "bad"))
+	assert.True(t, changed)
+	assert.Len(t, conds, 1)
+	t0 := conds[0].LastTransitionTime
+
+	changed = setCondition(&conds, degradedCondition(1, "Oops", "bad"))
+	assert.False(t, changed)
+
+	// same status, new message: transition time is kept
+	changed = setCondition(&conds, degradedCondition(1, "Oops", "worse"))
+	assert.True(t, changed)
+	assert.Equal(t, "worse", conds[0].Message)
+	assert.Equal(t, t0, conds[0].LastTransitionTime)
+
+	changed = setCondition(&conds, notDegradedCondition(2))
+	assert.True(t, changed)
+	assert.Len(t, conds, 1)
+	assert.Equal(t, corev1.ConditionFalse, conds[0].Status)
+	assert.Equal(t, int64(2), conds[0].ObservedGeneration)
+	assert.Equal(t, "", conds[0].Message)
+}
@@ -0,0 +1,257 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// ShareConnections counts the client connections to a share.
+type ShareConnections struct {
+	// Total is the number of connections.
+	Total int
+	// Encrypted is the number of encrypted connections.
+	Encrypted int
+}
+
+// ConnectionCounter counts the clients connected to the shares served by
+// pods.
+type ConnectionCounter interface {
+	// Connections counts the client connections to the named share served
+	// by the given container of the pod.
+	Connections(
+		ctx context.Context,
+		pod *corev1.Pod,
+		container, shareName string) (ShareConnections, error)
+}
+
+// smbstatusConnections counts connections by running smbstatus in the
+// samba container of the pods.
+type smbstatusConnections struct {
+	client kubernetes.Interface
+	config *rest.Config
+}
+
+// NewSmbstatusConnections returns a ConnectionCounter running smbstatus in
+// the pods, through the API server's pod exec subresource.
+func NewSmbstatusConnections(
+	client kubernetes.Interface, config *rest.Config) ConnectionCounter {
+	// ---
+	return &smbstatusConnections{client: client, config: config}
+}
+
+// Connections implements ConnectionCounter.
+func (c *smbstatusConnections) Connections(
+	ctx context.Context,
+	pod *corev1.Pod,
+	container, shareName string) (ShareConnections, error) {
+	// ---
+	out, err := podExec(
+		c.client, c.config, pod, container, "smbstatus", "--shares")
+	if err != nil {
+		return ShareConnections{}, err
+	}
+	return connectionsFromSmbstatus(out, shareName), nil
+}
+
+// podExec runs the command in the container of the pod, through the API
+// server's pod exec subresource, and returns its output.
+func podExec(
+	client kubernetes.Interface,
+	config *rest.Config,
+	pod *corev1.Pod,
+	container string,
+	command ...string) (string, error) {
+	// ---
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	err = exec.Stream(remotecommand.StreamOptions{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w: %s",
+			command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// connectionsFromSmbstatus counts the connections to the named share
+// listed in the output of smbstatus --shares. The table lists a connection
+// per line, starting with the name of the share and the id of the process
+// serving it. Share names may contain spaces, so a line is taken to be a
+// connection to the share if the name is followed by a process id. The
+// line ends with the encryption and signing of the connection, shown as
+// "-" if not in effect.
+func connectionsFromSmbstatus(out, shareName string) ShareConnections {
+	conns := ShareConnections{}
+	inTable := false
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "---") {
+			inTable = true
+			continue
+		}
+		if !inTable || len(line) <= len(shareName) ||
+			!strings.EqualFold(line[:len(shareName)], shareName) {
+			// ---
+			continue
+		}
+		rest := line[len(shareName):]
+		if rest[0] != ' ' && rest[0] != '\t' {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 || !isProcessID(fields[0]) {
+			continue
+		}
+		conns.Total++
+		if len(fields) >= 4 && fields[len(fields)-2] != "-" {
+			conns.Encrypted++
+		}
+	}
+	return conns
+}
+
+// isProcessID returns true if s is a process id as shown by smbstatus,
+// optionally prefixed with the node number of a cluster, as in "1:1234".
+func isProcessID(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && r != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// podReady returns true if the pod is ready to serve clients.
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// countConnections counts the client connections to the share on the pods
+// serving it. Pods being deleted are counted while they drain their
+// clients. Pods that are not ready, or that can not be queried, are
+// skipped; nil is returned if no pod could be queried.
+func (m *SmbShareManager) countConnections(
+	ctx context.Context, planner *sharePlanner, ns string) (
+	*ShareConnections, error) {
+	// ---
+	pods := &corev1.PodList{}
+	err := m.client.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{
+			svcSelectorKey: labelValue(planner.instanceName()),
+		})
+	if err != nil {
+		m.logger.Error(err, "Failed to list pods", "namespace", ns)
+		return nil, err
+	}
+	var count *ShareConnections
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		draining := pod.DeletionTimestamp != nil &&
+			pod.Status.Phase == corev1.PodRunning
+		if !draining && !podReady(pod) {
+			continue
+		}
+		n, err := m.conns.Connections(
+			ctx, pod, m.cfg.SmbdContainerName, planner.shareName())
+		if err != nil {
+			// the count is reported from the pods that could be queried
+			m.logger.Error(err, "Failed to count connections",
+				"Pod.Namespace", ns, "Pod.Name", pod.Name)
+			continue
+		}
+		if count == nil {
+			count = &ShareConnections{}
+		}
+		count.Total += n.Total
+		count.Encrypted += n.Encrypted
+	}
+	return count, nil
+}
+
+// updateConnectionsStatus counts the client connections to the share on
+// the pods serving it and records the count, and how many connections are
+// encrypted, in the status of the SmbShare. Pods being deleted are counted
+// while they drain their clients, so that the count shows when an update of
+// the pods has completed. If no pod could be queried the counts are
+// cleared. Returns true if the status was changed.
+func (m *SmbShareManager) updateConnectionsStatus(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	if m.conns == nil || m.cfg.ConnectionsCheckInterval == 0 {
+		return false, nil
+	}
+	count, err := m.countConnections(ctx, planner, ns)
+	if err != nil {
+		return false, err
+	}
+	var active *int32
+	var encryption *sambaoperatorv1alpha1.SmbShareEncryptionStatus
+	if count != nil {
+		active = new(int32)
+		*active = int32(count.Total)
+		encryption = &sambaoperatorv1alpha1.SmbShareEncryptionStatus{
+			Encrypted:   int32(count.Encrypted),
+			Unencrypted: int32(count.Total - count.Encrypted),
+		}
+	}
+	if reflect.DeepEqual(s.Status.ActiveConnections, active) &&
+		reflect.DeepEqual(s.Status.EncryptionInEffect, encryption) {
+		// ---
+		return false, nil
+	}
+	s.Status.ActiveConnections = active
+	s.Status.EncryptionInEffect = encryption
+	return true, m.client.Status().Update(ctx, s)
+}
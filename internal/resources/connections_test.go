@@ -0,0 +1,161 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+const testSmbstatus = `
+Service      pid     Machine       Connected at                     Encryption   Signing
+---------------------------------------------------------------------------------------------
+Forced       123     10.0.0.5      Wed Oct 14 10:00:00 AM 2026 UTC  -            -
+IPC$         123     10.0.0.5      Wed Oct 14 10:00:00 AM 2026 UTC  -            -
+forced       1:456   10.0.0.6      Wed Oct 14 10:01:00 AM 2026 UTC  AES-128-GCM  AES-128-GMAC
+Forced Two   789     10.0.0.7      Wed Oct 14 10:02:00 AM 2026 UTC  -            -
+`
+
+func TestConnectionsFromSmbstatus(t *testing.T) {
+	assert.Equal(t, ShareConnections{Total: 2, Encrypted: 1},
+		connectionsFromSmbstatus(testSmbstatus, "Forced"))
+	assert.Equal(t, ShareConnections{Total: 1},
+		connectionsFromSmbstatus(testSmbstatus, "Forced Two"))
+	assert.Equal(t, ShareConnections{},
+		connectionsFromSmbstatus(testSmbstatus, "Force"))
+	assert.Equal(t, ShareConnections{},
+		connectionsFromSmbstatus(testSmbstatus, "Service"))
+	assert.Equal(t, ShareConnections{}, connectionsFromSmbstatus("", "Forced"))
+}
+
+type fakeConnections struct {
+	count     map[string]int
+	encrypted map[string]int
+}
+
+func (f *fakeConnections) Connections(
+	_ context.Context, pod *corev1.Pod, _, _ string) (ShareConnections, error) {
+	// ---
+	n, found := f.count[pod.Name]
+	if !found {
+		return ShareConnections{}, fmt.Errorf("pod %s not reachable", pod.Name)
+	}
+	return ShareConnections{Total: n, Encrypted: f.encrypted[pod.Name]}, nil
+}
+
+func TestUpdateConnectionsStatus(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := testPlanner(share, nil)
+	pod := func(name string, ready bool) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{svcSelectorKey: "myshare"},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				Conditions: []corev1.PodCondition{{
+					Type:   corev1.PodReady,
+					Status: status,
+				}},
+			},
+		}
+	}
+	draining := pod("myshare-c", false)
+	now := metav1.NewTime(time.Now())
+	draining.DeletionTimestamp = &now
+	m, _ := newTestManager(share,
+		pod("myshare-a", true), pod("myshare-b", false), draining,
+		pod("myshare-d", true))
+	m.cfg.ConnectionsCheckInterval = time.Minute
+	ctx := context.Background()
+
+	// connections are not counted without a counter
+	changed, err := m.updateConnectionsStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// unready pods are skipped, unreachable pods are ignored
+	conns := &fakeConnections{count: map[string]int{
+		"myshare-a": 2,
+		"myshare-b": 4,
+		"myshare-c": 1,
+	}}
+	m.SetConnectionCounter(conns)
+	changed, err = m.updateConnectionsStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	if assert.NotNil(t, share.Status.ActiveConnections) {
+		assert.EqualValues(t, 3, *share.Status.ActiveConnections)
+	}
+
+	assert.Equal(t,
+		&sambaoperatorv1alpha1.SmbShareEncryptionStatus{Unencrypted: 3},
+		share.Status.EncryptionInEffect)
+
+	changed, err = m.updateConnectionsStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// encrypted connections are counted apart
+	conns.encrypted = map[string]int{"myshare-a": 1, "myshare-d": 1}
+	conns.count["myshare-d"] = 1
+	changed, err = m.updateConnectionsStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	if assert.NotNil(t, share.Status.ActiveConnections) {
+		assert.EqualValues(t, 4, *share.Status.ActiveConnections)
+	}
+	assert.Equal(t,
+		&sambaoperatorv1alpha1.SmbShareEncryptionStatus{Encrypted: 2, Unencrypted: 2},
+		share.Status.EncryptionInEffect)
+	conns.encrypted = nil
+
+	// no connections is not the same as an unknown count
+	conns.count = map[string]int{"myshare-a": 0}
+	changed, err = m.updateConnectionsStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	if assert.NotNil(t, share.Status.ActiveConnections) {
+		assert.EqualValues(t, 0, *share.Status.ActiveConnections)
+	}
+
+	conns.count = map[string]int{}
+	changed, err = m.updateConnectionsStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	stored := &sambaoperatorv1alpha1.SmbShare{}
+	err = m.client.Get(ctx, types.NamespacedName{
+		Namespace: "default", Name: "myshare"}, stored)
+	assert.NoError(t, err)
+	assert.Nil(t, stored.Status.ActiveConnections)
+	assert.Nil(t, stored.Status.EncryptionInEffect)
+}
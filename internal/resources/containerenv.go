@@ -0,0 +1,110 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// managedEnvPrefix prefixes the environment variables configuring sambacc,
+// which the operator manages.
+const managedEnvPrefix = "SAMBACC_"
+
+// extraEnv returns the environment variables the common config sets in the
+// samba server containers.
+func (sp *sharePlanner) extraEnv() []sambaoperatorv1alpha1.SmbEnvVar {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.PodSettings == nil {
+		return nil
+	}
+	return sp.CommonConfig.Spec.PodSettings.ExtraEnv
+}
+
+// containerArgs returns the arguments the common config passes to the
+// samba-container command of the samba server containers.
+func (sp *sharePlanner) containerArgs() []string {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.PodSettings == nil {
+		return nil
+	}
+	return sp.CommonConfig.Spec.PodSettings.ContainerArgs
+}
+
+// managedEnv returns true if the environment variable is set by the
+// operator, and so can not be set by the common config.
+func managedEnv(planner *sharePlanner, name string) bool {
+	if strings.HasPrefix(name, managedEnvPrefix) ||
+		strings.HasPrefix(name, sharePathEnvPrefix) {
+		// ---
+		return true
+	}
+	for _, e := range defaultPodEnv(planner) {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// serverEnv returns the environment of the samba server containers: the
+// default environment of the pods and the extra variables of the common
+// config. Variables the operator manages are never overridden.
+func serverEnv(planner *sharePlanner, podEnv []corev1.EnvVar) []corev1.EnvVar {
+	env := append([]corev1.EnvVar{}, podEnv...)
+	for _, e := range planner.extraEnv() {
+		if managedEnv(planner, e.Name) {
+			continue
+		}
+		env = append(env, corev1.EnvVar{Name: e.Name, Value: e.Value})
+	}
+	return env
+}
+
+// serverArgs returns the arguments of the samba-container command of a
+// samba server container, the arguments of the common config preceding
+// those running the server.
+func serverArgs(planner *sharePlanner, args ...string) []string {
+	return append(append([]string{}, planner.containerArgs()...), args...)
+}
+
+// validateExtraEnv checks that the extra environment variables of the
+// common config are defined once and are not managed by the operator. If
+// not, the Degraded condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateExtraEnv(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidExtraEnv, msg)
+	}
+	seen := map[string]bool{}
+	for _, e := range planner.extraEnv() {
+		if managedEnv(planner, e.Name) {
+			return degraded(fmt.Sprintf(
+				"Environment variable %s is managed by the operator", e.Name))
+		}
+		if seen[e.Name] {
+			return degraded(fmt.Sprintf(
+				"Environment variable %s is set more than once", e.Name))
+		}
+		seen[e.Name] = true
+	}
+	return true, nil
+}
@@ -0,0 +1,128 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+)
+
+func containerEnv(ctr corev1.Container) map[string]string {
+	env := map[string]string{}
+	for _, e := range ctr.Env {
+		env[e.Name] = e.Value
+	}
+	return env
+}
+
+func TestBuildPodSpecExtraEnv(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		ExtraEnv: []sambaoperatorv1alpha1.SmbEnvVar{
+			{Name: "SAMBA_EXPERIMENTAL", Value: "1"},
+			{Name: "SAMBA_CONTAINER_ID", Value: "other"},
+			{Name: "SAMBACC_CONFIG", Value: "/tmp/config.json"},
+		},
+		ContainerArgs: []string{"--debug-delay=5"},
+	}
+	planner := testPlanner(share, common)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	podSpec := buildPodSpec(planner, cfg, "mypvc")
+
+	ctr := podSpec.Containers[0]
+	env := containerEnv(ctr)
+	assert.Equal(t, "1", env["SAMBA_EXPERIMENTAL"])
+	// the variables managed by the operator are not overridden
+	assert.Equal(t, string(planner.instanceID()), env["SAMBA_CONTAINER_ID"])
+	assert.Equal(t, planner.containerConfigPath(), env["SAMBACC_CONFIG"])
+	assert.Len(t, ctr.Env, len(defaultPodEnv(planner))+1)
+	assert.Equal(t, []string{"--debug-delay=5", "run", "smbd"}, ctr.Args)
+
+	// in active directory mode, winbind is given the settings as well
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode:  "active-directory",
+			Realm: "EXAMPLE.COM",
+		},
+	}
+	podSpec = buildPodSpec(planner, cfg, "mypvc")
+	for _, ctr := range podSpec.Containers {
+		server := ctr.Name == "samba" || ctr.Name == "wb"
+		_, found := containerEnv(ctr)["SAMBA_EXPERIMENTAL"]
+		assert.Equal(t, server, found, ctr.Name)
+		if server {
+			assert.Equal(t, "--debug-delay=5", ctr.Args[0], ctr.Name)
+		}
+	}
+	// the configuration is checked with the environment of smbd
+	for _, ctr := range podSpec.InitContainers {
+		_, found := containerEnv(ctr)["SAMBA_EXPERIMENTAL"]
+		assert.Equal(t, ctr.Name == checkConfigContainerName, found, ctr.Name)
+	}
+}
+
+func TestValidateExtraEnv(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		ExtraEnv: []sambaoperatorv1alpha1.SmbEnvVar{
+			{Name: "SAMBA_EXPERIMENTAL", Value: "1"},
+			{Name: "SAMBA_DEBUG_LEVEL", Value: "3"},
+		},
+	}
+	planner := testPlanner(share, common)
+	env := common.Spec.PodSettings.ExtraEnv
+
+	m, recorder := newTestManager(share)
+	valid, err := m.validateExtraEnv(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+
+	check := func(msg string) {
+		t.Helper()
+		m, recorder := newTestManager(share)
+		valid, err := m.validateExtraEnv(context.TODO(), planner)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidExtraEnv)
+			assert.Contains(t, event, msg)
+		}
+	}
+	// the debug level is managed by the operator once set
+	common.Spec.Debug = &sambaoperatorv1alpha1.SmbDebugSpec{LogLevel: "5"}
+	check("Environment variable SAMBA_DEBUG_LEVEL is managed by the operator")
+	common.Spec.Debug = nil
+
+	env[1].Name = "SAMBACC_JOIN_FILES"
+	check("Environment variable SAMBACC_JOIN_FILES is managed by the operator")
+	env[1].Name = "SAMBA_SHARE_PATH_MYSHARE"
+	check("Environment variable SAMBA_SHARE_PATH_MYSHARE is managed by the operator")
+	env[1].Name = "SAMBA_EXPERIMENTAL"
+	check("Environment variable SAMBA_EXPERIMENTAL is set more than once")
+}
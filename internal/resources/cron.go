@@ -0,0 +1,158 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron schedule of five fields: minute, hour, day
+// of month, month and day of week. Each field is a bit set of the values it
+// matches.
+type cronSchedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// domAny and dowAny are true if the day fields start with "*". As in
+	// cron, a day matches either of two restricted day fields.
+	domAny bool
+	dowAny bool
+}
+
+// parseCronSchedule parses a cron schedule. The fields accept "*", numbers,
+// ranges such as "1-5", steps such as "*/15" or "10-50/10", and lists of
+// those separated by commas. Days of the week are 0 to 7, both 0 and 7
+// being Sunday.
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, found %d", len(fields))
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	bits := [5]uint64{}
+	for i, f := range fields {
+		b, err := parseCronField(f, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+	c := &cronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: strings.HasPrefix(fields[2], "*"),
+		dowAny: strings.HasPrefix(fields[4], "*"),
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+// parseCronField returns the bit set of the values, between min and max,
+// matched by a field of a cron schedule.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := min, max
+		var err error
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			r := strings.SplitN(rng, "-", 2)
+			lo, err = strconv.Atoi(r[0])
+			if err == nil {
+				hi, err = strconv.Atoi(r[1])
+			}
+		default:
+			lo, err = strconv.Atoi(rng)
+			if step == 1 {
+				// a single value, unless it starts a step
+				hi = lo
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("invalid value %q", part)
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf(
+				"value %q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// matchesDay returns true if the day of t is matched by the schedule.
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// cronSearchLimit bounds the search for the next time of a schedule, so
+// that schedules never matching, such as February 30th, are detected.
+const cronSearchLimit = 5
+
+// next returns the first time, in UTC and after t, matched by the schedule.
+// The zero time is returned if the schedule matches no time within the
+// next years.
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronSearchLimit, 0, 0)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		switch {
+		case c.month&(1<<uint(m)) == 0:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.matchesDay(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,89 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	c, err := parseCronSchedule("*/15 3 * * 0")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1|1<<15|1<<30|1<<45), c.minute)
+	assert.Equal(t, uint64(1<<3), c.hour)
+	assert.Equal(t, uint64(1), c.dow)
+	// Sunday is also day 7
+	c, err = parseCronSchedule("0 0 * * 5-7")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1|1<<5|1<<6|1<<7), c.dow)
+	c, err = parseCronSchedule("10-30/10,45 0 1 1,7 *")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1<<10|1<<20|1<<30|1<<45), c.minute)
+	assert.Equal(t, uint64(1<<1|1<<7), c.month)
+
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		_, err := parseCronSchedule(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return v
+	}
+	next := func(spec, after string) time.Time {
+		t.Helper()
+		c, err := parseCronSchedule(spec)
+		require.NoError(t, err)
+		return c.next(at(after))
+	}
+	// 2021-06-02 is a Wednesday
+	assert.Equal(t, at("2021-06-02T10:31:00Z"),
+		next("* * * * *", "2021-06-02T10:30:20Z"))
+	assert.Equal(t, at("2021-06-02T10:45:00Z"),
+		next("*/15 * * * *", "2021-06-02T10:30:00Z"))
+	assert.Equal(t, at("2021-06-06T03:00:00Z"),
+		next("0 3 * * 0", "2021-06-02T10:30:00Z"))
+	assert.Equal(t, at("2022-01-01T00:00:00Z"),
+		next("0 0 1 1 *", "2021-06-02T10:30:00Z"))
+	// either restricted day field matches
+	assert.Equal(t, at("2021-06-05T00:00:00Z"),
+		next("0 0 15 * 6", "2021-06-02T10:30:00Z"))
+	// times are in UTC
+	cest := time.FixedZone("CEST", 2*60*60)
+	assert.Equal(t, at("2021-06-03T03:00:00Z"),
+		next("0 3 * * *", at("2021-06-03T04:30:00+02:00").In(cest).Format(time.RFC3339)))
+	assert.True(t, next("0 0 30 2 *", "2021-06-02T10:30:00Z").IsZero())
+}
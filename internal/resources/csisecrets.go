@@ -0,0 +1,101 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+const (
+	// defaultSecretsStoreCSIDriver is the name of the Secrets Store CSI
+	// driver.
+	defaultSecretsStoreCSIDriver = "secrets-store.csi.k8s.io"
+	// secretProviderClassAPIVersion is the API version of the
+	// SecretProviderClasses of the Secrets Store CSI driver.
+	secretProviderClassAPIVersion = "secrets-store.csi.x-k8s.io/v1"
+)
+
+// csiSecretVolumeSource returns the source of a volume of the Secrets Store
+// CSI driver fetching the secrets of the SecretProviderClass of spec.
+func csiSecretVolumeSource(
+	spec *sambaoperatorv1alpha1.SmbCSISecretVolumeSpec) corev1.VolumeSource {
+	// ---
+	driver := spec.Driver
+	if driver == "" {
+		driver = defaultSecretsStoreCSIDriver
+	}
+	readOnly := true
+	return corev1.VolumeSource{
+		CSI: &corev1.CSIVolumeSource{
+			Driver:   driver,
+			ReadOnly: &readOnly,
+			VolumeAttributes: map[string]string{
+				"secretProviderClass": spec.SecretProviderClass,
+			},
+		},
+	}
+}
+
+// validateCSISecretVolume checks that users mounted from a CSI volume are
+// not also given a users secret, and that the SecretProviderClass of the
+// volume exists in the namespace of the pods. If not, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateCSISecretVolume(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	uss := planner.userSecuritySource()
+	if planner.securityMode() != userMode || uss.CSIVolume == nil {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidCSISecretVolume, msg)
+	}
+	if planner.SecurityConfig.Spec.Users.Secret != "" {
+		return degraded(fmt.Sprintf(
+			"Security config %s sets both a users secret and a CSI secret volume",
+			planner.SecurityConfig.Name))
+	}
+	name := uss.CSIVolume.SecretProviderClass
+	spc := &unstructured.Unstructured{}
+	spc.SetAPIVersion(secretProviderClassAPIVersion)
+	spc.SetKind("SecretProviderClass")
+	err := m.client.Get(
+		ctx, types.NamespacedName{Name: name, Namespace: ns}, spc)
+	if meta.IsNoMatchError(err) {
+		return degraded(
+			"SecretProviderClasses are not supported by the cluster: " +
+				"the Secrets Store CSI driver is not installed")
+	} else if errors.IsNotFound(err) {
+		return degraded(fmt.Sprintf(
+			"SecretProviderClass %s not found in namespace %s", name, ns))
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get SecretProviderClass",
+			"SecretProviderClass.Namespace", ns,
+			"SecretProviderClass.Name", name)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,123 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+)
+
+// csiUsersPlanner returns a planner of a share whose users are mounted from
+// a volume of the SecretProviderClass vault-users.
+func csiUsersPlanner(share *sambaoperatorv1alpha1.SmbShare) *sharePlanner {
+	planner := localGroupsPlanner(share)
+	planner.SecurityConfig.Name = "mysec"
+	planner.SecurityConfig.Spec.Users = &sambaoperatorv1alpha1.SmbSecurityUsersSpec{
+		CSISecretVolume: &sambaoperatorv1alpha1.SmbCSISecretVolumeSpec{
+			SecretProviderClass: "vault-users",
+			Path:                "samba/users.json",
+		},
+	}
+	return planner
+}
+
+func TestBuildPodSpecCSISecretVolume(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{}
+	planner := csiUsersPlanner(share)
+	assert.False(t, planner.usesSmbUsers())
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	var vol *corev1.Volume
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == userSecretVolName {
+			vol = &podSpec.Volumes[i]
+		}
+	}
+	if assert.NotNil(t, vol) && assert.NotNil(t, vol.CSI) {
+		assert.Nil(t, vol.Secret)
+		assert.Equal(t, "secrets-store.csi.k8s.io", vol.CSI.Driver)
+		assert.True(t, *vol.CSI.ReadOnly)
+		assert.Equal(t,
+			map[string]string{"secretProviderClass": "vault-users"},
+			vol.CSI.VolumeAttributes)
+	}
+	smbd := podSpec.Containers[0]
+	for _, mount := range smbd.VolumeMounts {
+		if mount.Name == userSecretVolName {
+			assert.Equal(t, "/etc/container-users", mount.MountPath)
+			assert.True(t, mount.ReadOnly)
+		}
+	}
+	// smbd reads the users from their path within the volume
+	assert.Equal(t,
+		"/etc/container-config/config.json:"+
+			"/etc/container-users/samba/users.json",
+		envValue(smbd.Env, containerConfigEnv))
+
+	planner.SecurityConfig.Spec.Users.CSISecretVolume.Driver = "vault.csi.example.com"
+	podSpec = buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	for _, v := range podSpec.Volumes {
+		if v.Name == userSecretVolName {
+			assert.Equal(t, "vault.csi.example.com", v.CSI.Driver)
+		}
+	}
+}
+
+func TestValidateCSISecretVolume(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := csiUsersPlanner(share)
+	spc := &unstructured.Unstructured{}
+	spc.SetAPIVersion(secretProviderClassAPIVersion)
+	spc.SetKind("SecretProviderClass")
+	spc.SetName("vault-users")
+	spc.SetNamespace("default")
+	ctx := context.TODO()
+
+	m, recorder := newTestManager(share, spc)
+	valid, err := m.validateCSISecretVolume(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+	// the users can not be validated by the operator
+	users, err := m.getUsersConfig(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.Nil(t, users)
+
+	m, recorder = newTestManager(share)
+	valid, err = m.validateCSISecretVolume(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	event := <-recorder.Events
+	assert.Contains(t, event, ReasonInvalidCSISecretVolume)
+	assert.Contains(t, event,
+		"SecretProviderClass vault-users not found in namespace default")
+
+	planner.SecurityConfig.Spec.Users.Secret = "users"
+	m, recorder = newTestManager(share, spc)
+	valid, err = m.validateCSISecretVolume(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events,
+		"Security config mysec sets both a users secret and a CSI secret volume")
+}
@@ -20,17 +20,38 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
 )
 
+// securityConfigHashKey is the pod template annotation holding the digest of
+// the SmbSecurityConfig the pods were configured with.
+const securityConfigHashKey = "samba-operator.samba.org/security-config-hash"
+
 // buildDeployment returns a samba server deployment object
 func buildDeployment(cfg *conf.OperatorConfig,
 	planner *sharePlanner, pvcName, ns string) *appsv1.Deployment {
 	// construct a deployment based on the following labels
 	labels := labelsForSmbServer(planner.instanceName())
-	var size int32 = 1
+	size := planner.replicas()
+	podAnnotations := annotationsForSmbPod(cfg.SmbdContainerName)
+	podAnnotations[corev1.SeccompPodAnnotationKey] = planner.seccompProfile()
+	if hash := planner.securityConfigHash(); hash != "" {
+		podAnnotations[securityConfigHashKey] = hash
+	}
+	podAnnotations[serverConfigHashKey] = planner.serverConfigHash()
+	if networks := planner.networksAnnotation(); networks != "" {
+		podAnnotations[networksAnnotationKey] = networks
+	}
+	if groups := planner.localGroupsConfig(); groups != "" {
+		podAnnotations[localGroupsAnnotationKey] = groups
+	}
+	if names := planner.extraContainerNames(); len(names) > 0 {
+		podAnnotations[extraContainersAnnotationKey] = strings.Join(names, ",")
+		podAnnotations[extraContainersHashKey] = planner.extraContainersHash()
+	}
 
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -43,10 +64,11 @@ func buildDeployment(cfg *conf.OperatorConfig,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
+			Strategy: planner.deploymentStrategy(),
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels:      labels,
-					Annotations: annotationsForSmbPod(cfg.SmbdContainerName),
+					Annotations: podAnnotations,
 				},
 				Spec: buildPodSpec(planner, cfg, pvcName),
 			},
@@ -55,6 +77,577 @@ func buildDeployment(cfg *conf.OperatorConfig,
 	return deployment
 }
 
+// updatePodTemplateSettings copies the pod settings managed by the
+// operator from the desired deployment into the current deployment. It
+// returns true if the current deployment was changed and needs to be
+// updated, which will result in a rolling update of the pods.
+func updatePodTemplateSettings(current, desired *appsv1.Deployment) bool {
+	return updatePodTemplate(&current.Spec.Template, &desired.Spec.Template)
+}
+
+// updatePodTemplate copies the pod settings managed by the operator from
+// the desired pod template of a workload into the current one. It returns
+// true if the current template was changed.
+func updatePodTemplate(cur, want *corev1.PodTemplateSpec) bool {
+	changed := false
+	if !equality.Semantic.DeepEqual(cur.Spec.NodeSelector, want.Spec.NodeSelector) {
+		cur.Spec.NodeSelector = want.Spec.NodeSelector
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(cur.Spec.Tolerations, want.Spec.Tolerations) {
+		cur.Spec.Tolerations = want.Spec.Tolerations
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(cur.Spec.Affinity, want.Spec.Affinity) {
+		cur.Spec.Affinity = want.Spec.Affinity
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(
+		cur.Spec.TopologySpreadConstraints, want.Spec.TopologySpreadConstraints) {
+		// ---
+		cur.Spec.TopologySpreadConstraints = want.Spec.TopologySpreadConstraints
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(
+		cur.Spec.SecurityContext, want.Spec.SecurityContext) {
+		// ---
+		cur.Spec.SecurityContext = want.Spec.SecurityContext
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(
+		cur.Spec.ImagePullSecrets, want.Spec.ImagePullSecrets) {
+		// ---
+		cur.Spec.ImagePullSecrets = want.Spec.ImagePullSecrets
+		changed = true
+	}
+	if cur.Spec.PriorityClassName != want.Spec.PriorityClassName {
+		cur.Spec.PriorityClassName = want.Spec.PriorityClassName
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(
+		cur.Spec.TerminationGracePeriodSeconds,
+		want.Spec.TerminationGracePeriodSeconds) {
+		// ---
+		cur.Spec.TerminationGracePeriodSeconds =
+			want.Spec.TerminationGracePeriodSeconds
+		changed = true
+	}
+	if updateContainerSet(cur, want) {
+		changed = true
+	}
+	if updateExtraContainers(cur, want) {
+		changed = true
+	}
+	if updateContainerImages(cur.Spec.InitContainers, want.Spec.InitContainers) {
+		changed = true
+	}
+	if updateContainerImages(cur.Spec.Containers, want.Spec.Containers) {
+		changed = true
+	}
+	if updateDNSRegisterContainer(cur.Spec.Containers, want.Spec.Containers) {
+		changed = true
+	}
+	if updateContainerLifecycles(cur.Spec.Containers, want.Spec.Containers) {
+		changed = true
+	}
+	if updatePodTemplateVolumes(cur, want) {
+		changed = true
+	}
+	if updateInitContainers(cur, want) {
+		changed = true
+	}
+	if updateSharePathEnv(cur.Spec.Containers, want.Spec.Containers) {
+		changed = true
+	}
+	if updateContainerEnv(cur.Spec.Containers, want.Spec.Containers) {
+		changed = true
+	}
+	if updateContainerArgs(cur.Spec.Containers, want.Spec.Containers) {
+		changed = true
+	}
+	if updateContainerPorts(cur.Spec.Containers, want.Spec.Containers) {
+		changed = true
+	}
+	if updateContainerProbes(cur.Spec.Containers, want.Spec.Containers) {
+		changed = true
+	}
+	if updateContainerResources(cur.Spec.Containers, want.Spec.Containers) {
+		changed = true
+	}
+	seccomp := want.Annotations[corev1.SeccompPodAnnotationKey]
+	if cur.Annotations[corev1.SeccompPodAnnotationKey] != seccomp {
+		if cur.Annotations == nil {
+			cur.Annotations = map[string]string{}
+		}
+		cur.Annotations[corev1.SeccompPodAnnotationKey] = seccomp
+		changed = true
+	}
+	if updateSecurityConfigHash(cur, want) {
+		changed = true
+	}
+	if updateTemplateAnnotation(cur, want, serverConfigHashKey) {
+		changed = true
+	}
+	if updateTemplateAnnotation(cur, want, networksAnnotationKey) {
+		changed = true
+	}
+	if updateTemplateAnnotation(cur, want, localGroupsAnnotationKey) {
+		changed = true
+	}
+	return changed
+}
+
+// updateSecurityConfigHash copies the digest of the SmbSecurityConfig from
+// the desired pod template into the current one. A changed digest rolls the
+// pods, following the strategy of the deployment, so that the new pods
+// join the domain with the new settings while the old pods keep serving
+// until the new ones are ready. It returns true if the current template was
+// changed.
+func updateSecurityConfigHash(cur, want *corev1.PodTemplateSpec) bool {
+	return updateTemplateAnnotation(cur, want, securityConfigHashKey)
+}
+
+// updateTemplateAnnotation copies the annotation of the given key from the
+// desired pod template into the current one, removing it if the desired
+// template does not have it. It returns true if the current template was
+// changed.
+func updateTemplateAnnotation(cur, want *corev1.PodTemplateSpec, key string) bool {
+	value, found := want.Annotations[key]
+	curValue, curFound := cur.Annotations[key]
+	if value == curValue && found == curFound {
+		return false
+	}
+	if !found {
+		delete(cur.Annotations, key)
+		return true
+	}
+	if cur.Annotations == nil {
+		cur.Annotations = map[string]string{}
+	}
+	cur.Annotations[key] = value
+	return true
+}
+
+// updatePodTemplateVolumes replaces the volumes, volume mounts and init
+// containers of the current pod template with the desired ones when the
+// shares served by the pods or the extra mounts differ, as happens when the
+// membership of a server group changes. It returns true if the current
+// template was changed.
+func updatePodTemplateVolumes(cur, want *corev1.PodTemplateSpec) bool {
+	if equality.Semantic.DeepEqual(
+		claimVolumes(cur.Spec.Volumes), claimVolumes(want.Spec.Volumes)) &&
+		equality.Semantic.DeepEqual(
+			extraVolumes(cur.Spec.Volumes), extraVolumes(want.Spec.Volumes)) &&
+		equality.Semantic.DeepEqual(
+			mountPaths(cur.Spec.Containers), mountPaths(want.Spec.Containers)) {
+		// ---
+		return false
+	}
+	cur.Spec.Volumes = want.Spec.Volumes
+	cur.Spec.InitContainers = want.Spec.InitContainers
+	for i := range cur.Spec.Containers {
+		for j := range want.Spec.Containers {
+			if cur.Spec.Containers[i].Name == want.Spec.Containers[j].Name {
+				cur.Spec.Containers[i].VolumeMounts =
+					want.Spec.Containers[j].VolumeMounts
+			}
+		}
+	}
+	return true
+}
+
+// updateInitContainers replaces the init containers of the current pod
+// template with the desired ones when they differ in name or command, as
+// happens when a share starts or stops requesting the permissions of its
+// directory to be set. It returns true if the current template was changed.
+func updateInitContainers(cur, want *corev1.PodTemplateSpec) bool {
+	if equality.Semantic.DeepEqual(
+		containerCommands(cur.Spec.InitContainers),
+		containerCommands(want.Spec.InitContainers)) {
+		// ---
+		return false
+	}
+	cur.Spec.InitContainers = want.Spec.InitContainers
+	return true
+}
+
+// updateContainerSet replaces the containers of the current pod template with
+// the desired ones when they differ in name, as happens when the security
+// mode of a share changes and the winbind container is added or removed. It
+// returns true if the current template was changed.
+func updateContainerSet(cur, want *corev1.PodTemplateSpec) bool {
+	if equality.Semantic.DeepEqual(
+		containerNames(cur.Spec.Containers),
+		containerNames(want.Spec.Containers)) &&
+		equality.Semantic.DeepEqual(
+			cur.Spec.ShareProcessNamespace, want.Spec.ShareProcessNamespace) {
+		// ---
+		return false
+	}
+	cur.Spec.Containers = want.Spec.Containers
+	cur.Spec.ShareProcessNamespace = want.Spec.ShareProcessNamespace
+	return true
+}
+
+// containerNames returns the names of the containers, in order.
+func containerNames(containers []corev1.Container) []string {
+	names := []string{}
+	for _, c := range containers {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// updateSharePathEnv replaces the environment of the current containers
+// with the desired one when the variables giving the paths of the shares to
+// a custom smb.conf, the debug level of samba, or the container config
+// files, differ. Other variables
+// may be subject to API defaulting and are not compared. It returns true if
+// a container was changed.
+func updateSharePathEnv(cur, want []corev1.Container) bool {
+	changed := false
+	for i := range cur {
+		for j := range want {
+			if cur[i].Name != want[j].Name {
+				continue
+			}
+			if !equality.Semantic.DeepEqual(
+				sharePathEnv(cur[i].Env), sharePathEnv(want[j].Env)) ||
+				envValue(cur[i].Env, debugLevelEnv) !=
+					envValue(want[j].Env, debugLevelEnv) ||
+				envValue(cur[i].Env, containerConfigEnv) !=
+					envValue(want[j].Env, containerConfigEnv) {
+				// ---
+				cur[i].Env = want[j].Env
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// updateContainerEnv copies the environment of the desired containers to
+// the current containers of the same name, if the variables with plain
+// values, such as the extra variables of the common config, differ. It
+// returns true if a current container was changed.
+func updateContainerEnv(cur, want []corev1.Container) bool {
+	changed := false
+	for i := range cur {
+		for j := range want {
+			if cur[i].Name != want[j].Name {
+				continue
+			}
+			if !equality.Semantic.DeepEqual(
+				plainEnv(cur[i].Env), plainEnv(want[j].Env)) {
+				// ---
+				cur[i].Env = want[j].Env
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// plainEnv maps the names of the variables with plain values to their
+// values. The sources of the other variables are subject to API defaulting
+// and are not compared.
+func plainEnv(env []corev1.EnvVar) map[string]string {
+	values := map[string]string{}
+	for _, e := range env {
+		if e.ValueFrom == nil {
+			values[e.Name] = e.Value
+		}
+	}
+	return values
+}
+
+// updateContainerArgs copies the arguments of the desired containers, which
+// include the container arguments of the common config, to the current
+// containers of the same name. It returns true if a current container was
+// changed.
+func updateContainerArgs(cur, want []corev1.Container) bool {
+	changed := false
+	for i := range cur {
+		for j := range want {
+			if cur[i].Name != want[j].Name {
+				continue
+			}
+			if !equality.Semantic.DeepEqual(cur[i].Args, want[j].Args) {
+				cur[i].Args = want[j].Args
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// envValue returns the value of the named variable, or an empty string if
+// it is not set.
+func envValue(env []corev1.EnvVar, name string) string {
+	for _, e := range env {
+		if e.Name == name {
+			return e.Value
+		}
+	}
+	return ""
+}
+
+// sharePathEnv maps the names of the variables giving the paths of the
+// shares to their values.
+func sharePathEnv(env []corev1.EnvVar) map[string]string {
+	paths := map[string]string{}
+	for _, e := range env {
+		if strings.HasPrefix(e.Name, sharePathEnvPrefix) {
+			paths[e.Name] = e.Value
+		}
+	}
+	return paths
+}
+
+// containerCommands maps the names of the containers to their commands.
+func containerCommands(containers []corev1.Container) map[string][]string {
+	commands := map[string][]string{}
+	for _, c := range containers {
+		commands[c.Name] = c.Command
+	}
+	return commands
+}
+
+// claimVolumes maps the names of the PVC backed volumes to the names of
+// their claims. Other volume sources are subject to API defaulting and are
+// not compared.
+func claimVolumes(volumes []corev1.Volume) map[string]string {
+	claims := map[string]string{}
+	for _, v := range volumes {
+		if v.PersistentVolumeClaim != nil {
+			claims[v.Name] = v.PersistentVolumeClaim.ClaimName
+		}
+	}
+	return claims
+}
+
+// extraVolumes maps the names of the volumes of extra mounts, of the custom
+// smb.conf and of the TSIG key, to the names of their ConfigMaps or Secrets,
+// the name of the volume collecting core dumps to its size limit, and the
+// name of the volume of the local groups to its source.
+func extraVolumes(volumes []corev1.Volume) map[string]string {
+	sources := map[string]string{}
+	for _, v := range volumes {
+		if !strings.HasPrefix(v.Name, extraVolumePrefix) &&
+			v.Name != customConfigVolName && v.Name != coresVolName &&
+			v.Name != dnsTSIGKeyVolName && v.Name != localGroupsVolName {
+			// ---
+			continue
+		}
+		switch {
+		case v.ConfigMap != nil:
+			sources[v.Name] = "configmap/" + v.ConfigMap.Name
+		case v.Secret != nil:
+			sources[v.Name] = "secret/" + v.Secret.SecretName
+		case v.EmptyDir != nil && v.EmptyDir.SizeLimit != nil:
+			sources[v.Name] = "emptydir/" + v.EmptyDir.SizeLimit.String()
+		case v.DownwardAPI != nil:
+			sources[v.Name] = "downwardapi"
+		}
+	}
+	return sources
+}
+
+// mountPaths maps the names of the containers to the paths their volumes
+// are mounted on.
+func mountPaths(containers []corev1.Container) map[string]map[string]string {
+	paths := map[string]map[string]string{}
+	for _, c := range containers {
+		paths[c.Name] = map[string]string{}
+		for _, vm := range c.VolumeMounts {
+			paths[c.Name][vm.Name] = vm.MountPath
+		}
+	}
+	return paths
+}
+
+// updateDeploymentStrategy copies the update strategy from the desired
+// deployment into the current deployment. Values left unset in the desired
+// deployment, and thus defaulted by Kubernetes, are not changed. It returns
+// true if the current deployment was changed.
+func updateDeploymentStrategy(current, desired *appsv1.Deployment) bool {
+	cur := &current.Spec.Strategy
+	want := desired.Spec.Strategy
+	if want.Type == "" {
+		return false
+	}
+	changed := false
+	if cur.Type != want.Type {
+		cur.Type = want.Type
+		changed = true
+	}
+	if want.Type == appsv1.RecreateDeploymentStrategyType {
+		if cur.RollingUpdate != nil {
+			cur.RollingUpdate = nil
+			changed = true
+		}
+		return changed
+	}
+	if want.RollingUpdate == nil {
+		return changed
+	}
+	if cur.RollingUpdate == nil {
+		cur.RollingUpdate = &appsv1.RollingUpdateDeployment{}
+	}
+	ru := want.RollingUpdate
+	if ru.MaxUnavailable != nil &&
+		!equality.Semantic.DeepEqual(cur.RollingUpdate.MaxUnavailable, ru.MaxUnavailable) {
+		// ---
+		cur.RollingUpdate.MaxUnavailable = ru.MaxUnavailable
+		changed = true
+	}
+	if ru.MaxSurge != nil &&
+		!equality.Semantic.DeepEqual(cur.RollingUpdate.MaxSurge, ru.MaxSurge) {
+		// ---
+		cur.RollingUpdate.MaxSurge = ru.MaxSurge
+		changed = true
+	}
+	return changed
+}
+
+// updateContainerImages sets the image of each current container to the
+// image of the desired container with the same name.
+func updateContainerImages(current, desired []corev1.Container) bool {
+	changed := false
+	for i := range current {
+		for _, d := range desired {
+			if current[i].Name == d.Name && current[i].Image != d.Image {
+				current[i].Image = d.Image
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// updateDNSRegisterContainer copies the arguments of the desired
+// dns-register container, which select the DNS records that are
+// registered, to the current container. It returns true if the current
+// container was changed.
+func updateDNSRegisterContainer(current, desired []corev1.Container) bool {
+	changed := false
+	for i := range current {
+		if current[i].Name != dnsRegisterContainerName {
+			continue
+		}
+		for _, d := range desired {
+			if d.Name != current[i].Name {
+				continue
+			}
+			if !equality.Semantic.DeepEqual(current[i].Args, d.Args) {
+				current[i].Args = d.Args
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// updateContainerPorts copies the ports of the desired containers to the
+// current containers of the same name. It returns true if a current
+// container was changed.
+func updateContainerPorts(current, desired []corev1.Container) bool {
+	changed := false
+	for i := range current {
+		cur := &current[i]
+		for _, d := range desired {
+			if cur.Name != d.Name {
+				continue
+			}
+			if !equality.Semantic.DeepEqual(
+				containerPortNumbers(cur.Ports), containerPortNumbers(d.Ports)) {
+				// ---
+				cur.Ports = d.Ports
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// updateContainerProbes copies the startup, liveness and readiness probes
+// of the desired containers to the current containers of the same name. The
+// probes of the operator set all of their timings, so they compare equal to
+// the probes read back from the API server. It returns true if a current
+// container was changed.
+func updateContainerProbes(current, desired []corev1.Container) bool {
+	changed := false
+	for i := range current {
+		cur := &current[i]
+		for _, d := range desired {
+			if cur.Name != d.Name {
+				continue
+			}
+			probes := []struct{ cur, want **corev1.Probe }{
+				{&cur.StartupProbe, &d.StartupProbe},
+				{&cur.LivenessProbe, &d.LivenessProbe},
+				{&cur.ReadinessProbe, &d.ReadinessProbe},
+			}
+			for _, p := range probes {
+				if !equality.Semantic.DeepEqual(*p.cur, *p.want) {
+					*p.cur = *p.want
+					changed = true
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// updateContainerResources copies the compute resources of the desired
+// containers to the current containers of the same name. It returns true
+// if a current container was changed.
+func updateContainerResources(current, desired []corev1.Container) bool {
+	changed := false
+	for i := range current {
+		for _, d := range desired {
+			if current[i].Name != d.Name {
+				continue
+			}
+			if !equality.Semantic.DeepEqual(current[i].Resources, d.Resources) {
+				current[i].Resources = d.Resources
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// containerPortNumbers maps the names of the ports to their numbers. The
+// protocols of the ports are subject to API defaulting and are not
+// included.
+func containerPortNumbers(ports []corev1.ContainerPort) map[string]int32 {
+	numbers := map[string]int32{}
+	for _, p := range ports {
+		numbers[p.Name] = p.ContainerPort
+	}
+	return numbers
+}
+
+// updateContainerLifecycles copies the lifecycle hooks of the desired
+// containers to the current containers of the same name. It returns true
+// if a current container was changed.
+func updateContainerLifecycles(current, desired []corev1.Container) bool {
+	changed := false
+	for i := range current {
+		for _, d := range desired {
+			if current[i].Name != d.Name {
+				continue
+			}
+			if !equality.Semantic.DeepEqual(current[i].Lifecycle, d.Lifecycle) {
+				current[i].Lifecycle = d.Lifecycle
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
 // labelsForSmbServer returns the labels for selecting the resources
 // belonging to the given CR name.
 func labelsForSmbServer(name string) map[string]string {
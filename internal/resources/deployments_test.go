@@ -0,0 +1,553 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func testPlanner(
+	share *sambaoperatorv1alpha1.SmbShare,
+	common *sambaoperatorv1alpha1.SmbCommonConfig) *sharePlanner {
+	// ---
+	if share.Name == "" {
+		share.Name = "myshare"
+	}
+	share.Status.ServerGroup = share.Name
+	return newSharePlanner(
+		InstanceConfiguration{
+			SmbShare:     share,
+			CommonConfig: common,
+			GlobalConfig: &conf.OperatorConfig{},
+		},
+		&smbcc.SambaContainerConfig{})
+}
+
+func TestBuildDeploymentScheduling(t *testing.T) {
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{
+		Spec: sambaoperatorv1alpha1.SmbCommonConfigSpec{
+			PodSettings: &sambaoperatorv1alpha1.SmbCommonPodSettings{
+				SmbPodSchedulingSettings: sambaoperatorv1alpha1.SmbPodSchedulingSettings{
+					NodeSelector: map[string]string{"storage": "yes"},
+					Tolerations: []corev1.Toleration{{
+						Key:      "storage",
+						Operator: corev1.TolerationOpExists,
+						Effect:   corev1.TaintEffectNoSchedule,
+					}},
+				},
+			},
+		},
+	}
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, common)
+	dep := buildDeployment(&conf.OperatorConfig{}, planner, "mypvc", "default")
+	podSpec := dep.Spec.Template.Spec
+	assert.Equal(t, map[string]string{"storage": "yes"}, podSpec.NodeSelector)
+	assert.Len(t, podSpec.Tolerations, 1)
+	assert.Nil(t, podSpec.Affinity)
+
+	// share overrides the node selector only
+	share.Spec.PodSettings = &sambaoperatorv1alpha1.SmbSharePodSettings{
+		SmbPodSchedulingSettings: sambaoperatorv1alpha1.SmbPodSchedulingSettings{
+			NodeSelector: map[string]string{"zone": "a"},
+		},
+	}
+	dep = buildDeployment(&conf.OperatorConfig{}, planner, "mypvc", "default")
+	podSpec = dep.Spec.Template.Spec
+	assert.Equal(t, map[string]string{"zone": "a"}, podSpec.NodeSelector)
+	assert.Len(t, podSpec.Tolerations, 1)
+}
+
+func TestBuildDeploymentArchitectures(t *testing.T) {
+	archTerms := func(dep *appsv1.Deployment) []corev1.NodeSelectorTerm {
+		affinity := dep.Spec.Template.Spec.Affinity
+		if affinity == nil || affinity.NodeAffinity == nil ||
+			affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+			// ---
+			return nil
+		}
+		return affinity.NodeAffinity.
+			RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	}
+	archReq := func(archs ...string) corev1.NodeSelectorRequirement {
+		return corev1.NodeSelectorRequirement{
+			Key:      "kubernetes.io/arch",
+			Operator: corev1.NodeSelectorOpIn,
+			Values:   archs,
+		}
+	}
+	cfg := &conf.OperatorConfig{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, common)
+
+	// no constraint without supported architectures
+	dep := buildDeployment(cfg, planner, "mypvc", "default")
+	assert.Nil(t, dep.Spec.Template.Spec.Affinity)
+
+	// the operator's default
+	planner.GlobalConfig.SupportedArchitectures = "amd64, arm64"
+	dep = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.Equal(t,
+		[]corev1.NodeSelectorTerm{{
+			MatchExpressions: []corev1.NodeSelectorRequirement{
+				archReq("amd64", "arm64"),
+			},
+		}},
+		archTerms(dep))
+
+	// the common config overrides the default and its affinity is kept
+	zoneReq := corev1.NodeSelectorRequirement{
+		Key:      "zone",
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{"a"},
+	}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		SmbPodSchedulingSettings: sambaoperatorv1alpha1.SmbPodSchedulingSettings{
+			SupportedArchitectures: []string{"amd64"},
+			Affinity: &corev1.Affinity{
+				NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{
+							{MatchExpressions: []corev1.NodeSelectorRequirement{zoneReq}},
+							{MatchExpressions: []corev1.NodeSelectorRequirement{
+								archReq("ppc64le"),
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+	dep = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.Equal(t,
+		[]corev1.NodeSelectorTerm{
+			{MatchExpressions: []corev1.NodeSelectorRequirement{
+				zoneReq, archReq("amd64"),
+			}},
+			// terms that name an architecture are left alone
+			{MatchExpressions: []corev1.NodeSelectorRequirement{
+				archReq("ppc64le"),
+			}},
+		},
+		archTerms(dep))
+	// the affinity of the common config is not modified
+	assert.Len(t,
+		common.Spec.PodSettings.Affinity.NodeAffinity.
+			RequiredDuringSchedulingIgnoredDuringExecution.
+			NodeSelectorTerms[0].MatchExpressions, 1)
+
+	// the share overrides the common config
+	share.Spec.PodSettings = &sambaoperatorv1alpha1.SmbSharePodSettings{
+		SmbPodSchedulingSettings: sambaoperatorv1alpha1.SmbPodSchedulingSettings{
+			SupportedArchitectures: []string{"arm64"},
+		},
+	}
+	dep = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.Equal(t,
+		[]corev1.NodeSelectorRequirement{zoneReq, archReq("arm64")},
+		archTerms(dep)[0].MatchExpressions)
+}
+
+func TestUpdatePodTemplateSettings(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	current := buildDeployment(
+		&conf.OperatorConfig{}, planner, "mypvc", "default")
+
+	desired := current.DeepCopy()
+	assert.False(t, updatePodTemplateSettings(current, desired))
+
+	desired.Spec.Template.Spec.NodeSelector = map[string]string{"zone": "b"}
+	desired.Spec.Template.Spec.Affinity = &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+				Weight: 1,
+				PodAffinityTerm: corev1.PodAffinityTerm{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "samba"},
+					},
+					TopologyKey: "kubernetes.io/hostname",
+				},
+			}},
+		},
+	}
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t,
+		map[string]string{"zone": "b"},
+		current.Spec.Template.Spec.NodeSelector)
+	assert.NotNil(t, current.Spec.Template.Spec.Affinity)
+	assert.False(t, updatePodTemplateSettings(current, desired))
+}
+
+func TestBuildDeploymentImageOverride(t *testing.T) {
+	cfg := &conf.OperatorConfig{
+		SmbdContainerImage:     "quay.io/samba.org/samba-server:latest",
+		SvcWatchContainerImage: "quay.io/samba.org/svcwatch:latest",
+	}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{
+		Spec: sambaoperatorv1alpha1.SmbCommonConfigSpec{
+			Images: &sambaoperatorv1alpha1.SmbCommonImages{
+				Samba: &sambaoperatorv1alpha1.SmbContainerImage{
+					Repository: "registry.example.com/samba-server",
+					Tag:        "v1",
+				},
+			},
+			PodSettings: &sambaoperatorv1alpha1.SmbCommonPodSettings{
+				ImagePullSecrets: []corev1.LocalObjectReference{
+					{Name: "regcred"},
+				},
+			},
+		},
+	}
+	planner := testPlanner(&sambaoperatorv1alpha1.SmbShare{}, common)
+	planner.GlobalConfig = cfg
+	dep := buildDeployment(cfg, planner, "mypvc", "default")
+	podSpec := dep.Spec.Template.Spec
+	if assert.Len(t, podSpec.Containers, 1) {
+		assert.Equal(t,
+			"registry.example.com/samba-server:v1",
+			podSpec.Containers[0].Image)
+	}
+	assert.Equal(t,
+		[]corev1.LocalObjectReference{{Name: "regcred"}},
+		podSpec.ImagePullSecrets)
+
+	// changing the image override updates the existing deployment
+	common.Spec.Images.Samba.Tag = "v2"
+	desired := buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(dep, desired))
+	assert.Equal(t,
+		"registry.example.com/samba-server:v2",
+		dep.Spec.Template.Spec.Containers[0].Image)
+}
+
+func TestBuildDeploymentStrategy(t *testing.T) {
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, common)
+	dep := buildDeployment(&conf.OperatorConfig{}, planner, "mypvc", "default")
+	assert.Equal(t, appsv1.DeploymentStrategy{}, dep.Spec.Strategy)
+
+	common.Spec.UpdateStrategy = &sambaoperatorv1alpha1.SmbUpdateStrategy{
+		Type: "Recreate",
+	}
+	dep = buildDeployment(&conf.OperatorConfig{}, planner, "mypvc", "default")
+	assert.Equal(t,
+		appsv1.RecreateDeploymentStrategyType, dep.Spec.Strategy.Type)
+	assert.Nil(t, dep.Spec.Strategy.RollingUpdate)
+
+	zero := intstr.FromInt(0)
+	common.Spec.UpdateStrategy = &sambaoperatorv1alpha1.SmbUpdateStrategy{
+		MaxUnavailable: &zero,
+	}
+	dep = buildDeployment(&conf.OperatorConfig{}, planner, "mypvc", "default")
+	assert.Equal(t,
+		appsv1.RollingUpdateDeploymentStrategyType, dep.Spec.Strategy.Type)
+	if assert.NotNil(t, dep.Spec.Strategy.RollingUpdate) {
+		assert.Equal(t, zero, *dep.Spec.Strategy.RollingUpdate.MaxUnavailable)
+		assert.Nil(t, dep.Spec.Strategy.RollingUpdate.MaxSurge)
+	}
+}
+
+func TestUpdateDeploymentStrategy(t *testing.T) {
+	quarter := intstr.FromString("25%")
+	current := &appsv1.Deployment{}
+	current.Spec.Strategy = appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxUnavailable: &quarter,
+			MaxSurge:       &quarter,
+		},
+	}
+	desired := &appsv1.Deployment{}
+	// nothing configured
+	assert.False(t, updateDeploymentStrategy(current, desired))
+
+	// defaulted values are kept
+	one := intstr.FromInt(1)
+	desired.Spec.Strategy = appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxUnavailable: &one,
+		},
+	}
+	assert.True(t, updateDeploymentStrategy(current, desired))
+	assert.Equal(t, one, *current.Spec.Strategy.RollingUpdate.MaxUnavailable)
+	assert.Equal(t, quarter, *current.Spec.Strategy.RollingUpdate.MaxSurge)
+	assert.False(t, updateDeploymentStrategy(current, desired))
+
+	desired.Spec.Strategy = appsv1.DeploymentStrategy{
+		Type: appsv1.RecreateDeploymentStrategyType,
+	}
+	assert.True(t, updateDeploymentStrategy(current, desired))
+	assert.Equal(t,
+		appsv1.RecreateDeploymentStrategyType, current.Spec.Strategy.Type)
+	assert.Nil(t, current.Spec.Strategy.RollingUpdate)
+}
+
+func TestBuildDeploymentPriorityClass(t *testing.T) {
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{
+		Spec: sambaoperatorv1alpha1.SmbCommonConfigSpec{
+			PodSettings: &sambaoperatorv1alpha1.SmbCommonPodSettings{
+				PriorityClassName: "file-servers",
+			},
+		},
+	}
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, common)
+	desired := buildDeployment(&conf.OperatorConfig{}, planner, "mypvc", "default")
+	assert.Equal(t,
+		"file-servers", desired.Spec.Template.Spec.PriorityClassName)
+
+	current := buildDeployment(
+		&conf.OperatorConfig{}, testPlanner(share, nil), "mypvc", "default")
+	assert.Equal(t, "", current.Spec.Template.Spec.PriorityClassName)
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t,
+		"file-servers", current.Spec.Template.Spec.PriorityClassName)
+}
+
+func TestUpdatePodTemplateVolumes(t *testing.T) {
+	one := &sambaoperatorv1alpha1.SmbShare{}
+	one.Name = "one"
+	one.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{}
+	two := sambaoperatorv1alpha1.SmbShare{}
+	two.Name = "two"
+	two.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{}
+	planner := testPlanner(one, nil)
+	current := buildDeployment(
+		&conf.OperatorConfig{}, planner, "one-pvc", "default")
+
+	planner.GroupShares = []sambaoperatorv1alpha1.SmbShare{*one, two}
+	desired := buildDeployment(
+		&conf.OperatorConfig{}, planner, "one-pvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Contains(t,
+		claimVolumes(current.Spec.Template.Spec.Volumes), "two-pvc-smb")
+	assert.Equal(t,
+		desired.Spec.Template.Spec.Containers[0].VolumeMounts,
+		current.Spec.Template.Spec.Containers[0].VolumeMounts)
+	assert.False(t, updatePodTemplateSettings(current, desired))
+}
+
+func TestUpdateDNSRegisterContainer(t *testing.T) {
+	current := []corev1.Container{
+		{Name: "samba", Args: []string{"run", "smbd"}},
+		{Name: "dns-register", Args: []string{"dns-register", "x.json"}},
+	}
+	desired := []corev1.Container{
+		{Name: "samba", Args: []string{"run", "smbd", "--debug"}},
+		{
+			Name: "dns-register",
+			Args: []string{"dns-register", "--alias=a.example.com", "x.json"},
+		},
+	}
+	assert.True(t, updateDNSRegisterContainer(current, desired))
+	assert.Equal(t, desired[1].Args, current[1].Args)
+	// only the dns-register container is updated
+	assert.Equal(t, []string{"run", "smbd"}, current[0].Args)
+	assert.False(t, updateDNSRegisterContainer(current, desired))
+}
+
+func TestUpdateInitContainers(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{}
+	planner := testPlanner(share, nil)
+	current := buildDeployment(
+		&conf.OperatorConfig{}, planner, "myshare-pvc", "default")
+	assert.False(t, updateInitContainers(
+		&current.Spec.Template, &current.Spec.Template))
+
+	share.Spec.Storage.InitPermissions =
+		&sambaoperatorv1alpha1.SmbShareInitPermissionsSpec{UID: 1000, GID: 1000}
+	desired := buildDeployment(
+		&conf.OperatorConfig{}, planner, "myshare-pvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t,
+		desired.Spec.Template.Spec.InitContainers,
+		current.Spec.Template.Spec.InitContainers)
+	assert.False(t, updatePodTemplateSettings(current, desired))
+}
+
+func TestUpdatePodTemplateExtraMounts(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{}
+	planner := testPlanner(share, common)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	current := buildDeployment(cfg, planner, "mypvc", "default")
+
+	common.Spec.PodSettings.ExtraMounts = []sambaoperatorv1alpha1.SmbExtraMount{
+		{Name: "scripts", MountPath: "/opt/scripts", ConfigMap: "scripts"},
+	}
+	desired := buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Contains(t,
+		extraVolumes(current.Spec.Template.Spec.Volumes), "extra-scripts")
+	assert.False(t, updatePodTemplateSettings(current, desired))
+
+	// moving the mount
+	common.Spec.PodSettings.ExtraMounts[0].MountPath = "/opt/bin"
+	desired = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t,
+		desired.Spec.Template.Spec.Containers[0].VolumeMounts,
+		current.Spec.Template.Spec.Containers[0].VolumeMounts)
+}
+
+func TestUpdatePodTemplateCustomConfig(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.UID = "1234"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	current := buildDeployment(cfg, planner, "mypvc", "default")
+
+	common.Spec.CustomConfig = &sambaoperatorv1alpha1.SmbCustomConfig{
+		ConfigMap: "my-smb-conf",
+	}
+	desired := buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t,
+		"configmap/my-smb-conf",
+		extraVolumes(current.Spec.Template.Spec.Volumes)[customConfigVolName])
+	assert.Equal(t,
+		map[string]string{"SAMBA_SHARE_PATH_MYSHARE": "/mnt/1234"},
+		sharePathEnv(current.Spec.Template.Spec.Containers[0].Env))
+	assert.False(t, updatePodTemplateSettings(current, desired))
+
+	// switching to another ConfigMap
+	common.Spec.CustomConfig.ConfigMap = "other-smb-conf"
+	desired = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t,
+		"configmap/other-smb-conf",
+		extraVolumes(current.Spec.Template.Spec.Volumes)[customConfigVolName])
+
+	// moving the share's directory
+	share.Spec.Storage.Path = "data"
+	desired = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t,
+		map[string]string{"SAMBA_SHARE_PATH_MYSHARE": "/mnt/1234/data"},
+		sharePathEnv(current.Spec.Template.Spec.Containers[0].Env))
+}
+
+func TestUpdatePodTemplateSecurityConfig(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	current := buildDeployment(cfg, planner, "mypvc", "default")
+	assert.NotContains(t, current.Spec.Template.Annotations, securityConfigHashKey)
+
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode:  "active-directory",
+			Realm: "domain1.example.com",
+		},
+	}
+	desired := buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	hash := current.Spec.Template.Annotations[securityConfigHashKey]
+	assert.NotEmpty(t, hash)
+	// the winbind container is added along with the join
+	assert.Contains(t, containerNames(current.Spec.Template.Spec.Containers), "wb")
+	assert.False(t, updatePodTemplateSettings(current, desired))
+
+	// a change of the security config rolls the pods
+	planner.SecurityConfig.Spec.Realm = "domain2.example.com"
+	desired = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.NotEqual(t, hash,
+		current.Spec.Template.Annotations[securityConfigHashKey])
+	assert.False(t, updatePodTemplateSettings(current, desired))
+
+	planner.SecurityConfig = nil
+	desired = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.NotContains(t, current.Spec.Template.Annotations, securityConfigHashKey)
+	assert.NotContains(t, containerNames(current.Spec.Template.Spec.Containers), "wb")
+}
+
+func TestUpdatePodTemplateDebug(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	current := buildDeployment(cfg, planner, "mypvc", "default")
+
+	common.Spec.Debug = &sambaoperatorv1alpha1.SmbDebugSpec{LogLevel: "3"}
+	desired := buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t, "3",
+		envValue(current.Spec.Template.Spec.Containers[0].Env, "SAMBA_DEBUG_LEVEL"))
+	assert.False(t, updatePodTemplateSettings(current, desired))
+
+	common.Spec.Debug.CollectCores = true
+	desired = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t,
+		"emptydir/1Gi",
+		extraVolumes(current.Spec.Template.Spec.Volumes)[coresVolName])
+	assert.False(t, updatePodTemplateSettings(current, desired))
+
+	limit := resource.MustParse("2Gi")
+	common.Spec.Debug.CoresSizeLimit = &limit
+	desired = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t,
+		"emptydir/2Gi",
+		extraVolumes(current.Spec.Template.Spec.Volumes)[coresVolName])
+}
+
+func TestUpdatePodTemplateExtraEnv(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{}
+	planner := testPlanner(share, common)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	current := buildDeployment(cfg, planner, "mypvc", "default")
+	assert.False(t, updatePodTemplateSettings(current, current.DeepCopy()))
+
+	common.Spec.PodSettings.ExtraEnv = []sambaoperatorv1alpha1.SmbEnvVar{
+		{Name: "TZ", Value: "Europe/Berlin"},
+	}
+	desired := buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t, "Europe/Berlin",
+		envValue(current.Spec.Template.Spec.Containers[0].Env, "TZ"))
+	assert.False(t, updatePodTemplateSettings(current, desired))
+
+	common.Spec.PodSettings.ContainerArgs = []string{"--debug-delay=5"}
+	desired = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t,
+		[]string{"--debug-delay=5", "run", "smbd"},
+		current.Spec.Template.Spec.Containers[0].Args)
+	assert.False(t, updatePodTemplateSettings(current, desired))
+}
@@ -0,0 +1,65 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newPodDisruptionBudgetForSmb returns a PodDisruptionBudget for the pods
+// of the share or nil if the share does not need one.
+func newPodDisruptionBudgetForSmb(
+	planner *sharePlanner, ns string) *policyv1beta1.PodDisruptionBudget {
+	// ---
+	minAvailable, maxUnavailable := planner.disruptionBudget()
+	if minAvailable == nil && maxUnavailable == nil {
+		return nil
+	}
+	labels := labelsForSmbServer(planner.instanceName())
+	return &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      planner.instanceName(),
+			Namespace: ns,
+			Labels:    labels,
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MinAvailable:   minAvailable,
+			MaxUnavailable: maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+		},
+	}
+}
+
+// updatePodDisruptionBudget copies the availability settings from the
+// desired PodDisruptionBudget into the current one. It returns true if the
+// current PodDisruptionBudget was changed and needs to be updated.
+func updatePodDisruptionBudget(
+	current, desired *policyv1beta1.PodDisruptionBudget) bool {
+	// ---
+	cur := &current.Spec
+	want := &desired.Spec
+	if equality.Semantic.DeepEqual(cur.MinAvailable, want.MinAvailable) &&
+		equality.Semantic.DeepEqual(cur.MaxUnavailable, want.MaxUnavailable) {
+		return false
+	}
+	cur.MinAvailable = want.MinAvailable
+	cur.MaxUnavailable = want.MaxUnavailable
+	return true
+}
@@ -0,0 +1,108 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+func TestPlannerDisruptionBudget(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+
+	// single replica shares have no PDB by default
+	minA, maxU := planner.disruptionBudget()
+	assert.Nil(t, minA)
+	assert.Nil(t, maxU)
+	assert.Nil(t, newPodDisruptionBudgetForSmb(planner, "default"))
+
+	common.Spec.DisruptionBudget = &sambaoperatorv1alpha1.SmbDisruptionBudgetSpec{
+		SingleReplica: true,
+	}
+	minA, maxU = planner.disruptionBudget()
+	assert.Equal(t, intstr.FromInt(1), *minA)
+	assert.Nil(t, maxU)
+
+	pct := intstr.FromString("50%")
+	common.Spec.DisruptionBudget.MaxUnavailable = &pct
+	pdb := newPodDisruptionBudgetForSmb(planner, "default")
+	if assert.NotNil(t, pdb) {
+		assert.Equal(t, "myshare", pdb.Name)
+		assert.Nil(t, pdb.Spec.MinAvailable)
+		assert.Equal(t, pct, *pdb.Spec.MaxUnavailable)
+		assert.Equal(t,
+			labelsForSmbServer("myshare"), pdb.Spec.Selector.MatchLabels)
+	}
+}
+
+func TestUpdatePodDisruptionBudget(t *testing.T) {
+	ctx := context.TODO()
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{
+		Spec: sambaoperatorv1alpha1.SmbCommonConfigSpec{
+			DisruptionBudget: &sambaoperatorv1alpha1.SmbDisruptionBudgetSpec{
+				SingleReplica: true,
+			},
+		},
+	}
+	planner := testPlanner(share, common)
+	m, recorder := newTestManager(share)
+	key := types.NamespacedName{Name: "myshare", Namespace: "default"}
+
+	changed, err := m.updatePodDisruptionBudget(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonCreatedPodDisruptionBudget)
+	pdb := &policyv1beta1.PodDisruptionBudget{}
+	assert.NoError(t, m.client.Get(ctx, key, pdb))
+	assert.Equal(t, intstr.FromInt(1), *pdb.Spec.MinAvailable)
+	if assert.Len(t, pdb.OwnerReferences, 1) {
+		assert.Equal(t, "myshare", pdb.OwnerReferences[0].Name)
+	}
+
+	changed, err = m.updatePodDisruptionBudget(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// settings changes are applied
+	two := intstr.FromInt(2)
+	common.Spec.DisruptionBudget.MinAvailable = &two
+	changed, err = m.updatePodDisruptionBudget(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.NoError(t, m.client.Get(ctx, key, pdb))
+	assert.Equal(t, two, *pdb.Spec.MinAvailable)
+	assert.Contains(t, <-recorder.Events, ReasonUpdatedPodDisruptionBudget)
+
+	// the PDB is removed when no longer wanted
+	common.Spec.DisruptionBudget = nil
+	changed, err = m.updatePodDisruptionBudget(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	err = m.client.Get(ctx, key, pdb)
+	assert.Error(t, err)
+	assert.Contains(t, <-recorder.Events, "Deleting PodDisruptionBudget")
+}
@@ -0,0 +1,186 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// winbindContainerName is the name of the container running winbindd in
+// the pods of domain member shares.
+const winbindContainerName = "wb"
+
+// domainGroups returns the groups the access control lists of the share
+// refer to, as @name or +name, when the share is a domain member: the
+// groups are then domain groups, resolved by winbind.
+func (sp *sharePlanner) domainGroups() []string {
+	if sp.securityMode() != adMode {
+		return nil
+	}
+	groups := referencedGroups(sp.SmbShare)
+	if len(groups) == 0 {
+		return nil
+	}
+	return sortedUnique(groups)
+}
+
+// domainGroupAccess returns true if a share of the server group grants
+// access through domain groups.
+func (sp *sharePlanner) domainGroupAccess() bool {
+	if sp.securityMode() != adMode {
+		return false
+	}
+	shares := sp.groupShares()
+	for i := range shares {
+		if len(referencedGroups(&shares[i])) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// winbindNSSInfo returns the source of the unix attributes of the domain
+// users: the rfc2307 attributes stored in the domain when a domain maps its
+// IDs with the ad backend, as idmapOptions configures, templates
+// otherwise.
+func (sp *sharePlanner) winbindNSSInfo() string {
+	if sp.SecurityConfig != nil {
+		for _, d := range sp.SecurityConfig.Spec.Domains {
+			if d.Backend != "autorid" {
+				return "rfc2307"
+			}
+		}
+	}
+	return "template"
+}
+
+// domainGroupsKey returns the key of the globals section resolving the
+// domain groups granted access to the shares.
+func (sp *sharePlanner) domainGroupsKey() smbcc.Key {
+	return smbcc.Key("domain_groups_" + sp.winbindNSSInfo())
+}
+
+// domainGroupsOptions returns the global options letting winbind resolve
+// the members of the domain groups granted access to the shares. With the
+// default domain, names in the access control lists need no domain prefix,
+// and the unix attributes of the users, including their primary group, are
+// looked up as the ID mapping of their domain does.
+func (sp *sharePlanner) domainGroupsOptions() smbcc.SmbOptions {
+	return smbcc.SmbOptions{
+		smbcc.WinbindUseDefaultDomainParam: smbcc.Yes,
+		smbcc.WinbindNSSInfoParam:          sp.winbindNSSInfo(),
+	}
+}
+
+// GroupResolver looks up domain groups through the winbind daemons of
+// pods.
+type GroupResolver interface {
+	// ResolveGroup returns true if the winbind daemon serving the given
+	// container of the pod resolves the named group.
+	ResolveGroup(
+		ctx context.Context,
+		pod *corev1.Pod,
+		container, name string) (bool, error)
+}
+
+// wbinfoGroups resolves groups by running wbinfo in the winbind container
+// of the pods.
+type wbinfoGroups struct {
+	client kubernetes.Interface
+	config *rest.Config
+}
+
+// NewWbinfoGroups returns a GroupResolver running wbinfo in the pods,
+// through the API server's pod exec subresource.
+func NewWbinfoGroups(
+	client kubernetes.Interface, config *rest.Config) GroupResolver {
+	// ---
+	return &wbinfoGroups{client: client, config: config}
+}
+
+// ResolveGroup implements GroupResolver. wbinfo fails alike for unknown
+// groups and unreachable domains, so its result is printed rather than
+// returned as the exit status, which would be taken for a failure to run
+// the command.
+func (g *wbinfoGroups) ResolveGroup(
+	ctx context.Context,
+	pod *corev1.Pod,
+	container, name string) (bool, error) {
+	// ---
+	out, err := podExec(g.client, g.config, pod, container,
+		"/bin/sh", "-c",
+		`if wbinfo --group-info "$1" >/dev/null; then echo found; fi`,
+		"sh", name)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) == "found", nil
+}
+
+// checkDomainGroups records a warning event on the SmbShare for each domain
+// group of its access control lists that the winbind daemon of a ready
+// server pod can not resolve, as the members of the group are then denied
+// access. Pods that can not be queried are skipped.
+func (m *SmbShareManager) checkDomainGroups(
+	ctx context.Context, planner *sharePlanner, ns string) error {
+	// ---
+	groups := planner.domainGroups()
+	if m.groups == nil || len(groups) == 0 {
+		return nil
+	}
+	pods := &corev1.PodList{}
+	err := m.client.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{
+			svcSelectorKey: labelValue(planner.instanceName()),
+		})
+	if err != nil {
+		m.logger.Error(err, "Failed to list pods", "namespace", ns)
+		return err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || !podReady(pod) {
+			continue
+		}
+		for _, g := range groups {
+			found, err := m.groups.ResolveGroup(
+				ctx, pod, winbindContainerName, g)
+			if err != nil {
+				m.logger.Error(err, "Failed to resolve domain group",
+					"Pod.Namespace", ns, "Pod.Name", pod.Name, "group", g)
+				break
+			}
+			if !found {
+				m.recorder.Eventf(planner.SmbShare,
+					EventWarning,
+					ReasonUnresolvedDomainGroup,
+					"Pod %s: domain group %s can not be resolved, "+
+						"its members are denied access",
+					pod.Name, g)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// domainPlanner returns a planner of a domain member share granting access
+// to the given users and groups.
+func domainPlanner(share *sambaoperatorv1alpha1.SmbShare, validUsers ...string) *sharePlanner {
+	share.Spec.AccessControl = &sambaoperatorv1alpha1.SmbShareAccessControl{
+		ValidUsers: validUsers,
+	}
+	planner := testPlanner(share, nil)
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode:  string(adMode),
+			Realm: "domain1.example.com",
+		},
+	}
+	return planner
+}
+
+func TestPlannerDomainGroups(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := domainPlanner(share, "bwayne", `@DOMAIN1\Domain Users`, "+admins")
+	assert.Equal(t, []string{`DOMAIN1\Domain Users`, "admins"}, planner.domainGroups())
+	assert.True(t, planner.domainGroupAccess())
+	planner.ConfigState = smbcc.New()
+	planner.update()
+	assert.Equal(t, smbcc.SmbOptions{
+		smbcc.WinbindUseDefaultDomainParam: smbcc.Yes,
+		smbcc.WinbindNSSInfoParam:          "template",
+	}, planner.ConfigState.Globals["domain_groups_template"].Options)
+	assert.Contains(t,
+		planner.ConfigState.Configs["myshare"].Globals,
+		smbcc.Key("domain_groups_template"))
+
+	// the unix attributes of the domains mapped by the ad backend are
+	// stored in the domain
+	planner.SecurityConfig.Spec.Domains = []sambaoperatorv1alpha1.SmbSecurityDomainSpec{
+		{Name: "DOMAIN1", Backend: "ad-rfc2307"},
+	}
+	assert.Equal(t, smbcc.Key("domain_groups_rfc2307"), planner.domainGroupsKey())
+	planner.ConfigState = smbcc.New()
+	planner.update()
+	assert.Equal(t, "rfc2307",
+		planner.ConfigState.Globals["domain_groups_rfc2307"].Options[smbcc.WinbindNSSInfoParam])
+	assert.NotContains(t, planner.ConfigState.Globals, smbcc.Key("domain_groups_template"))
+
+	// users are not resolved by winbind
+	planner = domainPlanner(share, "bwayne")
+	assert.Empty(t, planner.domainGroups())
+	assert.False(t, planner.domainGroupAccess())
+	planner.ConfigState = smbcc.New()
+	planner.update()
+	assert.NotContains(t, planner.ConfigState.Globals, smbcc.Key("domain_groups_template"))
+
+	// groups of user security are local groups
+	planner = domainPlanner(share, "@staff")
+	planner.SecurityConfig.Spec.Mode = string(userMode)
+	assert.Empty(t, planner.domainGroups())
+	assert.False(t, planner.domainGroupAccess())
+}
+
+func TestPlannerWinbind(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := domainPlanner(share, "bwayne")
+	planner.ConfigState = smbcc.New()
+	_, err := planner.update()
+	assert.NoError(t, err)
+	smbConf, err := planner.ConfigState.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.NotContains(t, smbConf, "winbind request timeout")
+
+	timeout, clients, conns := int32(120), int32(500), int32(0)
+	planner.SecurityConfig.Spec.Winbind = &sambaoperatorv1alpha1.SmbSecurityWinbindSpec{
+		RequestTimeout:       &timeout,
+		MaxClients:           &clients,
+		MaxDomainConnections: &conns,
+	}
+	planner.ConfigState = smbcc.New()
+	_, err = planner.update()
+	assert.NoError(t, err)
+	smbConf, err = planner.ConfigState.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, smbConf, "\twinbind request timeout = 120\n")
+	assert.Contains(t, smbConf, "\twinbind max clients = 500\n")
+	assert.Contains(t, smbConf, "\twinbind max domain connections = 0\n")
+	assert.True(t, needsRestart(smbcc.WinbindMaxClientsParam))
+
+	// shares with user security run no winbind
+	planner.SecurityConfig.Spec.Mode = string(userMode)
+	planner.ConfigState = smbcc.New()
+	_, err = planner.update()
+	assert.NoError(t, err)
+	smbConf, err = planner.ConfigState.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.NotContains(t, smbConf, "winbind request timeout")
+}
+
+type fakeGroups struct {
+	known map[string]bool
+}
+
+func (f *fakeGroups) ResolveGroup(
+	_ context.Context, pod *corev1.Pod, container, name string) (bool, error) {
+	// ---
+	if pod.Name == "myshare-down" {
+		return false, fmt.Errorf("pod %s not reachable", pod.Name)
+	}
+	if container != winbindContainerName {
+		return false, fmt.Errorf("no container %s", container)
+	}
+	return f.known[name], nil
+}
+
+func TestCheckDomainGroups(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := domainPlanner(share, `@DOMAIN1\Domain Users`, "@missing")
+	pod := func(name string, ready bool) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{svcSelectorKey: "myshare"},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				Conditions: []corev1.PodCondition{{
+					Type:   corev1.PodReady,
+					Status: status,
+				}},
+			},
+		}
+	}
+	m, recorder := newTestManager(share,
+		pod("myshare-a", true), pod("myshare-b", false), pod("myshare-down", true))
+	ctx := context.Background()
+
+	// groups are not checked without a resolver
+	assert.NoError(t, m.checkDomainGroups(ctx, planner, "default"))
+	assert.Len(t, recorder.Events, 0)
+
+	// unready and unreachable pods are skipped
+	m.SetGroupResolver(&fakeGroups{known: map[string]bool{
+		`DOMAIN1\Domain Users`: true,
+	}})
+	assert.NoError(t, m.checkDomainGroups(ctx, planner, "default"))
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonUnresolvedDomainGroup)
+		assert.Contains(t, event, "Pod myshare-a: domain group missing can not be resolved")
+	}
+
+	// users are not looked up
+	planner = domainPlanner(share, "bwayne")
+	assert.NoError(t, m.checkDomainGroups(ctx, planner, "default"))
+	assert.Len(t, recorder.Events, 0)
+}
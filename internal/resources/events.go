@@ -26,4 +26,119 @@ const (
 const (
 	ReasonCreatedPersistentVolumeClaim = "CreatedPersistentVolumeClaim"
 	ReasonCreatedDeployment            = "CreatedDeployment"
+	ReasonCreatedPodDisruptionBudget   = "CreatedPodDisruptionBudget"
+	ReasonCreatedService               = "CreatedService"
+	ReasonCreatedConfigMap             = "CreatedConfigMap"
+	ReasonUpdatedDeployment            = "UpdatedDeployment"
+	ReasonUpdatedService               = "UpdatedService"
+	ReasonUpdatedConfigMap             = "UpdatedConfigMap"
+	ReasonUpdatedPodDisruptionBudget   = "UpdatedPodDisruptionBudget"
+	ReasonInvalidStorageClass          = "InvalidStorageClass"
+	ReasonInvalidAccessMode            = "InvalidAccessMode"
+	ReasonReconciled                   = "Reconciled"
+	ReasonMissingImagePullSecret       = "MissingImagePullSecret"
+	ReasonMissingPriorityClass         = "MissingPriorityClass"
+	ReasonInvalidAccessControl         = "InvalidAccessControl"
+	ReasonDeleting                     = "Deleting"
+	ReasonDeleted                      = "Deleted"
+	ReasonJoinFailed                   = "JoinFailed"
+	ReasonJoined                       = "Joined"
+	ReasonJoinInProgress               = "JoinInProgress"
+	ReasonJoinPending                  = "JoinPending"
+	ReasonInvalidKeytab                = "InvalidKeytab"
+	ReasonInvalidFileMode              = "InvalidFileMode"
+	ReasonXattrsUnsupported            = "XattrsUnsupported"
+	ReasonInvalidServerGroup           = "InvalidServerGroup"
+	ReasonInvalidDNSName               = "InvalidDNSName"
+	ReasonInvalidQuota                 = "InvalidQuota"
+	ReasonQuotaExceeded                = "QuotaExceeded"
+	ReasonRouteUnsupported             = "RouteUnsupported"
+	ReasonIPFamilyUnsupported          = "IPFamilyUnsupported"
+	ReasonInvalidPort                  = "InvalidPort"
+	ReasonInvalidExtraMount            = "InvalidExtraMount"
+	ReasonUnschedulable                = "Unschedulable"
+	ReasonInvalidGuestAccess           = "InvalidGuestAccess"
+	ReasonInvalidFilePattern           = "InvalidFilePattern"
+	ReasonInvalidSymlinks              = "InvalidSymlinks"
+	ReasonWideLinksEnabled             = "WideLinksEnabled"
+	ReasonInvalidForcedID              = "InvalidForcedID"
+	ReasonShareNameInUse               = "ShareNameInUse"
+	ReasonInvalidPath                  = "InvalidPath"
+	ReasonInvalidAuthentication        = "InvalidAuthentication"
+	ReasonWaitingForStorage            = "WaitingForStorage"
+	ReasonInvalidCustomConfig          = "InvalidCustomConfig"
+	ReasonInvalidDNSUpdate             = "InvalidDNSUpdate"
+	ReasonDNSRegistrationFailed        = "DNSRegistrationFailed"
+	ReasonInvalidInterfaces            = "InvalidInterfaces"
+	ReasonDeletionBlocked              = "DeletionBlocked"
+	ReasonInvalidLocalGroups           = "InvalidLocalGroups"
+	ReasonInvalidSmbUser               = "InvalidSmbUser"
+	ReasonCreatedSecret                = "CreatedSecret"
+	ReasonUpdatedSecret                = "UpdatedSecret"
+	ReasonInvalidServerIdentity        = "InvalidServerIdentity"
+	ReasonInvalidMacOS                 = "InvalidMacOS"
+	ReasonSpotlightUnavailable         = "SpotlightUnavailable"
+	ReasonInvalidMaintenance           = "InvalidMaintenance"
+	ReasonScheduledRestart             = "ScheduledRestart"
+	ReasonRestartSkipped               = "RestartSkipped"
+	ReasonInvalidCSISecretVolume       = "InvalidCSISecretVolume"
+	ReasonInvalidHosts                 = "InvalidHosts"
+	ReasonSuspended                    = "Suspended"
+	ReasonResumed                      = "Resumed"
+	ReasonInvalidWorkload              = "InvalidWorkload"
+	ReasonCreatedStatefulSet           = "CreatedStatefulSet"
+	ReasonUpdatedStatefulSet           = "UpdatedStatefulSet"
+	ReasonInvalidStorageBackend        = "InvalidStorageBackend"
+	ReasonUnmanagedResource            = "UnmanagedResource"
+	ReasonAdoptedResource              = "AdoptedResource"
+	ReasonInvalidPassdb                = "InvalidPassdb"
+	ReasonInvalidHandles               = "InvalidHandles"
+	ReasonInvalidShareUsers            = "InvalidShareUsers"
+	ReasonInvalidMSDFS                 = "InvalidMSDFS"
+	ReasonInvalidReadOnlyMount         = "InvalidReadOnlyMount"
+	ReasonInvalidSync                  = "InvalidSync"
+	ReasonCreatedServiceMonitor        = "CreatedServiceMonitor"
+	ReasonUpdatedServiceMonitor        = "UpdatedServiceMonitor"
+	ReasonServiceMonitorUnsupported    = "ServiceMonitorUnsupported"
+	ReasonInvalidUnicodeNormalization  = "InvalidUnicodeNormalization"
+	ReasonInvalidVolumeMode            = "InvalidVolumeMode"
+	ReasonMultiChannelSingleNetwork    = "MultiChannelSingleNetwork"
+	ReasonInvalidCommonLabels          = "InvalidCommonLabels"
+	ReasonUpdatedPersistentVolumeClaim = "UpdatedPersistentVolumeClaim"
+	ReasonInvalidPvcAnnotations        = "InvalidPvcAnnotations"
+	ReasonInvalidSmbConf               = "InvalidSmbConf"
+	ReasonUnresolvedDomainGroup        = "UnresolvedDomainGroup"
+	ReasonPaused                       = "Paused"
+	ReasonUnpaused                     = "Unpaused"
+	ReasonInvalidUsersImport           = "InvalidUsersImport"
+	ReasonImportedUsers                = "ImportedUsers"
+	ReasonInvalidExtraEnv              = "InvalidExtraEnv"
+	ReasonMissingSharePath             = "MissingSharePath"
+	ReasonInvalidJoinSecret            = "InvalidJoinSecret"
+	ReasonJoinCredentialsRejected      = "JoinCredentialsRejected"
+	ReasonInvalidACLs                  = "InvalidACLs"
+	ReasonInvalidDosAttributes         = "InvalidDosAttributes"
+	ReasonInvalidResources             = "InvalidResources"
+	ReasonInvalidSocketOptions         = "InvalidSocketOptions"
+	ReasonImagePull                    = "ImagePull"
+	ReasonJoining                      = "Joining"
+	ReasonStarting                     = "Starting"
+	ReasonStartupTimeout               = "StartupTimeout"
+	ReasonInvalidKrb5Conf              = "InvalidKrb5Conf"
+	ReasonReloadedConfig               = "ReloadedConfig"
+	ReasonConfigReloadFailed           = "ConfigReloadFailed"
+	ReasonInvalidVfsObjects            = "InvalidVfsObjects"
+	ReasonInvalidPerformance           = "InvalidPerformance"
+	ReasonInvalidIDMap                 = "InvalidIDMap"
+	ReasonInvalidName                  = "InvalidName"
+	ReasonSelfTestStarted              = "SelfTestStarted"
+	ReasonSelfTestPassed               = "SelfTestPassed"
+	ReasonSelfTestFailed               = "SelfTestFailed"
+	ReasonSelfTestDisabled             = "SelfTestDisabled"
+	ReasonSelfTestUnsupported          = "SelfTestUnsupported"
+	ReasonHealthCheckPassed            = "HealthCheckPassed"
+	ReasonHealthCheckFailed            = "HealthCheckFailed"
+	ReasonInvalidExtraContainer        = "InvalidExtraContainer"
+	ReasonInvalidAntivirus             = "InvalidAntivirus"
+	ReasonInfectedFiles                = "InfectedFiles"
 )
@@ -0,0 +1,173 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// lastAppliedAnnotationKey is the annotation kubectl records the last
+// applied configuration of a resource in.
+const lastAppliedAnnotationKey = "kubectl.kubernetes.io/last-applied-configuration"
+
+// exportedMetadata are the metadata fields kept by an export. The other
+// fields, such as the uid, resourceVersion and managedFields, are set by
+// the API server.
+var exportedMetadata = map[string]bool{
+	"name":         true,
+	"namespace":    true,
+	"labels":       true,
+	"annotations":  true,
+	"finalizers":   true,
+	"generateName": true,
+}
+
+// exportedKind is a kind of the operator's resources that is exported,
+// and the list its resources are read into.
+type exportedKind struct {
+	kind string
+	list runtime.Object
+}
+
+// exportedKinds returns the kinds of the exported resources, in the order
+// they are exported: the resources shares refer to come first, so that
+// applying an export creates them before the shares.
+func exportedKinds() []exportedKind {
+	return []exportedKind{
+		{"SmbCommonConfig", &sambaoperatorv1alpha1.SmbCommonConfigList{}},
+		{"SmbSecurityConfig", &sambaoperatorv1alpha1.SmbSecurityConfigList{}},
+		{"SmbUser", &sambaoperatorv1alpha1.SmbUserList{}},
+		{"SmbShare", &sambaoperatorv1alpha1.SmbShareList{}},
+	}
+}
+
+// ExportResources returns the SmbCommonConfigs, SmbSecurityConfigs,
+// SmbUsers and SmbShares of the namespace in a form ready to be applied
+// again, such as after committing them to Git: their status and the
+// metadata set by the API server, kubectl and the operator are removed.
+// Resources being deleted are not exported. The resources are returned in
+// the operator's storage version, sorted by kind and name.
+func ExportResources(
+	ctx context.Context,
+	cl rtclient.Reader,
+	ns string) ([]*unstructured.Unstructured, error) {
+	// ---
+	exported := []*unstructured.Unstructured{}
+	for _, ek := range exportedKinds() {
+		if err := cl.List(ctx, ek.list, rtclient.InNamespace(ns)); err != nil {
+			return nil, err
+		}
+		items, err := meta.ExtractList(ek.list)
+		if err != nil {
+			return nil, err
+		}
+		objs := []*unstructured.Unstructured{}
+		for _, item := range items {
+			u, err := exportObject(item, ek.kind)
+			if err != nil {
+				return nil, err
+			} else if u != nil {
+				objs = append(objs, u)
+			}
+		}
+		sort.Slice(objs, func(i, j int) bool {
+			return objs[i].GetName() < objs[j].GetName()
+		})
+		exported = append(exported, objs...)
+	}
+	return exported, nil
+}
+
+// exportObject returns the exported form of the resource, or nil if the
+// resource is being deleted.
+func exportObject(
+	obj runtime.Object, kind string) (*unstructured.Unstructured, error) {
+	// ---
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	if accessor.GetDeletionTimestamp() != nil {
+		return nil, nil
+	}
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: data}
+	u.SetGroupVersionKind(sambaoperatorv1alpha1.GroupVersion.WithKind(kind))
+	unstructured.RemoveNestedField(u.Object, "status")
+	metadata, _, _ := unstructured.NestedMap(u.Object, "metadata")
+	for field := range metadata {
+		if !exportedMetadata[field] {
+			unstructured.RemoveNestedField(u.Object, "metadata", field)
+		}
+	}
+	annotations := u.GetAnnotations()
+	delete(annotations, lastAppliedAnnotationKey)
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(u.Object, "metadata", "annotations")
+	} else {
+		u.SetAnnotations(annotations)
+	}
+	finalizers := []string{}
+	for _, f := range u.GetFinalizers() {
+		if f != shareFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if len(finalizers) == 0 {
+		unstructured.RemoveNestedField(u.Object, "metadata", "finalizers")
+	} else {
+		u.SetFinalizers(finalizers)
+	}
+	return u, nil
+}
+
+// WriteExport writes the resources exported from the namespace to out, as
+// a stream of YAML documents.
+func WriteExport(
+	ctx context.Context,
+	cl rtclient.Reader,
+	ns string,
+	out io.Writer) error {
+	// ---
+	exported, err := ExportResources(ctx, cl, ns)
+	if err != nil {
+		return err
+	}
+	for _, u := range exported {
+		data, err := yaml.Marshal(u.Object)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// liveMeta returns the metadata of a resource as the API server, kubectl
+// and the operator leave it.
+func liveMeta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         "default",
+		UID:               types.UID(name + "-uid"),
+		ResourceVersion:   "42",
+		Generation:        3,
+		CreationTimestamp: metav1.NewTime(time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)),
+		Labels:            map[string]string{"team": "finance"},
+		Annotations: map[string]string{
+			lastAppliedAnnotationKey: `{"kind":"SmbShare"}`,
+		},
+		ManagedFields: []metav1.ManagedFieldsEntry{{
+			Manager:   "kubectl",
+			Operation: metav1.ManagedFieldsOperationApply,
+		}},
+	}
+}
+
+// readExport decodes the resources of an export into typed objects.
+func readExport(
+	t *testing.T, scheme *runtime.Scheme, data []byte) []runtime.Object {
+	// ---
+	t.Helper()
+	objs := []runtime.Object{}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		u := &unstructured.Unstructured{}
+		err := decoder.Decode(&u.Object)
+		if err == io.EOF {
+			return objs
+		}
+		require.NoError(t, err)
+		obj, err := scheme.New(u.GroupVersionKind())
+		require.NoError(t, err)
+		require.NoError(t,
+			runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj))
+		objs = append(objs, obj)
+	}
+}
+
+func TestWriteExport(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{ObjectMeta: liveMeta("myshare")}
+	share.Finalizers = []string{shareFinalizer, "example.com/backup"}
+	share.Spec.ShareName = "Data"
+	share.Spec.Browseable = true
+	share.Spec.SecurityConfig = "mysec"
+	share.Spec.CommonConfig = "mycommon"
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{Name: "data"}
+	share.Status.ServerGroup = "myshare"
+	share.Status.Conditions = []sambaoperatorv1alpha1.Condition{{
+		Type:   "Ready",
+		Reason: "PodsReady",
+	}}
+	security := &sambaoperatorv1alpha1.SmbSecurityConfig{ObjectMeta: liveMeta("mysec")}
+	security.Spec.Mode = "user"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{ObjectMeta: liveMeta("mycommon")}
+	common.Spec.Network.Publish = "external"
+	user := &sambaoperatorv1alpha1.SmbUser{ObjectMeta: liveMeta("alice")}
+	user.Spec.SecurityConfig = "mysec"
+	user.Spec.Password.Secret = "passwords"
+	deleting := &sambaoperatorv1alpha1.SmbShare{ObjectMeta: liveMeta("deleting")}
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	other := &sambaoperatorv1alpha1.SmbShare{ObjectMeta: liveMeta("other")}
+	other.Namespace = "elsewhere"
+	m, _ := newTestManager(share, security, common, user, deleting, other)
+	ctx := context.TODO()
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteExport(ctx, m.client, "default", &buf))
+	export := buf.String()
+	for _, field := range []string{
+		"status", "uid", "resourceVersion", "generation", "creationTimestamp",
+		"managedFields", lastAppliedAnnotationKey, shareFinalizer,
+	} {
+		assert.NotContains(t, export, field)
+	}
+	assert.NotContains(t, export, "name: deleting")
+	assert.NotContains(t, export, "namespace: elsewhere")
+	assert.Contains(t, export, "- example.com/backup\n")
+	assert.Contains(t, export, "team: finance\n")
+
+	// the resources shares refer to come first
+	objs := readExport(t, m.scheme, buf.Bytes())
+	if assert.Len(t, objs, 4) {
+		assert.IsType(t, &sambaoperatorv1alpha1.SmbCommonConfig{}, objs[0])
+		assert.IsType(t, &sambaoperatorv1alpha1.SmbSecurityConfig{}, objs[1])
+		assert.IsType(t, &sambaoperatorv1alpha1.SmbUser{}, objs[2])
+		assert.IsType(t, &sambaoperatorv1alpha1.SmbShare{}, objs[3])
+	}
+
+	// the exported resources are those of the cluster, without their status
+	exportedShare := objs[3].(*sambaoperatorv1alpha1.SmbShare)
+	assert.Equal(t, share.Spec, exportedShare.Spec)
+	assert.Equal(t, share.Labels, exportedShare.Labels)
+	assert.Equal(t, sambaoperatorv1alpha1.SmbShareStatus{}, exportedShare.Status)
+	assert.Equal(t, security.Spec,
+		objs[1].(*sambaoperatorv1alpha1.SmbSecurityConfig).Spec)
+	assert.Equal(t, common.Spec,
+		objs[0].(*sambaoperatorv1alpha1.SmbCommonConfig).Spec)
+	assert.Equal(t, user.Spec, objs[2].(*sambaoperatorv1alpha1.SmbUser).Spec)
+
+	// applying the export to an empty namespace, and exporting it again,
+	// gives the same export
+	applied, _ := newTestManager()
+	for _, obj := range objs {
+		require.NoError(t, applied.client.Create(ctx, obj))
+	}
+	var again bytes.Buffer
+	require.NoError(t, WriteExport(ctx, applied.client, "default", &again))
+	assert.Equal(t, export, again.String())
+
+	buf.Reset()
+	require.NoError(t, WriteExport(ctx, m.client, "empty", &buf))
+	assert.Equal(t, "", buf.String())
+}
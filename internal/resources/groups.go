@@ -0,0 +1,319 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+const (
+	// localGroupsAnnotationKey is the pod template annotation holding the
+	// container config of the local groups of the security config. The
+	// annotation is projected into the pods, and changing it rolls them.
+	localGroupsAnnotationKey = "samba-operator.samba.org/local-groups"
+	// localGroupsVolName is the name of the volume projecting the local
+	// groups annotation.
+	localGroupsVolName = "local-groups"
+)
+
+// localGroups returns the local groups defined by the security config of
+// the share. Local groups are only used with user security.
+func (sp *sharePlanner) localGroups() []sambaoperatorv1alpha1.SmbSecurityLocalGroupSpec {
+	if sp.securityMode() != userMode || !sp.userSecuritySource().Configured {
+		return nil
+	}
+	return sp.SecurityConfig.Spec.Users.Groups
+}
+
+// projectsLocalGroups returns true if the local groups of the security
+// config are projected into the pods. The local groups of security configs
+// using SmbUsers are part of the users secret generated from the SmbUsers.
+func (sp *sharePlanner) projectsLocalGroups() bool {
+	return len(sp.localGroups()) > 0 && !sp.usesSmbUsers()
+}
+
+// localGroupsConfig returns the container config defining the local groups
+// of the security config, or an empty string if they are not projected into
+// the pods.
+func (sp *sharePlanner) localGroupsConfig() string {
+	if !sp.projectsLocalGroups() {
+		return ""
+	}
+	groups := sp.localGroups()
+	entries := make(smbcc.GroupEntries, 0, len(groups))
+	for _, g := range groups {
+		entries = append(entries, smbcc.GroupEntry{
+			Name:    g.Name,
+			Gid:     uint(g.GID),
+			Members: g.Members,
+		})
+	}
+	cc := &smbcc.SambaContainerConfig{
+		SCCVersion: smbcc.New().SCCVersion,
+		Groups:     map[smbcc.Key]smbcc.GroupEntries{smbcc.AllEntriesKey: entries},
+	}
+	// marshaling structs of strings and numbers can not fail
+	data, _ := json.Marshal(cc)
+	return string(data)
+}
+
+func (*sharePlanner) localGroupsConfigFileName() string {
+	return "groups.json"
+}
+
+func (*sharePlanner) localGroupsConfigDir() string {
+	return "/etc/container-groups"
+}
+
+func (sp *sharePlanner) localGroupsConfigPath() string {
+	return path.Join(sp.localGroupsConfigDir(), sp.localGroupsConfigFileName())
+}
+
+func localGroupsVolumeAndMount(planner *sharePlanner) (
+	corev1.Volume, corev1.VolumeMount) {
+	// volume
+	volume := corev1.Volume{
+		Name: localGroupsVolName,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{{
+					Path: planner.localGroupsConfigFileName(),
+					FieldRef: &corev1.ObjectFieldSelector{
+						FieldPath: fmt.Sprintf(
+							"metadata.annotations['%s']",
+							localGroupsAnnotationKey),
+					},
+				}},
+			},
+		},
+	}
+	// mount
+	mount := corev1.VolumeMount{
+		MountPath: planner.localGroupsConfigDir(),
+		Name:      localGroupsVolName,
+		ReadOnly:  true,
+	}
+	return volume, mount
+}
+
+// getUsersConfig returns the container config of the users of the share.
+// The users the operator generates, from SmbUsers or by merging the users
+// of the shares of the server group, are generated rather than read from
+// their secret, so that they can be checked before the secret is written.
+// Nil is returned, without an error, if the share does not use a users
+// secret, or if the secret is missing or can not be parsed: the share's
+// pods wait for the secret and samba reports its errors. The users of a
+// CSI volume are only read by the pods, so nil is returned for them too.
+func (m *SmbShareManager) getUsersConfig(
+	ctx context.Context, planner *sharePlanner, ns string) (
+	*smbcc.SambaContainerConfig, error) {
+	// ---
+	if planner.mergesShareUsers() {
+		return m.generateShareUsersConfig(ctx, planner, ns)
+	}
+	return m.getSecurityConfigUsers(ctx, planner, ns)
+}
+
+// getSecurityConfigUsers returns the container config of the users of the
+// share's security config, or nil as getUsersConfig does.
+func (m *SmbShareManager) getSecurityConfigUsers(
+	ctx context.Context, planner *sharePlanner, ns string) (
+	*smbcc.SambaContainerConfig, error) {
+	// ---
+	uss := planner.securityConfigUserSource()
+	if planner.securityMode() != userMode || !uss.Configured ||
+		uss.CSIVolume != nil {
+		// ---
+		return nil, nil
+	}
+	if planner.usesSmbUsers() {
+		return m.generateSmbUsersConfig(ctx, planner)
+	}
+	users, _, err := m.getUsersSecretConfig(ctx, ns, uss.Secret, uss.Key)
+	return users, err
+}
+
+// getUsersSecretConfig returns the container config stored in the key of
+// the users secret. Nil is returned if the secret, or its key, is missing,
+// in which case found is false, or if the key can not be parsed.
+func (m *SmbShareManager) getUsersSecretConfig(
+	ctx context.Context, ns, name, key string) (
+	*smbcc.SambaContainerConfig, bool, error) {
+	// ---
+	secret := &corev1.Secret{}
+	err := m.client.Get(
+		ctx, types.NamespacedName{Name: name, Namespace: ns}, secret)
+	if errors.IsNotFound(err) {
+		return nil, false, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get users secret",
+			"Secret.Namespace", ns, "Secret.Name", name)
+		return nil, false, err
+	}
+	data, found := secret.Data[key]
+	if !found {
+		return nil, false, nil
+	}
+	users := &smbcc.SambaContainerConfig{}
+	if err := json.Unmarshal(data, users); err != nil {
+		return nil, true, nil
+	}
+	return users, true, nil
+}
+
+// configUserNames returns the names of the users of the users config.
+func configUserNames(users *smbcc.SambaContainerConfig) map[string]bool {
+	names := map[string]bool{}
+	for _, u := range users.Users[smbcc.AllEntriesKey] {
+		names[u.Name] = true
+	}
+	return names
+}
+
+// configGroupNames returns the names of the groups known to the samba
+// servers: the groups of the users config, the local groups of the
+// security config and the groups each user has of the same name.
+func configGroupNames(
+	planner *sharePlanner, users *smbcc.SambaContainerConfig) map[string]bool {
+	// ---
+	names := configUserNames(users)
+	for _, g := range users.Groups[smbcc.AllEntriesKey] {
+		names[g.Name] = true
+	}
+	for _, g := range planner.localGroups() {
+		names[g.Name] = true
+	}
+	return names
+}
+
+// referencedGroups returns the groups the access control lists of the share
+// refer to, as @name, +name or &name.
+func referencedGroups(s *sambaoperatorv1alpha1.SmbShare) []string {
+	ac := s.Spec.AccessControl
+	if ac == nil {
+		return nil
+	}
+	groups := []string{}
+	lists := [][]string{ac.ValidUsers, ac.InvalidUsers, ac.ReadList, ac.WriteList}
+	for _, l := range lists {
+		for _, n := range l {
+			if g := strings.TrimLeft(n, "@+&"); g != n {
+				groups = append(groups, g)
+			}
+		}
+	}
+	return groups
+}
+
+// validateLocalGroups checks that the local groups of the security config
+// are unique and have users of the users secret as members, and that the
+// groups the share grants access to exist. If not, the Degraded condition
+// is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateLocalGroups(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(ctx, s, ReasonInvalidLocalGroups, msg)
+	}
+	groups := planner.localGroups()
+	seen := map[string]bool{}
+	for _, g := range groups {
+		if !validAccountName(g.Name, userMode) {
+			return degraded(fmt.Sprintf("Invalid local group name: %q", g.Name))
+		}
+		if seen[g.Name] {
+			return degraded(fmt.Sprintf(
+				"Local group %s is defined more than once", g.Name))
+		}
+		seen[g.Name] = true
+	}
+	users, err := m.getUsersConfig(ctx, planner, ns)
+	if err != nil {
+		return false, err
+	} else if users == nil {
+		return true, nil
+	}
+	uss := planner.userSecuritySource()
+	if len(groups) > 0 && !planner.usesSmbUsers() &&
+		len(users.Groups[smbcc.AllEntriesKey]) > 0 {
+		// ---
+		return degraded(fmt.Sprintf(
+			"Groups are defined by both the security config and users secret %s",
+			uss.Secret))
+	}
+	userNames := configUserNames(users)
+	for _, g := range groups {
+		for _, member := range g.Members {
+			if !userNames[member] {
+				return degraded(fmt.Sprintf(
+					"Member %s of local group %s is not a user of users secret %s",
+					member, g.Name, uss.Secret))
+			}
+		}
+	}
+	groupNames := configGroupNames(planner, users)
+	missing := []string{}
+	for _, g := range referencedGroups(s) {
+		if !groupNames[g] {
+			missing = append(missing, g)
+		}
+	}
+	if len(missing) > 0 {
+		return degraded(fmt.Sprintf(
+			"Access control lists refer to unknown groups: %s",
+			strings.Join(sortedUnique(missing), ", ")))
+	}
+	return true, nil
+}
+
+// validateGuestAccount checks that the guest account of the server group
+// is a user of the users config of the share, or samba's default guest
+// account. If not, the Degraded condition is set on the SmbShare and false
+// is returned. Users that are only known to the pods, such as those of a
+// CSI volume, are not checked.
+func (m *SmbShareManager) validateGuestAccount(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	account := planner.guestAccount()
+	if planner.guestAccountKey() == "" || account == defaultGuestAccount {
+		return true, nil
+	}
+	users, err := m.getUsersConfig(ctx, planner, ns)
+	if err != nil {
+		return false, err
+	} else if users == nil {
+		return true, nil
+	}
+	if !configUserNames(users)[account] {
+		return false, m.setDegraded(ctx, planner.SmbShare,
+			ReasonInvalidGuestAccess,
+			fmt.Sprintf("Guest account %s is not a user of users secret %s",
+				account, planner.userSecuritySource().Secret))
+	}
+	return true, nil
+}
@@ -0,0 +1,228 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+)
+
+// localGroupsPlanner returns a planner of a share with user security,
+// whose security config defines the given local groups.
+func localGroupsPlanner(
+	share *sambaoperatorv1alpha1.SmbShare,
+	groups ...sambaoperatorv1alpha1.SmbSecurityLocalGroupSpec) *sharePlanner {
+	// ---
+	planner := testPlanner(share, nil)
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{}
+	planner.SecurityConfig.Spec.Mode = string(userMode)
+	planner.SecurityConfig.Spec.Users = &sambaoperatorv1alpha1.SmbSecurityUsersSpec{
+		Secret: "users",
+		Key:    "demousers",
+		Groups: groups,
+	}
+	return planner
+}
+
+func TestBuildDeploymentLocalGroups(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{}
+	planner := localGroupsPlanner(share)
+	current := buildDeployment(
+		&conf.OperatorConfig{}, planner, "myshare-pvc", "default")
+	assert.NotContains(t,
+		current.Spec.Template.Annotations, localGroupsAnnotationKey)
+	assert.Equal(t,
+		"/etc/container-config/config.json:/etc/container-users/users.json",
+		planner.containerConfigPath())
+
+	planner.SecurityConfig.Spec.Users.Groups = []sambaoperatorv1alpha1.SmbSecurityLocalGroupSpec{{
+		Name:    "staff",
+		GID:     3000,
+		Members: []string{"alice", "bob"},
+	}}
+	desired := buildDeployment(
+		&conf.OperatorConfig{}, planner, "myshare-pvc", "default")
+	assert.Equal(t,
+		`{"samba-container-config":"v0","groups":{"all_entries":`+
+			`[{"name":"staff","gid":3000,"members":["alice","bob"]}]}}`,
+		desired.Spec.Template.Annotations[localGroupsAnnotationKey])
+	smbd := desired.Spec.Template.Spec.Containers[0]
+	assert.Equal(t,
+		"/etc/container-config/config.json:/etc/container-users/users.json:"+
+			"/etc/container-groups/groups.json",
+		envValue(smbd.Env, containerConfigEnv))
+	paths := mountPaths(desired.Spec.Template.Spec.Containers)
+	assert.Equal(t, "/etc/container-groups", paths[smbd.Name][localGroupsVolName])
+
+	// adding groups rolls the pods with the new volume and config path
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t,
+		desired.Spec.Template.Annotations[localGroupsAnnotationKey],
+		current.Spec.Template.Annotations[localGroupsAnnotationKey])
+	assert.Equal(t,
+		envValue(smbd.Env, containerConfigEnv),
+		envValue(current.Spec.Template.Spec.Containers[0].Env, containerConfigEnv))
+	assert.Contains(t,
+		extraVolumes(current.Spec.Template.Spec.Volumes), localGroupsVolName)
+	assert.False(t, updatePodTemplateSettings(current, desired))
+
+	// local groups are not used with domain security
+	planner.SecurityConfig.Spec.Mode = string(adMode)
+	assert.Equal(t, "", planner.localGroupsConfig())
+}
+
+func TestValidateLocalGroups(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	share.Spec.AccessControl = &sambaoperatorv1alpha1.SmbShareAccessControl{
+		ValidUsers: []string{"@staff", "sambauser"},
+	}
+	staff := sambaoperatorv1alpha1.SmbSecurityLocalGroupSpec{
+		Name:    "staff",
+		Members: []string{"alice", "bob"},
+	}
+	planner := localGroupsPlanner(share, staff)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "users", Namespace: "default"},
+		Data: map[string][]byte{
+			"demousers": []byte(`{"samba-container-config": "v0",
+				"users": {"all_entries": [
+					{"name": "sambauser"}, {"name": "alice"}, {"name": "bob"}]}}`),
+		},
+	}
+	ctx := context.TODO()
+
+	// access granted to a local group
+	m, recorder := newTestManager(share, secret)
+	valid, err := m.validateLocalGroups(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+	// users have a group of their own name
+	share.Spec.AccessControl.WriteList = []string{"+alice"}
+	valid, err = m.validateLocalGroups(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share.Spec.AccessControl.WriteList = []string{"@admins", "&ops", "@admins"}
+	valid, err = m.validateLocalGroups(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidLocalGroups)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t,
+			"Access control lists refer to unknown groups: admins, ops",
+			cond.Message)
+	}
+	share.Spec.AccessControl.WriteList = nil
+
+	planner = localGroupsPlanner(share, sambaoperatorv1alpha1.SmbSecurityLocalGroupSpec{
+		Name:    "staff",
+		Members: []string{"alice", "carol"},
+	})
+	m, recorder = newTestManager(share, secret)
+	valid, err = m.validateLocalGroups(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events,
+		"Member carol of local group staff is not a user of users secret users")
+
+	planner = localGroupsPlanner(share, staff, staff)
+	valid, err = m.validateLocalGroups(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events,
+		"Local group staff is defined more than once")
+
+	// groups may not be defined in both places
+	secret.Data["demousers"] = []byte(`{"samba-container-config": "v0",
+		"users": {"all_entries": [{"name": "alice"}, {"name": "bob"}]},
+		"groups": {"all_entries": [{"name": "staff"}]}}`)
+	planner = localGroupsPlanner(share, staff)
+	m, recorder = newTestManager(share, secret)
+	valid, err = m.validateLocalGroups(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidLocalGroups)
+
+	// groups of the users secret are known too
+	planner = localGroupsPlanner(share)
+	share.Spec.AccessControl.ValidUsers = []string{"@staff"}
+	valid, err = m.validateLocalGroups(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	// the pods wait for a missing secret
+	m, _ = newTestManager(share)
+	share.Spec.AccessControl.ValidUsers = []string{"@admins"}
+	valid, err = m.validateLocalGroups(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestValidateGuestAccount(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.GuestAccess = "dropbox"
+	planner := localGroupsPlanner(share)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "users", Namespace: "default"},
+		Data: map[string][]byte{
+			"demousers": []byte(`{"samba-container-config": "v0",
+				"users": {"all_entries": [
+					{"name": "sambauser"}, {"name": "dropper"}]}}`),
+		},
+	}
+	ctx := context.TODO()
+
+	for _, account := range []string{"", "nobody", "dropper"} {
+		share.Spec.GuestAccount = account
+		m, recorder := newTestManager(share, secret)
+		valid, err := m.validateGuestAccount(ctx, planner, "default")
+		assert.NoError(t, err)
+		assert.True(t, valid, account)
+		assert.Len(t, recorder.Events, 0)
+	}
+
+	share.Spec.GuestAccount = "guests"
+	m, recorder := newTestManager(share, secret)
+	valid, err := m.validateGuestAccount(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonInvalidGuestAccess)
+		assert.Contains(t, event,
+			"Guest account guests is not a user of users secret users")
+	}
+
+	// the users are checked once the users secret exists
+	m, _ = newTestManager(share)
+	valid, err = m.validateGuestAccount(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
@@ -0,0 +1,293 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+const (
+	// healthCheckAnnotationKey is the Service annotation telling external
+	// health checks how to probe the server group: "tcp" or "negotiate".
+	healthCheckAnnotationKey = "samba-operator.samba.org/health-check"
+	// healthCheckPortAnnotationKey is the Service annotation holding the
+	// port external health checks probe.
+	healthCheckPortAnnotationKey = "samba-operator.samba.org/health-check-port"
+
+	// healthCheckTCP checks that the SMB port accepts connections.
+	healthCheckTCP = "tcp"
+	// healthCheckNegotiate also checks that the samba server answers an
+	// anonymous SMB2 negotiate request.
+	healthCheckNegotiate = "negotiate"
+
+	// healthProbeTimeout bounds the time a health probe waits for the
+	// samba server to accept the connection and answer.
+	healthProbeTimeout = 5 * time.Second
+)
+
+// healthCheck returns how the health of the share is probed, or an empty
+// string if it has no health check.
+func (sp *sharePlanner) healthCheck() string {
+	hc := sp.SmbShare.Spec.HealthCheck
+	switch {
+	case hc == nil:
+		return ""
+	case hc.Negotiate:
+		return healthCheckNegotiate
+	}
+	return healthCheckTCP
+}
+
+// groupHealthCheck returns how external health checks probe the Service of
+// the server group: with a negotiate request if any share of the group
+// asks for one, or with a TCP connection if any share has a health check.
+// An empty string is returned if no share of the group has a health check.
+func (sp *sharePlanner) groupHealthCheck() string {
+	check := ""
+	shares := sp.groupShares()
+	for i := range shares {
+		hc := shares[i].Spec.HealthCheck
+		switch {
+		case hc == nil:
+		case hc.Negotiate:
+			return healthCheckNegotiate
+		default:
+			check = healthCheckTCP
+		}
+	}
+	return check
+}
+
+// healthCheckAnnotations returns the Service annotations telling external
+// health checks how to probe the server group, or nil if none should.
+func (sp *sharePlanner) healthCheckAnnotations() map[string]string {
+	check := sp.groupHealthCheck()
+	if check == "" {
+		return nil
+	}
+	return map[string]string{
+		healthCheckAnnotationKey:     check,
+		healthCheckPortAnnotationKey: strconv.Itoa(int(sp.smbPort())),
+	}
+}
+
+// HealthProber probes the samba servers of shares, as external health
+// checks do.
+type HealthProber interface {
+	// Probe connects to the samba server at the address, given as
+	// host:port, and, if negotiate is true, checks that it answers an
+	// anonymous SMB2 negotiate request. It returns an error describing
+	// why the server is not reachable.
+	Probe(ctx context.Context, address string, negotiate bool) error
+}
+
+// smbHealthProber probes samba servers over the network.
+type smbHealthProber struct {
+	timeout time.Duration
+}
+
+// NewSMBHealthProber returns a HealthProber connecting to the samba
+// servers from the operator.
+func NewSMBHealthProber() HealthProber {
+	return &smbHealthProber{timeout: healthProbeTimeout}
+}
+
+// Probe implements HealthProber.
+func (p *smbHealthProber) Probe(
+	ctx context.Context, address string, negotiate bool) error {
+	// ---
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if !negotiate {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	if _, err := conn.Write(smb2NegotiateRequest()); err != nil {
+		return fmt.Errorf("failed to send negotiate request: %w", err)
+	}
+	return readNegotiateResponse(conn)
+}
+
+const (
+	// smb2HeaderSize is the size of the header of SMB2 messages.
+	smb2HeaderSize = 64
+	// smb2Negotiate is the command code of SMB2 negotiate messages.
+	smb2Negotiate = 0
+	// smb2MaxResponseSize bounds the size of the negotiate responses read
+	// from the servers.
+	smb2MaxResponseSize = 1 << 16
+)
+
+// smb2ProtocolID starts the header of SMB2 messages.
+var smb2ProtocolID = []byte{0xfe, 'S', 'M', 'B'}
+
+// smb2NegotiateRequest returns an anonymous SMB2 negotiate request offering
+// the SMB 2.0.2 to 3.1.1 dialects, framed as a direct TCP transport
+// message. SMB 3.1.1 requires a preauth integrity context, which is given
+// with an all zero salt.
+func smb2NegotiateRequest() []byte {
+	dialects := []uint16{0x0202, 0x0210, 0x0300, 0x0302, 0x0311}
+	msg := &bytes.Buffer{}
+	le := func(v interface{}) {
+		// writes to a bytes.Buffer can not fail
+		_ = binary.Write(msg, binary.LittleEndian, v)
+	}
+	// header
+	msg.Write(smb2ProtocolID)
+	le(uint16(smb2HeaderSize))  // structure size
+	le(uint16(0))               // credit charge
+	le(uint32(0))               // status
+	le(uint16(smb2Negotiate))   // command
+	le(uint16(1))               // credits requested
+	le(uint32(0))               // flags
+	le(uint32(0))               // next command
+	le(uint64(0))               // message id
+	le(uint32(0))               // reserved
+	le(uint32(0))               // tree id
+	le(uint64(0))               // session id
+	msg.Write(make([]byte, 16)) // signature
+	// negotiate request
+	bodyEnd := smb2HeaderSize + 36 + 2*len(dialects)
+	contextOffset := (bodyEnd + 7) &^ 7
+	le(uint16(36))              // structure size
+	le(uint16(len(dialects)))   // dialect count
+	le(uint16(1))               // security mode: signing enabled
+	le(uint16(0))               // reserved
+	le(uint32(0))               // capabilities
+	msg.Write(make([]byte, 16)) // client guid
+	le(uint32(contextOffset))   // negotiate context offset
+	le(uint16(1))               // negotiate context count
+	le(uint16(0))               // reserved
+	le(dialects)
+	msg.Write(make([]byte, contextOffset-bodyEnd))
+	// preauth integrity context, using SHA-512
+	le(uint16(1))  // context type
+	le(uint16(38)) // data length
+	le(uint32(0))  // reserved
+	le(uint16(1))  // hash algorithm count
+	le(uint16(32)) // salt length
+	le(uint16(1))  // SHA-512
+	msg.Write(make([]byte, 32))
+
+	frame := make([]byte, 4, 4+msg.Len())
+	binary.BigEndian.PutUint32(frame, uint32(msg.Len()))
+	return append(frame, msg.Bytes()...)
+}
+
+// readNegotiateResponse reads the answer of a samba server to a negotiate
+// request and checks that it is a successful SMB2 negotiate response.
+func readNegotiateResponse(r io.Reader) error {
+	frame := make([]byte, 4)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return fmt.Errorf("failed to read negotiate response: %w", err)
+	}
+	size := binary.BigEndian.Uint32(frame)
+	if frame[0] != 0 || size < smb2HeaderSize || size > smb2MaxResponseSize {
+		return errors.New("invalid negotiate response: bad message length")
+	}
+	header := make([]byte, smb2HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("failed to read negotiate response: %w", err)
+	}
+	if !bytes.Equal(header[:4], smb2ProtocolID) {
+		return errors.New("invalid negotiate response: not an SMB2 message")
+	}
+	if cmd := binary.LittleEndian.Uint16(header[12:]); cmd != smb2Negotiate {
+		return fmt.Errorf("invalid negotiate response: command %d", cmd)
+	}
+	if status := binary.LittleEndian.Uint32(header[8:]); status != 0 {
+		return fmt.Errorf("negotiate request failed: status 0x%08x", status)
+	}
+	return nil
+}
+
+// healthCheckAddress returns the address health probes of the share
+// connect to: the port of the Service of its server group.
+func healthCheckAddress(planner *sharePlanner, ns string) string {
+	host := fmt.Sprintf("%s.%s.svc", planner.instanceName(), ns)
+	return net.JoinHostPort(host, strconv.Itoa(int(planner.smbPort())))
+}
+
+// updateHealthStatus probes the Service of the share, if it has a health
+// check, and records the result in the status of the SmbShare. The status
+// is cleared once the health check is removed. Probes are skipped if the
+// operator has no HealthProber or its probes are turned off. Returns true
+// if the status was changed.
+func (m *SmbShareManager) updateHealthStatus(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	check := planner.healthCheck()
+	if check == "" {
+		if s.Status.Health == nil {
+			return false, nil
+		}
+		s.Status.Health = nil
+		return true, m.client.Status().Update(ctx, s)
+	}
+	if m.health == nil || m.cfg.HealthCheckInterval == 0 {
+		return false, nil
+	}
+	health := &sambaoperatorv1alpha1.SmbShareHealthStatus{Reachable: true}
+	err := m.health.Probe(ctx, healthCheckAddress(planner, ns),
+		check == healthCheckNegotiate)
+	if err != nil {
+		health.Reachable = false
+		health.Message = err.Error()
+	}
+	cur := s.Status.Health
+	if cur != nil && cur.Reachable == health.Reachable &&
+		cur.Message == health.Message {
+		// ---
+		return false, nil
+	}
+	if cur != nil && cur.Reachable == health.Reachable {
+		health.LastTransitionTime = cur.LastTransitionTime
+	} else {
+		health.LastTransitionTime = metav1.Now()
+		if health.Reachable {
+			m.recorder.Event(s, EventNormal, ReasonHealthCheckPassed,
+				"Health probe of the share succeeded")
+		} else {
+			m.recorder.Eventf(s, EventWarning, ReasonHealthCheckFailed,
+				"Health probe of the share failed: %s", health.Message)
+		}
+	}
+	s.Status.Health = health
+	return true, m.client.Status().Update(ctx, s)
+}
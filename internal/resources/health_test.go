@@ -0,0 +1,228 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// fakeHealth fails the health probes with err, recording the addresses
+// probed.
+type fakeHealth struct {
+	err       error
+	negotiate bool
+	probed    []string
+}
+
+func (f *fakeHealth) Probe(
+	_ context.Context, address string, negotiate bool) error {
+	// ---
+	f.probed = append(f.probed, address)
+	f.negotiate = negotiate
+	return f.err
+}
+
+// fakeSmbd accepts connections on a local port and answers negotiate
+// requests with an SMB2 response of the given status.
+func fakeSmbd(t *testing.T, status uint32) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				frame := make([]byte, 4)
+				if _, err := io.ReadFull(conn, frame); err != nil {
+					return
+				}
+				req := make([]byte, binary.BigEndian.Uint32(frame))
+				if _, err := io.ReadFull(conn, req); err != nil {
+					return
+				}
+				resp := make([]byte, 4+smb2HeaderSize+65)
+				binary.BigEndian.PutUint32(resp, uint32(len(resp)-4))
+				copy(resp[4:], smb2ProtocolID)
+				binary.LittleEndian.PutUint32(resp[4+8:], status)
+				_, _ = conn.Write(resp)
+			}(conn)
+		}
+	}()
+	return l
+}
+
+func TestSMB2NegotiateRequest(t *testing.T) {
+	req := smb2NegotiateRequest()
+	size := binary.BigEndian.Uint32(req)
+	assert.Equal(t, len(req)-4, int(size))
+	msg := req[4:]
+	assert.Equal(t, smb2ProtocolID, msg[:4])
+	assert.Equal(t, uint16(smb2Negotiate), binary.LittleEndian.Uint16(msg[12:]))
+	body := msg[smb2HeaderSize:]
+	assert.Equal(t, uint16(36), binary.LittleEndian.Uint16(body))
+	assert.Equal(t, uint16(5), binary.LittleEndian.Uint16(body[2:]))
+	// the negotiate context is aligned to 8 bytes
+	offset := binary.LittleEndian.Uint32(body[28:])
+	assert.Equal(t, uint32(0), offset%8)
+	assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(msg[offset:]))
+	assert.Equal(t, int(offset)+8+38, len(msg))
+}
+
+func TestSMBHealthProber(t *testing.T) {
+	ctx := context.TODO()
+	prober := NewSMBHealthProber()
+
+	smbd := fakeSmbd(t, 0)
+	addr := smbd.Addr().String()
+	assert.NoError(t, prober.Probe(ctx, addr, false))
+	assert.NoError(t, prober.Probe(ctx, addr, true))
+
+	// the probes fail once smbd is down
+	require.NoError(t, smbd.Close())
+	assert.Error(t, prober.Probe(ctx, addr, false))
+	assert.Error(t, prober.Probe(ctx, addr, true))
+
+	failing := fakeSmbd(t, 0xc0000022)
+	defer failing.Close()
+	assert.NoError(t, prober.Probe(ctx, failing.Addr().String(), false))
+	err := prober.Probe(ctx, failing.Addr().String(), true)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "status 0xc0000022")
+	}
+
+	// servers that are not samba servers fail the negotiate probe
+	other, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer other.Close()
+	go func() {
+		conn, err := other.Accept()
+		if err == nil {
+			_, _ = conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+			conn.Close()
+		}
+	}()
+	assert.Error(t, prober.Probe(ctx, other.Addr().String(), true))
+}
+
+func TestHealthCheckAnnotations(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	svc := newServiceForSmb(planner, "default")
+	assert.Nil(t, svc.Annotations)
+	assert.Equal(t, "", planner.healthCheck())
+
+	share.Spec.HealthCheck = &sambaoperatorv1alpha1.SmbShareHealthCheckSpec{}
+	svc = newServiceForSmb(planner, "default")
+	assert.Equal(t, map[string]string{
+		healthCheckAnnotationKey:     "tcp",
+		healthCheckPortAnnotationKey: "445",
+	}, svc.Annotations)
+
+	// any share of the group asking for a negotiate request gets one
+	other := share.DeepCopy()
+	other.Name = "other"
+	other.Spec.HealthCheck.Negotiate = true
+	other.Spec.PublishDNSName = "files.example.com"
+	planner.GroupShares = []sambaoperatorv1alpha1.SmbShare{*share, *other}
+	assert.Equal(t, "tcp", planner.healthCheck())
+	desired := newServiceForSmb(planner, "default")
+	assert.Equal(t, "negotiate", desired.Annotations[healthCheckAnnotationKey])
+	assert.Equal(t, "files.example.com",
+		desired.Annotations[externalDNSHostnameKey])
+
+	assert.True(t, updateServiceHealthCheck(svc, desired))
+	assert.Equal(t, "negotiate", svc.Annotations[healthCheckAnnotationKey])
+	assert.False(t, updateServiceHealthCheck(svc, desired))
+	assert.True(t, updateServiceHealthCheck(svc, newServiceForSmb(
+		testPlanner(&sambaoperatorv1alpha1.SmbShare{}, nil), "default")))
+	assert.NotContains(t, svc.Annotations, healthCheckAnnotationKey)
+	assert.NotContains(t, svc.Annotations, healthCheckPortAnnotationKey)
+}
+
+func TestUpdateHealthStatus(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.HealthCheck = &sambaoperatorv1alpha1.SmbShareHealthCheckSpec{
+		Negotiate: true,
+	}
+	planner := testPlanner(share, nil)
+	m, recorder := newTestManager(share)
+	m.cfg.HealthCheckInterval = 1
+	ctx := context.TODO()
+
+	// without a prober the health is not reported
+	changed, err := m.updateHealthStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	health := &fakeHealth{}
+	m.SetHealthProber(health)
+	changed, err = m.updateHealthStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []string{"myshare.default.svc:445"}, health.probed)
+	assert.True(t, health.negotiate)
+	assert.Contains(t, <-recorder.Events, ReasonHealthCheckPassed)
+	found := &sambaoperatorv1alpha1.SmbShare{}
+	key := types.NamespacedName{Namespace: "default", Name: "myshare"}
+	require.NoError(t, m.client.Get(ctx, key, found))
+	if assert.NotNil(t, found.Status.Health) {
+		assert.True(t, found.Status.Health.Reachable)
+		assert.False(t, found.Status.Health.LastTransitionTime.IsZero())
+	}
+
+	changed, err = m.updateHealthStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// smbd going down is reported
+	health.err = errors.New("connection refused")
+	changed, err = m.updateHealthStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonHealthCheckFailed)
+	require.NoError(t, m.client.Get(ctx, key, found))
+	if assert.NotNil(t, found.Status.Health) {
+		assert.False(t, found.Status.Health.Reachable)
+		assert.Equal(t, "connection refused", found.Status.Health.Message)
+	}
+
+	// the status is cleared with the health check
+	share.Spec.HealthCheck = nil
+	changed, err = m.updateHealthStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	found = &sambaoperatorv1alpha1.SmbShare{}
+	require.NoError(t, m.client.Get(ctx, key, found))
+	assert.Nil(t, found.Status.Health)
+	assert.Len(t, health.probed, 3)
+}
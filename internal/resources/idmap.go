@@ -0,0 +1,126 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// idRange is a range of IDs mapped to the users and groups of a domain.
+type idRange struct {
+	domain    string
+	low, high uint64
+}
+
+// parseIDRange parses a range of IDs written as low-high.
+func parseIDRange(domain, s string) (idRange, error) {
+	r := idRange{domain: domain}
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return r, fmt.Errorf("range %q of domain %s is not low-high", s, domain)
+	}
+	var err error
+	r.low, err = strconv.ParseUint(parts[0], 10, 32)
+	if err == nil {
+		r.high, err = strconv.ParseUint(parts[1], 10, 32)
+	}
+	if err != nil {
+		return r, fmt.Errorf("range %q of domain %s is not low-high", s, domain)
+	}
+	if r.low == 0 || r.low >= r.high {
+		return r, fmt.Errorf(
+			"range %q of domain %s must start above 0 and end above its start",
+			s, domain)
+	}
+	return r, nil
+}
+
+// allowTrustedDomains returns true if the users of trusted domains may
+// access the shares of a domain member.
+func (sp *sharePlanner) allowTrustedDomains() bool {
+	return sp.securityMode() == adMode &&
+		sp.SecurityConfig.Spec.AllowTrustedDomains
+}
+
+// mapsTrustedDomains returns true if the ID mapping of the security config
+// gives IDs to the users of trusted domains: the "*" domain does with the
+// autorid backend, which maps all domains, and listed domains other than
+// the domain of the realm do.
+func (sp *sharePlanner) mapsTrustedDomains() bool {
+	for _, d := range sp.idmapDomains() {
+		if d.Name == "*" && d.Backend == "autorid" {
+			return true
+		}
+		if d.Name != "*" && !strings.EqualFold(d.Name, sp.workgroup()) &&
+			!strings.EqualFold(d.Name, sp.realm()) {
+			// ---
+			return true
+		}
+	}
+	return false
+}
+
+// validateIDMap checks that the domains of the ID mapping of a domain
+// member are listed once, with ranges of IDs that do not overlap, and that
+// the users of trusted domains get IDs when trusted domains are allowed.
+// If not, the Degraded condition is set on the SmbShare and false is
+// returned.
+func (m *SmbShareManager) validateIDMap(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	if planner.securityMode() != adMode {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidIDMap, msg)
+	}
+	seen := map[string]bool{}
+	ranges := []idRange{}
+	for _, d := range planner.idmapDomains() {
+		name := strings.ToUpper(d.Name)
+		if seen[name] {
+			return degraded(fmt.Sprintf(
+				"Domain %s is listed more than once", d.Name))
+		}
+		seen[name] = true
+		r, err := parseIDRange(d.Name, d.Range)
+		if err != nil {
+			return degraded("Invalid ID map: " + err.Error())
+		}
+		ranges = append(ranges, r)
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].low < ranges[j].low
+	})
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i].low <= ranges[i-1].high {
+			return degraded(fmt.Sprintf(
+				"ID ranges of domains %s and %s overlap",
+				ranges[i-1].domain, ranges[i].domain))
+		}
+	}
+	if planner.allowTrustedDomains() && !planner.mapsTrustedDomains() {
+		return degraded(
+			"Trusted domains are allowed but no ID range maps them: " +
+				"use the autorid backend for domain * or list the trusted domains")
+	}
+	return true, nil
+}
@@ -0,0 +1,136 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func TestPlannerIDMap(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := domainPlanner(share, "bwayne")
+	assert.Equal(t, smbcc.SmbOptions{
+		"idmap config * : backend": "autorid",
+		"idmap config * : range":   "2000-9999999",
+	}, planner.idmapOptions())
+
+	// listed domains get ranges in order, unless they have their own
+	planner.SecurityConfig.Spec.Domains = []sambaoperatorv1alpha1.SmbSecurityDomainSpec{
+		{Name: "DOMAIN1", Backend: "ad-rfc2307"},
+		{Name: "TRUSTED", Backend: "ad-rfc2307", Range: "100000-199999"},
+	}
+	assert.Equal(t, smbcc.SmbOptions{
+		"idmap config DOMAIN1 : backend":     "ad",
+		"idmap config DOMAIN1 : schema_mode": "rfc2307",
+		"idmap config DOMAIN1 : range":       "2000-11999",
+		"idmap config TRUSTED : backend":     "ad",
+		"idmap config TRUSTED : schema_mode": "rfc2307",
+		"idmap config TRUSTED : range":       "100000-199999",
+		"idmap config * : backend":           "autorid",
+		"idmap config * : range":             "22000-31999",
+	}, planner.idmapOptions())
+
+	opts := planner.realmOptions()
+	assert.NotContains(t, opts, smbcc.AllowTrustedDomainsParam)
+	assert.NotContains(t, opts, smbcc.WinbindScanTrustedDomainsParam)
+	planner.SecurityConfig.Spec.AllowTrustedDomains = true
+	opts = planner.realmOptions()
+	assert.Equal(t, smbcc.Yes, opts[smbcc.AllowTrustedDomainsParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.WinbindScanTrustedDomainsParam])
+	assert.Equal(t, "100000-199999", opts["idmap config TRUSTED : range"])
+	assert.True(t, needsRestart(smbcc.AllowTrustedDomainsParam))
+}
+
+func TestValidateIDMap(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	ctx := context.TODO()
+	check := func(
+		msg string,
+		allow bool,
+		domains ...sambaoperatorv1alpha1.SmbSecurityDomainSpec) {
+		// ---
+		t.Helper()
+		planner := domainPlanner(share, "bwayne")
+		planner.SecurityConfig.Spec.AllowTrustedDomains = allow
+		planner.SecurityConfig.Spec.Domains = domains
+		m, recorder := newTestManager(share)
+		valid, err := m.validateIDMap(ctx, planner)
+		assert.NoError(t, err)
+		if msg == "" {
+			assert.True(t, valid)
+			assert.Len(t, recorder.Events, 0)
+			return
+		}
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidIDMap)
+			assert.Contains(t, event, msg)
+		}
+	}
+	domain1 := sambaoperatorv1alpha1.SmbSecurityDomainSpec{
+		Name: "DOMAIN1", Backend: "ad-rfc2307",
+	}
+	adDefault := sambaoperatorv1alpha1.SmbSecurityDomainSpec{
+		Name: "*", Backend: "ad-rfc2307",
+	}
+	check("", false)
+	check("", true)
+	// the default autorid domain maps the trusted domains
+	check("", true, domain1)
+	check("", false, domain1, adDefault)
+	check("no ID range maps them", true, domain1, adDefault)
+	check("", true, domain1, adDefault,
+		sambaoperatorv1alpha1.SmbSecurityDomainSpec{
+			Name: "TRUSTED", Backend: "ad-rfc2307", Range: "100000-199999",
+		})
+
+	check("Domain domain1 is listed more than once", false, domain1,
+		sambaoperatorv1alpha1.SmbSecurityDomainSpec{
+			Name: "domain1", Backend: "autorid",
+		})
+	check(`range "5000-4000" of domain TRUSTED must start above 0`, false,
+		sambaoperatorv1alpha1.SmbSecurityDomainSpec{
+			Name: "TRUSTED", Backend: "autorid", Range: "5000-4000",
+		})
+	check(`range "1-99999999999" of domain TRUSTED is not low-high`, false,
+		sambaoperatorv1alpha1.SmbSecurityDomainSpec{
+			Name: "TRUSTED", Backend: "autorid", Range: "1-99999999999",
+		})
+	check("ID ranges of domains DOMAIN1 and TRUSTED overlap", false, domain1,
+		sambaoperatorv1alpha1.SmbSecurityDomainSpec{
+			Name: "TRUSTED", Backend: "ad-rfc2307", Range: "10000-19999",
+		})
+
+	// user security has no ID mapping
+	planner := domainPlanner(share, "bwayne")
+	planner.SecurityConfig.Spec.Mode = string(userMode)
+	planner.SecurityConfig.Spec.Domains = []sambaoperatorv1alpha1.SmbSecurityDomainSpec{
+		domain1, domain1,
+	}
+	m, _ := newTestManager(share)
+	valid, err := m.validateIDMap(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
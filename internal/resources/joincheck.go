@@ -0,0 +1,385 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+const (
+	// joinCheckNone leaves the join containers to report failed joins.
+	joinCheckNone = "none"
+	// joinCheckSecret checks the contents of the join secrets.
+	joinCheckSecret = "secret"
+	// joinCheckCredentials checks the contents of the join secrets, and
+	// that a domain controller accepts their credentials.
+	joinCheckCredentials = "credentials"
+)
+
+// joinCheck returns how the join sources of the share are checked.
+func (sp *sharePlanner) joinCheck() string {
+	if sp.securityMode() != adMode {
+		return joinCheckNone
+	}
+	if c := sp.SecurityConfig.Spec.JoinCheck; c != "" {
+		return c
+	}
+	return joinCheckSecret
+}
+
+// joinCredentials are the credentials of a join source, as read by the
+// join containers.
+type joinCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// joinSourceCredentials returns the credentials of the user join source,
+// or a message telling why its secret does not hold valid credentials.
+func (m *SmbShareManager) joinSourceCredentials(
+	ctx context.Context,
+	uj *sambaoperatorv1alpha1.SmbSecurityUserJoinSpec,
+	ns string) (*joinCredentials, string, error) {
+	// ---
+	secret := &corev1.Secret{}
+	err := m.client.Get(
+		ctx, types.NamespacedName{Name: uj.Secret, Namespace: ns}, secret)
+	if errors.IsNotFound(err) {
+		return nil, fmt.Sprintf("Join secret %s not found", uj.Secret), nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get join secret",
+			"Secret.Namespace", ns, "Secret.Name", uj.Secret)
+		return nil, "", err
+	}
+	data, found := secret.Data[uj.Key]
+	if !found {
+		return nil, fmt.Sprintf(
+			"Join secret %s has no key %s", uj.Secret, uj.Key), nil
+	}
+	creds := &joinCredentials{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, fmt.Sprintf(
+			"Key %s of join secret %s is not valid JSON: %v",
+			uj.Key, uj.Secret, err), nil
+	}
+	if creds.Username == "" || creds.Password == "" {
+		return nil, fmt.Sprintf(
+			"Key %s of join secret %s must set a username and a password",
+			uj.Key, uj.Secret), nil
+	}
+	return creds, "", nil
+}
+
+// validateJoinSources checks that the secrets of the join sources of the
+// share's security config hold a username and a password. If not, the
+// Degraded condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateJoinSources(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	if planner.joinCheck() == joinCheckNone {
+		return true, nil
+	}
+	for _, js := range planner.SecurityConfig.Spec.JoinSources {
+		if js.UserJoin == nil {
+			continue
+		}
+		_, msg, err := m.joinSourceCredentials(ctx, js.UserJoin, ns)
+		if err != nil {
+			return false, err
+		} else if msg != "" {
+			return false, m.setDegraded(
+				ctx, planner.SmbShare, ReasonInvalidJoinSecret, msg)
+		}
+	}
+	return true, nil
+}
+
+// JoinChecker is the interface used to check the credentials of the join
+// sources against the domain.
+type JoinChecker interface {
+	// CheckCredentials returns true if a domain controller of the realm
+	// accepts the credentials, and false if it rejects them. An error is
+	// returned if the credentials could not be checked.
+	CheckCredentials(
+		ctx context.Context, realm, username, password string) (bool, error)
+}
+
+// ldapJoinChecker checks credentials by binding to a domain controller of
+// the realm over LDAPS.
+type ldapJoinChecker struct {
+	timeout time.Duration
+}
+
+// NewLDAPJoinChecker returns a JoinChecker binding to the domain
+// controllers, found through the DNS SRV records of the realm, over LDAPS.
+// The certificates of the domain controllers must be trusted by the
+// operator, or the credentials are not checked, so that passwords are
+// never sent to servers that could not be verified.
+func NewLDAPJoinChecker() JoinChecker {
+	return &ldapJoinChecker{timeout: 10 * time.Second}
+}
+
+// CheckCredentials implements JoinChecker.
+func (c *ldapJoinChecker) CheckCredentials(
+	ctx context.Context, realm, username, password string) (bool, error) {
+	// ---
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	realm = strings.ToLower(realm)
+	_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "ldap", "tcp", realm)
+	if err != nil {
+		return false, err
+	} else if len(srvs) == 0 {
+		return false, fmt.Errorf("no domain controller found for %s", realm)
+	}
+	host := strings.TrimSuffix(srvs[0].Target, ".")
+	deadline, _ := ctx.Deadline()
+	conn, err := tls.DialWithDialer(
+		&net.Dialer{Deadline: deadline},
+		"tcp", net.JoinHostPort(host, "636"),
+		&tls.Config{ServerName: host})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return false, err
+	}
+	return ldapBind(conn, ldapBindName(realm, username), password)
+}
+
+// ldapBindName returns the name a user binds with: the user principal name
+// of a plain user name, or the name as given if it names its domain.
+func ldapBindName(realm, username string) string {
+	if strings.ContainsAny(username, `@\`) {
+		return username
+	}
+	return username + "@" + realm
+}
+
+const (
+	// ldapResultSuccess is the result code of a successful bind.
+	ldapResultSuccess = 0
+	// ldapResultInvalidCredentials is the result code of a bind with
+	// wrong credentials.
+	ldapResultInvalidCredentials = 49
+	// ldapMaxResponse limits the size of the bind response read.
+	ldapMaxResponse = 64 * 1024
+)
+
+type ldapSimpleBind struct {
+	Version  int
+	Name     []byte
+	Password []byte `asn1:"tag:0"`
+}
+
+type ldapBindRequest struct {
+	MessageID int
+	Bind      ldapSimpleBind `asn1:"application,tag:0"`
+}
+
+// ldapBind sends a simple bind request on conn and returns true if the
+// server accepts the credentials, and false if it rejects them. Binding
+// without a password is an anonymous bind, which proves nothing, so empty
+// passwords are rejected without asking the server.
+func ldapBind(conn io.ReadWriter, name, password string) (bool, error) {
+	if password == "" {
+		return false, nil
+	}
+	req, err := asn1.Marshal(ldapBindRequest{
+		MessageID: 1,
+		Bind: ldapSimpleBind{
+			Version:  3,
+			Name:     []byte(name),
+			Password: []byte(password),
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return false, err
+	}
+	resp, err := readBERElement(conn)
+	if err != nil {
+		return false, err
+	}
+	code, msg, err := parseLDAPBindResponse(resp)
+	if err != nil {
+		return false, err
+	}
+	switch code {
+	case ldapResultSuccess:
+		return true, nil
+	case ldapResultInvalidCredentials:
+		return false, nil
+	}
+	return false, fmt.Errorf("bind failed with result %d: %s", code, msg)
+}
+
+// readBERElement reads one BER encoded element, with a definite length.
+func readBERElement(r io.Reader) ([]byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	length := int(head[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 3 {
+			return nil, fmt.Errorf("unsupported BER length of %d bytes", n)
+		}
+		lb := make([]byte, n)
+		if _, err := io.ReadFull(r, lb); err != nil {
+			return nil, err
+		}
+		head = append(head, lb...)
+		length = 0
+		for _, b := range lb {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > ldapMaxResponse {
+		return nil, fmt.Errorf("LDAP response of %d bytes is too large", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return append(head, body...), nil
+}
+
+// parseLDAPBindResponse returns the result code and diagnostic message of
+// an LDAP bind response.
+func parseLDAPBindResponse(data []byte) (int, string, error) {
+	msg := asn1.RawValue{}
+	if _, err := asn1.Unmarshal(data, &msg); err != nil {
+		return 0, "", err
+	}
+	var id int
+	rest, err := asn1.Unmarshal(msg.Bytes, &id)
+	if err != nil {
+		return 0, "", err
+	}
+	op := asn1.RawValue{}
+	if _, err := asn1.Unmarshal(rest, &op); err != nil {
+		return 0, "", err
+	}
+	if op.Class != asn1.ClassApplication || op.Tag != 1 {
+		return 0, "", fmt.Errorf(
+			"unexpected LDAP operation %d in bind response", op.Tag)
+	}
+	var code asn1.Enumerated
+	rest, err = asn1.Unmarshal(op.Bytes, &code)
+	if err != nil {
+		return 0, "", err
+	}
+	var matched, diag []byte
+	if rest, err = asn1.Unmarshal(rest, &matched); err != nil {
+		return 0, "", err
+	}
+	if _, err = asn1.Unmarshal(rest, &diag); err != nil {
+		return 0, "", err
+	}
+	return int(code), string(diag), nil
+}
+
+// workloadRolledOut returns true if the workload of the share's server
+// group exists.
+func (m *SmbShareManager) workloadRolledOut(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	var obj runtime.Object = &appsv1.Deployment{}
+	if planner.workloadType() == statefulSetWorkload {
+		obj = &appsv1.StatefulSet{}
+	}
+	err := m.client.Get(ctx,
+		types.NamespacedName{Name: planner.instanceName(), Namespace: ns},
+		obj)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// checkJoinCredentials checks, before the workload of the share's server
+// group is first rolled out, that a domain controller accepts the
+// credentials of at least one join source of the security config, as the
+// pods try them in turn. If none is accepted, the Degraded condition is
+// set on the SmbShare and false is returned. Credentials that can not be
+// checked, for example because no domain controller can be reached, do
+// not hold back the rollout.
+func (m *SmbShareManager) checkJoinCredentials(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	if m.joins == nil || planner.joinCheck() != joinCheckCredentials {
+		return true, nil
+	}
+	rolledOut, err := m.workloadRolledOut(ctx, planner, ns)
+	if err != nil || rolledOut {
+		return true, err
+	}
+	sc := planner.SecurityConfig
+	rejected := []string{}
+	for _, js := range sc.Spec.JoinSources {
+		if js.UserJoin == nil {
+			continue
+		}
+		creds, msg, err := m.joinSourceCredentials(ctx, js.UserJoin, ns)
+		if err != nil {
+			return false, err
+		} else if msg != "" {
+			// reported by validateJoinSources
+			return true, nil
+		}
+		ok, err := m.joins.CheckCredentials(
+			ctx, sc.Spec.Realm, creds.Username, creds.Password)
+		if err != nil {
+			m.logger.Info("Could not check join credentials",
+				"Secret.Name", js.UserJoin.Secret, "error", err.Error())
+			return true, nil
+		} else if ok {
+			return true, nil
+		}
+		rejected = append(rejected, fmt.Sprintf(
+			"%s from join secret %s", creds.Username, js.UserJoin.Secret))
+	}
+	if len(rejected) == 0 {
+		return true, nil
+	}
+	msg := fmt.Sprintf("Realm %s rejected the credentials of %s",
+		sc.Spec.Realm, strings.Join(rejected, ", "))
+	return false, m.setDegraded(
+		ctx, planner.SmbShare, ReasonJoinCredentialsRejected, msg)
+}
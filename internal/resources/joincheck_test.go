@@ -0,0 +1,251 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/asn1"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// joinPlanner returns a planner of a domain member share joining with the
+// given join secrets, using key join.json.
+func joinPlanner(
+	share *sambaoperatorv1alpha1.SmbShare, secrets ...string) *sharePlanner {
+	// ---
+	planner := domainPlanner(share)
+	for _, s := range secrets {
+		planner.SecurityConfig.Spec.JoinSources = append(
+			planner.SecurityConfig.Spec.JoinSources,
+			sambaoperatorv1alpha1.SmbSecurityJoinSpec{
+				UserJoin: &sambaoperatorv1alpha1.SmbSecurityUserJoinSpec{
+					Secret: s,
+					Key:    "join.json",
+				},
+			})
+	}
+	return planner
+}
+
+func TestValidateJoinSources(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	planner := joinPlanner(share, "join1")
+	ctx := context.TODO()
+	check := func(msg string, objs ...*corev1.Secret) {
+		t.Helper()
+		m, recorder := newTestManager(share)
+		for _, o := range objs {
+			require.NoError(t, m.client.Create(ctx, o))
+		}
+		valid, err := m.validateJoinSources(ctx, planner, "default")
+		assert.NoError(t, err)
+		if msg == "" {
+			assert.True(t, valid)
+			assert.Len(t, recorder.Events, 0)
+			return
+		}
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidJoinSecret)
+			assert.Contains(t, event, msg)
+		}
+	}
+	check("", passwordSecret("join1", map[string]string{
+		"join.json": `{"username": "Administrator", "password": "P4ssw0rd"}`,
+	}))
+	// the pods are not rolled out with an empty join secret
+	check("Key join.json of join secret join1 is not valid JSON",
+		passwordSecret("join1", map[string]string{"join.json": ""}))
+	check("Key join.json of join secret join1 must set a username and a password",
+		passwordSecret("join1", map[string]string{"join.json": "{}"}))
+	check("Key join.json of join secret join1 must set a username and a password",
+		passwordSecret("join1", map[string]string{
+			"join.json": `{"username": "Administrator"}`,
+		}))
+	check("Join secret join1 has no key join.json",
+		passwordSecret("join1", map[string]string{"join2.json": "{}"}))
+	check("Join secret join1 not found")
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, ReasonInvalidJoinSecret, cond.Reason)
+	}
+
+	// the join containers are left to report the failures
+	planner.SecurityConfig.Spec.JoinCheck = joinCheckNone
+	check("")
+	// shares not joining a domain have no join sources to check
+	assert.Equal(t, joinCheckNone, testPlanner(share, nil).joinCheck())
+}
+
+// fakeJoins accepts the passwords it maps to true, rejects those it maps to
+// false and fails to check the others.
+type fakeJoins struct {
+	passwords map[string]bool
+	checked   []string
+}
+
+func (f *fakeJoins) CheckCredentials(
+	_ context.Context, realm, username, password string) (bool, error) {
+	// ---
+	f.checked = append(f.checked, username)
+	ok, found := f.passwords[password]
+	if !found {
+		return false, &net.DNSError{Err: "no such host", Name: realm}
+	}
+	return ok, nil
+}
+
+func TestCheckJoinCredentials(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	planner := joinPlanner(share, "join1", "join2")
+	planner.SecurityConfig.Spec.JoinCheck = joinCheckCredentials
+	join1 := passwordSecret("join1", map[string]string{
+		"join.json": `{"username": "Administrator", "password": "P4ssw0rd"}`,
+	})
+	join2 := passwordSecret("join2", map[string]string{
+		"join.json": `{"username": "joiner", "password": "Passw0rd"}`,
+	})
+	ctx := context.TODO()
+	check := func(joins *fakeJoins, objs ...runtime.Object) (bool, []string) {
+		t.Helper()
+		m, recorder := newTestManager(
+			append([]runtime.Object{share, join1, join2}, objs...)...)
+		m.joins = joins
+		valid, err := m.checkJoinCredentials(ctx, planner, "default")
+		assert.NoError(t, err)
+		events := []string{}
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		return valid, events
+	}
+
+	// the pods try the join sources in turn, one is enough
+	joins := &fakeJoins{passwords: map[string]bool{"P4ssw0rd": false, "Passw0rd": true}}
+	valid, events := check(joins)
+	assert.True(t, valid)
+	assert.Empty(t, events)
+	assert.Equal(t, []string{"Administrator", "joiner"}, joins.checked)
+
+	joins = &fakeJoins{passwords: map[string]bool{"P4ssw0rd": false, "Passw0rd": false}}
+	valid, events = check(joins)
+	assert.False(t, valid)
+	if assert.Len(t, events, 1) {
+		assert.Contains(t, events[0], ReasonJoinCredentialsRejected)
+		assert.Contains(t, events[0], "Realm domain1.example.com rejected the "+
+			"credentials of Administrator from join secret join1, "+
+			"joiner from join secret join2")
+	}
+
+	// credentials that can not be checked do not hold back the rollout
+	joins = &fakeJoins{passwords: map[string]bool{"P4ssw0rd": false}}
+	valid, events = check(joins)
+	assert.True(t, valid)
+	assert.Empty(t, events)
+
+	// the credentials are only checked before the first rollout
+	joins = &fakeJoins{passwords: map[string]bool{"P4ssw0rd": false, "Passw0rd": false}}
+	valid, events = check(joins, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:      planner.instanceName(),
+		Namespace: "default",
+	}})
+	assert.True(t, valid)
+	assert.Empty(t, events)
+	assert.Empty(t, joins.checked)
+
+	// nor with the default check of the join secrets
+	planner.SecurityConfig.Spec.JoinCheck = ""
+	valid, _ = check(joins)
+	assert.True(t, valid)
+	assert.Empty(t, joins.checked)
+}
+
+func TestLDAPBind(t *testing.T) {
+	bind := func(code int, password string) (bool, []byte, error) {
+		client, server := net.Pipe()
+		defer client.Close()
+		received := make(chan []byte, 1)
+		go func() {
+			defer server.Close()
+			req, err := readBERElement(server)
+			received <- req
+			if err != nil {
+				return
+			}
+			resp, _ := asn1.Marshal(struct {
+				MessageID int
+				Result    struct {
+					Code      asn1.Enumerated
+					MatchedDN []byte
+					Message   []byte
+				} `asn1:"application,tag:1"`
+			}{MessageID: 1, Result: struct {
+				Code      asn1.Enumerated
+				MatchedDN []byte
+				Message   []byte
+			}{Code: asn1.Enumerated(code), Message: []byte("no way")}})
+			_, _ = server.Write(resp)
+		}()
+		ok, err := ldapBind(client, "joiner@domain1.example.com", password)
+		if password == "" {
+			return ok, nil, err
+		}
+		return ok, <-received, err
+	}
+	ok, req, err := bind(ldapResultSuccess, "Passw0rd")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	parsed := ldapBindRequest{}
+	_, perr := asn1.Unmarshal(req, &parsed)
+	require.NoError(t, perr)
+	assert.Equal(t, 3, parsed.Bind.Version)
+	assert.Equal(t, "joiner@domain1.example.com", string(parsed.Bind.Name))
+	assert.Equal(t, "Passw0rd", string(parsed.Bind.Password))
+
+	ok, _, err = bind(ldapResultInvalidCredentials, "P4ssw0rd")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// a server refusing simple binds does not tell about the credentials
+	_, _, err = bind(8, "P4ssw0rd")
+	assert.EqualError(t, err, "bind failed with result 8: no way")
+
+	// an empty password would make an anonymous bind
+	ok, _, err = bind(ldapResultSuccess, "")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.Equal(t, "joiner@domain1.example.com",
+		ldapBindName("domain1.example.com", "joiner"))
+	assert.Equal(t, `DOMAIN1\joiner`,
+		ldapBindName("domain1.example.com", `DOMAIN1\joiner`))
+}
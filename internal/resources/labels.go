@@ -0,0 +1,215 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// commonLabelsAnnotationKey is the annotation listing the keys of the
+	// common labels the operator set on a resource, so that the labels
+	// removed from the common config are removed from the resource.
+	commonLabelsAnnotationKey = "samba-operator.samba.org/common-labels"
+	// commonLabelsFieldManager is the field manager of the common labels.
+	// The labels are written apart from the rest of the resources, and so
+	// are not owned by the operator's apply entry, whose applies would
+	// otherwise remove them.
+	commonLabelsFieldManager = "samba-operator-labels"
+	// operatorLabelPrefix is the prefix of the labels used by the operator.
+	operatorLabelPrefix = "samba-operator.samba.org/"
+)
+
+// commonLabels returns the labels the common config adds to the resources
+// created for the share.
+func (sp *sharePlanner) commonLabels() map[string]string {
+	if sp.CommonConfig == nil {
+		return nil
+	}
+	return sp.CommonConfig.Spec.CommonLabels
+}
+
+// functionalLabel returns true if the label key is used by the operator,
+// such as to select the pods of a server group, and so can not be a common
+// label.
+func functionalLabel(key string) bool {
+	if strings.HasPrefix(key, operatorLabelPrefix) {
+		return true
+	}
+	_, found := labelsForSmbServer("")[key]
+	return found
+}
+
+// validateCommonLabels checks that the common labels are valid labels that
+// are not used by the operator. If not, the Degraded condition is set on
+// the SmbShare and false is returned.
+func (m *SmbShareManager) validateCommonLabels(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	labels := planner.commonLabels()
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		msg := ""
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			msg = fmt.Sprintf("Invalid common label key %q: %s",
+				k, strings.Join(errs, "; "))
+		} else if errs := validation.IsValidLabelValue(labels[k]); len(errs) > 0 {
+			msg = fmt.Sprintf("Invalid value of common label %s: %s",
+				k, strings.Join(errs, "; "))
+		} else if functionalLabel(k) {
+			msg = fmt.Sprintf(
+				"Common label %s is used by the operator and can not be set", k)
+		}
+		if msg != "" {
+			return false, m.setDegraded(
+				ctx, planner.SmbShare, ReasonInvalidCommonLabels, msg)
+		}
+	}
+	return true, nil
+}
+
+// mergeTracked sets the wanted entries in values, the labels or annotations
+// of a resource, removing the entries the operator set before that are no
+// longer wanted. The keys of the entries the operator set are listed by the
+// trackKey annotation, in annotations, which may be the same map as values.
+// Entries the operator did not set, such as the functional labels of the
+// resource or those set by others, are left alone. It returns true if an
+// entry was changed.
+func mergeTracked(
+	values, annotations, want map[string]string, trackKey string) bool {
+	// ---
+	applied := map[string]bool{}
+	if value := annotations[trackKey]; value != "" {
+		for _, k := range strings.Split(value, ",") {
+			applied[k] = true
+		}
+	}
+	changed := false
+	for k := range applied {
+		if _, found := want[k]; !found {
+			delete(values, k)
+			changed = true
+		}
+	}
+	keys := []string{}
+	for k, v := range want {
+		if _, found := values[k]; found && !applied[k] {
+			continue
+		}
+		keys = append(keys, k)
+		if values[k] != v {
+			values[k] = v
+			changed = true
+		}
+	}
+	sort.Strings(keys)
+	value := strings.Join(keys, ",")
+	if annotations[trackKey] != value {
+		if value == "" {
+			delete(annotations, trackKey)
+		} else {
+			annotations[trackKey] = value
+		}
+		changed = true
+	}
+	return changed
+}
+
+// mergeCommonLabels sets the common labels on a resource, removing the
+// common labels set before that are no longer wanted. It returns true if
+// the resource was changed.
+func mergeCommonLabels(obj childObject, want map[string]string) bool {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	changed := mergeTracked(labels, annotations, want, commonLabelsAnnotationKey)
+	obj.SetLabels(labels)
+	obj.SetAnnotations(annotations)
+	return changed
+}
+
+// updateCommonLabels sets the common labels of the share's common config on
+// the resources created for the share: the resources of its server group,
+// its PVC and the ConfigMap holding its smb.conf. It returns true if a
+// resource was updated.
+func (m *SmbShareManager) updateCommonLabels(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	children := m.ownedChildren(s)
+	children = append(children, childResource{
+		"ConfigMap",
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      smbConfConfigMapName(s),
+				Namespace: s.Namespace,
+			},
+		},
+	})
+	changed := false
+	for _, child := range children {
+		key := types.NamespacedName{
+			Name:      child.obj.GetName(),
+			Namespace: child.obj.GetNamespace(),
+		}
+		err := m.client.Get(ctx, key, child.obj)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			m.logger.Error(err, "Failed to get "+child.kind,
+				child.kind+".Namespace", key.Namespace,
+				child.kind+".Name", key.Name)
+			return false, err
+		}
+		if child.obj.GetDeletionTimestamp() != nil ||
+			!mergeCommonLabels(child.obj, planner.commonLabels()) {
+			// ---
+			continue
+		}
+		m.logger.Info("Updating common labels of "+child.kind,
+			child.kind+".Namespace", key.Namespace,
+			child.kind+".Name", key.Name)
+		err = m.client.Update(
+			ctx, child.obj, rtclient.FieldOwner(commonLabelsFieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to update "+child.kind,
+				child.kind+".Namespace", key.Namespace,
+				child.kind+".Name", key.Name)
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
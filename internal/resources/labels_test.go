@@ -0,0 +1,150 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func TestValidateCommonLabels(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	ctx := context.TODO()
+
+	check := func(labels map[string]string, msg string) {
+		t.Helper()
+		common.Spec.CommonLabels = labels
+		m, recorder := newTestManager(share)
+		valid, err := m.validateCommonLabels(ctx, planner)
+		assert.NoError(t, err)
+		if msg == "" {
+			assert.True(t, valid)
+			assert.Empty(t, recorder.Events)
+			return
+		}
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidCommonLabels)
+			assert.Contains(t, event, msg)
+		}
+	}
+	check(nil, "")
+	check(map[string]string{"team": "storage", "example.com/cost-center": "42"}, "")
+	check(map[string]string{"team!": "storage"}, `Invalid common label key "team!"`)
+	check(map[string]string{"team": "storage team"},
+		"Invalid value of common label team")
+	check(map[string]string{"samba-operator.samba.org/service": "other"},
+		"Common label samba-operator.samba.org/service is used by the operator")
+	check(map[string]string{"app.kubernetes.io/managed-by": "helm"},
+		"Common label app.kubernetes.io/managed-by is used by the operator")
+}
+
+func TestUpdateCommonLabels(t *testing.T) {
+	share, planner := ownedShare()
+	m, _ := newTestManager(share)
+	children := createChildren(t, m, planner)
+	ctx := context.TODO()
+	planner.ConfigState = smbcc.New()
+	_, err := planner.update()
+	require.NoError(t, err)
+	_, err = m.updateSmbConf(ctx, planner)
+	require.NoError(t, err)
+	cm := &corev1.ConfigMap{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: smbConfConfigMapName(share)},
+		cm))
+	children = append(children, cm)
+
+	changed, err := m.updateCommonLabels(ctx, planner)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// a label set by hand is not taken over by the common labels
+	children[1].GetLabels()["owner"] = "alice"
+	require.NoError(t, m.client.Update(ctx, children[1]))
+
+	planner.CommonConfig.Spec.CommonLabels = map[string]string{
+		"team":        "storage",
+		"cost-center": "42",
+		"owner":       "storage-team",
+	}
+	changed, err = m.updateCommonLabels(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	get := func(obj childObject) map[string]string {
+		t.Helper()
+		key := types.NamespacedName{
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+		}
+		// decoding merges into the maps already set
+		obj.SetLabels(nil)
+		obj.SetAnnotations(nil)
+		require.NoError(t, m.client.Get(ctx, key, obj))
+		return obj.GetLabels()
+	}
+	for i, obj := range children {
+		labels := get(obj)
+		assert.Equal(t, "storage", labels["team"], "child %d", i)
+		assert.Equal(t, "42", labels["cost-center"], "child %d", i)
+		// the functional labels are preserved
+		assert.Equal(t, "samba-operator", labels[managedByLabelKey], "child %d", i)
+		if i != 0 && i != 4 {
+			assert.Equal(t, "myshare",
+				labels["samba-operator.samba.org/service"], "child %d", i)
+		}
+	}
+	assert.Equal(t, "alice", get(children[1])["owner"])
+	assert.Equal(t, "storage-team", get(children[2])["owner"])
+
+	changed, err = m.updateCommonLabels(ctx, planner)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// labels removed from the common config are removed from the children
+	planner.CommonConfig.Spec.CommonLabels = map[string]string{"team": "storage"}
+	changed, err = m.updateCommonLabels(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	for i, obj := range children {
+		labels := get(obj)
+		assert.Equal(t, "storage", labels["team"], "child %d", i)
+		assert.NotContains(t, labels, "cost-center", "child %d", i)
+	}
+	assert.Equal(t, "alice", get(children[1])["owner"])
+	assert.NotContains(t, get(children[2]), "owner")
+
+	planner.CommonConfig.Spec.CommonLabels = nil
+	changed, err = m.updateCommonLabels(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	for i, obj := range children {
+		assert.NotContains(t, get(obj), "team", "child %d", i)
+		assert.NotContains(t, obj.GetAnnotations(), commonLabelsAnnotationKey,
+			"child %d", i)
+	}
+}
@@ -0,0 +1,63 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import "sync"
+
+// keyedMutex provides a mutex for each of an arbitrary set of keys. Only
+// the keys currently locked, or waited for, take up memory.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	// users counts the holder and the waiters of the lock.
+	users int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: map[string]*keyLock{}}
+}
+
+// lock blocks until the lock for key is acquired. It returns a function
+// that releases the lock.
+func (km *keyedMutex) lock(key string) (unlock func()) {
+	km.mu.Lock()
+	l, found := km.locks[key]
+	if !found {
+		l = &keyLock{}
+		km.locks[key] = l
+	}
+	l.users++
+	km.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		km.mu.Lock()
+		l.users--
+		if l.users == 0 {
+			delete(km.locks, key)
+		}
+		km.mu.Unlock()
+	}
+}
+
+// serverGroupLocks serializes the reconciliation of the SmbShares of a
+// server group, as they manage the same deployment and service.
+var serverGroupLocks = newKeyedMutex()
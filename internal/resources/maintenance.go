@@ -0,0 +1,164 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// restartedAtAnnotationKey is the pod template annotation stamped with
+	// the time of the last scheduled restart. Changing it rolls the pods.
+	restartedAtAnnotationKey = "samba-operator.samba.org/restarted-at"
+	// lastScheduledRestartAnnotationKey is the deployment annotation
+	// holding the time the restart schedule was last acted on, whether the
+	// pods were restarted or the restart was skipped.
+	lastScheduledRestartAnnotationKey = "samba-operator.samba.org/last-scheduled-restart"
+	// restartFieldManager is the field manager of the restart annotations.
+	// The applies of the operator do not set them, and leave the fields of
+	// other managers alone.
+	restartFieldManager = "samba-operator-restarts"
+)
+
+// restartSchedule returns the cron schedule of the rolling restarts of the
+// pods, or an empty string if they are not restarted on a schedule.
+func (sp *sharePlanner) restartSchedule() string {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.Maintenance == nil {
+		return ""
+	}
+	return sp.CommonConfig.Spec.Maintenance.RestartSchedule
+}
+
+// validateMaintenance checks that the restart schedule of the common config
+// is a valid cron schedule that matches some time. If not, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateMaintenance(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	spec := planner.restartSchedule()
+	if spec == "" {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidMaintenance, msg)
+	}
+	sched, err := parseCronSchedule(spec)
+	if err != nil {
+		return degraded(fmt.Sprintf(
+			"Invalid restart schedule %q: %v", spec, err))
+	}
+	if sched.next(time.Now()).IsZero() {
+		return degraded(fmt.Sprintf(
+			"Restart schedule %q matches no time", spec))
+	}
+	return true, nil
+}
+
+// deploymentRollingOut returns true if the pods of the deployment are being
+// replaced, or the deployment controller has not seen its latest changes.
+func deploymentRollingOut(d *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	st := d.Status
+	return st.ObservedGeneration < d.Generation ||
+		st.UpdatedReplicas < replicas ||
+		st.Replicas > st.UpdatedReplicas ||
+		st.AvailableReplicas < st.UpdatedReplicas
+}
+
+// lastScheduledRestart returns the time the restart schedule of the
+// deployment was last acted on, or its creation time.
+func lastScheduledRestart(d *appsv1.Deployment) time.Time {
+	t, err := time.Parse(
+		time.RFC3339, d.Annotations[lastScheduledRestartAnnotationKey])
+	if err != nil {
+		return d.CreationTimestamp.Time
+	}
+	return t
+}
+
+// scheduleRestart restarts the pods of the deployment once a time of the
+// restart schedule has passed, by stamping the time on the pod template.
+// The deployment then replaces the pods following its update strategy. A
+// restart is skipped, and recorded as such, while the pods are being
+// replaced already. It returns true if the deployment was changed, and the
+// time until the next scheduled restart, or zero if there is none. Pods
+// not run by a deployment are not restarted.
+func (m *SmbShareManager) scheduleRestart(
+	ctx context.Context,
+	planner *sharePlanner,
+	deployment *appsv1.Deployment,
+	now time.Time) (bool, time.Duration, error) {
+	// ---
+	spec := planner.restartSchedule()
+	if spec == "" || deployment == nil {
+		return false, 0, nil
+	}
+	sched, err := parseCronSchedule(spec)
+	if err != nil {
+		// reported by validateMaintenance
+		return false, 0, nil
+	}
+	due := sched.next(lastScheduledRestart(deployment))
+	if due.IsZero() {
+		return false, 0, nil
+	} else if due.After(now) {
+		return false, due.Sub(now), nil
+	}
+
+	stamp := now.UTC().Format(time.RFC3339)
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+	deployment.Annotations[lastScheduledRestartAnnotationKey] = stamp
+	rolling := deploymentRollingOut(deployment)
+	if !rolling {
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = map[string]string{}
+		}
+		deployment.Spec.Template.Annotations[restartedAtAnnotationKey] = stamp
+	}
+	err = m.client.Update(
+		ctx, deployment, rtclient.FieldOwner(restartFieldManager))
+	if err != nil {
+		m.logger.Error(err, "Failed to update Deployment",
+			"Deployment.Namespace", deployment.Namespace,
+			"Deployment.Name", deployment.Name)
+		return false, 0, err
+	}
+	if rolling {
+		m.recorder.Eventf(planner.SmbShare,
+			EventNormal,
+			ReasonRestartSkipped,
+			"Skipped the scheduled restart of deployment %s: "+
+				"its pods are being replaced", deployment.Name)
+	} else {
+		m.recorder.Eventf(planner.SmbShare,
+			EventNormal,
+			ReasonScheduledRestart,
+			"Restarting the pods of deployment %s as scheduled by %q",
+			deployment.Name, spec)
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,137 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+func TestScheduleRestart(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	m, recorder := newTestManager(share)
+	ctx := context.TODO()
+	dep, created, err := m.getOrCreateDeployment(ctx, planner, "default")
+	require.NoError(t, err)
+	require.True(t, created)
+	dep.Annotations = map[string]string{
+		lastScheduledRestartAnnotationKey: "2021-06-02T10:00:00Z",
+	}
+	dep.Status = appsv1.DeploymentStatus{
+		Replicas:          1,
+		UpdatedReplicas:   1,
+		AvailableReplicas: 1,
+	}
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return v
+	}
+
+	// pods are not restarted without a schedule
+	changed, until, err := m.scheduleRestart(
+		ctx, planner, dep, at("2021-06-02T10:30:00Z"))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, time.Duration(0), until)
+
+	common.Spec.Maintenance = &sambaoperatorv1alpha1.SmbMaintenanceSpec{
+		RestartSchedule: "*/5 * * * *",
+	}
+	changed, until, err = m.scheduleRestart(
+		ctx, planner, dep, at("2021-06-02T10:03:00Z"))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 2*time.Minute, until)
+	assert.NotContains(t, dep.Spec.Template.Annotations, restartedAtAnnotationKey)
+
+	// the pod template is re-stamped once the time has come
+	changed, _, err = m.scheduleRestart(
+		ctx, planner, dep, at("2021-06-02T10:05:30Z"))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonScheduledRestart)
+	found := &appsv1.Deployment{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: dep.Name}, found))
+	assert.Equal(t, "2021-06-02T10:05:30Z",
+		found.Spec.Template.Annotations[restartedAtAnnotationKey])
+	assert.Equal(t, "2021-06-02T10:05:30Z",
+		found.Annotations[lastScheduledRestartAnnotationKey])
+	changed, until, err = m.scheduleRestart(
+		ctx, planner, found, at("2021-06-02T10:07:00Z"))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 3*time.Minute, until)
+
+	// restarts are skipped while the pods are being replaced
+	found.Status.UpdatedReplicas = 0
+	changed, _, err = m.scheduleRestart(
+		ctx, planner, found, at("2021-06-02T10:10:00Z"))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonRestartSkipped)
+	assert.Equal(t, "2021-06-02T10:05:30Z",
+		found.Spec.Template.Annotations[restartedAtAnnotationKey])
+	assert.Equal(t, "2021-06-02T10:10:00Z",
+		found.Annotations[lastScheduledRestartAnnotationKey])
+
+	// the operator's updates leave the restart stamp alone
+	desired := buildDeployment(m.cfg, planner, pvcName(share), "default")
+	updatePodTemplateSettings(found, desired)
+	assert.Equal(t, "2021-06-02T10:05:30Z",
+		found.Spec.Template.Annotations[restartedAtAnnotationKey])
+}
+
+func TestValidateMaintenance(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.Maintenance = &sambaoperatorv1alpha1.SmbMaintenanceSpec{
+		RestartSchedule: "0 3 * * 0",
+	}
+	planner := testPlanner(share, common)
+	m, recorder := newTestManager(share)
+	valid, err := m.validateMaintenance(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Empty(t, recorder.Events)
+
+	for spec, msg := range map[string]string{
+		"0 3 * *":    `Invalid restart schedule "0 3 * *": expected 5 fields, found 4`,
+		"0 0 30 2 *": `Restart schedule "0 0 30 2 *" matches no time`,
+	} {
+		common.Spec.Maintenance.RestartSchedule = spec
+		valid, err = m.validateMaintenance(context.TODO(), planner)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonInvalidMaintenance)
+		assert.Contains(t, event, msg)
+	}
+}
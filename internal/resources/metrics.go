@@ -0,0 +1,376 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+const (
+	// metricsContainerName is the name of the metrics exporter sidecar.
+	metricsContainerName = "metrics"
+	// metricsPortName is the name of the port the metrics are served on,
+	// in the pods and in the metrics Service.
+	metricsPortName = "metrics"
+	// metricsPort is the port the metrics exporter listens on.
+	metricsPort = 8080
+	// metricsComponent is the component label of the metrics Service,
+	// which the ServiceMonitor selects.
+	metricsComponent = "metrics"
+)
+
+// metrics returns true if the pods of the share run the metrics exporter.
+func (sp *sharePlanner) metrics() bool {
+	return sp.CommonConfig != nil && sp.CommonConfig.Spec.Metrics != nil
+}
+
+// serviceMonitor returns the settings of the ServiceMonitor of the share's
+// metrics, or nil if no ServiceMonitor is requested.
+func (sp *sharePlanner) serviceMonitor() *sambaoperatorv1alpha1.SmbServiceMonitorSpec {
+	if !sp.metrics() {
+		return nil
+	}
+	return sp.CommonConfig.Spec.Metrics.ServiceMonitor
+}
+
+// metricsServiceName returns the name of the Service of the metrics of the
+// server group.
+func metricsServiceName(serverGroup string) string {
+	return serverGroup + "-metrics"
+}
+
+// addMetricsContainer adds the metrics exporter sidecar to the pod spec.
+// The exporter reads the state of the samba server, so it shares the
+// mounts of the smbd container, apart from the shares, and the samba state
+// directory is added to the volumes if the pods do not have it already.
+func addMetricsContainer(
+	planner *sharePlanner, podSpec *corev1.PodSpec, smbdName, pvcName string) {
+	// ---
+	var smbd *corev1.Container
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == smbdName {
+			smbd = &podSpec.Containers[i]
+		}
+	}
+	if smbd == nil {
+		return
+	}
+	hasState := false
+	for _, v := range podSpec.Volumes {
+		if v.Name == stateVolName {
+			hasState = true
+		}
+	}
+	if !hasState {
+		stateVol, stateMount := sambaStateVolumeAndMount(planner)
+		podSpec.Volumes = append(podSpec.Volumes, stateVol)
+		smbd.VolumeMounts = append(smbd.VolumeMounts, stateMount)
+	}
+	_, shareMounts := shareVolumesAndMounts(planner, pvcName)
+	shared := map[string]bool{}
+	for _, m := range shareMounts {
+		shared[m.Name] = true
+	}
+	mounts := []corev1.VolumeMount{}
+	for _, m := range smbd.VolumeMounts {
+		if !shared[m.Name] {
+			mounts = append(mounts, m)
+		}
+	}
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{
+		Image: planner.metricsImage(),
+		Name:  metricsContainerName,
+		Env:   smbd.Env,
+		Ports: []corev1.ContainerPort{{
+			ContainerPort: metricsPort,
+			Name:          metricsPortName,
+		}},
+		VolumeMounts: mounts,
+	})
+}
+
+// metricsServiceLabels returns the labels of the metrics Service of the
+// server group.
+func metricsServiceLabels(planner *sharePlanner) map[string]string {
+	labels := labelsForSmbServer(planner.instanceName())
+	labels["app.kubernetes.io/component"] = metricsComponent
+	return labels
+}
+
+// metricsServiceSelector returns the labels the ServiceMonitor selects the
+// metrics Service with. The component label keeps the other Services of
+// the server group from being scraped.
+func metricsServiceSelector(planner *sharePlanner) map[string]string {
+	labels := metricsServiceLabels(planner)
+	return map[string]string{
+		svcSelectorKey:                labels[svcSelectorKey],
+		"app.kubernetes.io/component": metricsComponent,
+	}
+}
+
+// newMetricsServiceForSmb returns the Service of the metrics exporters of
+// the server group, or nil if the pods do not run the exporter.
+func newMetricsServiceForSmb(planner *sharePlanner, ns string) *corev1.Service {
+	if !planner.metrics() {
+		return nil
+	}
+	labels := metricsServiceLabels(planner)
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      metricsServiceName(planner.instanceName()),
+			Namespace: ns,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{{
+				Name:       metricsPortName,
+				Protocol:   corev1.ProtocolTCP,
+				Port:       metricsPort,
+				TargetPort: intstr.FromString(metricsPortName),
+			}},
+			Selector: map[string]string{
+				svcSelectorKey: labels[svcSelectorKey],
+			},
+		},
+	}
+}
+
+// newServiceMonitorForSmb returns the ServiceMonitor scraping the metrics
+// Service of the server group, or nil if none is requested. The
+// ServiceMonitor API is not known to the operator's scheme, so the
+// ServiceMonitor is an unstructured object.
+func newServiceMonitorForSmb(
+	planner *sharePlanner, ns string) *unstructured.Unstructured {
+	// ---
+	spec := planner.serviceMonitor()
+	if spec == nil {
+		return nil
+	}
+	labels := map[string]string{}
+	for k, v := range spec.Labels {
+		labels[k] = v
+	}
+	for k, v := range labelsForSmbServer(planner.instanceName()) {
+		labels[k] = v
+	}
+	matchLabels := map[string]interface{}{}
+	for k, v := range metricsServiceSelector(planner) {
+		matchLabels[k] = v
+	}
+	endpoint := map[string]interface{}{"port": metricsPortName}
+	if spec.Interval != "" {
+		endpoint["interval"] = spec.Interval
+	}
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{
+				"matchLabels": matchLabels,
+			},
+			"endpoints": []interface{}{endpoint},
+		},
+	}}
+	u.SetAPIVersion(monitoringGroupVersion)
+	u.SetKind("ServiceMonitor")
+	u.SetName(planner.instanceName())
+	u.SetNamespace(ns)
+	u.SetLabels(labels)
+	return u
+}
+
+// serviceMonitorObject returns an empty ServiceMonitor of the given name,
+// to be read into.
+func serviceMonitorObject(name, ns string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(monitoringGroupVersion)
+	u.SetKind("ServiceMonitor")
+	u.SetName(name)
+	u.SetNamespace(ns)
+	return u
+}
+
+// updateMetricsService creates, updates or deletes the metrics Service of
+// the server group to match the metrics settings of the share's
+// SmbCommonConfig. It returns true if a change was made.
+func (m *SmbShareManager) updateMetricsService(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	desired := newMetricsServiceForSmb(planner, ns)
+	if desired == nil {
+		gone, err := m.deleteChild(ctx, planner.SmbShare, childResource{
+			"Service",
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{
+				Name:      metricsServiceName(planner.instanceName()),
+				Namespace: ns,
+			}},
+		})
+		return !gone, err
+	}
+	found := &corev1.Service{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{Name: desired.Name, Namespace: ns},
+		found)
+	if errors.IsNotFound(err) {
+		if err := m.setOwner(planner.SmbShare, desired); err != nil {
+			return false, err
+		}
+		m.logger.Info("Creating a new Service",
+			"Service.Namespace", desired.Namespace,
+			"Service.Name", desired.Name)
+		err = m.client.Create(ctx, desired, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to create new Service",
+				"Service.Namespace", desired.Namespace,
+				"Service.Name", desired.Name)
+			return false, err
+		}
+		m.recorder.Eventf(planner.SmbShare,
+			EventNormal,
+			ReasonCreatedService,
+			"Created metrics service %s for SmbShare", desired.Name)
+		return true, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get Service",
+			"Service.Namespace", ns, "Service.Name", desired.Name)
+		return false, err
+	}
+	changed := updateServicePorts(found, desired)
+	if updateServiceSelector(found, desired) {
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+	if err := m.writeChild(ctx, found, desired); err != nil {
+		m.logger.Error(err, "Failed to update Service",
+			"Service.Namespace", found.Namespace,
+			"Service.Name", found.Name)
+		return false, err
+	}
+	m.recorder.Eventf(planner.SmbShare,
+		EventNormal,
+		ReasonUpdatedService,
+		"Updated metrics service %s for SmbShare", found.Name)
+	return true, nil
+}
+
+// updateServiceMonitor creates, updates or deletes the ServiceMonitor of
+// the server group to match the metrics settings of the share's
+// SmbCommonConfig. A warning event is recorded, and nothing is done, if a
+// ServiceMonitor is requested but the ServiceMonitor API is not available
+// in the cluster. It returns true if a change was made.
+func (m *SmbShareManager) updateServiceMonitor(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	if !m.caps.ServiceMonitors {
+		if planner.serviceMonitor() != nil {
+			m.recorder.Event(planner.SmbShare,
+				EventWarning,
+				ReasonServiceMonitorUnsupported,
+				"The ServiceMonitor API of the Prometheus Operator is not "+
+					"available in this cluster; no ServiceMonitor is created")
+		}
+		return false, nil
+	}
+	desired := newServiceMonitorForSmb(planner, ns)
+	if desired == nil {
+		gone, err := m.deleteChild(ctx, planner.SmbShare, childResource{
+			"ServiceMonitor",
+			serviceMonitorObject(planner.instanceName(), ns),
+		})
+		return !gone, err
+	}
+	found := serviceMonitorObject(desired.GetName(), ns)
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{Name: desired.GetName(), Namespace: ns},
+		found)
+	if errors.IsNotFound(err) {
+		if err := m.setOwner(planner.SmbShare, desired); err != nil {
+			return false, err
+		}
+		m.logger.Info("Creating a new ServiceMonitor",
+			"ServiceMonitor.Namespace", desired.GetNamespace(),
+			"ServiceMonitor.Name", desired.GetName())
+		err = m.client.Create(ctx, desired, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to create new ServiceMonitor",
+				"ServiceMonitor.Namespace", desired.GetNamespace(),
+				"ServiceMonitor.Name", desired.GetName())
+			return false, err
+		}
+		m.recorder.Eventf(planner.SmbShare,
+			EventNormal,
+			ReasonCreatedServiceMonitor,
+			"Created ServiceMonitor %s for SmbShare", desired.GetName())
+		return true, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get ServiceMonitor",
+			"ServiceMonitor.Namespace", ns,
+			"ServiceMonitor.Name", desired.GetName())
+		return false, err
+	}
+	if !updateServiceMonitor(found, desired) {
+		return false, nil
+	}
+	if err := m.writeChild(ctx, found, desired); err != nil {
+		m.logger.Error(err, "Failed to update ServiceMonitor",
+			"ServiceMonitor.Namespace", found.GetNamespace(),
+			"ServiceMonitor.Name", found.GetName())
+		return false, err
+	}
+	m.recorder.Eventf(planner.SmbShare,
+		EventNormal,
+		ReasonUpdatedServiceMonitor,
+		"Updated ServiceMonitor %s for SmbShare", found.GetName())
+	return true, nil
+}
+
+// updateServiceMonitor copies the spec and labels of the desired
+// ServiceMonitor into the current one. Labels added to the current
+// ServiceMonitor by others are kept. It returns true if the current
+// ServiceMonitor was changed.
+func updateServiceMonitor(current, desired *unstructured.Unstructured) bool {
+	changed := false
+	if !equality.Semantic.DeepEqual(current.Object["spec"], desired.Object["spec"]) {
+		current.Object["spec"] = desired.Object["spec"]
+		changed = true
+	}
+	labels := current.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for k, v := range desired.GetLabels() {
+		if labels[k] != v {
+			labels[k] = v
+			changed = true
+		}
+	}
+	current.SetLabels(labels)
+	return changed
+}
@@ -0,0 +1,176 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+)
+
+func metricsCommonConfig(
+	sm *sambaoperatorv1alpha1.SmbServiceMonitorSpec) *sambaoperatorv1alpha1.SmbCommonConfig {
+	// ---
+	return &sambaoperatorv1alpha1.SmbCommonConfig{
+		Spec: sambaoperatorv1alpha1.SmbCommonConfigSpec{
+			Metrics: &sambaoperatorv1alpha1.SmbMetricsSpec{ServiceMonitor: sm},
+		},
+	}
+}
+
+func TestBuildPodSpecMetrics(t *testing.T) {
+	share := pvcShare("", nil)
+	share.UID = "abc123"
+	share.Spec.Storage.Pvc.Name = "data"
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	planner := testPlanner(share, nil)
+	podSpec := buildPodSpec(planner, cfg, "data")
+	for _, c := range podSpec.Containers {
+		assert.NotEqual(t, metricsContainerName, c.Name)
+	}
+
+	planner = testPlanner(share, metricsCommonConfig(nil))
+	planner.GlobalConfig.MetricsContainerImage = "quay.io/samba.org/samba-metrics:latest"
+	podSpec = buildPodSpec(planner, cfg, "data")
+	var metrics, smbd *corev1.Container
+	for i := range podSpec.Containers {
+		switch podSpec.Containers[i].Name {
+		case metricsContainerName:
+			metrics = &podSpec.Containers[i]
+		case "samba":
+			smbd = &podSpec.Containers[i]
+		}
+	}
+	require.NotNil(t, metrics)
+	require.NotNil(t, smbd)
+	assert.Equal(t, "quay.io/samba.org/samba-metrics:latest", metrics.Image)
+	assert.Equal(t, []corev1.ContainerPort{{
+		ContainerPort: 8080,
+		Name:          "metrics",
+	}}, metrics.Ports)
+	paths := func(c *corev1.Container) map[string]bool {
+		p := map[string]bool{}
+		for _, m := range c.VolumeMounts {
+			p[m.MountPath] = true
+		}
+		return p
+	}
+	// the exporter and smbd share the samba state, but not the shares
+	assert.True(t, paths(smbd)["/var/lib/samba"])
+	assert.True(t, paths(metrics)["/var/lib/samba"])
+	assert.True(t, paths(smbd)["/mnt/abc123"])
+	assert.False(t, paths(metrics)["/mnt/abc123"])
+}
+
+func TestUpdateServiceMonitor(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := testPlanner(share, metricsCommonConfig(
+		&sambaoperatorv1alpha1.SmbServiceMonitorSpec{
+			Interval: "30s",
+			Labels:   map[string]string{"release": "prometheus"},
+		}))
+	m, recorder := newTestManager(share)
+	// register the ServiceMonitor API, as the Prometheus Operator CRDs do
+	gvk := schema.GroupVersionKind{
+		Group:   "monitoring.coreos.com",
+		Version: "v1",
+		Kind:    "ServiceMonitor",
+	}
+	m.scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+	gvk.Kind = "ServiceMonitorList"
+	m.scheme.AddKnownTypeWithName(gvk, &unstructured.UnstructuredList{})
+	ctx := context.TODO()
+
+	// nothing is created unless the API is available
+	changed, err := m.updateServiceMonitor(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonServiceMonitorUnsupported)
+
+	m.SetCapabilities(Capabilities{ServiceMonitors: true})
+	changed, err = m.updateMetricsService(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonCreatedService)
+	changed, err = m.updateServiceMonitor(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonCreatedServiceMonitor)
+
+	svc := &corev1.Service{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare-metrics"},
+		svc))
+	sm := serviceMonitorObject("myshare", "default")
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare"},
+		sm))
+	if assert.Len(t, sm.GetOwnerReferences(), 1) {
+		assert.Equal(t, "myshare", sm.GetOwnerReferences()[0].Name)
+	}
+	assert.Equal(t, "prometheus", sm.GetLabels()["release"])
+	// the ServiceMonitor selects the metrics service only
+	selector, _, err := unstructured.NestedStringMap(
+		sm.Object, "spec", "selector", "matchLabels")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"samba-operator.samba.org/service": "myshare",
+		"app.kubernetes.io/component":      "metrics",
+	}, selector)
+	for k, v := range selector {
+		assert.Equal(t, v, svc.Labels[k])
+	}
+	endpoints, _, err := unstructured.NestedSlice(sm.Object, "spec", "endpoints")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"port": "metrics", "interval": "30s"},
+	}, endpoints)
+
+	changed, err = m.updateServiceMonitor(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// changing the interval updates the ServiceMonitor
+	planner.CommonConfig.Spec.Metrics.ServiceMonitor.Interval = "1m"
+	changed, err = m.updateServiceMonitor(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonUpdatedServiceMonitor)
+
+	// turning off the metrics deletes the ServiceMonitor and the service
+	planner.CommonConfig.Spec.Metrics = nil
+	changed, err = m.updateServiceMonitor(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonDeleting)
+	changed, err = m.updateMetricsService(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonDeleting)
+	changed, err = m.updateServiceMonitor(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
@@ -0,0 +1,180 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	corev1 "k8s.io/api/core/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// msdfsKey is the key of the globals section turning on DFS support.
+const msdfsKey = smbcc.Key("msdfs")
+
+const msdfsContainerName = "init-msdfs"
+
+// invalidPathChars are the characters that may not be part of the
+// components of a UNC path, nor of the name of a DFS link. Commas separate
+// the targets of a link.
+const invalidPathChars = `"/\:|*?<>,`
+
+// msdfs returns true if a share of the server group is the root of a DFS
+// namespace.
+func (sp *sharePlanner) msdfs() bool {
+	if sp.SmbShare != nil && sp.SmbShare.Spec.MSDFS != nil {
+		return true
+	}
+	shares := sp.groupShares()
+	for i := range shares {
+		if shares[i].Spec.MSDFS != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validPathComponent returns true if c may be the name of a DFS link or a
+// component of a UNC path.
+func validPathComponent(c string) bool {
+	return c != "" && c != "." && c != ".." &&
+		!strings.ContainsAny(c, invalidPathChars) &&
+		strings.IndexFunc(c, unicode.IsControl) < 0
+}
+
+// validUNCPath returns true if p is a UNC path naming a share, or a
+// directory of a share, as \\server\share\path.
+func validUNCPath(p string) bool {
+	if !strings.HasPrefix(p, `\\`) {
+		return false
+	}
+	components := strings.Split(p[2:], `\`)
+	if len(components) < 2 || strings.ContainsAny(components[0], " \t") {
+		return false
+	}
+	for _, c := range components {
+		if !validPathComponent(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// msdfsLinkTarget returns the target of the symbolic link samba reads as
+// the DFS link: the UNC paths of the link, without their leading
+// backslashes, separated by commas.
+func msdfsLinkTarget(link sambaoperatorv1alpha1.SmbShareMSDFSLinkSpec) string {
+	targets := make([]string, len(link.Targets))
+	for i, t := range link.Targets {
+		targets[i] = strings.TrimPrefix(t, `\\`)
+	}
+	return "msdfs:" + strings.Join(targets, ",")
+}
+
+// msdfsCommand returns a command replacing the DFS links of the share's
+// directory with the links of the share. The other files of the directory
+// are left as they are.
+func msdfsCommand(s *sambaoperatorv1alpha1.SmbShare) []string {
+	script := fmt.Sprintf(
+		`d=%s; for l in "$d"/*; do [ -L "$l" ] || continue; `+
+			`case "$(readlink "$l")" in msdfs:*) rm -f "$l" || exit 1;; esac; done`,
+		shellQuote(sharePathOf(s)))
+	for _, link := range s.Spec.MSDFS.Links {
+		script += fmt.Sprintf(`; ln -s %s "$d"/%s || exit 1`,
+			shellQuote(msdfsLinkTarget(link)), shellQuote(link.Name))
+	}
+	return []string{"/bin/sh", "-c", script}
+}
+
+// msdfsInitContainers returns the init containers that create the DFS
+// links of the shares of the server group on their volumes.
+func msdfsInitContainers(
+	planner *sharePlanner, ownPvc string) []corev1.Container {
+	// ---
+	containers := []corev1.Container{}
+	shares := planner.groupShares()
+	for i := range shares {
+		s := &shares[i]
+		if s.Spec.MSDFS == nil || s.Spec.Storage.Pvc == nil {
+			continue
+		}
+		name := msdfsContainerName
+		if len(containers) > 0 {
+			name = fmt.Sprintf("%s-%d", name, len(containers))
+		}
+		// the links are created whoever owns the share's directory
+		root := int64(0)
+		_, shareMount := shareVolumeAndMount(s, sharePvcName(planner, s, ownPvc))
+		containers = append(containers, corev1.Container{
+			Image:        planner.sambaImage(),
+			Name:         name,
+			Command:      msdfsCommand(s),
+			VolumeMounts: []corev1.VolumeMount{shareMount},
+			SecurityContext: &corev1.SecurityContext{
+				RunAsUser: &root,
+			},
+		})
+	}
+	return containers
+}
+
+// validateMSDFS checks that the DFS links of the share have unique, valid
+// names and UNC paths as targets, and that the share's volume is a PVC
+// the links can be created on. If not, the Degraded condition is set on
+// the SmbShare and false is returned.
+func (m *SmbShareManager) validateMSDFS(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	if s.Spec.MSDFS == nil {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(ctx, s, ReasonInvalidMSDFS, msg)
+	}
+	if len(s.Spec.MSDFS.Links) > 0 && s.Spec.Storage.Pvc == nil {
+		return degraded("DFS links can only be created on PVC storage")
+	}
+	seen := map[string]bool{}
+	for _, link := range s.Spec.MSDFS.Links {
+		if !validPathComponent(link.Name) {
+			return degraded(fmt.Sprintf("Invalid DFS link name: %q", link.Name))
+		}
+		// windows clients look up the links regardless of case
+		name := strings.ToLower(link.Name)
+		if seen[name] {
+			return degraded(fmt.Sprintf(
+				"DFS link %s is defined more than once", link.Name))
+		}
+		seen[name] = true
+		if len(link.Targets) == 0 {
+			return degraded(fmt.Sprintf("DFS link %s has no targets", link.Name))
+		}
+		for _, t := range link.Targets {
+			if !validUNCPath(t) {
+				return degraded(fmt.Sprintf(
+					"Invalid target of DFS link %s: %q is not a UNC path",
+					link.Name, t))
+			}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,206 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func msdfsShare(links ...sambaoperatorv1alpha1.SmbShareMSDFSLinkSpec) *sambaoperatorv1alpha1.SmbShare {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.UID = "abc123"
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{}
+	share.Spec.MSDFS = &sambaoperatorv1alpha1.SmbShareMSDFSSpec{Links: links}
+	return share
+}
+
+func TestPlannerMSDFS(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	planner.ConfigState = smbcc.New()
+	_, found := planner.shareOptions()[smbcc.MSDFSRootParam]
+	assert.False(t, found)
+	_, err := planner.update()
+	assert.NoError(t, err)
+	assert.NotContains(t,
+		planner.ConfigState.Configs["myshare"].Globals, msdfsKey)
+
+	share.Spec.MSDFS = &sambaoperatorv1alpha1.SmbShareMSDFSSpec{}
+	assert.Equal(t, smbcc.Yes, planner.shareOptions()[smbcc.MSDFSRootParam])
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t,
+		planner.ConfigState.Configs["myshare"].Globals, msdfsKey)
+	conf, err := planner.ConfigState.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "host msdfs = yes")
+	assert.Contains(t, conf, "msdfs root = yes")
+}
+
+func TestMSDFSInitContainers(t *testing.T) {
+	share := msdfsShare(sambaoperatorv1alpha1.SmbShareMSDFSLinkSpec{
+		Name:    "archive",
+		Targets: []string{`\\files2\archive`},
+	})
+	planner := testPlanner(share, nil)
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "myshare-pvc")
+	found := false
+	names := []string{}
+	for _, c := range podSpec.InitContainers {
+		names = append(names, c.Name)
+		if c.Name == "init-msdfs" {
+			assert.Contains(t, c.Command[2],
+				`ln -s 'msdfs:files2\archive' "$d"/'archive'`)
+			if assert.Len(t, c.VolumeMounts, 1) {
+				assert.Equal(t, "/mnt/abc123", c.VolumeMounts[0].MountPath)
+			}
+			found = true
+		}
+	}
+	assert.True(t, found, names)
+
+	// shares that are not DFS roots have no links
+	share.Spec.MSDFS = nil
+	podSpec = buildPodSpec(planner, &conf.OperatorConfig{}, "myshare-pvc")
+	for _, c := range podSpec.InitContainers {
+		assert.NotEqual(t, "init-msdfs", c.Name)
+	}
+}
+
+func TestMSDFSCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+	root, err := ioutil.TempDir("", "msdfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(root, "keep"), []byte("data"), 0600))
+	require.NoError(t, os.Symlink("keep", filepath.Join(root, "link")))
+	require.NoError(t, os.Symlink(
+		`msdfs:old\share`, filepath.Join(root, "old")))
+
+	share := msdfsShare(
+		sambaoperatorv1alpha1.SmbShareMSDFSLinkSpec{
+			Name:    "it's here",
+			Targets: []string{`\\files2\projects\2026`, `\\files3\projects`},
+		},
+		sambaoperatorv1alpha1.SmbShareMSDFSLinkSpec{
+			Name:    "archive",
+			Targets: []string{`\\files2\archive`},
+		})
+	run := func() {
+		cmd := msdfsCommand(share)
+		script := strings.Replace(cmd[2], "'/mnt/abc123'", shellQuote(root), 1)
+		out, err := exec.Command(cmd[0], cmd[1], script).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	readlink := func(name string) string {
+		t.Helper()
+		target, err := os.Readlink(filepath.Join(root, name))
+		require.NoError(t, err)
+		return target
+	}
+	run()
+	assert.Equal(t, `msdfs:files2\projects\2026,files3\projects`,
+		readlink("it's here"))
+	assert.Equal(t, `msdfs:files2\archive`, readlink("archive"))
+	// links that are no longer listed are removed, other files are kept
+	_, err = os.Lstat(filepath.Join(root, "old"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, "keep", readlink("link"))
+
+	// running again replaces the links
+	share.Spec.MSDFS.Links = share.Spec.MSDFS.Links[1:]
+	share.Spec.MSDFS.Links[0].Targets = []string{`\\files4\archive`}
+	run()
+	assert.Equal(t, `msdfs:files4\archive`, readlink("archive"))
+	_, err = os.Lstat(filepath.Join(root, "it's here"))
+	assert.True(t, os.IsNotExist(err))
+	data, err := ioutil.ReadFile(filepath.Join(root, "keep"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
+
+func TestValidateMSDFS(t *testing.T) {
+	share := msdfsShare(sambaoperatorv1alpha1.SmbShareMSDFSLinkSpec{
+		Name:    "archive",
+		Targets: []string{`\\files2\archive`, `\\files3.example.com\archive\2026`},
+	})
+	planner := testPlanner(share, nil)
+	m, _ := newTestManager(share)
+	valid, err := m.validateMSDFS(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	check := func(msg string, links ...sambaoperatorv1alpha1.SmbShareMSDFSLinkSpec) {
+		t.Helper()
+		share := msdfsShare(links...)
+		m, recorder := newTestManager(share)
+		valid, err := m.validateMSDFS(context.TODO(), testPlanner(share, nil))
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidMSDFS)
+			assert.Contains(t, event, msg)
+		}
+	}
+	link := func(name string, targets ...string) sambaoperatorv1alpha1.SmbShareMSDFSLinkSpec {
+		return sambaoperatorv1alpha1.SmbShareMSDFSLinkSpec{Name: name, Targets: targets}
+	}
+	check(`Invalid DFS link name: "a/b"`, link("a/b", `\\files2\archive`))
+	check(`Invalid DFS link name: ".."`, link("..", `\\files2\archive`))
+	check("DFS link Archive is defined more than once",
+		link("archive", `\\files2\archive`), link("Archive", `\\files3\archive`))
+	check("DFS link archive has no targets", link("archive"))
+	for _, target := range []string{
+		`files2\archive`,
+		`\\files2`,
+		`\\files2\`,
+		`\\files2\archive\`,
+		`\\files 2\archive`,
+		`\\files2\arch,ive`,
+		`//files2/archive`,
+	} {
+		check("Invalid target of DFS link archive", link("archive", target))
+	}
+
+	// the links are created on PVCs only
+	share.Spec.Storage.Pvc = nil
+	share.Spec.Storage.CephFS = &sambaoperatorv1alpha1.SmbShareCephFSSpec{}
+	m, recorder := newTestManager(share)
+	valid, err = m.validateMSDFS(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "DFS links can only be created on PVC storage")
+}
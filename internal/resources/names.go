@@ -0,0 +1,117 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// revisionHashSuffixLength is the length of the dash and hash, of up to 10
+// characters, a StatefulSet appends to its name in the
+// controller-revision-hash label of its pods.
+const revisionHashSuffixLength = 11
+
+// derivedNameError returns a message naming the derived name, or label
+// value, and why Kubernetes rejects it, or an empty string if it has no
+// errors.
+func derivedNameError(what, name string, errs []string) string {
+	if len(errs) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("The %s name %q (%d characters) is invalid: %s",
+		what, name, len(name), strings.Join(errs, "; "))
+}
+
+// shareNameError checks the names of the resources derived from the name
+// and server group of the SmbShare whatever its configuration: the Service
+// named after the server group, and the PVC and ConfigMap named after the
+// share. A message describing the first invalid name is returned, or an
+// empty string if all are valid.
+func shareNameError(s *sambaoperatorv1alpha1.SmbShare) string {
+	group := shareServerGroup(s)
+	msg := derivedNameError(
+		"Service", group, validation.IsDNS1035Label(group))
+	if msg != "" {
+		return msg
+	}
+	if s.Spec.Storage.Pvc != nil && s.Spec.Storage.Pvc.Name == "" {
+		name := pvcName(s)
+		msg = derivedNameError(
+			"PersistentVolumeClaim", name, validation.IsDNS1123Subdomain(name))
+		if msg != "" {
+			return msg
+		}
+	}
+	name := smbConfConfigMapName(s)
+	return derivedNameError(
+		"smb.conf ConfigMap", name, validation.IsDNS1123Subdomain(name))
+}
+
+// nameError checks the names and label values derived from the
+// share and its server group, including those that only exist with some
+// configurations of the share. A message describing the first invalid name
+// is returned, or an empty string if all are valid.
+func (sp *sharePlanner) nameError() string {
+	if msg := shareNameError(sp.SmbShare); msg != "" {
+		return msg
+	}
+	group := sp.instanceName()
+	if sp.metrics() {
+		name := metricsServiceName(group)
+		msg := derivedNameError(
+			"metrics Service", name, validation.IsDNS1035Label(name))
+		if msg != "" {
+			return msg
+		}
+	}
+	if sp.workloadType() != statefulSetWorkload {
+		return ""
+	}
+	name := sp.headlessServiceName()
+	msg := derivedNameError(
+		"headless Service", name, validation.IsDNS1035Label(name))
+	if msg != "" {
+		return msg
+	}
+	maxLen := validation.LabelValueMaxLength - revisionHashSuffixLength
+	if len(group) > maxLen {
+		return fmt.Sprintf(
+			"The server group name %q (%d characters) is longer than the %d "+
+				"characters leaving room for the revision hash in the "+
+				"controller-revision-hash label of the StatefulSet's pods",
+			group, len(group), maxLen)
+	}
+	return ""
+}
+
+// validateNames checks that Kubernetes accepts the names and label values
+// derived from the share and its server group. If not, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateNames(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	if msg := planner.nameError(); msg != "" {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidName, msg)
+	}
+	return true, nil
+}
@@ -0,0 +1,109 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// namedShare returns a share of a server group of its own, with a PVC
+// named after it.
+func namedShare(name string) *sambaoperatorv1alpha1.SmbShare {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = name
+	share.Namespace = "default"
+	share.Status.ServerGroup = name
+	return share
+}
+
+func TestShareNameError(t *testing.T) {
+	// the Service of the server group is named after it
+	assert.Equal(t, "", shareNameError(namedShare(strings.Repeat("a", 63))))
+	msg := shareNameError(namedShare(strings.Repeat("a", 64)))
+	assert.Contains(t, msg, "The Service name")
+	assert.Contains(t, msg, "(64 characters) is invalid")
+	assert.Contains(t, msg, "must be no more than 63 characters")
+	assert.Contains(t,
+		shareNameError(namedShare("1share")), `The Service name "1share"`)
+
+	// long shares of a server group derive long PVC and ConfigMap names
+	share := namedShare(strings.Repeat("a", 244))
+	share.Status.ServerGroup = "grp"
+	assert.Equal(t, "", shareNameError(share))
+	share.Name = strings.Repeat("a", 245)
+	assert.Contains(t, shareNameError(share), "The smb.conf ConfigMap name")
+	share.Name = strings.Repeat("a", 250)
+	assert.Contains(t, shareNameError(share),
+		"The PersistentVolumeClaim name")
+	share.Spec.Storage.Pvc.Name = "mypvc"
+	assert.Contains(t, shareNameError(share), "The smb.conf ConfigMap name")
+
+	// shares not assigned to a server group yet are named after the group
+	// they ask for
+	share = namedShare("one")
+	share.Status.ServerGroup = ""
+	share.Spec.ServerGroup = strings.Repeat("g", 64)
+	assert.Contains(t, shareNameError(share), "The Service name")
+}
+
+func TestPlannerNameError(t *testing.T) {
+	planner := testPlanner(namedShare(strings.Repeat("a", 63)),
+		&sambaoperatorv1alpha1.SmbCommonConfig{})
+	assert.Equal(t, "", planner.nameError())
+
+	// the metrics Service appends -metrics to the server group
+	planner.CommonConfig.Spec.Metrics = &sambaoperatorv1alpha1.SmbMetricsSpec{}
+	assert.Contains(t, planner.nameError(), "The metrics Service name")
+	planner = testPlanner(namedShare(strings.Repeat("a", 55)),
+		planner.CommonConfig)
+	assert.Equal(t, "", planner.nameError())
+
+	// the pods of a StatefulSet are labeled with its name and a hash
+	planner.CommonConfig.Spec.Metrics = nil
+	planner.CommonConfig.Spec.WorkloadType = string(statefulSetWorkload)
+	planner = testPlanner(namedShare(strings.Repeat("a", 52)),
+		planner.CommonConfig)
+	assert.Equal(t, "", planner.nameError())
+	planner = testPlanner(namedShare(strings.Repeat("a", 53)),
+		planner.CommonConfig)
+	assert.Contains(t, planner.nameError(),
+		"(53 characters) is longer than the 52 characters")
+}
+
+func TestValidateNames(t *testing.T) {
+	share := namedShare(strings.Repeat("a", 64))
+	m, recorder := newTestManager(share)
+	valid, err := m.validateNames(context.TODO(), testPlanner(share, nil))
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events, ReasonInvalidName)
+	}
+
+	share = namedShare("myshare")
+	m, recorder = newTestManager(share)
+	valid, err = m.validateNames(context.TODO(), testPlanner(share, nil))
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+}
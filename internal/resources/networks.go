@@ -0,0 +1,150 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+const (
+	// networksAnnotationKey is the pod annotation asking Multus to attach
+	// the pod to secondary networks.
+	networksAnnotationKey = "k8s.v1.cni.cncf.io/networks"
+	// networkStatusAnnotationKey is the pod annotation Multus reports the
+	// networks a pod is attached to in.
+	networkStatusAnnotationKey = "k8s.v1.cni.cncf.io/network-status"
+)
+
+// networkSelection is an element of the networks annotation, in the JSON
+// format of the network attachment selection annotation.
+type networkSelection struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Interface string `json:"interface,omitempty"`
+}
+
+// networkStatus is an element of the network-status annotation of a pod.
+type networkStatus struct {
+	Name      string   `json:"name"`
+	Interface string   `json:"interface,omitempty"`
+	IPs       []string `json:"ips,omitempty"`
+	Default   bool     `json:"default,omitempty"`
+}
+
+// networkAttachments returns the secondary networks the server pods are
+// attached to. Attachments set on the share override those of the common
+// config.
+func (sp *sharePlanner) networkAttachments() []sambaoperatorv1alpha1.SmbNetworkAttachment {
+	s := sp.SmbShare
+	if s != nil && s.Spec.PodSettings != nil &&
+		len(s.Spec.PodSettings.NetworkAttachments) > 0 {
+		// ---
+		return s.Spec.PodSettings.NetworkAttachments
+	}
+	if sp.CommonConfig != nil && sp.CommonConfig.Spec.PodSettings != nil {
+		return sp.CommonConfig.Spec.PodSettings.NetworkAttachments
+	}
+	return nil
+}
+
+// networksAnnotation returns the value of the networks annotation of the
+// server pods, or an empty string if the pods are only attached to the
+// cluster network.
+func (sp *sharePlanner) networksAnnotation() string {
+	attachments := sp.networkAttachments()
+	if len(attachments) == 0 {
+		return ""
+	}
+	selections := make([]networkSelection, 0, len(attachments))
+	for _, a := range attachments {
+		selections = append(selections, networkSelection{
+			Name:      a.Name,
+			Namespace: a.Namespace,
+			Interface: a.Interface,
+		})
+	}
+	// marshaling structs of strings can not fail
+	data, _ := json.Marshal(selections)
+	return string(data)
+}
+
+// podNetworkAddresses returns the addresses of the pod on the secondary
+// networks it is attached to, as reported in its network-status
+// annotation.
+func podNetworkAddresses(pod *corev1.Pod) []string {
+	raw := pod.Annotations[networkStatusAnnotationKey]
+	if raw == "" {
+		return nil
+	}
+	statuses := []networkStatus{}
+	if err := json.Unmarshal([]byte(raw), &statuses); err != nil {
+		return nil
+	}
+	addrs := []string{}
+	for _, st := range statuses {
+		if st.Default {
+			// the cluster network is reached through the Service
+			continue
+		}
+		addrs = append(addrs, st.IPs...)
+	}
+	return addrs
+}
+
+// updateNetworkStatus records the addresses of the ready server pods on
+// their secondary networks in the status of the SmbShare. The addresses are
+// cleared when the pods are not attached to secondary networks. Returns true
+// if the status was changed.
+func (m *SmbShareManager) updateNetworkStatus(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	var addrs []string
+	if len(planner.networkAttachments()) > 0 {
+		pods := &corev1.PodList{}
+		err := m.client.List(ctx, pods,
+			rtclient.InNamespace(ns),
+			rtclient.MatchingLabels{
+				svcSelectorKey: labelValue(planner.instanceName()),
+			})
+		if err != nil {
+			m.logger.Error(err, "Failed to list pods", "namespace", ns)
+			return false, err
+		}
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if pod.DeletionTimestamp != nil || !podReady(pod) {
+				continue
+			}
+			addrs = append(addrs, podNetworkAddresses(pod)...)
+		}
+		if len(addrs) > 0 {
+			addrs = sortedUnique(addrs)
+		}
+	}
+	if equality.Semantic.DeepEqual(s.Status.NetworkAddresses, addrs) {
+		return false, nil
+	}
+	s.Status.NetworkAddresses = addrs
+	return true, m.client.Status().Update(ctx, s)
+}
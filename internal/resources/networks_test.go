@@ -0,0 +1,121 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+)
+
+func TestBuildDeploymentNetworkAttachments(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		NetworkAttachments: []sambaoperatorv1alpha1.SmbNetworkAttachment{
+			{Name: "storage", Interface: "net1"},
+			{Name: "backup", Namespace: "infra"},
+		},
+	}
+	planner := testPlanner(share, nil)
+	current := buildDeployment(
+		&conf.OperatorConfig{}, planner, "myshare-pvc", "default")
+	_, found := current.Spec.Template.Annotations[networksAnnotationKey]
+	assert.False(t, found)
+
+	planner = testPlanner(share, common)
+	desired := buildDeployment(
+		&conf.OperatorConfig{}, planner, "myshare-pvc", "default")
+	assert.Equal(t,
+		`[{"name":"storage","interface":"net1"},`+
+			`{"name":"backup","namespace":"infra"}]`,
+		desired.Spec.Template.Annotations[networksAnnotationKey])
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t,
+		desired.Spec.Template.Annotations[networksAnnotationKey],
+		current.Spec.Template.Annotations[networksAnnotationKey])
+	assert.False(t, updatePodTemplateSettings(current, desired))
+
+	// the attachments of the share override those of the common config
+	share.Spec.PodSettings = &sambaoperatorv1alpha1.SmbSharePodSettings{
+		NetworkAttachments: []sambaoperatorv1alpha1.SmbNetworkAttachment{
+			{Name: "fast"},
+		},
+	}
+	assert.Equal(t, `[{"name":"fast"}]`, planner.networksAnnotation())
+}
+
+func TestUpdateNetworkStatus(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := testPlanner(share, nil)
+	pod := func(name, status string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{svcSelectorKey: "myshare"},
+				Annotations: map[string]string{
+					networkStatusAnnotationKey: status,
+				},
+			},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{{
+					Type:   corev1.PodReady,
+					Status: corev1.ConditionTrue,
+				}},
+			},
+		}
+	}
+	m, _ := newTestManager(share,
+		pod("myshare-a", `[
+			{"name":"cbr0","ips":["10.244.0.5"],"default":true},
+			{"name":"default/storage","interface":"net1","ips":["192.0.2.10"]}
+		]`),
+		pod("myshare-b", "not json"))
+	ctx := context.Background()
+
+	// pods only attached to the cluster network report no addresses
+	changed, err := m.updateNetworkStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	share.Spec.PodSettings = &sambaoperatorv1alpha1.SmbSharePodSettings{
+		NetworkAttachments: []sambaoperatorv1alpha1.SmbNetworkAttachment{
+			{Name: "storage", Interface: "net1"},
+		},
+	}
+	changed, err = m.updateNetworkStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []string{"192.0.2.10"}, share.Status.NetworkAddresses)
+	changed, err = m.updateNetworkStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	share.Spec.PodSettings = nil
+	changed, err = m.updateNetworkStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Nil(t, share.Status.NetworkAddresses)
+}
@@ -0,0 +1,115 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+const (
+	// normalizeContainerName is the name of the init container normalizing
+	// the file names of a share.
+	normalizeContainerName = "init-normalize"
+
+	normalizationNone = "none"
+	normalizationNFC  = "nfc"
+	normalizationNFD  = "nfd"
+)
+
+// normalizeScript renames the entries below the directory given as first
+// argument whose names are not in the normalization form given as second
+// argument. Directories are walked bottom-up, so that the entries of a
+// directory are renamed before the directory itself. Names whose
+// normalized form is already taken are left as they are.
+const normalizeScript = `import os, sys, unicodedata
+root, form = sys.argv[1], sys.argv[2].upper()
+for d, dirs, files in os.walk(root, topdown=False):
+    for name in dirs + files:
+        want = unicodedata.normalize(form, name)
+        if want == name:
+            continue
+        src, dst = os.path.join(d, name), os.path.join(d, want)
+        if os.path.lexists(dst):
+            print("not renaming %r: %r exists" % (src, dst), file=sys.stderr)
+            continue
+        os.rename(src, dst)
+`
+
+// unicodeNormalization returns the normalization form the file names of
+// the share are kept in, or an empty string if they are left as they are.
+func unicodeNormalization(s *sambaoperatorv1alpha1.SmbShare) string {
+	if n := s.Spec.UnicodeNormalization; n != normalizationNone {
+		return n
+	}
+	return ""
+}
+
+// normalizeCommand returns a command renaming the entries below dir to
+// the normalization form.
+func normalizeCommand(dir, form string) []string {
+	return []string{"python3", "-c", normalizeScript, dir, form}
+}
+
+// normalizeInitContainers returns the init containers that normalize the
+// file names of the shares of the server group on their volumes.
+func normalizeInitContainers(
+	planner *sharePlanner, ownPvc string) []corev1.Container {
+	// ---
+	containers := []corev1.Container{}
+	shares := planner.groupShares()
+	for i := range shares {
+		s := &shares[i]
+		form := unicodeNormalization(s)
+		if form == "" || s.Spec.Storage.Pvc == nil {
+			continue
+		}
+		name := normalizeContainerName
+		if len(containers) > 0 {
+			name = fmt.Sprintf("%s-%d", name, len(containers))
+		}
+		// the files of all users are renamed
+		root := int64(0)
+		_, shareMount := shareVolumeAndMount(s, sharePvcName(planner, s, ownPvc))
+		containers = append(containers, corev1.Container{
+			Image:        planner.sambaImage(),
+			Name:         name,
+			Command:      normalizeCommand(sharePathOf(s), form),
+			VolumeMounts: []corev1.VolumeMount{shareMount},
+			SecurityContext: &corev1.SecurityContext{
+				RunAsUser: &root,
+			},
+		})
+	}
+	return containers
+}
+
+// validateUnicodeNormalization checks that a share normalizing its file
+// names has a PVC the names can be normalized on. If not, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateUnicodeNormalization(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	if unicodeNormalization(s) == "" || s.Spec.Storage.Pvc != nil {
+		return true, nil
+	}
+	return false, m.setDegraded(ctx, s, ReasonInvalidUnicodeNormalization,
+		"File names can only be normalized on PVC storage")
+}
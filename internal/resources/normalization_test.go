@@ -0,0 +1,151 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+)
+
+const (
+	// "cafe" with a precomposed e acute, as written by Windows clients
+	composedName = "caf\u00e9"
+	// "cafe" with an e followed by a combining acute accent, as stored by
+	// macOS file systems
+	decomposedName = "cafe\u0301"
+)
+
+func TestNormalizeCommand(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("no python3")
+	}
+	root, err := ioutil.TempDir("", "normalize")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, decomposedName)
+	require.NoError(t, os.Mkdir(dir, 0700))
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, decomposedName+".txt"), []byte("data"), 0600))
+	run := func(form string) {
+		cmd := normalizeCommand(root, form)
+		out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	// the decomposed names are found under their composed form
+	run(normalizationNFC)
+	data, err := ioutil.ReadFile(
+		filepath.Join(root, composedName, composedName+".txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	_, err = os.Stat(filepath.Join(root, decomposedName))
+	assert.True(t, os.IsNotExist(err))
+
+	// and back
+	run(normalizationNFD)
+	_, err = os.Stat(filepath.Join(root, decomposedName, decomposedName+".txt"))
+	assert.NoError(t, err)
+
+	// names whose normalized form is taken are left alone
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(root, composedName), []byte("other"), 0600))
+	run(normalizationNFC)
+	_, err = os.Stat(filepath.Join(root, decomposedName))
+	assert.NoError(t, err)
+	data, err = ioutil.ReadFile(filepath.Join(root, composedName))
+	require.NoError(t, err)
+	assert.Equal(t, "other", string(data))
+}
+
+func TestNormalizeInitContainers(t *testing.T) {
+	share := pvcShare("", nil)
+	share.UID = "abc123"
+	share.Spec.Storage.Pvc.Name = "data"
+	share.Spec.Storage.Path = "docs"
+	planner := testPlanner(share, nil)
+	assert.Empty(t, normalizeInitContainers(planner, "data"))
+	share.Spec.UnicodeNormalization = normalizationNone
+	assert.Empty(t, normalizeInitContainers(planner, "data"))
+
+	share.Spec.UnicodeNormalization = normalizationNFC
+	containers := normalizeInitContainers(planner, "data")
+	require.Len(t, containers, 1)
+	c := containers[0]
+	assert.Equal(t, normalizeContainerName, c.Name)
+	assert.Equal(t,
+		[]string{"python3", "-c", normalizeScript, "/mnt/abc123/docs", "nfc"},
+		c.Command)
+	if assert.Len(t, c.VolumeMounts, 1) {
+		assert.Equal(t, "/mnt/abc123", c.VolumeMounts[0].MountPath)
+	}
+	if assert.NotNil(t, c.SecurityContext.RunAsUser) {
+		assert.Equal(t, int64(0), *c.SecurityContext.RunAsUser)
+	}
+	// the names are normalized before the DFS links are created
+	share.Spec.MSDFS = &sambaoperatorv1alpha1.SmbShareMSDFSSpec{
+		Links: []sambaoperatorv1alpha1.SmbShareMSDFSLinkSpec{{
+			Name:    "docs",
+			Targets: []string{`\\server\docs`},
+		}},
+	}
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "data")
+	names := []string{}
+	for _, c := range podSpec.InitContainers {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t,
+		[]string{"init-path", "init-normalize", "init-msdfs", "check-config"},
+		names)
+}
+
+func TestValidateUnicodeNormalization(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.UnicodeNormalization = normalizationNFD
+	m, recorder := newTestManager(share)
+	valid, err := m.validateUnicodeNormalization(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	event := <-recorder.Events
+	assert.Contains(t, event, ReasonInvalidUnicodeNormalization)
+	assert.Contains(t, event, "File names can only be normalized on PVC storage")
+
+	share.Spec.UnicodeNormalization = normalizationNone
+	m, _ = newTestManager(share)
+	valid, err = m.validateUnicodeNormalization(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share = pvcShare("", nil)
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.UnicodeNormalization = normalizationNFC
+	m, _ = newTestManager(share)
+	valid, err = m.validateUnicodeNormalization(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
@@ -0,0 +1,303 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+const (
+	// managedByLabelKey is the label naming the tool managing a resource,
+	// set to samba-operator on the resources the operator creates.
+	managedByLabelKey = "app.kubernetes.io/managed-by"
+	// adoptResourcesAnnotationKey is the SmbShare annotation allowing the
+	// operator to adopt resources of the share created outside of the
+	// operator, such as those of a samba server deployed by hand.
+	adoptResourcesAnnotationKey = "samba-operator.samba.org/adopt-resources"
+)
+
+// setOwner makes the SmbShare the controller of a resource created for it,
+// so that the resource is garbage collected along with the share. Owner
+// references can not cross namespaces: the resources of shares outside of
+// the working namespace are left without one, and are only removed by the
+// share's finalizer.
+func (m *SmbShareManager) setOwner(
+	s *sambaoperatorv1alpha1.SmbShare, obj metav1.Object) error {
+	// ---
+	if s.Namespace != obj.GetNamespace() {
+		return nil
+	}
+	return controllerutil.SetControllerReference(s, obj, m.scheme)
+}
+
+// ownedChildren returns the resources that are controlled by a share: the
+// resources of its server group, those of its self test and the PVC created
+// for the share.
+func (m *SmbShareManager) ownedChildren(
+	s *sambaoperatorv1alpha1.SmbShare) []childResource {
+	// ---
+	children := append(m.groupResources(s), m.selfTestResources(s)...)
+	if shareNeedsPvc(s) {
+		children = append(children, childResource{
+			"PersistentVolumeClaim",
+			&corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      pvcName(s),
+					Namespace: m.cfg.WorkingNamespace,
+				},
+			},
+		})
+	}
+	return children
+}
+
+// adoptChildren makes the SmbShare the controller of the resources created
+// for it that lack a controller, such as resources created by earlier
+// versions of the operator or restored from a backup. The resources of a
+// server group controlled by another share of the group are left alone.
+// A PVC retained beyond the life of the share is instead released by the
+// share, so it is not garbage collected with the share. It returns true if
+// a resource was updated.
+func (m *SmbShareManager) adoptChildren(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	changed := false
+	for _, child := range m.ownedChildren(s) {
+		if child.obj.GetNamespace() != s.Namespace {
+			// see setOwner
+			continue
+		}
+		key := types.NamespacedName{
+			Name:      child.obj.GetName(),
+			Namespace: child.obj.GetNamespace(),
+		}
+		err := m.client.Get(ctx, key, child.obj)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			m.logger.Error(err, "Failed to get "+child.kind,
+				child.kind+".Namespace", key.Namespace,
+				child.kind+".Name", key.Name)
+			return false, err
+		}
+		if child.obj.GetDeletionTimestamp() != nil {
+			continue
+		}
+		var updated bool
+		_, isPvc := child.obj.(*corev1.PersistentVolumeClaim)
+		if isPvc && pvcRetained(s) {
+			updated = releaseChild(s, child.obj)
+		} else if metav1.GetControllerOf(child.obj) == nil {
+			if err := m.setOwner(s, child.obj); err != nil {
+				return false, err
+			}
+			updated = true
+		}
+		if !updated {
+			continue
+		}
+		m.logger.Info("Updating owner references of "+child.kind,
+			child.kind+".Namespace", key.Namespace,
+			child.kind+".Name", key.Name)
+		err = m.client.Update(
+			ctx, child.obj, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to update "+child.kind,
+				child.kind+".Namespace", key.Namespace,
+				child.kind+".Name", key.Name)
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// unmanagedChild returns true if obj was created outside of the operator:
+// it has no controller, lacks the label of the resources created by the
+// operator and has no fields set by the operator.
+func unmanagedChild(obj metav1.Object) bool {
+	if metav1.GetControllerOf(obj) != nil ||
+		obj.GetLabels()[managedByLabelKey] == "samba-operator" {
+		// ---
+		return false
+	}
+	for _, entry := range obj.GetManagedFields() {
+		if legacyFieldManagers[entry.Manager] {
+			return false
+		}
+	}
+	return true
+}
+
+// adoptUnmanagedChildren takes over the resources of the share that were
+// created outside of the operator, labeling them as managed by the
+// operator and making the share their controller, so that they are
+// reconciled like the resources the operator creates. Resources are only
+// adopted from a share annotated with adopt-resources, to keep the
+// operator from taking over unrelated resources of the same name. If a
+// resource can not be adopted, the Degraded condition is set on the
+// SmbShare and false is returned.
+func (m *SmbShareManager) adoptUnmanagedChildren(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	adopt := s.Annotations[adoptResourcesAnnotationKey] == "true"
+	for _, child := range m.ownedChildren(s) {
+		key := types.NamespacedName{
+			Name:      child.obj.GetName(),
+			Namespace: child.obj.GetNamespace(),
+		}
+		err := m.client.Get(ctx, key, child.obj)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			m.logger.Error(err, "Failed to get "+child.kind,
+				child.kind+".Namespace", key.Namespace,
+				child.kind+".Name", key.Name)
+			return false, err
+		}
+		if !unmanagedChild(child.obj) {
+			continue
+		}
+		if !adopt {
+			msg := fmt.Sprintf(
+				"%s %s/%s was not created by the operator; "+
+					"annotate the SmbShare with %s=true to adopt it",
+				child.kind, key.Namespace, key.Name,
+				adoptResourcesAnnotationKey)
+			return false, m.setDegraded(ctx, s, ReasonUnmanagedResource, msg)
+		}
+		labels := child.obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[managedByLabelKey] = "samba-operator"
+		child.obj.SetLabels(labels)
+		_, isPvc := child.obj.(*corev1.PersistentVolumeClaim)
+		if !isPvc || !pvcRetained(s) {
+			if err := m.setOwner(s, child.obj); err != nil {
+				return false, err
+			}
+		}
+		m.logger.Info("Adopting "+child.kind,
+			child.kind+".Namespace", key.Namespace,
+			child.kind+".Name", key.Name)
+		err = m.client.Update(
+			ctx, child.obj, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to update "+child.kind,
+				child.kind+".Namespace", key.Namespace,
+				child.kind+".Name", key.Name)
+			return false, err
+		}
+		m.recorder.Eventf(s,
+			EventNormal,
+			ReasonAdoptedResource,
+			"Adopted %s %s created outside of the operator",
+			child.kind, key.Name)
+	}
+	return true, nil
+}
+
+// releaseChild removes the owner references to the SmbShare from obj. It
+// returns true if a reference was removed.
+func releaseChild(s *sambaoperatorv1alpha1.SmbShare, obj metav1.Object) bool {
+	refs := []metav1.OwnerReference{}
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID != s.UID {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == len(obj.GetOwnerReferences()) {
+		return false
+	}
+	obj.SetOwnerReferences(refs)
+	return true
+}
+
+// managedResources returns the resources the operator may manage for the
+// share: the resources owned by the share, along with the ConfigMaps of its
+// configuration.
+func (m *SmbShareManager) managedResources(
+	s *sambaoperatorv1alpha1.SmbShare) []childResource {
+	// ---
+	children := m.ownedChildren(s)
+	return append(children,
+		childResource{
+			"ConfigMap",
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ConfigMapName,
+					Namespace: m.cfg.WorkingNamespace,
+				},
+			},
+		},
+		childResource{
+			"ConfigMap",
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      smbConfConfigMapName(s),
+					Namespace: s.Namespace,
+				},
+			},
+		})
+}
+
+// updateResourcesStatus records the managed resources of the share that
+// exist in the status of the SmbShare. It returns true if the status was
+// changed.
+func (m *SmbShareManager) updateResourcesStatus(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	var refs []sambaoperatorv1alpha1.SmbShareResourceRef
+	if s.Status.ServerGroup != "" {
+		for _, child := range m.managedResources(s) {
+			key := types.NamespacedName{
+				Name:      child.obj.GetName(),
+				Namespace: child.obj.GetNamespace(),
+			}
+			err := m.client.Get(ctx, key, child.obj)
+			if errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				m.logger.Error(err, "Failed to get "+child.kind,
+					child.kind+".Namespace", key.Namespace,
+					child.kind+".Name", key.Name)
+				return false, err
+			}
+			refs = append(refs, sambaoperatorv1alpha1.SmbShareResourceRef{
+				Kind:      child.kind,
+				Name:      key.Name,
+				Namespace: key.Namespace,
+			})
+		}
+	}
+	if equality.Semantic.DeepEqual(s.Status.Resources, refs) {
+		return false, nil
+	}
+	s.Status.Resources = refs
+	return true, m.client.Status().Update(ctx, s)
+}
@@ -0,0 +1,261 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// ownedShare returns a share, in the working namespace of the test
+// manager, for which a PVC, a Deployment, a Service and a
+// PodDisruptionBudget are created.
+func ownedShare() (*sambaoperatorv1alpha1.SmbShare, *sharePlanner) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Namespace = "default"
+	share.UID = "1234"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.DisruptionBudget = &sambaoperatorv1alpha1.SmbDisruptionBudgetSpec{
+		SingleReplica: true,
+	}
+	return share, testPlanner(share, common)
+}
+
+// createChildren creates the resources of the share, returning them as
+// stored by the client.
+func createChildren(
+	t *testing.T,
+	m *SmbShareManager,
+	planner *sharePlanner) []childObject {
+	// ---
+	ctx := context.TODO()
+	m.cfg.SmbdContainerName = "samba"
+	_, _, err := m.getOrCreatePvc(ctx, planner.SmbShare, "default")
+	require.NoError(t, err)
+	_, _, err = m.getOrCreateDeployment(ctx, planner, "default")
+	require.NoError(t, err)
+	_, _, err = m.getOrCreateService(ctx, planner, "default")
+	require.NoError(t, err)
+	_, err = m.updatePodDisruptionBudget(ctx, planner, "default")
+	require.NoError(t, err)
+
+	children := []childObject{
+		&corev1.PersistentVolumeClaim{},
+		&appsv1.Deployment{},
+		&corev1.Service{},
+		&policyv1beta1.PodDisruptionBudget{},
+	}
+	names := []string{"myshare-pvc", "myshare", "myshare", "myshare"}
+	for i, obj := range children {
+		key := types.NamespacedName{Namespace: "default", Name: names[i]}
+		require.NoError(t, m.client.Get(ctx, key, obj))
+	}
+	return children
+}
+
+func TestChildrenOwnerReferences(t *testing.T) {
+	share, planner := ownedShare()
+	m, _ := newTestManager(share)
+	for _, obj := range createChildren(t, m, planner) {
+		owner := metav1.GetControllerOf(obj)
+		if assert.NotNil(t, owner, "%T", obj) {
+			assert.Equal(t, "SmbShare", owner.Kind)
+			assert.Equal(t, "myshare", owner.Name)
+			assert.Equal(t, share.UID, owner.UID)
+			assert.True(t, *owner.BlockOwnerDeletion)
+		}
+	}
+
+	// a retained PVC is not deleted with the share
+	share, planner = ownedShare()
+	share.Spec.Storage.Pvc.RetainPolicy = "Retain"
+	m, _ = newTestManager(share)
+	children := createChildren(t, m, planner)
+	assert.Empty(t, children[0].GetOwnerReferences())
+	assert.NotNil(t, metav1.GetControllerOf(children[1]))
+
+	// owner references can not cross namespaces
+	share, planner = ownedShare()
+	share.Namespace = "other"
+	m, _ = newTestManager(share)
+	for _, obj := range createChildren(t, m, planner) {
+		assert.Empty(t, obj.GetOwnerReferences(), "%T", obj)
+	}
+}
+
+func TestAdoptChildren(t *testing.T) {
+	share, _ := ownedShare()
+	share.Spec.Storage.Pvc.RetainPolicy = "Retain"
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default"}
+	}
+	yes := true
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: meta("myshare-pvc")}
+	pvc.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: sambaoperatorv1alpha1.GroupVersion.String(),
+		Kind:       "SmbShare",
+		Name:       "myshare",
+		UID:        share.UID,
+		Controller: &yes,
+	}}
+	dep := &appsv1.Deployment{ObjectMeta: meta("myshare")}
+	svc := &corev1.Service{ObjectMeta: meta("myshare")}
+	// the service is controlled by another share of the group
+	svc.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: sambaoperatorv1alpha1.GroupVersion.String(),
+		Kind:       "SmbShare",
+		Name:       "othershare",
+		UID:        "5678",
+		Controller: &yes,
+	}}
+	m, _ := newTestManager(share, pvc, dep, svc)
+
+	changed, err := m.adoptChildren(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	ctx := context.TODO()
+	foundPvc := &corev1.PersistentVolumeClaim{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare-pvc"},
+		foundPvc))
+	assert.Empty(t, foundPvc.OwnerReferences)
+	foundDep := &appsv1.Deployment{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare"}, foundDep))
+	if owner := metav1.GetControllerOf(foundDep); assert.NotNil(t, owner) {
+		assert.Equal(t, share.UID, owner.UID)
+	}
+	foundSvc := &corev1.Service{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare"}, foundSvc))
+	if owner := metav1.GetControllerOf(foundSvc); assert.NotNil(t, owner) {
+		assert.Equal(t, types.UID("5678"), owner.UID)
+	}
+
+	changed, err = m.adoptChildren(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestUpdateResourcesStatus(t *testing.T) {
+	share, planner := ownedShare()
+	m, _ := newTestManager(share)
+	ctx := context.TODO()
+
+	// nothing was created for a share without a server group
+	share.Status.ServerGroup = ""
+	changed, err := m.updateResourcesStatus(ctx, share)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Empty(t, share.Status.Resources)
+
+	share.Status.ServerGroup = "myshare"
+	createChildren(t, m, planner)
+	changed, err = m.updateResourcesStatus(ctx, share)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []sambaoperatorv1alpha1.SmbShareResourceRef{
+		{Kind: "PodDisruptionBudget", Name: "myshare", Namespace: "default"},
+		{Kind: "Deployment", Name: "myshare", Namespace: "default"},
+		{Kind: "Service", Name: "myshare", Namespace: "default"},
+		{Kind: "PersistentVolumeClaim", Name: "myshare-pvc", Namespace: "default"},
+	}, share.Status.Resources)
+	found := &sambaoperatorv1alpha1.SmbShare{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare"}, found))
+	assert.Equal(t, share.Status.Resources, found.Status.Resources)
+
+	changed, err = m.updateResourcesStatus(ctx, share)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// deleted resources are dropped
+	require.NoError(t, m.client.Delete(ctx, &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "myshare", Namespace: "default"},
+	}))
+	changed, err = m.updateResourcesStatus(ctx, share)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, share.Status.Resources, 3)
+	assert.Equal(t, "Deployment", share.Status.Resources[0].Kind)
+}
+
+func TestAdoptUnmanagedChildren(t *testing.T) {
+	share, planner := ownedShare()
+	share.Status.ServerGroup = "myshare"
+	// a service deployed by hand for the samba server
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "myshare", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "my-samba"},
+			Ports:    []corev1.ServicePort{{Name: "smb", Port: 4450}},
+		},
+	}
+	m, recorder := newTestManager(share, svc)
+	ctx := context.TODO()
+
+	// resources are not adopted without the annotation
+	valid, err := m.adoptUnmanagedChildren(ctx, share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonUnmanagedResource)
+		assert.Contains(t, event, "Service default/myshare was not created by the operator")
+	}
+	found := &corev1.Service{}
+	key := types.NamespacedName{Namespace: "default", Name: "myshare"}
+	require.NoError(t, m.client.Get(ctx, key, found))
+	assert.Nil(t, metav1.GetControllerOf(found))
+
+	share.Annotations = map[string]string{adoptResourcesAnnotationKey: "true"}
+	valid, err = m.adoptUnmanagedChildren(ctx, share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonAdoptedResource)
+	require.NoError(t, m.client.Get(ctx, key, found))
+	if owner := metav1.GetControllerOf(found); assert.NotNil(t, owner) {
+		assert.Equal(t, share.UID, owner.UID)
+	}
+	assert.Equal(t, "samba-operator", found.Labels[managedByLabelKey])
+	assert.False(t, unmanagedChild(found))
+
+	// the adopted service is reconciled like one created by the operator
+	changed, err := m.updateService(ctx, planner, found, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	require.NoError(t, m.client.Get(ctx, key, found))
+	assert.Equal(t,
+		map[string]string{svcSelectorKey: labelValue("myshare")},
+		found.Spec.Selector)
+	assert.Equal(t, int32(445), found.Spec.Ports[0].Port)
+
+	// resources created by the operator are left alone
+	valid, err = m.adoptUnmanagedChildren(ctx, share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+}
@@ -0,0 +1,259 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+const (
+	// tdbsamPassdb stores the users in a database local to each server.
+	tdbsamPassdb = "tdbsam"
+	// ldapsamPassdb looks the users up on an LDAP server.
+	ldapsamPassdb = "ldapsam"
+
+	// ldapPasswordVolName is the name of the volume holding the password
+	// the samba servers bind to the LDAP server with.
+	ldapPasswordVolName = "ldap-password"
+	// passdbContainerName is the name of the init container storing the
+	// LDAP password in the secrets database of the samba servers.
+	passdbContainerName = "init-passdb"
+	// defaultLDAPPasswordKey is the key of the secret holding the LDAP
+	// password, unless one is configured.
+	defaultLDAPPasswordKey = "password"
+)
+
+// passdbType returns the passdb backend of the security config, or an
+// empty string if the security config is not in user mode.
+func (sp *sharePlanner) passdbType() string {
+	if sp.securityMode() != userMode {
+		return ""
+	}
+	if sp.SecurityConfig == nil || sp.SecurityConfig.Spec.PassdbBackend == nil ||
+		sp.SecurityConfig.Spec.PassdbBackend.Type == "" {
+		// ---
+		return tdbsamPassdb
+	}
+	return sp.SecurityConfig.Spec.PassdbBackend.Type
+}
+
+// ldapPassdb returns the LDAP settings of the ldapsam passdb backend, or
+// nil if another backend is used.
+func (sp *sharePlanner) ldapPassdb() *sambaoperatorv1alpha1.SmbSecurityLDAPSpec {
+	if sp.passdbType() != ldapsamPassdb {
+		return nil
+	}
+	return sp.SecurityConfig.Spec.PassdbBackend.LDAP
+}
+
+// passdbOptions returns the global options of the ldapsam passdb backend,
+// or nil if another backend is used. The password of the admin DN is
+// stored in the secrets database of the servers by an init container.
+func (sp *sharePlanner) passdbOptions() smbcc.SmbOptions {
+	ldap := sp.ldapPassdb()
+	if ldap == nil {
+		return nil
+	}
+	opts := smbcc.SmbOptions{
+		smbcc.PassdbBackendParam: ldapsamPassdb + ":" + ldap.URL,
+		smbcc.LDAPSuffixParam:    ldap.Suffix,
+		smbcc.LDAPAdminDNParam:   ldap.AdminDN,
+	}
+	if ldap.UserSuffix != "" {
+		opts[smbcc.LDAPUserSuffixParam] = ldap.UserSuffix
+	}
+	if ldap.GroupSuffix != "" {
+		opts[smbcc.LDAPGroupSuffixParam] = ldap.GroupSuffix
+	}
+	if ldap.SSL != "" {
+		opts[smbcc.LDAPSSLParam] = ldap.SSL
+	}
+	return opts
+}
+
+// passdbKey returns the key of the globals section configuring the passdb
+// backend, or an empty key if the default tdbsam backend is used. The key
+// is derived from the options.
+func (sp *sharePlanner) passdbKey() smbcc.Key {
+	opts := sp.passdbOptions()
+	if len(opts) == 0 {
+		return ""
+	}
+	// maps of strings always marshal, with sorted keys
+	data, _ := json.Marshal(opts)
+	return smbcc.Key(fmt.Sprintf("passdb_%x", sha256.Sum256(data))[:15])
+}
+
+func ldapPasswordKey(ldap *sambaoperatorv1alpha1.SmbSecurityLDAPSpec) string {
+	if ldap.AdminPasswordKey != "" {
+		return ldap.AdminPasswordKey
+	}
+	return defaultLDAPPasswordKey
+}
+
+func (*sharePlanner) ldapPasswordDir() string {
+	return "/etc/samba-ldap"
+}
+
+func (*sharePlanner) ldapPasswordFileName() string {
+	return "password"
+}
+
+func (sp *sharePlanner) ldapPasswordPath() string {
+	return path.Join(sp.ldapPasswordDir(), sp.ldapPasswordFileName())
+}
+
+func ldapPasswordVolumeAndMount(planner *sharePlanner) (
+	corev1.Volume, corev1.VolumeMount) {
+	// ---
+	ldap := planner.ldapPassdb()
+	// volume
+	mode := int32(0400)
+	volume := corev1.Volume{
+		Name: ldapPasswordVolName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: ldap.AdminPasswordSecret,
+				Items: []corev1.KeyToPath{{
+					Key:  ldapPasswordKey(ldap),
+					Path: planner.ldapPasswordFileName(),
+				}},
+				DefaultMode: &mode,
+			},
+		},
+	}
+	// mount
+	mount := corev1.VolumeMount{
+		MountPath: planner.ldapPasswordDir(),
+		Name:      ldapPasswordVolName,
+		ReadOnly:  true,
+	}
+	return volume, mount
+}
+
+// passdbInitContainers returns the init containers storing the password of
+// the LDAP admin DN in the secrets database, on the state volume shared
+// with smbd. The configuration is applied first, as samba stores the
+// password for the admin DN it is configured with.
+func passdbInitContainers(
+	planner *sharePlanner,
+	env []corev1.EnvVar,
+	mounts []corev1.VolumeMount,
+	passwordMount corev1.VolumeMount) []corev1.Container {
+	// ---
+	script := fmt.Sprintf(`smbpasswd -w "$(cat %s)"`, planner.ldapPasswordPath())
+	return []corev1.Container{
+		{
+			Image:        planner.sambaImage(),
+			Name:         "init",
+			Args:         []string{"init"},
+			Env:          env,
+			VolumeMounts: mounts,
+		},
+		{
+			Image:        planner.sambaImage(),
+			Name:         passdbContainerName,
+			Command:      []string{"/bin/sh", "-c", script},
+			Env:          env,
+			VolumeMounts: append(mounts, passwordMount),
+		},
+	}
+}
+
+// validatePassdb checks that the ldapsam passdb backend, if used, has the
+// settings needed to connect to the LDAP server and that the password
+// secret exists and holds the password. Users may not be defined by a
+// security config using ldapsam. If not, the Degraded condition is set on
+// the SmbShare and false is returned.
+func (m *SmbShareManager) validatePassdb(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	sc := planner.SecurityConfig
+	if sc == nil || sc.Spec.PassdbBackend == nil {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidPassdb, msg)
+	}
+	passdb := sc.Spec.PassdbBackend
+	if passdb.Type != ldapsamPassdb {
+		if passdb.LDAP != nil {
+			return degraded(
+				"LDAP settings require the ldapsam passdb backend")
+		}
+		return true, nil
+	}
+	if planner.securityMode() != userMode {
+		return degraded("The ldapsam passdb backend requires user mode")
+	}
+	if sc.Spec.Users != nil {
+		return degraded(
+			"Users may not be defined with the ldapsam passdb backend")
+	}
+	ldap := passdb.LDAP
+	if ldap == nil {
+		return degraded("The ldapsam passdb backend requires LDAP settings")
+	}
+	missing := []string{}
+	if ldap.URL == "" {
+		missing = append(missing, "url")
+	}
+	if ldap.Suffix == "" {
+		missing = append(missing, "suffix")
+	}
+	if ldap.AdminDN == "" {
+		missing = append(missing, "adminDN")
+	}
+	if ldap.AdminPasswordSecret == "" {
+		missing = append(missing, "adminPasswordSecret")
+	}
+	if len(missing) > 0 {
+		return degraded(fmt.Sprintf(
+			"Missing LDAP settings: %s", strings.Join(missing, ", ")))
+	}
+	secret := &corev1.Secret{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{Name: ldap.AdminPasswordSecret, Namespace: ns},
+		secret)
+	if errors.IsNotFound(err) {
+		return degraded(fmt.Sprintf(
+			"LDAP password secret %s not found in namespace %s",
+			ldap.AdminPasswordSecret, ns))
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get LDAP password secret",
+			"Secret.Namespace", ns, "Secret.Name", ldap.AdminPasswordSecret)
+		return false, err
+	}
+	if len(secret.Data[ldapPasswordKey(ldap)]) == 0 {
+		return degraded(fmt.Sprintf("LDAP password secret %s has no %s key",
+			ldap.AdminPasswordSecret, ldapPasswordKey(ldap)))
+	}
+	return true, nil
+}
@@ -0,0 +1,177 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// ldapPlanner returns a planner of a share whose security config in user
+// mode uses the ldapsam passdb backend.
+func ldapPlanner(share *sambaoperatorv1alpha1.SmbShare) *sharePlanner {
+	planner := testPlanner(share, nil)
+	planner.ConfigState = smbcc.New()
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{}
+	planner.SecurityConfig.Spec.Mode = string(userMode)
+	planner.SecurityConfig.Spec.PassdbBackend = &sambaoperatorv1alpha1.SmbSecurityPassdbSpec{
+		Type: "ldapsam",
+		LDAP: &sambaoperatorv1alpha1.SmbSecurityLDAPSpec{
+			URL:                 "ldap://ldap.example.com",
+			Suffix:              "dc=example,dc=com",
+			UserSuffix:          "ou=People",
+			AdminDN:             "cn=admin,dc=example,dc=com",
+			AdminPasswordSecret: "ldap-admin",
+		},
+	}
+	return planner
+}
+
+func TestPlannerLDAPPassdb(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := ldapPlanner(share)
+	_, err := planner.update()
+	assert.NoError(t, err)
+	key := planner.passdbKey()
+	assert.Contains(t, planner.ConfigState.Configs["myshare"].Globals, key)
+	conf, err := planner.ConfigState.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tpassdb backend = ldapsam:ldap://ldap.example.com\n")
+	assert.Contains(t, conf, "\tldap suffix = dc=example,dc=com\n")
+	assert.Contains(t, conf, "\tldap user suffix = ou=People\n")
+	assert.Contains(t, conf, "\tldap admin dn = cn=admin,dc=example,dc=com\n")
+	assert.NotContains(t, conf, "ldap group suffix")
+	assert.NotContains(t, conf, "ldap ssl")
+
+	planner.SecurityConfig.Spec.PassdbBackend.LDAP.SSL = "off"
+	assert.NotEqual(t, key, planner.passdbKey())
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.NotContains(t, planner.ConfigState.Configs["myshare"].Globals, key)
+	conf, err = planner.ConfigState.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tldap ssl = off\n")
+
+	// tdbsam is the default, and is not configured
+	planner.SecurityConfig.Spec.PassdbBackend = nil
+	assert.Equal(t, tdbsamPassdb, planner.passdbType())
+	assert.Equal(t, smbcc.Key(""), planner.passdbKey())
+	planner.SecurityConfig.Spec.PassdbBackend = &sambaoperatorv1alpha1.SmbSecurityPassdbSpec{
+		Type: "tdbsam",
+	}
+	assert.Nil(t, planner.ldapPassdb())
+	assert.Equal(t, smbcc.Key(""), planner.passdbKey())
+}
+
+func TestBuildPodSpecLDAPPassdb(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{}
+	planner := ldapPlanner(share)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	podSpec := buildPodSpec(planner, cfg, "mypvc")
+	if assert.Len(t, podSpec.InitContainers, 3) {
+		assert.Equal(t, []string{"init"}, podSpec.InitContainers[0].Args)
+		passdb := podSpec.InitContainers[1]
+		assert.Equal(t, passdbContainerName, passdb.Name)
+		assert.Equal(t,
+			[]string{"/bin/sh", "-c", `smbpasswd -w "$(cat /etc/samba-ldap/password)"`},
+			passdb.Command)
+		paths := mountPaths(podSpec.InitContainers)[passdbContainerName]
+		assert.Equal(t, "/etc/samba-ldap", paths[ldapPasswordVolName])
+		assert.Equal(t, planner.sambaStateDir(), paths[stateVolName])
+	}
+	// smbd shares the secrets database, but not the password
+	paths := mountPaths(podSpec.Containers)["samba"]
+	assert.Equal(t, planner.sambaStateDir(), paths[stateVolName])
+	assert.NotContains(t, paths, ldapPasswordVolName)
+	found := false
+	for _, v := range podSpec.Volumes {
+		if v.Name == ldapPasswordVolName {
+			found = true
+			assert.Equal(t, "ldap-admin", v.Secret.SecretName)
+			assert.Equal(t, "password", v.Secret.Items[0].Key)
+		}
+	}
+	assert.True(t, found)
+
+	planner.SecurityConfig.Spec.PassdbBackend = nil
+	podSpec = buildPodSpec(planner, cfg, "mypvc")
+	if assert.Len(t, podSpec.InitContainers, 1) {
+		assert.Equal(t, checkConfigContainerName, podSpec.InitContainers[0].Name)
+	}
+}
+
+func TestValidatePassdb(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ldap-admin", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("s3cr3t")},
+	}
+	ctx := context.TODO()
+	m, recorder := newTestManager(share, secret)
+	valid, err := m.validatePassdb(ctx, ldapPlanner(share), "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+
+	check := func(msg string, planner *sharePlanner) {
+		t.Helper()
+		m, recorder := newTestManager(share, secret)
+		valid, err := m.validatePassdb(ctx, planner, "default")
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidPassdb)
+			assert.Contains(t, event, msg)
+		}
+	}
+	planner := ldapPlanner(share)
+	planner.SecurityConfig.Spec.PassdbBackend.LDAP.Suffix = ""
+	planner.SecurityConfig.Spec.PassdbBackend.LDAP.AdminDN = ""
+	check("Missing LDAP settings: suffix, adminDN", planner)
+	planner = ldapPlanner(share)
+	planner.SecurityConfig.Spec.PassdbBackend.LDAP = nil
+	check("The ldapsam passdb backend requires LDAP settings", planner)
+	planner = ldapPlanner(share)
+	planner.SecurityConfig.Spec.PassdbBackend.LDAP.AdminPasswordSecret = "missing"
+	check("LDAP password secret missing not found in namespace default", planner)
+	planner = ldapPlanner(share)
+	planner.SecurityConfig.Spec.PassdbBackend.LDAP.AdminPasswordKey = "admin"
+	check("LDAP password secret ldap-admin has no admin key", planner)
+	planner = ldapPlanner(share)
+	planner.SecurityConfig.Spec.Users = &sambaoperatorv1alpha1.SmbSecurityUsersSpec{
+		Secret: "users",
+	}
+	check("Users may not be defined with the ldapsam passdb backend", planner)
+	planner = ldapPlanner(share)
+	planner.SecurityConfig.Spec.PassdbBackend.Type = "tdbsam"
+	check("LDAP settings require the ldapsam passdb backend", planner)
+	planner = ldapPlanner(share)
+	planner.SecurityConfig.Spec.Mode = string(adMode)
+	check("The ldapsam passdb backend requires user mode", planner)
+}
@@ -0,0 +1,75 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// pausedAnnotation pauses the reconciliation of the SmbShare when set to
+// "true".
+const pausedAnnotation = "samba-operator.samba.org/paused"
+
+// pausedMessage returns why the reconciliation of the SmbShare is paused,
+// or an empty string if it is not: the shares are paused all at once by
+// the operator configuration, or one at a time by their annotation.
+func (m *SmbShareManager) pausedMessage(
+	s *sambaoperatorv1alpha1.SmbShare) string {
+	// ---
+	if m.cfg != nil && m.cfg.Paused {
+		return "Reconciliation is paused by the operator configuration"
+	}
+	if s.GetAnnotations()[pausedAnnotation] == "true" {
+		return fmt.Sprintf(
+			"Reconciliation is paused by the %s annotation", pausedAnnotation)
+	}
+	return ""
+}
+
+// updatePausedStatus sets the Paused condition of the SmbShare and returns
+// true if its reconciliation is paused. While paused, the operator makes no
+// other change, deleting the share's resources included: a share deleted
+// while paused is finalized once resumed. Shares that were never paused get
+// no condition.
+func (m *SmbShareManager) updatePausedStatus(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	msg := m.pausedMessage(s)
+	paused := msg != ""
+	cond := findCondition(
+		s.Status.Conditions, sambaoperatorv1alpha1.ConditionPaused)
+	if cond == nil && !paused {
+		return false, nil
+	}
+	changed := setCondition(
+		&s.Status.Conditions, pausedCondition(s.Generation, paused, msg))
+	if !changed {
+		return paused, nil
+	}
+	if err := m.client.Status().Update(ctx, s); err != nil {
+		return paused, err
+	}
+	if paused {
+		m.recorder.Event(s, EventNormal, ReasonPaused, msg)
+	} else {
+		m.recorder.Event(s, EventNormal, ReasonUnpaused,
+			"Resumed the reconciliation of the share")
+	}
+	return paused, nil
+}
@@ -0,0 +1,115 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// processShare reconciles the share until it needs no requeue.
+func processShare(t *testing.T, m *SmbShareManager, key types.NamespacedName) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		res := m.Process(context.TODO(), key)
+		require.NoError(t, res.Err())
+		if !res.Requeue() {
+			return
+		}
+	}
+	t.Fatal("share not reconciled")
+}
+
+func TestPausedSharesNotReconciled(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.UID = "myshare-uid"
+	share.Annotations = map[string]string{pausedAnnotation: "true"}
+	m, _ := newTestManager(share)
+	m.recorder = record.NewFakeRecorder(100)
+	ctx := context.TODO()
+	key := types.NamespacedName{Namespace: "default", Name: "myshare"}
+
+	deployments := func() []appsv1.Deployment {
+		l := &appsv1.DeploymentList{}
+		require.NoError(t, m.client.List(ctx, l, rtclient.InNamespace("default")))
+		return l.Items
+	}
+	stored := func() *sambaoperatorv1alpha1.SmbShare {
+		s := &sambaoperatorv1alpha1.SmbShare{}
+		require.NoError(t, m.client.Get(ctx, key, s))
+		return s
+	}
+
+	// no resources are created, not even the finalizer is added
+	processShare(t, m, key)
+	assert.Empty(t, deployments())
+	s := stored()
+	assert.Empty(t, s.Finalizers)
+	cond := findCondition(s.Status.Conditions, sambaoperatorv1alpha1.ConditionPaused)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, corev1.ConditionTrue, cond.Status)
+		assert.Equal(t, ReasonPaused, cond.Reason)
+		assert.Contains(t, cond.Message, pausedAnnotation)
+	}
+
+	// resuming creates the resources
+	s.Annotations = nil
+	require.NoError(t, m.client.Update(ctx, s))
+	processShare(t, m, key)
+	if assert.Len(t, deployments(), 1) {
+		deployment := deployments()[0]
+		s = stored()
+		cond = findCondition(s.Status.Conditions, sambaoperatorv1alpha1.ConditionPaused)
+		if assert.NotNil(t, cond) {
+			assert.Equal(t, corev1.ConditionFalse, cond.Status)
+			assert.Equal(t, ReasonUnpaused, cond.Reason)
+		}
+
+		// changes made while paused by the operator are not applied
+		m.cfg.Paused = true
+		configMaps := &corev1.ConfigMapList{}
+		require.NoError(t, m.client.List(ctx, configMaps, rtclient.InNamespace("default")))
+		require.NotEmpty(t, configMaps.Items)
+		s.Spec.ReadOnly = !s.Spec.ReadOnly
+		s.Spec.Comment = "paused"
+		require.NoError(t, m.client.Update(ctx, s))
+		processShare(t, m, key)
+		assert.Equal(t, deployment.ResourceVersion, deployments()[0].ResourceVersion)
+		for _, cm := range configMaps.Items {
+			found := &corev1.ConfigMap{}
+			require.NoError(t, m.client.Get(ctx,
+				types.NamespacedName{Namespace: cm.Namespace, Name: cm.Name}, found))
+			assert.Equal(t, cm.ResourceVersion, found.ResourceVersion)
+		}
+		cond = findCondition(stored().Status.Conditions, sambaoperatorv1alpha1.ConditionPaused)
+		if assert.NotNil(t, cond) {
+			assert.Equal(t, corev1.ConditionTrue, cond.Status)
+			assert.Contains(t, cond.Message, "operator configuration")
+		}
+	}
+}
@@ -16,9 +16,23 @@ limitations under the License.
 package resources
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"net"
 	"path"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"unicode"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
 	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
@@ -32,6 +46,12 @@ const (
 	adMode   = securityMode("active-directory")
 )
 
+// homesShareName is the name samba reserves for home directory shares.
+const homesShareName = "homes"
+
+// aclModeWindows is the ACL mode storing NT ACLs in extended attributes.
+const aclModeWindows = "windows"
+
 type dnsRegister string
 
 const (
@@ -45,6 +65,9 @@ type userSecuritySource struct {
 	Namespace  string
 	Secret     string
 	Key        string
+	// CSIVolume is set if the users are mounted from a Secrets Store CSI
+	// driver volume rather than from Secret.
+	CSIVolume *sambaoperatorv1alpha1.SmbCSISecretVolumeSpec
 }
 
 // InstanceConfiguration bundles together the various inputs that define
@@ -54,6 +77,13 @@ type InstanceConfiguration struct {
 	SecurityConfig *sambaoperatorv1alpha1.SmbSecurityConfig
 	CommonConfig   *sambaoperatorv1alpha1.SmbCommonConfig
 	GlobalConfig   *conf.OperatorConfig
+	// DefaultCommonConfig is the default common config of the namespace,
+	// when the SmbShare refers to another common config. Only its compute
+	// resources apply, underneath those of CommonConfig.
+	DefaultCommonConfig *sambaoperatorv1alpha1.SmbCommonConfig
+	// GroupShares are all of the SmbShares, including SmbShare, that are
+	// currently members of the server group.
+	GroupShares []sambaoperatorv1alpha1.SmbShare
 }
 
 type sharePlanner struct {
@@ -87,26 +117,188 @@ func (sp *sharePlanner) instanceID() smbcc.Key {
 	return smbcc.Key(sp.instanceName())
 }
 
+// replicas returns the number of server pods that provide the share. The
+// servers are scaled to zero pods while all of their shares are suspended.
+func (sp *sharePlanner) replicas() int32 {
+	if sp.groupSuspended() {
+		return 0
+	}
+	// a share is served by exactly one pod until clustering is supported
+	return 1
+}
+
+// suspended returns true if the share is suspended by its spec.
+func (sp *sharePlanner) suspended() bool {
+	return sp.SmbShare != nil && sp.SmbShare.Spec.Suspended
+}
+
+// groupSuspended returns true if all of the shares of the server group are
+// suspended.
+func (sp *sharePlanner) groupSuspended() bool {
+	shares := sp.groupShares()
+	for i := range shares {
+		if !shares[i].Spec.Suspended {
+			return false
+		}
+	}
+	return len(shares) > 0
+}
+
+// disruptionBudget returns the minimum number of available pods, or the
+// maximum number of unavailable pods, for the share's PodDisruptionBudget.
+// Exactly one of the two values is returned, unless no PodDisruptionBudget
+// is wanted for the share, in which case both are nil.
+func (sp *sharePlanner) disruptionBudget() (
+	minAvailable, maxUnavailable *intstr.IntOrString) {
+	// ---
+	var pdb *sambaoperatorv1alpha1.SmbDisruptionBudgetSpec
+	if sp.CommonConfig != nil {
+		pdb = sp.CommonConfig.Spec.DisruptionBudget
+	}
+	multi := sp.replicas() > 1
+	if !multi && (pdb == nil || !pdb.SingleReplica) {
+		return nil, nil
+	}
+	switch {
+	case pdb != nil && pdb.MinAvailable != nil:
+		v := *pdb.MinAvailable
+		return &v, nil
+	case pdb != nil && pdb.MaxUnavailable != nil:
+		v := *pdb.MaxUnavailable
+		return nil, &v
+	case multi:
+		v := intstr.FromInt(1)
+		return nil, &v
+	}
+	// keep the only pod of the share from being evicted
+	v := intstr.FromInt(1)
+	return &v, nil
+}
+
 func (sp *sharePlanner) shareName() string {
+	return shareNameOf(sp.SmbShare)
+}
+
+func (sp *sharePlanner) sharePath() string {
+	return sharePathOf(sp.SmbShare)
+}
+
+// groupShares returns the SmbShares served by the server group. If the
+// members of the group are not known the group consists of the planner's
+// SmbShare alone.
+func (sp *sharePlanner) groupShares() []sambaoperatorv1alpha1.SmbShare {
+	if sp.GroupShares == nil && sp.SmbShare != nil {
+		return []sambaoperatorv1alpha1.SmbShare{*sp.SmbShare}
+	}
+	return sp.GroupShares
+}
+
+// shareNameOf returns the name of the smb share for the given SmbShare.
+func shareNameOf(s *sambaoperatorv1alpha1.SmbShare) string {
+	if s.Spec.HomeDirectories != nil {
+		return homesShareName
+	}
 	// todo: make sure this is smb-conf clean, otherwise we need to
 	// fix up the name value(s).
-	if sp.SmbShare.Spec.ShareName != "" {
-		return sp.SmbShare.Spec.ShareName
+	if s.Spec.ShareName != "" {
+		return s.Spec.ShareName
 	}
 	// It was not named explicitly. Name it after the CR.
 	// todo: may need massaging too.
-	return sp.SmbShare.Name
+	return s.Name
 }
 
-func (sp *sharePlanner) sharePath() string {
-	return path.Join("/mnt", string(sp.SmbShare.UID))
+// shareMountPathOf returns the path, within the server pods, that the
+// volume of the given SmbShare is mounted at.
+func shareMountPathOf(s *sambaoperatorv1alpha1.SmbShare) string {
+	return path.Join("/mnt", string(s.UID))
+}
+
+// sharePathOf returns the path, within the server pods, of the directory
+// shared by the given SmbShare. The directory of a share using the VFS
+// module of its file system is a path within that file system.
+func sharePathOf(s *sambaoperatorv1alpha1.SmbShare) string {
+	if nativeStorage(s) {
+		return path.Join("/", storagePathOf(s))
+	}
+	return path.Join(shareMountPathOf(s), storagePathOf(s))
+}
+
+// storagePathData is what the path of a share's storage is rendered with.
+type storagePathData struct {
+	Name      string
+	Namespace string
+}
+
+// renderStoragePath renders the path of the share's storage as a template,
+// in which .Name and .Namespace are the name and namespace of the SmbShare.
+func renderStoragePath(s *sambaoperatorv1alpha1.SmbShare) (string, error) {
+	p := s.Spec.Storage.Path
+	if !strings.Contains(p, "{{") {
+		return p, nil
+	}
+	t, err := template.New("path").Parse(p)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	err = t.Execute(&b, storagePathData{Name: s.Name, Namespace: s.Namespace})
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// storagePathOf returns the rendered path of the share's storage. A path
+// that can not be rendered is returned as it is; the share is degraded by
+// validateSharePath before any pod uses it.
+func storagePathOf(s *sambaoperatorv1alpha1.SmbShare) string {
+	p, err := renderStoragePath(s)
+	if err != nil {
+		return s.Spec.Storage.Path
+	}
+	return p
+}
+
+// validSharePath returns true if p names a directory within a volume: a
+// relative path, without "." or ".." components, empty components or
+// control characters. The empty path names the root of the volume.
+func validSharePath(p string) bool {
+	if p == "" {
+		return true
+	}
+	if strings.IndexFunc(p, unicode.IsControl) >= 0 {
+		return false
+	}
+	for _, c := range strings.Split(p, "/") {
+		if c == "" || c == "." || c == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// publishDNSNames returns the valid DNS names that the shares of the server
+// group are to be published under, sorted and without duplicates.
+func (sp *sharePlanner) publishDNSNames() []string {
+	names := []string{}
+	shares := sp.groupShares()
+	for i := range shares {
+		name := shares[i].Spec.PublishDNSName
+		if name != "" && validDNSName(name) {
+			names = append(names, name)
+		}
+	}
+	return sortedUnique(names)
 }
 
 func (sp *sharePlanner) containerConfigPath() string {
 	cpath := path.Join(sp.containerConfigDir(), "config.json")
 	if sp.userSecuritySource().Configured {
-		upath := path.Join(sp.usersConfigDir(), sp.usersConfigFileName())
-		cpath += ":" + upath
+		cpath += ":" + sp.usersConfigPath()
+	}
+	if sp.projectsLocalGroups() {
+		cpath += ":" + sp.localGroupsConfigPath()
 	}
 	return cpath
 }
@@ -123,6 +315,16 @@ func (*sharePlanner) usersConfigDir() string {
 	return "/etc/container-users"
 }
 
+// usersConfigPath returns the path of the users config within the pods.
+// The file name of a users config mounted from a CSI volume is its path
+// within the volume.
+func (sp *sharePlanner) usersConfigPath() string {
+	if csi := sp.userSecuritySource().CSIVolume; csi != nil {
+		return path.Join(sp.usersConfigDir(), csi.Path)
+	}
+	return path.Join(sp.usersConfigDir(), sp.usersConfigFileName())
+}
+
 func (*sharePlanner) winbindSocketsDir() string {
 	return "/run/samba/winbindd"
 }
@@ -148,6 +350,22 @@ func (sp *sharePlanner) securityMode() securityMode {
 	return m
 }
 
+// securityConfigHash returns a digest of the share's SmbSecurityConfig. It
+// is recorded in the pod template so that a change to the security config
+// rolls the pods, which join the domain again as they start. An empty
+// string is returned if the share has no security config.
+func (sp *sharePlanner) securityConfigHash() string {
+	if sp.SecurityConfig == nil {
+		return ""
+	}
+	data, err := json.Marshal(sp.SecurityConfig.Spec)
+	if err != nil {
+		// a plain struct always marshals
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+}
+
 func (sp *sharePlanner) realm() string {
 	return strings.ToUpper(sp.SecurityConfig.Spec.Realm)
 }
@@ -158,6 +376,140 @@ func (sp *sharePlanner) workgroup() string {
 	return parts[0]
 }
 
+// machineAccountOUPath converts the machine account OU distinguished name
+// to the top-to-bottom, slash delimited, form used by net ads join.
+// For example, OU=Servers,OU=Samba,DC=example,DC=com becomes Samba/Servers.
+func (sp *sharePlanner) machineAccountOUPath() string {
+	if sp.SecurityConfig == nil || sp.SecurityConfig.Spec.MachineAccountOU == "" {
+		return ""
+	}
+	ous := []string{}
+	for _, rdn := range strings.Split(sp.SecurityConfig.Spec.MachineAccountOU, ",") {
+		kv := strings.SplitN(strings.TrimSpace(rdn), "=", 2)
+		if len(kv) != 2 || !strings.EqualFold(kv[0], "OU") {
+			continue
+		}
+		// prepend: the DN lists the lowest level OU first
+		ous = append([]string{kv[1]}, ous...)
+	}
+	return strings.Join(ous, "/")
+}
+
+func (sp *sharePlanner) joinArgs() []string {
+	args := []string{"must-join"}
+	if ou := sp.machineAccountOUPath(); ou != "" {
+		args = append(args, "--createcomputer="+ou)
+	}
+	return args
+}
+
+// joinRetryScript runs the join command given as arguments, retrying with
+// exponential backoff. The last line of output names the number of
+// attempts made so that it is part of the container's termination message.
+const joinRetryScript = `attempt=1
+delay="${JOIN_INITIAL_DELAY}"
+while true; do
+  samba-container "$@" && exit 0
+  rc=$?
+  if [ "${attempt}" -ge "${JOIN_MAX_ATTEMPTS}" ]; then
+    echo "domain join failed after ${attempt} attempts (exit code ${rc})" >&2
+    exit "${rc}"
+  fi
+  echo "domain join attempt ${attempt} failed (exit code ${rc}), retrying in ${delay}s" >&2
+  sleep "${delay}"
+  attempt=$((attempt + 1))
+  delay=$((delay * 2))
+  if [ "${delay}" -gt "${JOIN_MAX_DELAY}" ]; then
+    delay="${JOIN_MAX_DELAY}"
+  fi
+done
+`
+
+type joinRetry struct {
+	maxAttempts  int32
+	initialDelay int32
+	maxDelay     int32
+}
+
+func (sp *sharePlanner) joinRetry() joinRetry {
+	r := joinRetry{
+		maxAttempts:  5,
+		initialDelay: 5,
+		maxDelay:     120,
+	}
+	if sp.SecurityConfig == nil || sp.SecurityConfig.Spec.JoinRetry == nil {
+		return r
+	}
+	spec := sp.SecurityConfig.Spec.JoinRetry
+	if spec.MaxAttempts > 0 {
+		r.maxAttempts = spec.MaxAttempts
+	}
+	if spec.InitialDelaySeconds > 0 {
+		r.initialDelay = spec.InitialDelaySeconds
+	}
+	if spec.MaxDelaySeconds > 0 {
+		r.maxDelay = spec.MaxDelaySeconds
+	}
+	return r
+}
+
+// joinCommand returns the command used to wrap the join with retries.
+// The joinArgs are passed to the command as arguments.
+func (*sharePlanner) joinCommand() []string {
+	return []string{"/bin/sh", "-c", joinRetryScript, "join-retry"}
+}
+
+func (sp *sharePlanner) joinRetryEnv() []corev1.EnvVar {
+	r := sp.joinRetry()
+	return []corev1.EnvVar{
+		{Name: "JOIN_MAX_ATTEMPTS", Value: fmt.Sprintf("%d", r.maxAttempts)},
+		{Name: "JOIN_INITIAL_DELAY", Value: fmt.Sprintf("%d", r.initialDelay)},
+		{Name: "JOIN_MAX_DELAY", Value: fmt.Sprintf("%d", r.maxDelay)},
+	}
+}
+
+// keytabSecret returns the name of the secret holding the keytab or an
+// empty string if no keytab is configured.
+func (sp *sharePlanner) keytabSecret() string {
+	if sp.SecurityConfig == nil || sp.SecurityConfig.Spec.Kerberos == nil {
+		return ""
+	}
+	return sp.SecurityConfig.Spec.Kerberos.KeytabSecret
+}
+
+func (*sharePlanner) keytabDir() string {
+	return "/etc/samba-keytab"
+}
+
+func (*sharePlanner) keytabFileName() string {
+	return "krb5.keytab"
+}
+
+func (sp *sharePlanner) keytabPath() string {
+	return path.Join(sp.keytabDir(), sp.keytabFileName())
+}
+
+// krb5ConfConfigMap returns the name of the ConfigMap holding the krb5.conf
+// of the samba containers, or an empty string if samba generates it.
+func (sp *sharePlanner) krb5ConfConfigMap() string {
+	if sp.securityMode() != adMode || sp.SecurityConfig.Spec.Kerberos == nil {
+		return ""
+	}
+	return sp.SecurityConfig.Spec.Kerberos.Krb5ConfConfigMap
+}
+
+func (*sharePlanner) krb5ConfDir() string {
+	return "/etc/samba-krb5"
+}
+
+func (*sharePlanner) krb5ConfFileName() string {
+	return "krb5.conf"
+}
+
+func (sp *sharePlanner) krb5ConfPath() string {
+	return path.Join(sp.krb5ConfDir(), sp.krb5ConfFileName())
+}
+
 func (*sharePlanner) joinJSONSuffix(index int) string {
 	return fmt.Sprintf("-%d", index)
 }
@@ -178,7 +530,21 @@ func (*sharePlanner) joinEnvPaths(p []string) string {
 	return strings.Join(p, ":")
 }
 
+// userSecuritySource returns the source of the users the share's pods
+// mount: the users of the security config, or the users generated by
+// merging them with the users of the shares of the server group.
 func (sp *sharePlanner) userSecuritySource() userSecuritySource {
+	s := sp.securityConfigUserSource()
+	if s.Configured && s.CSIVolume == nil && sp.mergesShareUsers() {
+		s.Secret = shareUsersSecretName(sp.instanceName())
+		s.Key = smbUsersSecretKey
+	}
+	return s
+}
+
+// securityConfigUserSource returns the source of the users of the share's
+// security config.
+func (sp *sharePlanner) securityConfigUserSource() userSecuritySource {
 	s := userSecuritySource{}
 	if sp.SecurityConfig == nil || sp.SecurityConfig.Spec.Users == nil {
 		return s
@@ -187,21 +553,32 @@ func (sp *sharePlanner) userSecuritySource() userSecuritySource {
 	s.Namespace = sp.SecurityConfig.Namespace
 	s.Secret = sp.SecurityConfig.Spec.Users.Secret
 	s.Key = sp.SecurityConfig.Spec.Users.Key
+	if csi := sp.SecurityConfig.Spec.Users.CSISecretVolume; csi != nil {
+		s.Secret, s.Key = "", ""
+		s.CSIVolume = csi
+	} else if s.Secret == "" {
+		// the users are generated from the SmbUsers of the security config
+		s.Secret = smbUsersSecretName(sp.SecurityConfig)
+		s.Key = smbUsersSecretKey
+	}
 	return s
 }
 
-func (sp *sharePlanner) idmapOptions() smbcc.SmbOptions {
+// idmapDomains returns the domains whose IDs are mapped, each with its
+// range of IDs. A "*" domain, with the autorid backend, is added unless the
+// security config lists one, and domains without a range are assigned
+// ranges in the order they are listed.
+func (sp *sharePlanner) idmapDomains() []sambaoperatorv1alpha1.SmbSecurityDomainSpec {
 	if sp.SecurityConfig == nil || len(sp.SecurityConfig.Spec.Domains) == 0 {
 		// default idmap config
-		return smbcc.SmbOptions{
-			"idmap config * : backend": "autorid",
-			"idmap config * : range":   "2000-9999999",
-		}
+		return []sambaoperatorv1alpha1.SmbSecurityDomainSpec{{
+			Name:    "*",
+			Backend: "autorid",
+			Range:   "2000-9999999",
+		}}
 	}
-	// this is hacky and needs both config to support user supplied ID
-	// ranges as well as a decent algo to deal with ID map ranges.
+	// this is hacky and needs a decent algo to deal with ID map ranges.
 	// for now we're just punting though (call it prototyping) :-)
-	o := smbcc.SmbOptions{}
 	doms := []sambaoperatorv1alpha1.SmbSecurityDomainSpec{}
 	userDefault := false
 	for _, d := range sp.SecurityConfig.Spec.Domains {
@@ -217,7 +594,18 @@ func (sp *sharePlanner) idmapOptions() smbcc.SmbOptions {
 		})
 	}
 	step := 10000
-	for i, d := range doms {
+	for i := range doms {
+		if doms[i].Range == "" {
+			rs := (i * step) + 2000
+			doms[i].Range = fmt.Sprintf("%d-%d", rs, rs+step-1)
+		}
+	}
+	return doms
+}
+
+func (sp *sharePlanner) idmapOptions() smbcc.SmbOptions {
+	o := smbcc.SmbOptions{}
+	for _, d := range sp.idmapDomains() {
 		pfx := fmt.Sprintf("idmap config %s : ", d.Name)
 		if d.Backend == "autorid" {
 			o[pfx+"backend"] = "autorid"
@@ -225,126 +613,2314 @@ func (sp *sharePlanner) idmapOptions() smbcc.SmbOptions {
 			o[pfx+"backend"] = "ad"
 			o[pfx+"schema_mode"] = "rfc2307"
 		}
-		rs := (i * step) + 2000
-		o[pfx+"range"] = fmt.Sprintf("%d-%d", rs, rs+step-1)
+		o[pfx+"range"] = d.Range
 	}
 	return o
 }
 
-func (sp *sharePlanner) update() (changed bool, err error) {
-	noprinting, found := sp.ConfigState.Globals[smbcc.NoPrintingKey]
-	if !found {
-		noprinting = smbcc.NewNoPrintingGlobals()
-		sp.ConfigState.Globals[smbcc.NoPrintingKey] = noprinting
-		changed = true
+// shareOptions returns the smb.conf parameters for the share. The options
+// are recomputed from the SmbShare on every update so that changes to the
+// SmbShare are reflected in the configuration of existing shares.
+func (sp *sharePlanner) shareOptions() smbcc.SmbOptions {
+	opts := smbcc.NewSimpleShare(sp.sharePath()).Options
+	if !sp.SmbShare.Spec.Browseable {
+		opts[smbcc.BrowseableParam] = smbcc.No
 	}
-	shareKey := smbcc.Key(sp.shareName())
-	share, found := sp.ConfigState.Shares[shareKey]
-	if !found {
-		share = smbcc.NewSimpleShare(sp.sharePath())
-		if !sp.SmbShare.Spec.Browseable {
-			share.Options[smbcc.BrowseableParam] = smbcc.No
+	if sp.SmbShare.Spec.ReadOnly || readOnlyMount(sp.SmbShare) {
+		opts[smbcc.ReadOnlyParam] = smbcc.Yes
+	}
+	if sp.SmbShare.Spec.Comment != "" {
+		opts[smbcc.CommentParam] = sp.SmbShare.Spec.Comment
+	}
+	if sp.homeDirectories() {
+		// samba creates a share, named after the user, for each user
+		// connecting to the server. %S is replaced by the name of that
+		// share. A user may only connect to their own share.
+		homeDir := path.Join(sp.homesBaseDir(), "%S")
+		opts["path"] = homeDir
+		validUsers := []string{"%S"}
+		if ac := sp.SmbShare.Spec.AccessControl; ac != nil {
+			validUsers = append(validUsers, ac.ValidUsers...)
 		}
-		if sp.SmbShare.Spec.ReadOnly {
-			share.Options[smbcc.ReadOnlyParam] = smbcc.Yes
+		setUserList(opts, smbcc.ValidUsersParam, validUsers)
+		if sp.SmbShare.Spec.HomeDirectories.CreateUserDirs {
+			opts[smbcc.RootPreexecParam] = fmt.Sprintf(
+				`/bin/sh -c 'mkdir -p -m 0700 "%s" && chown "%%S" "%s"'`,
+				homeDir, homeDir)
 		}
-		sp.ConfigState.Shares[shareKey] = share
-		changed = true
+	} else if ac := sp.SmbShare.Spec.AccessControl; ac != nil {
+		setUserList(opts, smbcc.ValidUsersParam, ac.ValidUsers)
 	}
-	cfgKey := sp.instanceID()
-	cfg, found := sp.ConfigState.Configs[cfgKey]
-	if !found || cfg.Shares[0] != shareKey {
-		cfg = smbcc.ConfigSection{
-			Shares:       []smbcc.Key{shareKey},
-			Globals:      []smbcc.Key{smbcc.NoPrintingKey},
-			InstanceName: sp.instanceName(),
+	if sp.SmbShare.Spec.PosixExtensions {
+		// the permissions POSIX clients give new files are masked as
+		// those of the other clients, the default masks dropping the
+		// write permission of the group and others.
+		opts[smbcc.CreateMaskParam] = posixMask
+		opts[smbcc.DirectoryMaskParam] = posixMask
+	}
+	for param, mode := range fileModes(sp.SmbShare) {
+		if mode != "" {
+			opts[param] = mode
+		}
+	}
+	if sp.SmbShare.Spec.InheritOwner {
+		opts[smbcc.InheritOwnerParam] = inheritOwnerWindowsAndUnix
+	}
+	if sp.SmbShare.Spec.InheritPermissions {
+		opts[smbcc.InheritPermissionsParam] = smbcc.Yes
+	}
+	switch sp.SmbShare.Spec.GuestAccess {
+	case guestRead:
+		opts[smbcc.GuestOkParam] = smbcc.Yes
+		opts[smbcc.ReadOnlyParam] = smbcc.Yes
+	case guestDropBox:
+		// everyone writes as the guest user. New files and directories
+		// can not be read by anyone, and are hidden from listings.
+		opts[smbcc.GuestOkParam] = smbcc.Yes
+		opts[smbcc.GuestOnlyParam] = smbcc.Yes
+		opts[smbcc.ReadOnlyParam] = smbcc.No
+		opts[smbcc.CreateMaskParam] = dropBoxCreateMask
+		opts[smbcc.DirectoryMaskParam] = dropBoxDirectoryMask
+		opts[smbcc.HideUnreadableParam] = smbcc.Yes
+	}
+	if v := sp.SmbShare.Spec.CaseSensitive; v != "" {
+		opts[smbcc.CaseSensitiveParam] = v
+	}
+	setBool(opts, smbcc.PreserveCaseParam, sp.SmbShare.Spec.PreserveCase)
+	setBool(opts, smbcc.ShortPreserveCaseParam,
+		sp.SmbShare.Spec.ShortPreserveCase)
+	if v := sp.SmbShare.Spec.MangledNames; v != "" {
+		opts[smbcc.MangledNamesParam] = v
+	}
+	setBool(opts, smbcc.FollowSymlinksParam, sp.SmbShare.Spec.FollowSymlinks)
+	if sp.SmbShare.Spec.WideLinks {
+		opts[smbcc.WideLinksParam] = smbcc.Yes
+	}
+	if sp.SmbShare.Spec.MSDFS != nil {
+		opts[smbcc.MSDFSRootParam] = smbcc.Yes
+	}
+	setBool(opts, smbcc.OplocksParam, sp.SmbShare.Spec.Oplocks)
+	setBool(opts, smbcc.KernelOplocksParam, sp.SmbShare.Spec.KernelOplocks)
+	setBool(opts, smbcc.Level2OplocksParam, sp.SmbShare.Spec.Level2Oplocks)
+	if durableHandles(sp.SmbShare) {
+		// samba only grants durable handles on shares whose locks and
+		// share modes are not shared with the kernel
+		opts[smbcc.DurableHandlesParam] = smbcc.Yes
+		opts[smbcc.KernelShareModesParam] = smbcc.No
+		opts[smbcc.PosixLockingParam] = smbcc.No
+	}
+	if sp.SmbShare.Spec.PersistentHandles {
+		opts[smbcc.ContinuouslyAvailableParam] = smbcc.Yes
+	}
+	setBool(opts, smbcc.StrictSyncParam, sp.SmbShare.Spec.StrictSync)
+	if sp.SmbShare.Spec.SyncAlways {
+		opts[smbcc.SyncAlwaysParam] = smbcc.Yes
+	}
+	if u := sp.SmbShare.Spec.ForceUser; u != "" {
+		opts[smbcc.ForceUserParam] = u
+	}
+	if g := sp.SmbShare.Spec.ForceGroup; g != "" {
+		opts[smbcc.ForceGroupParam] = g
+	}
+	if patterns := sp.SmbShare.Spec.VetoFiles; len(patterns) > 0 {
+		opts[smbcc.VetoFilesParam] = joinFilePatterns(patterns)
+		// without this, directories holding vetoed files, such as those
+		// created by clients before the files were vetoed, can not be
+		// deleted.
+		opts[smbcc.DeleteVetoFilesParam] = smbcc.Yes
+	}
+	if patterns := sp.hideFiles(); len(patterns) > 0 {
+		opts[smbcc.HideFilesParam] = joinFilePatterns(patterns)
+	}
+	if sp.SmbShare.Spec.DeleteReadonly {
+		opts[smbcc.DeleteReadonlyParam] = smbcc.Yes
+	}
+	setBool(opts, smbcc.ACLCheckPermissionsParam,
+		sp.SmbShare.Spec.ACLCheckPermissions)
+	if sp.SmbShare.Spec.ForceUnknownACLUser {
+		opts[smbcc.ForceUnknownACLUserParam] = smbcc.Yes
+	}
+	if hosts := sp.SmbShare.Spec.HostsAllow; len(hosts) > 0 {
+		opts[smbcc.HostsAllowParam] = strings.Join(hosts, " ")
+	}
+	if hosts := sp.SmbShare.Spec.HostsDeny; len(hosts) > 0 {
+		opts[smbcc.HostsDenyParam] = strings.Join(hosts, " ")
+	}
+	if sp.SmbShare.Spec.Encryption != "" {
+		opts[smbcc.SMBEncryptParam] = sp.SmbShare.Spec.Encryption
+	}
+	if acls := sp.SmbShare.Spec.ACLs; acls != nil {
+		if acls.Inherit {
+			opts[smbcc.InheritACLsParam] = smbcc.Yes
+			opts[smbcc.MapACLInheritParam] = smbcc.Yes
 		}
-		if sp.securityMode() == adMode {
-			realmKey := smbcc.Key(sp.realm())
-			cfg.Globals = append(cfg.Globals, realmKey)
+		if sp.windowsACLs() {
+			opts[smbcc.ACLXattrIgnoreSystemACLsParam] = smbcc.Yes
+			if acls.WindowsEditing {
+				opts[smbcc.DosFilemodeParam] = smbcc.Yes
+				opts[smbcc.ACLGroupControlParam] = smbcc.Yes
+			}
 		}
-		sp.ConfigState.Configs[cfgKey] = cfg
-		changed = true
 	}
-	if len(sp.ConfigState.Users) == 0 {
-		sp.ConfigState.Users = smbcc.NewDefaultUsers()
-		changed = true
+	for param, value := range sp.backendOptions() {
+		if param != smbcc.VfsObjectsParam {
+			opts[param] = value
+		}
 	}
-	if sp.securityMode() == adMode {
-		realmKey := smbcc.Key(sp.realm())
-		_, found := sp.ConfigState.Globals[realmKey]
-		if !found {
-			opts := sp.idmapOptions()
-			// security mode
-			opts["security"] = "ads"
-			// workgroup and realm
-			opts["workgroup"] = sp.workgroup()
-			opts["realm"] = sp.realm()
-			sp.ConfigState.Globals[realmKey] = smbcc.GlobalConfig{
-				Options: opts,
+	if vfs := sp.vfsObjects(); len(vfs) > 0 {
+		opts[smbcc.VfsObjectsParam] = strings.Join(vfs, " ")
+	}
+	if sp.spotlight() {
+		opts[smbcc.SpotlightParam] = smbcc.Yes
+		if es := sp.SmbShare.Spec.MacOS.Elasticsearch; es != nil {
+			opts[smbcc.SpotlightBackendParam] = "elasticsearch"
+			opts[smbcc.ElasticsearchAddressParam] = es.Address
+			if es.Port != nil {
+				opts[smbcc.ElasticsearchPortParam] = strconv.Itoa(int(*es.Port))
+			}
+			if es.Index != "" {
+				opts[smbcc.ElasticsearchIndexParam] = es.Index
 			}
-			changed = true
 		}
 	}
-	return
+	if v := sp.SmbShare.Spec.StoreDosAttributes; v != nil {
+		setBool(opts, smbcc.StoreDosAttributesParam, v)
+		if *v {
+			opts[smbcc.EaSupportParam] = smbcc.Yes
+		}
+	}
+	for param, value := range sp.dosAttributeMappingOptions() {
+		opts[param] = value
+	}
+	for param, value := range sp.antivirusOptions() {
+		opts[param] = value
+	}
+	if ac := sp.SmbShare.Spec.AccessControl; ac != nil {
+		setUserList(opts, smbcc.InvalidUsersParam, ac.InvalidUsers)
+		setUserList(opts, smbcc.ReadListParam, ac.ReadList)
+		setUserList(opts, smbcc.WriteListParam, ac.WriteList)
+	}
+	if n := sp.SmbShare.Spec.MaxConnections; n != nil {
+		opts[smbcc.MaxConnectionsParam] = strconv.Itoa(int(*n))
+	}
+	if size, ok := sp.quotaBytes(); ok {
+		// max disk size is given in megabytes; round up so that clients
+		// are never shown less space than the quota allows.
+		opts[smbcc.MaxDiskSizeParam] = strconv.FormatInt(
+			(size+mebibyte-1)/mebibyte, 10)
+		if sp.quotaExceeded() {
+			// a share over its quota only accepts reads, even from
+			// users otherwise granted write access.
+			opts[smbcc.ReadOnlyParam] = smbcc.Yes
+			delete(opts, smbcc.WriteListParam)
+		}
+	}
+	return opts
 }
 
-func (sp *sharePlanner) prune() (changed bool, err error) {
-	cfgKey := sp.instanceID()
-	if _, found := sp.ConfigState.Configs[cfgKey]; found {
-		delete(sp.ConfigState.Configs, cfgKey)
-		changed = true
+const mebibyte = 1024 * 1024
+
+// quotaBytes returns the quota of the share in bytes and true if the share
+// has an active quota.
+func (sp *sharePlanner) quotaBytes() (int64, bool) {
+	return quotaBytesOf(sp.SmbShare)
+}
+
+func quotaBytesOf(s *sambaoperatorv1alpha1.SmbShare) (int64, bool) {
+	q := s.Spec.Quota
+	if q == nil || q.Disabled {
+		return 0, false
 	}
-	shareKey := smbcc.Key(sp.shareName())
-	if _, found := sp.ConfigState.Shares[shareKey]; found {
-		delete(sp.ConfigState.Shares, shareKey)
-		changed = true
+	return q.Size.Value(), true
+}
+
+// quotaExceeded returns true if the share was last found to hold more data
+// than its quota allows.
+func (sp *sharePlanner) quotaExceeded() bool {
+	q := sp.SmbShare.Status.Quota
+	return q != nil && q.Exceeded
+}
+
+// homeDirectories returns true if the share provides per-user home
+// directories.
+func (sp *sharePlanner) homeDirectories() bool {
+	return sp.SmbShare.Spec.HomeDirectories != nil
+}
+
+// homesBaseDir returns the path, within the share pods, of the directory
+// containing the users' home directories.
+func (sp *sharePlanner) homesBaseDir() string {
+	return homesBaseDirOf(sp.SmbShare)
+}
+
+func homesBaseDirOf(s *sambaoperatorv1alpha1.SmbShare) string {
+	base := s.Spec.HomeDirectories.BaseDir
+	if base == "" {
+		base = homesShareName
 	}
-	return
+	return path.Join(sharePathOf(s), base)
 }
 
-func (sp *sharePlanner) dnsRegister() dnsRegister {
-	reg := dnsRegisterNever
-	if sp.securityMode() == adMode && sp.SecurityConfig.Spec.DNS != nil {
-		reg = dnsRegister(sp.SecurityConfig.Spec.DNS.Register)
+// windowsACLs returns true if the share stores Windows NT ACLs in
+// extended attributes.
+func (sp *sharePlanner) windowsACLs() bool {
+	acls := sp.SmbShare.Spec.ACLs
+	return acls != nil && acls.Mode == aclModeWindows
+}
+
+// macOSFruit returns true if the share provides the SMB extensions of
+// macOS clients.
+func (sp *sharePlanner) macOSFruit() bool {
+	mac := sp.SmbShare.Spec.MacOS
+	return mac != nil && mac.Fruit
+}
+
+// spotlight returns true if macOS clients may search the share with
+// Spotlight.
+func (sp *sharePlanner) spotlight() bool {
+	mac := sp.SmbShare.Spec.MacOS
+	return mac != nil && mac.Spotlight
+}
+
+// storeDosAttributes returns true if the share is explicitly set to store
+// DOS attributes in extended attributes. Samba stores them by default as
+// well, but volumes lacking extended attributes are only reported when they
+// are requested explicitly.
+func (sp *sharePlanner) storeDosAttributes() bool {
+	v := sp.SmbShare.Spec.StoreDosAttributes
+	return v != nil && *v
+}
+
+// dosAttributeMappingOptions returns the parameters mapping DOS attributes
+// to the permissions of the files. Shares storing DOS attributes map none,
+// as samba would otherwise keep some attributes, such as the archive bit,
+// in the permissions rather than in the extended attributes.
+func (sp *sharePlanner) dosAttributeMappingOptions() smbcc.SmbOptions {
+	opts := smbcc.SmbOptions{}
+	if sp.storeDosAttributes() {
+		opts[smbcc.MapArchiveParam] = smbcc.No
+		opts[smbcc.MapHiddenParam] = smbcc.No
+		opts[smbcc.MapSystemParam] = smbcc.No
+		opts[smbcc.MapReadonlyParam] = smbcc.No
+		return opts
 	}
-	switch reg {
-	// allowed values
-	case dnsRegisterExternalIP, dnsRegisterClusterIP:
-	// anything else is reverted to "never"
-	default:
-		reg = dnsRegisterNever
+	mapping := sp.SmbShare.Spec.DosAttributeMapping
+	if mapping == nil {
+		return opts
 	}
-	return reg
+	setBool(opts, smbcc.MapArchiveParam, mapping.Archive)
+	setBool(opts, smbcc.MapHiddenParam, mapping.Hidden)
+	setBool(opts, smbcc.MapSystemParam, mapping.System)
+	if mapping.ReadOnly != "" {
+		opts[smbcc.MapReadonlyParam] = mapping.ReadOnly
+	}
+	return opts
 }
 
-func (*sharePlanner) serviceWatchStateDir() string {
-	return "/var/lib/svcwatch"
+const (
+	// guestRead lets guests read the files of the share.
+	guestRead = "read"
+	// guestDropBox lets guests add files to the share without being able
+	// to read any.
+	guestDropBox = "dropbox"
+
+	// dropBoxCreateMask leaves only write permission for the owner on the
+	// files of dropbox shares.
+	dropBoxCreateMask = "0200"
+	// dropBoxDirectoryMask lets the owner of a directory of a dropbox
+	// share add files to it, but not list it.
+	dropBoxDirectoryMask = "0300"
+)
+
+// inheritOwnerWindowsAndUnix makes samba give new files the unix owner of
+// their parent directory and the windows owner of its ACL.
+const inheritOwnerWindowsAndUnix = "windows and unix"
+
+// guestKey is the key of the globals section letting clients log in as
+// the guest user.
+const guestKey = smbcc.Key("guest")
+
+// guestAccess returns true if a share of the server group allows guest
+// access.
+func (sp *sharePlanner) guestAccess() bool {
+	if sp.SmbShare != nil && sp.SmbShare.Spec.GuestAccess != "" {
+		return true
+	}
+	shares := sp.groupShares()
+	for i := range shares {
+		if shares[i].Spec.GuestAccess != "" {
+			return true
+		}
+	}
+	return false
 }
 
-func (sp *sharePlanner) serviceWatchJSONPath() string {
-	return path.Join(sp.serviceWatchStateDir(), "status.json")
+// defaultGuestAccount is the guest account of samba, which exists in the
+// samba container images.
+const defaultGuestAccount = "nobody"
+
+// guestAccount returns the user guests of the server group are mapped to,
+// or an empty string for samba's default.
+func (sp *sharePlanner) guestAccount() string {
+	if sp.SmbShare != nil && sp.SmbShare.Spec.GuestAccount != "" {
+		return sp.SmbShare.Spec.GuestAccount
+	}
+	shares := sp.groupShares()
+	for i := range shares {
+		if shares[i].Spec.GuestAccount != "" {
+			return shares[i].Spec.GuestAccount
+		}
+	}
+	return ""
 }
 
-func (sp *sharePlanner) dnsRegisterArgs() []string {
-	args := []string{
-		"dns-register",
-		"--watch",
+// guestAccountKey returns the key of the globals section setting the guest
+// account, or an empty key if samba's default is used.
+func (sp *sharePlanner) guestAccountKey() smbcc.Key {
+	account := sp.guestAccount()
+	if !sp.guestAccess() || account == "" {
+		return ""
 	}
-	if sp.dnsRegister() == dnsRegisterClusterIP {
-		args = append(args, "--target=internal")
+	return smbcc.Key("guest_account_" + account)
+}
+
+// wideLinksKey is the key of the globals section allowing wide links.
+const wideLinksKey = smbcc.Key("wide_links")
+
+// wideLinks returns true if a share of the server group lets clients follow
+// symbolic links out of the share.
+func (sp *sharePlanner) wideLinks() bool {
+	if sp.SmbShare != nil && sp.SmbShare.Spec.WideLinks {
+		return true
 	}
-	args = append(args, sp.serviceWatchJSONPath())
-	return args
+	shares := sp.groupShares()
+	for i := range shares {
+		if shares[i].Spec.WideLinks {
+			return true
+		}
+	}
+	return false
 }
 
-func (sp *sharePlanner) serviceType() string {
-	if sp.CommonConfig != nil && sp.CommonConfig.Spec.Network.Publish == "external" {
-		return "LoadBalancer"
+// posixExtensionsKey is the key of the globals section advertising the
+// SMB3 POSIX extensions.
+const posixExtensionsKey = smbcc.Key("smb3_unix_extensions")
+
+// posixMask is the create and directory mask of shares with the POSIX
+// extensions, keeping the permissions given by the clients.
+const posixMask = "0777"
+
+// posixExtensions returns true if a share of the server group enables the
+// SMB3 POSIX extensions.
+func (sp *sharePlanner) posixExtensions() bool {
+	if sp.SmbShare != nil && sp.SmbShare.Spec.PosixExtensions {
+		return true
 	}
-	return "ClusterIP"
+	shares := sp.groupShares()
+	for i := range shares {
+		if shares[i].Spec.PosixExtensions {
+			return true
+		}
+	}
+	return false
 }
 
-func (sp *sharePlanner) sambaContainerDebugLevel() string {
-	return sp.GlobalConfig.SambaDebugLevel
+// leases returns the smb2 leases setting of the server group: false if a
+// share of the group turns leases off, true if a share turns them on, and
+// nil, leaving samba's default, if no share sets them.
+func (sp *sharePlanner) leases() *bool {
+	values := []*bool{}
+	if sp.SmbShare != nil {
+		values = append(values, shareLeases(sp.SmbShare))
+	}
+	shares := sp.groupShares()
+	for i := range shares {
+		values = append(values, shareLeases(&shares[i]))
+	}
+	var leases *bool
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if !*v {
+			return v
+		}
+		leases = v
+	}
+	return leases
+}
+
+// shareLeases returns the leases setting of the share. Shares with durable
+// handles turn leases on, unless they turn them off explicitly.
+func shareLeases(s *sambaoperatorv1alpha1.SmbShare) *bool {
+	if s.Spec.Leases == nil && durableHandles(s) {
+		yes := true
+		return &yes
+	}
+	return s.Spec.Leases
+}
+
+// durableHandles returns true if the share grants durable handles, which
+// persistent handles imply.
+func durableHandles(s *sambaoperatorv1alpha1.SmbShare) bool {
+	return s.Spec.DurableHandles || s.Spec.PersistentHandles
+}
+
+// clustered returns true if the server group is served by several samba
+// servers sharing their state.
+func (sp *sharePlanner) clustered() bool {
+	return sp.replicas() > 1
+}
+
+// leasesKey returns the key of the globals section setting smb2 leases, or
+// an empty key if samba's default is used. The key names the setting, as
+// the globals are shared by all server groups.
+func (sp *sharePlanner) leasesKey() smbcc.Key {
+	leases := sp.leases()
+	if leases == nil {
+		return ""
+	}
+	if *leases {
+		return smbcc.Key("leases_yes")
+	}
+	return smbcc.Key("leases_no")
+}
+
+// loopbackInterface is always listened on when the interfaces of the server
+// are restricted, for the liveness probe and the samba tools connecting to
+// the local server.
+const loopbackInterface = "lo"
+
+// interfaces returns the network interfaces the server listens on, or nil
+// if it listens on all the interfaces of the pod. Interfaces set on the
+// share override those of the common config.
+func (sp *sharePlanner) interfaces() []string {
+	if sp.SmbShare != nil && len(sp.SmbShare.Spec.Interfaces) > 0 {
+		return sp.SmbShare.Spec.Interfaces
+	}
+	if sp.CommonConfig != nil {
+		return sp.CommonConfig.Spec.Network.Interfaces
+	}
+	return nil
+}
+
+// interfacesParam returns the value of the interfaces parameter of the
+// server, which includes the loopback interface.
+func (sp *sharePlanner) interfacesParam() string {
+	ifaces := []string{loopbackInterface}
+	for _, iface := range sp.interfaces() {
+		if iface != loopbackInterface {
+			ifaces = append(ifaces, iface)
+		}
+	}
+	return strings.Join(ifaces, " ")
+}
+
+// interfacesKey returns the key of the globals section binding the server
+// to its interfaces, or an empty key if the server listens on all
+// interfaces. The key names the interfaces, as the globals are shared by
+// all server groups.
+func (sp *sharePlanner) interfacesKey() smbcc.Key {
+	if len(sp.interfaces()) == 0 {
+		return ""
+	}
+	return smbcc.Key("interfaces_" + strings.ReplaceAll(
+		sp.interfacesParam(), " ", ","))
+}
+
+// multiChannelKey is the key of the globals section turning on SMB3
+// multichannel.
+const multiChannelKey = smbcc.Key("multi_channel")
+
+// multiChannel returns true if the server supports SMB3 multichannel.
+func (sp *sharePlanner) multiChannel() bool {
+	return sp.CommonConfig != nil && sp.CommonConfig.Spec.Network.MultiChannel
+}
+
+// defaultAuthKey is the key of the globals section with the default
+// authentication settings.
+const defaultAuthKey = smbcc.Key("auth")
+
+const (
+	// ntlmV1Permitted accepts NTLMv1, and LANMAN if enabled, from clients.
+	ntlmV1Permitted = "ntlmv1-permitted"
+	// ntlmV2Only refuses NTLMv1 and LANMAN.
+	ntlmV2Only = "ntlmv2-only"
+	// ntlmDisabled refuses NTLM, leaving kerberos as the only way for
+	// clients to authenticate.
+	ntlmDisabled = "disabled"
+)
+
+// authentication returns the authentication settings of the security
+// config, or nil if none are set.
+func (sp *sharePlanner) authentication() *sambaoperatorv1alpha1.SmbSecurityAuthenticationSpec {
+	if sp.SecurityConfig == nil {
+		return nil
+	}
+	return sp.SecurityConfig.Spec.Authentication
+}
+
+// ntlmAuth returns the NTLM protocols clients may authenticate with.
+func (sp *sharePlanner) ntlmAuth() string {
+	if auth := sp.authentication(); auth != nil && auth.NTLMAuth != "" {
+		return auth.NTLMAuth
+	}
+	return ntlmV2Only
+}
+
+// authKey returns the key of the globals section setting the authentication
+// protocols smbd accepts and uses. As the section may be shared by server
+// groups, the key names the settings that differ from the defaults.
+func (sp *sharePlanner) authKey() smbcc.Key {
+	auth := sp.authentication()
+	key := "auth"
+	if ntlm := sp.ntlmAuth(); ntlm != ntlmV2Only {
+		key += "_" + ntlm
+	}
+	if auth != nil && auth.LanmanAuth {
+		key += "_lanman"
+	}
+	if auth != nil && auth.RawNTLMv2Auth {
+		key += "_raw_ntlmv2"
+	}
+	if auth != nil && auth.ClientNTLMv2Auth != nil && !*auth.ClientNTLMv2Auth {
+		key += "_client_ntlmv1"
+	}
+	return smbcc.Key(key)
+}
+
+// authOptions returns the global options selecting the authentication
+// protocols. They are always set, so that the legacy protocols are refused
+// whatever the defaults of the samba version in use.
+func (sp *sharePlanner) authOptions() smbcc.SmbOptions {
+	opts := smbcc.SmbOptions{
+		smbcc.NTLMAuthParam:            sp.ntlmAuth(),
+		smbcc.LanmanAuthParam:          smbcc.No,
+		smbcc.RawNTLMv2AuthParam:       smbcc.No,
+		smbcc.ClientNTLMv2AuthParam:    smbcc.Yes,
+		smbcc.ClientLanmanAuthParam:    smbcc.No,
+		smbcc.ClientPlaintextAuthParam: smbcc.No,
+	}
+	auth := sp.authentication()
+	if auth == nil {
+		return opts
+	}
+	setBool(opts, smbcc.LanmanAuthParam, &auth.LanmanAuth)
+	setBool(opts, smbcc.RawNTLMv2AuthParam, &auth.RawNTLMv2Auth)
+	setBool(opts, smbcc.ClientNTLMv2AuthParam, auth.ClientNTLMv2Auth)
+	return opts
+}
+
+// fileModes returns the share's file and directory mode settings keyed by
+// the smb.conf parameter they map to.
+func fileModes(s *sambaoperatorv1alpha1.SmbShare) map[string]string {
+	spec := s.Spec
+	return map[string]string{
+		smbcc.CreateMaskParam:         spec.CreateMask,
+		smbcc.DirectoryMaskParam:      spec.DirectoryMask,
+		smbcc.ForceCreateModeParam:    spec.ForceCreateMode,
+		smbcc.ForceDirectoryModeParam: spec.ForceDirectoryMode,
+	}
+}
+
+// invalidFileModes returns the smb.conf parameters whose mode values are
+// not valid octal permissions. The returned names are sorted.
+func invalidFileModes(s *sambaoperatorv1alpha1.SmbShare) []string {
+	invalid := []string{}
+	for param, mode := range fileModes(s) {
+		if mode == "" {
+			continue
+		}
+		if v, err := strconv.ParseUint(mode, 8, 32); err != nil || v > 07777 {
+			invalid = append(invalid, fmt.Sprintf("%s=%q", param, mode))
+		}
+	}
+	sort.Strings(invalid)
+	return invalid
+}
+
+// setBool sets a boolean smb.conf parameter if the setting is not nil.
+func setBool(opts smbcc.SmbOptions, param string, v *bool) {
+	if v == nil {
+		return
+	}
+	if *v {
+		opts[param] = smbcc.Yes
+	} else {
+		opts[param] = smbcc.No
+	}
+}
+
+// joinFilePatterns formats file name patterns as a value of the veto files
+// and hide files parameters, where each pattern is enclosed in "/". Samba
+// offers no way to escape a "/" in a pattern, so patterns containing one
+// are rejected by invalidFilePatterns. Whitespace is kept as is, as it is
+// part of the file names.
+// hideFiles returns the file name patterns hidden from the clients of the
+// share: those listed by the share and the quarantine directory of the
+// infected files.
+func (sp *sharePlanner) hideFiles() []string {
+	patterns := sp.SmbShare.Spec.HideFiles
+	if sp.antivirus() != nil &&
+		sp.infectedFileAction() == defaultInfectedFileAction {
+		// ---
+		patterns = append(append([]string{}, patterns...), sp.quarantineDirectory())
+	}
+	return patterns
+}
+
+func joinFilePatterns(patterns []string) string {
+	return "/" + strings.Join(patterns, "/") + "/"
+}
+
+// invalidFilePatterns returns the veto and hide file patterns of the share
+// that can not be passed to samba: empty patterns, and patterns containing
+// "/" or control characters.
+func invalidFilePatterns(s *sambaoperatorv1alpha1.SmbShare) []string {
+	return invalidPatterns(s.Spec.VetoFiles, s.Spec.HideFiles)
+}
+
+// invalidPatterns returns the file name patterns of the lists that can not
+// be joined by joinFilePatterns, quoted.
+func invalidPatterns(lists ...[]string) []string {
+	invalid := []string{}
+	for _, patterns := range lists {
+		for _, p := range patterns {
+			if p == "" || strings.ContainsRune(p, '/') ||
+				strings.IndexFunc(p, unicode.IsControl) >= 0 {
+				invalid = append(invalid, strconv.Quote(p))
+			}
+		}
+	}
+	return invalid
+}
+
+// invalidHosts returns the entries of the hosts allow and deny lists of
+// the share that are neither an IP address, a CIDR network nor a host name.
+func invalidHosts(s *sambaoperatorv1alpha1.SmbShare) []string {
+	invalid := []string{}
+	for _, hosts := range [][]string{s.Spec.HostsAllow, s.Spec.HostsDeny} {
+		for _, h := range hosts {
+			if _, _, err := net.ParseCIDR(h); err == nil {
+				continue
+			}
+			if net.ParseIP(h) != nil || validDNSName(h) {
+				continue
+			}
+			invalid = append(invalid, strconv.Quote(h))
+		}
+	}
+	return invalid
+}
+
+// invalidAccountChars are the characters that may not appear in the name
+// of a user or a group, as they are not allowed in Windows account names.
+const invalidAccountChars = `"/\[]:;|=,+*?<>`
+
+// validAccountName returns true if name is a valid user or group name to
+// force the files of a share to. Only shares of a security config in
+// active-directory mode may qualify a name with a domain, as DOMAIN\name.
+func validAccountName(name string, mode securityMode) bool {
+	if i := strings.IndexRune(name, '\\'); i >= 0 {
+		if mode != adMode || i == 0 {
+			return false
+		}
+		name = name[i+1:]
+	}
+	return name != "" && name == strings.TrimSpace(name) &&
+		!strings.ContainsAny(name, invalidAccountChars) &&
+		strings.IndexFunc(name, unicode.IsControl) < 0
+}
+
+// setUserList sets an smb.conf parameter taking a list of user and group
+// names. Names containing spaces are quoted. Empty lists are omitted.
+func setUserList(opts smbcc.SmbOptions, param string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		if strings.ContainsAny(n, " \t") {
+			n = `"` + n + `"`
+		}
+		quoted[i] = n
+	}
+	opts[param] = strings.Join(quoted, ", ")
+}
+
+// accessControlConflicts returns the names that appear in both the read
+// list and the write list of the share. Names are compared without regard
+// to case, as they are by samba.
+func accessControlConflicts(
+	ac *sambaoperatorv1alpha1.SmbShareAccessControl) []string {
+	// ---
+	conflicts := []string{}
+	if ac == nil {
+		return conflicts
+	}
+	readers := map[string]bool{}
+	for _, n := range ac.ReadList {
+		readers[strings.ToLower(n)] = true
+	}
+	for _, n := range ac.WriteList {
+		if readers[strings.ToLower(n)] {
+			conflicts = append(conflicts, n)
+		}
+	}
+	return conflicts
+}
+
+// realmOptions returns the global smb.conf parameters for the domain.
+func (sp *sharePlanner) realmOptions() smbcc.SmbOptions {
+	opts := sp.idmapOptions()
+	// security mode
+	opts["security"] = "ads"
+	// workgroup and realm
+	opts[smbcc.WorkgroupParam] = sp.workgroup()
+	opts["realm"] = sp.realm()
+	if sp.allowTrustedDomains() {
+		opts[smbcc.AllowTrustedDomainsParam] = smbcc.Yes
+		opts[smbcc.WinbindScanTrustedDomainsParam] = smbcc.Yes
+	}
+	if sp.keytabSecret() != "" {
+		opts[smbcc.KerberosMethodParam] = "dedicated keytab"
+		opts[smbcc.DedicatedKeytabFileParam] = "FILE:" + sp.keytabPath()
+	}
+	if sp.krb5ConfConfigMap() != "" {
+		// the containers find the supplied krb5.conf by KRB5_CONFIG
+		opts[smbcc.CreateKrb5ConfParam] = "no"
+	}
+	// the join and dns-register containers use the same configuration,
+	// so their connections to the domain controllers are secured alike
+	for param, v := range sp.clientSecurityOptions() {
+		opts[param] = v
+	}
+	for param, v := range sp.winbindOptions() {
+		opts[param] = v
+	}
+	return opts
+}
+
+// defaultClientSigning signs the connections to the domain controllers,
+// as hardened domains require.
+const defaultClientSigning = "mandatory"
+
+// clientSecurityOptions returns the global options securing the client
+// connections of the domain member.
+func (sp *sharePlanner) clientSecurityOptions() smbcc.SmbOptions {
+	opts := smbcc.SmbOptions{
+		smbcc.ClientSigningParam: defaultClientSigning,
+	}
+	if sp.SecurityConfig == nil || sp.SecurityConfig.Spec.Client == nil {
+		return opts
+	}
+	client := sp.SecurityConfig.Spec.Client
+	if client.Signing != "" {
+		opts[smbcc.ClientSigningParam] = client.Signing
+	}
+	if client.Encryption != "" {
+		opts[smbcc.ClientSMBEncryptParam] = client.Encryption
+	}
+	if client.MaxProtocol != "" {
+		opts[smbcc.ClientMaxProtocolParam] = client.MaxProtocol
+	}
+	if client.IPCMaxProtocol != "" {
+		opts[smbcc.ClientIPCMaxProtocolParam] = client.IPCMaxProtocol
+	}
+	return opts
+}
+
+// winbindOptions returns the global options tuning the winbind daemons of
+// the domain member.
+func (sp *sharePlanner) winbindOptions() smbcc.SmbOptions {
+	opts := smbcc.SmbOptions{}
+	if sp.SecurityConfig == nil || sp.SecurityConfig.Spec.Winbind == nil {
+		return opts
+	}
+	wb := sp.SecurityConfig.Spec.Winbind
+	setInt := func(param string, v *int32) {
+		if v != nil {
+			opts[param] = strconv.Itoa(int(*v))
+		}
+	}
+	setInt(smbcc.WinbindRequestTimeoutParam, wb.RequestTimeout)
+	setInt(smbcc.WinbindMaxClientsParam, wb.MaxClients)
+	setInt(smbcc.WinbindMaxDomainConnectionsParam, wb.MaxDomainConnections)
+	return opts
+}
+
+func (sp *sharePlanner) update() (changed bool, err error) {
+	printingKey := smbcc.NoPrintingKey
+	if sp.printServices() {
+		printingKey = smbcc.PrintingKey
+		if _, found := sp.ConfigState.Globals[printingKey]; !found {
+			sp.ConfigState.Globals[printingKey] = smbcc.NewPrintingGlobals()
+			changed = true
+		}
+		if _, found := sp.ConfigState.Shares[smbcc.PrintersKey]; !found {
+			sp.ConfigState.Shares[smbcc.PrintersKey] = smbcc.NewPrintersShare()
+			changed = true
+		}
+	} else if _, found := sp.ConfigState.Globals[printingKey]; !found {
+		sp.ConfigState.Globals[printingKey] = smbcc.NewNoPrintingGlobals()
+		changed = true
+	}
+	shareKey := smbcc.Key(sp.shareName())
+	share, found := sp.ConfigState.Shares[shareKey]
+	shareOpts := sp.shareOptions()
+	if !found || !reflect.DeepEqual(share.Options, shareOpts) {
+		share = smbcc.ShareConfig{Options: shareOpts}
+		sp.ConfigState.Shares[shareKey] = share
+		changed = true
+	}
+	cfgKey := sp.instanceID()
+	cfg, found := sp.ConfigState.Configs[cfgKey]
+	groupKeys := sp.configShareKeys(sp.groupShareKeys(""))
+	globalKeys := []smbcc.Key{printingKey}
+	if sp.securityMode() == adMode {
+		globalKeys = append(globalKeys, smbcc.Key(sp.realm()))
+	}
+	authKey := sp.authKey()
+	globalKeys = append(globalKeys, authKey)
+	if _, found := sp.ConfigState.Globals[authKey]; !found {
+		sp.ConfigState.Globals[authKey] = smbcc.GlobalConfig{
+			Options: sp.authOptions(),
+		}
+		changed = true
+	}
+	if portsKey := sp.portsKey(); portsKey != "" {
+		globalKeys = append(globalKeys, portsKey)
+		if _, found := sp.ConfigState.Globals[portsKey]; !found {
+			sp.ConfigState.Globals[portsKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					smbcc.SmbPortsParam: strconv.Itoa(int(sp.smbPort())),
+				},
+			}
+			changed = true
+		}
+	}
+	if limitsKey := sp.limitsKey(); limitsKey != "" {
+		globalKeys = append(globalKeys, limitsKey)
+		if _, found := sp.ConfigState.Globals[limitsKey]; !found {
+			sp.ConfigState.Globals[limitsKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					smbcc.MaxSmbdProcessesParam: strconv.Itoa(
+						int(sp.maxSmbdProcesses())),
+				},
+			}
+			changed = true
+		}
+	}
+	if sp.guestAccess() {
+		globalKeys = append(globalKeys, guestKey)
+		if _, found := sp.ConfigState.Globals[guestKey]; !found {
+			sp.ConfigState.Globals[guestKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					// logins of unknown users become guest logins
+					smbcc.MapToGuestParam: "Bad User",
+				},
+			}
+			changed = true
+		}
+	}
+	if guestAccountKey := sp.guestAccountKey(); guestAccountKey != "" {
+		globalKeys = append(globalKeys, guestAccountKey)
+		if _, found := sp.ConfigState.Globals[guestAccountKey]; !found {
+			sp.ConfigState.Globals[guestAccountKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					smbcc.GuestAccountParam: sp.guestAccount(),
+				},
+			}
+			changed = true
+		}
+	}
+	if sp.wideLinks() {
+		globalKeys = append(globalKeys, wideLinksKey)
+		if _, found := sp.ConfigState.Globals[wideLinksKey]; !found {
+			sp.ConfigState.Globals[wideLinksKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					// samba ignores wide links while the unix extensions,
+					// letting clients create symbolic links, are enabled
+					smbcc.AllowInsecureWideLinksParam: smbcc.Yes,
+				},
+			}
+			changed = true
+		}
+	}
+	if sp.msdfs() {
+		globalKeys = append(globalKeys, msdfsKey)
+		if _, found := sp.ConfigState.Globals[msdfsKey]; !found {
+			sp.ConfigState.Globals[msdfsKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					smbcc.HostMSDFSParam: smbcc.Yes,
+				},
+			}
+			changed = true
+		}
+	}
+	if sp.posixExtensions() {
+		globalKeys = append(globalKeys, posixExtensionsKey)
+		if _, found := sp.ConfigState.Globals[posixExtensionsKey]; !found {
+			sp.ConfigState.Globals[posixExtensionsKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					smbcc.SMB3UnixExtensionsParam: smbcc.Yes,
+				},
+			}
+			changed = true
+		}
+	}
+	if sp.profiling() {
+		globalKeys = append(globalKeys, profilingKey)
+		if _, found := sp.ConfigState.Globals[profilingKey]; !found {
+			sp.ConfigState.Globals[profilingKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					smbcc.SmbdProfilingParam: "on",
+				},
+			}
+			changed = true
+		}
+	}
+	if leasesKey := sp.leasesKey(); leasesKey != "" {
+		globalKeys = append(globalKeys, leasesKey)
+		if _, found := sp.ConfigState.Globals[leasesKey]; !found {
+			opts := smbcc.SmbOptions{}
+			setBool(opts, smbcc.SMB2LeasesParam, sp.leases())
+			sp.ConfigState.Globals[leasesKey] = smbcc.GlobalConfig{
+				Options: opts,
+			}
+			changed = true
+		}
+	}
+	if interfacesKey := sp.interfacesKey(); interfacesKey != "" {
+		globalKeys = append(globalKeys, interfacesKey)
+		if _, found := sp.ConfigState.Globals[interfacesKey]; !found {
+			sp.ConfigState.Globals[interfacesKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					smbcc.InterfacesParam:         sp.interfacesParam(),
+					smbcc.BindInterfacesOnlyParam: smbcc.Yes,
+				},
+			}
+			changed = true
+		}
+	}
+	if sp.multiChannel() {
+		globalKeys = append(globalKeys, multiChannelKey)
+		if _, found := sp.ConfigState.Globals[multiChannelKey]; !found {
+			sp.ConfigState.Globals[multiChannelKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					smbcc.ServerMultiChannelSupportParam: smbcc.Yes,
+				},
+			}
+			changed = true
+		}
+	}
+	if sp.domainGroupAccess() {
+		key := sp.domainGroupsKey()
+		globalKeys = append(globalKeys, key)
+		if _, found := sp.ConfigState.Globals[key]; !found {
+			sp.ConfigState.Globals[key] = smbcc.GlobalConfig{
+				Options: sp.domainGroupsOptions(),
+			}
+			changed = true
+		}
+	}
+	if includeKey := sp.includeKey(); includeKey != "" {
+		globalKeys = append(globalKeys, includeKey)
+		if _, found := sp.ConfigState.Globals[includeKey]; !found {
+			sp.ConfigState.Globals[includeKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					smbcc.IncludeParam: sp.includePath(),
+				},
+			}
+			changed = true
+		}
+	}
+	if identityKey := sp.identityKey(); identityKey != "" {
+		globalKeys = append(globalKeys, identityKey)
+		if _, found := sp.ConfigState.Globals[identityKey]; !found {
+			sp.ConfigState.Globals[identityKey] = smbcc.GlobalConfig{
+				Options: sp.identityOptions(),
+			}
+			changed = true
+		}
+	}
+	if performanceKey := sp.performanceKey(); performanceKey != "" {
+		globalKeys = append(globalKeys, performanceKey)
+		if _, found := sp.ConfigState.Globals[performanceKey]; !found {
+			sp.ConfigState.Globals[performanceKey] = smbcc.GlobalConfig{
+				Options: sp.performanceOptions(),
+			}
+			changed = true
+		}
+	}
+	if sessionsKey := sp.sessionsKey(); sessionsKey != "" {
+		globalKeys = append(globalKeys, sessionsKey)
+		if _, found := sp.ConfigState.Globals[sessionsKey]; !found {
+			sp.ConfigState.Globals[sessionsKey] = smbcc.GlobalConfig{
+				Options: sp.sessionsOptions(),
+			}
+			changed = true
+		}
+	}
+	if socketOptionsKey := sp.socketOptionsKey(); socketOptionsKey != "" {
+		globalKeys = append(globalKeys, socketOptionsKey)
+		if _, found := sp.ConfigState.Globals[socketOptionsKey]; !found {
+			sp.ConfigState.Globals[socketOptionsKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					smbcc.SocketOptionsParam: sp.socketOptionsParam(),
+				},
+			}
+			changed = true
+		}
+	}
+	if sp.customConfig() != nil {
+		// the custom smb.conf replaces the generated shares and globals
+		customKey := sp.customConfigKey()
+		groupKeys = []smbcc.Key{}
+		globalKeys = []smbcc.Key{customKey}
+		if _, found := sp.ConfigState.Globals[customKey]; !found {
+			sp.ConfigState.Globals[customKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					smbcc.IncludeParam: sp.customConfigPath(),
+				},
+			}
+			changed = true
+		}
+	}
+	if sp.collectCores() {
+		// kept with a custom smb.conf, which only replaces the
+		// generated configuration
+		globalKeys = append(globalKeys, coresKey)
+		if _, found := sp.ConfigState.Globals[coresKey]; !found {
+			sp.ConfigState.Globals[coresKey] = smbcc.GlobalConfig{
+				Options: smbcc.SmbOptions{
+					smbcc.PanicActionParam: sp.panicAction(),
+				},
+			}
+			changed = true
+		}
+	}
+	if passdbKey := sp.passdbKey(); passdbKey != "" {
+		// kept with a custom smb.conf, as the init containers store the
+		// password of the configured admin DN
+		globalKeys = append(globalKeys, passdbKey)
+		if _, found := sp.ConfigState.Globals[passdbKey]; !found {
+			sp.ConfigState.Globals[passdbKey] = smbcc.GlobalConfig{
+				Options: sp.passdbOptions(),
+			}
+			changed = true
+		}
+	}
+	if loggingKey := sp.loggingKey(); loggingKey != "" {
+		// kept with a custom smb.conf, like the collection of cores
+		globalKeys = append(globalKeys, loggingKey)
+		if _, found := sp.ConfigState.Globals[loggingKey]; !found {
+			sp.ConfigState.Globals[loggingKey] = smbcc.GlobalConfig{
+				Options: sp.loggingOptions(),
+			}
+			changed = true
+		}
+	}
+	if !found ||
+		!reflect.DeepEqual(cfg.Shares, groupKeys) ||
+		!reflect.DeepEqual(cfg.Globals, globalKeys) {
+		// ---
+		cfg = smbcc.ConfigSection{
+			Shares:       groupKeys,
+			Globals:      globalKeys,
+			InstanceName: sp.instanceName(),
+		}
+		sp.ConfigState.Configs[cfgKey] = cfg
+		changed = true
+	}
+	if len(sp.ConfigState.Users) == 0 {
+		sp.ConfigState.Users = smbcc.NewDefaultUsers()
+		changed = true
+	}
+	if sp.securityMode() == adMode {
+		realmKey := smbcc.Key(sp.realm())
+		globals, found := sp.ConfigState.Globals[realmKey]
+		opts := sp.realmOptions()
+		if !found || !reflect.DeepEqual(globals.Options, opts) {
+			sp.ConfigState.Globals[realmKey] = smbcc.GlobalConfig{
+				Options: opts,
+			}
+			changed = true
+		}
+	}
+	return
+}
+
+// groupShareKeys returns the sorted keys of the shares of the server
+// group, skipping the share named exclude. The planner's own share is
+// always included, unless excluded, other members only once their share
+// configuration exists.
+func (sp *sharePlanner) groupShareKeys(exclude string) []smbcc.Key {
+	keys := []smbcc.Key{}
+	own := sp.shareName()
+	for i := range sp.groupShares() {
+		name := shareNameOf(&sp.groupShares()[i])
+		if name == exclude {
+			continue
+		}
+		if _, found := sp.ConfigState.Shares[smbcc.Key(name)]; found || name == own {
+			keys = append(keys, smbcc.Key(name))
+		}
+	}
+	if exclude != own && !containsKey(keys, smbcc.Key(own)) {
+		keys = append(keys, smbcc.Key(own))
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// servedShareKeys returns the keys, out of the given share keys, of the
+// shares of the server group that are not suspended.
+func (sp *sharePlanner) servedShareKeys(keys []smbcc.Key) []smbcc.Key {
+	suspended := map[smbcc.Key]bool{}
+	shares := sp.groupShares()
+	for i := range shares {
+		if shares[i].Spec.Suspended {
+			suspended[smbcc.Key(shareNameOf(&shares[i]))] = true
+		}
+	}
+	served := []smbcc.Key{}
+	for _, k := range keys {
+		if !suspended[k] {
+			served = append(served, k)
+		}
+	}
+	return served
+}
+
+// configShareKeys returns the keys of the shares listed in the
+// configuration of the server group: the served shares, out of the given
+// share keys, followed by the share of the printers if print services are
+// enabled.
+func (sp *sharePlanner) configShareKeys(keys []smbcc.Key) []smbcc.Key {
+	served := sp.servedShareKeys(keys)
+	if sp.printServices() {
+		served = append(served, smbcc.PrintersKey)
+	}
+	return served
+}
+
+// printServices returns true if the samba servers share printers.
+func (sp *sharePlanner) printServices() bool {
+	return sp.CommonConfig != nil && sp.CommonConfig.Spec.PrintServices
+}
+
+func containsKey(keys []smbcc.Key, k smbcc.Key) bool {
+	for _, key := range keys {
+		if key == k {
+			return true
+		}
+	}
+	return false
+}
+
+func (sp *sharePlanner) prune() (changed bool, err error) {
+	cfgKey := sp.instanceID()
+	if cfg, found := sp.ConfigState.Configs[cfgKey]; found {
+		// the share is removed from the group, the group's
+		// configuration is only removed with its last share.
+		remaining := sp.groupShareKeys(sp.shareName())
+		if len(remaining) == 0 {
+			delete(sp.ConfigState.Configs, cfgKey)
+			changed = true
+		} else if served := sp.configShareKeys(remaining); !reflect.DeepEqual(cfg.Shares, served) {
+			cfg.Shares = served
+			sp.ConfigState.Configs[cfgKey] = cfg
+			changed = true
+		}
+	}
+	shareKey := smbcc.Key(sp.shareName())
+	if _, found := sp.ConfigState.Shares[shareKey]; found {
+		delete(sp.ConfigState.Shares, shareKey)
+		changed = true
+	}
+	return
+}
+
+func (sp *sharePlanner) dnsRegister() dnsRegister {
+	reg := dnsRegisterNever
+	if sp.securityMode() == adMode && sp.SecurityConfig.Spec.DNS != nil {
+		reg = dnsRegister(sp.SecurityConfig.Spec.DNS.Register)
+	}
+	switch reg {
+	// allowed values
+	case dnsRegisterExternalIP, dnsRegisterClusterIP:
+	// anything else is reverted to "never"
+	default:
+		reg = dnsRegisterNever
+	}
+	return reg
+}
+
+func (*sharePlanner) serviceWatchStateDir() string {
+	return "/var/lib/svcwatch"
+}
+
+func (sp *sharePlanner) serviceWatchJSONPath() string {
+	return path.Join(sp.serviceWatchStateDir(), "status.json")
+}
+
+func (sp *sharePlanner) dnsRegisterArgs() []string {
+	args := []string{
+		"dns-register",
+		"--watch",
+	}
+	args = append(args, sp.dnsRecordArgs()...)
+	args = append(args, sp.serviceWatchJSONPath())
+	return args
+}
+
+// dnsUnregisterCommand returns the command that removes the server's DNS
+// records when the dns-register container stops.
+func (sp *sharePlanner) dnsUnregisterCommand() []string {
+	cmd := []string{
+		"samba-container",
+		"dns-register",
+		"--unregister",
+	}
+	cmd = append(cmd, sp.dnsRecordArgs()...)
+	cmd = append(cmd, sp.serviceWatchJSONPath())
+	return cmd
+}
+
+// dnsRecordArgs returns the dns-register options selecting the records to
+// be registered.
+func (sp *sharePlanner) dnsRecordArgs() []string {
+	args := []string{}
+	if sp.dnsRegister() == dnsRegisterClusterIP {
+		args = append(args, "--target=internal")
+	}
+	if ttl := sp.dnsTTL(); ttl > 0 {
+		args = append(args, fmt.Sprintf("--ttl=%d", ttl))
+	}
+	if sp.dnsRegisterPTR() {
+		args = append(args, "--reverse")
+	}
+	if method := sp.dnsUpdateMethod(); method != dnsUpdateGSSTSIG {
+		args = append(args, "--update-method="+method)
+	}
+	if sp.dnsUpdateMethod() == dnsUpdateTSIG && sp.dnsTSIGKey() != nil {
+		args = append(args, "--tsig-key="+sp.dnsTSIGKeyPath())
+	}
+	if server := sp.dnsServer(); server != "" {
+		args = append(args, "--server="+server)
+	}
+	for _, alias := range sp.dnsAliases() {
+		args = append(args, "--alias="+alias)
+	}
+	return args
+}
+
+// dnsTTL returns the time to live of the registered DNS records in
+// seconds, or zero if it is not set.
+func (sp *sharePlanner) dnsTTL() int32 {
+	dns := sp.SecurityConfig.Spec.DNS
+	if dns == nil || dns.TTL == nil {
+		return 0
+	}
+	return *dns.TTL
+}
+
+const (
+	// dnsUpdateGSSTSIG signs DNS updates with the machine account.
+	dnsUpdateGSSTSIG = "gss-tsig"
+	// dnsUpdateTSIG signs DNS updates with a shared key.
+	dnsUpdateTSIG = "tsig"
+	// dnsUpdateUnauthenticated sends unsigned DNS updates.
+	dnsUpdateUnauthenticated = "unauthenticated"
+)
+
+// defaultTSIGKeyFile is the key of the Secret holding the TSIG key, unless
+// another one is named.
+const defaultTSIGKeyFile = "tsig.key"
+
+// dnsUpdateMethod returns how the DNS updates of the server are
+// authenticated.
+func (sp *sharePlanner) dnsUpdateMethod() string {
+	dns := sp.SecurityConfig.Spec.DNS
+	if dns == nil || dns.UpdateMethod == "" {
+		return dnsUpdateGSSTSIG
+	}
+	return dns.UpdateMethod
+}
+
+func (sp *sharePlanner) dnsTSIGKey() *sambaoperatorv1alpha1.SmbSecurityDNSKeySpec {
+	if sp.SecurityConfig == nil || sp.SecurityConfig.Spec.DNS == nil {
+		return nil
+	}
+	return sp.SecurityConfig.Spec.DNS.TSIGKey
+}
+
+func (sp *sharePlanner) dnsTSIGKeyFile() string {
+	if k := sp.dnsTSIGKey(); k != nil && k.Key != "" {
+		return k.Key
+	}
+	return defaultTSIGKeyFile
+}
+
+func (*sharePlanner) dnsTSIGKeyDir() string {
+	return "/etc/samba-dns-key"
+}
+
+func (sp *sharePlanner) dnsTSIGKeyPath() string {
+	return path.Join(sp.dnsTSIGKeyDir(), sp.dnsTSIGKeyFile())
+}
+
+// dnsServer returns the address of the DNS server the updates are sent to,
+// or an empty string if the servers of the domain are used.
+func (sp *sharePlanner) dnsServer() string {
+	dns := sp.SecurityConfig.Spec.DNS
+	if dns == nil {
+		return ""
+	}
+	return dns.Server
+}
+
+// dnsRegisterPTR returns true if the reverse record of the server's address
+// is registered along with its forward records.
+func (sp *sharePlanner) dnsRegisterPTR() bool {
+	dns := sp.SecurityConfig.Spec.DNS
+	return dns != nil && dns.RegisterPTR
+}
+
+// dnsAliases returns the fully qualified DNS aliases of the shares in the
+// server group, sorted and without duplicates. Invalid aliases are skipped.
+func (sp *sharePlanner) dnsAliases() []string {
+	domain := strings.ToLower(sp.SecurityConfig.Spec.Realm)
+	aliases := []string{}
+	shares := sp.groupShares()
+	for i := range shares {
+		for _, alias := range shares[i].Spec.DNSAliases {
+			if validDNSAlias(alias) {
+				aliases = append(aliases, alias+"."+domain)
+			}
+		}
+	}
+	return sortedUnique(aliases)
+}
+
+func (sp *sharePlanner) serviceType() string {
+	if sp.CommonConfig == nil {
+		return "ClusterIP"
+	}
+	switch sp.CommonConfig.Spec.Network.Publish {
+	case "external":
+		return "LoadBalancer"
+	case publishRoute:
+		// Routes can not carry SMB, see publishRoute
+		return "NodePort"
+	}
+	return "ClusterIP"
+}
+
+// defaultSmbPort is the standard TCP port of SMB.
+const defaultSmbPort = 445
+
+// smbPort returns the TCP port the server group serves its shares on. A
+// port set on the share overrides the port of the common config.
+func (sp *sharePlanner) smbPort() int32 {
+	if sp.SmbShare != nil && sp.SmbShare.Spec.Port != nil {
+		return *sp.SmbShare.Spec.Port
+	}
+	if sp.CommonConfig != nil && sp.CommonConfig.Spec.Network.Port != nil {
+		return *sp.CommonConfig.Spec.Network.Port
+	}
+	return defaultSmbPort
+}
+
+// portsKey returns the key of the globals section setting the port smbd
+// listens on, or an empty key if smbd uses its default ports.
+func (sp *sharePlanner) portsKey() smbcc.Key {
+	port := sp.smbPort()
+	if port == defaultSmbPort {
+		return ""
+	}
+	return smbcc.Key(fmt.Sprintf("ports_%d", port))
+}
+
+// maxSmbdProcesses returns the limit on the number of smbd processes of
+// the server group, or zero if the number is not limited.
+func (sp *sharePlanner) maxSmbdProcesses() int32 {
+	if sp.CommonConfig != nil && sp.CommonConfig.Spec.MaxSmbdProcesses != nil {
+		return *sp.CommonConfig.Spec.MaxSmbdProcesses
+	}
+	return 0
+}
+
+// deletionProtection returns true if the share may not be deleted while
+// clients are connected to it. A setting of the share overrides the one of
+// the common config.
+func (sp *sharePlanner) deletionProtection() bool {
+	if sp.SmbShare.Spec.DeletionProtection != nil {
+		return *sp.SmbShare.Spec.DeletionProtection
+	}
+	return sp.CommonConfig != nil && sp.CommonConfig.Spec.DeletionProtection
+}
+
+// limitsKey returns the key of the globals section limiting the number of
+// smbd processes, or an empty key if the number is not limited.
+func (sp *sharePlanner) limitsKey() smbcc.Key {
+	n := sp.maxSmbdProcesses()
+	if n == 0 {
+		return ""
+	}
+	return smbcc.Key(fmt.Sprintf("limits_%d", n))
+}
+
+// serverString returns the description of the servers of the share, or an
+// empty string if samba's default is to be used.
+func (sp *sharePlanner) serverString() string {
+	if sp.CommonConfig == nil {
+		return ""
+	}
+	return sp.CommonConfig.Spec.ServerString
+}
+
+// netbiosName returns the NetBIOS name of the servers of the share, or an
+// empty string if the name of the server group is to be used.
+func (sp *sharePlanner) netbiosName() string {
+	if sp.CommonConfig == nil {
+		return ""
+	}
+	return sp.CommonConfig.Spec.NetbiosName
+}
+
+// localWorkgroup returns the workgroup of the servers of a share using
+// user security, or an empty string if samba's default is to be used. The
+// workgroup of domain members is derived from the realm instead.
+func (sp *sharePlanner) localWorkgroup() string {
+	if sp.CommonConfig == nil || sp.securityMode() == adMode {
+		return ""
+	}
+	return sp.CommonConfig.Spec.Workgroup
+}
+
+// identityOptions returns the global options identifying the servers of
+// the share on the network.
+func (sp *sharePlanner) identityOptions() smbcc.SmbOptions {
+	opts := smbcc.SmbOptions{}
+	if s := sp.serverString(); s != "" {
+		opts[smbcc.ServerStringParam] = s
+	}
+	if n := sp.netbiosName(); n != "" {
+		opts[smbcc.NetbiosNameParam] = n
+	}
+	if w := sp.localWorkgroup(); w != "" {
+		opts[smbcc.WorkgroupParam] = w
+	}
+	return opts
+}
+
+// identityKey returns the key of the globals section identifying the
+// servers of the share, or an empty key if the defaults are used. The key
+// is derived from the options, which may contain any characters.
+func (sp *sharePlanner) identityKey() smbcc.Key {
+	opts := sp.identityOptions()
+	if len(opts) == 0 {
+		return ""
+	}
+	// maps of strings always marshal, with sorted keys
+	data, _ := json.Marshal(opts)
+	return smbcc.Key(fmt.Sprintf("identity_%x", sha256.Sum256(data))[:17])
+}
+
+// performanceOptions returns the global options tuning the I/O of the
+// servers of the share.
+func (sp *sharePlanner) performanceOptions() smbcc.SmbOptions {
+	opts := smbcc.SmbOptions{}
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.Performance == nil {
+		return opts
+	}
+	perf := sp.CommonConfig.Spec.Performance
+	setInt := func(param string, v *int64) {
+		if v != nil {
+			opts[param] = strconv.FormatInt(*v, 10)
+		}
+	}
+	setInt(smbcc.AioReadSizeParam, perf.AioReadSize)
+	setInt(smbcc.AioWriteSizeParam, perf.AioWriteSize)
+	if n := perf.AioMaxThreads; n != nil {
+		opts[smbcc.AioMaxThreadsParam] = strconv.Itoa(int(*n))
+	}
+	setBool(opts, smbcc.UseSendfileParam, perf.UseSendfile)
+	setBool(opts, smbcc.ReadRawParam, perf.ReadRaw)
+	setBool(opts, smbcc.WriteRawParam, perf.WriteRaw)
+	setInt(smbcc.SMB2MaxReadParam, perf.SMB2MaxRead)
+	setInt(smbcc.SMB2MaxWriteParam, perf.SMB2MaxWrite)
+	setInt(smbcc.MinReceivefileSizeParam, perf.MinReceivefileSize)
+	if len(perf.AioWriteBehind) > 0 {
+		opts[smbcc.AioWriteBehindParam] = joinFilePatterns(perf.AioWriteBehind)
+	}
+	return opts
+}
+
+// performanceKey returns the key of the globals section tuning the I/O of
+// the servers of the share, or an empty key if samba's defaults are used.
+// The key is derived from the options.
+func (sp *sharePlanner) performanceKey() smbcc.Key {
+	opts := sp.performanceOptions()
+	if len(opts) == 0 {
+		return ""
+	}
+	// maps of strings always marshal, with sorted keys
+	data, _ := json.Marshal(opts)
+	return smbcc.Key(fmt.Sprintf("performance_%x", sha256.Sum256(data))[:20])
+}
+
+// sessionsOptions returns the global options controlling how long the
+// servers of the share keep idle client sessions.
+func (sp *sharePlanner) sessionsOptions() smbcc.SmbOptions {
+	opts := smbcc.SmbOptions{}
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.Sessions == nil {
+		return opts
+	}
+	sessions := sp.CommonConfig.Spec.Sessions
+	setInt := func(param string, v *int32) {
+		if v != nil {
+			opts[param] = strconv.Itoa(int(*v))
+		}
+	}
+	setInt(smbcc.DeadtimeParam, sessions.Deadtime)
+	setInt(smbcc.KeepaliveParam, sessions.Keepalive)
+	setInt(smbcc.SMB2MaxCreditsParam, sessions.SMB2MaxCredits)
+	return opts
+}
+
+// sessionsKey returns the key of the globals section controlling the idle
+// sessions of the servers of the share, or an empty key if samba's defaults
+// are used. The key is derived from the options.
+func (sp *sharePlanner) sessionsKey() smbcc.Key {
+	opts := sp.sessionsOptions()
+	if len(opts) == 0 {
+		return ""
+	}
+	// maps of strings always marshal, with sorted keys
+	data, _ := json.Marshal(opts)
+	return smbcc.Key(fmt.Sprintf("sessions_%x", sha256.Sum256(data))[:17])
+}
+
+// defaultSessionAffinityTimeout is the default time, in seconds, the
+// connections of a client are sent to the same pod: the Kubernetes default
+// of three hours.
+const defaultSessionAffinityTimeout = int32(10800)
+
+// sessionAffinity returns the session affinity of the service of the server
+// group and, with ClientIP affinity, its config.
+func (sp *sharePlanner) sessionAffinity() (
+	corev1.ServiceAffinity, *corev1.SessionAffinityConfig) {
+	// ---
+	var spec *sambaoperatorv1alpha1.SmbServiceSessionAffinity
+	if sp.CommonConfig != nil {
+		spec = sp.CommonConfig.Spec.Network.ServiceSessionAffinity
+	}
+	return sessionAffinity(spec, sp.replicas())
+}
+
+// sessionAffinity returns the session affinity of the service of a server
+// group with the given number of replicas. The SMB sessions of clustered
+// servers break if a client's connections reach different pods, so they
+// default to ClientIP affinity. The services of single pods have none.
+func sessionAffinity(
+	spec *sambaoperatorv1alpha1.SmbServiceSessionAffinity,
+	replicas int32) (corev1.ServiceAffinity, *corev1.SessionAffinityConfig) {
+	// ---
+	if replicas <= 1 || (spec != nil && spec.Type == string(corev1.ServiceAffinityNone)) {
+		return corev1.ServiceAffinityNone, nil
+	}
+	timeout := defaultSessionAffinityTimeout
+	if spec != nil && spec.TimeoutSeconds != nil {
+		timeout = *spec.TimeoutSeconds
+	}
+	return corev1.ServiceAffinityClientIP, &corev1.SessionAffinityConfig{
+		ClientIP: &corev1.ClientIPConfig{TimeoutSeconds: &timeout},
+	}
+}
+
+// ipFamilyPolicy returns the IP family policy of the service of the server
+// group, or an empty string if the cluster's default is to be used.
+func (sp *sharePlanner) ipFamilyPolicy() string {
+	if sp.CommonConfig == nil {
+		return ""
+	}
+	return sp.CommonConfig.Spec.Network.IPFamilyPolicy
+}
+
+// ipFamilies returns the IP families of the service of the server group in
+// order of preference, or nil if the cluster's default is to be used.
+func (sp *sharePlanner) ipFamilies() []string {
+	if sp.CommonConfig == nil {
+		return nil
+	}
+	var families []string
+	for _, f := range sp.CommonConfig.Spec.Network.IPFamilies {
+		families = append(families, string(f))
+	}
+	return families
+}
+
+// publishRoute is the publish setting of shares meant to be exposed like
+// OpenShift Routes, without a cloud load balancer. The OpenShift router
+// only forwards HTTP and TLS connections, selecting the backend using the
+// TLS SNI extension, so SMB connections can not be routed by it. These
+// shares are instead exposed on a port of every node.
+const publishRoute = "route"
+
+// routeRequested returns true if the share is to be published for use like
+// an OpenShift Route.
+func (sp *sharePlanner) routeRequested() bool {
+	return sp.CommonConfig != nil &&
+		sp.CommonConfig.Spec.Network.Publish == publishRoute
+}
+
+// schedulingSettings returns the common config and share specific pod
+// scheduling settings. Either may be nil.
+func (sp *sharePlanner) schedulingSettings() (
+	common, share *sambaoperatorv1alpha1.SmbPodSchedulingSettings) {
+	// ---
+	if sp.CommonConfig != nil && sp.CommonConfig.Spec.PodSettings != nil {
+		common = &sp.CommonConfig.Spec.PodSettings.SmbPodSchedulingSettings
+	}
+	if sp.SmbShare != nil && sp.SmbShare.Spec.PodSettings != nil {
+		share = &sp.SmbShare.Spec.PodSettings.SmbPodSchedulingSettings
+	}
+	return common, share
+}
+
+// nodeSelector returns the node selector for the server pods. A node
+// selector set on the share overrides one from the common config.
+func (sp *sharePlanner) nodeSelector() map[string]string {
+	common, share := sp.schedulingSettings()
+	if share != nil && len(share.NodeSelector) > 0 {
+		return share.NodeSelector
+	}
+	if common != nil {
+		return common.NodeSelector
+	}
+	return nil
+}
+
+// tolerations returns the tolerations for the server pods. Tolerations
+// set on the share override those from the common config.
+func (sp *sharePlanner) tolerations() []corev1.Toleration {
+	common, share := sp.schedulingSettings()
+	if share != nil && len(share.Tolerations) > 0 {
+		return share.Tolerations
+	}
+	if common != nil {
+		return common.Tolerations
+	}
+	return nil
+}
+
+// archLabel is the node label naming the CPU architecture of the node.
+const archLabel = "kubernetes.io/arch"
+
+// affinity returns the affinity for the server pods. Affinity set on
+// the share overrides one from the common config. The pods are required to
+// run on nodes of the supported architectures, and replicas prefer running
+// on different nodes unless spreading them is turned off.
+func (sp *sharePlanner) affinity() *corev1.Affinity {
+	var affinity *corev1.Affinity
+	common, share := sp.schedulingSettings()
+	if share != nil && share.Affinity != nil {
+		affinity = share.Affinity
+	} else if common != nil {
+		affinity = common.Affinity
+	}
+	affinity = withReplicaAntiAffinity(
+		affinity, sp.spreadReplicas(), sp.replicas(),
+		labelsForSmbServer(sp.instanceName()))
+	return withArchAffinity(affinity, sp.supportedArchitectures())
+}
+
+type spreadMode string
+
+const (
+	spreadNode = spreadMode("node")
+	spreadZone = spreadMode("zone")
+	spreadOff  = spreadMode("off")
+)
+
+// spreadReplicas returns how the replicas of the server pods are spread
+// across failure domains. A mode set on the share overrides one from the
+// common config.
+func (sp *sharePlanner) spreadReplicas() spreadMode {
+	common, share := sp.schedulingSettings()
+	if share != nil && share.SpreadReplicas != "" {
+		return spreadMode(share.SpreadReplicas)
+	}
+	if common != nil && common.SpreadReplicas != "" {
+		return spreadMode(common.SpreadReplicas)
+	}
+	return spreadNode
+}
+
+// topologySpreadConstraints returns the topology spread constraints of the
+// server pods. Constraints set on the share override those from the common
+// config, which override the constraints spreading the replicas across
+// zones.
+func (sp *sharePlanner) topologySpreadConstraints() []corev1.TopologySpreadConstraint {
+	common, share := sp.schedulingSettings()
+	if share != nil && len(share.TopologySpreadConstraints) > 0 {
+		return share.TopologySpreadConstraints
+	}
+	if common != nil && len(common.TopologySpreadConstraints) > 0 {
+		return common.TopologySpreadConstraints
+	}
+	return replicaSpreadConstraints(
+		sp.spreadReplicas(), sp.replicas(),
+		labelsForSmbServer(sp.instanceName()))
+}
+
+// withReplicaAntiAffinity returns a copy of affinity with a preferred pod
+// anti-affinity keeping the replicas of the pods matching labels on
+// different nodes. Affinity is returned unchanged for a single replica,
+// if spreading is off or if the affinity already has a pod anti-affinity.
+func withReplicaAntiAffinity(
+	affinity *corev1.Affinity,
+	mode spreadMode,
+	replicas int32,
+	labels map[string]string) *corev1.Affinity {
+	// ---
+	if replicas <= 1 || mode == spreadOff ||
+		(affinity != nil && affinity.PodAntiAffinity != nil) {
+		// ---
+		return affinity
+	}
+	if affinity == nil {
+		affinity = &corev1.Affinity{}
+	} else {
+		affinity = affinity.DeepCopy()
+	}
+	affinity.PodAntiAffinity = &corev1.PodAntiAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+			Weight: 100,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: labels},
+				TopologyKey:   corev1.LabelHostname,
+			},
+		}},
+	}
+	return affinity
+}
+
+// replicaSpreadConstraints returns the constraints spreading the replicas
+// of the pods matching labels across zones, or nil unless there is more
+// than one replica to spread by zone. Zones are a preference, so that
+// clusters with fewer zones than replicas can still run all of them.
+func replicaSpreadConstraints(
+	mode spreadMode,
+	replicas int32,
+	labels map[string]string) []corev1.TopologySpreadConstraint {
+	// ---
+	if replicas <= 1 || mode != spreadZone {
+		return nil
+	}
+	return []corev1.TopologySpreadConstraint{{
+		MaxSkew:           1,
+		TopologyKey:       corev1.LabelZoneFailureDomainStable,
+		WhenUnsatisfiable: corev1.ScheduleAnyway,
+		LabelSelector:     &metav1.LabelSelector{MatchLabels: labels},
+	}}
+}
+
+// supportedArchitectures returns the CPU architectures of the nodes the
+// server pods may run on. Architectures set on the share override those
+// from the common config, which override the operator's default.
+func (sp *sharePlanner) supportedArchitectures() []string {
+	common, share := sp.schedulingSettings()
+	if share != nil && len(share.SupportedArchitectures) > 0 {
+		return share.SupportedArchitectures
+	}
+	if common != nil && len(common.SupportedArchitectures) > 0 {
+		return common.SupportedArchitectures
+	}
+	if sp.GlobalConfig == nil {
+		return nil
+	}
+	return sp.GlobalConfig.Architectures()
+}
+
+// withArchAffinity returns a copy of affinity requiring the nodes to be of
+// one of the architectures. The requirement is added to every required
+// node selector term, as the terms are alternatives, except to terms that
+// already constrain the architecture. If archs is empty, affinity is
+// returned unchanged.
+func withArchAffinity(
+	affinity *corev1.Affinity, archs []string) *corev1.Affinity {
+	// ---
+	if len(archs) == 0 {
+		return affinity
+	}
+	req := corev1.NodeSelectorRequirement{
+		Key:      archLabel,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   append([]string(nil), archs...),
+	}
+	if affinity == nil {
+		affinity = &corev1.Affinity{}
+	} else {
+		affinity = affinity.DeepCopy()
+	}
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	na := affinity.NodeAffinity
+	if na.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		na.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	ns := na.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(ns.NodeSelectorTerms) == 0 {
+		ns.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+	for i := range ns.NodeSelectorTerms {
+		term := &ns.NodeSelectorTerms[i]
+		if constrainsArch(term) {
+			continue
+		}
+		term.MatchExpressions = append(term.MatchExpressions, req)
+	}
+	return affinity
+}
+
+// constrainsArch returns true if the node selector term has a requirement
+// on the architecture of the nodes.
+func constrainsArch(term *corev1.NodeSelectorTerm) bool {
+	for _, e := range term.MatchExpressions {
+		if e.Key == archLabel {
+			return true
+		}
+	}
+	return false
+}
+
+func (sp *sharePlanner) podSecuritySettings() *sambaoperatorv1alpha1.SmbPodSecurityContext {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.PodSettings == nil {
+		return nil
+	}
+	return sp.CommonConfig.Spec.PodSettings.SecurityContext
+}
+
+// podSecurityContext returns the security context for the server pods or
+// nil if no custom security context is needed.
+func (sp *sharePlanner) podSecurityContext() *corev1.PodSecurityContext {
+	seLinux := sp.seLinuxOptions()
+	psc := sp.podSecuritySettings()
+	if psc == nil {
+		psc = &sambaoperatorv1alpha1.SmbPodSecurityContext{}
+	}
+	if psc.RunAsUser == nil && psc.RunAsGroup == nil && psc.FSGroup == nil &&
+		seLinux == nil {
+		return nil
+	}
+	return &corev1.PodSecurityContext{
+		RunAsUser:      psc.RunAsUser,
+		RunAsGroup:     psc.RunAsGroup,
+		FSGroup:        psc.FSGroup,
+		SELinuxOptions: seLinux,
+	}
+}
+
+// seLinuxOptions returns the SELinux context of the server pods or nil if
+// the container runtime's default context is to be used.
+func (sp *sharePlanner) seLinuxOptions() *corev1.SELinuxOptions {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.PodSettings == nil {
+		return nil
+	}
+	o := sp.CommonConfig.Spec.PodSettings.SELinuxOptions
+	if o == nil || (o.User == "" && o.Role == "" && o.Type == "" && o.Level == "") {
+		return nil
+	}
+	return &corev1.SELinuxOptions{
+		User:  o.User,
+		Role:  o.Role,
+		Type:  o.Type,
+		Level: o.Level,
+	}
+}
+
+// seccompProfile returns the value of the seccomp profile annotation for
+// the server pods. By default the runtime's default profile is used, which
+// is compatible with the "baseline" pod security standard.
+func (sp *sharePlanner) seccompProfile() string {
+	psc := sp.podSecuritySettings()
+	if psc == nil || psc.SeccompProfile == nil {
+		return corev1.SeccompProfileRuntimeDefault
+	}
+	switch psc.SeccompProfile.Type {
+	case "Unconfined":
+		return "unconfined"
+	case "Localhost":
+		return "localhost/" + psc.SeccompProfile.LocalhostProfile
+	}
+	return corev1.SeccompProfileRuntimeDefault
+}
+
+func (sp *sharePlanner) imageOverrides() *sambaoperatorv1alpha1.SmbCommonImages {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.Images == nil {
+		return &sambaoperatorv1alpha1.SmbCommonImages{}
+	}
+	return sp.CommonConfig.Spec.Images
+}
+
+func imageName(
+	override *sambaoperatorv1alpha1.SmbContainerImage, dflt string) string {
+	// ---
+	if override == nil || override.Repository == "" {
+		return dflt
+	}
+	if override.Tag == "" {
+		return override.Repository
+	}
+	return override.Repository + ":" + override.Tag
+}
+
+// sambaImage returns the image used for the samba server containers.
+func (sp *sharePlanner) sambaImage() string {
+	return imageName(
+		sp.imageOverrides().Samba,
+		sp.GlobalConfig.SmbdContainerImage)
+}
+
+// dnsRegisterImage returns the image used for the dns-register container.
+func (sp *sharePlanner) dnsRegisterImage() string {
+	dflt := sp.GlobalConfig.DNSRegisterContainerImage
+	if dflt == "" {
+		dflt = sp.GlobalConfig.SmbdContainerImage
+	}
+	return imageName(sp.imageOverrides().DNSRegister, dflt)
+}
+
+// svcWatchImage returns the image used for the svc-watch container.
+func (sp *sharePlanner) svcWatchImage() string {
+	return imageName(
+		sp.imageOverrides().SvcWatch,
+		sp.GlobalConfig.SvcWatchContainerImage)
+}
+
+// metricsImage returns the image used for the metrics exporter container.
+func (sp *sharePlanner) metricsImage() string {
+	return imageName(
+		sp.imageOverrides().Metrics,
+		sp.GlobalConfig.MetricsContainerImage)
+}
+
+type workloadType string
+
+const (
+	deploymentWorkload  = workloadType("deployment")
+	statefulSetWorkload = workloadType("statefulset")
+)
+
+// workloadType returns the kind of workload running the server pods.
+func (sp *sharePlanner) workloadType() workloadType {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.WorkloadType == "" {
+		return deploymentWorkload
+	}
+	return workloadType(sp.CommonConfig.Spec.WorkloadType)
+}
+
+// headlessServiceName returns the name of the headless service giving the
+// pods of a server StatefulSet their DNS names.
+func (sp *sharePlanner) headlessServiceName() string {
+	return headlessServiceNameOf(sp.instanceName())
+}
+
+func headlessServiceNameOf(serverGroup string) string {
+	return serverGroup + "-headless"
+}
+
+// deploymentStrategy returns the update strategy of the server deployment.
+// An empty strategy is returned if none is configured, leaving the choice
+// to Kubernetes.
+func (sp *sharePlanner) deploymentStrategy() appsv1.DeploymentStrategy {
+	strategy := appsv1.DeploymentStrategy{}
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.UpdateStrategy == nil {
+		return strategy
+	}
+	us := sp.CommonConfig.Spec.UpdateStrategy
+	strategy.Type = appsv1.DeploymentStrategyType(us.Type)
+	if strategy.Type == "" {
+		strategy.Type = appsv1.RollingUpdateDeploymentStrategyType
+	}
+	if strategy.Type == appsv1.RollingUpdateDeploymentStrategyType &&
+		(us.MaxUnavailable != nil || us.MaxSurge != nil) {
+		// ---
+		strategy.RollingUpdate = &appsv1.RollingUpdateDeployment{
+			MaxUnavailable: us.MaxUnavailable,
+			MaxSurge:       us.MaxSurge,
+		}
+	}
+	return strategy
+}
+
+func (sp *sharePlanner) imagePullSecrets() []corev1.LocalObjectReference {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.PodSettings == nil {
+		return nil
+	}
+	return sp.CommonConfig.Spec.PodSettings.ImagePullSecrets
+}
+
+func (sp *sharePlanner) priorityClassName() string {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.PodSettings == nil {
+		return ""
+	}
+	return sp.CommonConfig.Spec.PodSettings.PriorityClassName
+}
+
+// extraMounts returns the ConfigMaps and Secrets mounted into the samba
+// server containers of the pods.
+func (sp *sharePlanner) extraMounts() []sambaoperatorv1alpha1.SmbExtraMount {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.PodSettings == nil {
+		return nil
+	}
+	return sp.CommonConfig.Spec.PodSettings.ExtraMounts
+}
+
+// includePath returns the path of the file the extra mounts include into
+// the smb.conf of the server group, or an empty string if none is included.
+func (sp *sharePlanner) includePath() string {
+	for _, em := range sp.extraMounts() {
+		if em.Include != "" {
+			return path.Join(em.MountPath, em.Include)
+		}
+	}
+	return ""
+}
+
+// includeKey returns the key of the globals section including a file of
+// the extra mounts, or an empty key if no file is included.
+func (sp *sharePlanner) includeKey() smbcc.Key {
+	p := sp.includePath()
+	if p == "" {
+		return ""
+	}
+	return smbcc.Key("include_" + p)
+}
+
+const (
+	// customConfigDir is the directory the ConfigMap holding a custom
+	// smb.conf is mounted on.
+	customConfigDir = "/etc/samba/custom"
+	// defaultCustomConfigFile is the key of the ConfigMap holding a custom
+	// smb.conf, unless another is given.
+	defaultCustomConfigFile = "smb.conf"
+
+	// configManaged is the config mode of shares served with the
+	// configuration generated by the operator.
+	configManaged = "Managed"
+	// configUnmanaged is the config mode of shares served with a custom
+	// smb.conf.
+	configUnmanaged = "Unmanaged"
+)
+
+// customConfig returns the custom smb.conf settings of the server group,
+// or nil if the operator generates the configuration.
+func (sp *sharePlanner) customConfig() *sambaoperatorv1alpha1.SmbCustomConfig {
+	if sp.CommonConfig == nil {
+		return nil
+	}
+	return sp.CommonConfig.Spec.CustomConfig
+}
+
+// customConfigFile returns the key of the ConfigMap holding the custom
+// smb.conf, which is also the name of the file it is mounted as.
+func (sp *sharePlanner) customConfigFile() string {
+	if c := sp.customConfig(); c != nil && c.Key != "" {
+		return c.Key
+	}
+	return defaultCustomConfigFile
+}
+
+// customConfigPath returns the path of the custom smb.conf within the
+// samba server containers.
+func (sp *sharePlanner) customConfigPath() string {
+	return path.Join(customConfigDir, sp.customConfigFile())
+}
+
+// customConfigKey returns the key of the globals section including the
+// custom smb.conf.
+func (sp *sharePlanner) customConfigKey() smbcc.Key {
+	return smbcc.Key("custom_" + sp.customConfigPath())
+}
+
+// configMode returns the config mode of the server group.
+func (sp *sharePlanner) configMode() string {
+	if sp.customConfig() != nil {
+		return configUnmanaged
+	}
+	return configManaged
+}
+
+// sharePathEnvPrefix prefixes the names of the environment variables
+// holding the paths of the shares' directories.
+const sharePathEnvPrefix = "SAMBA_SHARE_PATH_"
+
+// sharePathEnvName returns the name of the environment variable holding
+// the path of the given SmbShare's directory in the samba server
+// containers, for use by a custom smb.conf.
+func sharePathEnvName(s *sambaoperatorv1alpha1.SmbShare) string {
+	name := strings.ToUpper(s.Name)
+	name = strings.NewReplacer("-", "_", ".", "_").Replace(name)
+	return sharePathEnvPrefix + name
+}
+
+// defaultTerminationGracePeriod is the number of seconds clients are given
+// to finish their work before a server pod is stopped.
+const defaultTerminationGracePeriod = int64(60)
+
+// terminationGracePeriod returns the termination grace period, in seconds,
+// of the pods that host the share.
+func (sp *sharePlanner) terminationGracePeriod() int64 {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.PodSettings == nil ||
+		sp.CommonConfig.Spec.PodSettings.TerminationGracePeriodSeconds == nil {
+		// ---
+		return defaultTerminationGracePeriod
+	}
+	return *sp.CommonConfig.Spec.PodSettings.TerminationGracePeriodSeconds
+}
+
+// probesSettings returns the settings of the smbd probes of the pods. The
+// settings of each probe may be nil.
+func (sp *sharePlanner) probesSettings() sambaoperatorv1alpha1.SmbProbesSettings {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.PodSettings == nil ||
+		sp.CommonConfig.Spec.PodSettings.Probes == nil {
+		// ---
+		return sambaoperatorv1alpha1.SmbProbesSettings{}
+	}
+	return *sp.CommonConfig.Spec.PodSettings.Probes
+}
+
+// domainCheckCommand returns the command checking the domain membership
+// of the servers in their readiness probe, or an empty string if the
+// membership is not checked.
+func (sp *sharePlanner) domainCheckCommand() string {
+	if sp.securityMode() != adMode {
+		return ""
+	}
+	switch sp.probesSettings().DomainCheck {
+	case "ping-dc":
+		return "wbinfo --ping-dc"
+	case "none":
+		return ""
+	}
+	return "wbinfo -t"
+}
+
+// drainCommand returns the command run before the samba server is stopped.
+// It waits, at most for the termination grace period, until no files are
+// held open by clients. It gives up early if the state of the server can
+// not be determined.
+func (*sharePlanner) drainCommand() []string {
+	return []string{
+		"/bin/sh",
+		"-c",
+		`while out="$(smbstatus --locks 2>/dev/null)" && ` +
+			`! echo "$out" | grep -q "No locked files"; do sleep 1; done`,
+	}
+}
+
+// sambaContainerDebugLevel returns the debug level of the samba containers.
+// A level set in the common config overrides the operator's level.
+func (sp *sharePlanner) sambaContainerDebugLevel() string {
+	if d := sp.debug(); d != nil && d.LogLevel != "" {
+		return d.LogLevel
+	}
+	return sp.GlobalConfig.SambaDebugLevel
+}
+
+func (sp *sharePlanner) debug() *sambaoperatorv1alpha1.SmbDebugSpec {
+	if sp.CommonConfig == nil {
+		return nil
+	}
+	return sp.CommonConfig.Spec.Debug
+}
+
+type logDestination string
+
+const (
+	logToStdout = logDestination("stdout")
+	logToFile   = logDestination("file")
+)
+
+// logFilePath is the log file of a samba server logging to files, named
+// after the client machine.
+const logFilePath = "/var/log/samba/log.%m"
+
+// loggingOptions returns the global options selecting where the samba
+// servers write their logs. Nothing is returned unless a destination or
+// size is configured, in which case the containers log to stdout.
+func (sp *sharePlanner) loggingOptions() smbcc.SmbOptions {
+	opts := smbcc.SmbOptions{}
+	d := sp.debug()
+	if d == nil || (d.LogTo == "" && d.MaxLogSize == nil) {
+		return opts
+	}
+	if logDestination(d.LogTo) == logToFile {
+		opts[smbcc.LogFileParam] = logFilePath
+		if d.MaxLogSize != nil {
+			opts[smbcc.MaxLogSizeParam] = strconv.Itoa(int(*d.MaxLogSize))
+		}
+		return opts
+	}
+	// samba can not rotate its output, rotating the logs of the
+	// containers is left to Kubernetes.
+	opts[smbcc.LogFileParam] = "/dev/stdout"
+	opts[smbcc.MaxLogSizeParam] = "0"
+	return opts
+}
+
+// loggingKey returns the key of the globals section selecting where the
+// samba servers log, or an empty key if the default is used. The key is
+// derived from the options.
+func (sp *sharePlanner) loggingKey() smbcc.Key {
+	opts := sp.loggingOptions()
+	if len(opts) == 0 {
+		return ""
+	}
+	// maps of strings always marshal, with sorted keys
+	data, _ := json.Marshal(opts)
+	return smbcc.Key(fmt.Sprintf("logging_%x", sha256.Sum256(data))[:16])
+}
+
+const (
+	// coresDir is where samba writes the core dumps of its processes, in
+	// a subdirectory named after the program.
+	coresDir = "/var/log/samba/cores"
+	// panicLogFile logs the panics of the samba processes.
+	panicLogFile = coresDir + "/panic.log"
+	// coresKey is the globals section collecting crash data.
+	coresKey = smbcc.Key("debug_cores")
+)
+
+// defaultCoresSizeLimit is the size of the volume holding the core dumps,
+// unless one is configured.
+var defaultCoresSizeLimit = resource.MustParse("1Gi")
+
+// collectCores returns true if the core dumps and panics of the samba
+// servers are kept on a volume of the pods.
+func (sp *sharePlanner) collectCores() bool {
+	d := sp.debug()
+	return d != nil && d.CollectCores
+}
+
+func (sp *sharePlanner) coresSizeLimit() resource.Quantity {
+	if d := sp.debug(); d != nil && d.CoresSizeLimit != nil {
+		return *d.CoresSizeLimit
+	}
+	return defaultCoresSizeLimit
+}
+
+// panicAction returns the command samba runs when one of its processes
+// panics. Samba substitutes %d with the id of the process, before dumping
+// its core.
+func (*sharePlanner) panicAction() string {
+	return fmt.Sprintf(
+		`/bin/sh -c 'echo "$(date -u) process %%d panicked" >> %s'`,
+		panicLogFile)
 }
@@ -19,8 +19,11 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
 	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
 )
 
@@ -155,3 +158,1609 @@ func TestPlannerDNSRegisterArgs(t *testing.T) {
 		},
 		v)
 }
+
+func TestPlannerDNSAliases(t *testing.T) {
+	ttl := int32(30)
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.DNSAliases = []string{"files", "Not_Valid"}
+	other := sambaoperatorv1alpha1.SmbShare{}
+	other.Spec.DNSAliases = []string{"archive", "files"}
+	planner := newSharePlanner(
+		InstanceConfiguration{
+			SmbShare:    share,
+			GroupShares: []sambaoperatorv1alpha1.SmbShare{*share, other},
+			SecurityConfig: &sambaoperatorv1alpha1.SmbSecurityConfig{
+				Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+					Mode:  "active-directory",
+					Realm: "DOMAIN1.Example.COM",
+					DNS: &sambaoperatorv1alpha1.SmbSecurityDNSSpec{
+						Register: "external-ip",
+						TTL:      &ttl,
+					},
+				},
+			},
+		},
+		&smbcc.SambaContainerConfig{})
+	assert.Equal(t,
+		[]string{"archive.domain1.example.com", "files.domain1.example.com"},
+		planner.dnsAliases())
+	assert.Equal(t,
+		[]string{
+			"dns-register",
+			"--watch",
+			"--ttl=30",
+			"--alias=archive.domain1.example.com",
+			"--alias=files.domain1.example.com",
+			"/var/lib/svcwatch/status.json",
+		},
+		planner.dnsRegisterArgs())
+	assert.Equal(t,
+		[]string{
+			"samba-container",
+			"dns-register",
+			"--unregister",
+			"--ttl=30",
+			"--alias=archive.domain1.example.com",
+			"--alias=files.domain1.example.com",
+			"/var/lib/svcwatch/status.json",
+		},
+		planner.dnsUnregisterCommand())
+
+	// the reverse record is registered and removed with the others
+	planner.SecurityConfig.Spec.DNS.RegisterPTR = true
+	assert.Equal(t,
+		[]string{
+			"dns-register",
+			"--watch",
+			"--ttl=30",
+			"--reverse",
+			"--alias=archive.domain1.example.com",
+			"--alias=files.domain1.example.com",
+			"/var/lib/svcwatch/status.json",
+		},
+		planner.dnsRegisterArgs())
+	assert.Contains(t, planner.dnsUnregisterCommand(), "--reverse")
+	planner.SecurityConfig.Spec.DNS.RegisterPTR = false
+
+	// updates may be sent unsigned, to a given server
+	planner.SecurityConfig.Spec.DNS.UpdateMethod = "unauthenticated"
+	planner.SecurityConfig.Spec.DNS.Server = "ns1.example.com"
+	assert.Equal(t,
+		[]string{
+			"dns-register",
+			"--watch",
+			"--ttl=30",
+			"--update-method=unauthenticated",
+			"--server=ns1.example.com",
+			"--alias=archive.domain1.example.com",
+			"--alias=files.domain1.example.com",
+			"/var/lib/svcwatch/status.json",
+		},
+		planner.dnsRegisterArgs())
+	assert.Contains(t,
+		planner.dnsUnregisterCommand(), "--server=ns1.example.com")
+
+	// or signed with a shared key
+	planner.SecurityConfig.Spec.DNS.UpdateMethod = "tsig"
+	planner.SecurityConfig.Spec.DNS.TSIGKey =
+		&sambaoperatorv1alpha1.SmbSecurityDNSKeySpec{Secret: "mykey"}
+	assert.Contains(t,
+		planner.dnsRegisterArgs(), "--tsig-key=/etc/samba-dns-key/tsig.key")
+}
+
+func TestPlannerPodSecurity(t *testing.T) {
+	// no common config: runtime defaults
+	planner := newSharePlanner(
+		InstanceConfiguration{},
+		&smbcc.SambaContainerConfig{})
+	assert.Nil(t, planner.podSecurityContext())
+	assert.Equal(t, "runtime/default", planner.seccompProfile())
+
+	var uid, gid, fsgid int64 = 1000, 1000, 2000
+	planner = newSharePlanner(
+		InstanceConfiguration{
+			CommonConfig: &sambaoperatorv1alpha1.SmbCommonConfig{
+				Spec: sambaoperatorv1alpha1.SmbCommonConfigSpec{
+					PodSettings: &sambaoperatorv1alpha1.SmbCommonPodSettings{
+						SecurityContext: &sambaoperatorv1alpha1.SmbPodSecurityContext{
+							RunAsUser:  &uid,
+							RunAsGroup: &gid,
+							FSGroup:    &fsgid,
+							SeccompProfile: &sambaoperatorv1alpha1.SmbSeccompProfile{
+								Type:             "Localhost",
+								LocalhostProfile: "samba.json",
+							},
+						},
+					},
+				},
+			},
+		},
+		&smbcc.SambaContainerConfig{})
+	psc := planner.podSecurityContext()
+	if assert.NotNil(t, psc) {
+		assert.Equal(t, uid, *psc.RunAsUser)
+		assert.Equal(t, gid, *psc.RunAsGroup)
+		assert.Equal(t, fsgid, *psc.FSGroup)
+	}
+	assert.Equal(t, "localhost/samba.json", planner.seccompProfile())
+}
+
+func TestPlannerImages(t *testing.T) {
+	cfg := &conf.OperatorConfig{
+		SmbdContainerImage:     "quay.io/samba.org/samba-server:latest",
+		SvcWatchContainerImage: "quay.io/samba.org/svcwatch:latest",
+	}
+	planner := newSharePlanner(
+		InstanceConfiguration{GlobalConfig: cfg},
+		&smbcc.SambaContainerConfig{})
+	assert.Equal(t, cfg.SmbdContainerImage, planner.sambaImage())
+	assert.Equal(t, cfg.SmbdContainerImage, planner.dnsRegisterImage())
+	assert.Equal(t, cfg.SvcWatchContainerImage, planner.svcWatchImage())
+
+	cfg.DNSRegisterContainerImage = "quay.io/samba.org/samba-dns:latest"
+	assert.Equal(t, cfg.DNSRegisterContainerImage, planner.dnsRegisterImage())
+
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{
+		Spec: sambaoperatorv1alpha1.SmbCommonConfigSpec{
+			Images: &sambaoperatorv1alpha1.SmbCommonImages{
+				DNSRegister: &sambaoperatorv1alpha1.SmbContainerImage{
+					Repository: "registry.example.com/samba-server",
+					Tag:        "v1",
+				},
+				SvcWatch: &sambaoperatorv1alpha1.SmbContainerImage{
+					Repository: "registry.example.com/svcwatch",
+				},
+			},
+		},
+	}
+	assert.Equal(t, cfg.SmbdContainerImage, planner.sambaImage())
+	assert.Equal(t,
+		"registry.example.com/samba-server:v1", planner.dnsRegisterImage())
+	assert.Equal(t, "registry.example.com/svcwatch", planner.svcWatchImage())
+}
+
+func TestPlannerShareOptions(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{
+		Spec: sambaoperatorv1alpha1.SmbShareSpec{
+			ShareName:  "stuff",
+			Browseable: true,
+		},
+	}
+	share.UID = "abc123"
+	state := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{
+			SmbShare:     share,
+			GlobalConfig: &conf.OperatorConfig{},
+		},
+		state)
+
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	opts := state.Shares["stuff"].Options
+	assert.Equal(t, "/mnt/abc123", opts["path"])
+	_, found := opts[smbcc.CommentParam]
+	assert.False(t, found)
+
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// changes to an existing share are applied
+	share.Spec.Comment = "Offene Dateien für alle"
+	share.Spec.ReadOnly = true
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	opts = state.Shares["stuff"].Options
+	assert.Equal(t, "Offene Dateien für alle", opts[smbcc.CommentParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.ReadOnlyParam])
+	_, found = opts[smbcc.BrowseableParam]
+	assert.False(t, found)
+
+	// hide the share from browsing
+	share.Spec.Browseable = false
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	opts = state.Shares["stuff"].Options
+	assert.Equal(t, smbcc.No, opts[smbcc.BrowseableParam])
+}
+
+func TestPlannerAccessControl(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{
+		Spec: sambaoperatorv1alpha1.SmbShareSpec{
+			Browseable: true,
+			AccessControl: &sambaoperatorv1alpha1.SmbShareAccessControl{
+				ValidUsers:   []string{"alice", "bob", `DOMAIN1\Domain Users`},
+				InvalidUsers: []string{"carol"},
+				WriteList:    []string{"alice"},
+			},
+		},
+	}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		smbcc.New())
+	opts := planner.shareOptions()
+	assert.Equal(t,
+		`alice, bob, "DOMAIN1\Domain Users"`,
+		opts[smbcc.ValidUsersParam])
+	assert.Equal(t, "carol", opts[smbcc.InvalidUsersParam])
+	assert.Equal(t, "alice", opts[smbcc.WriteListParam])
+	_, found := opts[smbcc.ReadListParam]
+	assert.False(t, found)
+
+	assert.Len(t, accessControlConflicts(share.Spec.AccessControl), 0)
+	share.Spec.AccessControl.ReadList = []string{"bob", "ALICE"}
+	assert.Equal(t,
+		[]string{"alice"},
+		accessControlConflicts(share.Spec.AccessControl))
+}
+
+func TestPlannerJoinArgs(t *testing.T) {
+	planner := newSharePlanner(
+		InstanceConfiguration{
+			SecurityConfig: &sambaoperatorv1alpha1.SmbSecurityConfig{
+				Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+					Mode: "active-directory",
+				},
+			},
+		},
+		&smbcc.SambaContainerConfig{})
+	assert.Equal(t, []string{"must-join"}, planner.joinArgs())
+
+	planner.SecurityConfig.Spec.MachineAccountOU = "OU=Servers,ou=Samba,DC=example,DC=com"
+	assert.Equal(t, "Samba/Servers", planner.machineAccountOUPath())
+	assert.Equal(t,
+		[]string{"must-join", "--createcomputer=Samba/Servers"},
+		planner.joinArgs())
+}
+
+func TestPlannerJoinRetry(t *testing.T) {
+	planner := newSharePlanner(
+		InstanceConfiguration{
+			SecurityConfig: &sambaoperatorv1alpha1.SmbSecurityConfig{
+				Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+					Mode: "active-directory",
+				},
+			},
+		},
+		&smbcc.SambaContainerConfig{})
+	assert.Equal(t,
+		[]corev1.EnvVar{
+			{Name: "JOIN_MAX_ATTEMPTS", Value: "5"},
+			{Name: "JOIN_INITIAL_DELAY", Value: "5"},
+			{Name: "JOIN_MAX_DELAY", Value: "120"},
+		},
+		planner.joinRetryEnv())
+
+	planner.SecurityConfig.Spec.JoinRetry = &sambaoperatorv1alpha1.SmbSecurityJoinRetrySpec{
+		MaxAttempts:         10,
+		InitialDelaySeconds: 2,
+	}
+	assert.Equal(t,
+		[]corev1.EnvVar{
+			{Name: "JOIN_MAX_ATTEMPTS", Value: "10"},
+			{Name: "JOIN_INITIAL_DELAY", Value: "2"},
+			{Name: "JOIN_MAX_DELAY", Value: "120"},
+		},
+		planner.joinRetryEnv())
+	cmd := planner.joinCommand()
+	assert.Equal(t, []string{"/bin/sh", "-c"}, cmd[:2])
+}
+
+func TestPlannerKeytab(t *testing.T) {
+	planner := newSharePlanner(
+		InstanceConfiguration{
+			SecurityConfig: &sambaoperatorv1alpha1.SmbSecurityConfig{
+				Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+					Mode:  "active-directory",
+					Realm: "EXAMPLE.COM",
+				},
+			},
+		},
+		&smbcc.SambaContainerConfig{})
+	opts := planner.realmOptions()
+	_, found := opts[smbcc.KerberosMethodParam]
+	assert.False(t, found)
+
+	planner.SecurityConfig.Spec.Kerberos = &sambaoperatorv1alpha1.SmbSecurityKerberosSpec{
+		KeytabSecret: "mykeytab",
+	}
+	opts = planner.realmOptions()
+	assert.Equal(t, "dedicated keytab", opts[smbcc.KerberosMethodParam])
+	assert.Equal(t,
+		"FILE:/etc/samba-keytab/krb5.keytab",
+		opts[smbcc.DedicatedKeytabFileParam])
+}
+
+func TestPlannerFileModes(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{
+		Spec: sambaoperatorv1alpha1.SmbShareSpec{
+			Browseable:      true,
+			CreateMask:      "0664",
+			DirectoryMask:   "0775",
+			ForceCreateMode: "0660",
+		},
+	}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+	opts := planner.shareOptions()
+	assert.Equal(t, "0664", opts[smbcc.CreateMaskParam])
+	assert.Equal(t, "0775", opts[smbcc.DirectoryMaskParam])
+	assert.Equal(t, "0660", opts[smbcc.ForceCreateModeParam])
+	_, found := opts[smbcc.ForceDirectoryModeParam]
+	assert.False(t, found)
+	assert.Len(t, invalidFileModes(share), 0)
+
+	share.Spec.DirectoryMask = "0789"
+	share.Spec.ForceDirectoryMode = "17777"
+	assert.Equal(t,
+		[]string{`directory mask="0789"`, `force directory mode="17777"`},
+		invalidFileModes(share))
+}
+
+func TestPlannerInheritOwner(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{
+		Spec: sambaoperatorv1alpha1.SmbShareSpec{
+			Browseable: true,
+		},
+	}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+	opts := planner.shareOptions()
+	_, found := opts[smbcc.InheritOwnerParam]
+	assert.False(t, found)
+	_, found = opts[smbcc.InheritPermissionsParam]
+	assert.False(t, found)
+
+	share.Spec.InheritOwner = true
+	share.Spec.InheritPermissions = true
+	opts = planner.shareOptions()
+	assert.Equal(t, "windows and unix", opts[smbcc.InheritOwnerParam])
+	assert.Equal(t, "yes", opts[smbcc.InheritPermissionsParam])
+}
+
+func TestPlannerACLs(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{
+		Spec: sambaoperatorv1alpha1.SmbShareSpec{
+			Browseable: true,
+			ACLs: &sambaoperatorv1alpha1.SmbShareACLSpec{
+				Mode:    "posix",
+				Inherit: true,
+			},
+		},
+	}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+	opts := planner.shareOptions()
+	assert.Equal(t, smbcc.Yes, opts[smbcc.InheritACLsParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.MapACLInheritParam])
+	_, found := opts[smbcc.VfsObjectsParam]
+	assert.False(t, found)
+
+	share.Spec.ACLs = &sambaoperatorv1alpha1.SmbShareACLSpec{Mode: "windows"}
+	opts = planner.shareOptions()
+	assert.Equal(t, "acl_xattr", opts[smbcc.VfsObjectsParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.ACLXattrIgnoreSystemACLsParam])
+	_, found = opts[smbcc.InheritACLsParam]
+	assert.False(t, found)
+	_, found = opts[smbcc.DosFilemodeParam]
+	assert.False(t, found)
+
+	// permissions edited from the Security tab of Windows clients
+	share.Spec.ACLs.WindowsEditing = true
+	opts = planner.shareOptions()
+	assert.Equal(t, "acl_xattr", opts[smbcc.VfsObjectsParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.DosFilemodeParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.ACLGroupControlParam])
+}
+
+func TestPlannerDosAttributes(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+	opts := planner.shareOptions()
+	_, found := opts[smbcc.StoreDosAttributesParam]
+	assert.False(t, found)
+	assert.False(t, planner.storeDosAttributes())
+
+	store := true
+	share.Spec.StoreDosAttributes = &store
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.Yes, opts[smbcc.StoreDosAttributesParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.EaSupportParam])
+	assert.True(t, planner.storeDosAttributes())
+	// stored attributes are not mapped to file permissions
+	for _, param := range []string{
+		smbcc.MapArchiveParam,
+		smbcc.MapHiddenParam,
+		smbcc.MapSystemParam,
+		smbcc.MapReadonlyParam,
+	} {
+		assert.Equal(t, smbcc.No, opts[param], param)
+	}
+
+	store = false
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.No, opts[smbcc.StoreDosAttributesParam])
+	_, found = opts[smbcc.EaSupportParam]
+	assert.False(t, found)
+	_, found = opts[smbcc.MapArchiveParam]
+	assert.False(t, found)
+
+	archive := true
+	hidden := false
+	share.Spec.DosAttributeMapping = &sambaoperatorv1alpha1.SmbShareDosAttributeMappingSpec{
+		Archive:  &archive,
+		Hidden:   &hidden,
+		ReadOnly: "permissions",
+	}
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.Yes, opts[smbcc.MapArchiveParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.MapHiddenParam])
+	assert.Equal(t, "permissions", opts[smbcc.MapReadonlyParam])
+	_, found = opts[smbcc.MapSystemParam]
+	assert.False(t, found)
+}
+
+func TestPlannerHosts(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+	opts := planner.shareOptions()
+	_, found := opts[smbcc.HostsAllowParam]
+	assert.False(t, found)
+	_, found = opts[smbcc.HostsDenyParam]
+	assert.False(t, found)
+
+	share.Spec.HostsAllow = []string{"10.0.0.0/8", "client1.example.com"}
+	share.Spec.HostsDeny = []string{"10.1.0.0/16"}
+	opts = planner.shareOptions()
+	assert.Equal(t, "10.0.0.0/8 client1.example.com", opts[smbcc.HostsAllowParam])
+	assert.Equal(t, "10.1.0.0/16", opts[smbcc.HostsDenyParam])
+}
+
+func TestPlannerEncryption(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+	_, found := planner.shareOptions()[smbcc.SMBEncryptParam]
+	assert.False(t, found)
+
+	share.Spec.Encryption = "desired"
+	assert.Equal(t, "desired", planner.shareOptions()[smbcc.SMBEncryptParam])
+}
+
+func TestPlannerMacOS(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+	opts := planner.shareOptions()
+	_, found := opts[smbcc.SpotlightParam]
+	assert.False(t, found)
+	_, found = opts[smbcc.VfsObjectsParam]
+	assert.False(t, found)
+
+	share.Spec.MacOS = &sambaoperatorv1alpha1.SmbShareMacOSSpec{Fruit: true}
+	opts = planner.shareOptions()
+	assert.Equal(t, "fruit streams_xattr", opts[smbcc.VfsObjectsParam])
+	_, found = opts[smbcc.SpotlightParam]
+	assert.False(t, found)
+	// fruit is loaded after the module storing the ACLs
+	share.Spec.ACLs = &sambaoperatorv1alpha1.SmbShareACLSpec{Mode: "windows"}
+	opts = planner.shareOptions()
+	assert.Equal(t, "acl_xattr fruit streams_xattr", opts[smbcc.VfsObjectsParam])
+
+	share.Spec.MacOS.Spotlight = true
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.Yes, opts[smbcc.SpotlightParam])
+	_, found = opts[smbcc.SpotlightBackendParam]
+	assert.False(t, found)
+
+	port := int32(9201)
+	share.Spec.MacOS.Elasticsearch = &sambaoperatorv1alpha1.SmbSpotlightElasticsearch{
+		Address: "es.example.com",
+		Port:    &port,
+		Index:   "files",
+	}
+	opts = planner.shareOptions()
+	assert.Equal(t, "elasticsearch", opts[smbcc.SpotlightBackendParam])
+	assert.Equal(t, "es.example.com", opts[smbcc.ElasticsearchAddressParam])
+	assert.Equal(t, "9201", opts[smbcc.ElasticsearchPortParam])
+	assert.Equal(t, "files", opts[smbcc.ElasticsearchIndexParam])
+}
+
+func TestPlannerHomeDirectories(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{
+		Spec: sambaoperatorv1alpha1.SmbShareSpec{
+			ShareName:  "ignored",
+			Browseable: true,
+			HomeDirectories: &sambaoperatorv1alpha1.SmbShareHomeDirectoriesSpec{
+				BaseDir: "users",
+			},
+			AccessControl: &sambaoperatorv1alpha1.SmbShareAccessControl{
+				ValidUsers: []string{"@admins"},
+			},
+		},
+	}
+	share.UID = "abc123"
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+	assert.Equal(t, "homes", planner.shareName())
+	assert.Equal(t, "/mnt/abc123/users", planner.homesBaseDir())
+	opts := planner.shareOptions()
+	assert.Equal(t, "/mnt/abc123/users/%S", opts["path"])
+	assert.Equal(t, "%S, @admins", opts[smbcc.ValidUsersParam])
+	_, found := opts[smbcc.RootPreexecParam]
+	assert.False(t, found)
+
+	share.Spec.HomeDirectories.BaseDir = ""
+	share.Spec.HomeDirectories.CreateUserDirs = true
+	opts = planner.shareOptions()
+	assert.Equal(t, "/mnt/abc123/homes/%S", opts["path"])
+	assert.Equal(t,
+		`/bin/sh -c 'mkdir -p -m 0700 "/mnt/abc123/homes/%S" && chown "%S" "/mnt/abc123/homes/%S"'`,
+		opts[smbcc.RootPreexecParam])
+}
+
+func TestPlannerServerGroup(t *testing.T) {
+	one := sambaoperatorv1alpha1.SmbShare{}
+	one.Name = "one"
+	one.UID = "uid1"
+	one.Status.ServerGroup = "grp"
+	two := sambaoperatorv1alpha1.SmbShare{}
+	two.Name = "two"
+	two.UID = "uid2"
+	two.Spec.ShareName = "Second"
+	two.Status.ServerGroup = "grp"
+	cc := smbcc.New()
+
+	planner := newSharePlanner(
+		InstanceConfiguration{
+			SmbShare:    &one,
+			GroupShares: []sambaoperatorv1alpha1.SmbShare{one},
+		},
+		cc)
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []smbcc.Key{"one"}, cc.Configs["grp"].Shares)
+
+	planner = newSharePlanner(
+		InstanceConfiguration{
+			SmbShare:    &two,
+			GroupShares: []sambaoperatorv1alpha1.SmbShare{one, two},
+		},
+		cc)
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []smbcc.Key{"Second", "one"}, cc.Configs["grp"].Shares)
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// one leaves the group, the group's config stays
+	planner = newSharePlanner(
+		InstanceConfiguration{
+			SmbShare:    &one,
+			GroupShares: []sambaoperatorv1alpha1.SmbShare{two},
+		},
+		cc)
+	changed, err = planner.prune()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []smbcc.Key{"Second"}, cc.Configs["grp"].Shares)
+	assert.NotContains(t, cc.Shares, smbcc.Key("one"))
+
+	// two is the last share of the group
+	planner = newSharePlanner(
+		InstanceConfiguration{SmbShare: &two},
+		cc)
+	changed, err = planner.prune()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.NotContains(t, cc.Configs, smbcc.Key("grp"))
+	assert.NotContains(t, cc.Shares, smbcc.Key("Second"))
+}
+
+func TestPlannerSuspendedServerGroup(t *testing.T) {
+	one := sambaoperatorv1alpha1.SmbShare{}
+	one.Name = "one"
+	one.Status.ServerGroup = "grp"
+	two := sambaoperatorv1alpha1.SmbShare{}
+	two.Name = "two"
+	two.Status.ServerGroup = "grp"
+	two.Spec.Suspended = true
+	cc := smbcc.New()
+	_, err := newSharePlanner(
+		InstanceConfiguration{
+			SmbShare:    &one,
+			GroupShares: []sambaoperatorv1alpha1.SmbShare{one, two},
+		},
+		cc).update()
+	assert.NoError(t, err)
+
+	// the servers keep serving the shares that are not suspended
+	planner := newSharePlanner(
+		InstanceConfiguration{
+			SmbShare:    &two,
+			GroupShares: []sambaoperatorv1alpha1.SmbShare{one, two},
+		},
+		cc)
+	assert.True(t, planner.suspended())
+	assert.False(t, planner.groupSuspended())
+	assert.Equal(t, int32(1), planner.replicas())
+	_, err = planner.update()
+	assert.NoError(t, err)
+	assert.Equal(t, []smbcc.Key{"one"}, cc.Configs["grp"].Shares)
+	assert.Contains(t, cc.Shares, smbcc.Key("two"))
+
+	// the servers are scaled to zero with the last of the shares
+	one.Spec.Suspended = true
+	planner.GroupShares = []sambaoperatorv1alpha1.SmbShare{one, two}
+	assert.True(t, planner.groupSuspended())
+	assert.Equal(t, int32(0), planner.replicas())
+	_, err = planner.update()
+	assert.NoError(t, err)
+	assert.Equal(t, []smbcc.Key{}, cc.Configs["grp"].Shares)
+
+	// resuming a share serves it again
+	two.Spec.Suspended = false
+	planner.GroupShares = []sambaoperatorv1alpha1.SmbShare{one, two}
+	assert.Equal(t, int32(1), planner.replicas())
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []smbcc.Key{"two"}, cc.Configs["grp"].Shares)
+}
+
+func TestPlannerQuota(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{
+		Spec: sambaoperatorv1alpha1.SmbShareSpec{
+			Browseable: true,
+			AccessControl: &sambaoperatorv1alpha1.SmbShareAccessControl{
+				WriteList: []string{"alice"},
+			},
+		},
+	}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		smbcc.New())
+
+	// no quota
+	opts := planner.shareOptions()
+	_, found := opts[smbcc.MaxDiskSizeParam]
+	assert.False(t, found)
+
+	// sizes are rounded up to whole megabytes
+	share.Spec.Quota = &sambaoperatorv1alpha1.SmbShareQuotaSpec{
+		Size: resource.MustParse("1500k"),
+	}
+	opts = planner.shareOptions()
+	assert.Equal(t, "2", opts[smbcc.MaxDiskSizeParam])
+	share.Spec.Quota.Size = resource.MustParse("10Gi")
+	opts = planner.shareOptions()
+	assert.Equal(t, "10240", opts[smbcc.MaxDiskSizeParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.ReadOnlyParam])
+	assert.Equal(t, "alice", opts[smbcc.WriteListParam])
+
+	// an exceeded quota makes the share read-only
+	share.Status.Quota = &sambaoperatorv1alpha1.SmbShareQuotaStatus{
+		Exceeded: true,
+	}
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.Yes, opts[smbcc.ReadOnlyParam])
+	_, found = opts[smbcc.WriteListParam]
+	assert.False(t, found)
+
+	// a disabled quota has no effect
+	share.Spec.Quota.Disabled = true
+	opts = planner.shareOptions()
+	_, found = opts[smbcc.MaxDiskSizeParam]
+	assert.False(t, found)
+	assert.Equal(t, smbcc.No, opts[smbcc.ReadOnlyParam])
+	assert.Equal(t, "alice", opts[smbcc.WriteListParam])
+}
+
+func TestPlannerSmbPort(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		cc)
+	assert.Equal(t, int32(445), planner.smbPort())
+	_, err := planner.update()
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]smbcc.Key{smbcc.NoPrintingKey, defaultAuthKey}, cc.Configs["myshare"].Globals)
+
+	// the common config's port applies unless the share sets its own
+	port := int32(4450)
+	sharePort := int32(8445)
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner.CommonConfig.Spec.Network.Port = &port
+	assert.Equal(t, int32(4450), planner.smbPort())
+	share.Spec.Port = &sharePort
+	assert.Equal(t, int32(8445), planner.smbPort())
+
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t,
+		[]smbcc.Key{smbcc.NoPrintingKey, defaultAuthKey, "ports_8445"},
+		cc.Configs["myshare"].Globals)
+	assert.Equal(t,
+		"8445",
+		cc.Globals["ports_8445"].Options[smbcc.SmbPortsParam])
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestPlannerConnectionLimits(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		cc)
+	_, found := planner.shareOptions()[smbcc.MaxConnectionsParam]
+	assert.False(t, found)
+	assert.Equal(t, smbcc.Key(""), planner.limitsKey())
+
+	maxConns := int32(20)
+	maxProcs := int32(100)
+	share.Spec.MaxConnections = &maxConns
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner.CommonConfig.Spec.MaxSmbdProcesses = &maxProcs
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t,
+		"20",
+		cc.Shares["myshare"].Options[smbcc.MaxConnectionsParam])
+	assert.Equal(t,
+		[]smbcc.Key{smbcc.NoPrintingKey, defaultAuthKey, "limits_100"},
+		cc.Configs["myshare"].Globals)
+	assert.Equal(t,
+		"100",
+		cc.Globals["limits_100"].Options[smbcc.MaxSmbdProcessesParam])
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestPlannerServerIdentity(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		cc)
+	assert.Equal(t, smbcc.Key(""), planner.identityKey())
+
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner.CommonConfig.Spec.ServerString = "Accounting files"
+	planner.CommonConfig.Spec.NetbiosName = "ACCOUNTING"
+	planner.CommonConfig.Spec.Workgroup = "FINANCE"
+	_, err := planner.update()
+	assert.NoError(t, err)
+	key := planner.identityKey()
+	assert.Equal(t,
+		[]smbcc.Key{smbcc.NoPrintingKey, defaultAuthKey, key},
+		cc.Configs["myshare"].Globals)
+	conf, err := cc.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tnetbios name = ACCOUNTING\n")
+	assert.Contains(t, conf, "\tserver string = Accounting files\n")
+	assert.Contains(t, conf, "\tworkgroup = FINANCE\n")
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// a changed identity is a new globals section
+	planner.CommonConfig.Spec.ServerString = "Accounting"
+	assert.NotEqual(t, key, planner.identityKey())
+
+	// the workgroup of domain members is derived from the realm
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{}
+	planner.SecurityConfig.Spec.Mode = string(adMode)
+	planner.SecurityConfig.Spec.Realm = "finance.example.com"
+	_, found := planner.identityOptions()[smbcc.WorkgroupParam]
+	assert.False(t, found)
+	assert.Equal(t, "FINANCE", planner.realmOptions()[smbcc.WorkgroupParam])
+}
+
+func TestPlannerPerformance(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		cc)
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	assert.Equal(t, smbcc.Key(""), planner.performanceKey())
+
+	aioRead, aioWrite := int64(16384), int64(0)
+	threads := int32(200)
+	sendfile, readRaw := true, false
+	maxRead := int64(4 * mebibyte)
+	receivefile := int64(16384)
+	planner.CommonConfig.Spec.Performance = &sambaoperatorv1alpha1.SmbPerformanceSpec{
+		AioReadSize:        &aioRead,
+		AioWriteSize:       &aioWrite,
+		AioMaxThreads:      &threads,
+		UseSendfile:        &sendfile,
+		ReadRaw:            &readRaw,
+		SMB2MaxRead:        &maxRead,
+		MinReceivefileSize: &receivefile,
+		AioWriteBehind:     []string{"*.tmp", "*.bak"},
+	}
+	_, err := planner.update()
+	assert.NoError(t, err)
+	key := planner.performanceKey()
+	assert.Equal(t,
+		[]smbcc.Key{smbcc.NoPrintingKey, defaultAuthKey, key},
+		cc.Configs["myshare"].Globals)
+	conf, err := cc.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\taio read size = 16384\n")
+	assert.Contains(t, conf, "\taio write size = 0\n")
+	assert.Contains(t, conf, "\taio max threads = 200\n")
+	assert.Contains(t, conf, "\tuse sendfile = yes\n")
+	assert.Contains(t, conf, "\tread raw = no\n")
+	assert.Contains(t, conf, "\tsmb2 max read = 4194304\n")
+	assert.Contains(t, conf, "\tmin receivefile size = 16384\n")
+	assert.Contains(t, conf, "\taio write behind = /*.tmp/*.bak/\n")
+	// unset values are left to samba
+	assert.NotContains(t, conf, "write raw")
+	assert.NotContains(t, conf, "smb2 max write")
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// changed settings are a new globals section
+	readRaw = true
+	assert.NotEqual(t, key, planner.performanceKey())
+}
+
+func TestPlannerSessions(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		cc)
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	assert.Equal(t, smbcc.Key(""), planner.sessionsKey())
+
+	deadtime, keepalive := int32(15), int32(0)
+	planner.CommonConfig.Spec.Sessions = &sambaoperatorv1alpha1.SmbSessionsSpec{
+		Deadtime:  &deadtime,
+		Keepalive: &keepalive,
+	}
+	_, err := planner.update()
+	assert.NoError(t, err)
+	key := planner.sessionsKey()
+	assert.Equal(t,
+		[]smbcc.Key{smbcc.NoPrintingKey, defaultAuthKey, key},
+		cc.Configs["myshare"].Globals)
+	conf, err := cc.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tdeadtime = 15\n")
+	assert.Contains(t, conf, "\tkeepalive = 0\n")
+	// unset values are left to samba
+	assert.NotContains(t, conf, "smb2 max credits")
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	credits := int32(512)
+	planner.CommonConfig.Spec.Sessions.SMB2MaxCredits = &credits
+	assert.NotEqual(t, key, planner.sessionsKey())
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	conf, err = cc.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tsmb2 max credits = 512\n")
+}
+
+func TestPlannerInclude(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		cc)
+	assert.Equal(t, smbcc.Key(""), planner.includeKey())
+
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner.CommonConfig.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		ExtraMounts: []sambaoperatorv1alpha1.SmbExtraMount{
+			{Name: "scripts", MountPath: "/opt/scripts", ConfigMap: "scripts"},
+			{
+				Name:      "tuning",
+				MountPath: "/etc/samba/tuning",
+				ConfigMap: "tuning",
+				Include:   "tuning.conf",
+			},
+		},
+	}
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	key := smbcc.Key("include_/etc/samba/tuning/tuning.conf")
+	assert.Equal(t,
+		[]smbcc.Key{smbcc.NoPrintingKey, defaultAuthKey, key},
+		cc.Configs["myshare"].Globals)
+	assert.Equal(t,
+		"/etc/samba/tuning/tuning.conf",
+		cc.Globals[key].Options[smbcc.IncludeParam])
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestPlannerGuestAccess(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		cc)
+	opts := planner.shareOptions()
+	_, found := opts[smbcc.GuestOkParam]
+	assert.False(t, found)
+	assert.False(t, planner.guestAccess())
+
+	share.Spec.GuestAccess = "read"
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.Yes, opts[smbcc.GuestOkParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.ReadOnlyParam])
+	_, found = opts[smbcc.GuestOnlyParam]
+	assert.False(t, found)
+
+	share.Spec.GuestAccess = "dropbox"
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.Yes, opts[smbcc.GuestOkParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.GuestOnlyParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.ReadOnlyParam])
+	assert.Equal(t, "0200", opts[smbcc.CreateMaskParam])
+	assert.Equal(t, "0300", opts[smbcc.DirectoryMaskParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.HideUnreadableParam])
+
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t,
+		[]smbcc.Key{smbcc.NoPrintingKey, defaultAuthKey, guestKey},
+		cc.Configs["myshare"].Globals)
+	assert.Equal(t,
+		"Bad User",
+		cc.Globals[guestKey].Options[smbcc.MapToGuestParam])
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// guests are mapped to the guest account
+	share.Spec.GuestAccount = "dropper"
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	key := planner.guestAccountKey()
+	assert.Equal(t,
+		[]smbcc.Key{smbcc.NoPrintingKey, defaultAuthKey, guestKey, key},
+		cc.Configs["myshare"].Globals)
+	conf, err := cc.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tguest account = dropper\n")
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	share.Spec.GuestAccount = "guests"
+	assert.NotEqual(t, key, planner.guestAccountKey())
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	conf, err = cc.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tguest account = guests\n")
+	assert.NotContains(t, conf, "dropper")
+}
+
+func TestPlannerFilePatterns(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	opts := planner.shareOptions()
+	_, found := opts[smbcc.VetoFilesParam]
+	assert.False(t, found)
+	_, found = opts[smbcc.DeleteVetoFilesParam]
+	assert.False(t, found)
+
+	share.Spec.VetoFiles = []string{"Thumbs.db", ".DS_Store", "*.tmp"}
+	share.Spec.HideFiles = []string{"desktop.ini", "My Notes?.txt"}
+	opts = planner.shareOptions()
+	assert.Equal(t, "/Thumbs.db/.DS_Store/*.tmp/", opts[smbcc.VetoFilesParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.DeleteVetoFilesParam])
+	assert.Equal(t, "/desktop.ini/My Notes?.txt/", opts[smbcc.HideFilesParam])
+}
+
+func TestInvalidFilePatterns(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	assert.Empty(t, invalidFilePatterns(share))
+
+	share.Spec.VetoFiles = []string{"*.tmp", "", "a/b"}
+	share.Spec.HideFiles = []string{"ok", "bad\nline"}
+	assert.Equal(t,
+		[]string{`""`, `"a/b"`, `"bad\nline"`},
+		invalidFilePatterns(share))
+}
+
+func TestPlannerCaseSensitivity(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	opts := planner.shareOptions()
+	for _, param := range []string{
+		smbcc.CaseSensitiveParam,
+		smbcc.PreserveCaseParam,
+		smbcc.ShortPreserveCaseParam,
+		smbcc.MangledNamesParam,
+	} {
+		_, found := opts[param]
+		assert.False(t, found, param)
+	}
+
+	no, yes := false, true
+	share.Spec.CaseSensitive = "no"
+	share.Spec.PreserveCase = &yes
+	share.Spec.ShortPreserveCase = &no
+	share.Spec.MangledNames = "illegal"
+	opts = planner.shareOptions()
+	assert.Equal(t, "no", opts[smbcc.CaseSensitiveParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.PreserveCaseParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.ShortPreserveCaseParam])
+	assert.Equal(t, "illegal", opts[smbcc.MangledNamesParam])
+}
+
+func TestPlannerWideLinks(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	planner.ConfigState = smbcc.New()
+	opts := planner.shareOptions()
+	_, found := opts[smbcc.FollowSymlinksParam]
+	assert.False(t, found)
+	_, found = opts[smbcc.WideLinksParam]
+	assert.False(t, found)
+	assert.False(t, planner.wideLinks())
+
+	no := false
+	share.Spec.FollowSymlinks = &no
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.No, opts[smbcc.FollowSymlinksParam])
+
+	share.Spec.FollowSymlinks = nil
+	share.Spec.WideLinks = true
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.Yes, opts[smbcc.WideLinksParam])
+	_, err := planner.update()
+	assert.NoError(t, err)
+	assert.Contains(t,
+		planner.ConfigState.Configs["myshare"].Globals, wideLinksKey)
+	assert.Equal(t,
+		smbcc.Yes,
+		planner.ConfigState.Globals[wideLinksKey].Options[smbcc.AllowInsecureWideLinksParam])
+}
+
+func TestPlannerPosixExtensions(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	planner.ConfigState = smbcc.New()
+	assert.False(t, planner.posixExtensions())
+	_, err := planner.update()
+	assert.NoError(t, err)
+	assert.NotContains(t,
+		planner.ConfigState.Configs["myshare"].Globals, posixExtensionsKey)
+
+	share.Spec.PosixExtensions = true
+	opts := planner.shareOptions()
+	assert.Equal(t, "0777", opts[smbcc.CreateMaskParam])
+	assert.Equal(t, "0777", opts[smbcc.DirectoryMaskParam])
+	_, err = planner.update()
+	assert.NoError(t, err)
+	assert.Contains(t,
+		planner.ConfigState.Configs["myshare"].Globals, posixExtensionsKey)
+	assert.Equal(t,
+		smbcc.Yes,
+		planner.ConfigState.Globals[posixExtensionsKey].Options[smbcc.SMB3UnixExtensionsParam])
+
+	// the masks of the share win
+	share.Spec.CreateMask = "0755"
+	opts = planner.shareOptions()
+	assert.Equal(t, "0755", opts[smbcc.CreateMaskParam])
+	assert.Equal(t, "0777", opts[smbcc.DirectoryMaskParam])
+
+	// the extensions are advertised to all the shares of the group
+	other := &sambaoperatorv1alpha1.SmbShare{}
+	other.Name = "other"
+	otherPlanner := testPlanner(other, nil)
+	otherPlanner.GroupShares = []sambaoperatorv1alpha1.SmbShare{*other, *share}
+	assert.True(t, otherPlanner.posixExtensions())
+	_, found := otherPlanner.shareOptions()[smbcc.CreateMaskParam]
+	assert.False(t, found)
+}
+
+func TestPlannerDeletionOptions(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	opts := planner.shareOptions()
+	for _, param := range []string{
+		smbcc.DeleteReadonlyParam,
+		smbcc.ACLCheckPermissionsParam,
+		smbcc.ForceUnknownACLUserParam,
+	} {
+		_, found := opts[param]
+		assert.False(t, found, param)
+	}
+
+	no := false
+	share.Spec.DeleteReadonly = true
+	share.Spec.ACLCheckPermissions = &no
+	share.Spec.ForceUnknownACLUser = true
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.Yes, opts[smbcc.DeleteReadonlyParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.ACLCheckPermissionsParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.ForceUnknownACLUserParam])
+}
+
+func TestPlannerOplocks(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	planner.ConfigState = smbcc.New()
+	opts := planner.shareOptions()
+	for _, param := range []string{
+		smbcc.OplocksParam,
+		smbcc.KernelOplocksParam,
+		smbcc.Level2OplocksParam,
+	} {
+		_, found := opts[param]
+		assert.False(t, found, param)
+	}
+	assert.Equal(t, smbcc.Key(""), planner.leasesKey())
+
+	no, yes := false, true
+	share.Spec.Oplocks = &no
+	share.Spec.KernelOplocks = &yes
+	share.Spec.Level2Oplocks = &no
+	share.Spec.Leases = &no
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.No, opts[smbcc.OplocksParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.KernelOplocksParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.Level2OplocksParam])
+	_, err := planner.update()
+	assert.NoError(t, err)
+	key := smbcc.Key("leases_no")
+	assert.Contains(t, planner.ConfigState.Configs["myshare"].Globals, key)
+	assert.Equal(t,
+		smbcc.No,
+		planner.ConfigState.Globals[key].Options[smbcc.SMB2LeasesParam])
+
+	// leases are off for the group if any share turns them off
+	other := sambaoperatorv1alpha1.SmbShare{}
+	other.Name = "other"
+	other.Spec.Leases = &yes
+	planner.GroupShares = []sambaoperatorv1alpha1.SmbShare{*share, other}
+	assert.Equal(t, key, planner.leasesKey())
+	share.Spec.Leases = nil
+	planner.GroupShares = []sambaoperatorv1alpha1.SmbShare{*share, other}
+	assert.Equal(t, smbcc.Key("leases_yes"), planner.leasesKey())
+}
+
+func TestPlannerDurableHandles(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	opts := planner.shareOptions()
+	for _, param := range []string{
+		smbcc.DurableHandlesParam,
+		smbcc.PosixLockingParam,
+		smbcc.ContinuouslyAvailableParam,
+	} {
+		_, found := opts[param]
+		assert.False(t, found, param)
+	}
+
+	// durable handles turn leases on for the group
+	share.Spec.DurableHandles = true
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.Yes, opts[smbcc.DurableHandlesParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.KernelShareModesParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.PosixLockingParam])
+	_, found := opts[smbcc.ContinuouslyAvailableParam]
+	assert.False(t, found)
+	assert.Equal(t, smbcc.Key("leases_yes"), planner.leasesKey())
+
+	share.Spec.DurableHandles = false
+	share.Spec.PersistentHandles = true
+	opts = planner.shareOptions()
+	assert.Equal(t, smbcc.Yes, opts[smbcc.DurableHandlesParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.ContinuouslyAvailableParam])
+	assert.False(t, planner.clustered())
+}
+
+func TestPlannerInterfaces(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	planner.ConfigState = smbcc.New()
+	assert.Nil(t, planner.interfaces())
+	assert.Equal(t, smbcc.Key(""), planner.interfacesKey())
+
+	common.Spec.Network.Interfaces = []string{"net1", "10.1.0.0/16"}
+	_, err := planner.update()
+	assert.NoError(t, err)
+	key := smbcc.Key("interfaces_lo,net1,10.1.0.0/16")
+	assert.Contains(t, planner.ConfigState.Configs["myshare"].Globals, key)
+	opts := planner.ConfigState.Globals[key].Options
+	assert.Equal(t, "lo net1 10.1.0.0/16", opts[smbcc.InterfacesParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.BindInterfacesOnlyParam])
+
+	// the share overrides the common config
+	share.Spec.Interfaces = []string{"lo", "net2"}
+	assert.Equal(t, []string{"lo", "net2"}, planner.interfaces())
+	assert.Equal(t, "lo net2", planner.interfacesParam())
+	assert.Equal(t, smbcc.Key("interfaces_lo,net2"), planner.interfacesKey())
+}
+
+func TestPlannerMultiChannel(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	planner.ConfigState = smbcc.New()
+	_, err := planner.update()
+	assert.NoError(t, err)
+	assert.NotContains(t,
+		planner.ConfigState.Configs["myshare"].Globals, multiChannelKey)
+
+	common.Spec.Network.MultiChannel = true
+	planner.ConfigState = smbcc.New()
+	_, err = planner.update()
+	assert.NoError(t, err)
+	assert.Contains(t,
+		planner.ConfigState.Configs["myshare"].Globals, multiChannelKey)
+	opts := planner.ConfigState.Globals[multiChannelKey].Options
+	assert.Equal(t, smbcc.Yes, opts[smbcc.ServerMultiChannelSupportParam])
+}
+
+func TestPlannerForcedIDs(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	opts := planner.shareOptions()
+	_, found := opts[smbcc.ForceUserParam]
+	assert.False(t, found)
+	_, found = opts[smbcc.ForceGroupParam]
+	assert.False(t, found)
+
+	share.Spec.ForceUser = `CHEM\alice`
+	share.Spec.ForceGroup = "domain users"
+	opts = planner.shareOptions()
+	assert.Equal(t, `CHEM\alice`, opts[smbcc.ForceUserParam])
+	assert.Equal(t, "domain users", opts[smbcc.ForceGroupParam])
+}
+
+func TestValidAccountName(t *testing.T) {
+	valid := []string{"alice", "domain users", "a.b-c_d"}
+	for _, name := range valid {
+		assert.True(t, validAccountName(name, userMode), name)
+		assert.True(t, validAccountName(name, adMode), name)
+	}
+	invalid := []string{"", " alice", "alice ", "a/b", "a:b", "a*", "a\tb"}
+	for _, name := range invalid {
+		assert.False(t, validAccountName(name, userMode), name)
+		assert.False(t, validAccountName(name, adMode), name)
+	}
+	// only domain accounts are qualified with a domain
+	assert.False(t, validAccountName(`CHEM\alice`, userMode))
+	assert.True(t, validAccountName(`CHEM\alice`, adMode))
+	assert.False(t, validAccountName(`\alice`, adMode))
+	assert.False(t, validAccountName(`CHEM\`, adMode))
+	assert.False(t, validAccountName(`CHEM\a\b`, adMode))
+}
+
+func TestPlannerSharePath(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.UID = "abc123"
+	planner := testPlanner(share, nil)
+	assert.Equal(t, "/mnt/abc123", planner.shareOptions()["path"])
+
+	share.Spec.Storage.Path = "projects/2026"
+	assert.Equal(t, "/mnt/abc123/projects/2026", planner.shareOptions()["path"])
+	assert.Equal(t, "/mnt/abc123", shareMountPathOf(share))
+}
+
+func TestPlannerSharePathTemplate(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "alpha"
+	share.Namespace = "team-a"
+	share.UID = "abc123"
+	share.Spec.Storage.Path = "shares/{{ .Namespace }}/{{ .Name }}"
+	planner := testPlanner(share, nil)
+	planner.ConfigState = smbcc.New()
+	_, err := planner.update()
+	assert.NoError(t, err)
+	cfg, err := planner.ConfigState.SmbConf("alpha")
+	assert.NoError(t, err)
+	assert.Contains(t, cfg, "\tpath = /mnt/abc123/shares/team-a/alpha\n")
+
+	// the directory of the share is created on the volume
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	if assert.NotEmpty(t, podSpec.InitContainers) {
+		ctr := podSpec.InitContainers[0]
+		assert.Equal(t, "init-path", ctr.Name)
+		assert.Equal(t, "/mnt/abc123", ctr.VolumeMounts[0].MountPath)
+		assert.Contains(t, ctr.Command[2], "for c in 'shares' 'team-a' 'alpha';")
+	}
+
+	// paths without a template are left as they are
+	share.Spec.Storage.Path = "shares/{ .Name }"
+	assert.Equal(t, "/mnt/abc123/shares/{ .Name }", sharePathOf(share))
+}
+
+func TestValidSharePath(t *testing.T) {
+	valid := []string{"", "a", "a/b c/d", "it's"}
+	for _, p := range valid {
+		assert.True(t, validSharePath(p), p)
+	}
+	invalid := []string{"/a", "a/", "a//b", ".", "a/../b", "..", "a/./b", "a\nb"}
+	for _, p := range invalid {
+		assert.False(t, validSharePath(p), p)
+	}
+}
+
+func TestPlannerAuthentication(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		cc)
+	_, err := planner.update()
+	assert.NoError(t, err)
+	// the legacy protocols are refused by default
+	opts := cc.Globals[defaultAuthKey].Options
+	assert.Equal(t, "ntlmv2-only", opts[smbcc.NTLMAuthParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.LanmanAuthParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.RawNTLMv2AuthParam])
+	assert.Equal(t, smbcc.Yes, opts[smbcc.ClientNTLMv2AuthParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.ClientLanmanAuthParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.ClientPlaintextAuthParam])
+
+	no := false
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{}
+	planner.SecurityConfig.Spec.Mode = "active-directory"
+	planner.SecurityConfig.Spec.Realm = "example.com"
+	planner.SecurityConfig.Spec.Authentication = &sambaoperatorv1alpha1.SmbSecurityAuthenticationSpec{
+		NTLMAuth:         "disabled",
+		ClientNTLMv2Auth: &no,
+	}
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t,
+		[]smbcc.Key{
+			smbcc.NoPrintingKey, "EXAMPLE.COM", "auth_disabled_client_ntlmv1"},
+		cc.Configs["myshare"].Globals)
+	opts = cc.Globals["auth_disabled_client_ntlmv1"].Options
+	assert.Equal(t, "disabled", opts[smbcc.NTLMAuthParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.ClientNTLMv2AuthParam])
+	assert.Equal(t, smbcc.No, opts[smbcc.LanmanAuthParam])
+	// the default settings remain for the server groups using them
+	assert.Equal(t, "ntlmv2-only",
+		cc.Globals[defaultAuthKey].Options[smbcc.NTLMAuthParam])
+	// kerberos remains available to the clients of the domain
+	assert.Equal(t, "ads", cc.Globals["EXAMPLE.COM"].Options["security"])
+
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestPlannerCustomConfig(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		cc)
+	assert.Equal(t, "Managed", planner.configMode())
+	_, err := planner.update()
+	assert.NoError(t, err)
+	assert.Equal(t, []smbcc.Key{"myshare"}, cc.Configs["myshare"].Shares)
+
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner.CommonConfig.Spec.CustomConfig = &sambaoperatorv1alpha1.SmbCustomConfig{
+		ConfigMap: "my-smb-conf",
+		Key:       "custom.conf",
+	}
+	assert.Equal(t, "Unmanaged", planner.configMode())
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	// only the custom smb.conf is loaded
+	key := smbcc.Key("custom_/etc/samba/custom/custom.conf")
+	assert.Equal(t, []smbcc.Key{key}, cc.Configs["myshare"].Globals)
+	assert.Empty(t, cc.Configs["myshare"].Shares)
+	assert.Equal(t,
+		"/etc/samba/custom/custom.conf",
+		cc.Globals[key].Options[smbcc.IncludeParam])
+
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestPlannerCollectCores(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{
+			SmbShare:     share,
+			CommonConfig: &sambaoperatorv1alpha1.SmbCommonConfig{},
+		},
+		cc)
+	_, err := planner.update()
+	assert.NoError(t, err)
+	assert.NotContains(t, cc.Configs["myshare"].Globals, coresKey)
+
+	planner.CommonConfig.Spec.Debug = &sambaoperatorv1alpha1.SmbDebugSpec{
+		CollectCores: true,
+	}
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, cc.Configs["myshare"].Globals, coresKey)
+	assert.Equal(t,
+		`/bin/sh -c 'echo "$(date -u) process %d panicked" >> `+
+			`/var/log/samba/cores/panic.log'`,
+		cc.Globals[coresKey].Options[smbcc.PanicActionParam])
+
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// crash data is still collected with a custom smb.conf
+	planner.CommonConfig.Spec.CustomConfig = &sambaoperatorv1alpha1.SmbCustomConfig{
+		ConfigMap: "my-smb-conf",
+	}
+	_, err = planner.update()
+	assert.NoError(t, err)
+	assert.Contains(t, cc.Configs["myshare"].Globals, coresKey)
+}
+
+func TestPlannerPrintServices(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		cc)
+
+	// printing is disabled by default
+	_, err := planner.update()
+	assert.NoError(t, err)
+	assert.Equal(t, smbcc.NoPrintingKey, cc.Configs["myshare"].Globals[0])
+	assert.Equal(t, []smbcc.Key{"myshare"}, cc.Configs["myshare"].Shares)
+	conf, err := cc.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tload printers = no\n")
+	assert.Contains(t, conf, "\tprinting = bsd\n")
+	assert.Contains(t, conf, "\tprintcap name = /dev/null\n")
+	assert.Contains(t, conf, "\tdisable spoolss = yes\n")
+	assert.NotContains(t, conf, "[printers]")
+	assert.NotContains(t, conf, "[print$]")
+
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner.CommonConfig.Spec.PrintServices = true
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, smbcc.PrintingKey, cc.Configs["myshare"].Globals[0])
+	assert.Equal(t,
+		[]smbcc.Key{"myshare", smbcc.PrintersKey},
+		cc.Configs["myshare"].Shares)
+	conf, err = cc.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tload printers = yes\n")
+	assert.Contains(t, conf, "[printers]\n")
+	assert.Contains(t, conf, "\tprintable = yes\n")
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestPlannerLogging(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		cc)
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner.CommonConfig.Spec.Debug = &sambaoperatorv1alpha1.SmbDebugSpec{}
+	assert.Equal(t, smbcc.Key(""), planner.loggingKey())
+
+	planner.CommonConfig.Spec.Debug.LogTo = "stdout"
+	_, err := planner.update()
+	assert.NoError(t, err)
+	key := planner.loggingKey()
+	assert.Contains(t, cc.Configs["myshare"].Globals, key)
+	conf, err := cc.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tlog file = /dev/stdout\n")
+	assert.Contains(t, conf, "\tmax log size = 0\n")
+
+	size := int32(1024)
+	planner.CommonConfig.Spec.Debug.LogTo = "file"
+	planner.CommonConfig.Spec.Debug.MaxLogSize = &size
+	assert.NotEqual(t, key, planner.loggingKey())
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.NotContains(t, cc.Configs["myshare"].Globals, key)
+	conf, err = cc.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tlog file = /var/log/samba/log.%m\n")
+	assert.Contains(t, conf, "\tmax log size = 1024\n")
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestPlannerSync(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	opts := planner.shareOptions()
+	for _, param := range []string{smbcc.StrictSyncParam, smbcc.SyncAlwaysParam} {
+		_, found := opts[param]
+		assert.False(t, found, param)
+	}
+
+	no, yes := false, true
+	share.Spec.StrictSync = &no
+	assert.Equal(t, smbcc.No, planner.shareOptions()[smbcc.StrictSyncParam])
+
+	share.Spec.StrictSync = &yes
+	share.Spec.SyncAlways = true
+	planner.ConfigState = smbcc.New()
+	_, err := planner.update()
+	assert.NoError(t, err)
+	conf, err := planner.ConfigState.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "strict sync = yes")
+	assert.Contains(t, conf, "sync always = yes")
+}
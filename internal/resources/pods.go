@@ -17,19 +17,27 @@ package resources
 
 import (
 	"fmt"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
 	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
 )
 
+const joinContainerName = "must-join"
+
+const dnsRegisterContainerName = "dns-register"
+
 const (
 	userSecretVolName = "users-config"
 	wbSocketsVolName  = "samba-wb-sockets-dir"
 	stateVolName      = "samba-state-dir"
 	osRunVolName      = "run"
 	joinJSONVolName   = "join-data"
+	keytabVolName     = "keytab"
+	krb5ConfVolName   = "krb5-conf"
 )
 
 func buildPodSpec(
@@ -37,10 +45,62 @@ func buildPodSpec(
 	cfg *conf.OperatorConfig,
 	pvcName string) corev1.PodSpec {
 	// ---
+	var podSpec corev1.PodSpec
 	if planner.securityMode() == adMode {
-		return buildADPodSpec(planner, cfg, pvcName)
+		podSpec = buildADPodSpec(planner, cfg, pvcName)
+	} else {
+		podSpec = buildUserPodSpec(planner, cfg, pvcName)
+	}
+	// the share directories must exist before their permissions are set,
+	// and be writable before home directories can be created in them.
+	podSpec.InitContainers = append(
+		podSpec.InitContainers, pathInitContainers(planner, pvcName)...)
+	podSpec.InitContainers = append(
+		podSpec.InitContainers, permissionsInitContainers(planner, pvcName)...)
+	podSpec.InitContainers = append(
+		podSpec.InitContainers, homesInitContainers(planner, pvcName)...)
+	// names are normalized before the DFS links are created, so that the
+	// links are not renamed.
+	podSpec.InitContainers = append(
+		podSpec.InitContainers, normalizeInitContainers(planner, pvcName)...)
+	podSpec.InitContainers = append(
+		podSpec.InitContainers, msdfsInitContainers(planner, pvcName)...)
+	if planner.metrics() {
+		addMetricsContainer(planner, &podSpec, cfg.SmbdContainerName, pvcName)
+	}
+	// the configuration is checked once the init containers have set up
+	// everything it refers to.
+	addCheckConfigContainer(&podSpec, planner, cfg.SmbdContainerName)
+	// last, so that the containers added above get the writable paths too
+	setReadOnlyRootFilesystem(planner, &podSpec)
+	// after, as clamd updates its signatures in its own root file system
+	addAntivirusContainers(planner, &podSpec, pvcName)
+	// the containers of the common config are added as they are
+	podSpec.Containers = append(
+		podSpec.Containers, extraContainers(planner, pvcName)...)
+	podSpec.SecurityContext = planner.podSecurityContext()
+	podSpec.NodeSelector = planner.nodeSelector()
+	podSpec.Tolerations = planner.tolerations()
+	podSpec.Affinity = planner.affinity()
+	podSpec.TopologySpreadConstraints = planner.topologySpreadConstraints()
+	podSpec.ImagePullSecrets = planner.imagePullSecrets()
+	podSpec.PriorityClassName = planner.priorityClassName()
+	gracePeriod := planner.terminationGracePeriod()
+	podSpec.TerminationGracePeriodSeconds = &gracePeriod
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name != cfg.SmbdContainerName {
+			continue
+		}
+		// let clients finish their work before smbd is stopped
+		podSpec.Containers[i].Lifecycle = &corev1.Lifecycle{
+			PreStop: &corev1.Handler{
+				Exec: &corev1.ExecAction{
+					Command: planner.drainCommand(),
+				},
+			},
+		}
 	}
-	return buildUserPodSpec(planner, cfg, pvcName)
+	return podSpec
 }
 
 func buildADPodSpec(
@@ -59,19 +119,40 @@ func buildADPodSpec(
 	volumes = append(volumes, stateVol)
 	mounts = append(mounts, stateMount)
 
+	// for all containers talking to the domain, if a krb5.conf is provided
+	if planner.krb5ConfConfigMap() != "" {
+		krb5Vol, krb5Mount := krb5ConfVolumeAndMount(planner)
+		volumes = append(volumes, krb5Vol)
+		mounts = append(mounts, krb5Mount)
+	}
+
 	// for smbd only
-	shareVol, shareMount := shareVolumeAndMount(planner, pvcName)
-	volumes = append(volumes, shareVol)
+	shareVols, shareMounts := shareVolumesAndMounts(planner, pvcName)
+	volumes = append(volumes, shareVols...)
 
 	// for smbd and winbind only (not init containers)
 	wbSockVol, wbSockMount := wbSocketsVolumeAndMount(planner)
 	volumes = append(volumes, wbSockVol)
 
+	// for smbd and winbind only, if a keytab is provided
+	serverMounts := []corev1.VolumeMount{wbSockMount}
+	if planner.keytabSecret() != "" {
+		keytabVol, keytabMount := keytabVolumeAndMount(planner)
+		volumes = append(volumes, keytabVol)
+		serverMounts = append(serverMounts, keytabMount)
+	}
+
+	// for smbd and winbind only
+	extraVols, extraMounts := extraVolumesAndMounts(planner)
+	volumes = append(volumes, extraVols...)
+	serverMounts = append(serverMounts, extraMounts...)
+
 	jsrc := getJoinSources(planner)
 	joinEnv := []corev1.EnvVar{{
 		Name:  "SAMBACC_JOIN_FILES",
 		Value: planner.joinEnvPaths(jsrc.paths),
 	}}
+	joinEnv = append(joinEnv, planner.joinRetryEnv()...)
 	volumes = append(volumes, jsrc.volumes...)
 
 	podEnv := defaultPodEnv(planner)
@@ -82,45 +163,47 @@ func buildADPodSpec(
 		ShareProcessNamespace: &spn,
 		InitContainers: []corev1.Container{
 			{
-				Image:        cfg.SmbdContainerImage,
+				Image:        planner.sambaImage(),
 				Name:         "init",
 				Args:         []string{"init"},
 				Env:          podEnv,
 				VolumeMounts: mounts,
 			},
 			{
-				Image:        cfg.SmbdContainerImage,
-				Name:         "must-join",
-				Args:         []string{"must-join"},
+				Image:        planner.sambaImage(),
+				Name:         joinContainerName,
+				Command:      planner.joinCommand(),
+				Args:         planner.joinArgs(),
 				Env:          append(podEnv, joinEnv...),
 				VolumeMounts: append(mounts, jsrc.mounts...),
+				// the output of a failed join is reported in the
+				// SmbShare's conditions.
+				TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
 			},
 		},
 		Containers: []corev1.Container{
 			{
-				Image: cfg.SmbdContainerImage,
+				Image: planner.sambaImage(),
 				Name:  cfg.SmbdContainerName,
-				Args:  []string{"run", "smbd"},
-				Env:   podEnv,
+				Args:  serverArgs(planner, "run", "smbd"),
+				Env:   serverEnv(planner, podEnv),
 				Ports: []corev1.ContainerPort{{
-					ContainerPort: 445,
+					ContainerPort: planner.smbPort(),
 					Name:          "smb",
 				}},
-				VolumeMounts: append(mounts, wbSockMount, shareMount),
-				LivenessProbe: &corev1.Probe{
-					Handler: corev1.Handler{
-						TCPSocket: &corev1.TCPSocketAction{
-							Port: intstr.FromInt(445),
-						},
-					},
-				},
+				VolumeMounts: append(
+					append(mounts, serverMounts...), shareMounts...),
+				Resources:      planner.smbdResources(),
+				StartupProbe:   smbdStartupProbe(planner),
+				LivenessProbe:  smbdLivenessProbe(planner),
+				ReadinessProbe: smbdReadinessProbe(planner),
 			},
 			{
-				Image:        cfg.SmbdContainerImage,
-				Name:         "wb", //cfg.WinbindContainerName,
-				Args:         []string{"run", "winbindd"},
-				Env:          podEnv,
-				VolumeMounts: append(mounts, wbSockMount),
+				Image:        planner.sambaImage(),
+				Name:         winbindContainerName,
+				Args:         serverArgs(planner, "run", "winbindd"),
+				Env:          serverEnv(planner, podEnv),
+				VolumeMounts: append(mounts, serverMounts...),
 				LivenessProbe: &corev1.Probe{
 					Handler: corev1.Handler{
 						Exec: &corev1.ExecAction{
@@ -140,16 +223,33 @@ func buildADPodSpec(
 			planner.serviceWatchStateDir(),
 		)
 		podSpec.Volumes = append(podSpec.Volumes, watchVol)
+		dnsMounts := append(mounts, wbSockMount, watchMount)
+		if planner.dnsUpdateMethod() == dnsUpdateTSIG &&
+			planner.dnsTSIGKey() != nil {
+			// ---
+			keyVol, keyMount := dnsTSIGKeyVolumeAndMount(planner)
+			podSpec.Volumes = append(podSpec.Volumes, keyVol)
+			dnsMounts = append(dnsMounts, keyMount)
+		}
 		podSpec.Containers = append(podSpec.Containers, corev1.Container{
-			Image:        cfg.SmbdContainerImage,
-			Name:         "dns-register",
+			Image:        planner.dnsRegisterImage(),
+			Name:         dnsRegisterContainerName,
 			Args:         planner.dnsRegisterArgs(),
 			Env:          podEnv,
-			VolumeMounts: append(mounts, wbSockMount, watchMount),
+			VolumeMounts: dnsMounts,
+			// remove the records of a stopping server, so that clients
+			// don't wait for them to expire.
+			Lifecycle: &corev1.Lifecycle{
+				PreStop: &corev1.Handler{
+					Exec: &corev1.ExecAction{
+						Command: planner.dnsUnregisterCommand(),
+					},
+				},
+			},
 		})
 		serviceLabelSel := fmt.Sprintf("metadata.labels['%s']", svcSelectorKey)
 		podSpec.Containers = append(podSpec.Containers, corev1.Container{
-			Image: cfg.SvcWatchContainerImage,
+			Image: planner.svcWatchImage(),
 			Name:  "svc-watch",
 			Env: []corev1.EnvVar{
 				{
@@ -191,9 +291,9 @@ func buildUserPodSpec(
 	volumes := []corev1.Volume{}
 	mounts := []corev1.VolumeMount{}
 
-	shareVol, shareMount := shareVolumeAndMount(planner, pvcName)
-	volumes = append(volumes, shareVol)
-	mounts = append(mounts, shareMount)
+	shareVols, shareMounts := shareVolumesAndMounts(planner, pvcName)
+	volumes = append(volumes, shareVols...)
+	mounts = append(mounts, shareMounts...)
 
 	configVol, configMount := configVolumeAndMount(planner)
 	volumes = append(volumes, configVol)
@@ -208,32 +308,262 @@ func buildUserPodSpec(
 		volumes = append(volumes, v)
 		mounts = append(mounts, m)
 	}
+	if planner.projectsLocalGroups() {
+		v, m := localGroupsVolumeAndMount(planner)
+		volumes = append(volumes, v)
+		mounts = append(mounts, m)
+	}
+	extraVols, extraMounts := extraVolumesAndMounts(planner)
+	volumes = append(volumes, extraVols...)
+	mounts = append(mounts, extraMounts...)
+
 	podEnv := defaultPodEnv(planner)
+	var initContainers []corev1.Container
+	if planner.ldapPassdb() != nil {
+		// the LDAP password is stored in the secrets database of the
+		// state volume by the init containers only
+		stateVol, stateMount := sambaStateVolumeAndMount(planner)
+		volumes = append(volumes, stateVol)
+		mounts = append(mounts, stateMount)
+		passwordVol, passwordMount := ldapPasswordVolumeAndMount(planner)
+		volumes = append(volumes, passwordVol)
+		initContainers = passdbInitContainers(
+			planner, podEnv, mounts, passwordMount)
+	}
 	podSpec := corev1.PodSpec{
-		Volumes: volumes,
+		Volumes:        volumes,
+		InitContainers: initContainers,
 		Containers: []corev1.Container{{
-			Image: cfg.SmbdContainerImage,
+			Image: planner.sambaImage(),
 			Name:  cfg.SmbdContainerName,
-			Args:  []string{"run", "smbd"},
-			Env:   podEnv,
+			Args:  serverArgs(planner, "run", "smbd"),
+			Env:   serverEnv(planner, podEnv),
 			Ports: []corev1.ContainerPort{{
-				ContainerPort: 445,
+				ContainerPort: planner.smbPort(),
 				Name:          "smb",
 			}},
-			VolumeMounts: mounts,
-			LivenessProbe: &corev1.Probe{
-				Handler: corev1.Handler{
-					TCPSocket: &corev1.TCPSocketAction{
-						Port: intstr.FromInt(445),
-					},
-				},
-			},
+			VolumeMounts:   mounts,
+			Resources:      planner.smbdResources(),
+			StartupProbe:   smbdStartupProbe(planner),
+			LivenessProbe:  smbdLivenessProbe(planner),
+			ReadinessProbe: smbdReadinessProbe(planner),
 		}},
 	}
 	return podSpec
 }
 
-func shareVolumeAndMount(planner *sharePlanner, pvcName string) (
+// homesInitContainers returns containers that create the base directory
+// of each home directories share of the server group on the share's
+// volume.
+func homesInitContainers(
+	planner *sharePlanner, ownPvc string) []corev1.Container {
+	// ---
+	containers := []corev1.Container{}
+	shares := planner.groupShares()
+	for i := range shares {
+		s := &shares[i]
+		if s.Spec.HomeDirectories == nil {
+			continue
+		}
+		_, shareMount := shareVolumeAndMount(s, sharePvcName(planner, s, ownPvc))
+		containers = append(containers, corev1.Container{
+			Image:        planner.sambaImage(),
+			Name:         "init-homes",
+			Command:      []string{"mkdir", "-p", "-m", "0755", homesBaseDirOf(s)},
+			VolumeMounts: []corev1.VolumeMount{shareMount},
+		})
+	}
+	return containers
+}
+
+// pathInitContainers returns the init containers that create the
+// directories of the shares that share a directory below the root of their
+// volume, or check that the directories exist for the shares requiring it.
+func pathInitContainers(
+	planner *sharePlanner, ownPvc string) []corev1.Container {
+	// ---
+	containers := []corev1.Container{}
+	shares := planner.groupShares()
+	for i := range shares {
+		s := &shares[i]
+		if storagePathOf(s) == "" || s.Spec.Storage.Pvc == nil {
+			continue
+		}
+		_, shareMount := shareVolumeAndMount(s, sharePvcName(planner, s, ownPvc))
+		if s.Spec.Storage.RequirePathExists {
+			name := pathCheckContainerName
+			if len(containers) > 0 {
+				name = fmt.Sprintf("%s-%d", name, len(containers))
+			}
+			containers = append(containers, corev1.Container{
+				Image:        planner.sambaImage(),
+				Name:         name,
+				Command:      pathCheckCommand(s),
+				VolumeMounts: []corev1.VolumeMount{shareMount},
+				// the missing path is reported in the SmbShare's
+				// conditions.
+				TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+			})
+			continue
+		}
+		name := pathContainerName
+		if len(containers) > 0 {
+			name = fmt.Sprintf("%s-%d", name, len(containers))
+		}
+		// the new directories are given the owner of the volume
+		root := int64(0)
+		containers = append(containers, corev1.Container{
+			Image:        planner.sambaImage(),
+			Name:         name,
+			Command:      pathCommand(s),
+			VolumeMounts: []corev1.VolumeMount{shareMount},
+			SecurityContext: &corev1.SecurityContext{
+				RunAsUser: &root,
+			},
+		})
+	}
+	return containers
+}
+
+const pathContainerName = "init-path"
+
+// pathCommand returns a command creating the missing directories of the
+// share's path, one at a time, so that only the directories it creates are
+// changed. New directories are given the owner of the root of the volume,
+// or the owner set by the share's initPermissions, and the mode of the
+// root of the volume, or the share's directoryMask. Existing directories
+// and their contents are left as they are.
+func pathCommand(s *sambaoperatorv1alpha1.SmbShare) []string {
+	owner := `"$(stat -c %u:%g "$root")"`
+	if perms := s.Spec.Storage.InitPermissions; perms != nil {
+		owner = fmt.Sprintf(`"%d:%d"`, perms.UID, perms.GID)
+	}
+	mode := `"$(stat -c %a "$root")"`
+	if m := s.Spec.DirectoryMask; m != "" {
+		mode = shellQuote(m)
+	}
+	components := strings.Split(storagePathOf(s), "/")
+	for i, c := range components {
+		components[i] = shellQuote(c)
+	}
+	script := fmt.Sprintf(
+		`root=%s; owner=%s; mode=%s; d="$root"; `+
+			`for c in %s; do d="$d/$c"; [ -d "$d" ] && continue; `+
+			`mkdir -m "$mode" "$d" && chown "$owner" "$d" || exit 1; done`,
+		shellQuote(shareMountPathOf(s)), owner, mode,
+		strings.Join(components, " "))
+	return []string{"/bin/sh", "-c", script}
+}
+
+// shellQuote quotes s as a single word for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// permissionsInitContainers returns the init containers that set the
+// owner and mode of the directories of the shares requesting it.
+func permissionsInitContainers(
+	planner *sharePlanner, ownPvc string) []corev1.Container {
+	// ---
+	containers := []corev1.Container{}
+	shares := planner.groupShares()
+	for i := range shares {
+		s := &shares[i]
+		perms := s.Spec.Storage.InitPermissions
+		if perms == nil || s.Spec.Storage.Pvc == nil {
+			continue
+		}
+		name := permissionsContainerName
+		if len(containers) > 0 {
+			name = fmt.Sprintf("%s-%d", name, len(containers))
+		}
+		// changing the owner of a file requires root
+		root := int64(0)
+		_, shareMount := shareVolumeAndMount(s, sharePvcName(planner, s, ownPvc))
+		containers = append(containers, corev1.Container{
+			Image:        planner.sambaImage(),
+			Name:         name,
+			Command:      permissionsCommand(sharePathOf(s), perms),
+			VolumeMounts: []corev1.VolumeMount{shareMount},
+			SecurityContext: &corev1.SecurityContext{
+				RunAsUser: &root,
+			},
+		})
+	}
+	return containers
+}
+
+const (
+	permissionsContainerName = "init-permissions"
+	defaultPermissionsMode   = "0775"
+)
+
+// permissionsCommand returns a command setting the owner and mode of dir.
+// Directories that already have the wanted owner and mode are not
+// changed, so existing volumes are left as they are.
+func permissionsCommand(
+	dir string,
+	perms *sambaoperatorv1alpha1.SmbShareInitPermissionsSpec) []string {
+	// ---
+	mode := perms.Mode
+	if mode == "" {
+		mode = defaultPermissionsMode
+	}
+	// stat reports the mode without leading zeros
+	mode = strings.TrimLeft(mode, "0")
+	if mode == "" {
+		mode = "0"
+	}
+	script := fmt.Sprintf(
+		`d=%s; owner="%d:%d"; mode="%s"; `+
+			`[ "$(stat -c %%u:%%g "$d")" = "$owner" ] || chown "$owner" "$d"; `+
+			`[ "$(stat -c %%a "$d")" = "$mode" ] || chmod "$mode" "$d"`,
+		shellQuote(dir), perms.UID, perms.GID, mode)
+	return []string{"/bin/sh", "-c", script}
+}
+
+// shareVolumesAndMounts returns the volumes and mounts for the storage of
+// each share of the server group.
+func shareVolumesAndMounts(planner *sharePlanner, ownPvc string) (
+	[]corev1.Volume, []corev1.VolumeMount) {
+	// ---
+	volumes := []corev1.Volume{}
+	mounts := []corev1.VolumeMount{}
+	shares := planner.groupShares()
+	cephSecrets := map[string]bool{}
+	for i := range shares {
+		s := &shares[i]
+		// shares of the same ceph cluster share its config
+		if secret := cephSecretOf(s); secret != "" && !cephSecrets[secret] {
+			cephSecrets[secret] = true
+			v, m := cephVolumeAndMount(secret)
+			volumes = append(volumes, v)
+			mounts = append(mounts, m)
+		}
+		if s.Spec.Storage.Pvc == nil {
+			continue
+		}
+		v, m := shareVolumeAndMount(s, sharePvcName(planner, s, ownPvc))
+		volumes = append(volumes, v)
+		mounts = append(mounts, m)
+	}
+	return volumes, mounts
+}
+
+// sharePvcName returns the name of the PVC of a share in the server group.
+// The PVC of the planner's own share is named ownPvc.
+func sharePvcName(
+	planner *sharePlanner,
+	s *sambaoperatorv1alpha1.SmbShare,
+	ownPvc string) string {
+	// ---
+	if s.Name == planner.SmbShare.Name && ownPvc != "" {
+		return ownPvc
+	}
+	return pvcName(s)
+}
+
+func shareVolumeAndMount(s *sambaoperatorv1alpha1.SmbShare, pvcName string) (
 	corev1.Volume, corev1.VolumeMount) {
 	// volume
 	pvcVolName := pvcName + "-smb"
@@ -247,8 +577,9 @@ func shareVolumeAndMount(planner *sharePlanner, pvcName string) (
 	}
 	// mount
 	mount := corev1.VolumeMount{
-		MountPath: planner.sharePath(),
+		MountPath: shareMountPathOf(s),
 		Name:      pvcVolName,
+		ReadOnly:  readOnlyMount(s),
 	}
 	return volume, mount
 }
@@ -288,10 +619,15 @@ func userConfigVolumeAndMount(planner *sharePlanner) (
 			},
 		},
 	}
+	if uss.CSIVolume != nil {
+		volume.VolumeSource = csiSecretVolumeSource(uss.CSIVolume)
+	}
 	// mount
 	mount := corev1.VolumeMount{
 		MountPath: planner.usersConfigDir(),
 		Name:      userSecretVolName,
+		// the CSI driver only mounts its volumes read-only
+		ReadOnly: uss.CSIVolume != nil,
 	}
 	return volume, mount
 }
@@ -379,6 +715,272 @@ func joinJSONFileVolumeAndMount(planner *sharePlanner, index int) (
 	return volume, mount
 }
 
+func keytabVolumeAndMount(planner *sharePlanner) (
+	corev1.Volume, corev1.VolumeMount) {
+	// volume
+	mode := int32(0400)
+	volume := corev1.Volume{
+		Name: keytabVolName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: planner.keytabSecret(),
+				Items: []corev1.KeyToPath{{
+					Key:  planner.keytabFileName(),
+					Path: planner.keytabFileName(),
+				}},
+				DefaultMode: &mode,
+			},
+		},
+	}
+	// mount
+	mount := corev1.VolumeMount{
+		MountPath: planner.keytabDir(),
+		Name:      keytabVolName,
+		ReadOnly:  true,
+	}
+	return volume, mount
+}
+
+func krb5ConfVolumeAndMount(planner *sharePlanner) (
+	corev1.Volume, corev1.VolumeMount) {
+	// volume
+	volume := corev1.Volume{
+		Name: krb5ConfVolName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: planner.krb5ConfConfigMap(),
+				},
+				Items: []corev1.KeyToPath{{
+					Key:  planner.krb5ConfFileName(),
+					Path: planner.krb5ConfFileName(),
+				}},
+			},
+		},
+	}
+	// mount
+	mount := corev1.VolumeMount{
+		MountPath: planner.krb5ConfDir(),
+		Name:      krb5ConfVolName,
+		ReadOnly:  true,
+	}
+	return volume, mount
+}
+
+const (
+	// defaultProbePeriod is the default number of seconds between two
+	// checks of the smbd probes.
+	defaultProbePeriod = int32(10)
+	// defaultProbeTimeout is the default number of seconds after which a
+	// check of the smbd probes fails.
+	defaultProbeTimeout = int32(1)
+	// defaultProbeFailureThreshold is the default number of failed checks
+	// after which the smbd liveness and readiness probes fail.
+	defaultProbeFailureThreshold = int32(3)
+	// defaultStartupFailureThreshold is the default number of failed checks
+	// after which the smbd startup probe fails. Along with the default
+	// period, smbd is given 5 minutes to start listening.
+	defaultStartupFailureThreshold = int32(30)
+)
+
+// smbdPortCheck returns the check of the smbd probes that the SMB port
+// accepts connections. The probe connects to the SMB port of the pod,
+// unless smbd only listens on some interfaces, which may not include the
+// one of the pod's address: the port is then checked on the loopback
+// interface from within the container.
+func smbdPortCheck(planner *sharePlanner) corev1.Handler {
+	if len(planner.interfaces()) > 0 {
+		return corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: []string{
+					"/bin/bash",
+					"-c",
+					fmt.Sprintf("exec 3<>/dev/tcp/127.0.0.1/%d",
+						planner.smbPort()),
+				},
+			},
+		}
+	}
+	return corev1.Handler{
+		TCPSocket: &corev1.TCPSocketAction{
+			Port: intstr.FromInt(int(planner.smbPort())),
+		},
+	}
+}
+
+// smbdProbe returns a probe with the given check and the timings of the
+// settings, or the defaults where they are unset. All timings are set so
+// that the probe matches the one read back from the API server.
+func smbdProbe(
+	handler corev1.Handler,
+	settings *sambaoperatorv1alpha1.SmbProbeSettings,
+	failureThreshold int32) *corev1.Probe {
+	// ---
+	probe := &corev1.Probe{
+		Handler:          handler,
+		PeriodSeconds:    defaultProbePeriod,
+		TimeoutSeconds:   defaultProbeTimeout,
+		SuccessThreshold: 1,
+		FailureThreshold: failureThreshold,
+	}
+	if settings == nil {
+		return probe
+	}
+	if settings.PeriodSeconds != nil {
+		probe.PeriodSeconds = *settings.PeriodSeconds
+	}
+	if settings.TimeoutSeconds != nil {
+		probe.TimeoutSeconds = *settings.TimeoutSeconds
+	}
+	if settings.FailureThreshold != nil {
+		probe.FailureThreshold = *settings.FailureThreshold
+	}
+	return probe
+}
+
+// smbdStartupProbe returns the startup probe of the smbd container. It
+// holds back the other probes until smbd accepts connections, so that a
+// slow start is not mistaken for a wedged smbd.
+func smbdStartupProbe(planner *sharePlanner) *corev1.Probe {
+	return smbdProbe(
+		smbdPortCheck(planner),
+		planner.probesSettings().Startup,
+		defaultStartupFailureThreshold)
+}
+
+// smbdLivenessProbe returns the liveness probe of the smbd container. The
+// container is restarted once smbd stops accepting connections on the SMB
+// port.
+func smbdLivenessProbe(planner *sharePlanner) *corev1.Probe {
+	return smbdProbe(
+		smbdPortCheck(planner),
+		planner.probesSettings().Liveness,
+		defaultProbeFailureThreshold)
+}
+
+// smbdReadinessProbe returns the readiness probe of the smbd container. The
+// pod is ready when smbd accepts connections and, for members of a domain,
+// when winbind can reach the domain controllers over a valid trust: clients
+// could not be authenticated otherwise. The check of the domain membership
+// is selected by the probe settings.
+func smbdReadinessProbe(planner *sharePlanner) *corev1.Probe {
+	handler := smbdPortCheck(planner)
+	if check := planner.domainCheckCommand(); check != "" {
+		handler = corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: []string{
+					"/bin/bash",
+					"-c",
+					fmt.Sprintf("exec 3<>/dev/tcp/127.0.0.1/%d && %s",
+						planner.smbPort(), check),
+				},
+			},
+		}
+	}
+	return smbdProbe(
+		handler,
+		planner.probesSettings().Readiness,
+		defaultProbeFailureThreshold)
+}
+
+// dnsTSIGKeyVolName is the name of the volume of the Secret holding the key
+// signing DNS updates.
+const dnsTSIGKeyVolName = "samba-dns-tsig-key"
+
+func dnsTSIGKeyVolumeAndMount(planner *sharePlanner) (
+	corev1.Volume, corev1.VolumeMount) {
+	// volume
+	mode := int32(0400)
+	volume := corev1.Volume{
+		Name: dnsTSIGKeyVolName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: planner.dnsTSIGKey().Secret,
+				Items: []corev1.KeyToPath{{
+					Key:  planner.dnsTSIGKeyFile(),
+					Path: planner.dnsTSIGKeyFile(),
+				}},
+				DefaultMode: &mode,
+			},
+		},
+	}
+	// mount
+	mount := corev1.VolumeMount{
+		MountPath: planner.dnsTSIGKeyDir(),
+		Name:      dnsTSIGKeyVolName,
+		ReadOnly:  true,
+	}
+	return volume, mount
+}
+
+// extraVolumePrefix prefixes the names of the volumes of extra mounts,
+// keeping them apart from the volumes of the operator.
+const extraVolumePrefix = "extra-"
+
+// customConfigVolName is the name of the volume of the ConfigMap holding a
+// custom smb.conf.
+const customConfigVolName = "custom-smb-conf"
+
+// coresVolName is the name of the volume the core dumps of the samba
+// servers are written to.
+const coresVolName = "samba-cores"
+
+// extraVolumesAndMounts returns the volumes and mounts for the ConfigMaps
+// and Secrets mounted into the samba server containers, including the
+// ConfigMap holding a custom smb.conf, and for the volume collecting the
+// core dumps of the servers.
+func extraVolumesAndMounts(planner *sharePlanner) (
+	[]corev1.Volume, []corev1.VolumeMount) {
+	// ---
+	volumes := []corev1.Volume{}
+	mounts := []corev1.VolumeMount{}
+	for _, em := range planner.extraMounts() {
+		name := extraVolumePrefix + em.Name
+		volume := corev1.Volume{Name: name}
+		if em.Secret != "" {
+			volume.Secret = &corev1.SecretVolumeSource{
+				SecretName: em.Secret,
+			}
+		} else {
+			volume.ConfigMap = &corev1.ConfigMapVolumeSource{}
+			volume.ConfigMap.Name = em.ConfigMap
+		}
+		volumes = append(volumes, volume)
+		mounts = append(mounts, corev1.VolumeMount{
+			MountPath: em.MountPath,
+			Name:      name,
+			ReadOnly:  true,
+		})
+	}
+	if c := planner.customConfig(); c != nil {
+		volume := corev1.Volume{Name: customConfigVolName}
+		volume.ConfigMap = &corev1.ConfigMapVolumeSource{}
+		volume.ConfigMap.Name = c.ConfigMap
+		volumes = append(volumes, volume)
+		mounts = append(mounts, corev1.VolumeMount{
+			MountPath: customConfigDir,
+			Name:      customConfigVolName,
+			ReadOnly:  true,
+		})
+	}
+	if planner.collectCores() {
+		size := planner.coresSizeLimit()
+		volumes = append(volumes, corev1.Volume{
+			Name: coresVolName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{
+					SizeLimit: &size,
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			MountPath: coresDir,
+			Name:      coresVolName,
+		})
+	}
+	return volumes, mounts
+}
+
 func svcWatchVolumeAndMount(dir string) (
 	corev1.Volume, corev1.VolumeMount) {
 	// volume
@@ -399,6 +1001,18 @@ func svcWatchVolumeAndMount(dir string) (
 	return volume, mount
 }
 
+// debugLevelEnv is the variable setting the debug level of the samba
+// containers.
+const debugLevelEnv = "SAMBA_DEBUG_LEVEL"
+
+// containerConfigEnv is the variable listing the container config files
+// of the samba containers.
+const containerConfigEnv = "SAMBACC_CONFIG"
+
+// krb5ConfigEnv is the variable naming the krb5.conf used by the kerberos
+// libraries.
+const krb5ConfigEnv = "KRB5_CONFIG"
+
 func defaultPodEnv(planner *sharePlanner) []corev1.EnvVar {
 	env := []corev1.EnvVar{
 		{
@@ -406,7 +1020,7 @@ func defaultPodEnv(planner *sharePlanner) []corev1.EnvVar {
 			Value: string(planner.instanceID()),
 		},
 		{
-			Name:  "SAMBACC_CONFIG",
+			Name:  containerConfigEnv,
 			Value: planner.containerConfigPath(),
 		},
 	}
@@ -415,10 +1029,27 @@ func defaultPodEnv(planner *sharePlanner) []corev1.EnvVar {
 	// debug level for all samba containers in the pod.
 	if lvl := planner.sambaContainerDebugLevel(); lvl != "" {
 		env = append(env, corev1.EnvVar{
-			Name:  "SAMBA_DEBUG_LEVEL",
+			Name:  debugLevelEnv,
 			Value: lvl,
 		})
 	}
+	if planner.krb5ConfConfigMap() != "" {
+		env = append(env, corev1.EnvVar{
+			Name:  krb5ConfigEnv,
+			Value: planner.krb5ConfPath(),
+		})
+	}
+	if planner.customConfig() != nil {
+		// a custom smb.conf can not know the paths the volumes of the
+		// shares are mounted on, but can refer to them as %$(NAME)
+		shares := planner.groupShares()
+		for i := range shares {
+			env = append(env, corev1.EnvVar{
+				Name:  sharePathEnvName(&shares[i]),
+				Value: sharePathOf(&shares[i]),
+			})
+		}
+	}
 	return env
 }
 
@@ -444,3 +1075,91 @@ func getJoinSources(planner *sharePlanner) joinSources {
 	}
 	return src
 }
+
+type joinState struct {
+	status  corev1.ConditionStatus
+	reason  string
+	message string
+}
+
+// podJoinState returns the state of the domain join performed by the join
+// container of the pod.
+func podJoinState(pod *corev1.Pod) joinState {
+	for _, cs := range pod.Status.InitContainerStatuses {
+		if cs.Name != joinContainerName {
+			continue
+		}
+		var lastFailure string
+		if t := cs.LastTerminationState.Terminated; t != nil && t.ExitCode != 0 {
+			lastFailure = terminationText(t)
+		}
+		switch {
+		case cs.State.Terminated != nil && cs.State.Terminated.ExitCode == 0:
+			return joinState{
+				status:  corev1.ConditionTrue,
+				reason:  ReasonJoined,
+				message: "Joined the domain",
+			}
+		case cs.State.Terminated != nil:
+			return joinState{
+				status:  corev1.ConditionFalse,
+				reason:  ReasonJoinFailed,
+				message: terminationText(cs.State.Terminated),
+			}
+		case cs.State.Running != nil && lastFailure != "":
+			return joinState{
+				status: corev1.ConditionUnknown,
+				reason: ReasonJoinInProgress,
+				message: fmt.Sprintf(
+					"Join in progress after %d restarts, last error: %s",
+					cs.RestartCount, lastFailure),
+			}
+		case cs.State.Running != nil:
+			return joinState{
+				status:  corev1.ConditionUnknown,
+				reason:  ReasonJoinInProgress,
+				message: "Join in progress",
+			}
+		case lastFailure != "":
+			// waiting to be restarted after a failure
+			return joinState{
+				status:  corev1.ConditionFalse,
+				reason:  ReasonJoinFailed,
+				message: lastFailure,
+			}
+		}
+	}
+	return joinState{
+		status:  corev1.ConditionUnknown,
+		reason:  ReasonJoinPending,
+		message: "Waiting for join to start",
+	}
+}
+
+// podDNSRegisterFailure returns the error of the DNS registration
+// container of the pod if it failed and has not been successfully
+// restarted, or an empty string otherwise.
+func podDNSRegisterFailure(pod *corev1.Pod) string {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name != dnsRegisterContainerName {
+			continue
+		}
+		if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+			return terminationText(t)
+		}
+		// waiting to be restarted after a failure
+		t := cs.LastTerminationState.Terminated
+		if cs.State.Waiting != nil && t != nil && t.ExitCode != 0 {
+			return terminationText(t)
+		}
+	}
+	return ""
+}
+
+func terminationText(t *corev1.ContainerStateTerminated) string {
+	msg := strings.TrimSpace(t.Message)
+	if msg == "" {
+		msg = fmt.Sprintf("exit code %d", t.ExitCode)
+	}
+	return msg
+}
@@ -0,0 +1,989 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func TestPodJoinState(t *testing.T) {
+	pod := &corev1.Pod{}
+	js := podJoinState(pod)
+	assert.Equal(t, corev1.ConditionUnknown, js.status)
+	assert.Equal(t, ReasonJoinPending, js.reason)
+
+	// join in progress after a previous failure
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+		{Name: "init"},
+		{
+			Name:         joinContainerName,
+			RestartCount: 1,
+			State: corev1.ContainerState{
+				Running: &corev1.ContainerStateRunning{},
+			},
+			LastTerminationState: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: 1,
+					Message:  "domain join failed after 5 attempts (exit code 1)\n",
+				},
+			},
+		},
+	}
+	js = podJoinState(pod)
+	assert.Equal(t, corev1.ConditionUnknown, js.status)
+	assert.Equal(t, ReasonJoinInProgress, js.reason)
+	assert.Equal(t,
+		"Join in progress after 1 restarts, last error: "+
+			"domain join failed after 5 attempts (exit code 1)",
+		js.message)
+
+	// join succeeded
+	pod.Status.InitContainerStatuses[1].State = corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{ExitCode: 0},
+	}
+	js = podJoinState(pod)
+	assert.Equal(t, corev1.ConditionTrue, js.status)
+	assert.Equal(t, ReasonJoined, js.reason)
+
+	// join failed without output
+	pod.Status.InitContainerStatuses[1].State = corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{ExitCode: 2},
+	}
+	js = podJoinState(pod)
+	assert.Equal(t, corev1.ConditionFalse, js.status)
+	assert.Equal(t, ReasonJoinFailed, js.reason)
+	assert.Equal(t, "exit code 2", js.message)
+}
+
+func TestBuildADPodSpecKeytab(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode:  "active-directory",
+			Realm: "EXAMPLE.COM",
+			Kerberos: &sambaoperatorv1alpha1.SmbSecurityKerberosSpec{
+				KeytabSecret: "mykeytab",
+			},
+		},
+	}
+	podSpec := buildADPodSpec(
+		planner, &conf.OperatorConfig{SmbdContainerName: "samba"}, "mypvc")
+
+	var vol *corev1.Volume
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == keytabVolName {
+			vol = &podSpec.Volumes[i]
+		}
+	}
+	if assert.NotNil(t, vol) && assert.NotNil(t, vol.Secret) {
+		assert.Equal(t, "mykeytab", vol.Secret.SecretName)
+		assert.Equal(t, "krb5.keytab", vol.Secret.Items[0].Key)
+	}
+	for _, ctr := range podSpec.Containers {
+		mounted := false
+		for _, m := range ctr.VolumeMounts {
+			if m.Name == keytabVolName {
+				mounted = true
+				assert.Equal(t, "/etc/samba-keytab", m.MountPath)
+			}
+		}
+		switch ctr.Name {
+		case "samba", "wb":
+			assert.True(t, mounted, ctr.Name)
+		}
+	}
+}
+
+func TestBuildADPodSpecKrb5Conf(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode:  "active-directory",
+			Realm: "EXAMPLE.COM",
+			Kerberos: &sambaoperatorv1alpha1.SmbSecurityKerberosSpec{
+				Krb5ConfConfigMap: "mykrb5",
+			},
+			DNS: &sambaoperatorv1alpha1.SmbSecurityDNSSpec{
+				Register: "cluster-ip",
+			},
+		},
+	}
+	// samba no longer generates its own krb5.conf
+	assert.Equal(t, "no", planner.realmOptions()[smbcc.CreateKrb5ConfParam])
+
+	podSpec := buildADPodSpec(
+		planner, &conf.OperatorConfig{SmbdContainerName: "samba"}, "mypvc")
+	var vol *corev1.Volume
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == krb5ConfVolName {
+			vol = &podSpec.Volumes[i]
+		}
+	}
+	if assert.NotNil(t, vol) && assert.NotNil(t, vol.ConfigMap) {
+		assert.Equal(t, "mykrb5", vol.ConfigMap.Name)
+		assert.Equal(t, "krb5.conf", vol.ConfigMap.Items[0].Key)
+	}
+	ctrs := append(podSpec.InitContainers, podSpec.Containers...)
+	for _, ctr := range ctrs {
+		if ctr.Name == "svc-watch" {
+			continue
+		}
+		mounted := false
+		for _, m := range ctr.VolumeMounts {
+			if m.Name == krb5ConfVolName {
+				mounted = true
+				assert.Equal(t, "/etc/samba-krb5", m.MountPath)
+			}
+		}
+		assert.True(t, mounted, ctr.Name)
+		assert.Equal(t, "/etc/samba-krb5/krb5.conf",
+			envValue(ctr.Env, "KRB5_CONFIG"), ctr.Name)
+	}
+
+	// without a ConfigMap samba generates the krb5.conf
+	planner.SecurityConfig.Spec.Kerberos = nil
+	_, found := planner.realmOptions()[smbcc.CreateKrb5ConfParam]
+	assert.False(t, found)
+	podSpec = buildADPodSpec(
+		planner, &conf.OperatorConfig{SmbdContainerName: "samba"}, "mypvc")
+	for _, v := range podSpec.Volumes {
+		assert.NotEqual(t, krb5ConfVolName, v.Name)
+	}
+	assert.Equal(t, "", envValue(podSpec.Containers[0].Env, "KRB5_CONFIG"))
+}
+
+func TestBuildADPodSpecClientSecurity(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	planner.ConfigState = smbcc.New()
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode:  "active-directory",
+			Realm: "EXAMPLE.COM",
+			DNS: &sambaoperatorv1alpha1.SmbSecurityDNSSpec{
+				Register: "cluster-ip",
+			},
+		},
+	}
+	// connections are signed by default
+	assert.Equal(t, "mandatory", planner.realmOptions()[smbcc.ClientSigningParam])
+
+	planner.SecurityConfig.Spec.Client = &sambaoperatorv1alpha1.SmbSecurityClientSpec{
+		Signing:        "desired",
+		Encryption:     "required",
+		MaxProtocol:    "SMB3",
+		IPCMaxProtocol: "SMB3_11",
+	}
+	_, err := planner.update()
+	assert.NoError(t, err)
+	smbConf, err := planner.ConfigState.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, smbConf, "\tclient signing = desired\n")
+	assert.Contains(t, smbConf, "\tclient smb encrypt = required\n")
+	assert.Contains(t, smbConf, "\tclient max protocol = SMB3\n")
+	assert.Contains(t, smbConf, "\tclient ipc max protocol = SMB3_11\n")
+
+	// the join and dns-register containers read the same configuration
+	podSpec := buildADPodSpec(
+		planner, &conf.OperatorConfig{SmbdContainerName: "samba"}, "mypvc")
+	containers := append(podSpec.InitContainers, podSpec.Containers...)
+	found := map[string]bool{}
+	for _, ctr := range containers {
+		if ctr.Name != joinContainerName && ctr.Name != dnsRegisterContainerName {
+			continue
+		}
+		found[ctr.Name] = true
+		assert.Contains(t, ctr.Env, corev1.EnvVar{
+			Name:  containerConfigEnv,
+			Value: planner.containerConfigPath(),
+		}, ctr.Name)
+		assert.Contains(t, mountPaths([]corev1.Container{ctr})[ctr.Name],
+			ConfigMapName, ctr.Name)
+	}
+	assert.True(t, found[joinContainerName])
+	assert.True(t, found[dnsRegisterContainerName])
+}
+
+func TestBuildADPodSpecDNSUpdate(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode:  "active-directory",
+			Realm: "EXAMPLE.COM",
+			DNS: &sambaoperatorv1alpha1.SmbSecurityDNSSpec{
+				Register:     "cluster-ip",
+				UpdateMethod: "tsig",
+				TSIGKey: &sambaoperatorv1alpha1.SmbSecurityDNSKeySpec{
+					Secret: "mykey",
+					Key:    "update.key",
+				},
+				Server: "10.0.0.53",
+			},
+		},
+	}
+	podSpec := buildADPodSpec(
+		planner, &conf.OperatorConfig{SmbdContainerName: "samba"}, "mypvc")
+
+	var vol *corev1.Volume
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == dnsTSIGKeyVolName {
+			vol = &podSpec.Volumes[i]
+		}
+	}
+	if assert.NotNil(t, vol) && assert.NotNil(t, vol.Secret) {
+		assert.Equal(t, "mykey", vol.Secret.SecretName)
+		assert.Equal(t, "update.key", vol.Secret.Items[0].Key)
+	}
+	found := false
+	for _, ctr := range podSpec.Containers {
+		mounted := false
+		for _, m := range ctr.VolumeMounts {
+			if m.Name == dnsTSIGKeyVolName {
+				mounted = true
+			}
+		}
+		// the key is only given to the container updating DNS
+		assert.Equal(t, ctr.Name == dnsRegisterContainerName, mounted, ctr.Name)
+		if ctr.Name == dnsRegisterContainerName {
+			found = true
+			assert.Contains(t, ctr.Args, "--update-method=tsig")
+			assert.Contains(t, ctr.Args,
+				"--tsig-key=/etc/samba-dns-key/update.key")
+			assert.Contains(t, ctr.Args, "--server=10.0.0.53")
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestBuildPodSpecHomeDirectories(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.UID = "abc123"
+	planner := testPlanner(share, nil)
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	assert.Len(t, podSpec.InitContainers, 1)
+
+	share.Spec.HomeDirectories = &sambaoperatorv1alpha1.SmbShareHomeDirectoriesSpec{}
+	podSpec = buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	if assert.Len(t, podSpec.InitContainers, 2) {
+		ctr := podSpec.InitContainers[0]
+		assert.Equal(t, "init-homes", ctr.Name)
+		assert.Equal(t,
+			[]string{"mkdir", "-p", "-m", "0755", "/mnt/abc123/homes"},
+			ctr.Command)
+		assert.Equal(t, "/mnt/abc123", ctr.VolumeMounts[0].MountPath)
+	}
+}
+
+func TestBuildPodSpecServerGroup(t *testing.T) {
+	one := &sambaoperatorv1alpha1.SmbShare{}
+	one.Name = "one"
+	one.UID = "uid1"
+	one.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{Name: "data"}
+	two := sambaoperatorv1alpha1.SmbShare{}
+	two.Name = "two"
+	two.UID = "uid2"
+	two.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{}
+	planner := testPlanner(one, nil)
+	planner.GroupShares = []sambaoperatorv1alpha1.SmbShare{*one, two}
+
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "data")
+	claims := claimVolumes(podSpec.Volumes)
+	assert.Equal(t,
+		map[string]string{"data-smb": "data", "two-pvc-smb": "two-pvc"},
+		claims)
+	mounts := map[string]string{}
+	for _, m := range podSpec.Containers[0].VolumeMounts {
+		mounts[m.Name] = m.MountPath
+	}
+	assert.Equal(t, "/mnt/uid1", mounts["data-smb"])
+	assert.Equal(t, "/mnt/uid2", mounts["two-pvc-smb"])
+}
+
+func TestBuildPodSpecDrain(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	if assert.NotNil(t, podSpec.TerminationGracePeriodSeconds) {
+		assert.Equal(t, int64(60), *podSpec.TerminationGracePeriodSeconds)
+	}
+	smbd := podSpec.Containers[0]
+	if assert.NotNil(t, smbd.Lifecycle) && assert.NotNil(t, smbd.Lifecycle.PreStop) {
+		assert.Equal(t,
+			planner.drainCommand(),
+			smbd.Lifecycle.PreStop.Exec.Command)
+	}
+
+	grace := int64(5)
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{
+		Spec: sambaoperatorv1alpha1.SmbCommonConfigSpec{
+			PodSettings: &sambaoperatorv1alpha1.SmbCommonPodSettings{
+				TerminationGracePeriodSeconds: &grace,
+			},
+		},
+	}
+	podSpec = buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	assert.Equal(t, int64(5), *podSpec.TerminationGracePeriodSeconds)
+}
+
+func TestBuildPodSpecSELinux(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	assert.Nil(t, podSpec.SecurityContext)
+
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{
+		Spec: sambaoperatorv1alpha1.SmbCommonConfigSpec{
+			PodSettings: &sambaoperatorv1alpha1.SmbCommonPodSettings{
+				SELinuxOptions: &sambaoperatorv1alpha1.SmbSELinuxOptions{
+					Type:  "spc_t",
+					Level: "s0:c123,c456",
+				},
+			},
+		},
+	}
+	podSpec = buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	if assert.NotNil(t, podSpec.SecurityContext) {
+		assert.Equal(t,
+			&corev1.SELinuxOptions{Type: "spc_t", Level: "s0:c123,c456"},
+			podSpec.SecurityContext.SELinuxOptions)
+		assert.Nil(t, podSpec.SecurityContext.RunAsUser)
+	}
+
+	// an empty context uses the runtime's defaults
+	planner.CommonConfig.Spec.PodSettings.SELinuxOptions =
+		&sambaoperatorv1alpha1.SmbSELinuxOptions{}
+	podSpec = buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	assert.Nil(t, podSpec.SecurityContext)
+}
+
+func TestBuildPodSpecInitPermissions(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.UID = "abc123"
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{}
+	planner := testPlanner(share, nil)
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	for _, c := range podSpec.InitContainers {
+		assert.NotEqual(t, "init-permissions", c.Name)
+	}
+
+	share.Spec.Storage.InitPermissions =
+		&sambaoperatorv1alpha1.SmbShareInitPermissionsSpec{
+			UID: 1000,
+			GID: 2000,
+		}
+	podSpec = buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	var perms *corev1.Container
+	for i := range podSpec.InitContainers {
+		if podSpec.InitContainers[i].Name == "init-permissions" {
+			perms = &podSpec.InitContainers[i]
+		}
+	}
+	if assert.NotNil(t, perms) {
+		assert.Equal(t,
+			[]string{
+				"/bin/sh",
+				"-c",
+				`d='/mnt/abc123'; owner="1000:2000"; mode="775"; ` +
+					`[ "$(stat -c %u:%g "$d")" = "$owner" ] || chown "$owner" "$d"; ` +
+					`[ "$(stat -c %a "$d")" = "$mode" ] || chmod "$mode" "$d"`,
+			},
+			perms.Command)
+		assert.Equal(t, "/mnt/abc123", perms.VolumeMounts[0].MountPath)
+		assert.Equal(t, int64(0), *perms.SecurityContext.RunAsUser)
+	}
+
+	share.Spec.Storage.InitPermissions.Mode = "02770"
+	assert.Contains(t,
+		permissionsCommand("/mnt/abc123", share.Spec.Storage.InitPermissions)[2],
+		`mode="2770"`)
+}
+
+func TestPermissionsCommandQuoting(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+	root, err := ioutil.TempDir("", "permissions")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	marker := filepath.Join(root, "pwned")
+	dir := "/mnt/abc123/x$(touch " + marker + ")`touch " + marker +
+		"`\"; touch " + marker + "; \"'"
+	cmd := permissionsCommand(
+		dir, &sambaoperatorv1alpha1.SmbShareInitPermissionsSpec{})
+	// report the directory given to chown and chmod instead of running
+	// them
+	script := `stat() { :; }; ` +
+		`chown() { printf '%s\n' "$2"; }; ` +
+		`chmod() { printf '%s\n' "$2"; }; ` + cmd[2]
+	out, err := exec.Command(cmd[0], cmd[1], script).Output()
+	require.NoError(t, err)
+	assert.Equal(t, dir+"\n"+dir+"\n", string(out))
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBuildPodSpecSharePath(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.UID = "abc123"
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{}
+	planner := testPlanner(share, nil)
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	for _, c := range podSpec.InitContainers {
+		assert.NotEqual(t, "init-path", c.Name)
+	}
+
+	share.Spec.Storage.Path = "projects/2026"
+	share.Spec.Storage.InitPermissions =
+		&sambaoperatorv1alpha1.SmbShareInitPermissionsSpec{UID: 1000, GID: 2000}
+	podSpec = buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	names := []string{}
+	for _, c := range podSpec.InitContainers {
+		names = append(names, c.Name)
+	}
+	// the directory is created before its permissions are set
+	require.Equal(t,
+		[]string{"init-path", "init-permissions", "check-config"}, names)
+	ctr := podSpec.InitContainers[0]
+	assert.Equal(t, "/mnt/abc123", ctr.VolumeMounts[0].MountPath)
+	assert.Equal(t, int64(0), *ctr.SecurityContext.RunAsUser)
+	assert.Contains(t, ctr.Command[2], `owner="1000:2000"`)
+	assert.Contains(t, podSpec.InitContainers[1].Command[2],
+		`d='/mnt/abc123/projects/2026'`)
+	mounts := map[string]bool{}
+	for _, m := range podSpec.Containers[0].VolumeMounts {
+		mounts[m.MountPath] = true
+	}
+	assert.True(t, mounts["/mnt/abc123"])
+}
+
+func TestPathCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+	root, err := ioutil.TempDir("", "sharepath")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	require.NoError(t, os.Chmod(root, 0750))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "a"), 0700))
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(root, "a", "keep"), []byte("data"), 0600))
+
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.UID = "abc123"
+	share.Spec.Storage.Path = "a/it's here/c"
+	run := func() {
+		cmd := pathCommand(share)
+		script := strings.Replace(cmd[2], "'/mnt/abc123'", shellQuote(root), 1)
+		out, err := exec.Command(cmd[0], cmd[1], script).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	run()
+	mode := func(p string) os.FileMode {
+		fi, err := os.Stat(filepath.Join(root, p))
+		require.NoError(t, err)
+		return fi.Mode().Perm()
+	}
+	// existing directories are left alone, new ones take the mode of the
+	// volume
+	assert.Equal(t, os.FileMode(0700), mode("a"))
+	assert.Equal(t, os.FileMode(0750), mode("a/it's here"))
+	assert.Equal(t, os.FileMode(0750), mode("a/it's here/c"))
+
+	// running again changes nothing
+	share.Spec.DirectoryMask = "0755"
+	run()
+	assert.Equal(t, os.FileMode(0750), mode("a/it's here/c"))
+	data, err := ioutil.ReadFile(filepath.Join(root, "a", "keep"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	share.Spec.Storage.Path = "a/d"
+	run()
+	assert.Equal(t, os.FileMode(0755), mode("a/d"))
+}
+
+func TestBuildPodSpecSmbPort(t *testing.T) {
+	port := int32(4450)
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Port = &port
+	planner := testPlanner(share, nil)
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	smbd := podSpec.Containers[0]
+	assert.Equal(t, int32(4450), smbd.Ports[0].ContainerPort)
+	assert.Equal(t, 4450, smbd.LivenessProbe.TCPSocket.Port.IntValue())
+}
+
+func TestBuildPodSpecProbes(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	smbd := podSpec.Containers[0]
+	for _, probe := range []*corev1.Probe{
+		smbd.StartupProbe, smbd.LivenessProbe, smbd.ReadinessProbe} {
+		// ---
+		if assert.NotNil(t, probe) && assert.NotNil(t, probe.TCPSocket) {
+			assert.Equal(t, 445, probe.TCPSocket.Port.IntValue())
+			assert.Equal(t, int32(10), probe.PeriodSeconds)
+		}
+	}
+	assert.Equal(t, int32(30), smbd.StartupProbe.FailureThreshold)
+	assert.Equal(t, int32(3), smbd.LivenessProbe.FailureThreshold)
+	assert.Equal(t, int32(3), smbd.ReadinessProbe.FailureThreshold)
+
+	// domain members are ready once the trust is verified
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{}
+	planner.SecurityConfig.Spec.Mode = string(adMode)
+	planner.SecurityConfig.Spec.Realm = "domain1.sink.test"
+	podSpec = buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	smbd = podSpec.Containers[0]
+	assert.NotNil(t, smbd.LivenessProbe.TCPSocket)
+	if assert.NotNil(t, smbd.ReadinessProbe.Exec) {
+		assert.Contains(t, smbd.ReadinessProbe.Exec.Command,
+			"exec 3<>/dev/tcp/127.0.0.1/445 && wbinfo -t")
+	}
+
+	// the timings are configurable and changing them rolls the pods
+	current := buildDeployment(
+		&conf.OperatorConfig{}, planner, "mypvc", "default")
+	period, failures := int32(5), int32(60)
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		Probes: &sambaoperatorv1alpha1.SmbProbesSettings{
+			Startup:   &sambaoperatorv1alpha1.SmbProbeSettings{FailureThreshold: &failures},
+			Readiness: &sambaoperatorv1alpha1.SmbProbeSettings{PeriodSeconds: &period},
+		},
+	}
+	desired := buildDeployment(
+		&conf.OperatorConfig{}, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	smbd = current.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, int32(60), smbd.StartupProbe.FailureThreshold)
+	assert.Equal(t, int32(10), smbd.StartupProbe.PeriodSeconds)
+	assert.Equal(t, int32(5), smbd.ReadinessProbe.PeriodSeconds)
+	assert.Equal(t, int32(10), smbd.LivenessProbe.PeriodSeconds)
+	assert.False(t, updatePodTemplateSettings(current, desired))
+}
+
+func TestSmbdReadinessProbeDomainCheck(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	standalone := smbdReadinessProbe(planner)
+	assert.NotNil(t, standalone.TCPSocket)
+
+	// the readiness of domain members differs from standalone servers
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{}
+	planner.SecurityConfig.Spec.Mode = string(adMode)
+	planner.SecurityConfig.Spec.Realm = "domain1.sink.test"
+	member := smbdReadinessProbe(planner)
+	assert.NotEqual(t, standalone.Handler, member.Handler)
+	if assert.NotNil(t, member.Exec) {
+		assert.Equal(t, []string{
+			"/bin/bash",
+			"-c",
+			"exec 3<>/dev/tcp/127.0.0.1/445 && wbinfo -t",
+		}, member.Exec.Command)
+	}
+
+	probes := &sambaoperatorv1alpha1.SmbProbesSettings{DomainCheck: "ping-dc"}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		Probes: probes,
+	}
+	member = smbdReadinessProbe(planner)
+	if assert.NotNil(t, member.Exec) {
+		assert.Contains(t, member.Exec.Command,
+			"exec 3<>/dev/tcp/127.0.0.1/445 && wbinfo --ping-dc")
+	}
+
+	// without a check the members are ready when smbd listens
+	probes.DomainCheck = "none"
+	assert.Equal(t, standalone, smbdReadinessProbe(planner))
+}
+
+func TestBuildPodSpecInterfaces(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Interfaces = []string{"net1"}
+	planner := testPlanner(share, nil)
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+	// the pod address may not be listened on
+	probe := podSpec.Containers[0].LivenessProbe
+	assert.Nil(t, probe.TCPSocket)
+	if assert.NotNil(t, probe.Exec) {
+		assert.Contains(t,
+			probe.Exec.Command, "exec 3<>/dev/tcp/127.0.0.1/445")
+	}
+
+	current := buildDeployment(
+		&conf.OperatorConfig{}, planner, "mypvc", "default")
+	share.Spec.Interfaces = nil
+	desired := buildDeployment(
+		&conf.OperatorConfig{}, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	probe = current.Spec.Template.Spec.Containers[0].LivenessProbe
+	assert.Nil(t, probe.Exec)
+	assert.NotNil(t, probe.TCPSocket)
+	assert.False(t, updatePodTemplateSettings(current, desired))
+}
+
+func TestBuildPodSpecExtraMounts(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		ExtraMounts: []sambaoperatorv1alpha1.SmbExtraMount{
+			{Name: "scripts", MountPath: "/opt/scripts", ConfigMap: "scripts"},
+			{Name: "certs", MountPath: "/etc/certs", Secret: "certs"},
+		},
+	}
+	planner := testPlanner(share, common)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	podSpec := buildPodSpec(planner, cfg, "mypvc")
+
+	volumes := map[string]corev1.Volume{}
+	for _, v := range podSpec.Volumes {
+		volumes[v.Name] = v
+	}
+	if v, ok := volumes["extra-scripts"]; assert.True(t, ok) &&
+		assert.NotNil(t, v.ConfigMap) {
+		// ---
+		assert.Equal(t, "scripts", v.ConfigMap.Name)
+	}
+	if v, ok := volumes["extra-certs"]; assert.True(t, ok) &&
+		assert.NotNil(t, v.Secret) {
+		// ---
+		assert.Equal(t, "certs", v.Secret.SecretName)
+	}
+	mounts := map[string]corev1.VolumeMount{}
+	for _, m := range podSpec.Containers[0].VolumeMounts {
+		mounts[m.Name] = m
+	}
+	assert.Equal(t, "/opt/scripts", mounts["extra-scripts"].MountPath)
+	assert.True(t, mounts["extra-scripts"].ReadOnly)
+	assert.Equal(t, "/etc/certs", mounts["extra-certs"].MountPath)
+
+	// in active directory mode, winbind is given the mounts as well
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode:  "active-directory",
+			Realm: "EXAMPLE.COM",
+		},
+	}
+	podSpec = buildPodSpec(planner, cfg, "mypvc")
+	for _, ctr := range podSpec.Containers {
+		mounted := false
+		for _, m := range ctr.VolumeMounts {
+			if m.Name == "extra-scripts" {
+				mounted = true
+			}
+		}
+		assert.Equal(t, ctr.Name == "samba" || ctr.Name == "wb", mounted, ctr.Name)
+	}
+}
+
+func TestBuildPodSpecCustomConfig(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "team-data"
+	share.UID = "1234"
+	share.Spec.Storage.Path = "projects"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	podSpec := buildPodSpec(planner, cfg, "mypvc")
+	for _, v := range podSpec.Volumes {
+		assert.NotEqual(t, customConfigVolName, v.Name)
+	}
+
+	common.Spec.CustomConfig = &sambaoperatorv1alpha1.SmbCustomConfig{
+		ConfigMap: "my-smb-conf",
+	}
+	podSpec = buildPodSpec(planner, cfg, "mypvc")
+	var volume *corev1.Volume
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == customConfigVolName {
+			volume = &podSpec.Volumes[i]
+		}
+	}
+	if assert.NotNil(t, volume) && assert.NotNil(t, volume.ConfigMap) {
+		assert.Equal(t, "my-smb-conf", volume.ConfigMap.Name)
+	}
+	ctr := podSpec.Containers[0]
+	mounted := false
+	for _, m := range ctr.VolumeMounts {
+		if m.Name == customConfigVolName {
+			mounted = true
+			assert.Equal(t, "/etc/samba/custom", m.MountPath)
+			assert.True(t, m.ReadOnly)
+		}
+	}
+	assert.True(t, mounted)
+	// the custom smb.conf finds the share's directory in the environment
+	assert.Contains(t, ctr.Env, corev1.EnvVar{
+		Name:  "SAMBA_SHARE_PATH_TEAM_DATA",
+		Value: "/mnt/1234/projects",
+	})
+}
+
+func TestBuildPodSpecCollectCores(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	podSpec := buildPodSpec(planner, cfg, "mypvc")
+	for _, v := range podSpec.Volumes {
+		assert.NotEqual(t, coresVolName, v.Name)
+	}
+	assert.Equal(t, "", envValue(podSpec.Containers[0].Env, "SAMBA_DEBUG_LEVEL"))
+
+	limit := resource.MustParse("5Gi")
+	common.Spec.Debug = &sambaoperatorv1alpha1.SmbDebugSpec{
+		LogLevel:       "5",
+		CollectCores:   true,
+		CoresSizeLimit: &limit,
+	}
+	podSpec = buildPodSpec(planner, cfg, "mypvc")
+	var volume *corev1.Volume
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == coresVolName {
+			volume = &podSpec.Volumes[i]
+		}
+	}
+	if assert.NotNil(t, volume) && assert.NotNil(t, volume.EmptyDir) {
+		assert.Equal(t, "5Gi", volume.EmptyDir.SizeLimit.String())
+	}
+	ctr := podSpec.Containers[0]
+	assert.Contains(t, ctr.VolumeMounts, corev1.VolumeMount{
+		Name:      coresVolName,
+		MountPath: "/var/log/samba/cores",
+	})
+	assert.Equal(t, "5", envValue(ctr.Env, "SAMBA_DEBUG_LEVEL"))
+
+	// the size of the volume defaults to 1Gi
+	common.Spec.Debug.CoresSizeLimit = nil
+	podSpec = buildPodSpec(planner, cfg, "mypvc")
+	assert.Equal(t,
+		"emptydir/1Gi",
+		extraVolumes(podSpec.Volumes)[coresVolName])
+}
+
+func TestBuildPodSpecSpreadReplicas(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{Name: "data"}
+	planner := testPlanner(share, nil)
+	labels := labelsForSmbServer(planner.instanceName())
+
+	// a single replica has nothing to spread
+	podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "data")
+	assert.Nil(t, podSpec.Affinity)
+	assert.Len(t, podSpec.TopologySpreadConstraints, 0)
+	assert.Equal(t, spreadNode, planner.spreadReplicas())
+
+	// three replicas prefer different nodes by default
+	affinity := withReplicaAntiAffinity(nil, spreadNode, 3, labels)
+	if assert.NotNil(t, affinity.PodAntiAffinity) {
+		terms := affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+		if assert.Len(t, terms, 1) {
+			assert.Equal(t, corev1.LabelHostname, terms[0].PodAffinityTerm.TopologyKey)
+			assert.Equal(t, labels, terms[0].PodAffinityTerm.LabelSelector.MatchLabels)
+		}
+	}
+	assert.Len(t, replicaSpreadConstraints(spreadNode, 3, labels), 0)
+
+	// and are spread across zones when asked to
+	constraints := replicaSpreadConstraints(spreadZone, 3, labels)
+	if assert.Len(t, constraints, 1) {
+		assert.Equal(t, corev1.LabelZoneFailureDomainStable, constraints[0].TopologyKey)
+		assert.Equal(t, corev1.ScheduleAnyway, constraints[0].WhenUnsatisfiable)
+		assert.Equal(t, int32(1), constraints[0].MaxSkew)
+	}
+	assert.NotNil(t, withReplicaAntiAffinity(nil, spreadZone, 3, labels))
+	assert.Nil(t, withReplicaAntiAffinity(nil, spreadOff, 3, labels))
+	assert.Len(t, replicaSpreadConstraints(spreadOff, 3, labels), 0)
+
+	// an anti-affinity of the pod settings is kept as is
+	own := &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{}}
+	assert.Equal(t, own, withReplicaAntiAffinity(own, spreadNode, 3, labels))
+
+	// constraints of the share override those of the common config
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{}
+	common.Spec.PodSettings.SpreadReplicas = "zone"
+	common.Spec.PodSettings.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{{
+		MaxSkew:           2,
+		TopologyKey:       "rack",
+		WhenUnsatisfiable: corev1.DoNotSchedule,
+	}}
+	planner = testPlanner(share, common)
+	assert.Equal(t, spreadZone, planner.spreadReplicas())
+	podSpec = buildPodSpec(planner, &conf.OperatorConfig{}, "data")
+	if assert.Len(t, podSpec.TopologySpreadConstraints, 1) {
+		assert.Equal(t, "rack", podSpec.TopologySpreadConstraints[0].TopologyKey)
+	}
+	share.Spec.PodSettings = &sambaoperatorv1alpha1.SmbSharePodSettings{}
+	share.Spec.PodSettings.SpreadReplicas = "off"
+	share.Spec.PodSettings.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{{
+		MaxSkew:     1,
+		TopologyKey: corev1.LabelHostname,
+	}}
+	assert.Equal(t, spreadOff, planner.spreadReplicas())
+	assert.Equal(t, corev1.LabelHostname,
+		planner.topologySpreadConstraints()[0].TopologyKey)
+}
+
+func TestBuildPodSpecReadOnlyMount(t *testing.T) {
+	share := pvcShare("", nil)
+	share.UID = "abc123"
+	share.Spec.Storage.Pvc.Name = "replica"
+	planner := testPlanner(share, nil)
+	readOnly := func() map[string]bool {
+		podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "replica")
+		mounts := map[string]bool{}
+		for _, c := range append(podSpec.InitContainers, podSpec.Containers...) {
+			for _, m := range c.VolumeMounts {
+				if m.MountPath == "/mnt/abc123" {
+					mounts[c.Name] = m.ReadOnly
+				}
+			}
+		}
+		return mounts
+	}
+	assert.False(t, readOnly()["samba"])
+	assert.Equal(t, smbcc.No, planner.shareOptions()[smbcc.ReadOnlyParam])
+
+	share.Spec.Storage.Pvc.ReadOnlyMount = true
+	mounts := readOnly()
+	require.NotEmpty(t, mounts)
+	for name, ro := range mounts {
+		assert.True(t, ro, name)
+	}
+	// the share is read-only for clients too
+	assert.Equal(t, smbcc.Yes, planner.shareOptions()[smbcc.ReadOnlyParam])
+}
+
+func TestBuildPodSpecReadOnlyRootFilesystem(t *testing.T) {
+	cfg := &conf.OperatorConfig{
+		SmbdContainerName:      "samba",
+		SmbdContainerImage:     "samba-server",
+		SvcWatchContainerImage: "svcwatch",
+		MetricsContainerImage:  "samba-metrics",
+	}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	planner := testPlanner(share, common)
+	planner.GlobalConfig = cfg
+	podSpec := buildPodSpec(planner, cfg, "mypvc")
+	for _, ctr := range append(podSpec.InitContainers, podSpec.Containers...) {
+		assert.NotEqual(t, accountsInitContainerName, ctr.Name)
+		if sc := ctr.SecurityContext; sc != nil {
+			assert.Nil(t, sc.ReadOnlyRootFilesystem, ctr.Name)
+		}
+	}
+
+	check := func(podSpec corev1.PodSpec) {
+		t.Helper()
+		volumes := map[string]*corev1.Volume{}
+		for i := range podSpec.Volumes {
+			v := &podSpec.Volumes[i]
+			assert.Nil(t, volumes[v.Name], "volume %s added twice", v.Name)
+			volumes[v.Name] = v
+		}
+		if assert.NotEmpty(t, podSpec.InitContainers) {
+			accounts := podSpec.InitContainers[0]
+			assert.Equal(t, accountsInitContainerName, accounts.Name)
+			assert.Equal(t,
+				[]string{"cp", "/etc/passwd", "/etc/group", accountsDir},
+				accounts.Command)
+		}
+		for _, ctr := range append(podSpec.InitContainers, podSpec.Containers...) {
+			if assert.NotNil(t, ctr.SecurityContext, ctr.Name) &&
+				assert.NotNil(t, ctr.SecurityContext.ReadOnlyRootFilesystem, ctr.Name) {
+				// ---
+				assert.True(t, *ctr.SecurityContext.ReadOnlyRootFilesystem, ctr.Name)
+			}
+			if ctr.Image == "svcwatch" {
+				continue
+			}
+			mounts := map[string]corev1.VolumeMount{}
+			for _, m := range ctr.VolumeMounts {
+				_, found := mounts[m.MountPath]
+				assert.False(t, found, "%s mounted twice in %s", m.MountPath, ctr.Name)
+				mounts[m.MountPath] = m
+			}
+			for _, p := range []string{
+				"/etc/samba", "/run", "/tmp", "/var/cache/samba",
+				"/var/lib/samba", "/var/log/samba", "/var/tmp",
+			} {
+				m, found := mounts[p]
+				if assert.True(t, found, "%s not mounted in %s", p, ctr.Name) &&
+					assert.NotNil(t, volumes[m.Name], m.Name) {
+					// ---
+					assert.NotNil(t, volumes[m.Name].EmptyDir, m.Name)
+					assert.False(t, m.ReadOnly)
+				}
+			}
+			if ctr.Name == accountsInitContainerName {
+				continue
+			}
+			for _, f := range []string{"/etc/passwd", "/etc/group"} {
+				m, found := mounts[f]
+				if assert.True(t, found, "%s not mounted in %s", f, ctr.Name) {
+					assert.Equal(t, accountsVolName, m.Name)
+					assert.Equal(t, f[len("/etc/"):], m.SubPath)
+				}
+			}
+		}
+	}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		ReadOnlyRootFilesystem: true,
+	}
+	common.Spec.Metrics = &sambaoperatorv1alpha1.SmbMetricsSpec{}
+	check(buildPodSpec(planner, cfg, "mypvc"))
+
+	// domain members run winbind, join the domain and register in DNS
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode:  "active-directory",
+			Realm: "EXAMPLE.COM",
+			DNS: &sambaoperatorv1alpha1.SmbSecurityDNSSpec{
+				Register: "cluster-ip",
+			},
+		},
+	}
+	podSpec = buildPodSpec(planner, cfg, "mypvc")
+	names := []string{}
+	for _, ctr := range podSpec.Containers {
+		names = append(names, ctr.Name)
+	}
+	assert.Contains(t, names, winbindContainerName)
+	assert.Contains(t, names, "svc-watch")
+	check(podSpec)
+}
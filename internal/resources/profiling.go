@@ -0,0 +1,164 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// profilingKey is the key of the globals section turning on the profiling
+// of smbd.
+const profilingKey = smbcc.Key("profiling")
+
+// profiling returns true if the common config turns on the profiling of
+// the samba servers.
+func (sp *sharePlanner) profiling() bool {
+	return sp.CommonConfig != nil && sp.CommonConfig.Spec.Profiling
+}
+
+// ProfileReader reads the profiling counters of the samba servers of pods.
+type ProfileReader interface {
+	// Profile returns the profiling counters of the samba server running
+	// in the given container of the pod.
+	Profile(
+		ctx context.Context,
+		pod *corev1.Pod,
+		container string) (map[string]int64, error)
+}
+
+// smbstatusProfiles reads profiling counters by running smbstatus in the
+// samba container of the pods.
+type smbstatusProfiles struct {
+	client kubernetes.Interface
+	config *rest.Config
+}
+
+// NewSmbstatusProfiles returns a ProfileReader running smbstatus in the
+// pods, through the API server's pod exec subresource.
+func NewSmbstatusProfiles(
+	client kubernetes.Interface, config *rest.Config) ProfileReader {
+	// ---
+	return &smbstatusProfiles{client: client, config: config}
+}
+
+// Profile implements ProfileReader.
+func (p *smbstatusProfiles) Profile(
+	ctx context.Context,
+	pod *corev1.Pod,
+	container string) (map[string]int64, error) {
+	// ---
+	out, err := podExec(
+		p.client, p.config, pod, container, "smbstatus", "--profile")
+	if err != nil {
+		return nil, err
+	}
+	return countersFromSmbstatus(out), nil
+}
+
+// countersFromSmbstatus returns the non-zero counters listed in the output
+// of smbstatus --profile, as "name: value" lines between section headers.
+func countersFromSmbstatus(out string) map[string]int64 {
+	counters := map[string]int64{}
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		v, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if name == "" || strings.ContainsAny(name, " *") || err != nil || v == 0 {
+			continue
+		}
+		counters[name] = v
+	}
+	return counters
+}
+
+// readProfiles sums the profiling counters of the ready pods serving the
+// share. Pods that can not be queried are skipped; nil is returned if no
+// pod could be queried.
+func (m *SmbShareManager) readProfiles(
+	ctx context.Context, planner *sharePlanner, ns string) (
+	map[string]int64, error) {
+	// ---
+	pods := &corev1.PodList{}
+	err := m.client.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{
+			svcSelectorKey: labelValue(planner.instanceName()),
+		})
+	if err != nil {
+		m.logger.Error(err, "Failed to list pods", "namespace", ns)
+		return nil, err
+	}
+	var counters map[string]int64
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || !podReady(pod) {
+			continue
+		}
+		c, err := m.profiles.Profile(ctx, pod, m.cfg.SmbdContainerName)
+		if err != nil {
+			// the counters are reported from the pods that could be read
+			m.logger.Error(err, "Failed to read profiling counters",
+				"Pod.Namespace", ns, "Pod.Name", pod.Name)
+			continue
+		}
+		if counters == nil {
+			counters = map[string]int64{}
+		}
+		for name, v := range c {
+			counters[name] += v
+		}
+	}
+	return counters, nil
+}
+
+// updateProfileStatus records the profiling counters of the pods serving
+// the share in the status of the SmbShare, and clears them once profiling
+// is turned off. They are read as often as the connections are counted.
+// Returns true if the status was changed.
+func (m *SmbShareManager) updateProfileStatus(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	var counters map[string]int64
+	if planner.profiling() {
+		if m.profiles == nil || m.cfg.ConnectionsCheckInterval == 0 {
+			return false, nil
+		}
+		var err error
+		counters, err = m.readProfiles(ctx, planner, ns)
+		if err != nil {
+			return false, err
+		}
+	}
+	if reflect.DeepEqual(s.Status.ProfileCounters, counters) {
+		return false, nil
+	}
+	s.Status.ProfileCounters = counters
+	return true, m.client.Status().Update(ctx, s)
+}
@@ -0,0 +1,141 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func TestPlannerProfiling(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	planner.ConfigState = smbcc.New()
+	_, err := planner.update()
+	assert.NoError(t, err)
+	assert.NotContains(t,
+		planner.ConfigState.Configs["myshare"].Globals, profilingKey)
+
+	common.Spec.Profiling = true
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t,
+		planner.ConfigState.Configs["myshare"].Globals, profilingKey)
+	conf, err := planner.ConfigState.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tsmbd profiling = on\n")
+}
+
+const smbstatusProfile = `smb_count:                              1043
+smb_num_elements:                       0
+**** System Calls **************************************************************
+syscall_opendir_count:                  12
+syscall_opendir_time:                   340
+syscall_fdopendir_count:                0
+**** SMB2 Calls ****************************************************************
+smb2_negprot_count:                     3
+smb2_negprot_idle:                      0
+`
+
+func TestCountersFromSmbstatus(t *testing.T) {
+	assert.Equal(t,
+		map[string]int64{
+			"smb_count":             1043,
+			"syscall_opendir_count": 12,
+			"syscall_opendir_time":  340,
+			"smb2_negprot_count":    3,
+		},
+		countersFromSmbstatus(smbstatusProfile))
+	assert.Empty(t, countersFromSmbstatus(""))
+}
+
+type fakeProfiles struct {
+	counters map[string]map[string]int64
+}
+
+func (f *fakeProfiles) Profile(
+	_ context.Context, pod *corev1.Pod, _ string) (map[string]int64, error) {
+	// ---
+	c, found := f.counters[pod.Name]
+	if !found {
+		return nil, fmt.Errorf("pod %s not reachable", pod.Name)
+	}
+	return c, nil
+}
+
+func TestUpdateProfileStatus(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.Profiling = true
+	planner := testPlanner(share, common)
+	pod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{svcSelectorKey: "myshare"},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				Conditions: []corev1.PodCondition{{
+					Type:   corev1.PodReady,
+					Status: corev1.ConditionTrue,
+				}},
+			},
+		}
+	}
+	m, _ := newTestManager(share, pod("myshare-a"), pod("myshare-b"))
+	m.cfg.ConnectionsCheckInterval = time.Minute
+	ctx := context.TODO()
+
+	// nothing is reported without a reader
+	changed, err := m.updateProfileStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	m.SetProfileReader(&fakeProfiles{counters: map[string]map[string]int64{
+		"myshare-a": {"smb_count": 10, "syscall_opendir_count": 2},
+		"myshare-b": {"smb_count": 5},
+	}})
+	changed, err = m.updateProfileStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t,
+		map[string]int64{"smb_count": 15, "syscall_opendir_count": 2},
+		share.Status.ProfileCounters)
+	changed, err = m.updateProfileStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// the counters are cleared once profiling is off
+	common.Spec.Profiling = false
+	changed, err = m.updateProfileStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Nil(t, share.Status.ProfileCounters)
+}
@@ -0,0 +1,109 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// quotaCheckInterval is how often the usage of a share with an active
+// quota is measured.
+const quotaCheckInterval = time.Minute
+
+// VolumeUsageGetter measures the space used on the volumes of pods.
+type VolumeUsageGetter interface {
+	// VolumeUsage returns the number of bytes used on the volume of the
+	// pod that is backed by the named PVC. False is returned if the usage
+	// of the volume is not known.
+	VolumeUsage(
+		ctx context.Context, pod *corev1.Pod, claimName string) (int64, bool, error)
+}
+
+// kubeletVolumeUsage gets volume usage from the stats summary published by
+// the kubelet of a pod's node.
+type kubeletVolumeUsage struct {
+	client kubernetes.Interface
+}
+
+// NewKubeletVolumeUsage returns a VolumeUsageGetter reading the stats
+// summary of the kubelets through the API server's node proxy.
+func NewKubeletVolumeUsage(client kubernetes.Interface) VolumeUsageGetter {
+	return &kubeletVolumeUsage{client: client}
+}
+
+// VolumeUsage implements VolumeUsageGetter.
+func (k *kubeletVolumeUsage) VolumeUsage(
+	ctx context.Context, pod *corev1.Pod, claimName string) (int64, bool, error) {
+	// ---
+	if pod.Spec.NodeName == "" {
+		return 0, false, nil
+	}
+	data, err := k.client.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		Name(pod.Spec.NodeName).
+		SubResource("proxy", "stats", "summary").
+		DoRaw(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	return volumeUsageFromSummary(data, pod, claimName)
+}
+
+// statsSummary holds the parts of the kubelet stats summary needed to find
+// the usage of PVC backed volumes.
+type statsSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Volumes []struct {
+			UsedBytes *int64 `json:"usedBytes"`
+			PVCRef    *struct {
+				Name string `json:"name"`
+			} `json:"pvcRef"`
+		} `json:"volume"`
+	} `json:"pods"`
+}
+
+func volumeUsageFromSummary(
+	data []byte, pod *corev1.Pod, claimName string) (int64, bool, error) {
+	// ---
+	summary := statsSummary{}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return 0, false, err
+	}
+	for _, p := range summary.Pods {
+		if p.PodRef.Name != pod.Name || p.PodRef.Namespace != pod.Namespace {
+			continue
+		}
+		for _, v := range p.Volumes {
+			if v.PVCRef == nil || v.PVCRef.Name != claimName {
+				continue
+			}
+			if v.UsedBytes == nil {
+				return 0, false, nil
+			}
+			return *v.UsedBytes, true, nil
+		}
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,166 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+const testSummary = `{
+  "node": {"nodeName": "node1"},
+  "pods": [
+    {
+      "podRef": {"name": "other", "namespace": "default"},
+      "volume": [
+        {"name": "data", "usedBytes": 1, "pvcRef": {"name": "myshare-pvc"}}
+      ]
+    },
+    {
+      "podRef": {"name": "myshare-abc", "namespace": "default"},
+      "volume": [
+        {"name": "run", "usedBytes": 4096},
+        {"name": "data", "usedBytes": 123456, "pvcRef": {"name": "myshare-pvc"}}
+      ]
+    }
+  ]
+}`
+
+func TestVolumeUsageFromSummary(t *testing.T) {
+	pod := &corev1.Pod{}
+	pod.Name = "myshare-abc"
+	pod.Namespace = "default"
+
+	used, found, err := volumeUsageFromSummary(
+		[]byte(testSummary), pod, "myshare-pvc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.EqualValues(t, 123456, used)
+
+	_, found, err = volumeUsageFromSummary(
+		[]byte(testSummary), pod, "other-pvc")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, _, err = volumeUsageFromSummary([]byte("<html>"), pod, "myshare-pvc")
+	assert.Error(t, err)
+}
+
+type fakeVolumeUsage struct {
+	used int64
+}
+
+func (f *fakeVolumeUsage) VolumeUsage(
+	_ context.Context, _ *corev1.Pod, _ string) (int64, bool, error) {
+	// ---
+	return f.used, true, nil
+}
+
+func TestUpdateQuotaStatus(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Status.ServerGroup = "myshare"
+	share.Spec.Quota = &sambaoperatorv1alpha1.SmbShareQuotaSpec{
+		Size: resource.MustParse("1Mi"),
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myshare-abc",
+			Namespace: "default",
+			Labels:    map[string]string{svcSelectorKey: "myshare"},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	m, recorder := newTestManager(share, pod)
+	usage := &fakeVolumeUsage{used: 512 * 1024}
+	m.SetVolumeUsage(usage)
+	ctx := context.Background()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share}, smbcc.New())
+
+	// usage is reported
+	changed, err := m.updateQuotaStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "512Ki", share.Status.Quota.Used.String())
+	assert.False(t, share.Status.Quota.Exceeded)
+	assert.Len(t, recorder.Events, 0)
+
+	changed, err = m.updateQuotaStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// going over the quota is recorded once
+	usage.used = 2 * 1024 * 1024
+	changed, err = m.updateQuotaStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, share.Status.Quota.Exceeded)
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, ReasonQuotaExceeded)
+
+	usage.used++
+	changed, err = m.updateQuotaStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, recorder.Events, 0)
+
+	// disabling the quota clears the status
+	share.Spec.Quota.Disabled = true
+	changed, err = m.updateQuotaStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	stored := &sambaoperatorv1alpha1.SmbShare{}
+	err = m.client.Get(ctx, types.NamespacedName{
+		Namespace: "default", Name: "myshare"}, stored)
+	assert.NoError(t, err)
+	assert.Nil(t, stored.Status.Quota)
+}
+
+func TestValidateQuota(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	m, _ := newTestManager(share)
+	ctx := context.Background()
+
+	valid, err := m.validateQuota(ctx, share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share.Spec.Quota = &sambaoperatorv1alpha1.SmbShareQuotaSpec{
+		Size: resource.MustParse("0"),
+	}
+	valid, err = m.validateQuota(ctx, share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+
+	// a disabled quota is not checked
+	share.Spec.Quota.Disabled = true
+	valid, err = m.validateQuota(ctx, share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
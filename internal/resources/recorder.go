@@ -0,0 +1,137 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// DefaultEventInterval is the default time during which repeats of an event
+// are dropped. It matches the interval over which the event broadcaster
+// aggregates similar events.
+const DefaultEventInterval = 10 * time.Minute
+
+// eventKey identifies the events that repeat one another.
+type eventKey struct {
+	object    string
+	eventtype string
+	reason    string
+	message   string
+}
+
+// dedupRecorder is an event recorder dropping an event if the same event
+// was recorded for the same object within an interval. The event
+// broadcaster only aggregates events once they reach the API server, so
+// without it every reconcile of a stuck share sends its warnings again.
+type dedupRecorder struct {
+	record.EventRecorder
+
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	seen      map[eventKey]time.Time
+	lastPrune time.Time
+}
+
+// NewDedupRecorder returns an event recorder passing the events that were
+// not recorded for the same object, with the same type, reason and message,
+// during the last interval on to the given recorder.
+func NewDedupRecorder(
+	recorder record.EventRecorder, interval time.Duration) record.EventRecorder {
+	// ---
+	return &dedupRecorder{
+		EventRecorder: recorder,
+		interval:      interval,
+		now:           time.Now,
+		seen:          map[eventKey]time.Time{},
+	}
+}
+
+// objectKey returns the UID of the object, or its namespace and name if it
+// has none.
+func objectKey(object runtime.Object) string {
+	m, err := meta.Accessor(object)
+	if err != nil {
+		return fmt.Sprintf("%p", object)
+	}
+	if uid := m.GetUID(); uid != "" {
+		return string(uid)
+	}
+	return m.GetNamespace() + "/" + m.GetName()
+}
+
+// allow returns true if the event was not recorded during the interval,
+// and remembers it as recorded now.
+func (r *dedupRecorder) allow(key eventKey) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	if now.Sub(r.lastPrune) >= r.interval {
+		for k, t := range r.seen {
+			if now.Sub(t) >= r.interval {
+				delete(r.seen, k)
+			}
+		}
+		r.lastPrune = now
+	}
+	if t, found := r.seen[key]; found && now.Sub(t) < r.interval {
+		return false
+	}
+	r.seen[key] = now
+	return true
+}
+
+// Event records the event unless it repeats a recent one.
+func (r *dedupRecorder) Event(
+	object runtime.Object, eventtype, reason, message string) {
+	// ---
+	key := eventKey{objectKey(object), eventtype, reason, message}
+	if r.allow(key) {
+		r.EventRecorder.Event(object, eventtype, reason, message)
+	}
+}
+
+// Eventf records the formatted event unless it repeats a recent one.
+func (r *dedupRecorder) Eventf(
+	object runtime.Object,
+	eventtype, reason, messageFmt string,
+	args ...interface{}) {
+	// ---
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// AnnotatedEventf records the formatted event, with the annotations, unless
+// it repeats a recent one.
+func (r *dedupRecorder) AnnotatedEventf(
+	object runtime.Object,
+	annotations map[string]string,
+	eventtype, reason, messageFmt string,
+	args ...interface{}) {
+	// ---
+	message := fmt.Sprintf(messageFmt, args...)
+	key := eventKey{objectKey(object), eventtype, reason, message}
+	if r.allow(key) {
+		r.EventRecorder.AnnotatedEventf(
+			object, annotations, eventtype, reason, "%s", message)
+	}
+}
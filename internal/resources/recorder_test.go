@@ -0,0 +1,85 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func TestDedupRecorder(t *testing.T) {
+	share := pvcShare("fast", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	m, fake := newTestManager(share)
+	now := time.Now()
+	recorder := NewDedupRecorder(fake, time.Minute).(*dedupRecorder)
+	recorder.now = func() time.Time { return now }
+	m.recorder = recorder
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+
+	// repeated failures record a single event
+	for i := 0; i < 20; i++ {
+		valid, err := m.validateStorage(context.TODO(), planner, "default")
+		assert.NoError(t, err)
+		assert.False(t, valid)
+	}
+	if assert.Len(t, fake.Events, 1) {
+		assert.Contains(t, <-fake.Events, ReasonInvalidStorageClass)
+	}
+
+	// other events get through
+	recorder.Eventf(share, EventWarning, ReasonInvalidStorageClass, "other %d", 1)
+	recorder.Event(share, EventNormal, ReasonReconciled, "done")
+	other := share.DeepCopy()
+	other.Name = "othershare"
+	m.recorder.Event(other, EventWarning, ReasonInvalidStorageClass, "other 1")
+	assert.Len(t, fake.Events, 3)
+	for len(fake.Events) > 0 {
+		<-fake.Events
+	}
+
+	// the event is recorded again after the interval
+	now = now.Add(time.Minute)
+	_, err := m.validateStorage(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.Len(t, fake.Events, 1)
+	assert.Len(t, recorder.seen, 1)
+}
+
+func TestDedupRecorderAnnotated(t *testing.T) {
+	fake := record.NewFakeRecorder(10)
+	recorder := NewDedupRecorder(fake, time.Minute)
+	share := pvcShare("fast", &corev1.PersistentVolumeClaimSpec{})
+	share.UID = "1234"
+	for i := 0; i < 3; i++ {
+		recorder.AnnotatedEventf(share, map[string]string{"a": "b"},
+			EventWarning, ReasonInvalidStorageClass, "missing %s", "fast")
+	}
+	if assert.Len(t, fake.Events, 1) {
+		assert.Equal(t,
+			"Warning InvalidStorageClass missing fast", <-fake.Events)
+	}
+}
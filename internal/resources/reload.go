@@ -0,0 +1,265 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+const (
+	// serverConfigHashKey is the pod template annotation holding the digest
+	// of the configuration the samba servers only read as they start.
+	// Changing it rolls the pods, while the rest of the configuration is
+	// reloaded by the running servers.
+	serverConfigHashKey = "samba-operator.samba.org/server-config-hash"
+	// reloadedConfigAnnotationKey is the pod annotation holding the digest
+	// of the configuration the samba servers of the pod last reloaded.
+	reloadedConfigAnnotationKey = "samba-operator.samba.org/reloaded-config"
+)
+
+// reloadRecheck is how long to wait before reloading the configuration of
+// pods that do not see the updated config file yet, or that failed to
+// reload it.
+const reloadRecheck = 10 * time.Second
+
+// restartParams are the global smb.conf parameters that the samba servers
+// only read as they start, or that change the accounts they serve. Changing
+// any of them rolls the pods; the other parameters, including those of the
+// shares, are reloaded in place.
+var restartParams = map[string]bool{
+	"security":                             true,
+	"realm":                                true,
+	smbcc.WorkgroupParam:                   true,
+	smbcc.NetbiosNameParam:                 true,
+	smbcc.SmbPortsParam:                    true,
+	smbcc.InterfacesParam:                  true,
+	smbcc.BindInterfacesOnlyParam:          true,
+	smbcc.KerberosMethodParam:              true,
+	smbcc.DedicatedKeytabFileParam:         true,
+	smbcc.CreateKrb5ConfParam:              true,
+	smbcc.PassdbBackendParam:               true,
+	smbcc.LDAPSuffixParam:                  true,
+	smbcc.LDAPUserSuffixParam:              true,
+	smbcc.LDAPGroupSuffixParam:             true,
+	smbcc.LDAPAdminDNParam:                 true,
+	smbcc.LDAPSSLParam:                     true,
+	smbcc.WinbindUseDefaultDomainParam:     true,
+	smbcc.WinbindNSSInfoParam:              true,
+	smbcc.AllowTrustedDomainsParam:         true,
+	smbcc.WinbindScanTrustedDomainsParam:   true,
+	smbcc.WinbindRequestTimeoutParam:       true,
+	smbcc.WinbindMaxClientsParam:           true,
+	smbcc.WinbindMaxDomainConnectionsParam: true,
+	smbcc.ServerMultiChannelSupportParam:   true,
+}
+
+// needsRestart returns true if changing the global parameter requires the
+// samba servers to be restarted.
+func needsRestart(param string) bool {
+	return restartParams[param] || strings.HasPrefix(param, "idmap config ")
+}
+
+// ConfigReloader makes the samba servers of pods reload their
+// configuration.
+type ConfigReloader interface {
+	// ReloadConfig makes the samba servers of the given container of the
+	// pod reload their configuration from the config file at path, once
+	// the container sees the version of the file with the given sha256
+	// digest. False is returned, without an error, if the container does
+	// not see that version yet.
+	ReloadConfig(
+		ctx context.Context,
+		pod *corev1.Pod,
+		container, path, digest string) (bool, error)
+}
+
+// smbcontrolReloader reloads the configuration by importing the config
+// file into samba's registry and running smbcontrol in the samba container
+// of the pods.
+type smbcontrolReloader struct {
+	client kubernetes.Interface
+	config *rest.Config
+}
+
+// NewSmbcontrolReloader returns a ConfigReloader running smbcontrol in the
+// pods, through the API server's pod exec subresource.
+func NewSmbcontrolReloader(
+	client kubernetes.Interface, config *rest.Config) ConfigReloader {
+	// ---
+	return &smbcontrolReloader{client: client, config: config}
+}
+
+// reloadScript checks that the mounted config file is the expected one, as
+// the kubelet updates ConfigMap volumes some time after the ConfigMap,
+// before reloading it. Its output tells the two cases apart.
+const reloadScript = `test "$(sha256sum "$1" | cut -d" " -f1)" = "$2" || exit 0
+samba-container import && smbcontrol all reload-config && echo reloaded`
+
+// ReloadConfig implements ConfigReloader.
+func (r *smbcontrolReloader) ReloadConfig(
+	ctx context.Context,
+	pod *corev1.Pod,
+	container, path, digest string) (bool, error) {
+	// ---
+	out, err := podExec(r.client, r.config, pod, container,
+		"/bin/sh", "-c", reloadScript, "sh", path, digest)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) == "reloaded", nil
+}
+
+// SetConfigReloader sets the ConfigReloader used to apply the changes of
+// the configuration that do not require the samba servers to restart. If
+// unset, such changes only apply once the pods restart.
+func (m *SmbShareManager) SetConfigReloader(reloader ConfigReloader) {
+	m.reloader = reloader
+}
+
+// configDigest returns a digest of the JSON encoding of the values.
+func configDigest(values ...interface{}) string {
+	data, err := json.Marshal(values)
+	if err != nil {
+		// plain maps and structs always marshal
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+}
+
+// serverConfigHash returns a digest of the configuration of the server
+// group that the samba servers only read as they start: the global
+// parameters needing a restart and the users and groups of the container
+// config. It is recorded in the pod template, so that changing it rolls the
+// pods.
+func (sp *sharePlanner) serverConfigHash() string {
+	params := []string{}
+	for _, key := range sp.ConfigState.Configs[sp.instanceID()].Globals {
+		for param, value := range sp.ConfigState.Globals[key].Options {
+			if needsRestart(param) {
+				params = append(params, param+" = "+value)
+			}
+		}
+	}
+	sort.Strings(params)
+	return configDigest(params, sp.ConfigState.Users, sp.ConfigState.Groups)
+}
+
+// reloadConfigHash returns a digest of all of the configuration of the
+// server group, changing whenever its servers should reload it.
+func (sp *sharePlanner) reloadConfigHash() string {
+	section := sp.ConfigState.Configs[sp.instanceID()]
+	globals := map[smbcc.Key]smbcc.GlobalConfig{}
+	for _, key := range section.Globals {
+		globals[key] = sp.ConfigState.Globals[key]
+	}
+	shares := map[smbcc.Key]smbcc.ShareConfig{}
+	for _, key := range section.Shares {
+		shares[key] = sp.ConfigState.Shares[key]
+	}
+	return configDigest(section, globals, shares)
+}
+
+// reloadConfig makes the samba servers of the ready pods of the server
+// group reload their configuration, held in the ConfigMap, when it changed
+// without requiring a restart. The reloaded configuration is recorded in
+// an annotation of each pod. Pods started with other parameters needing a
+// restart are skipped, as they are about to be replaced. It returns true if
+// a pod still has to reload the configuration, because it does not see the
+// updated config file yet or failed to reload it.
+func (m *SmbShareManager) reloadConfig(
+	ctx context.Context,
+	planner *sharePlanner,
+	cm *corev1.ConfigMap,
+	ns string) (bool, error) {
+	// ---
+	if m.reloader == nil {
+		return false, nil
+	}
+	pods := &corev1.PodList{}
+	err := m.client.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{
+			svcSelectorKey: labelValue(planner.instanceName()),
+		})
+	if err != nil {
+		m.logger.Error(err, "Failed to list pods", "namespace", ns)
+		return false, err
+	}
+	want := planner.reloadConfigHash()
+	serverHash := planner.serverConfigHash()
+	digest := fmt.Sprintf("%x", sha256.Sum256([]byte(cm.Data[ConfigJSONKey])))
+	path := planner.containerConfigDir() + "/" + ConfigJSONKey
+	pending := false
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || !podReady(pod) ||
+			pod.Annotations[serverConfigHashKey] != serverHash ||
+			pod.Annotations[reloadedConfigAnnotationKey] == want {
+			// ---
+			continue
+		}
+		reloaded, err := m.reloader.ReloadConfig(
+			ctx, pod, m.cfg.SmbdContainerName, path, digest)
+		if err != nil {
+			m.logger.Error(err, "Failed to reload configuration",
+				"Pod.Namespace", pod.Namespace, "Pod.Name", pod.Name)
+			m.recorder.Eventf(planner.SmbShare,
+				EventWarning,
+				ReasonConfigReloadFailed,
+				"Failed to reload the configuration of pod %s: %v",
+				pod.Name, err)
+			pending = true
+			continue
+		} else if !reloaded {
+			pending = true
+			continue
+		}
+		orig := pod.DeepCopy()
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[reloadedConfigAnnotationKey] = want
+		err = m.client.Patch(ctx, pod, rtclient.MergeFrom(orig))
+		if err != nil {
+			m.logger.Error(err, "Failed to annotate pod",
+				"Pod.Namespace", pod.Namespace, "Pod.Name", pod.Name)
+			return false, err
+		}
+		if _, found := orig.Annotations[reloadedConfigAnnotationKey]; found {
+			// new pods are only reloaded in case they started with an
+			// outdated config file, which is not worth an event
+			m.recorder.Eventf(planner.SmbShare,
+				EventNormal,
+				ReasonReloadedConfig,
+				"Reloaded the configuration of the samba servers of pod %s",
+				pod.Name)
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,191 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+type fakeReloader struct {
+	// stale lists the pods not seeing the updated config file yet.
+	stale    map[string]bool
+	reloaded []string
+}
+
+func (f *fakeReloader) ReloadConfig(
+	_ context.Context,
+	pod *corev1.Pod,
+	container, path, digest string) (bool, error) {
+	// ---
+	if pod.Name == "myshare-down" {
+		return false, fmt.Errorf("pod %s not reachable", pod.Name)
+	}
+	if container != "samba" || path != "/etc/container-config/config.json" ||
+		len(digest) != 64 {
+		// ---
+		return false, fmt.Errorf("unexpected reload of %s %s", container, path)
+	}
+	if f.stale[pod.Name] {
+		return false, nil
+	}
+	f.reloaded = append(f.reloaded, pod.Name)
+	return true, nil
+}
+
+func TestServerConfigHash(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	planner.ConfigState = smbcc.New()
+	_, err := planner.update()
+	require.NoError(t, err)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	current := buildDeployment(cfg, planner, "mypvc", "default")
+	serverHash := planner.serverConfigHash()
+	reloadHash := planner.reloadConfigHash()
+	assert.Equal(t, serverHash,
+		current.Spec.Template.Annotations[serverConfigHashKey])
+
+	// a change to the options of the share is only reloaded
+	share.Spec.Browseable = !share.Spec.Browseable
+	changed, err := planner.update()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, serverHash, planner.serverConfigHash())
+	assert.NotEqual(t, reloadHash, planner.reloadConfigHash())
+	desired := buildDeployment(cfg, planner, "mypvc", "default")
+	assert.False(t, updatePodTemplateSettings(current, desired))
+
+	// a change to the name of the servers needs a restart
+	common.Spec.NetbiosName = "FILES1"
+	changed, err = planner.update()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.NotEqual(t, serverHash, planner.serverConfigHash())
+	desired = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(current, desired))
+	assert.Equal(t, planner.serverConfigHash(),
+		current.Spec.Template.Annotations[serverConfigHashKey])
+
+	assert.True(t, needsRestart("idmap config * : range"))
+	assert.True(t, needsRestart(smbcc.SmbPortsParam))
+	assert.False(t, needsRestart(smbcc.DeadtimeParam))
+}
+
+func TestReloadConfig(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Namespace = "default"
+	planner := testPlanner(share, nil)
+	planner.ConfigState = smbcc.New()
+	_, err := planner.update()
+	require.NoError(t, err)
+	cm := &corev1.ConfigMap{Data: map[string]string{}}
+	require.NoError(t, setContainerConfig(cm, planner.ConfigState))
+	serverHash := planner.serverConfigHash()
+	pod := func(name string, ready bool, annotations map[string]string) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Labels:      map[string]string{svcSelectorKey: "myshare"},
+				Annotations: annotations,
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				Conditions: []corev1.PodCondition{{
+					Type:   corev1.PodReady,
+					Status: status,
+				}},
+			},
+		}
+	}
+	reloaded := map[string]string{
+		serverConfigHashKey:         serverHash,
+		reloadedConfigAnnotationKey: planner.reloadConfigHash(),
+	}
+	outdated := map[string]string{
+		serverConfigHashKey:         serverHash,
+		reloadedConfigAnnotationKey: "outdated",
+	}
+	restarting := map[string]string{serverConfigHashKey: "outdated"}
+	m, recorder := newTestManager(share,
+		pod("myshare-a", true, reloaded),
+		pod("myshare-b", true, outdated),
+		pod("myshare-c", false, outdated),
+		pod("myshare-d", true, restarting),
+		pod("myshare-e", true, map[string]string{serverConfigHashKey: serverHash}),
+		pod("myshare-f", true, outdated))
+	m.cfg = &conf.OperatorConfig{SmbdContainerName: "samba"}
+	ctx := context.TODO()
+
+	// without a reloader the configuration is not reloaded
+	pending, err := m.reloadConfig(ctx, planner, cm, "default")
+	assert.NoError(t, err)
+	assert.False(t, pending)
+
+	// only the ready pods that did not reload the configuration yet, and
+	// are not about to be restarted, are reloaded
+	reloader := &fakeReloader{stale: map[string]bool{"myshare-f": true}}
+	m.SetConfigReloader(reloader)
+	pending, err = m.reloadConfig(ctx, planner, cm, "default")
+	assert.NoError(t, err)
+	assert.True(t, pending)
+	assert.Equal(t, []string{"myshare-b", "myshare-e"}, reloader.reloaded)
+	// new pods are reloaded without an event
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonReloadedConfig)
+		assert.Contains(t, event, "myshare-b")
+	}
+	got := &corev1.Pod{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare-b"}, got))
+	assert.Equal(t, planner.reloadConfigHash(),
+		got.Annotations[reloadedConfigAnnotationKey])
+
+	// once the pods see the config file, nothing is left to reload
+	reloader.stale = nil
+	reloader.reloaded = nil
+	pending, err = m.reloadConfig(ctx, planner, cm, "default")
+	assert.NoError(t, err)
+	assert.False(t, pending)
+	assert.Equal(t, []string{"myshare-f"}, reloader.reloaded)
+
+	// failures are reported and retried
+	m, recorder = newTestManager(share, pod("myshare-down", true, outdated))
+	m.cfg = &conf.OperatorConfig{SmbdContainerName: "samba"}
+	m.SetConfigReloader(reloader)
+	pending, err = m.reloadConfig(ctx, planner, cm, "default")
+	assert.NoError(t, err)
+	assert.True(t, pending)
+	assert.Contains(t, <-recorder.Events, ReasonConfigReloadFailed)
+}
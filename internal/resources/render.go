@@ -0,0 +1,119 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// RenderedShare holds the configuration generated for a share and the
+// resources the operator would create for it.
+type RenderedShare struct {
+	// SmbConf is the smb.conf of the share's server group.
+	SmbConf string
+	// ContainerConfig is the samba container config holding the share's
+	// server group.
+	ContainerConfig *smbcc.SambaContainerConfig
+	// Objects are the resources created for the share, in the order they
+	// are created by the operator. Their kinds are not set.
+	Objects []runtime.Object
+}
+
+// Render returns the configuration and the resources the operator would
+// create for the share of the instance configuration, without reading or
+// changing the cluster. The share is not validated. Unless group shares
+// are given, the share is rendered as the only member of its server
+// group. Owner references are not set, as the share is not expected to
+// exist yet.
+func Render(
+	cfg *conf.OperatorConfig, ic InstanceConfiguration) (*RenderedShare, error) {
+	// ---
+	s := ic.SmbShare.DeepCopy()
+	if s.Status.ServerGroup == "" {
+		s.Status.ServerGroup = desiredServerGroup(s)
+	}
+	if shareNeedsPvc(s) && s.Spec.Storage.Pvc.Name == "" {
+		s.Spec.Storage.Pvc.Name = pvcName(s)
+	}
+	ic.SmbShare = s
+	ic.GlobalConfig = cfg
+	if len(ic.GroupShares) == 0 {
+		ic.GroupShares = []sambaoperatorv1alpha1.SmbShare{*s}
+	}
+	cc := smbcc.New()
+	for i := range ic.GroupShares {
+		member := ic.GroupShares[i].DeepCopy()
+		if member.Name == s.Name {
+			continue
+		}
+		// the shares of the group are served by the same configuration
+		member.Status.ServerGroup = s.Status.ServerGroup
+		mic := ic
+		mic.SmbShare = member
+		if _, err := newSharePlanner(mic, cc).update(); err != nil {
+			return nil, err
+		}
+	}
+	planner := newSharePlanner(ic, cc)
+	if _, err := planner.update(); err != nil {
+		return nil, err
+	}
+	smbConf, err := planner.ConfigState.SmbConf(planner.instanceID())
+	if err != nil {
+		return nil, err
+	}
+
+	ns := cfg.WorkingNamespace
+	cm, err := newDefaultConfigMap(ConfigMapName, ns)
+	if err != nil {
+		return nil, err
+	}
+	if err := setContainerConfig(cm, planner.ConfigState); err != nil {
+		return nil, err
+	}
+	smbConfCM, err := newSmbConfConfigMap(planner)
+	if err != nil {
+		return nil, err
+	}
+	objects := []runtime.Object{cm, smbConfCM}
+	if shareNeedsPvc(s) {
+		objects = append(objects, pvcForSmbShare(s, ns))
+	}
+	claimName := ""
+	if s.Spec.Storage.Pvc != nil {
+		claimName = s.Spec.Storage.Pvc.Name
+	}
+	if planner.workloadType() == statefulSetWorkload {
+		objects = append(objects,
+			newHeadlessServiceForSmb(planner, ns),
+			buildStatefulSet(cfg, planner, claimName, ns))
+	} else {
+		objects = append(objects, buildDeployment(cfg, planner, claimName, ns))
+	}
+	objects = append(objects, newServiceForSmb(planner, ns))
+	if pdb := newPodDisruptionBudgetForSmb(planner, ns); pdb != nil {
+		objects = append(objects, pdb)
+	}
+	return &RenderedShare{
+		SmbConf:         smbConf,
+		ContainerConfig: planner.ConfigState,
+		Objects:         objects,
+	}, nil
+}
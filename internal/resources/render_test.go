@@ -0,0 +1,106 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func TestRender(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{
+		AccessModes: []corev1.PersistentVolumeAccessMode{
+			corev1.ReadWriteOnce,
+		},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse("1Gi"),
+			},
+		},
+	})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.ShareName = "Data"
+	share.Spec.Browseable = true
+	share.Spec.HideFiles = []string{"desktop.ini"}
+	cfg := &conf.OperatorConfig{
+		SmbdContainerName:  "samba",
+		SmbdContainerImage: "quay.io/samba.org/samba-server:latest",
+		WorkingNamespace:   "samba-operator-system",
+	}
+
+	rendered, err := Render(cfg, InstanceConfiguration{SmbShare: share})
+	require.NoError(t, err)
+	assert.Contains(t, rendered.SmbConf, "[Data]\n")
+	assert.Contains(t, rendered.SmbConf, "\thide files = /desktop.ini/\n")
+	assert.Contains(t, rendered.SmbConf, "\tnetbios name = myshare\n")
+	assert.Contains(t, rendered.ContainerConfig.Configs, smbcc.Key("myshare"))
+
+	// the share given is left as is
+	assert.Empty(t, share.Status.ServerGroup)
+	assert.Empty(t, share.Spec.Storage.Pvc.Name)
+
+	kinds := []string{}
+	for _, obj := range rendered.Objects {
+		switch o := obj.(type) {
+		case *corev1.ConfigMap:
+			kinds = append(kinds, "ConfigMap/"+o.Name)
+		case *corev1.PersistentVolumeClaim:
+			kinds = append(kinds, "PersistentVolumeClaim/"+o.Name)
+			assert.Equal(t, "samba-operator-system", o.Namespace)
+		case *appsv1.Deployment:
+			kinds = append(kinds, "Deployment/"+o.Name)
+			vol := o.Spec.Template.Spec.Volumes[0]
+			if assert.NotNil(t, vol.PersistentVolumeClaim) {
+				assert.Equal(t, "myshare-pvc", vol.PersistentVolumeClaim.ClaimName)
+			}
+		case *corev1.Service:
+			kinds = append(kinds, "Service/"+o.Name)
+		default:
+			kinds = append(kinds, "unexpected")
+		}
+	}
+	assert.Equal(t, []string{
+		"ConfigMap/" + ConfigMapName,
+		"ConfigMap/myshare-smb-conf",
+		"PersistentVolumeClaim/myshare-pvc",
+		"Deployment/myshare",
+		"Service/myshare",
+	}, kinds)
+
+	// other shares of the group are served too
+	other := share.DeepCopy()
+	other.Name = "othershare"
+	other.Spec.ShareName = "Other"
+	other.Spec.ServerGroup = "myshare"
+	share.Spec.ServerGroup = "myshare"
+	rendered, err = Render(cfg, InstanceConfiguration{
+		SmbShare:    share,
+		GroupShares: []sambaoperatorv1alpha1.SmbShare{*share, *other},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, rendered.SmbConf, "[Data]\n")
+	assert.Contains(t, rendered.SmbConf, "[Other]\n")
+}
@@ -0,0 +1,340 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// maxReportEvents is the number of the most recent events of the SmbShare
+// that a share report lists.
+const maxReportEvents = 10
+
+// WriteShareReport writes a human readable report of the live state of the
+// SmbShare to out: its status and conditions, the state of the resources
+// recorded in its status and of the pods of its server group, its most
+// recent events and the smb.conf of its server group. Resources that can
+// not be found are reported as missing rather than failing the report.
+func WriteShareReport(
+	ctx context.Context,
+	cl rtclient.Reader,
+	key types.NamespacedName,
+	out io.Writer) error {
+	// ---
+	s := &sambaoperatorv1alpha1.SmbShare{}
+	if err := cl.Get(ctx, key, s); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	writeShareSummary(w, s)
+
+	fmt.Fprintf(w, "\nConditions:\n")
+	if len(s.Status.Conditions) == 0 {
+		fmt.Fprintf(w, "  <none>\n")
+	} else {
+		fmt.Fprintf(w, "  TYPE\tSTATUS\tREASON\tSINCE\tMESSAGE\n")
+		for _, c := range s.Status.Conditions {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n",
+				c.Type, c.Status, c.Reason,
+				reportTime(c.LastTransitionTime.Time), c.Message)
+		}
+	}
+
+	fmt.Fprintf(w, "\nResources:\n")
+	if len(s.Status.Resources) == 0 {
+		fmt.Fprintf(w, "  <none>\n")
+	} else {
+		fmt.Fprintf(w, "  KIND\tNAME\tSTATE\n")
+		for _, ref := range s.Status.Resources {
+			state, err := resourceState(ctx, cl, ref)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "  %s\t%s/%s\t%s\n",
+				ref.Kind, ref.Namespace, ref.Name, state)
+		}
+	}
+
+	if err := writeServerPods(ctx, w, cl, s); err != nil {
+		return err
+	}
+	if err := writeShareEvents(ctx, w, cl, s); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// the smb.conf is written past the tabwriter, which would align its
+	// tab indented lines
+	return writeShareSmbConf(ctx, out, cl, s)
+}
+
+// writeShareSummary writes the fields of the status of the SmbShare that
+// are set.
+func writeShareSummary(w io.Writer, s *sambaoperatorv1alpha1.SmbShare) {
+	st := s.Status
+	fmt.Fprintf(w, "SmbShare:\t%s/%s\n", s.Namespace, s.Name)
+	fmt.Fprintf(w, "Share name:\t%s\n", s.Spec.ShareName)
+	fsummary := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%s:\t%s\n", label, value)
+		}
+	}
+	fsummary("Server group", st.ServerGroup)
+	fsummary("Published DNS name", st.PublishedDNSName)
+	if st.Port != 0 {
+		fsummary("Port", fmt.Sprint(st.Port))
+	}
+	fsummary("Network addresses", strings.Join(st.NetworkAddresses, ", "))
+	fsummary("Config mode", st.ConfigMode)
+	if st.ActiveConnections != nil {
+		fsummary("Active connections", fmt.Sprint(*st.ActiveConnections))
+	}
+	if q := st.Quota; q != nil && q.Used != nil {
+		used := q.Used.String()
+		if q.Exceeded {
+			used += " (exceeded)"
+		}
+		fsummary("Quota used", used)
+	}
+}
+
+// reportTime formats a time of the report, or returns "-" if it is unset.
+func reportTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// resourceState returns a short description of the state of the resource
+// the SmbShare refers to, such as the ready replicas of a Deployment or
+// the phase of a PVC.
+func resourceState(
+	ctx context.Context,
+	cl rtclient.Reader,
+	ref sambaoperatorv1alpha1.SmbShareResourceRef) (string, error) {
+	// ---
+	var obj childObject
+	switch ref.Kind {
+	case "Deployment":
+		obj = &appsv1.Deployment{}
+	case "StatefulSet":
+		obj = &appsv1.StatefulSet{}
+	case "Service":
+		obj = &corev1.Service{}
+	case "PersistentVolumeClaim":
+		obj = &corev1.PersistentVolumeClaim{}
+	case "PodDisruptionBudget":
+		obj = &policyv1beta1.PodDisruptionBudget{}
+	case "ConfigMap":
+		obj = &corev1.ConfigMap{}
+	case "Secret":
+		obj = &corev1.Secret{}
+	case "ServiceMonitor":
+		obj = serviceMonitorObject(ref.Name, ref.Namespace)
+	default:
+		return "unknown kind", nil
+	}
+	key := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+	err := cl.Get(ctx, key, obj)
+	if errors.IsNotFound(err) {
+		return "missing", nil
+	} else if err != nil {
+		return "", err
+	}
+	if obj.GetDeletionTimestamp() != nil {
+		return "deleting", nil
+	}
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return replicasState(o.Spec.Replicas, o.Status.ReadyReplicas), nil
+	case *appsv1.StatefulSet:
+		return replicasState(o.Spec.Replicas, o.Status.ReadyReplicas), nil
+	case *corev1.Service:
+		state := string(o.Spec.Type)
+		if o.Spec.ClusterIP != "" {
+			state += " " + o.Spec.ClusterIP
+		}
+		for _, ingress := range o.Status.LoadBalancer.Ingress {
+			state += " " + ingress.IP + ingress.Hostname
+		}
+		return state, nil
+	case *corev1.PersistentVolumeClaim:
+		return string(o.Status.Phase), nil
+	case *policyv1beta1.PodDisruptionBudget:
+		return fmt.Sprintf("%d/%d healthy",
+			o.Status.CurrentHealthy, o.Status.DesiredHealthy), nil
+	}
+	return "present", nil
+}
+
+// replicasState describes the ready replicas of a workload.
+func replicasState(replicas *int32, ready int32) string {
+	want := int32(1)
+	if replicas != nil {
+		want = *replicas
+	}
+	return fmt.Sprintf("%d/%d ready", ready, want)
+}
+
+// writeServerPods writes the state of the pods of the server group of the
+// SmbShare, found in the namespace of its Deployment or StatefulSet.
+func writeServerPods(
+	ctx context.Context,
+	w io.Writer,
+	cl rtclient.Reader,
+	s *sambaoperatorv1alpha1.SmbShare) error {
+	// ---
+	ns := ""
+	for _, ref := range s.Status.Resources {
+		if ref.Kind == "Deployment" || ref.Kind == "StatefulSet" {
+			ns = ref.Namespace
+		}
+	}
+	fmt.Fprintf(w, "\nPods:\n")
+	if ns == "" || s.Status.ServerGroup == "" {
+		fmt.Fprintf(w, "  <none>\n")
+		return nil
+	}
+	pods := &corev1.PodList{}
+	err := cl.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels(labelsForSmbServer(s.Status.ServerGroup)))
+	if err != nil {
+		return err
+	}
+	if len(pods.Items) == 0 {
+		fmt.Fprintf(w, "  <none>\n")
+		return nil
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+	fmt.Fprintf(w, "  NAME\tPHASE\tREADY\tRESTARTS\tNODE\n")
+	for _, pod := range pods.Items {
+		ready, restarts := 0, int32(0)
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Ready {
+				ready++
+			}
+			restarts += cs.RestartCount
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%d/%d\t%d\t%s\n",
+			pod.Name, pod.Status.Phase, ready, len(pod.Spec.Containers),
+			restarts, pod.Spec.NodeName)
+	}
+	return nil
+}
+
+// eventTime returns the time the event last happened.
+func eventTime(e *corev1.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+// writeShareEvents writes the most recent events of the SmbShare, oldest
+// first.
+func writeShareEvents(
+	ctx context.Context,
+	w io.Writer,
+	cl rtclient.Reader,
+	s *sambaoperatorv1alpha1.SmbShare) error {
+	// ---
+	l := &corev1.EventList{}
+	if err := cl.List(ctx, l, rtclient.InNamespace(s.Namespace)); err != nil {
+		return err
+	}
+	events := []*corev1.Event{}
+	for i := range l.Items {
+		e := &l.Items[i]
+		ref := e.InvolvedObject
+		if ref.Kind != "SmbShare" || ref.Name != s.Name ||
+			(ref.UID != "" && s.UID != "" && ref.UID != s.UID) {
+			// ---
+			continue
+		}
+		events = append(events, e)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(events[i]).Before(eventTime(events[j]))
+	})
+	if len(events) > maxReportEvents {
+		events = events[len(events)-maxReportEvents:]
+	}
+	fmt.Fprintf(w, "\nEvents:\n")
+	if len(events) == 0 {
+		fmt.Fprintf(w, "  <none>\n")
+		return nil
+	}
+	fmt.Fprintf(w, "  LAST SEEN\tTYPE\tREASON\tCOUNT\tMESSAGE\n")
+	for _, e := range events {
+		count := e.Count
+		if count == 0 {
+			count = 1
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%d\t%s\n",
+			reportTime(eventTime(e)), e.Type, e.Reason, count, e.Message)
+	}
+	return nil
+}
+
+// writeShareSmbConf writes the smb.conf stored in the ConfigMap recorded in
+// the status of the SmbShare.
+func writeShareSmbConf(
+	ctx context.Context,
+	out io.Writer,
+	cl rtclient.Reader,
+	s *sambaoperatorv1alpha1.SmbShare) error {
+	// ---
+	name := s.Status.SmbConfConfigMap
+	if name == "" {
+		_, err := fmt.Fprintf(out, "\nsmb.conf:\n  <not rendered yet>\n")
+		return err
+	}
+	cm := &corev1.ConfigMap{}
+	err := cl.Get(ctx, types.NamespacedName{Name: name, Namespace: s.Namespace}, cm)
+	if errors.IsNotFound(err) {
+		_, err := fmt.Fprintf(out,
+			"\nsmb.conf (ConfigMap %s/%s):\n  <missing>\n", s.Namespace, name)
+		return err
+	} else if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "\nsmb.conf (ConfigMap %s/%s):\n%s",
+		s.Namespace, name, cm.Data[SmbConfKey])
+	return err
+}
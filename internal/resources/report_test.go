@@ -0,0 +1,177 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+func shareEvent(name, reason, msg string, at time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{
+			Kind: "SmbShare",
+			Name: "myshare",
+		},
+		Type:          EventNormal,
+		Reason:        reason,
+		Message:       msg,
+		LastTimestamp: metav1.NewTime(at),
+		Count:         2,
+	}
+}
+
+func TestWriteShareReport(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.ShareName = "Data"
+	connections := int32(3)
+	share.Status = sambaoperatorv1alpha1.SmbShareStatus{
+		ServerGroup:       "myshare",
+		Port:              445,
+		ActiveConnections: &connections,
+		SmbConfConfigMap:  "myshare-smb-conf",
+		Conditions: []sambaoperatorv1alpha1.Condition{{
+			Type:    "Ready",
+			Status:  corev1.ConditionFalse,
+			Reason:  "PodsNotReady",
+			Message: "0 of 1 pods are ready",
+			LastTransitionTime: metav1.NewTime(
+				time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)),
+		}},
+		Resources: []sambaoperatorv1alpha1.SmbShareResourceRef{
+			{Kind: "Deployment", Name: "myshare", Namespace: "samba"},
+			{Kind: "Service", Name: "myshare", Namespace: "samba"},
+			{Kind: "PersistentVolumeClaim", Name: "myshare-pvc", Namespace: "samba"},
+			{Kind: "ConfigMap", Name: "myshare-smb-conf", Namespace: "default"},
+		},
+	}
+	replicas := int32(2)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "myshare", Namespace: "samba"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "myshare", Namespace: "samba"},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			ClusterIP: "10.0.0.7",
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myshare-5d9c-x7k2p",
+			Namespace: "samba",
+			Labels:    labelsForSmbServer("myshare"),
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "node1",
+			Containers: []corev1.Container{{Name: "samba"}, {Name: "wb"}},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "samba", Ready: true, RestartCount: 4},
+				{Name: "wb", Ready: false, RestartCount: 1},
+			},
+		},
+	}
+	// pods of other server groups are not listed
+	other := pod.DeepCopy()
+	other.Name = "other-7f8d-q2w3e"
+	other.Labels = labelsForSmbServer("other")
+	smbConf := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "myshare-smb-conf", Namespace: "default"},
+		Data:       map[string]string{SmbConfKey: "[Data]\n\tpath = /share\n"},
+	}
+	base := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	objs := []runtime.Object{share, deployment, service, pod, other, smbConf}
+	for i := 0; i < maxReportEvents+2; i++ {
+		objs = append(objs, shareEvent(
+			fmt.Sprintf("myshare.%d", i), ReasonCreatedDeployment,
+			fmt.Sprintf("event %d", i), base.Add(time.Duration(i)*time.Minute)))
+	}
+	unrelated := shareEvent("othershare.1", ReasonCreatedDeployment,
+		"event of another share", base)
+	unrelated.InvolvedObject.Name = "othershare"
+	objs = append(objs, unrelated)
+	m, _ := newTestManager(objs...)
+	ctx := context.TODO()
+
+	var buf bytes.Buffer
+	key := types.NamespacedName{Namespace: "default", Name: "myshare"}
+	require.NoError(t, WriteShareReport(ctx, m.client, key, &buf))
+	report := buf.String()
+	assert.Contains(t, report, "SmbShare:            default/myshare\n")
+	assert.Contains(t, report, "Share name:          Data\n")
+	assert.Contains(t, report, "Active connections:  3\n")
+	assert.NotContains(t, report, "Published DNS name")
+	assert.Regexp(t,
+		`Ready +False +PodsNotReady +2021-03-01T12:00:00Z +0 of 1 pods are ready`,
+		report)
+	assert.Regexp(t, `Deployment +samba/myshare +1/2 ready\n`, report)
+	assert.Regexp(t, `Service +samba/myshare +ClusterIP 10.0.0.7\n`, report)
+	assert.Regexp(t, `PersistentVolumeClaim +samba/myshare-pvc +missing\n`, report)
+	assert.Regexp(t, `ConfigMap +default/myshare-smb-conf +present\n`, report)
+	assert.Regexp(t, `myshare-5d9c-x7k2p +Running +1/2 +5 +node1\n`, report)
+	assert.NotContains(t, report, "other-7f8d-q2w3e")
+	// the most recent events are listed, oldest first
+	assert.NotContains(t, report, "event 1\n")
+	assert.Regexp(t,
+		`2021-03-01T12:02:00Z +Normal +CreatedDeployment +2 +event 2\n`, report)
+	assert.Contains(t, report, "event 11\n")
+	assert.Less(t,
+		bytes.Index(buf.Bytes(), []byte("event 2\n")),
+		bytes.Index(buf.Bytes(), []byte("event 11\n")))
+	assert.NotContains(t, report, "event of another share")
+	assert.Contains(t, report,
+		"smb.conf (ConfigMap default/myshare-smb-conf):\n[Data]\n\tpath = /share\n")
+
+	// a share not reconciled yet
+	fresh := &sambaoperatorv1alpha1.SmbShare{}
+	fresh.Name = "fresh"
+	fresh.Namespace = "default"
+	m, _ = newTestManager(fresh)
+	buf.Reset()
+	key.Name = "fresh"
+	require.NoError(t, WriteShareReport(ctx, m.client, key, &buf))
+	report = buf.String()
+	assert.Contains(t, report, "Conditions:\n  <none>\n")
+	assert.Contains(t, report, "Resources:\n  <none>\n")
+	assert.Contains(t, report, "Pods:\n  <none>\n")
+	assert.Contains(t, report, "Events:\n  <none>\n")
+	assert.Contains(t, report, "smb.conf:\n  <not rendered yet>\n")
+
+	// a missing share fails the report
+	key.Name = "missing"
+	assert.Error(t, WriteShareReport(ctx, m.client, key, &buf))
+}
@@ -0,0 +1,78 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// pathCheckContainerName is the name of the init container checking that
+// the directory of a share requiring it exists on its volume.
+const pathCheckContainerName = "check-path"
+
+// pathCheckCommand returns a command failing, with a message naming the
+// share's path, if the directory of the share does not exist.
+func pathCheckCommand(s *sambaoperatorv1alpha1.SmbShare) []string {
+	msg := fmt.Sprintf("path %s of share %s does not exist on the volume",
+		storagePathOf(s), s.Name)
+	script := fmt.Sprintf(`[ -d %s ] || { echo %s >&2; exit 1; }`,
+		shellQuote(sharePathOf(s)), shellQuote(msg))
+	return []string{"/bin/sh", "-c", script}
+}
+
+// podPathCheckFailure returns the message of the path check of the pod if
+// it failed, as it does until the directory is created, or an empty string
+// otherwise.
+func podPathCheckFailure(pod *corev1.Pod) string {
+	return initContainerFailure(pod, func(name string) bool {
+		return strings.HasPrefix(name, pathCheckContainerName)
+	})
+}
+
+// checkPathStatus sets the Degraded condition on the SmbShare, and returns
+// false, if a server pod found the directory of a share requiring it to be
+// missing. Such pods wait, without starting their samba servers, for the
+// directory to be created.
+func (m *SmbShareManager) checkPathStatus(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	pods := &corev1.PodList{}
+	err := m.client.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{
+			svcSelectorKey: labelValue(planner.instanceName()),
+		})
+	if err != nil {
+		m.logger.Error(err, "Failed to list pods", "namespace", ns)
+		return false, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if failure := podPathCheckFailure(pod); failure != "" {
+			msg := fmt.Sprintf("Pod %s: %s", pod.Name, failure)
+			return false, m.setDegraded(
+				ctx, planner.SmbShare, ReasonMissingSharePath, msg)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,146 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+)
+
+func TestBuildPodSpecRequirePathExists(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Spec.Storage.Path = "projects/current"
+	planner := testPlanner(share, nil)
+	initNames := func() []string {
+		podSpec := buildPodSpec(planner, &conf.OperatorConfig{}, "mypvc")
+		names := []string{}
+		for _, c := range podSpec.InitContainers {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+	assert.Contains(t, initNames(), pathContainerName)
+	assert.NotContains(t, initNames(), pathCheckContainerName)
+
+	// the directories are checked rather than created
+	share.Spec.Storage.RequirePathExists = true
+	assert.NotContains(t, initNames(), pathContainerName)
+	assert.Contains(t, initNames(), pathCheckContainerName)
+}
+
+func TestPathCheckCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+	root, err := ioutil.TempDir("", "sharepath")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.UID = "abc123"
+	share.Spec.Storage.Path = "a/it's here"
+	run := func() (string, error) {
+		cmd := pathCheckCommand(share)
+		script := strings.Replace(
+			cmd[2], "'/mnt/abc123/a/it'\\''s here'",
+			shellQuote(filepath.Join(root, "a", "it's here")), 1)
+		out, err := exec.Command(cmd[0], cmd[1], script).CombinedOutput()
+		return string(out), err
+	}
+	out, err := run()
+	assert.Error(t, err)
+	assert.Equal(t,
+		"path a/it's here of share myshare does not exist on the volume\n", out)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "a", "it's here"), 0755))
+	out, err = run()
+	assert.NoError(t, err)
+	assert.Empty(t, out)
+	// nothing was created
+	_, err = os.Stat(filepath.Join(root, "a", "it's here", "c"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCheckPathStatus(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.Storage.Path = "projects/current"
+	share.Spec.Storage.RequirePathExists = true
+	planner := testPlanner(share, nil)
+	pod := &corev1.Pod{}
+	pod.Name = "myshare-abc"
+	pod.Namespace = "default"
+	pod.Labels = labelsForSmbServer("myshare")
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		Name: pathCheckContainerName,
+		State: corev1.ContainerState{
+			Running: &corev1.ContainerStateRunning{},
+		},
+	}}
+	ctx := context.TODO()
+	m, recorder := newTestManager(share, pod)
+	valid, err := m.checkPathStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Empty(t, recorder.Events)
+
+	// the pod waits for the missing directory to be created
+	pod.Status.InitContainerStatuses[0] = corev1.ContainerStatus{
+		Name: pathCheckContainerName,
+		State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+		},
+		LastTerminationState: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{
+				ExitCode: 1,
+				Message: "path projects/current of share myshare " +
+					"does not exist on the volume\n",
+			},
+		},
+	}
+	m, recorder = newTestManager(share, pod)
+	valid, err = m.checkPathStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonMissingSharePath)
+		assert.Contains(t, event,
+			"Pod myshare-abc: path projects/current of share myshare "+
+				"does not exist on the volume")
+	}
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, corev1.ConditionTrue, cond.Status)
+		assert.Equal(t, ReasonMissingSharePath, cond.Reason)
+	}
+}
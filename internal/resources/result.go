@@ -15,10 +15,13 @@ limitations under the License.
 
 package resources
 
+import "time"
+
 // Result encapsulates the result of the work performed by a resource update.
 type Result struct {
-	err     error
-	requeue bool
+	err          error
+	requeue      bool
+	requeueAfter time.Duration
 }
 
 // Err returns any error associated with the result.
@@ -31,6 +34,18 @@ func (r Result) Requeue() bool {
 	return r.requeue
 }
 
+// RequeueAfter returns the delay after which the resource should be
+// checked again, even if nothing changed. Zero means no check is needed.
+func (r Result) RequeueAfter() time.Duration {
+	return r.requeueAfter
+}
+
+// requeueAfter returns a result that is complete but should be checked
+// again after the given delay.
+func requeueAfter(d time.Duration) Result {
+	return Result{requeueAfter: d}
+}
+
 var (
 	// Done represents a result that is complete.
 	Done = Result{}
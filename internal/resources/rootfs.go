@@ -0,0 +1,157 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// accountsInitContainerName is the name of the init container copying
+	// the accounts files of the samba image to the accounts volume.
+	accountsInitContainerName = "init-accounts"
+	// accountsVolName is the name of the volume holding the writable
+	// copies of the accounts files.
+	accountsVolName = "accounts"
+	// accountsDir is where the init container mounts the accounts volume.
+	accountsDir = "/var/lib/samba-accounts"
+)
+
+// writablePath is a path the samba containers write to, mounted from an
+// emptyDir volume when the root file system is read-only.
+type writablePath struct {
+	path   string
+	volume string
+	medium corev1.StorageMedium
+}
+
+// writablePaths are the paths smbd, winbindd and the samba-container tool
+// write to: the smb.conf generated by samba-container, the pid files,
+// locks and sockets, the temporary files of kerberos and the tools, the
+// caches, the databases of samba and its logs. The volumes of the state
+// and run directories are those the pods use with a writable root file
+// system.
+var writablePaths = []writablePath{
+	{"/etc/samba", "etc-samba", corev1.StorageMediumDefault},
+	{"/run", osRunVolName, corev1.StorageMediumMemory},
+	{"/tmp", "tmp", corev1.StorageMediumDefault},
+	{"/var/cache/samba", "samba-cache-dir", corev1.StorageMediumDefault},
+	{"/var/lib/samba", stateVolName, corev1.StorageMediumDefault},
+	{"/var/log/samba", "samba-log-dir", corev1.StorageMediumDefault},
+	{"/var/tmp", "var-tmp", corev1.StorageMediumDefault},
+}
+
+// accountsFiles are the files samba-container adds the users and groups
+// of the share to. They are edited in place.
+var accountsFiles = []string{"/etc/passwd", "/etc/group"}
+
+// readOnlyRootFilesystem returns true if the containers of the pods that
+// host the share are to have a read-only root file system.
+func (sp *sharePlanner) readOnlyRootFilesystem() bool {
+	return sp.CommonConfig != nil && sp.CommonConfig.Spec.PodSettings != nil &&
+		sp.CommonConfig.Spec.PodSettings.ReadOnlyRootFilesystem
+}
+
+// runsSamba returns true if the container runs samba or its tools, and so
+// writes to the writable paths.
+func (sp *sharePlanner) runsSamba(c *corev1.Container) bool {
+	return c.Image == sp.sambaImage() || c.Image == sp.dnsRegisterImage() ||
+		c.Image == sp.metricsImage()
+}
+
+// setReadOnlyRootFilesystem makes the root file systems of the containers
+// of the pod read-only, if the share asks for it. The writable paths are
+// mounted from emptyDir volumes in the containers running samba, unless
+// they already mount them, and writable copies of the accounts files of
+// the samba image, made by an init container ahead of the others, are
+// mounted over the read-only ones.
+func setReadOnlyRootFilesystem(planner *sharePlanner, podSpec *corev1.PodSpec) {
+	if !planner.readOnlyRootFilesystem() {
+		return
+	}
+	volumes := map[string]bool{}
+	for _, v := range podSpec.Volumes {
+		volumes[v.Name] = true
+	}
+	addVolume := func(name string, medium corev1.StorageMedium) {
+		if volumes[name] {
+			return
+		}
+		volumes[name] = true
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{Medium: medium},
+			},
+		})
+	}
+	addMounts := func(c *corev1.Container) {
+		if c.SecurityContext == nil {
+			c.SecurityContext = &corev1.SecurityContext{}
+		}
+		readOnly := true
+		c.SecurityContext.ReadOnlyRootFilesystem = &readOnly
+		if !planner.runsSamba(c) {
+			return
+		}
+		mounted := map[string]bool{}
+		for _, m := range c.VolumeMounts {
+			mounted[m.MountPath] = true
+		}
+		// the writable paths are mounted ahead of the mounts below them
+		mounts := []corev1.VolumeMount{}
+		for _, wp := range writablePaths {
+			if mounted[wp.path] {
+				continue
+			}
+			addVolume(wp.volume, wp.medium)
+			mounts = append(mounts, corev1.VolumeMount{
+				MountPath: wp.path,
+				Name:      wp.volume,
+			})
+		}
+		if c.Name != accountsInitContainerName {
+			for _, f := range accountsFiles {
+				mounts = append(mounts, corev1.VolumeMount{
+					MountPath: f,
+					Name:      accountsVolName,
+					SubPath:   path.Base(f),
+				})
+			}
+		}
+		c.VolumeMounts = append(mounts, c.VolumeMounts...)
+	}
+
+	addVolume(accountsVolName, corev1.StorageMediumDefault)
+	copyArgs := append([]string{"cp"}, accountsFiles...)
+	podSpec.InitContainers = append([]corev1.Container{{
+		Image:   planner.sambaImage(),
+		Name:    accountsInitContainerName,
+		Command: append(copyArgs, accountsDir),
+		VolumeMounts: []corev1.VolumeMount{{
+			MountPath: accountsDir,
+			Name:      accountsVolName,
+		}},
+	}}, podSpec.InitContainers...)
+	for i := range podSpec.InitContainers {
+		addMounts(&podSpec.InitContainers[i])
+	}
+	for i := range podSpec.Containers {
+		addMounts(&podSpec.Containers[i])
+	}
+}
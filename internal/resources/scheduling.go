@@ -0,0 +1,383 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// pendingTimeout is how long the pods of a share may wait to be scheduled
+// before the share is reported as unschedulable. It is also how long the
+// PVC of a share may wait to be bound, unless the storage bind timeout is
+// configured.
+const pendingTimeout = 5 * time.Minute
+
+const (
+	// minStorageRecheck is the shortest time to wait before checking an
+	// unbound PVC again.
+	minStorageRecheck = 5 * time.Second
+	// maxStorageRecheck is the longest time to wait before checking an
+	// unbound PVC again.
+	maxStorageRecheck = time.Minute
+)
+
+// shareUnschedulable reports the shares whose pods can not be scheduled or
+// whose PVC can not be bound.
+var shareUnschedulable = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "samba_share_unschedulable",
+		Help: "Whether the pods of the SmbShare have been unschedulable, " +
+			"or its PVC unbound, for longer than the pending timeout.",
+	},
+	[]string{"namespace", "name"})
+
+func init() {
+	metrics.Registry.MustRegister(shareUnschedulable)
+}
+
+// SetEventReader sets the reader used to look up the events of a share's
+// PVC, explaining why the PVC can not be bound. Events are not watched by
+// the operator, so this should be a reader of the API server rather than
+// of the cache. If unset, no PVC events are looked up.
+func (m *SmbShareManager) SetEventReader(reader rtclient.Reader) {
+	m.events = reader
+}
+
+// pendingState describes why the resources of a share are stuck pending.
+type pendingState struct {
+	// stuck is true if a resource has been pending for longer than the
+	// pending timeout.
+	stuck   bool
+	message string
+	// reason is the reason of the Degraded condition of a stuck resource,
+	// or of the Progressing condition of a waited for resource.
+	reason string
+	// waiting describes a resource that is pending but is expected to
+	// become ready without any change, such as a PVC being provisioned.
+	waiting string
+	// recheck is the time after which a resource that is pending, but not
+	// yet stuck, should be checked again.
+	recheck time.Duration
+}
+
+// checkSchedulable checks that the PVC of the share has been bound within
+// the storage bind timeout, its pods scheduled within the pending timeout
+// and ready within the startup timeout. While the PVC waits to be bound,
+// or the pods start, the Progressing condition is set on the SmbShare. If
+// a resource is stuck, the Degraded condition is set with the reason it
+// is pending and false is returned. The returned
+// duration is the time after which the share should be checked again, or
+// zero if nothing is pending.
+func (m *SmbShareManager) checkSchedulable(
+	ctx context.Context, planner *sharePlanner, ns string) (
+	bool, time.Duration, error) {
+	// ---
+	s := planner.SmbShare
+	now := time.Now()
+	state := pendingState{}
+	var err error
+	if s.Spec.Storage.Pvc != nil {
+		state, err = m.pvcPendingState(
+			ctx, s.Spec.Storage.Pvc.Name, ns, now)
+		if err != nil {
+			return false, 0, err
+		}
+	}
+	if !state.stuck && state.waiting == "" {
+		// pods waiting for an unbound PVC can not be scheduled yet, so
+		// they are only checked once the storage is ready
+		var podsState pendingState
+		podsState, err = m.podsPendingState(ctx, planner, ns, now)
+		if err != nil {
+			return false, 0, err
+		}
+		if podsState.stuck {
+			state = podsState
+		} else {
+			state.reason, state.waiting = podsState.reason, podsState.waiting
+			state.recheck = minRecheck(state.recheck, podsState.recheck)
+		}
+	}
+	if err := m.updateProgressing(ctx, s, state); err != nil {
+		return false, 0, err
+	}
+	gauge := shareUnschedulable.WithLabelValues(s.Namespace, s.Name)
+	if !state.stuck || state.reason != ReasonUnschedulable {
+		gauge.Set(0)
+	} else {
+		gauge.Set(1)
+	}
+	if !state.stuck {
+		return true, state.recheck, nil
+	}
+	return false, pendingTimeout,
+		m.setDegraded(ctx, s, state.reason, state.message)
+}
+
+// updateProgressing sets the Progressing condition of the SmbShare while a
+// resource is waited for, recording an event when the wait starts or its
+// reason changes. The condition is only set on shares that had to wait,
+// and becomes false once the wait is over.
+func (m *SmbShareManager) updateProgressing(
+	ctx context.Context,
+	s *sambaoperatorv1alpha1.SmbShare,
+	state pendingState) error {
+	// ---
+	prev := findCondition(
+		s.Status.Conditions, sambaoperatorv1alpha1.ConditionProgressing)
+	started := state.waiting != "" && (prev == nil ||
+		prev.Status != corev1.ConditionTrue || prev.Reason != state.reason)
+	var cond sambaoperatorv1alpha1.Condition
+	switch {
+	case state.waiting != "":
+		cond = progressingCondition(s.Generation, state.reason, state.waiting)
+	case prev == nil:
+		return nil
+	case state.stuck:
+		cond = notProgressingCondition(s.Generation, state.reason)
+	default:
+		cond = notProgressingCondition(s.Generation, ReasonReconciled)
+	}
+	if !setCondition(&s.Status.Conditions, cond) {
+		return nil
+	}
+	if started {
+		m.recorder.Event(s, EventNormal, state.reason, state.waiting)
+	}
+	return m.client.Status().Update(ctx, s)
+}
+
+// podsPendingState returns the state of the pods of the share's server
+// group that have not been scheduled, or that are not ready yet.
+func (m *SmbShareManager) podsPendingState(
+	ctx context.Context,
+	planner *sharePlanner,
+	ns string,
+	now time.Time) (pendingState, error) {
+	// ---
+	pods := &corev1.PodList{}
+	err := m.client.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{
+			svcSelectorKey: labelValue(planner.instanceName()),
+		})
+	if err != nil {
+		m.logger.Error(err, "Failed to list pods", "namespace", ns)
+		return pendingState{}, err
+	}
+	state := pendingState{}
+	timeout := m.startupTimeout(planner)
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil ||
+			(pod.Status.Phase != corev1.PodPending &&
+				pod.Status.Phase != corev1.PodRunning) {
+			// ---
+			continue
+		}
+		if podScheduled(pod) {
+			ps, err := m.podStartupState(ctx, pod, now, timeout)
+			if err != nil {
+				return pendingState{}, err
+			}
+			if ps.stuck {
+				return ps, nil
+			}
+			if state.waiting == "" {
+				state.reason, state.waiting = ps.reason, ps.waiting
+			}
+			state.recheck = minRecheck(state.recheck, ps.recheck)
+			continue
+		}
+		waited := now.Sub(pod.CreationTimestamp.Time)
+		if waited < pendingTimeout {
+			state.recheck = minRecheck(state.recheck, pendingTimeout-waited)
+			continue
+		}
+		msg := fmt.Sprintf("Pod %s has not been scheduled", pod.Name)
+		if reason := unschedulableReason(pod); reason != "" {
+			msg += ": " + reason
+		}
+		return pendingState{
+			stuck: true, reason: ReasonUnschedulable, message: msg}, nil
+	}
+	return state, nil
+}
+
+// podScheduled returns true if the pod has been assigned to a node.
+func podScheduled(pod *corev1.Pod) bool {
+	if pod.Spec.NodeName != "" {
+		return true
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// unschedulableReason returns the reason the scheduler gave for not
+// scheduling the pod, as also found in its FailedScheduling events.
+func unschedulableReason(pod *corev1.Pod) string {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse {
+			return c.Message
+		}
+	}
+	return ""
+}
+
+// pvcPendingState returns the state of the named PVC if it is not bound.
+func (m *SmbShareManager) pvcPendingState(
+	ctx context.Context,
+	name, ns string,
+	now time.Time) (pendingState, error) {
+	// ---
+	if name == "" {
+		return pendingState{}, nil
+	}
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := m.client.Get(
+		ctx, types.NamespacedName{Name: name, Namespace: ns}, pvc)
+	if errors.IsNotFound(err) {
+		return pendingState{}, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get PVC",
+			"PersistentVolumeClaim.Namespace", ns,
+			"PersistentVolumeClaim.Name", name)
+		return pendingState{}, err
+	}
+	if pvc.Status.Phase != corev1.ClaimPending {
+		return pendingState{}, nil
+	}
+	waited := now.Sub(pvc.CreationTimestamp.Time)
+	if timeout := m.storageBindTimeout(); waited < timeout {
+		return pendingState{
+			reason: ReasonWaitingForStorage,
+			waiting: fmt.Sprintf("Waiting for PVC %s to be bound (%s elapsed)",
+				name, waited.Truncate(time.Second)),
+			recheck: storageRecheck(waited, timeout),
+		}, nil
+	}
+	msg := fmt.Sprintf("PVC %s has not been bound", name)
+	reason, err := m.lastWarning(ctx, pvc.Namespace, pvc.UID)
+	if err != nil {
+		return pendingState{}, err
+	}
+	if reason != "" {
+		msg += ": " + reason
+	}
+	return pendingState{
+		stuck: true, reason: ReasonUnschedulable, message: msg}, nil
+}
+
+// storageBindTimeout returns how long the PVC of a share may wait to be
+// bound before the share is reported as degraded.
+func (m *SmbShareManager) storageBindTimeout() time.Duration {
+	if m.cfg.StorageBindTimeout > 0 {
+		return m.cfg.StorageBindTimeout
+	}
+	return pendingTimeout
+}
+
+// storageRecheck returns the time after which a PVC that has waited to be
+// bound for the given time should be checked again. The checks are spaced
+// further apart as the wait grows, and the last one is made when the
+// timeout expires.
+func storageRecheck(waited, timeout time.Duration) time.Duration {
+	recheck := waited
+	if recheck < minStorageRecheck {
+		recheck = minStorageRecheck
+	} else if recheck > maxStorageRecheck {
+		recheck = maxStorageRecheck
+	}
+	if remaining := timeout - waited; remaining < recheck {
+		recheck = remaining
+	}
+	return recheck
+}
+
+// lastWarning returns the message of the most recent warning event of the
+// object with the given UID, or an empty string if there is none.
+func (m *SmbShareManager) lastWarning(
+	ctx context.Context, ns string, uid types.UID) (string, error) {
+	// ---
+	last, err := m.lastEvent(ctx, ns, uid, corev1.EventTypeWarning)
+	if err != nil || last == nil {
+		return "", err
+	}
+	return last.Message, nil
+}
+
+// lastEvent returns the most recent event of the given type, or of any
+// type if eventType is empty, of the object with the given UID. Nil is
+// returned if there is none.
+func (m *SmbShareManager) lastEvent(
+	ctx context.Context, ns string, uid types.UID, eventType string) (
+	*corev1.Event, error) {
+	// ---
+	if m.events == nil {
+		return nil, nil
+	}
+	events := &corev1.EventList{}
+	err := m.events.List(ctx, events,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingFields{"involvedObject.uid": string(uid)})
+	if err != nil {
+		m.logger.Error(err, "Failed to list events", "namespace", ns)
+		return nil, err
+	}
+	var last *corev1.Event
+	for i := range events.Items {
+		e := &events.Items[i]
+		if e.InvolvedObject.UID != uid ||
+			(eventType != "" && e.Type != eventType) {
+			// ---
+			continue
+		}
+		if last == nil || last.LastTimestamp.Before(&e.LastTimestamp) {
+			last = e
+		}
+	}
+	return last, nil
+}
+
+// minRecheck returns the shorter of two recheck times, ignoring unset
+// times.
+func minRecheck(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// forgetShareMetrics removes the metrics recorded for the share.
+func forgetShareMetrics(s *sambaoperatorv1alpha1.SmbShare) {
+	shareUnschedulable.DeleteLabelValues(s.Namespace, s.Name)
+	shareInfectedFiles.DeleteLabelValues(s.Namespace, s.Name)
+}
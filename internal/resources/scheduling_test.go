@@ -0,0 +1,251 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// pendingPod returns a pod of the share's server group that was created
+// age ago and that the scheduler could not place.
+func pendingPod(planner *sharePlanner, age time.Duration) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "myshare-abc",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			Labels: map[string]string{
+				svcSelectorKey: labelValue(planner.instanceName()),
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+			Conditions: []corev1.PodCondition{{
+				Type:    corev1.PodScheduled,
+				Status:  corev1.ConditionFalse,
+				Reason:  corev1.PodReasonUnschedulable,
+				Message: "0/3 nodes are available: 3 node(s) didn't match node selector.",
+			}},
+		},
+	}
+	return pod
+}
+
+func TestCheckSchedulablePods(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{}
+	common.Spec.PodSettings.NodeSelector = map[string]string{
+		"example.com/no-such-node": "true",
+	}
+	planner := testPlanner(share, common)
+	gauge := shareUnschedulable.WithLabelValues("default", "myshare")
+
+	// the pod was just created, the scheduler may yet find a node
+	m, _ := newTestManager(share, pendingPod(planner, time.Minute))
+	ok, recheck, err := m.checkSchedulable(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, recheck > 3*time.Minute && recheck <= 4*time.Minute)
+	assert.Equal(t, 0.0, testutil.ToFloat64(gauge))
+
+	m, recorder := newTestManager(share, pendingPod(planner, time.Hour))
+	ok, recheck, err = m.checkSchedulable(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, pendingTimeout, recheck)
+	assert.Contains(t, <-recorder.Events, ReasonUnschedulable)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, corev1.ConditionTrue, cond.Status)
+		assert.Equal(t, ReasonUnschedulable, cond.Reason)
+		assert.Equal(t,
+			"Pod myshare-abc has not been scheduled: "+
+				"0/3 nodes are available: 3 node(s) didn't match node selector.",
+			cond.Message)
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(gauge))
+
+	// once scheduled and ready, the share is fine again
+	pod := pendingPod(planner, time.Hour)
+	pod.Spec.NodeName = "node1"
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.Conditions = []corev1.PodCondition{{
+		Type:   corev1.PodReady,
+		Status: corev1.ConditionTrue,
+	}}
+	m, _ = newTestManager(share, pod)
+	ok, recheck, err = m.checkSchedulable(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), recheck)
+	assert.Equal(t, 0.0, testutil.ToFloat64(gauge))
+
+	forgetShareMetrics(share)
+}
+
+func TestCheckSchedulablePvc(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Namespace = "default"
+	share.Spec.Storage.Pvc.Name = "mypvc"
+	planner := testPlanner(share, nil)
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "mypvc",
+			Namespace:         "default",
+			UID:               "1234",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase: corev1.ClaimPending,
+		},
+	}
+	event := func(name, uid, msg string, age time.Duration) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			InvolvedObject: corev1.ObjectReference{
+				Kind: "PersistentVolumeClaim",
+				Name: "mypvc",
+				UID:  types.UID(uid),
+			},
+			Type:          corev1.EventTypeWarning,
+			Message:       msg,
+			LastTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		}
+	}
+
+	m, _ := newTestManager(share, pvc,
+		event("old", "1234", "storageclass.storage.k8s.io \"fast\" not found", time.Hour),
+		event("new", "1234", "no persistent volumes available", time.Minute),
+		event("other", "5678", "not this PVC", 0))
+	m.SetEventReader(m.client)
+	ok, _, err := m.checkSchedulable(context.TODO(), planner, "default")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, ReasonUnschedulable, cond.Reason)
+		assert.Equal(t,
+			"PVC mypvc has not been bound: no persistent volumes available",
+			cond.Message)
+	}
+
+	pvc.Status.Phase = corev1.ClaimBound
+	m, _ = newTestManager(share, pvc)
+	ok, _, err = m.checkSchedulable(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	forgetShareMetrics(share)
+}
+
+func TestCheckSchedulableSlowPvc(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Namespace = "default"
+	share.Spec.Storage.Pvc.Name = "mypvc"
+	planner := testPlanner(share, nil)
+	slowPvc := func(age time.Duration) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "mypvc",
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			},
+			Status: corev1.PersistentVolumeClaimStatus{
+				Phase: corev1.ClaimPending,
+			},
+		}
+	}
+	progressing := func() *sambaoperatorv1alpha1.Condition {
+		return findCondition(
+			share.Status.Conditions,
+			sambaoperatorv1alpha1.ConditionProgressing)
+	}
+
+	// the pods wait for the PVC, which is still being provisioned
+	m, recorder := newTestManager(
+		share, slowPvc(20*time.Second), pendingPod(planner, time.Hour))
+	m.cfg.StorageBindTimeout = 10 * time.Minute
+	ok, recheck, err := m.checkSchedulable(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, recheck >= 20*time.Second && recheck < time.Minute)
+	if cond := progressing(); assert.NotNil(t, cond) {
+		assert.Equal(t, corev1.ConditionTrue, cond.Status)
+		assert.Equal(t, ReasonWaitingForStorage, cond.Reason)
+		assert.Equal(t, "Waiting for PVC mypvc to be bound (20s elapsed)",
+			cond.Message)
+	}
+	assert.Nil(t, findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded))
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events, ReasonWaitingForStorage)
+	}
+
+	// the wait is only reported once
+	ok, _, err = m.checkSchedulable(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Len(t, recorder.Events, 0)
+
+	// the share is degraded once the timeout expires
+	m, recorder = newTestManager(share, slowPvc(11*time.Minute))
+	m.cfg.StorageBindTimeout = 10 * time.Minute
+	ok, _, err = m.checkSchedulable(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Contains(t, <-recorder.Events, ReasonUnschedulable)
+	if cond := progressing(); assert.NotNil(t, cond) {
+		assert.Equal(t, corev1.ConditionFalse, cond.Status)
+		assert.Equal(t, ReasonUnschedulable, cond.Reason)
+	}
+
+	pvc := slowPvc(11 * time.Minute)
+	pvc.Status.Phase = corev1.ClaimBound
+	m, _ = newTestManager(share, pvc)
+	ok, recheck, err = m.checkSchedulable(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), recheck)
+	if cond := progressing(); assert.NotNil(t, cond) {
+		assert.Equal(t, corev1.ConditionFalse, cond.Status)
+		assert.Equal(t, ReasonReconciled, cond.Reason)
+	}
+
+	forgetShareMetrics(share)
+}
+
+func TestStorageRecheck(t *testing.T) {
+	timeout := 5 * time.Minute
+	assert.Equal(t, 5*time.Second, storageRecheck(0, timeout))
+	assert.Equal(t, 20*time.Second, storageRecheck(20*time.Second, timeout))
+	assert.Equal(t, time.Minute, storageRecheck(3*time.Minute, timeout))
+	assert.Equal(t, 30*time.Second, storageRecheck(270*time.Second, timeout))
+}
@@ -0,0 +1,466 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+const (
+	// selfTestGenerationKey is the annotation of the self test Job holding
+	// the generation of the SmbShare it tests. The Job is replaced when
+	// the SmbShare changes.
+	selfTestGenerationKey = "samba-operator.samba.org/self-test-generation"
+	// selfTestContainerName is the name of the container running smbclient
+	// in the self test Job.
+	selfTestContainerName = "selftest"
+	// selfTestCanary is the name of the file the self test writes to the
+	// share and reads back.
+	selfTestCanary = "samba-operator-self-test"
+	// selfTestBackoffLimit is the number of times a failed self test is
+	// retried before the test fails.
+	selfTestBackoffLimit = int32(2)
+	// selfTestDeadline is the number of seconds a self test may run.
+	selfTestDeadline = int64(300)
+)
+
+// selfTestRecheck is how long to wait before checking a running self test,
+// whose Job may be in another namespace than the SmbShare and so is not
+// watched.
+const selfTestRecheck = 10 * time.Second
+
+// selfTestName returns the name of the self test Job of the share, and of
+// the Secret holding the credentials it logs in with.
+func selfTestName(s *sambaoperatorv1alpha1.SmbShare) string {
+	return s.Name + "-selftest"
+}
+
+// selfTestResources returns the resources of the self test of the share.
+func (m *SmbShareManager) selfTestResources(
+	s *sambaoperatorv1alpha1.SmbShare) []childResource {
+	// ---
+	meta := metav1.ObjectMeta{
+		Name:      selfTestName(s),
+		Namespace: m.cfg.WorkingNamespace,
+	}
+	return []childResource{
+		{"Job", &batchv1.Job{ObjectMeta: meta}},
+		{"Secret", &corev1.Secret{ObjectMeta: meta}},
+	}
+}
+
+// selfTestMode is how the self test uses the share.
+type selfTestMode string
+
+const (
+	// selfTestWrite writes the canary, reads it back and removes it.
+	selfTestWrite = selfTestMode("write")
+	// selfTestList lists the files of read-only shares.
+	selfTestList = selfTestMode("list")
+	// selfTestDropbox writes the canary to dropbox shares, which do not
+	// let guests read it back.
+	selfTestDropbox = selfTestMode("dropbox")
+)
+
+// selfTestCommands returns the smbclient commands of the self test, and
+// true if the canary read back is to be compared with the one written.
+func selfTestCommands(mode selfTestMode) (string, bool) {
+	switch mode {
+	case selfTestList:
+		return "ls", false
+	case selfTestDropbox:
+		return fmt.Sprintf("put /tmp/canary %s", selfTestCanary), false
+	}
+	return fmt.Sprintf("put /tmp/canary %s; get %s /tmp/readback; del %s",
+		selfTestCanary, selfTestCanary, selfTestCanary), true
+}
+
+// selfTestUser returns the user the self test logs in as: the first user
+// of the users config that the access control lists of the share let in.
+// Nil is returned if no such user is known to the operator.
+func selfTestUser(
+	s *sambaoperatorv1alpha1.SmbShare,
+	users *smbcc.SambaContainerConfig) *smbcc.UserEntry {
+	// ---
+	if users == nil {
+		return nil
+	}
+	valid, invalid := map[string]bool{}, map[string]bool{}
+	if ac := s.Spec.AccessControl; ac != nil {
+		for _, n := range ac.ValidUsers {
+			valid[n] = true
+		}
+		for _, n := range ac.InvalidUsers {
+			invalid[n] = true
+		}
+	}
+	entries := users.Users[smbcc.AllEntriesKey]
+	for i := range entries {
+		u := &entries[i]
+		if u.Password == "" || invalid[u.Name] ||
+			(len(valid) > 0 && !valid[u.Name]) {
+			// ---
+			continue
+		}
+		return u
+	}
+	return nil
+}
+
+// selfTestMode returns how the self test uses the share, as the given user
+// or as a guest if user is nil.
+func (sp *sharePlanner) selfTestMode(user *smbcc.UserEntry) selfTestMode {
+	s := sp.SmbShare
+	if user == nil && s.Spec.GuestAccess == "dropbox" {
+		return selfTestDropbox
+	}
+	if s.Spec.ReadOnly || readOnlyMount(s) ||
+		(user == nil && s.Spec.GuestAccess == "read") {
+		// ---
+		return selfTestList
+	}
+	return selfTestWrite
+}
+
+// newSelfTestJob returns the Job running the self test of the share. With
+// a user, the Job logs in with the credentials of the self test Secret,
+// without it as a guest.
+func newSelfTestJob(
+	planner *sharePlanner,
+	ns string,
+	user *smbcc.UserEntry) *batchv1.Job {
+	// ---
+	s := planner.SmbShare
+	commands, verify := selfTestCommands(planner.selfTestMode(user))
+	script := `set -eu
+head -c 512 /dev/urandom | od -An -tx1 > /tmp/canary
+if [ -n "${SMB_USER:-}" ]; then set -- -U "${SMB_USER}"; else set -- -N; fi
+smbclient "//${SMB_SERVER}/${SMB_SHARE}" -p "${SMB_PORT}" "$@" -c "${SMB_COMMANDS}"
+`
+	if verify {
+		script += `[ "$(cat /tmp/canary)" = "$(cat /tmp/readback)" ]
+`
+	}
+	env := []corev1.EnvVar{
+		{
+			Name: "SMB_SERVER",
+			Value: fmt.Sprintf("%s.%s.svc",
+				planner.instanceName(), ns),
+		},
+		{Name: "SMB_PORT", Value: strconv.Itoa(int(planner.smbPort()))},
+		{Name: "SMB_SHARE", Value: planner.shareName()},
+		{Name: "SMB_COMMANDS", Value: commands},
+	}
+	if user != nil {
+		// smbclient reads the password from PASSWD
+		secretEnv := func(name, key string) corev1.EnvVar {
+			return corev1.EnvVar{
+				Name: name,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: selfTestName(s),
+						},
+						Key: key,
+					},
+				},
+			}
+		}
+		env = append(env,
+			secretEnv("SMB_USER", "username"),
+			secretEnv("PASSWD", "password"))
+	}
+	backoffLimit := selfTestBackoffLimit
+	deadline := selfTestDeadline
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      selfTestName(s),
+			Namespace: ns,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "samba",
+				"app.kubernetes.io/component":  "selftest",
+				"app.kubernetes.io/managed-by": "samba-operator",
+			},
+			Annotations: map[string]string{
+				selfTestGenerationKey: strconv.FormatInt(s.Generation, 10),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &deadline,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy:    corev1.RestartPolicyNever,
+					ImagePullSecrets: planner.imagePullSecrets(),
+					Containers: []corev1.Container{{
+						Name:    selfTestContainerName,
+						Image:   planner.sambaImage(),
+						Command: []string{"/bin/sh", "-c", script},
+						Env:     env,
+					}},
+				},
+			},
+		},
+	}
+}
+
+// jobFinished returns true if the Job has finished, and if it succeeded.
+func jobFinished(job *batchv1.Job) (finished, succeeded bool) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return true, true
+		case batchv1.JobFailed:
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// updateSelfTest runs the self test of a share requesting it, once the
+// share is served, and records its result in the status of the SmbShare.
+// The resources of the test are removed once the share no longer requests
+// it. It returns true if a resource or the status was changed, and true for
+// running while the test runs, or waits for the pods of the share to be
+// ready.
+func (m *SmbShareManager) updateSelfTest(
+	ctx context.Context, planner *sharePlanner, ns string) (
+	changed, running bool, err error) {
+	// ---
+	s := planner.SmbShare
+	if !s.Spec.SelfTest || !m.cfg.SelfTestEnabled {
+		if s.Spec.SelfTest {
+			m.recorder.Event(s,
+				EventWarning,
+				ReasonSelfTestDisabled,
+				"Self tests are disabled: the operator is not run with self-test-enabled")
+		}
+		return m.removeSelfTest(ctx, s)
+	}
+	ready, err := m.servingPodReady(ctx, planner, ns)
+	if err != nil || !ready {
+		return false, true, err
+	}
+	users, err := m.getUsersConfig(ctx, planner, ns)
+	if err != nil {
+		return false, false, err
+	}
+	user := selfTestUser(s, users)
+	if user == nil && s.Spec.GuestAccess == "" {
+		m.recorder.Event(s,
+			EventWarning,
+			ReasonSelfTestUnsupported,
+			"The share can not be self tested: it allows no guests and "+
+				"no user with a password is known to the operator")
+		return false, false, nil
+	}
+	if user != nil {
+		changed, err := m.updateSelfTestSecret(ctx, planner, ns, user)
+		if err != nil || changed {
+			return changed, false, err
+		}
+	}
+
+	desired := newSelfTestJob(planner, ns, user)
+	job := &batchv1.Job{}
+	err = m.client.Get(ctx,
+		types.NamespacedName{Name: desired.Name, Namespace: ns}, job)
+	if errors.IsNotFound(err) {
+		if err := m.setOwner(s, desired); err != nil {
+			return false, false, err
+		}
+		m.logger.Info("Creating self test Job",
+			"Job.Namespace", ns, "Job.Name", desired.Name)
+		err = m.client.Create(ctx, desired, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to create self test Job",
+				"Job.Namespace", ns, "Job.Name", desired.Name)
+			return false, false, err
+		}
+		m.recorder.Eventf(s,
+			EventNormal,
+			ReasonSelfTestStarted,
+			"Started self test Job %s", desired.Name)
+		return true, true, m.setSelfTestPassed(ctx, s, nil)
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get self test Job",
+			"Job.Namespace", ns, "Job.Name", desired.Name)
+		return false, false, err
+	}
+	if job.Annotations[selfTestGenerationKey] !=
+		desired.Annotations[selfTestGenerationKey] {
+		// ---
+		// the share changed since it was tested
+		gone, err := m.deleteChild(ctx, s, childResource{"Job", job})
+		return !gone, !gone, err
+	}
+	finished, succeeded := jobFinished(job)
+	if !finished {
+		return false, true, nil
+	}
+	if s.Status.SelfTestPassed != nil && *s.Status.SelfTestPassed == succeeded {
+		return false, false, nil
+	}
+	if succeeded {
+		m.recorder.Eventf(s,
+			EventNormal,
+			ReasonSelfTestPassed,
+			"Self test Job %s passed", job.Name)
+	} else {
+		m.recorder.Eventf(s,
+			EventWarning,
+			ReasonSelfTestFailed,
+			"Self test Job %s failed, see the logs of its pods", job.Name)
+	}
+	return true, false, m.setSelfTestPassed(ctx, s, &succeeded)
+}
+
+// setSelfTestPassed records the result of the self test in the status of
+// the SmbShare, if it changed.
+func (m *SmbShareManager) setSelfTestPassed(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare, passed *bool) error {
+	// ---
+	if reflect.DeepEqual(s.Status.SelfTestPassed, passed) {
+		return nil
+	}
+	s.Status.SelfTestPassed = passed
+	return m.client.Status().Update(ctx, s)
+}
+
+// removeSelfTest deletes the resources of the self test and clears its
+// result from the status of the SmbShare.
+func (m *SmbShareManager) removeSelfTest(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (
+	changed, running bool, err error) {
+	// ---
+	for _, child := range m.selfTestResources(s) {
+		gone, err := m.deleteChild(ctx, s, child)
+		if err != nil {
+			return false, false, err
+		} else if !gone {
+			return true, false, nil
+		}
+	}
+	if s.Status.SelfTestPassed == nil {
+		return false, false, nil
+	}
+	return true, false, m.setSelfTestPassed(ctx, s, nil)
+}
+
+// servingPodReady returns true if a pod serving the share is ready.
+func (m *SmbShareManager) servingPodReady(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	pods := &corev1.PodList{}
+	err := m.client.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{
+			svcSelectorKey: labelValue(planner.instanceName()),
+		})
+	if err != nil {
+		m.logger.Error(err, "Failed to list pods", "namespace", ns)
+		return false, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp == nil && podReady(pod) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// updateSelfTestSecret stores the credentials of the user the self test
+// logs in as in the self test Secret. It returns true if the Secret was
+// created or changed.
+func (m *SmbShareManager) updateSelfTestSecret(
+	ctx context.Context,
+	planner *sharePlanner,
+	ns string,
+	user *smbcc.UserEntry) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	desired := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      selfTestName(s),
+			Namespace: ns,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "samba-operator",
+			},
+		},
+		Data: map[string][]byte{
+			"username": []byte(user.Name),
+			"password": []byte(user.Password),
+		},
+	}
+	if err := m.setOwner(s, desired); err != nil {
+		return false, err
+	}
+	found := &corev1.Secret{}
+	err := m.client.Get(ctx,
+		types.NamespacedName{Name: desired.Name, Namespace: ns}, found)
+	if errors.IsNotFound(err) {
+		m.logger.Info("Creating a new Secret",
+			"Secret.Namespace", ns, "Secret.Name", desired.Name)
+		err = m.client.Create(ctx, desired, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to create new Secret",
+				"Secret.Namespace", ns, "Secret.Name", desired.Name)
+			return false, err
+		}
+		m.recorder.Eventf(s,
+			EventNormal,
+			ReasonCreatedSecret,
+			"Created Secret %s holding the credentials of the self test",
+			desired.Name)
+		return true, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get Secret",
+			"Secret.Namespace", ns, "Secret.Name", desired.Name)
+		return false, err
+	}
+	if reflect.DeepEqual(found.Data, desired.Data) {
+		return false, nil
+	}
+	found.Data = desired.Data
+	if err := m.writeChild(ctx, found, desired); err != nil {
+		m.logger.Error(err, "Failed to update Secret",
+			"Secret.Namespace", ns, "Secret.Name", found.Name)
+		return false, err
+	}
+	m.recorder.Eventf(s,
+		EventNormal,
+		ReasonUpdatedSecret,
+		"Updated the credentials of the self test in Secret %s", found.Name)
+	return true, nil
+}
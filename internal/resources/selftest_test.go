@@ -0,0 +1,225 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// readyPod returns a ready pod serving the server group.
+func readyPod(group string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      group + "-pod",
+			Namespace: "default",
+			Labels:    map[string]string{svcSelectorKey: group},
+		},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+}
+
+func TestNewSelfTestJob(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.ShareName = "My Share"
+	share.Generation = 3
+	planner := testPlanner(share, nil)
+	alice := &smbcc.UserEntry{Name: "alice", Password: "wond3r1and"}
+	job := newSelfTestJob(planner, "default", alice)
+	assert.Equal(t, "myshare-selftest", job.Name)
+	assert.Equal(t, "3", job.Annotations[selfTestGenerationKey])
+	assert.NotContains(t, job.Labels, svcSelectorKey)
+	podSpec := job.Spec.Template.Spec
+	assert.Equal(t, corev1.RestartPolicyNever, podSpec.RestartPolicy)
+	ctr := podSpec.Containers[0]
+	assert.Equal(t, planner.sambaImage(), ctr.Image)
+	assert.Equal(t, "myshare.default.svc", envValue(ctr.Env, "SMB_SERVER"))
+	assert.Equal(t, "445", envValue(ctr.Env, "SMB_PORT"))
+	assert.Equal(t, "My Share", envValue(ctr.Env, "SMB_SHARE"))
+	assert.Contains(t, envValue(ctr.Env, "SMB_COMMANDS"), "get samba-operator-self-test")
+	assert.Contains(t, ctr.Command[2], `"$(cat /tmp/readback)"`)
+	var password *corev1.EnvVar
+	for i := range ctr.Env {
+		if ctr.Env[i].Name == "PASSWD" {
+			password = &ctr.Env[i]
+		}
+	}
+	if assert.NotNil(t, password) {
+		assert.Equal(t, "myshare-selftest",
+			password.ValueFrom.SecretKeyRef.Name)
+		assert.Equal(t, "password", password.ValueFrom.SecretKeyRef.Key)
+	}
+
+	// read-only shares are listed
+	share.Spec.ReadOnly = true
+	ctr = newSelfTestJob(planner, "default", alice).Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "ls", envValue(ctr.Env, "SMB_COMMANDS"))
+	assert.NotContains(t, ctr.Command[2], "readback")
+
+	// guests of dropbox shares can only write
+	share.Spec.ReadOnly = false
+	share.Spec.GuestAccess = "dropbox"
+	ctr = newSelfTestJob(planner, "default", nil).Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "put /tmp/canary samba-operator-self-test",
+		envValue(ctr.Env, "SMB_COMMANDS"))
+	assert.Equal(t, "", envValue(ctr.Env, "PASSWD"))
+}
+
+func TestSelfTestUser(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	users := &smbcc.SambaContainerConfig{
+		Users: map[smbcc.Key]smbcc.UserEntries{
+			smbcc.AllEntriesKey: {
+				{Name: "nopass"},
+				{Name: "alice", Password: "wond3r1and"},
+				{Name: "bob", Password: "r0b0t"},
+			},
+		},
+	}
+	assert.Equal(t, "alice", selfTestUser(share, users).Name)
+	share.Spec.AccessControl = &sambaoperatorv1alpha1.SmbShareAccessControl{
+		InvalidUsers: []string{"alice"},
+	}
+	assert.Equal(t, "bob", selfTestUser(share, users).Name)
+	share.Spec.AccessControl.ValidUsers = []string{"@staff"}
+	assert.Nil(t, selfTestUser(share, users))
+	assert.Nil(t, selfTestUser(share, nil))
+}
+
+func TestUpdateSelfTest(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Generation = 1
+	share.Spec.SelfTest = true
+	planner := localGroupsPlanner(share)
+	users := usersSecret("users", "demousers",
+		smbcc.UserEntry{Name: "alice", Password: "wond3r1and"})
+	m, recorder := newTestManager(share, users, readyPod("myshare"))
+	ctx := context.TODO()
+
+	// the operator must allow self tests
+	changed, running, err := m.updateSelfTest(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.False(t, running)
+	assert.Contains(t, <-recorder.Events, ReasonSelfTestDisabled)
+
+	m.cfg.SelfTestEnabled = true
+	changed, _, err = m.updateSelfTest(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonCreatedSecret)
+	secret := &corev1.Secret{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare-selftest"},
+		secret))
+	assert.Equal(t, "alice", string(secret.Data["username"]))
+	assert.Equal(t, "wond3r1and", string(secret.Data["password"]))
+
+	changed, running, err = m.updateSelfTest(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, running)
+	assert.Contains(t, <-recorder.Events, ReasonSelfTestStarted)
+	job := &batchv1.Job{}
+	key := types.NamespacedName{Namespace: "default", Name: "myshare-selftest"}
+	require.NoError(t, m.client.Get(ctx, key, job))
+	if assert.Len(t, job.OwnerReferences, 1) {
+		assert.Equal(t, "myshare", job.OwnerReferences[0].Name)
+	}
+
+	// the test runs until the Job finishes
+	changed, running, err = m.updateSelfTest(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.True(t, running)
+	assert.Nil(t, share.Status.SelfTestPassed)
+
+	// a healthy share passes
+	job.Status.Conditions = []batchv1.JobCondition{{
+		Type:   batchv1.JobComplete,
+		Status: corev1.ConditionTrue,
+	}}
+	require.NoError(t, m.client.Status().Update(ctx, job))
+	changed, running, err = m.updateSelfTest(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.False(t, running)
+	assert.Contains(t, <-recorder.Events, ReasonSelfTestPassed)
+	found := &sambaoperatorv1alpha1.SmbShare{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare"}, found))
+	if assert.NotNil(t, found.Status.SelfTestPassed) {
+		assert.True(t, *found.Status.SelfTestPassed)
+	}
+	changed, _, err = m.updateSelfTest(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// the test is rerun once the share changes
+	share.Generation = 2
+	changed, running, err = m.updateSelfTest(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, running)
+	assert.Contains(t, <-recorder.Events, ReasonDeleting)
+
+	// shares no longer self tested lose the result and the resources
+	share.Spec.SelfTest = false
+	changed, _, err = m.updateSelfTest(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+}
+
+func TestUpdateSelfTestUnsupported(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.SelfTest = true
+	planner := domainPlanner(share, `DOMAIN1\bwayne`)
+	m, recorder := newTestManager(share, readyPod("myshare"))
+	m.cfg.SelfTestEnabled = true
+	changed, running, err := m.updateSelfTest(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.False(t, running)
+	assert.Contains(t, <-recorder.Events, ReasonSelfTestUnsupported)
+
+	// nothing is tested until a pod is ready
+	m, recorder = newTestManager(share)
+	m.cfg.SelfTestEnabled = true
+	changed, running, err = m.updateSelfTest(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.True(t, running)
+	assert.Len(t, recorder.Events, 0)
+}
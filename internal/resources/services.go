@@ -16,31 +16,49 @@ limitations under the License.
 package resources
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 var svcSelectorKey = "samba-operator.samba.org/service"
 
+// externalDNSHostnameKey is the Service annotation ExternalDNS reads the
+// hostnames to publish from.
+const externalDNSHostnameKey = "external-dns.alpha.kubernetes.io/hostname"
+
 func newServiceForSmb(planner *sharePlanner, ns string) *corev1.Service {
 	// as of now we only generate ClusterIP type services
 	labels := labelsForSmbServer(planner.instanceName())
+	affinity, affinityConfig := planner.sessionAffinity()
 	return &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      planner.instanceName(),
-			Namespace: ns,
-			Labels:    labels,
+			Name:        planner.instanceName(),
+			Namespace:   ns,
+			Labels:      labels,
+			Annotations: serviceAnnotations(planner),
 		},
 		Spec: corev1.ServiceSpec{
 			Type: toServiceType(planner.serviceType()),
 			Ports: []corev1.ServicePort{{
-				Name:     "smb",
-				Protocol: corev1.ProtocolTCP,
-				Port:     445,
+				Name:       "smb",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       planner.smbPort(),
+				TargetPort: intstr.FromInt(int(planner.smbPort())),
 			}},
 			Selector: map[string]string{
 				svcSelectorKey: labels[svcSelectorKey],
 			},
+			SessionAffinity:       affinity,
+			SessionAffinityConfig: affinityConfig,
 		},
 	}
 }
@@ -56,3 +74,227 @@ func toServiceType(s string) corev1.ServiceType {
 	}
 	return svcType
 }
+
+// serviceAnnotations returns the annotations of the share's Service, or nil
+// if there are none.
+func serviceAnnotations(planner *sharePlanner) map[string]string {
+	annotations := planner.healthCheckAnnotations()
+	names := planner.publishDNSNames()
+	if len(names) == 0 {
+		return annotations
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[externalDNSHostnameKey] = strings.Join(names, ",")
+	return annotations
+}
+
+// updateServiceDNSNames copies the ExternalDNS hostname annotation from the
+// desired service into the current service. It returns true if the current
+// service was changed.
+func updateServiceDNSNames(current, desired *corev1.Service) bool {
+	return updateServiceAnnotation(current, desired, externalDNSHostnameKey)
+}
+
+// updateServiceHealthCheck copies the annotations telling external health
+// checks how to probe the service from the desired service into the current
+// service. It returns true if the current service was changed.
+func updateServiceHealthCheck(current, desired *corev1.Service) bool {
+	changed := updateServiceAnnotation(
+		current, desired, healthCheckAnnotationKey)
+	if updateServiceAnnotation(
+		current, desired, healthCheckPortAnnotationKey) {
+		// ---
+		changed = true
+	}
+	return changed
+}
+
+// updateServiceAnnotation copies the annotation of the given key from the
+// desired service into the current service, removing it from the current
+// service if the desired service lacks it. It returns true if the current
+// service was changed.
+func updateServiceAnnotation(current, desired *corev1.Service, key string) bool {
+	want, found := desired.Annotations[key]
+	cur, curFound := current.Annotations[key]
+	if found == curFound && want == cur {
+		return false
+	}
+	if !found {
+		delete(current.Annotations, key)
+		return true
+	}
+	if current.Annotations == nil {
+		current.Annotations = map[string]string{}
+	}
+	current.Annotations[key] = want
+	return true
+}
+
+// updateServicePorts copies the port numbers of the desired service into
+// the ports of the same name of the current service, keeping any node port
+// already assigned. It returns true if the current service was changed.
+func updateServicePorts(current, desired *corev1.Service) bool {
+	changed := false
+	for i := range current.Spec.Ports {
+		cur := &current.Spec.Ports[i]
+		for _, want := range desired.Spec.Ports {
+			if cur.Name != want.Name {
+				continue
+			}
+			if cur.Port != want.Port {
+				cur.Port = want.Port
+				changed = true
+			}
+			if cur.TargetPort != want.TargetPort {
+				cur.TargetPort = want.TargetPort
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// updateServiceSelector copies the selector of the desired service into the
+// current service, such as a service created outside of the operator and
+// adopted for a share. It returns true if the current service was changed.
+func updateServiceSelector(current, desired *corev1.Service) bool {
+	if equality.Semantic.DeepEqual(current.Spec.Selector, desired.Spec.Selector) {
+		return false
+	}
+	current.Spec.Selector = desired.Spec.Selector
+	return true
+}
+
+// updateServiceSessionAffinity copies the session affinity of the desired
+// service into the current service. It returns true if the current service
+// was changed.
+func updateServiceSessionAffinity(current, desired *corev1.Service) bool {
+	cur := current.Spec.SessionAffinity
+	if cur == "" {
+		// the API server defaults to no affinity
+		cur = corev1.ServiceAffinityNone
+	}
+	if cur == desired.Spec.SessionAffinity &&
+		(cur == corev1.ServiceAffinityNone || equality.Semantic.DeepEqual(
+			current.Spec.SessionAffinityConfig,
+			desired.Spec.SessionAffinityConfig)) {
+		// ---
+		return false
+	}
+	current.Spec.SessionAffinity = desired.Spec.SessionAffinity
+	current.Spec.SessionAffinityConfig = desired.Spec.SessionAffinityConfig
+	return true
+}
+
+// updateServiceType copies the type of the desired service into the
+// current service. It returns true if the current service was changed.
+func updateServiceType(current, desired *corev1.Service) bool {
+	if current.Spec.Type == desired.Spec.Type {
+		return false
+	}
+	current.Spec.Type = desired.Spec.Type
+	if current.Spec.Type == corev1.ServiceTypeClusterIP {
+		// node ports are only permitted on NodePort and LoadBalancer
+		// services.
+		for i := range current.Spec.Ports {
+			current.Spec.Ports[i].NodePort = 0
+		}
+	}
+	return true
+}
+
+// The IP family policy and the list of IP families of a Service were added
+// in a Kubernetes API version newer than the one used by the operator. They
+// are read and written using unstructured Services.
+var (
+	ipFamilyPolicyField = []string{"spec", "ipFamilyPolicy"}
+	ipFamiliesField     = []string{"spec", "ipFamilies"}
+)
+
+// unstructuredService returns an unstructured copy of svc with the IP
+// family policy and IP families of the server group set.
+func unstructuredService(
+	planner *sharePlanner, svc *corev1.Service) (*unstructured.Unstructured, error) {
+	// ---
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(svc)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: obj}
+	u.SetAPIVersion("v1")
+	u.SetKind("Service")
+	setServiceIPFamilies(u, planner.ipFamilyPolicy(), planner.ipFamilies())
+	return u, nil
+}
+
+func setServiceIPFamilies(
+	u *unstructured.Unstructured, policy string, families []string) {
+	// ---
+	if policy != "" {
+		_ = unstructured.SetNestedField(u.Object, policy, ipFamilyPolicyField...)
+	}
+	if len(families) > 0 {
+		_ = unstructured.SetNestedStringSlice(
+			u.Object, families, ipFamiliesField...)
+	}
+}
+
+// serviceIPFamilies returns the IP family policy and IP families of an
+// unstructured Service.
+func serviceIPFamilies(u *unstructured.Unstructured) (string, []string) {
+	policy, _, _ := unstructured.NestedString(u.Object, ipFamilyPolicyField...)
+	families, _, _ := unstructured.NestedStringSlice(u.Object, ipFamiliesField...)
+	return policy, families
+}
+
+// ipFamiliesProblem compares the IP families of a Service to the requested
+// IP family policy and families. It returns a description of how the
+// Service falls short of the request or an empty string if it does not.
+func ipFamiliesProblem(
+	wantPolicy string,
+	wantFamilies []string,
+	policy string,
+	families []string) string {
+	// ---
+	if policy == "" {
+		return "The cluster does not support IP family policies"
+	}
+	if len(wantFamilies) > 0 && (len(families) == 0 || families[0] != wantFamilies[0]) {
+		return fmt.Sprintf(
+			"Service has primary IP family %s instead of %s; "+
+				"the primary family of an existing Service can not be changed",
+			strings.Join(families, ","), wantFamilies[0])
+	}
+	if wantPolicy == "PreferDualStack" && len(families) < 2 {
+		return fmt.Sprintf(
+			"The cluster does not support dual-stack Services; "+
+				"Service is single-stack %s", strings.Join(families, ","))
+	}
+	return ""
+}
+
+// validDNSName returns true if name is a valid DNS hostname. A trailing dot,
+// marking a fully qualified name, is permitted.
+func validDNSName(name string) bool {
+	errs := validation.IsDNS1123Subdomain(strings.TrimSuffix(name, "."))
+	return len(errs) == 0
+}
+
+// validDNSAlias returns true if alias is a valid host name within a domain.
+func validDNSAlias(alias string) bool {
+	return len(validation.IsDNS1123Label(alias)) == 0
+}
+
+// sortedUnique sorts the given names and removes duplicates.
+func sortedUnique(names []string) []string {
+	sort.Strings(names)
+	out := []string{}
+	for i, n := range names {
+		if i == 0 || n != names[i-1] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
@@ -0,0 +1,300 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+func TestValidDNSName(t *testing.T) {
+	assert.True(t, validDNSName("files.example.com"))
+	assert.True(t, validDNSName("files.example.com."))
+	assert.True(t, validDNSName("files"))
+	assert.False(t, validDNSName("files..example.com"))
+	assert.False(t, validDNSName("-files.example.com"))
+	assert.False(t, validDNSName("files_1.example.com"))
+}
+
+func TestServiceDNSNames(t *testing.T) {
+	one := sambaoperatorv1alpha1.SmbShare{}
+	one.Name = "one"
+	planner := testPlanner(&one, nil)
+	svc := newServiceForSmb(planner, "default")
+	assert.Nil(t, svc.Annotations)
+
+	one.Spec.PublishDNSName = "files.example.com"
+	two := sambaoperatorv1alpha1.SmbShare{}
+	two.Spec.PublishDNSName = "archive.example.com"
+	three := sambaoperatorv1alpha1.SmbShare{}
+	three.Spec.PublishDNSName = "not_valid"
+	planner.GroupShares = []sambaoperatorv1alpha1.SmbShare{one, two, three}
+	desired := newServiceForSmb(planner, "default")
+	assert.Equal(t,
+		"archive.example.com,files.example.com",
+		desired.Annotations[externalDNSHostnameKey])
+
+	assert.True(t, updateServiceDNSNames(svc, desired))
+	assert.Equal(t,
+		"archive.example.com,files.example.com",
+		svc.Annotations[externalDNSHostnameKey])
+	assert.False(t, updateServiceDNSNames(svc, desired))
+
+	planner.GroupShares = nil
+	one.Spec.PublishDNSName = ""
+	assert.True(t, updateServiceDNSNames(svc, newServiceForSmb(planner, "default")))
+	assert.NotContains(t, svc.Annotations, externalDNSHostnameKey)
+}
+
+func TestValidateDNSName(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.PublishDNSName = "files.example.com"
+	m, recorder := newTestManager(share)
+
+	valid, err := m.validateDNSName(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	changed, err := m.updatePublishedDNSName(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "files.example.com", share.Status.PublishedDNSName)
+
+	share.Spec.PublishDNSName = "files..example.com"
+	valid, err = m.validateDNSName(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidDNSName)
+
+	share.Spec.PublishDNSName = ""
+	share.Spec.DNSAliases = []string{"files", "files.example.com"}
+	valid, err = m.validateDNSName(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "Invalid DNS alias: files.example.com")
+}
+
+func TestServiceTypeRoute(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.Network.Publish = "external"
+	planner := testPlanner(share, common)
+	svc := newServiceForSmb(planner, "default")
+	assert.Equal(t, corev1.ServiceTypeLoadBalancer, svc.Spec.Type)
+	assert.False(t, planner.routeRequested())
+
+	// routes are served from a node port
+	common.Spec.Network.Publish = "route"
+	desired := newServiceForSmb(planner, "default")
+	assert.Equal(t, corev1.ServiceTypeNodePort, desired.Spec.Type)
+	assert.True(t, planner.routeRequested())
+	svc.Spec.Ports[0].NodePort = 30445
+	assert.True(t, updateServiceType(svc, desired))
+	assert.Equal(t, corev1.ServiceTypeNodePort, svc.Spec.Type)
+	assert.EqualValues(t, 30445, svc.Spec.Ports[0].NodePort)
+	assert.False(t, updateServiceType(svc, desired))
+
+	// node ports are dropped from cluster services
+	common.Spec.Network.Publish = "cluster"
+	assert.True(t, updateServiceType(svc, newServiceForSmb(planner, "default")))
+	assert.Equal(t, corev1.ServiceTypeClusterIP, svc.Spec.Type)
+	assert.EqualValues(t, 0, svc.Spec.Ports[0].NodePort)
+}
+
+func TestCheckRouteSupport(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.Network.Publish = "cluster"
+	planner := testPlanner(share, common)
+	m, recorder := newTestManager()
+
+	m.checkRouteSupport(planner)
+	assert.Len(t, recorder.Events, 0)
+
+	common.Spec.Network.Publish = "route"
+	m.checkRouteSupport(planner)
+	assert.Contains(t, <-recorder.Events, "Route API is not available")
+
+	m.SetCapabilities(Capabilities{Routes: true})
+	m.checkRouteSupport(planner)
+	event := <-recorder.Events
+	assert.Contains(t, event, ReasonRouteUnsupported)
+	assert.Contains(t, event, "only carry HTTP and TLS traffic")
+}
+
+func TestIPFamiliesProblem(t *testing.T) {
+	assert.Contains(t,
+		ipFamiliesProblem("SingleStack", []string{"IPv6"}, "", nil),
+		"does not support IP family policies")
+	assert.Equal(t, "",
+		ipFamiliesProblem("SingleStack", []string{"IPv6"},
+			"SingleStack", []string{"IPv6"}))
+	assert.Contains(t,
+		ipFamiliesProblem("SingleStack", []string{"IPv6"},
+			"SingleStack", []string{"IPv4"}),
+		"primary IP family IPv4 instead of IPv6")
+	assert.Contains(t,
+		ipFamiliesProblem("PreferDualStack", nil,
+			"PreferDualStack", []string{"IPv4"}),
+		"does not support dual-stack")
+	assert.Equal(t, "",
+		ipFamiliesProblem("PreferDualStack", []string{"IPv6", "IPv4"},
+			"PreferDualStack", []string{"IPv6", "IPv4"}))
+}
+
+func TestServiceIPFamilies(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.Network.IPFamilyPolicy = "SingleStack"
+	common.Spec.Network.IPFamilies = []sambaoperatorv1alpha1.SmbIPFamily{"IPv6"}
+	planner := testPlanner(share, common)
+	m, recorder := newTestManager()
+	ctx := context.TODO()
+
+	// clusters before Kubernetes 1.20 get a plain service and a warning
+	svc := newServiceForSmb(planner, "default")
+	assert.NoError(t, m.createService(ctx, planner, svc))
+	changed, err := m.updateServiceIPFamilies(ctx, planner, svc)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonIPFamilyUnsupported)
+
+	m, recorder = newTestManager()
+	m.SetCapabilities(Capabilities{IPFamilyPolicy: true})
+	svc = newServiceForSmb(planner, "default")
+	assert.NoError(t, m.createService(ctx, planner, svc))
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("Service")
+	assert.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare"}, u))
+	policy, families := serviceIPFamilies(u)
+	assert.Equal(t, "SingleStack", policy)
+	assert.Equal(t, []string{"IPv6"}, families)
+	changed, err = m.updateServiceIPFamilies(ctx, planner, svc)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Len(t, recorder.Events, 0)
+
+	// the policy of an existing service is changed
+	common.Spec.Network.IPFamilyPolicy = "PreferDualStack"
+	common.Spec.Network.IPFamilies =
+		[]sambaoperatorv1alpha1.SmbIPFamily{"IPv6", "IPv4"}
+	changed, err = m.updateServiceIPFamilies(ctx, planner, svc)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare"}, u))
+	policy, families = serviceIPFamilies(u)
+	assert.Equal(t, "PreferDualStack", policy)
+	assert.Equal(t, []string{"IPv6", "IPv4"}, families)
+}
+
+func TestServicePorts(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	svc := newServiceForSmb(planner, "default")
+	assert.Equal(t, int32(445), svc.Spec.Ports[0].Port)
+	svc.Spec.Ports[0].NodePort = 30445
+
+	port := int32(4450)
+	share.Spec.Port = &port
+	desired := newServiceForSmb(planner, "default")
+	assert.True(t, updateServicePorts(svc, desired))
+	assert.Equal(t, int32(4450), svc.Spec.Ports[0].Port)
+	assert.Equal(t, 4450, svc.Spec.Ports[0].TargetPort.IntValue())
+	assert.Equal(t, int32(30445), svc.Spec.Ports[0].NodePort)
+	assert.False(t, updateServicePorts(svc, desired))
+}
+
+func TestServiceSessionAffinity(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	// the service of a single pod has no affinity
+	svc := newServiceForSmb(planner, "default")
+	assert.Equal(t, corev1.ServiceAffinityNone, svc.Spec.SessionAffinity)
+	assert.Nil(t, svc.Spec.SessionAffinityConfig)
+	current := svc.DeepCopy()
+	current.Spec.SessionAffinity = ""
+	assert.False(t, updateServiceSessionAffinity(current, svc))
+
+	// the connections of a client stick to one pod of clustered shares
+	affinity, config := sessionAffinity(nil, 3)
+	assert.Equal(t, corev1.ServiceAffinityClientIP, affinity)
+	if assert.NotNil(t, config) && assert.NotNil(t, config.ClientIP) {
+		assert.EqualValues(t, 10800, *config.ClientIP.TimeoutSeconds)
+	}
+	timeout := int32(600)
+	spec := &sambaoperatorv1alpha1.SmbServiceSessionAffinity{
+		Type:           "ClientIP",
+		TimeoutSeconds: &timeout,
+	}
+	affinity, config = sessionAffinity(spec, 3)
+	assert.Equal(t, corev1.ServiceAffinityClientIP, affinity)
+	assert.EqualValues(t, 600, *config.ClientIP.TimeoutSeconds)
+	desired := svc.DeepCopy()
+	desired.Spec.SessionAffinity = affinity
+	desired.Spec.SessionAffinityConfig = config
+	assert.True(t, updateServiceSessionAffinity(current, desired))
+	assert.Equal(t, corev1.ServiceAffinityClientIP, current.Spec.SessionAffinity)
+	assert.False(t, updateServiceSessionAffinity(current, desired))
+	// a changed timeout is updated
+	_, desired.Spec.SessionAffinityConfig = sessionAffinity(nil, 3)
+	assert.True(t, updateServiceSessionAffinity(current, desired))
+	assert.EqualValues(t, 10800, *current.Spec.SessionAffinityConfig.ClientIP.TimeoutSeconds)
+
+	// the affinity of clustered shares can be turned off
+	spec.Type = "None"
+	affinity, config = sessionAffinity(spec, 3)
+	assert.Equal(t, corev1.ServiceAffinityNone, affinity)
+	assert.Nil(t, config)
+	// and is ignored for single pods
+	common.Spec.Network.ServiceSessionAffinity = &sambaoperatorv1alpha1.SmbServiceSessionAffinity{
+		Type: "ClientIP",
+	}
+	assert.Equal(t,
+		corev1.ServiceAffinityNone,
+		newServiceForSmb(planner, "default").Spec.SessionAffinity)
+}
+
+func TestValidatePort(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Namespace = "default"
+	planner := testPlanner(share, nil)
+	m, recorder := newTestManager(share)
+	m.cfg.SmbdContainerName = "samba"
+
+	valid, err := m.validatePort(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	port := int32(0)
+	share.Spec.Port = &port
+	valid, err = m.validatePort(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "Invalid port: 0")
+}
@@ -0,0 +1,263 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// shareUsersSecretName returns the name of the Secret holding the users of
+// the server group, merged from the users of the security config and the
+// users secrets of the group's shares.
+func shareUsersSecretName(group string) string {
+	return group + "-users"
+}
+
+// shareUsers is the users secret of a share of the server group.
+type shareUsers struct {
+	share string
+	spec  *sambaoperatorv1alpha1.SmbShareUsersSpec
+}
+
+// shareUsers returns the users secrets of the shares of the server group.
+func (sp *sharePlanner) shareUsers() []shareUsers {
+	users := []shareUsers{}
+	shares := sp.groupShares()
+	for i := range shares {
+		if spec := shares[i].Spec.Users; spec != nil {
+			users = append(users, shareUsers{shares[i].Name, spec})
+		}
+	}
+	return users
+}
+
+// mergesShareUsers returns true if shares of the server group add users to
+// the users of the security config.
+func (sp *sharePlanner) mergesShareUsers() bool {
+	return sp.securityMode() == userMode && len(sp.shareUsers()) > 0
+}
+
+// validateShareUsers checks that the users secrets of the shares of the
+// server group exist, and that the shares do not define the same user
+// differently. If not, the Degraded condition is set on the SmbShare and
+// false is returned.
+func (m *SmbShareManager) validateShareUsers(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	if len(planner.shareUsers()) == 0 {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(ctx, s, ReasonInvalidShareUsers, msg)
+	}
+	uss := planner.securityConfigUserSource()
+	if planner.securityMode() != userMode || !uss.Configured {
+		return degraded(
+			"Users can only be added to the users of a security config in user mode")
+	}
+	if uss.CSIVolume != nil {
+		return degraded(fmt.Sprintf(
+			"Users can not be added to the CSI secret volume of security config %s",
+			planner.SecurityConfig.Name))
+	}
+	defined := map[string]smbcc.UserEntry{}
+	definedBy := map[string]string{}
+	for _, su := range planner.shareUsers() {
+		users, found, err := m.getUsersSecretConfig(
+			ctx, ns, su.spec.Secret, su.spec.Key)
+		if err != nil {
+			return false, err
+		} else if users == nil && !found {
+			return degraded(fmt.Sprintf(
+				"Users secret %s of SmbShare %s is missing or has no key %s",
+				su.spec.Secret, su.share, su.spec.Key))
+		} else if users == nil {
+			return degraded(fmt.Sprintf(
+				"Key %s of users secret %s of SmbShare %s is not a valid users config",
+				su.spec.Key, su.spec.Secret, su.share))
+		}
+		for _, u := range users.Users[smbcc.AllEntriesKey] {
+			if !validAccountName(u.Name, userMode) {
+				return degraded(fmt.Sprintf(
+					"Invalid user name in users secret %s of SmbShare %s: %q",
+					su.spec.Secret, su.share, u.Name))
+			}
+			other, seen := defined[u.Name]
+			if seen && !reflect.DeepEqual(other, u) {
+				return degraded(fmt.Sprintf(
+					"SmbShares %s and %s define user %s differently",
+					definedBy[u.Name], su.share, u.Name))
+			}
+			defined[u.Name] = u
+			definedBy[u.Name] = su.share
+		}
+	}
+	return true, nil
+}
+
+// mergeShareUsers returns the users config of the security config with the
+// users of the shares added to it. A user of a share replaces the user of
+// the same name of the security config.
+func mergeShareUsers(
+	base *smbcc.SambaContainerConfig,
+	shares []*smbcc.SambaContainerConfig) *smbcc.SambaContainerConfig {
+	// ---
+	merged := &smbcc.SambaContainerConfig{
+		SCCVersion: base.SCCVersion,
+		Users:      map[smbcc.Key]smbcc.UserEntries{},
+		Groups:     base.Groups,
+	}
+	if merged.SCCVersion == "" {
+		merged.SCCVersion = smbcc.New().SCCVersion
+	}
+	added := smbcc.UserEntries{}
+	names := map[string]bool{}
+	for _, cc := range shares {
+		for _, u := range cc.Users[smbcc.AllEntriesKey] {
+			if !names[u.Name] {
+				added = append(added, u)
+				names[u.Name] = true
+			}
+		}
+	}
+	entries := smbcc.UserEntries{}
+	for _, u := range base.Users[smbcc.AllEntriesKey] {
+		if !names[u.Name] {
+			entries = append(entries, u)
+		}
+	}
+	merged.Users[smbcc.AllEntriesKey] = append(entries, added...)
+	return merged
+}
+
+// generateShareUsersConfig returns the users of the security config merged
+// with the users of the shares of the server group, or nil if the users of
+// the security config are missing or mounted from a CSI volume.
+func (m *SmbShareManager) generateShareUsersConfig(
+	ctx context.Context, planner *sharePlanner, ns string) (
+	*smbcc.SambaContainerConfig, error) {
+	// ---
+	base, err := m.getSecurityConfigUsers(ctx, planner, ns)
+	if err != nil || base == nil {
+		return nil, err
+	}
+	shares := []*smbcc.SambaContainerConfig{}
+	for _, su := range planner.shareUsers() {
+		users, _, err := m.getUsersSecretConfig(
+			ctx, ns, su.spec.Secret, su.spec.Key)
+		if err != nil {
+			return nil, err
+		} else if users != nil {
+			shares = append(shares, users)
+		}
+	}
+	return mergeShareUsers(base, shares), nil
+}
+
+// updateShareUsersSecret stores the users of the security config, merged
+// with the users of the shares of the server group, in the Secret mounted
+// by the share's pods. The Secret is a resource of the server group. It
+// returns true if the Secret was created or changed.
+func (m *SmbShareManager) updateShareUsersSecret(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	if !planner.mergesShareUsers() {
+		return false, nil
+	}
+	s := planner.SmbShare
+	merged, err := m.generateShareUsersConfig(ctx, planner, ns)
+	if err != nil {
+		return false, err
+	} else if merged == nil {
+		// the pods wait for the users of the security config
+		return false, nil
+	}
+	// we use marshal indent so that the json is semi-human-readable
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	desired := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      shareUsersSecretName(planner.instanceName()),
+			Namespace: ns,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "samba-operator",
+			},
+		},
+		Data: map[string][]byte{smbUsersSecretKey: data},
+	}
+	if err := m.setOwner(s, desired); err != nil {
+		return false, err
+	}
+	found := &corev1.Secret{}
+	err = m.client.Get(ctx,
+		types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace},
+		found)
+	if errors.IsNotFound(err) {
+		m.logger.Info("Creating a new Secret",
+			"Secret.Namespace", desired.Namespace,
+			"Secret.Name", desired.Name)
+		err = m.client.Create(
+			ctx, desired, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to create new Secret",
+				"Secret.Namespace", desired.Namespace,
+				"Secret.Name", desired.Name)
+			return false, err
+		}
+		m.recorder.Eventf(s,
+			EventNormal,
+			ReasonCreatedSecret,
+			"Created Secret %s holding the users of server group %s",
+			desired.Name, planner.instanceName())
+		return true, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get Secret",
+			"Secret.Namespace", desired.Namespace,
+			"Secret.Name", desired.Name)
+		return false, err
+	}
+	if !reflect.DeepEqual(found.Data, desired.Data) {
+		found.Data = desired.Data
+		if err := m.writeChild(ctx, found, desired); err != nil {
+			m.logger.Error(err, "Failed to update Secret",
+				"Secret.Namespace", found.Namespace,
+				"Secret.Name", found.Name)
+			return false, err
+		}
+		m.recorder.Eventf(s,
+			EventNormal,
+			ReasonUpdatedSecret,
+			"Updated the users of server group %s in Secret %s",
+			planner.instanceName(), found.Name)
+		return true, nil
+	}
+	return false, nil
+}
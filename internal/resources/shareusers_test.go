@@ -0,0 +1,198 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// usersSecret returns a users secret, in the default namespace, holding
+// the users in the given key.
+func usersSecret(name, key string, users ...smbcc.UserEntry) *corev1.Secret {
+	cc := &smbcc.SambaContainerConfig{
+		SCCVersion: "v0",
+		Users: map[smbcc.Key]smbcc.UserEntries{
+			smbcc.AllEntriesKey: users,
+		},
+	}
+	data, _ := json.Marshal(cc)
+	return passwordSecret(name, map[string]string{key: string(data)})
+}
+
+func shareUsersPlanner(share *sambaoperatorv1alpha1.SmbShare) *sharePlanner {
+	share.Name = "myshare"
+	share.Namespace = "default"
+	planner := localGroupsPlanner(share)
+	share.Status.ServerGroup = "mygroup"
+	planner.SecurityConfig.Name = "mysec"
+	return planner
+}
+
+func TestShareUsersSecuritySource(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := shareUsersPlanner(share)
+	uss := planner.userSecuritySource()
+	assert.Equal(t, "users", uss.Secret)
+	assert.Equal(t, "demousers", uss.Key)
+
+	share.Spec.Users = &sambaoperatorv1alpha1.SmbShareUsersSpec{
+		Secret: "extra",
+		Key:    "users",
+	}
+	uss = planner.userSecuritySource()
+	assert.Equal(t, "mygroup-users", uss.Secret)
+	assert.Equal(t, "users.json", uss.Key)
+	// the users of the security config are merged with those of the share
+	uss = planner.securityConfigUserSource()
+	assert.Equal(t, "users", uss.Secret)
+	assert.Equal(t, "demousers", uss.Key)
+}
+
+func TestValidateShareUsers(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Users = &sambaoperatorv1alpha1.SmbShareUsersSpec{
+		Secret: "extra",
+		Key:    "users",
+	}
+	planner := shareUsersPlanner(share)
+	carol := smbcc.UserEntry{Name: "carol", Password: "c4r0l"}
+	extra := usersSecret("extra", "users", carol)
+	ctx := context.TODO()
+
+	m, recorder := newTestManager(share, extra)
+	valid, err := m.validateShareUsers(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+
+	check := func(planner *sharePlanner, msg string, secrets ...*corev1.Secret) {
+		t.Helper()
+		m, recorder := newTestManager(share)
+		for _, secret := range secrets {
+			secret = secret.DeepCopy()
+			secret.ResourceVersion = ""
+			require.NoError(t, m.client.Create(ctx, secret))
+		}
+		valid, err := m.validateShareUsers(ctx, planner, "default")
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidShareUsers)
+			assert.Contains(t, event, msg)
+		}
+	}
+	check(planner,
+		"Users secret extra of SmbShare myshare is missing or has no key users")
+	check(planner,
+		"Users secret extra of SmbShare myshare is missing or has no key users",
+		usersSecret("extra", "other", carol))
+	check(planner,
+		"Key users of users secret extra of SmbShare myshare is not a valid users config",
+		passwordSecret("extra", map[string]string{"users": "{"}))
+	check(planner,
+		`Invalid user name in users secret extra of SmbShare myshare: "carol:x"`,
+		usersSecret("extra", "users", smbcc.UserEntry{Name: "carol:x"}))
+
+	// the shares of a server group may not define a user differently
+	other := share.DeepCopy()
+	other.Name = "othershare"
+	other.Spec.Users.Secret = "otherextra"
+	planner.GroupShares = []sambaoperatorv1alpha1.SmbShare{*share, *other}
+	check(planner, "SmbShares myshare and othershare define user carol differently",
+		extra,
+		usersSecret("otherextra", "users", smbcc.UserEntry{Name: "carol"}))
+	m, _ = newTestManager(share, extra, usersSecret("otherextra", "users", carol))
+	valid, err = m.validateShareUsers(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	planner.GroupShares = nil
+
+	csi := shareUsersPlanner(share)
+	csi.SecurityConfig.Spec.Users.Secret = ""
+	csi.SecurityConfig.Spec.Users.CSISecretVolume = &sambaoperatorv1alpha1.SmbCSISecretVolumeSpec{}
+	check(csi,
+		"Users can not be added to the CSI secret volume of security config mysec",
+		extra)
+	noUsers := shareUsersPlanner(share)
+	noUsers.SecurityConfig.Spec.Users = nil
+	check(noUsers,
+		"Users can only be added to the users of a security config in user mode",
+		extra)
+}
+
+func TestUpdateShareUsersSecret(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Users = &sambaoperatorv1alpha1.SmbShareUsersSpec{
+		Secret: "extra",
+		Key:    "users",
+	}
+	planner := shareUsersPlanner(share)
+	base := usersSecret("users", "demousers",
+		smbcc.UserEntry{Name: "alice", Uid: 1001, Password: "wond3r1and"},
+		smbcc.UserEntry{Name: "bob", Password: "r0b0t"})
+	extra := usersSecret("extra", "users",
+		smbcc.UserEntry{Name: "carol", Password: "c4r0l"},
+		smbcc.UserEntry{Name: "bob", Password: "b0bb0"})
+	m, recorder := newTestManager(share, base, extra)
+	ctx := context.TODO()
+
+	changed, err := m.updateShareUsersSecret(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonCreatedSecret)
+	secret := &corev1.Secret{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "mygroup-users"},
+		secret))
+	if assert.Len(t, secret.OwnerReferences, 1) {
+		assert.Equal(t, "myshare", secret.OwnerReferences[0].Name)
+	}
+	cc := &smbcc.SambaContainerConfig{}
+	require.NoError(t, json.Unmarshal(secret.Data[smbUsersSecretKey], cc))
+	// the share's bob replaces the bob of the security config
+	assert.Equal(t, smbcc.UserEntries{
+		{Name: "alice", Uid: 1001, Password: "wond3r1and"},
+		{Name: "carol", Password: "c4r0l"},
+		{Name: "bob", Password: "b0bb0"},
+	}, cc.Users[smbcc.AllEntriesKey])
+
+	// the merged users are those of the users config of the share
+	users, err := m.getUsersConfig(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, cc, users)
+
+	changed, err = m.updateShareUsersSecret(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// no secret is generated for shares without users
+	share.Spec.Users = nil
+	m, _ = newTestManager(share, base, extra)
+	changed, err = m.updateShareUsersSecret(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
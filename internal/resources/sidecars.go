@@ -0,0 +1,176 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// extraContainersAnnotationKey is the pod template annotation listing
+	// the names of the extra containers of the common config, telling
+	// them apart from the containers of the operator.
+	extraContainersAnnotationKey = "samba-operator.samba.org/extra-containers"
+	// extraContainersHashKey is the pod template annotation holding the
+	// digest of the extra containers. Changing them rolls the pods.
+	extraContainersHashKey = "samba-operator.samba.org/extra-containers-hash"
+	// shareDataVolumeName is the name the volume mounts of the extra
+	// containers refer to the volume of the share's PVC by.
+	shareDataVolumeName = "share-data"
+)
+
+// extraContainerSpecs returns the sidecar containers the common config
+// adds to the pods.
+func (sp *sharePlanner) extraContainerSpecs() []corev1.Container {
+	if sp.CommonConfig == nil || sp.CommonConfig.Spec.PodSettings == nil {
+		return nil
+	}
+	return sp.CommonConfig.Spec.PodSettings.ExtraContainers
+}
+
+// extraContainerNames returns the names of the extra containers, in order.
+func (sp *sharePlanner) extraContainerNames() []string {
+	specs := sp.extraContainerSpecs()
+	if len(specs) == 0 {
+		return nil
+	}
+	return containerNames(specs)
+}
+
+// extraContainersHash returns a digest of the extra containers, or an
+// empty string if there are none.
+func (sp *sharePlanner) extraContainersHash() string {
+	specs := sp.extraContainerSpecs()
+	if len(specs) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(specs)
+	if err != nil {
+		// containers always marshal
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+}
+
+// shareDataVolume returns the name of the pod volume of the share's PVC,
+// or an empty string if the share does not use a PVC.
+func shareDataVolume(planner *sharePlanner, pvcName string) string {
+	if planner.SmbShare.Spec.Storage.Pvc == nil {
+		return ""
+	}
+	return sharePvcName(planner, planner.SmbShare, pvcName) + "-smb"
+}
+
+// extraContainers returns the extra containers of the pods, whose mounts of
+// the share-data volume are mounts of the volume of the share's PVC.
+func extraContainers(planner *sharePlanner, pvcName string) []corev1.Container {
+	specs := planner.extraContainerSpecs()
+	if len(specs) == 0 {
+		return nil
+	}
+	dataVolume := shareDataVolume(planner, pvcName)
+	containers := make([]corev1.Container, 0, len(specs))
+	for i := range specs {
+		c := specs[i].DeepCopy()
+		for j := range c.VolumeMounts {
+			if c.VolumeMounts[j].Name == shareDataVolumeName && dataVolume != "" {
+				c.VolumeMounts[j].Name = dataVolume
+			}
+		}
+		containers = append(containers, *c)
+	}
+	return containers
+}
+
+// updateExtraContainers replaces the containers of the current pod template
+// with the desired ones when the extra containers of the common config
+// changed. The containers are compared by digest, as the API server sets
+// defaults in them. It returns true if the current template was changed.
+func updateExtraContainers(cur, want *corev1.PodTemplateSpec) bool {
+	if cur.Annotations[extraContainersHashKey] ==
+		want.Annotations[extraContainersHashKey] {
+		// ---
+		return false
+	}
+	cur.Spec.Containers = want.Spec.Containers
+	updateTemplateAnnotation(cur, want, extraContainersAnnotationKey)
+	updateTemplateAnnotation(cur, want, extraContainersHashKey)
+	return true
+}
+
+// validateExtraContainers checks that the extra containers of the common
+// config have unique names, that are not those of the containers of the
+// operator, and only mount volumes of the pods. If not, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateExtraContainers(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	specs := planner.extraContainerSpecs()
+	if len(specs) == 0 {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidExtraContainer, msg)
+	}
+	seen := map[string]bool{}
+	for _, c := range specs {
+		if seen[c.Name] {
+			return degraded(fmt.Sprintf(
+				"Extra container %s is defined more than once", c.Name))
+		}
+		seen[c.Name] = true
+	}
+	podSpec := m.deploymentForSmbShare(planner, m.cfg.WorkingNamespace).
+		Spec.Template.Spec
+	// the extra containers are the last containers of the pods
+	operator := append([]corev1.Container{}, podSpec.InitContainers...)
+	operator = append(operator,
+		podSpec.Containers[:len(podSpec.Containers)-len(specs)]...)
+	for _, c := range operator {
+		if seen[c.Name] {
+			return degraded(fmt.Sprintf(
+				"Extra container %s has the name of a container of the operator",
+				c.Name))
+		}
+	}
+	volumes := map[string]bool{}
+	for _, v := range podSpec.Volumes {
+		volumes[v.Name] = true
+	}
+	for _, c := range specs {
+		for _, vm := range c.VolumeMounts {
+			if vm.Name == shareDataVolumeName &&
+				planner.SmbShare.Spec.Storage.Pvc == nil {
+				// ---
+				return degraded(fmt.Sprintf(
+					"Extra container %s mounts %s, which requires PVC storage",
+					c.Name, shareDataVolumeName))
+			}
+			if vm.Name != shareDataVolumeName && !volumes[vm.Name] {
+				return degraded(fmt.Sprintf(
+					"Extra container %s mounts unknown volume %s",
+					c.Name, vm.Name))
+			}
+		}
+	}
+	return true, nil
+}
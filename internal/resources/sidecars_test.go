@@ -0,0 +1,171 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+)
+
+// sidecarCommonConfig returns a common config adding the sidecar
+// containers.
+func sidecarCommonConfig(
+	containers ...corev1.Container) *sambaoperatorv1alpha1.SmbCommonConfig {
+	// ---
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		ExtraContainers: containers,
+	}
+	return common
+}
+
+func scannerContainer() corev1.Container {
+	return corev1.Container{
+		Name:  "av-scanner",
+		Image: "registry.example.com/av-scanner:1.0",
+		VolumeMounts: []corev1.VolumeMount{{
+			Name:      "share-data",
+			MountPath: "/scan",
+			ReadOnly:  true,
+		}},
+	}
+}
+
+func TestBuildPodSpecExtraContainers(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	planner := testPlanner(share, sidecarCommonConfig(scannerContainer()))
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	podSpec := buildPodSpec(planner, cfg, "mypvc")
+
+	// the sidecar follows the containers of the operator
+	last := podSpec.Containers[len(podSpec.Containers)-1]
+	assert.Equal(t, "av-scanner", last.Name)
+	assert.Equal(t, "registry.example.com/av-scanner:1.0", last.Image)
+	// and mounts the volume of the share's PVC
+	assert.Equal(t, []corev1.VolumeMount{{
+		Name:      "mypvc-smb",
+		MountPath: "/scan",
+		ReadOnly:  true,
+	}}, last.VolumeMounts)
+	found := false
+	for _, v := range podSpec.Volumes {
+		if v.Name == "mypvc-smb" {
+			found = true
+			assert.Equal(t, "mypvc", v.PersistentVolumeClaim.ClaimName)
+		}
+	}
+	assert.True(t, found)
+	// the common config is left as it is
+	assert.Equal(t, "share-data",
+		planner.extraContainerSpecs()[0].VolumeMounts[0].Name)
+
+	dep := buildDeployment(cfg, planner, "mypvc", "default")
+	annotations := dep.Spec.Template.Annotations
+	assert.Equal(t, "av-scanner", annotations[extraContainersAnnotationKey])
+	assert.NotEmpty(t, annotations[extraContainersHashKey])
+
+	// pods without sidecars are not annotated
+	planner = testPlanner(share, nil)
+	dep = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.NotContains(t, dep.Spec.Template.Annotations, extraContainersAnnotationKey)
+	assert.NotContains(t, dep.Spec.Template.Annotations, extraContainersHashKey)
+}
+
+func TestUpdateExtraContainers(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	scanner := scannerContainer()
+	planner := testPlanner(share, sidecarCommonConfig(scanner))
+	cur := buildDeployment(cfg, planner, "mypvc", "default")
+	want := buildDeployment(cfg, planner, "mypvc", "default")
+	assert.False(t, updatePodTemplateSettings(cur, want))
+
+	// changing a sidecar rolls the pods
+	scanner.Image = "registry.example.com/av-scanner:1.1"
+	planner = testPlanner(share, sidecarCommonConfig(scanner))
+	want = buildDeployment(cfg, planner, "mypvc", "default")
+	assert.True(t, updateExtraContainers(&cur.Spec.Template, &want.Spec.Template))
+	assert.Equal(t, want.Spec.Template.Spec.Containers, cur.Spec.Template.Spec.Containers)
+	assert.Equal(t,
+		want.Spec.Template.Annotations[extraContainersHashKey],
+		cur.Spec.Template.Annotations[extraContainersHashKey])
+	assert.False(t, updatePodTemplateSettings(cur, want))
+
+	// removing the sidecars removes their container and annotations
+	want = buildDeployment(cfg, testPlanner(share, nil), "mypvc", "default")
+	assert.True(t, updatePodTemplateSettings(cur, want))
+	for _, c := range cur.Spec.Template.Spec.Containers {
+		assert.NotEqual(t, "av-scanner", c.Name)
+	}
+	assert.NotContains(t, cur.Spec.Template.Annotations, extraContainersAnnotationKey)
+	assert.NotContains(t, cur.Spec.Template.Annotations, extraContainersHashKey)
+}
+
+func TestValidateExtraContainers(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	sync := corev1.Container{
+		Name:  "file-sync",
+		Image: "registry.example.com/sync:2",
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "share-data", MountPath: "/data"},
+			{Name: ConfigMapName, MountPath: "/etc/samba-container"},
+		},
+	}
+	planner := testPlanner(share, sidecarCommonConfig(scannerContainer(), sync))
+
+	m, recorder := newTestManager(share)
+	valid, err := m.validateExtraContainers(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+
+	check := func(msg string, containers ...corev1.Container) {
+		t.Helper()
+		planner := testPlanner(share, sidecarCommonConfig(containers...))
+		m, recorder := newTestManager(share)
+		m.cfg.SmbdContainerName = "samba"
+		valid, err := m.validateExtraContainers(context.TODO(), planner)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidExtraContainer)
+			assert.Contains(t, event, msg)
+		}
+	}
+	check("Extra container av-scanner is defined more than once",
+		scannerContainer(), scannerContainer())
+	check("Extra container samba has the name of a container of the operator",
+		corev1.Container{Name: "samba", Image: "busybox"})
+	missing := scannerContainer()
+	missing.VolumeMounts[0].Name = "scratch"
+	check("Extra container av-scanner mounts unknown volume scratch", missing)
+
+	// the share-data volume requires a PVC
+	share.Spec.Storage.Pvc = nil
+	check("Extra container av-scanner mounts share-data, which requires PVC storage",
+		scannerContainer())
+}
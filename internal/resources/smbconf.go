@@ -0,0 +1,126 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// SmbConfKey is the key of the smb.conf in the ConfigMap of a share.
+const SmbConfKey = "smb.conf"
+
+// smbConfConfigMapName returns the name of the ConfigMap holding the
+// smb.conf of the share.
+func smbConfConfigMapName(s *sambaoperatorv1alpha1.SmbShare) string {
+	return s.Name + "-smb-conf"
+}
+
+// newSmbConfConfigMap returns the ConfigMap holding the smb.conf generated
+// for the share's server group. The ConfigMap is only there to be read by
+// users: the samba containers load their configuration from the container
+// config. It lives in the namespace of the share, so that it can always be
+// owned by the share.
+func newSmbConfConfigMap(planner *sharePlanner) (*corev1.ConfigMap, error) {
+	conf, err := planner.ConfigState.SmbConf(planner.instanceID())
+	if err != nil {
+		return nil, err
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      smbConfConfigMapName(planner.SmbShare),
+			Namespace: planner.SmbShare.Namespace,
+			Labels:    labelsForSmbServer(planner.instanceName()),
+		},
+		Data: map[string]string{SmbConfKey: conf},
+	}
+	return cm, nil
+}
+
+// updateSmbConf stores the smb.conf generated for the share's server group
+// in the share's ConfigMap and records the name of the ConfigMap, and the
+// config mode of the share, in the status of the SmbShare. It returns true
+// if a change was made.
+func (m *SmbShareManager) updateSmbConf(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	desired, err := newSmbConfConfigMap(planner)
+	if err != nil {
+		m.logger.Error(err, "Failed to render smb.conf")
+		return false, err
+	}
+	if err := m.setOwner(s, desired); err != nil {
+		return false, err
+	}
+	found := &corev1.ConfigMap{}
+	err = m.client.Get(ctx,
+		types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace},
+		found)
+	if errors.IsNotFound(err) {
+		m.logger.Info("Creating a new ConfigMap",
+			"ConfigMap.Namespace", desired.Namespace,
+			"ConfigMap.Name", desired.Name)
+		err = m.client.Create(
+			ctx, desired, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to create new ConfigMap",
+				"ConfigMap.Namespace", desired.Namespace,
+				"ConfigMap.Name", desired.Name)
+			return false, err
+		}
+		m.recorder.Eventf(s,
+			EventNormal,
+			ReasonCreatedConfigMap,
+			"Created ConfigMap %s holding the smb.conf of SmbShare",
+			desired.Name)
+		return true, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get ConfigMap",
+			"ConfigMap.Namespace", desired.Namespace,
+			"ConfigMap.Name", desired.Name)
+		return false, err
+	}
+	if !reflect.DeepEqual(found.Data, desired.Data) {
+		found.Data = desired.Data
+		if err := m.writeChild(ctx, found, desired); err != nil {
+			m.logger.Error(err, "Failed to update ConfigMap",
+				"ConfigMap.Namespace", found.Namespace,
+				"ConfigMap.Name", found.Name)
+			return false, err
+		}
+		m.recorder.Eventf(s,
+			EventNormal,
+			ReasonUpdatedConfigMap,
+			"Updated the smb.conf of SmbShare in ConfigMap %s", found.Name)
+		return true, nil
+	}
+	mode := planner.configMode()
+	if s.Status.SmbConfConfigMap == desired.Name && s.Status.ConfigMode == mode {
+		return false, nil
+	}
+	s.Status.SmbConfConfigMap = desired.Name
+	s.Status.ConfigMode = mode
+	return true, m.client.Status().Update(ctx, s)
+}
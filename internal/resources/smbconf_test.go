@@ -0,0 +1,113 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func TestUpdateSmbConf(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	share.UID = "1234"
+	share.Spec.ShareName = "Data"
+	share.Spec.Browseable = true
+	share.Spec.VetoFiles = []string{"Thumbs.db"}
+	planner := testPlanner(share, nil)
+	planner.ConfigState = smbcc.New()
+	_, err := planner.update()
+	require.NoError(t, err)
+	m, recorder := newTestManager(share)
+
+	changed, err := m.updateSmbConf(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonCreatedConfigMap)
+	cm := &corev1.ConfigMap{}
+	require.NoError(t, m.client.Get(context.TODO(),
+		types.NamespacedName{Namespace: "default", Name: "myshare-smb-conf"},
+		cm))
+	assert.Equal(t, `[global]
+	client lanman auth = no
+	client ntlmv2 auth = yes
+	client plaintext auth = no
+	disable spoolss = yes
+	lanman auth = no
+	load printers = no
+	netbios name = myshare
+	ntlm auth = ntlmv2-only
+	printcap name = /dev/null
+	printing = bsd
+	raw NTLMv2 auth = no
+
+[Data]
+	delete veto files = yes
+	path = /mnt/1234
+	read only = no
+	veto files = /Thumbs.db/
+`, cm.Data[SmbConfKey])
+	if owner := metav1.GetControllerOf(cm); assert.NotNil(t, owner) {
+		assert.Equal(t, share.UID, owner.UID)
+	}
+
+	// the ConfigMap is recorded in the status once it is up to date
+	changed, err = m.updateSmbConf(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "myshare-smb-conf", share.Status.SmbConfConfigMap)
+	assert.Equal(t, "Managed", share.Status.ConfigMode)
+	changed, err = m.updateSmbConf(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// changes to the share's configuration are rendered
+	share.Spec.ReadOnly = true
+	_, err = planner.update()
+	require.NoError(t, err)
+	changed, err = m.updateSmbConf(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	require.NoError(t, m.client.Get(context.TODO(),
+		types.NamespacedName{Namespace: "default", Name: "myshare-smb-conf"},
+		cm))
+	assert.Contains(t, cm.Data[SmbConfKey], "read only = yes")
+	assert.Contains(t, <-recorder.Events, ReasonUpdatedConfigMap)
+
+	// a custom smb.conf is reported in the status
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner.CommonConfig.Spec.CustomConfig = &sambaoperatorv1alpha1.SmbCustomConfig{
+		ConfigMap: "my-smb-conf",
+	}
+	_, err = planner.update()
+	require.NoError(t, err)
+	changed, err = m.updateSmbConf(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = m.updateSmbConf(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "Unmanaged", share.Status.ConfigMode)
+}
@@ -0,0 +1,257 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// defaultUsersImportKey is the key of the Secret holding the smbpasswd file
+// the users are imported from, if the security config names none.
+const defaultUsersImportKey = "smbpasswd"
+
+// usersImport returns the smbpasswd file the users of the share are
+// imported from, or nil if no users are imported.
+func (sp *sharePlanner) usersImport() *sambaoperatorv1alpha1.SmbSecurityUsersImportSpec {
+	if sp.securityMode() != userMode || sp.SecurityConfig == nil ||
+		sp.SecurityConfig.Spec.Users == nil {
+		// ---
+		return nil
+	}
+	return sp.SecurityConfig.Spec.Users.Import
+}
+
+// usersImportKey returns the key of the Secret holding the smbpasswd file.
+func usersImportKey(spec *sambaoperatorv1alpha1.SmbSecurityUsersImportSpec) string {
+	if spec.Key != "" {
+		return spec.Key
+	}
+	return defaultUsersImportKey
+}
+
+// smbpasswdFlags returns the account flags of an smbpasswd entry, given
+// between brackets, as in "[U          ]".
+func smbpasswdFlags(field string) (string, bool) {
+	if len(field) < 2 || field[0] != '[' || field[len(field)-1] != ']' {
+		return "", false
+	}
+	return strings.TrimSpace(field[1 : len(field)-1]), true
+}
+
+// isNTHash returns true if s is an NT hash, as 32 hexadecimal digits.
+func isNTHash(s string) bool {
+	if len(s) != 32 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSmbpasswd returns the users of the smbpasswd file. Each line holds
+// an account as "name:uid:LM hash:NT hash:[flags]:LCT-time:". Accounts
+// that are not user accounts, such as machine trust accounts, and disabled
+// accounts are skipped and counted. Blank lines and comments are ignored.
+func parseSmbpasswd(data string) (smbcc.UserEntries, int, error) {
+	users := smbcc.UserEntries{}
+	skipped := 0
+	seen := map[string]bool{}
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 6 {
+			return nil, 0, fmt.Errorf(
+				"line %d: expected name:uid:LM hash:NT hash:[flags]:LCT", i+1)
+		}
+		name := fields[0]
+		if !validAccountName(name, userMode) {
+			return nil, 0, fmt.Errorf("line %d: invalid user name %q", i+1, name)
+		}
+		if seen[name] {
+			return nil, 0, fmt.Errorf(
+				"line %d: user %s is listed more than once", i+1, name)
+		}
+		seen[name] = true
+		uid, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, 0, fmt.Errorf(
+				"line %d: invalid uid of user %s: %q", i+1, name, fields[1])
+		}
+		flags, ok := smbpasswdFlags(fields[4])
+		if !ok {
+			return nil, 0, fmt.Errorf(
+				"line %d: invalid account flags of user %s: %q",
+				i+1, name, fields[4])
+		}
+		if !strings.Contains(flags, "U") || strings.Contains(flags, "D") {
+			skipped++
+			continue
+		}
+		if !isNTHash(fields[3]) {
+			return nil, 0, fmt.Errorf(
+				"line %d: user %s has no NT hash", i+1, name)
+		}
+		users = append(users, smbcc.UserEntry{
+			Name:   name,
+			Uid:    uint(uid),
+			NTHash: strings.ToLower(fields[3]),
+		})
+	}
+	return users, skipped, nil
+}
+
+// getUsersImport returns the contents of the smbpasswd file the users are
+// imported from, and false if its Secret, or the key of the Secret, is
+// missing.
+func (m *SmbShareManager) getUsersImport(
+	ctx context.Context, planner *sharePlanner) (string, bool, error) {
+	// ---
+	spec := planner.usersImport()
+	ns := planner.SecurityConfig.Namespace
+	secret := &corev1.Secret{}
+	err := m.client.Get(
+		ctx, types.NamespacedName{Name: spec.Secret, Namespace: ns}, secret)
+	if errors.IsNotFound(err) {
+		return "", false, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get users import secret",
+			"Secret.Namespace", ns, "Secret.Name", spec.Secret)
+		return "", false, err
+	}
+	data, found := secret.Data[usersImportKey(spec)]
+	return string(data), found, nil
+}
+
+// importedUsers returns the users imported from the smbpasswd file of the
+// security config, and the number of accounts skipped. No users are
+// returned if none are imported, or if the file is missing or invalid.
+func (m *SmbShareManager) importedUsers(
+	ctx context.Context, planner *sharePlanner) (smbcc.UserEntries, int, error) {
+	// ---
+	if planner.usersImport() == nil || !planner.usesSmbUsers() {
+		return nil, 0, nil
+	}
+	data, found, err := m.getUsersImport(ctx, planner)
+	if err != nil || !found {
+		return nil, 0, err
+	}
+	users, skipped, err := parseSmbpasswd(data)
+	if err != nil {
+		return nil, 0, nil
+	}
+	return users, skipped, nil
+}
+
+// addImportedUsers adds the imported users to the users config, keeping
+// the users sorted by name.
+func addImportedUsers(cc *smbcc.SambaContainerConfig, imported smbcc.UserEntries) {
+	if len(imported) == 0 {
+		return
+	}
+	users := append(cc.Users[smbcc.AllEntriesKey], imported...)
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+	cc.Users[smbcc.AllEntriesKey] = users
+}
+
+// validateUsersImport checks that the users imported into the security
+// config come from a valid smbpasswd file, in an existing Secret, and do
+// not have the user names of SmbUsers. If not, the Degraded condition is
+// set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateUsersImport(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	spec := planner.usersImport()
+	if spec == nil {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidUsersImport, msg)
+	}
+	sc := planner.SecurityConfig
+	if !planner.usesSmbUsers() {
+		return degraded(fmt.Sprintf(
+			"Security config %s imports users along with a users secret or CSI secret volume",
+			sc.Name))
+	}
+	data, found, err := m.getUsersImport(ctx, planner)
+	if err != nil {
+		return false, err
+	} else if !found {
+		return degraded(fmt.Sprintf(
+			"Key %s of Secret %s, holding the users to import, not found",
+			usersImportKey(spec), spec.Secret))
+	}
+	imported, _, err := parseSmbpasswd(data)
+	if err != nil {
+		return degraded(fmt.Sprintf(
+			"Invalid smbpasswd file in key %s of Secret %s: %v",
+			usersImportKey(spec), spec.Secret, err))
+	}
+	users, err := m.listSmbUsers(ctx, planner)
+	if err != nil {
+		return false, err
+	}
+	names := map[string]string{}
+	for i := range users {
+		names[smbUserName(&users[i])] = users[i].Name
+	}
+	for _, u := range imported {
+		if other, found := names[u.Name]; found {
+			return degraded(fmt.Sprintf(
+				"SmbUser %s has the user name %s of an imported account",
+				other, u.Name))
+		}
+	}
+	return true, nil
+}
+
+// importedUsersEvent records an event on the SmbShare reporting how many
+// users were imported into the generated users secret.
+func (m *SmbShareManager) importedUsersEvent(
+	planner *sharePlanner, imported, skipped int) {
+	// ---
+	spec := planner.usersImport()
+	if spec == nil {
+		return
+	}
+	msg := fmt.Sprintf("Imported %d users from key %s of Secret %s",
+		imported, usersImportKey(spec), spec.Secret)
+	if skipped > 0 {
+		msg += fmt.Sprintf(
+			", skipped %d disabled or non-user accounts", skipped)
+	}
+	m.recorder.Event(planner.SmbShare, EventNormal, ReasonImportedUsers, msg)
+}
@@ -0,0 +1,163 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+const testSmbpasswd = `
+# exported with pdbedit -e smbpasswd:/tmp/smbpasswd
+alice:1001:XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX:4ED66BBD2A82DE4281135C759FA6290A:[U          ]:LCT-5F5A1C2B:
+bob:1002:XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX:8D20073FA3578AD8E9004C1B5E39348C:[UX         ]:LCT-5F5A1C2B:
+oldhost$:1003:XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX:8D20073FA3578AD8E9004C1B5E39348C:[W          ]:LCT-5F5A1C2B:
+carol:1004:XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX:XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX:[DU         ]:LCT-5F5A1C2B:
+`
+
+func TestParseSmbpasswd(t *testing.T) {
+	users, skipped, err := parseSmbpasswd(testSmbpasswd)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, skipped)
+	assert.Equal(t, smbcc.UserEntries{
+		{Name: "alice", Uid: 1001, NTHash: "4ed66bbd2a82de4281135c759fa6290a"},
+		{Name: "bob", Uid: 1002, NTHash: "8d20073fa3578ad8e9004c1b5e39348c"},
+	}, users)
+
+	invalid := map[string]string{
+		"alice:1001:XXXX": "line 1: expected name:uid:LM hash:NT hash:[flags]:LCT",
+		"al:ice:1001:X:4ED66BBD2A82DE4281135C759FA6290A:[U]:LCT-0:": "line 1: invalid uid of user al",
+		"alice:x:X:4ED66BBD2A82DE4281135C759FA6290A:[U]:LCT-0:":     `line 1: invalid uid of user alice: "x"`,
+		"alice:1001:X:4ED66BBD2A82DE4281135C759FA6290A:U:LCT-0:":    `line 1: invalid account flags of user alice: "U"`,
+		"alice:1001:X:NOHASH:[U]:LCT-0:":                            "line 1: user alice has no NT hash",
+		"a/b:1001:X:4ED66BBD2A82DE4281135C759FA6290A:[U]:LCT-0:":    `line 1: invalid user name "a/b"`,
+		"\nalice:1001:X:4ED66BBD2A82DE4281135C759FA6290A:[U]:LCT-0:\n" +
+			"alice:1002:X:4ED66BBD2A82DE4281135C759FA6290A:[U]:LCT-0:": "line 3: user alice is listed more than once",
+	}
+	for data, msg := range invalid {
+		_, _, err := parseSmbpasswd(data)
+		if assert.Error(t, err, data) {
+			assert.Contains(t, err.Error(), msg)
+		}
+	}
+}
+
+// importPlanner returns a planner of a share whose security config imports
+// its users from the smbpasswd Secret.
+func importPlanner(share *sambaoperatorv1alpha1.SmbShare) *sharePlanner {
+	planner := smbUsersPlanner(share)
+	planner.SecurityConfig.Spec.Users.Import = &sambaoperatorv1alpha1.SmbSecurityUsersImportSpec{
+		Secret: "legacy",
+	}
+	return planner
+}
+
+func TestValidateUsersImport(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := importPlanner(share)
+	legacy := passwordSecret("legacy", map[string]string{"smbpasswd": testSmbpasswd})
+	ctx := context.TODO()
+
+	m, recorder := newTestManager(share, legacy, testSmbUser("erin", "passwords"))
+	valid, err := m.validateUsersImport(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+
+	check := func(msg string, objs ...*corev1.Secret) {
+		t.Helper()
+		m, recorder := newTestManager(share, testSmbUser("alice2", "passwords"))
+		for _, o := range objs {
+			require.NoError(t, m.client.Create(ctx, o))
+		}
+		valid, err := m.validateUsersImport(ctx, planner)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidUsersImport)
+			assert.Contains(t, event, msg)
+		}
+	}
+	check("Key smbpasswd of Secret legacy, holding the users to import, not found")
+	check("Key smbpasswd of Secret legacy, holding the users to import, not found",
+		passwordSecret("legacy", map[string]string{"users": testSmbpasswd}))
+	check("Invalid smbpasswd file in key smbpasswd of Secret legacy: line 1:",
+		passwordSecret("legacy", map[string]string{"smbpasswd": "alice:1001"}))
+
+	// imported users may not have the names of SmbUsers
+	alias := testSmbUser("alice2", "passwords")
+	alias.Spec.Username = "alice"
+	m, recorder = newTestManager(share, legacy, alias)
+	valid, err = m.validateUsersImport(ctx, planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events,
+		"SmbUser alice2 has the user name alice of an imported account")
+
+	// users are imported into generated users only
+	planner.SecurityConfig.Spec.Users.Secret = "users"
+	m, recorder = newTestManager(share, legacy)
+	valid, err = m.validateUsersImport(ctx, planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events,
+		"Security config mysec imports users along with a users secret")
+}
+
+func TestUpdateSmbUsersSecretImport(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := importPlanner(share)
+	legacy := passwordSecret("legacy", map[string]string{"smbpasswd": testSmbpasswd})
+	passwords := passwordSecret("passwords", map[string]string{"password": "3r1n"})
+	m, recorder := newTestManager(share, legacy, passwords, testSmbUser("erin", "passwords"))
+	ctx := context.TODO()
+
+	changed, err := m.updateSmbUsersSecret(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonCreatedSecret)
+	assert.Contains(t, <-recorder.Events,
+		"Imported 2 users from key smbpasswd of Secret legacy, "+
+			"skipped 2 disabled or non-user accounts")
+	secret := &corev1.Secret{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "mysec-smbusers"},
+		secret))
+	cc := &smbcc.SambaContainerConfig{}
+	require.NoError(t, json.Unmarshal(secret.Data[smbUsersSecretKey], cc))
+	assert.Equal(t, smbcc.UserEntries{
+		{Name: "alice", Uid: 1001, NTHash: "4ed66bbd2a82de4281135c759fa6290a"},
+		{Name: "bob", Uid: 1002, NTHash: "8d20073fa3578ad8e9004c1b5e39348c"},
+		{Name: "erin", Password: "3r1n"},
+	}, cc.Users[smbcc.AllEntriesKey])
+
+	changed, err = m.updateSmbUsersSecret(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Len(t, recorder.Events, 0)
+}
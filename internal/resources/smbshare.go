@@ -17,30 +17,68 @@ package resources
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/tools/record"
 	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
 	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
 )
 
 const shareFinalizer = "samba-operator.samba.org/shareFinalizer"
 
+// forceDeleteAnnotation lets a share protected from deletion be deleted
+// while clients are connected to it, when set to "true".
+const forceDeleteAnnotation = "samba-operator.samba.org/force-delete"
+
+// pvcAnnotationsAnnotationKey is the PVC annotation listing the keys of the
+// annotations the operator set from the share's pvc section.
+const pvcAnnotationsAnnotationKey = "samba-operator.samba.org/pvc-annotations"
+
+// deletionRecheckInterval is how often the connections to a share whose
+// deletion is blocked are counted again.
+const deletionRecheckInterval = 30 * time.Second
+
 // SmbShareManager is used to manage SmbShare resources.
 type SmbShareManager struct {
-	client   rtclient.Client
-	scheme   *runtime.Scheme
-	recorder record.EventRecorder
-	logger   Logger
-	cfg      *conf.OperatorConfig
+	client     rtclient.Client
+	scheme     *runtime.Scheme
+	recorder   record.EventRecorder
+	logger     Logger
+	cfg        *conf.OperatorConfig
+	usage      VolumeUsageGetter
+	conns      ConnectionCounter
+	profiles   ProfileReader
+	infections InfectedFileReader
+	health     HealthProber
+	groups     GroupResolver
+	joins      JoinChecker
+	caps       Capabilities
+	events     rtclient.Reader
+	reloader   ConfigReloader
 }
 
 // NewSmbShareManager creates a SmbShareManager.
@@ -59,6 +97,57 @@ func NewSmbShareManager(
 	}
 }
 
+// SetVolumeUsage sets the VolumeUsageGetter used to measure the usage of
+// shares with a quota. If unset, quota usage is not reported.
+func (m *SmbShareManager) SetVolumeUsage(usage VolumeUsageGetter) {
+	m.usage = usage
+}
+
+// SetConnectionCounter sets the ConnectionCounter used to count the clients
+// connected to shares. If unset, connections are not reported.
+func (m *SmbShareManager) SetConnectionCounter(conns ConnectionCounter) {
+	m.conns = conns
+}
+
+// SetInfectedFileReader sets the InfectedFileReader used to read the
+// infected files found on shares scanned for viruses. If unset, infected
+// files are not reported.
+func (m *SmbShareManager) SetInfectedFileReader(infections InfectedFileReader) {
+	m.infections = infections
+}
+
+// SetProfileReader sets the ProfileReader used to read the profiling
+// counters of the samba servers. If unset, the counters are not reported.
+func (m *SmbShareManager) SetProfileReader(profiles ProfileReader) {
+	m.profiles = profiles
+}
+
+// SetHealthProber sets the HealthProber used to probe the shares with a
+// health check. If unset, their health is not reported.
+func (m *SmbShareManager) SetHealthProber(health HealthProber) {
+	m.health = health
+}
+
+// SetGroupResolver sets the GroupResolver used to check that the domain
+// groups granted access to shares can be resolved. The groups are not
+// checked if unset.
+func (m *SmbShareManager) SetGroupResolver(groups GroupResolver) {
+	m.groups = groups
+}
+
+// SetJoinChecker sets the JoinChecker used to check the credentials of the
+// join sources before the pods joining the domain are rolled out. The
+// credentials are not checked if unset.
+func (m *SmbShareManager) SetJoinChecker(joins JoinChecker) {
+	m.joins = joins
+}
+
+// SetCapabilities sets the optional APIs known to be available in the
+// cluster.
+func (m *SmbShareManager) SetCapabilities(caps Capabilities) {
+	m.caps = caps
+}
+
 // Process is called by the controller on any type of reconciliation.
 func (m *SmbShareManager) Process(
 	ctx context.Context,
@@ -77,6 +166,37 @@ func (m *SmbShareManager) Process(
 		return Result{err: err}
 	}
 
+	// shares of a server group are reconciled one at a time, shares of
+	// different groups may be reconciled concurrently.
+	group := instance.Status.ServerGroup
+	if group == "" {
+		group = desiredServerGroup(instance)
+	}
+	unlock := serverGroupLocks.lock(instance.Namespace + "/" + group)
+	defer unlock()
+
+	res := m.process(ctx, instance)
+	if errors.IsConflict(res.err) || errors.IsAlreadyExists(res.err) {
+		// a resource was changed, or created, after it was read. This is
+		// typically the config map shared by all shares. try again with
+		// fresh data.
+		m.logger.Info("Conflicting update, retrying", "error", res.err)
+		return Requeue
+	}
+	return res
+}
+
+func (m *SmbShareManager) process(
+	ctx context.Context,
+	instance *sambaoperatorv1alpha1.SmbShare) Result {
+	paused, err := m.updatePausedStatus(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if paused {
+		// leave the share, and its resources, as they are until resumed
+		m.logger.Info("Reconciliation is paused")
+		return Done
+	}
 	// now that we have the resource. determine if its live or pending deletion
 	if instance.GetDeletionTimestamp() != nil {
 		// its being deleted
@@ -92,6 +212,20 @@ func (m *SmbShareManager) Process(
 
 // Update should be called when a SmbShare resource changes.
 func (m *SmbShareManager) Update(
+	ctx context.Context,
+	instance *sambaoperatorv1alpha1.SmbShare) Result {
+	// ---
+	result := m.update(ctx, instance)
+	if result.err != nil || result.requeue {
+		return result
+	}
+	// resources changed behind our back are only corrected when the share
+	// is reconciled again, including shares that are degraded or suspended
+	return requeueAfter(
+		minRecheck(result.requeueAfter, m.cfg.ResyncInterval))
+}
+
+func (m *SmbShareManager) update(
 	ctx context.Context,
 	instance *sambaoperatorv1alpha1.SmbShare) Result {
 	// ---
@@ -117,185 +251,2700 @@ func (m *SmbShareManager) Update(
 		return Requeue
 	}
 
+	valid, err := m.validateServerGroup(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share, or other shares of the group, to be fixed
+		return Done
+	}
+
+	valid, err = m.validateAccessControl(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateFileModes(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateACLs(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateDosAttributes(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateGuestAccess(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateFilePatterns(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateHosts(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateSymlinks(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateSync(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateReadOnlyMount(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateUnicodeNormalization(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateSharePath(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateDNSName(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.validateQuota(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
+
+	valid, err = m.adoptUnmanagedChildren(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the resources to be removed, or the share annotated
+		return Done
+	}
+
+	// the share is validated in full before any of its resources are
+	// created or changed, so that an invalid share is left without a
+	// partial set of resources
 	destNamespace := m.cfg.WorkingNamespace
-	cm, created, err := getOrCreateConfigMap(ctx, m.client, destNamespace)
+	planner, err := m.newPlanner(ctx, smbcc.New(), instance)
 	if err != nil {
 		return Result{err: err}
-	} else if created {
-		m.logger.Info("Created config map")
-		return Requeue
 	}
-	planner, changed, err := m.updateConfiguration(ctx, cm, instance)
+
+	valid, err = m.validateNames(ctx, planner)
 	if err != nil {
 		return Result{err: err}
-	} else if changed {
-		m.logger.Info("Updated config map")
-		return Requeue
+	} else if !valid {
+		// wait for the share to be renamed, or its configuration fixed
+		return Done
 	}
 
-	if shareNeedsPvc(instance) {
-		pvc, created, err := m.getOrCreatePvc(
-			ctx, instance, destNamespace)
-		if err != nil {
-			return Result{err: err}
-		} else if created {
-			m.logger.Info("Created PVC")
-			m.recorder.Eventf(instance,
-				EventNormal,
-				ReasonCreatedPersistentVolumeClaim,
-				"Created PVC %s for SmbShare", pvc.Name)
-			return Requeue
-		}
-		// if name is unset in the YAML, set it here
-		instance.Spec.Storage.Pvc.Name = pvc.Name
+	valid, err = m.validatePort(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
 	}
 
-	deployment, created, err := m.getOrCreateDeployment(
-		ctx, planner, destNamespace)
+	valid, err = m.validateInterfaces(ctx, planner)
 	if err != nil {
 		return Result{err: err}
-	} else if created {
-		// Deployment created successfully - return and requeue
-		m.logger.Info("Created deployment")
-		m.recorder.Eventf(instance,
-			EventNormal,
-			ReasonCreatedDeployment,
-			"Created deployment %s for SmbShare", deployment.Name)
-		return Requeue
+	} else if !valid {
+		// wait for the share, or the common config, to be fixed
+		return Done
+	}
+	valid, err = m.validateSocketOptions(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the common config to be fixed
+		return Done
 	}
 
-	resized, err := m.updateDeploymentSize(ctx, deployment)
+	valid, err = m.validateServerIdentity(ctx, planner)
 	if err != nil {
 		return Result{err: err}
-	} else if resized {
-		m.logger.Info("Resized deployment")
-		return Requeue
+	} else if !valid {
+		// wait for the common config to be fixed
+		return Done
+	}
+	valid, err = m.validatePerformance(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the common config to be fixed
+		return Done
 	}
 
-	_, created, err = m.getOrCreateService(
-		ctx, planner, destNamespace)
+	valid, err = m.validateMacOS(ctx, planner)
 	if err != nil {
 		return Result{err: err}
-	} else if created {
-		m.logger.Info("Created service")
-		return Requeue
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
 	}
 
-	m.logger.Info("Done updating SmbShare resources")
-	return Done
-}
+	valid, err = m.validateVfsObjects(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
+	}
 
-// Finalize should be called when there's a finalizer on the resource
-// and we need to do some cleanup.
-func (m *SmbShareManager) Finalize(
-	ctx context.Context,
-	instance *sambaoperatorv1alpha1.SmbShare) Result {
-	// ---
-	cm, err := getConfigMap(ctx, m.client, m.cfg.WorkingNamespace)
-	if err == nil {
-		_, changed, err := m.updateConfiguration(ctx, cm, instance)
-		if err != nil {
-			return Result{err: err}
-		} else if changed {
-			m.logger.Info("Updated config map")
-			return Requeue
-		}
-	} else if err != nil && !errors.IsNotFound(err) {
+	valid, err = m.validateAntivirus(ctx, planner)
+	if err != nil {
 		return Result{err: err}
+	} else if !valid {
+		// wait for the share to be fixed
+		return Done
 	}
 
-	m.logger.Info("Removing finalizer")
-	controllerutil.RemoveFinalizer(instance, shareFinalizer)
-	err = m.client.Update(ctx, instance)
+	valid, err = m.validateMaintenance(ctx, planner)
 	if err != nil {
 		return Result{err: err}
+	} else if !valid {
+		// wait for the common config to be fixed
+		return Done
 	}
-	return Done
-}
 
-func (m *SmbShareManager) getOrCreateDeployment(
-	ctx context.Context,
-	planner *sharePlanner,
-	ns string) (*appsv1.Deployment, bool, error) {
-	// Check if the deployment already exists, if not create a new one
-	found := &appsv1.Deployment{}
-	err := m.client.Get(
-		ctx,
-		types.NamespacedName{
-			Name:      planner.SmbShare.Name,
-			Namespace: ns,
-		},
-		found)
-	if err == nil {
-		return found, false, nil
+	valid, err = m.validateWorkload(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the common config to be fixed
+		return Done
 	}
 
-	if errors.IsNotFound(err) {
-		// not found - define a new deployment
-		dep := m.deploymentForSmbShare(planner, ns)
-		m.logger.Info(
-			"Creating a new Deployment",
-			"Deployment.Namespace", dep.Namespace,
-			"Deployment.Name", dep.Name)
-		err = m.client.Create(ctx, dep)
-		if err != nil {
-			m.logger.Error(
-				err,
-				"Failed to create new Deployment",
-				"Deployment.Namespace", dep.Namespace,
-				"Deployment.Name", dep.Name)
-			return dep, false, err
-		}
-		// Deployment created successfully
-		return dep, true, nil
+	valid, err = m.validateAuthentication(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the security config to be fixed
+		return Done
 	}
-	m.logger.Error(err, "Failed to get Deployment")
-	return nil, false, err
-}
 
-func (m *SmbShareManager) getOrCreatePvc(
-	ctx context.Context,
-	smbShare *sambaoperatorv1alpha1.SmbShare,
-	ns string) (*corev1.PersistentVolumeClaim, bool, error) {
-	// Check if the pvc already exists, if not create it
-	pvc := &corev1.PersistentVolumeClaim{}
-	err := m.client.Get(
-		ctx,
-		types.NamespacedName{
-			Name:      pvcName(smbShare),
-			Namespace: ns,
-		},
-		pvc)
-	if err == nil {
+	valid, err = m.validateExtraMounts(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the common config to be fixed
+		return Done
+	}
+
+	valid, err = m.validateExtraEnv(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the common config to be fixed
+		return Done
+	}
+
+	valid, err = m.validateExtraContainers(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the common config to be fixed
+		return Done
+	}
+	valid, err = m.validateResources(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the resources to be fixed
+		return Done
+	}
+
+	valid, err = m.validateCustomConfig(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the common config, or its ConfigMap, to be fixed
+		return Done
+	}
+
+	valid, err = m.validateCommonLabels(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the common config to be fixed
+		return Done
+	}
+
+	valid, err = m.validateStorageBackend(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the storage settings to be fixed
+		return Done
+	}
+
+	valid, err = m.validateHandles(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share, or the shares of its group, to be fixed
+		return Done
+	}
+
+	valid, err = m.validateMSDFS(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the DFS links of the share to be fixed
+		return Done
+	}
+
+	if instance.Spec.Storage.Pvc != nil {
+		valid, err := m.validateStorage(ctx, planner, destNamespace)
+		if err != nil {
+			return Result{err: err}
+		} else if !valid {
+			// wait for the share (or its storage) to be fixed
+			return Done
+		}
+	}
+
+	if err := m.checkImagePullSecrets(ctx, planner, destNamespace); err != nil {
+		return Result{err: err}
+	}
+
+	if err := m.checkPriorityClass(ctx, planner); err != nil {
+		return Result{err: err}
+	}
+
+	if valid, err := m.validateKeytab(ctx, planner, destNamespace); err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the keytab secret to be fixed
+		return Done
+	}
+
+	valid, err = m.validateKrb5Conf(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the krb5.conf ConfigMap to be fixed
+		return Done
+	}
+
+	valid, err = m.validateIDMap(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the domains of the security config to be fixed
+		return Done
+	}
+
+	valid, err = m.validatePassdb(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the passdb backend, or its password secret, to be fixed
+		return Done
+	}
+
+	valid, err = m.validateCSISecretVolume(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the security config, or the SecretProviderClass, to be
+		// fixed
+		return Done
+	}
+
+	if valid, err := m.validateDNSUpdate(ctx, planner, destNamespace); err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the security config, or the key secret, to be fixed
+		return Done
+	}
+
+	valid, err = m.validateSmbUsers(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the SmbUsers, or their password secrets, to be fixed
+		return Done
+	}
+
+	valid, err = m.validateUsersImport(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the security config, or the smbpasswd file, to be fixed
+		return Done
+	}
+
+	valid, err = m.validateShareUsers(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the users secrets of the shares to be fixed
+		return Done
+	}
+
+	valid, err = m.validateForcedIDs(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share, or the users secret, to be fixed
+		return Done
+	}
+
+	valid, err = m.validateLocalGroups(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share, the security config, or the users secret, to
+		// be fixed
+		return Done
+	}
+
+	valid, err = m.validateGuestAccount(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the share, or the users secret, to be fixed
+		return Done
+	}
+
+	valid, err = m.validateJoinSources(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the join secrets to be fixed
+		return Done
+	}
+
+	valid, err = m.checkJoinCredentials(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the join secrets to be fixed
+		return Done
+	}
+
+	cm, created, err := getOrCreateConfigMap(ctx, m.client, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if created {
+		m.logger.Info("Created config map")
+		m.recorder.Eventf(instance,
+			EventNormal,
+			ReasonCreatedConfigMap,
+			"Created ConfigMap %s holding the configuration of the shares",
+			cm.Name)
+		return Requeue
+	}
+	planner, changed, err = m.updateConfiguration(ctx, cm, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated config map")
+		m.recorder.Eventf(instance,
+			EventNormal,
+			ReasonUpdatedConfigMap,
+			"Updated the configuration of SmbShare in ConfigMap %s", cm.Name)
+		return Requeue
+	}
+
+	changed, err = m.updateSmbConf(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated smb.conf")
+		return Requeue
+	}
+
+	if shareNeedsPvc(instance) {
+		pvc, created, err := m.getOrCreatePvc(
+			ctx, instance, destNamespace)
+		if err != nil {
+			return Result{err: err}
+		} else if created {
+			m.logger.Info("Created PVC")
+			m.recorder.Eventf(instance,
+				EventNormal,
+				ReasonCreatedPersistentVolumeClaim,
+				"Created PVC %s for SmbShare", pvc.Name)
+			return Requeue
+		}
+		// if name is unset in the YAML, set it here
+		instance.Spec.Storage.Pvc.Name = pvc.Name
+
+		changed, err = m.updatePvcAnnotations(ctx, instance, pvc)
+		if err != nil {
+			return Result{err: err}
+		} else if changed {
+			m.logger.Info("Updated PVC annotations")
+			return Requeue
+		}
+	}
+
+	if err := m.checkXattrSupport(ctx, planner, destNamespace); err != nil {
+		return Result{err: err}
+	}
+
+	changed, err = m.updateSmbUsersSecret(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated SmbUsers secret")
+		return Requeue
+	}
+
+	changed, err = m.updateShareUsersSecret(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated share users secret")
+		return Requeue
+	}
+
+	removing, err := m.removeOtherWorkloads(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if removing {
+		m.logger.Info("Removing workload of another type")
+		return Requeue
+	}
+
+	var deployment *appsv1.Deployment
+	if planner.workloadType() == statefulSetWorkload {
+		changed, err = m.updateStatefulSetWorkload(ctx, planner, destNamespace)
+	} else {
+		deployment, changed, err = m.updateDeploymentWorkload(
+			ctx, planner, destNamespace)
+	}
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated server workload")
+		return Requeue
+	}
+
+	changed, err = m.updateSuspendedStatus(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated suspended status")
+		return Requeue
+	}
+
+	changed, err = m.updateResourcesStatus(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated resources status")
+		return Requeue
+	}
+	if planner.groupSuspended() {
+		// without pods there is nothing to restart or to check until the
+		// share is resumed, which changes the SmbShare
+		m.logger.Info("Done updating resources of suspended SmbShare")
+		return Done
+	}
+
+	restarted, untilRestart, err := m.scheduleRestart(
+		ctx, planner, deployment, time.Now())
+	if err != nil {
+		return Result{err: err}
+	} else if restarted {
+		m.logger.Info("Acted on the restart schedule of the deployment")
+		return Requeue
+	}
+
+	svc, created, err := m.getOrCreateService(
+		ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if created {
+		m.logger.Info("Created service")
+		m.recorder.Eventf(instance,
+			EventNormal,
+			ReasonCreatedService,
+			"Created service %s for SmbShare", svc.Name)
+		return Requeue
+	}
+
+	updated, err := m.updateService(ctx, planner, svc, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if updated {
+		m.logger.Info("Updated service")
+		m.recorder.Eventf(instance,
+			EventNormal,
+			ReasonUpdatedService,
+			"Updated service %s for SmbShare", svc.Name)
+		return Requeue
+	}
+	m.checkRouteSupport(planner)
+	m.warnWideLinks(planner)
+	m.warnMultiChannelSingleNetwork(planner)
+	m.warnSpotlightUnavailable(planner)
+	if err := m.warnShareNameInUse(ctx, planner); err != nil {
+		return Result{err: err}
+	}
+
+	updated, err = m.updateServiceIPFamilies(ctx, planner, svc)
+	if err != nil {
+		return Result{err: err}
+	} else if updated {
+		m.logger.Info("Updated service IP families")
+		m.recorder.Eventf(instance,
+			EventNormal,
+			ReasonUpdatedService,
+			"Updated IP family policy of service %s", svc.Name)
+		return Requeue
+	}
+
+	changed, err = m.updatePublishedDNSName(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated published DNS name")
+		return Requeue
+	}
+
+	changed, err = m.updateServedPort(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated served port")
+		return Requeue
+	}
+
+	changed, err = m.updatePodDisruptionBudget(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated PodDisruptionBudget")
+		return Requeue
+	}
+
+	changed, err = m.updateMetricsService(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated metrics service")
+		return Requeue
+	}
+
+	changed, err = m.updateServiceMonitor(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated ServiceMonitor")
+		return Requeue
+	}
+
+	changed, err = m.adoptChildren(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated owner references")
+		return Requeue
+	}
+
+	changed, err = m.updateCommonLabels(ctx, planner)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated common labels")
+		return Requeue
+	}
+
+	changed, err = m.updateQuotaStatus(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated quota status")
+		return Requeue
+	}
+
+	changed, err = m.updateConnectionsStatus(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated connections status")
+		return Requeue
+	}
+
+	changed, err = m.updateInfectedFilesStatus(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated infected files status")
+		return Requeue
+	}
+
+	changed, err = m.updateProfileStatus(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated profile status")
+		return Requeue
+	}
+
+	changed, err = m.updateNetworkStatus(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated network status")
+		return Requeue
+	}
+
+	changed, err = m.updateHealthStatus(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated health status")
+		return Requeue
+	}
+
+	schedulable, recheck, err := m.checkSchedulable(
+		ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !schedulable {
+		// pending resources may become schedulable without any change
+		// to our resources
+		return requeueAfter(recheck)
+	}
+
+	valid, err = m.checkConfigStatus(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the configuration to be fixed
+		return Done
+	}
+
+	valid, err = m.checkPathStatus(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if !valid {
+		// wait for the directory of the share to be created
+		return Done
+	}
+
+	if planner.securityMode() == adMode {
+		joined, err := m.checkJoinStatus(ctx, planner, destNamespace)
+		if err != nil {
+			return Result{err: err}
+		} else if !joined {
+			return Done
+		}
+		if err := m.checkDNSRegistration(ctx, planner, destNamespace); err != nil {
+			return Result{err: err}
+		}
+		if err := m.checkDomainGroups(ctx, planner, destNamespace); err != nil {
+			return Result{err: err}
+		}
+	}
+
+	reloading, err := m.reloadConfig(ctx, planner, cm, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if reloading {
+		// the kubelet updates the config file of the pods without any
+		// change to our resources
+		recheck = minRecheck(recheck, reloadRecheck)
+	}
+
+	changed, err = m.clearDegraded(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated SmbShare conditions")
+		return Requeue
+	}
+
+	changed, selfTesting, err := m.updateSelfTest(ctx, planner, destNamespace)
+	if err != nil {
+		return Result{err: err}
+	} else if changed {
+		m.logger.Info("Updated self test")
+		return Requeue
+	} else if selfTesting {
+		// the Job finishes without any change to our resources
+		recheck = minRecheck(recheck, selfTestRecheck)
+	}
+
+	m.logger.Info("Done updating SmbShare resources")
+	if _, ok := planner.quotaBytes(); ok && m.usage != nil {
+		// usage changes without any change to our resources
+		recheck = minRecheck(recheck, quotaCheckInterval)
+	}
+	if m.conns != nil {
+		// clients come and go without any change to our resources
+		recheck = minRecheck(recheck, m.cfg.ConnectionsCheckInterval)
+	}
+	if m.profiles != nil && planner.profiling() {
+		// the counters grow without any change to our resources
+		recheck = minRecheck(recheck, m.cfg.ConnectionsCheckInterval)
+	}
+	if m.infections != nil && planner.antivirus() != nil {
+		// viruses are found without any change to our resources
+		recheck = minRecheck(recheck, m.cfg.ConnectionsCheckInterval)
+	}
+	if m.health != nil && planner.healthCheck() != "" {
+		// servers become unreachable without any change to our resources
+		recheck = minRecheck(recheck, m.cfg.HealthCheckInterval)
+	}
+	// scheduled restarts are due without any change to our resources
+	recheck = minRecheck(recheck, untilRestart)
+	if recheck != 0 {
+		return requeueAfter(recheck)
+	}
+	return Done
+}
+
+// Finalize should be called when there's a finalizer on the resource
+// and we need to do some cleanup.
+func (m *SmbShareManager) Finalize(
+	ctx context.Context,
+	instance *sambaoperatorv1alpha1.SmbShare) Result {
+	// ---
+	var planner *sharePlanner
+	cm, err := getConfigMap(ctx, m.client, m.cfg.WorkingNamespace)
+	if err == nil {
+		var changed bool
+		planner, changed, err = m.updateConfiguration(ctx, cm, instance)
+		if err != nil {
+			return Result{err: err}
+		} else if changed {
+			m.logger.Info("Updated config map")
+			return Requeue
+		}
+	} else if err != nil && !errors.IsNotFound(err) {
+		return Result{err: err}
+	}
+
+	if planner != nil {
+		blocked, err := m.checkDeletionBlocked(ctx, planner)
+		if err != nil {
+			return Result{err: err}
+		} else if blocked {
+			// clients disconnect without any change to our resources
+			return requeueAfter(deletionRecheckInterval)
+		}
+	}
+
+	members, err := m.groupMembers(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	}
+	lastMember := len(members) == 0 || instance.Status.ServerGroup == ""
+	if !lastMember {
+		// the server group lives on. Hand the group's resources over to a
+		// remaining share and stop serving this share from the group's
+		// pods before its storage goes away.
+		changed, err := m.transferGroupOwnership(ctx, instance, &members[0])
+		if err != nil {
+			return Result{err: err}
+		} else if changed {
+			m.logger.Info("Transferred ownership of server group resources")
+			return Requeue
+		}
+		if planner != nil && planner.workloadType() == statefulSetWorkload {
+			changed, err = m.leaveGroupStatefulSet(ctx, planner)
+			if err != nil {
+				return Result{err: err}
+			} else if changed {
+				m.logger.Info("Removed share from server group statefulset")
+				m.recorder.Eventf(instance,
+					EventNormal,
+					ReasonUpdatedStatefulSet,
+					"Removed share from statefulset %s of server group %s",
+					planner.instanceName(), instance.Status.ServerGroup)
+				return Requeue
+			}
+		} else if planner != nil {
+			changed, err = m.leaveGroupDeployment(ctx, planner)
+			if err != nil {
+				return Result{err: err}
+			} else if changed {
+				m.logger.Info("Removed share from server group deployment")
+				m.recorder.Eventf(instance,
+					EventNormal,
+					ReasonUpdatedDeployment,
+					"Removed share from deployment %s of server group %s",
+					planner.instanceName(), instance.Status.ServerGroup)
+				return Requeue
+			}
+		}
+	}
+
+	// the status lists the resources that are left
+	if _, err := m.updateResourcesStatus(ctx, instance); err != nil {
+		return Result{err: err}
+	}
+
+	// delete the resources created for the share in order. Each resource
+	// must be fully gone before the next is deleted.
+	for _, child := range m.childResources(instance, lastMember) {
+		gone, err := m.deleteChild(ctx, instance, child)
+		if err != nil {
+			return Result{err: err}
+		} else if !gone {
+			return Requeue
+		}
+	}
+
+	forgetShareMetrics(instance)
+	m.logger.Info("Removing finalizer")
+	controllerutil.RemoveFinalizer(instance, shareFinalizer)
+	err = m.client.Update(ctx, instance)
+	if err != nil {
+		return Result{err: err}
+	}
+	m.recorder.Event(instance,
+		EventNormal,
+		ReasonDeleted,
+		"Deleted all resources for SmbShare")
+	return Done
+}
+
+// childObject is satisfied by the k8s resource types created for shares.
+type childObject interface {
+	runtime.Object
+	metav1.Object
+}
+
+type childResource struct {
+	kind string
+	obj  childObject
+}
+
+// childResources returns the resources created for the SmbShare, in the
+// order they are to be deleted. The resources of the share's server group
+// are only included if lastMember is true.
+func (m *SmbShareManager) childResources(
+	s *sambaoperatorv1alpha1.SmbShare, lastMember bool) []childResource {
+	// ---
+	children := []childResource{}
+	if s.Status.ServerGroup == "" {
+		// nothing was created for the share
+		return children
+	}
+	ns := m.cfg.WorkingNamespace
+	if lastMember {
+		children = append(children, m.groupResources(s)...)
+	}
+	children = append(children, m.selfTestResources(s)...)
+	children = append(children, childResource{
+		"ConfigMap",
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      smbConfConfigMapName(s),
+				Namespace: s.Namespace,
+			},
+		},
+	})
+	if shareNeedsPvc(s) && !pvcRetained(s) {
+		children = append(children, childResource{
+			"PersistentVolumeClaim",
+			&corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: pvcName(s), Namespace: ns},
+			},
+		})
+	}
+	return children
+}
+
+// groupResources returns the resources shared by all members of the
+// server group of the SmbShare.
+func (m *SmbShareManager) groupResources(
+	s *sambaoperatorv1alpha1.SmbShare) []childResource {
+	// ---
+	meta := metav1.ObjectMeta{
+		Name:      s.Status.ServerGroup,
+		Namespace: m.cfg.WorkingNamespace,
+	}
+	children := []childResource{
+		{
+			"PodDisruptionBudget",
+			&policyv1beta1.PodDisruptionBudget{ObjectMeta: meta},
+		},
+		{"Deployment", &appsv1.Deployment{ObjectMeta: meta}},
+		{"StatefulSet", &appsv1.StatefulSet{ObjectMeta: meta}},
+		{"Service", &corev1.Service{ObjectMeta: meta}},
+		{"Service", &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Name:      headlessServiceNameOf(s.Status.ServerGroup),
+			Namespace: m.cfg.WorkingNamespace,
+		}}},
+		{"Secret", &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      shareUsersSecretName(s.Status.ServerGroup),
+			Namespace: m.cfg.WorkingNamespace,
+		}}},
+		{"Service", &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Name:      metricsServiceName(s.Status.ServerGroup),
+			Namespace: m.cfg.WorkingNamespace,
+		}}},
+	}
+	if m.caps.ServiceMonitors {
+		// without the API, ServiceMonitors can not even be looked up
+		children = append(children, childResource{
+			"ServiceMonitor",
+			serviceMonitorObject(s.Status.ServerGroup, m.cfg.WorkingNamespace),
+		})
+	}
+	return children
+}
+
+// transferGroupOwnership makes newOwner the controller of any server group
+// resource currently controlled by the SmbShare s, so that the resources
+// are not garbage collected along with s. It returns true if a resource
+// was updated.
+func (m *SmbShareManager) transferGroupOwnership(
+	ctx context.Context,
+	s, newOwner *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	changed := false
+	for _, child := range m.groupResources(s) {
+		key := types.NamespacedName{
+			Name:      child.obj.GetName(),
+			Namespace: child.obj.GetNamespace(),
+		}
+		err := m.client.Get(ctx, key, child.obj)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			m.logger.Error(err, "Failed to get "+child.kind,
+				child.kind+".Namespace", key.Namespace,
+				child.kind+".Name", key.Name)
+			return false, err
+		}
+		owner := metav1.GetControllerOf(child.obj)
+		if owner == nil || owner.UID != s.UID {
+			continue
+		}
+		releaseChild(s, child.obj)
+		err = controllerutil.SetControllerReference(
+			newOwner, child.obj, m.scheme)
+		if err != nil {
+			return false, err
+		}
+		err = m.client.Update(
+			ctx, child.obj, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to update "+child.kind,
+				child.kind+".Namespace", key.Namespace,
+				child.kind+".Name", key.Name)
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// leaveGroupDeployment updates the deployment of the server group so that
+// it no longer serves the share of the planner. It returns true if the
+// deployment was changed.
+func (m *SmbShareManager) leaveGroupDeployment(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	ns := m.cfg.WorkingNamespace
+	deployment := &appsv1.Deployment{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{Name: planner.instanceName(), Namespace: ns},
+		deployment)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get Deployment",
+			"Deployment.Namespace", ns,
+			"Deployment.Name", planner.instanceName())
+		return false, err
+	}
+	return m.updateDeploymentPodSettings(ctx, planner, deployment, ns)
+}
+
+// deleteChild deletes the given child resource of the SmbShare. It returns
+// true once the resource no longer exists.
+func (m *SmbShareManager) deleteChild(
+	ctx context.Context,
+	s *sambaoperatorv1alpha1.SmbShare,
+	child childResource) (bool, error) {
+	// ---
+	kind, obj := child.kind, child.obj
+	nsname := types.NamespacedName{
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+	}
+	err := m.client.Get(ctx, nsname, obj)
+	if errors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get resource",
+			"kind", kind,
+			"namespace", nsname.Namespace,
+			"name", nsname.Name)
+		return false, err
+	}
+	if obj.GetDeletionTimestamp() != nil {
+		// deletion in progress
+		return false, nil
+	}
+	m.logger.Info("Deleting resource",
+		"kind", kind,
+		"namespace", nsname.Namespace,
+		"name", nsname.Name)
+	m.recorder.Eventf(s,
+		EventNormal,
+		ReasonDeleting,
+		"Deleting %s %s", kind, nsname.Name)
+	err = m.client.Delete(
+		ctx, obj, rtclient.PropagationPolicy(metav1.DeletePropagationForeground))
+	if err != nil && !errors.IsNotFound(err) {
+		m.logger.Error(err, "Failed to delete resource",
+			"kind", kind,
+			"namespace", nsname.Namespace,
+			"name", nsname.Name)
+		return false, err
+	}
+	return false, nil
+}
+
+// updateDeploymentWorkload creates the server deployment of the share, or
+// updates its size and pod settings. It returns the deployment, and true
+// if it was created or changed.
+func (m *SmbShareManager) updateDeploymentWorkload(
+	ctx context.Context, planner *sharePlanner, ns string) (
+	*appsv1.Deployment, bool, error) {
+	// ---
+	deployment, created, err := m.getOrCreateDeployment(
+		ctx, planner, ns)
+	if err != nil {
+		return nil, false, err
+	} else if created {
+		// Deployment created successfully - return and requeue
+		m.logger.Info("Created deployment")
+		m.recorder.Eventf(planner.SmbShare,
+			EventNormal,
+			ReasonCreatedDeployment,
+			"Created deployment %s for SmbShare", deployment.Name)
+		return deployment, true, nil
+	}
+
+	resized, err := m.updateDeploymentSize(ctx, planner, deployment)
+	if err != nil {
+		return nil, false, err
+	} else if resized {
+		m.logger.Info("Resized deployment")
+		m.recorder.Eventf(planner.SmbShare,
+			EventNormal,
+			ReasonUpdatedDeployment,
+			"Resized deployment %s to %d replicas",
+			deployment.Name, *deployment.Spec.Replicas)
+		return deployment, true, nil
+	}
+
+	updated, err := m.updateDeploymentPodSettings(
+		ctx, planner, deployment, ns)
+	if err != nil {
+		return nil, false, err
+	} else if updated {
+		m.logger.Info("Updated deployment pod settings")
+		m.recorder.Eventf(planner.SmbShare,
+			EventNormal,
+			ReasonUpdatedDeployment,
+			"Updated pod settings of deployment %s", deployment.Name)
+		return deployment, true, nil
+	}
+	return deployment, false, nil
+}
+
+func (m *SmbShareManager) getOrCreateDeployment(
+	ctx context.Context,
+	planner *sharePlanner,
+	ns string) (*appsv1.Deployment, bool, error) {
+	// Check if the deployment already exists, if not create a new one
+	found := &appsv1.Deployment{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{
+			Name:      planner.instanceName(),
+			Namespace: ns,
+		},
+		found)
+	if err == nil {
+		return found, false, nil
+	}
+
+	if errors.IsNotFound(err) {
+		// not found - define a new deployment
+		dep := m.deploymentForSmbShare(planner, ns)
+		// set the smbshare instance as the owner and controller
+		if err := m.setOwner(planner.SmbShare, dep); err != nil {
+			return dep, false, err
+		}
+		m.logger.Info(
+			"Creating a new Deployment",
+			"Deployment.Namespace", dep.Namespace,
+			"Deployment.Name", dep.Name)
+		err = m.client.Create(ctx, dep, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(
+				err,
+				"Failed to create new Deployment",
+				"Deployment.Namespace", dep.Namespace,
+				"Deployment.Name", dep.Name)
+			return dep, false, err
+		}
+		// Deployment created successfully
+		return dep, true, nil
+	}
+	m.logger.Error(err, "Failed to get Deployment")
+	return nil, false, err
+}
+
+func (m *SmbShareManager) getOrCreatePvc(
+	ctx context.Context,
+	smbShare *sambaoperatorv1alpha1.SmbShare,
+	ns string) (*corev1.PersistentVolumeClaim, bool, error) {
+	// Check if the pvc already exists, if not create it
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{
+			Name:      pvcName(smbShare),
+			Namespace: ns,
+		},
+		pvc)
+	if err == nil {
 		return pvc, false, nil
 	}
 
-	if errors.IsNotFound(err) {
-		// not found - define a new pvc
-		pvc = m.pvcForSmbShare(smbShare, ns)
-		m.logger.Info("Creating a new PVC",
-			"pvc.Namespace", pvc.Namespace, "pvc.Name", pvc.Name)
-		err = m.client.Create(ctx, pvc)
-		if err != nil {
-			m.logger.Error(err, "Failed to create new PVC",
-				"pvc.Namespace", pvc.Namespace, "pvc.Name", pvc.Name)
-			return pvc, false, err
-		}
-		// Pvc created successfully
-		return pvc, true, nil
+	if errors.IsNotFound(err) {
+		// not found - define a new pvc
+		pvc = pvcForSmbShare(smbShare, ns)
+		// a retained PVC must outlive the share, so it is not owned by it
+		if !pvcRetained(smbShare) {
+			if err := m.setOwner(smbShare, pvc); err != nil {
+				return pvc, false, err
+			}
+		}
+		m.logger.Info("Creating a new PVC",
+			"pvc.Namespace", pvc.Namespace, "pvc.Name", pvc.Name)
+		err = m.client.Create(ctx, pvc)
+		if err != nil {
+			m.logger.Error(err, "Failed to create new PVC",
+				"pvc.Namespace", pvc.Namespace, "pvc.Name", pvc.Name)
+			return pvc, false, err
+		}
+		// Pvc created successfully
+		return pvc, true, nil
+	}
+	m.logger.Error(err, "Failed to get PVC")
+	return nil, false, err
+}
+
+// updatePvcAnnotations reconciles the annotations of the PVC created for the
+// share with those of the share's pvc section. It returns true if the PVC
+// was updated.
+func (m *SmbShareManager) updatePvcAnnotations(
+	ctx context.Context,
+	s *sambaoperatorv1alpha1.SmbShare,
+	pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	// ---
+	if !mergePvcAnnotations(pvc, s) {
+		return false, nil
+	}
+	m.logger.Info("Updating PVC annotations",
+		"pvc.Namespace", pvc.Namespace, "pvc.Name", pvc.Name)
+	err := m.client.Update(ctx, pvc, rtclient.FieldOwner(fieldManager))
+	if err != nil {
+		m.logger.Error(err, "Failed to update PVC",
+			"pvc.Namespace", pvc.Namespace, "pvc.Name", pvc.Name)
+		return false, err
+	}
+	m.recorder.Eventf(s,
+		EventNormal,
+		ReasonUpdatedPersistentVolumeClaim,
+		"Updated the annotations of PVC %s", pvc.Name)
+	return true, nil
+}
+
+// checkDeletionBlocked returns true if the share is protected from deletion
+// and clients are still connected to it, setting the Degraded condition on
+// the SmbShare. The share is not protected if it is annotated to be
+// force-deleted, or if its connections can not be counted.
+func (m *SmbShareManager) checkDeletionBlocked(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	if !planner.deletionProtection() || m.conns == nil ||
+		s.GetAnnotations()[forceDeleteAnnotation] == "true" {
+		// ---
+		return false, nil
+	}
+	count, err := m.countConnections(ctx, planner, m.cfg.WorkingNamespace)
+	if err != nil {
+		return false, err
+	}
+	if count == nil || count.Total == 0 {
+		return false, nil
+	}
+	msg := fmt.Sprintf(
+		"Deletion blocked by %d client connections to the share; "+
+			"annotate the SmbShare with %s=true to delete it anyway",
+		count.Total, forceDeleteAnnotation)
+	return true, m.setDegraded(ctx, s, ReasonDeletionBlocked, msg)
+}
+
+// checkJoinStatus reports the state of the domain join of the server pods
+// in the DomainJoined condition of the SmbShare. If a join failed, after
+// all retries, the Degraded condition is also set using the output of the
+// join and false is returned.
+func (m *SmbShareManager) checkJoinStatus(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	pods := &corev1.PodList{}
+	err := m.client.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{
+			svcSelectorKey: labelValue(planner.instanceName()),
+		})
+	if err != nil {
+		m.logger.Error(err, "Failed to list pods", "namespace", ns)
+		return false, err
+	}
+	state := joinState{
+		status:  corev1.ConditionUnknown,
+		reason:  ReasonJoinPending,
+		message: "Waiting for pods to be created",
+	}
+	for i := range pods.Items {
+		ps := podJoinState(&pods.Items[i])
+		ps.message = fmt.Sprintf("Pod %s: %s", pods.Items[i].Name, ps.message)
+		if i == 0 || joinStatePriority(ps) > joinStatePriority(state) {
+			state = ps
+		}
+	}
+
+	s := planner.SmbShare
+	changed := setCondition(&s.Status.Conditions, sambaoperatorv1alpha1.Condition{
+		Type:               sambaoperatorv1alpha1.ConditionDomainJoined,
+		Status:             state.status,
+		ObservedGeneration: s.Generation,
+		Reason:             state.reason,
+		Message:            state.message,
+	})
+	if state.status == corev1.ConditionFalse {
+		msg := "Domain join failed: " + state.message
+		return false, m.setDegraded(ctx, s, ReasonJoinFailed, msg)
+	}
+	if changed {
+		if err := m.client.Status().Update(ctx, s); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// checkDNSRegistration records a warning event on the SmbShare for each
+// server pod whose DNS registration failed.
+func (m *SmbShareManager) checkDNSRegistration(
+	ctx context.Context, planner *sharePlanner, ns string) error {
+	// ---
+	if planner.dnsRegister() == dnsRegisterNever {
+		return nil
+	}
+	pods := &corev1.PodList{}
+	err := m.client.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{
+			svcSelectorKey: labelValue(planner.instanceName()),
+		})
+	if err != nil {
+		m.logger.Error(err, "Failed to list pods", "namespace", ns)
+		return err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if failure := podDNSRegisterFailure(pod); failure != "" {
+			m.recorder.Eventf(planner.SmbShare,
+				EventWarning,
+				ReasonDNSRegistrationFailed,
+				"Pod %s: DNS registration failed: %s", pod.Name, failure)
+		}
+	}
+	return nil
+}
+
+// joinStatePriority is used to pick the state reported for a group of
+// pods. Failures are reported first, followed by joins in progress.
+func joinStatePriority(js joinState) int {
+	switch js.status {
+	case corev1.ConditionFalse:
+		return 2
+	case corev1.ConditionUnknown:
+		return 1
+	}
+	return 0
+}
+
+// validateAccessControl checks that the access control lists of the share
+// are consistent. If not, the Degraded condition is set on the SmbShare
+// and false is returned.
+func (m *SmbShareManager) validateAccessControl(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	conflicts := accessControlConflicts(s.Spec.AccessControl)
+	if len(conflicts) == 0 {
+		return true, nil
+	}
+	msg := fmt.Sprintf(
+		"Users and groups may not be in both readList and writeList: %s",
+		strings.Join(conflicts, ", "))
+	return false, m.setDegraded(ctx, s, ReasonInvalidAccessControl, msg)
+}
+
+// validateFileModes checks that the file and directory modes of the share
+// are valid octal permissions. If not, the Degraded condition is set on the
+// SmbShare and false is returned.
+func (m *SmbShareManager) validateFileModes(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	invalid := invalidFileModes(s)
+	if len(invalid) == 0 {
+		return true, nil
+	}
+	msg := fmt.Sprintf("Invalid octal file modes: %s",
+		strings.Join(invalid, ", "))
+	return false, m.setDegraded(ctx, s, ReasonInvalidFileMode, msg)
+}
+
+// validateACLs checks that the ACLs of the share are only edited from
+// Windows when they are stored as Windows NT ACLs. If not, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateACLs(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	acls := s.Spec.ACLs
+	if acls == nil || !acls.WindowsEditing || acls.Mode == aclModeWindows {
+		return true, nil
+	}
+	return false, m.setDegraded(ctx, s, ReasonInvalidACLs,
+		"acls windowsEditing requires the windows ACL mode")
+}
+
+// mappedDosAttributes returns the names of the DOS attributes the share maps
+// to the permissions of its files.
+func mappedDosAttributes(s *sambaoperatorv1alpha1.SmbShare) []string {
+	mapping := s.Spec.DosAttributeMapping
+	if mapping == nil {
+		return nil
+	}
+	mapped := []string{}
+	enabled := func(v *bool) bool { return v != nil && *v }
+	if enabled(mapping.Archive) {
+		mapped = append(mapped, "archive")
+	}
+	if enabled(mapping.Hidden) {
+		mapped = append(mapped, "hidden")
+	}
+	if enabled(mapping.System) {
+		mapped = append(mapped, "system")
+	}
+	if mapping.ReadOnly != "" && mapping.ReadOnly != smbcc.No {
+		mapped = append(mapped, "readOnly")
+	}
+	return mapped
+}
+
+// validateDosAttributes checks that the share only maps DOS attributes to
+// the permissions of its files when it does not store them in extended
+// attributes, samba storing them by default. If not, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateDosAttributes(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	mapped := mappedDosAttributes(s)
+	store := s.Spec.StoreDosAttributes
+	if len(mapped) == 0 || (store != nil && !*store) {
+		return true, nil
+	}
+	return false, m.setDegraded(ctx, s, ReasonInvalidDosAttributes,
+		fmt.Sprintf(
+			"DOS attributes mapped to file permissions require storeDosAttributes to be false: %s",
+			strings.Join(mapped, ", ")))
+}
+
+// validateFilePatterns checks that the veto and hide file patterns of the
+// share can be passed to samba. If not, the Degraded condition is set on
+// the SmbShare and false is returned.
+func (m *SmbShareManager) validateFilePatterns(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	invalid := invalidFilePatterns(s)
+	if len(invalid) == 0 {
+		return true, nil
+	}
+	msg := fmt.Sprintf("Invalid file name patterns: %s",
+		strings.Join(invalid, ", "))
+	return false, m.setDegraded(ctx, s, ReasonInvalidFilePattern, msg)
+}
+
+// validateHosts checks that the hosts allow and deny lists of the share
+// only hold IP addresses, CIDR networks and host names. If not, the
+// Degraded condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateHosts(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	invalid := invalidHosts(s)
+	if len(invalid) == 0 {
+		return true, nil
+	}
+	msg := fmt.Sprintf("Invalid hosts: %s", strings.Join(invalid, ", "))
+	return false, m.setDegraded(ctx, s, ReasonInvalidHosts, msg)
+}
+
+// validateSymlinks checks that a share allowing wide links also follows
+// symbolic links. If not, the Degraded condition is set on the SmbShare
+// and false is returned.
+func (m *SmbShareManager) validateSymlinks(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	follow := s.Spec.FollowSymlinks
+	if !s.Spec.WideLinks || follow == nil || *follow {
+		return true, nil
+	}
+	return false, m.setDegraded(ctx, s, ReasonInvalidSymlinks,
+		"wideLinks requires followSymlinks")
+}
+
+// validateReadOnlyMount checks that a share whose PVC is mounted read-only
+// does not let clients write to it, and does not need to write to the
+// volume when its pods start. If not, the Degraded condition is set on the
+// SmbShare and false is returned.
+func (m *SmbShareManager) validateReadOnlyMount(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	if !readOnlyMount(s) {
+		return true, nil
+	}
+	conflicts := []string{}
+	if s.Spec.GuestAccess == guestDropBox {
+		conflicts = append(conflicts, "guestAccess dropBox")
+	}
+	if ac := s.Spec.AccessControl; ac != nil && len(ac.WriteList) > 0 {
+		conflicts = append(conflicts, "accessControl writeList")
+	}
+	if s.Spec.HomeDirectories != nil {
+		conflicts = append(conflicts, "homeDirectories")
+	}
+	if s.Spec.Storage.InitPermissions != nil {
+		conflicts = append(conflicts, "storage initPermissions")
+	}
+	if s.Spec.MSDFS != nil && len(s.Spec.MSDFS.Links) > 0 {
+		conflicts = append(conflicts, "msdfs links")
+	}
+	if unicodeNormalization(s) != "" {
+		conflicts = append(conflicts, "unicodeNormalization")
+	}
+	if len(conflicts) == 0 {
+		return true, nil
+	}
+	return false, m.setDegraded(ctx, s, ReasonInvalidReadOnlyMount,
+		fmt.Sprintf("readOnlyMount can not be used with %s",
+			strings.Join(conflicts, ", ")))
+}
+
+// validateSync checks that a share flushing every write to disk honors the
+// flush requests of clients and can be written to by some users. If not, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateSync(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	if !s.Spec.SyncAlways {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(ctx, s, ReasonInvalidSync, msg)
+	}
+	if strict := s.Spec.StrictSync; strict != nil && !*strict {
+		return degraded("syncAlways requires strictSync")
+	}
+	// the users of the write list may write to a read-only share
+	writers := s.Spec.AccessControl != nil &&
+		len(s.Spec.AccessControl.WriteList) > 0
+	readOnly := s.Spec.ReadOnly || s.Spec.GuestAccess == guestRead
+	if readOnlyMount(s) || (readOnly && !writers) {
+		return degraded("syncAlways can not be used on a read-only share")
+	}
+	return true, nil
+}
+
+// validateHandles checks that a share with durable handles can use leases
+// and does not use kernel oplocks, and that a share with persistent handles
+// is clustered. If not, the Degraded condition is set on the SmbShare and
+// false is returned.
+func (m *SmbShareManager) validateHandles(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	if !durableHandles(s) {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(ctx, s, ReasonInvalidHandles, msg)
+	}
+	if s.Spec.PersistentHandles && !planner.clustered() {
+		return degraded("persistentHandles requires a clustered share")
+	}
+	if v := s.Spec.KernelOplocks; v != nil && *v {
+		return degraded("durableHandles can not be used with kernelOplocks")
+	}
+	if v := planner.leases(); v != nil && !*v {
+		return degraded(
+			"durableHandles requires leases, which are turned off for the server group")
+	}
+	return true, nil
+}
+
+// validateSharePath checks that the path of the share renders, if it is a
+// template, and names a directory within its volume. If not, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateSharePath(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	p, err := renderStoragePath(s)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid path template %q: %v",
+			s.Spec.Storage.Path, err)
+		return false, m.setDegraded(ctx, s, ReasonInvalidPath, msg)
+	}
+	if validSharePath(p) {
+		return true, nil
+	}
+	invalid := fmt.Sprintf("%q", p)
+	if p != s.Spec.Storage.Path {
+		invalid += fmt.Sprintf(", rendered from %q,", s.Spec.Storage.Path)
+	}
+	msg := fmt.Sprintf("Invalid path %s: must be a relative path "+
+		"within the volume, without . or .. components", invalid)
+	return false, m.setDegraded(ctx, s, ReasonInvalidPath, msg)
+}
+
+// validateGuestAccess checks that a share allowing guest access uses a
+// security config in user mode, that the settings of a dropbox share do
+// not contradict it and that a guest account is only set along with guest
+// access. If not, the Degraded condition is set on the SmbShare and false
+// is returned.
+func (m *SmbShareManager) validateGuestAccess(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	spec := &s.Spec
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(ctx, s, ReasonInvalidGuestAccess, msg)
+	}
+	if spec.GuestAccess == "" {
+		if spec.GuestAccount != "" {
+			return degraded("guestAccount requires guestAccess")
+		}
+		return true, nil
+	}
+	if spec.GuestAccount != "" && !validAccountName(spec.GuestAccount, userMode) {
+		return degraded(fmt.Sprintf(
+			"Invalid guest account: %q", spec.GuestAccount))
+	}
+	if spec.HomeDirectories != nil {
+		return degraded("Home directories shares can not allow guest access")
+	}
+	if spec.GuestAccess == guestDropBox {
+		switch {
+		case spec.ReadOnly:
+			return degraded("Dropbox shares can not be read-only")
+		case spec.CreateMask != "" || spec.DirectoryMask != "":
+			return degraded(
+				"Dropbox shares set their own createMask and directoryMask")
+		}
+	}
+	security, err := m.getSecurityConfig(ctx, s)
+	if errors.IsNotFound(err) {
+		// reported once the share's configuration is updated
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if security != nil && securityMode(security.Spec.Mode) == adMode {
+		return degraded(
+			"Guest access requires a SmbSecurityConfig in user mode")
+	}
+	return true, nil
+}
+
+// validateDNSName checks that the DNS name the share is to be published
+// under is a valid hostname and that its DNS aliases are valid host names.
+// If not, the Degraded condition is set on the
+// SmbShare and false is returned.
+func (m *SmbShareManager) validateDNSName(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	name := s.Spec.PublishDNSName
+	if name != "" && !validDNSName(name) {
+		msg := fmt.Sprintf("Invalid DNS name: %s", name)
+		return false, m.setDegraded(ctx, s, ReasonInvalidDNSName, msg)
+	}
+	for _, alias := range s.Spec.DNSAliases {
+		if !validDNSAlias(alias) {
+			msg := fmt.Sprintf("Invalid DNS alias: %s", alias)
+			return false, m.setDegraded(ctx, s, ReasonInvalidDNSName, msg)
+		}
+	}
+	return true, nil
+}
+
+// checkRouteSupport records a warning event on shares published for use
+// like an OpenShift Route, explaining how the share is exposed instead.
+func (m *SmbShareManager) checkRouteSupport(planner *sharePlanner) {
+	if !planner.routeRequested() {
+		return
+	}
+	msg := "OpenShift Routes only carry HTTP and TLS traffic, not SMB"
+	if !m.caps.Routes {
+		msg = "The OpenShift Route API is not available in this cluster"
+	}
+	m.recorder.Eventf(planner.SmbShare,
+		EventWarning,
+		ReasonRouteUnsupported,
+		"%s; the share is exposed on a node port instead", msg)
+}
+
+// warnShareNameInUse records a warning event on a share whose share name
+// is also used by SmbShares of other server groups in the namespace. The
+// shares are served by different servers, so they do not conflict, but
+// clients may easily reach the wrong one.
+func (m *SmbShareManager) warnShareNameInUse(
+	ctx context.Context, planner *sharePlanner) error {
+	// ---
+	s := planner.SmbShare
+	l := &sambaoperatorv1alpha1.SmbShareList{}
+	if err := m.client.List(ctx, l, rtclient.InNamespace(s.Namespace)); err != nil {
+		m.logger.Error(err, "Failed to list SmbShares",
+			"namespace", s.Namespace)
+		return err
+	}
+	for i := range l.Items {
+		other := &l.Items[i]
+		if other.Name == s.Name || other.GetDeletionTimestamp() != nil ||
+			shareServerGroup(other) == s.Status.ServerGroup ||
+			!sameShareName(other, s) {
+			// ---
+			continue
+		}
+		m.recorder.Eventf(s,
+			EventWarning,
+			ReasonShareNameInUse,
+			"Share name %s is also used by SmbShare %s of server group %s",
+			shareNameOf(s), other.Name, shareServerGroup(other))
+	}
+	return nil
+}
+
+// warnMultiChannelSingleNetwork records a warning event on a share whose
+// server supports SMB3 multichannel while its pods are only attached to the
+// cluster network: with a single interface, clients have no other
+// connection to add to their sessions.
+func (m *SmbShareManager) warnMultiChannelSingleNetwork(planner *sharePlanner) {
+	if !planner.multiChannel() || len(planner.networkAttachments()) > 0 {
+		return
+	}
+	m.recorder.Event(planner.SmbShare,
+		EventWarning,
+		ReasonMultiChannelSingleNetwork,
+		"SMB3 multichannel is enabled, but the server pods are only "+
+			"attached to the cluster network: clients can not open more "+
+			"than one channel")
+}
+
+// warnWideLinks records a warning event on a share allowing wide links, as
+// clients may then reach files outside of the share.
+func (m *SmbShareManager) warnWideLinks(planner *sharePlanner) {
+	if !planner.SmbShare.Spec.WideLinks {
+		return
+	}
+	m.recorder.Event(planner.SmbShare,
+		EventWarning,
+		ReasonWideLinksEnabled,
+		"Wide links are enabled: clients may follow symbolic links to "+
+			"any file the samba server can read, outside of the share")
+}
+
+// validateMacOS checks that Spotlight is only enabled on shares providing
+// the SMB extensions of macOS clients, which Spotlight relies on. If not,
+// the Degraded condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateMacOS(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	if !planner.spotlight() || planner.macOSFruit() {
+		return true, nil
+	}
+	return false, m.setDegraded(ctx, planner.SmbShare, ReasonInvalidMacOS,
+		"Spotlight requires the fruit module: macos.fruit must be enabled")
+}
+
+// warnSpotlightUnavailable records a warning event on a share enabling
+// Spotlight without an Elasticsearch server: without an index, the searches
+// of macOS clients return no results.
+func (m *SmbShareManager) warnSpotlightUnavailable(planner *sharePlanner) {
+	if !planner.spotlight() || planner.SmbShare.Spec.MacOS.Elasticsearch != nil {
+		return
+	}
+	m.recorder.Event(planner.SmbShare,
+		EventWarning,
+		ReasonSpotlightUnavailable,
+		"Spotlight is enabled without an Elasticsearch server: "+
+			"searches of the share return no results")
+}
+
+// validateQuota checks that the quota of the share, if active, is a
+// positive size. If not, the Degraded condition is set on the SmbShare and
+// false is returned.
+func (m *SmbShareManager) validateQuota(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	if size, ok := quotaBytesOf(s); ok && size <= 0 {
+		msg := fmt.Sprintf("Invalid quota size: %s", s.Spec.Quota.Size.String())
+		return false, m.setDegraded(ctx, s, ReasonInvalidQuota, msg)
+	}
+	return true, nil
+}
+
+// updatePublishedDNSName records the DNS name the share is published
+// under in the status of the SmbShare. It returns true if the status was
+// changed.
+func (m *SmbShareManager) updatePublishedDNSName(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	if s.Status.PublishedDNSName == s.Spec.PublishDNSName {
+		return false, nil
+	}
+	s.Status.PublishedDNSName = s.Spec.PublishDNSName
+	return true, m.client.Status().Update(ctx, s)
+}
+
+// updateServedPort records the port the share is served on in the status
+// of the SmbShare. It returns true if the status was changed.
+func (m *SmbShareManager) updateServedPort(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	port := planner.smbPort()
+	if s.Status.Port == port {
+		return false, nil
+	}
+	s.Status.Port = port
+	return true, m.client.Status().Update(ctx, s)
+}
+
+// validatePort checks that the port the share is to be served on is a
+// valid port that is not used by another container of the server pods. If
+// not, the Degraded condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validatePort(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	port := planner.smbPort()
+	if port < 1 || port > 65535 {
+		msg := fmt.Sprintf("Invalid port: %d", port)
+		return false, m.setDegraded(ctx, planner.SmbShare, ReasonInvalidPort, msg)
+	}
+	dep := m.deploymentForSmbShare(planner, m.cfg.WorkingNamespace)
+	for _, c := range dep.Spec.Template.Spec.Containers {
+		if c.Name == m.cfg.SmbdContainerName {
+			continue
+		}
+		for _, p := range c.Ports {
+			if p.ContainerPort == port {
+				msg := fmt.Sprintf(
+					"Port %d is used by the %s container", port, c.Name)
+				return false, m.setDegraded(
+					ctx, planner.SmbShare, ReasonInvalidPort, msg)
+			}
+		}
+	}
+	return true, nil
+}
+
+// validInterface returns true if s names a network interface, or gives an
+// address or network in CIDR notation, as samba's interfaces parameter
+// accepts. Linux interface names are at most 15 characters long and may not
+// contain slashes or spaces.
+func validInterface(s string) bool {
+	if _, _, err := net.ParseCIDR(s); err == nil {
+		return true
+	}
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	return s != "" && len(s) <= 15 && !strings.ContainsAny(s, "/ \t\n,;=")
+}
+
+// validateInterfaces checks that the network interfaces the server listens
+// on are valid. If not, the Degraded condition is set on the SmbShare and
+// false is returned.
+func (m *SmbShareManager) validateInterfaces(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	for _, iface := range planner.interfaces() {
+		if !validInterface(iface) {
+			msg := fmt.Sprintf("Invalid interface: %q", iface)
+			return false, m.setDegraded(
+				ctx, planner.SmbShare, ReasonInvalidInterfaces, msg)
+		}
+	}
+	return true, nil
+}
+
+// validateServerIdentity checks that the NetBIOS name of the servers has at
+// most 15 upper case characters, that the server string is a single line
+// and that the workgroup of domain members matches their realm. If not, the
+// Degraded condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateServerIdentity(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidServerIdentity, msg)
+	}
+	if planner.CommonConfig == nil {
+		return true, nil
+	}
+	spec := planner.CommonConfig.Spec
+	if n := spec.NetbiosName; n != "" && !validNetbiosName(n) {
+		return degraded(fmt.Sprintf("Invalid NetBIOS name: %q", n))
+	}
+	if strings.IndexFunc(spec.ServerString, unicode.IsControl) >= 0 {
+		return degraded(fmt.Sprintf("Invalid server string: %q", spec.ServerString))
+	}
+	if w := spec.Workgroup; w != "" && planner.securityMode() == adMode &&
+		!strings.EqualFold(w, planner.workgroup()) {
+		// ---
+		return degraded(fmt.Sprintf(
+			"Workgroup %s conflicts with the workgroup %s of realm %s",
+			w, planner.workgroup(), planner.realm()))
+	}
+	return true, nil
+}
+
+// defaultSMB2MaxWrite is samba's default of the largest write of SMB2
+// clients.
+const defaultSMB2MaxWrite = 8 * mebibyte
+
+// validatePerformance checks that the minimum size of the writes received
+// without copies is not larger than the largest write the servers allow,
+// which would never use the zero-copy path, and that the aio write behind
+// patterns can be passed to samba. If not, the Degraded condition is set on
+// the SmbShare and false is returned.
+func (m *SmbShareManager) validatePerformance(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidPerformance, msg)
+	}
+	if planner.CommonConfig == nil || planner.CommonConfig.Spec.Performance == nil {
+		return true, nil
+	}
+	perf := planner.CommonConfig.Spec.Performance
+	maxWrite := int64(defaultSMB2MaxWrite)
+	if perf.SMB2MaxWrite != nil {
+		maxWrite = *perf.SMB2MaxWrite
+	}
+	if size := perf.MinReceivefileSize; size != nil && *size > maxWrite {
+		return degraded(fmt.Sprintf(
+			"minReceivefileSize %d is larger than the largest write of %d bytes",
+			*size, maxWrite))
+	}
+	if invalid := invalidPatterns(perf.AioWriteBehind); len(invalid) > 0 {
+		return degraded(fmt.Sprintf("Invalid aio write behind patterns: %s",
+			strings.Join(invalid, ", ")))
+	}
+	return true, nil
+}
+
+// validNetbiosName returns true if the name is a NetBIOS name of at most 15
+// upper case letters, digits, underscores and dashes.
+func validNetbiosName(name string) bool {
+	if name == "" || len(name) > 15 || name[0] == '_' || name[0] == '-' {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateAuthentication checks that the authentication protocols of the
+// security config leave clients a way to authenticate and that LANMAN is
+// only enabled along with NTLMv1, as samba requires. If not, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateAuthentication(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	auth := planner.authentication()
+	if auth == nil {
+		return true, nil
+	}
+	var msg string
+	switch {
+	case planner.ntlmAuth() == ntlmDisabled &&
+		planner.securityMode() != adMode:
+		// ---
+		msg = "Disabling NTLM requires a SmbSecurityConfig in " +
+			"active-directory mode, as users can only log in with kerberos"
+	case auth.LanmanAuth && planner.ntlmAuth() != ntlmV1Permitted:
+		msg = fmt.Sprintf(
+			"lanmanAuth requires ntlmAuth to be %q", ntlmV1Permitted)
+	default:
+		return true, nil
+	}
+	return false, m.setDegraded(
+		ctx, planner.SmbShare, ReasonInvalidAuthentication, msg)
+}
+
+// validateExtraMounts checks that each extra mount names exactly one
+// ConfigMap or Secret, that the mounts are not mounted on or within the
+// paths of other mounts of the samba server containers, nor those within
+// them, and that at most one file is included into smb.conf. If not, the
+// Degraded condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateExtraMounts(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	extra := planner.extraMounts()
+	if len(extra) == 0 {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidExtraMount, msg)
+	}
+	includes := 0
+	for _, em := range extra {
+		if (em.ConfigMap == "") == (em.Secret == "") {
+			return degraded(fmt.Sprintf(
+				"Extra mount %s must set exactly one of configMap and secret",
+				em.Name))
+		}
+		if !path.IsAbs(em.MountPath) {
+			return degraded(fmt.Sprintf(
+				"Extra mount %s has a relative mount path: %s",
+				em.Name, em.MountPath))
+		}
+		if em.Include != "" {
+			includes++
+		}
+	}
+	if includes > 1 {
+		return degraded("Only one extra mount may set include")
+	}
+	dep := m.deploymentForSmbShare(planner, m.cfg.WorkingNamespace)
+	for _, c := range dep.Spec.Template.Spec.Containers {
+		for i, vm := range c.VolumeMounts {
+			if !strings.HasPrefix(vm.Name, extraVolumePrefix) {
+				continue
+			}
+			for j, other := range c.VolumeMounts {
+				if i == j || !pathsOverlap(vm.MountPath, other.MountPath) {
+					continue
+				}
+				return degraded(fmt.Sprintf(
+					"Extra mount %s at %s overlaps with the %s mount at %s",
+					strings.TrimPrefix(vm.Name, extraVolumePrefix),
+					vm.MountPath, other.Name, other.MountPath))
+			}
+		}
+	}
+	return true, nil
+}
+
+// validateCustomConfig checks that the ConfigMap holding the custom smb.conf
+// of the share's server group exists in the working namespace and has the
+// smb.conf under the expected key, and that no extra mount includes another
+// file, which the custom smb.conf would replace. If not, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateCustomConfig(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	c := planner.customConfig()
+	if c == nil {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidCustomConfig, msg)
+	}
+	if planner.includePath() != "" {
+		return degraded(
+			"Extra mounts can not set include along with a customConfig")
+	}
+	cm := &corev1.ConfigMap{}
+	err := m.client.Get(ctx,
+		types.NamespacedName{Name: c.ConfigMap, Namespace: m.cfg.WorkingNamespace},
+		cm)
+	if errors.IsNotFound(err) {
+		return degraded(fmt.Sprintf("ConfigMap %s not found", c.ConfigMap))
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get ConfigMap",
+			"ConfigMap.Namespace", m.cfg.WorkingNamespace,
+			"ConfigMap.Name", c.ConfigMap)
+		return false, err
+	}
+	key := planner.customConfigFile()
+	if _, found := cm.Data[key]; !found {
+		return degraded(fmt.Sprintf(
+			"ConfigMap %s has no %s key", c.ConfigMap, key))
+	}
+	return true, nil
+}
+
+// pathsOverlap returns true if the paths are the same, or one path is
+// within the other.
+func pathsOverlap(a, b string) bool {
+	a, b = path.Clean(a), path.Clean(b)
+	within := func(p, dir string) bool {
+		return dir == "/" || strings.HasPrefix(p, dir+"/")
+	}
+	return a == b || within(a, b) || within(b, a)
+}
+
+// updateQuotaStatus measures the usage of the share's quota and records it
+// in the status of the SmbShare. A warning event is recorded if the share
+// goes over its quota. Returns true if the status was changed.
+func (m *SmbShareManager) updateQuotaStatus(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	size, ok := planner.quotaBytes()
+	if !ok {
+		if s.Status.Quota == nil {
+			return false, nil
+		}
+		s.Status.Quota = nil
+		return true, m.client.Status().Update(ctx, s)
+	}
+	if m.usage == nil || s.Spec.Storage.Pvc == nil {
+		return false, nil
+	}
+	pods := &corev1.PodList{}
+	err := m.client.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{
+			svcSelectorKey: labelValue(planner.instanceName()),
+		})
+	if err != nil {
+		m.logger.Error(err, "Failed to list pods", "namespace", ns)
+		return false, err
+	}
+	var (
+		used  int64
+		found bool
+	)
+	for i := range pods.Items {
+		if pods.Items[i].Status.Phase != corev1.PodRunning {
+			continue
+		}
+		used, found, err = m.usage.VolumeUsage(ctx, &pods.Items[i], pvcName(s))
+		if err != nil {
+			// the kubelet of a single node may be unreachable; try the
+			// other pods before giving up.
+			m.logger.Error(err, "Failed to get volume usage",
+				"Pod.Namespace", ns, "Pod.Name", pods.Items[i].Name)
+			continue
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	wasExceeded := planner.quotaExceeded()
+	status := &sambaoperatorv1alpha1.SmbShareQuotaStatus{
+		Used:     resource.NewQuantity(used, resource.BinarySI),
+		Exceeded: used >= size,
+	}
+	if cur := s.Status.Quota; cur != nil && cur.Used != nil &&
+		cur.Used.Value() == used && cur.Exceeded == status.Exceeded {
+		return false, nil
+	}
+	s.Status.Quota = status
+	if err := m.client.Status().Update(ctx, s); err != nil {
+		return false, err
+	}
+	if status.Exceeded && !wasExceeded {
+		m.recorder.Eventf(s,
+			EventWarning,
+			ReasonQuotaExceeded,
+			"Share uses %s of its %s quota and is now read-only",
+			status.Used.String(), s.Spec.Quota.Size.String())
+	}
+	return true, nil
+}
+
+// validateStorage checks that the PVC of the share has a file system, that
+// the storage class that will be used for a PVC not created yet exists and
+// that the PVC can be shared by all replicas of the server. If a problem
+// is found a warning event is recorded and the Degraded condition is set
+// on the SmbShare. It returns true if the
+// storage is valid. Otherwise false is returned and no further resources
+// should be created for the share.
+func (m *SmbShareManager) validateStorage(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	if s.Spec.Storage.Pvc != nil {
+		mode, err := m.pvcVolumeMode(ctx, s, ns)
+		if err != nil {
+			return false, err
+		}
+		if mode != corev1.PersistentVolumeFilesystem {
+			msg := fmt.Sprintf(
+				"PVC %s has volume mode %s: samba serves files, which "+
+					"requires volume mode %s",
+				pvcName(s), mode, corev1.PersistentVolumeFilesystem)
+			return false, m.setDegraded(ctx, s, ReasonInvalidVolumeMode, msg)
+		}
+	}
+	if planner.replicas() > 1 {
+		modes, err := m.pvcAccessModes(ctx, s, ns)
+		if err != nil {
+			return false, err
+		}
+		if !hasAccessMode(modes, corev1.ReadWriteMany) {
+			msg := fmt.Sprintf(
+				"PVC for SmbShare must support %s when using %d replicas",
+				corev1.ReadWriteMany, planner.replicas())
+			return false, m.setDegraded(ctx, s, ReasonInvalidAccessMode, msg)
+		}
+	}
+
+	if !shareNeedsPvc(s) {
+		return true, nil
+	}
+	if msg := invalidPvcAnnotations(s); msg != "" {
+		return false, m.setDegraded(ctx, s, ReasonInvalidPvcAnnotations, msg)
+	}
+	scName := pvcStorageClassName(s)
+	if scName == "" {
+		// the default storage class will be used
+		return true, nil
+	}
+	// the storage class is only needed to create the PVC: an existing PVC
+	// keeps working if its storage class is deleted
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := m.client.Get(
+		ctx, types.NamespacedName{Name: pvcName(s), Namespace: ns}, pvc)
+	if err == nil {
+		return true, nil
+	} else if !errors.IsNotFound(err) {
+		m.logger.Error(err, "Failed to get PVC",
+			"pvc.Namespace", ns, "pvc.Name", pvcName(s))
+		return false, err
+	}
+	sc := &storagev1.StorageClass{}
+	err = m.client.Get(ctx, types.NamespacedName{Name: scName}, sc)
+	if errors.IsNotFound(err) {
+		msg := fmt.Sprintf("Storage class %s not found", scName)
+		return false, m.setDegraded(ctx, s, ReasonInvalidStorageClass, msg)
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get StorageClass",
+			"StorageClass.Name", scName)
+		return false, err
+	}
+	return true, nil
+}
+
+// checkImagePullSecrets records a warning event on the SmbShare for each
+// image pull secret that does not exist in the namespace of the pods.
+// Missing secrets do not prevent creating the pods, but without the event
+// the resulting ImagePullBackOff errors can be hard to diagnose.
+func (m *SmbShareManager) checkImagePullSecrets(
+	ctx context.Context, planner *sharePlanner, ns string) error {
+	// ---
+	for _, ref := range planner.imagePullSecrets() {
+		secret := &corev1.Secret{}
+		err := m.client.Get(
+			ctx,
+			types.NamespacedName{Name: ref.Name, Namespace: ns},
+			secret)
+		if errors.IsNotFound(err) {
+			m.recorder.Eventf(planner.SmbShare,
+				EventWarning,
+				ReasonMissingImagePullSecret,
+				"Image pull secret %s not found in namespace %s",
+				ref.Name, ns)
+		} else if err != nil {
+			m.logger.Error(err, "Failed to get image pull secret",
+				"Secret.Namespace", ns, "Secret.Name", ref.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+// checkXattrSupport records a warning event if the share stores ACLs, or
+// DOS attributes, in extended attributes but is backed by a persistent
+// volume of a type known not to support them. Volumes that are not yet
+// bound, or of other types, are assumed to support extended attributes.
+func (m *SmbShareManager) checkXattrSupport(
+	ctx context.Context, planner *sharePlanner, ns string) error {
+	// ---
+	s := planner.SmbShare
+	features := []string{}
+	if planner.windowsACLs() {
+		features = append(features, "Windows ACLs")
+	}
+	if planner.storeDosAttributes() {
+		features = append(features, "DOS attributes")
+	}
+	if planner.macOSFruit() {
+		features = append(features, "macOS streams")
+	}
+	if len(features) == 0 || s.Spec.Storage.Pvc == nil {
+		return nil
+	}
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{Name: pvcName(s), Namespace: ns},
+		pvc)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get PVC",
+			"pvc.Namespace", ns, "pvc.Name", pvcName(s))
+		return err
+	}
+	if pvc.Spec.VolumeName == "" {
+		return nil
+	}
+	pv := &corev1.PersistentVolume{}
+	err = m.client.Get(
+		ctx, types.NamespacedName{Name: pvc.Spec.VolumeName}, pv)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get PV", "pv.Name", pvc.Spec.VolumeName)
+		return err
+	}
+	if vtype := xattrUnsupportedVolumeType(pv); vtype != "" {
+		m.recorder.Eventf(s,
+			EventWarning,
+			ReasonXattrsUnsupported,
+			"%s require extended attributes which %s volume %s may not support",
+			strings.Join(features, " and "), vtype, pv.Name)
+	}
+	return nil
+}
+
+// xattrUnsupportedVolumeType returns the type of the persistent volume if
+// volumes of that type generally lack support for extended attributes.
+// Otherwise, an empty string is returned.
+func xattrUnsupportedVolumeType(pv *corev1.PersistentVolume) string {
+	switch {
+	case pv.Spec.NFS != nil:
+		return "NFS"
+	case pv.Spec.AzureFile != nil:
+		return "AzureFile"
+	}
+	return ""
+}
+
+// validateKeytab checks that the keytab secret, if any, exists and
+// contains a keytab. If not, the Degraded condition is set on the SmbShare
+// and false is returned.
+func (m *SmbShareManager) validateKeytab(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	name := planner.keytabSecret()
+	if name == "" {
+		return true, nil
+	}
+	secret := &corev1.Secret{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{Name: name, Namespace: ns},
+		secret)
+	if errors.IsNotFound(err) {
+		msg := fmt.Sprintf("Keytab secret %s not found in namespace %s",
+			name, ns)
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidKeytab, msg)
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get keytab secret",
+			"Secret.Namespace", ns, "Secret.Name", name)
+		return false, err
+	}
+	if len(secret.Data[planner.keytabFileName()]) == 0 {
+		msg := fmt.Sprintf("Keytab secret %s has no %s key",
+			name, planner.keytabFileName())
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidKeytab, msg)
+	}
+	return true, nil
+}
+
+// validateKrb5Conf checks that the krb5.conf ConfigMap, if any, exists and
+// contains a krb5.conf. If not, the Degraded condition is set on the
+// SmbShare and false is returned.
+func (m *SmbShareManager) validateKrb5Conf(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	name := planner.krb5ConfConfigMap()
+	if name == "" {
+		return true, nil
+	}
+	cm := &corev1.ConfigMap{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{Name: name, Namespace: ns},
+		cm)
+	if errors.IsNotFound(err) {
+		msg := fmt.Sprintf("Kerberos ConfigMap %s not found in namespace %s",
+			name, ns)
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidKrb5Conf, msg)
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get krb5.conf ConfigMap",
+			"ConfigMap.Namespace", ns, "ConfigMap.Name", name)
+		return false, err
+	}
+	if strings.TrimSpace(cm.Data[planner.krb5ConfFileName()]) == "" {
+		msg := fmt.Sprintf("Kerberos ConfigMap %s has no %s key",
+			name, planner.krb5ConfFileName())
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidKrb5Conf, msg)
+	}
+	return true, nil
+}
+
+// validateDNSUpdate checks that the options of the DNS updates of the
+// security config are consistent, and that the TSIG key secret, if any,
+// exists and contains the key. If not, the Degraded condition is set on the
+// SmbShare and false is returned.
+func (m *SmbShareManager) validateDNSUpdate(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	if planner.dnsRegister() == dnsRegisterNever {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidDNSUpdate, msg)
+	}
+	method := planner.dnsUpdateMethod()
+	key := planner.dnsTSIGKey()
+	switch {
+	case method == dnsUpdateTSIG && key == nil:
+		return degraded("DNS update method tsig requires a tsigKey")
+	case method != dnsUpdateTSIG && key != nil:
+		return degraded(fmt.Sprintf(
+			"A tsigKey may not be used with DNS update method %s", method))
+	}
+	if server := planner.dnsServer(); server != "" &&
+		net.ParseIP(server) == nil && !validDNSName(server) {
+		// ---
+		return degraded(fmt.Sprintf("Invalid DNS server: %q", server))
+	}
+	if key == nil {
+		return true, nil
+	}
+	secret := &corev1.Secret{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{Name: key.Secret, Namespace: ns},
+		secret)
+	if errors.IsNotFound(err) {
+		return degraded(fmt.Sprintf(
+			"TSIG key secret %s not found in namespace %s", key.Secret, ns))
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get TSIG key secret",
+			"Secret.Namespace", ns, "Secret.Name", key.Secret)
+		return false, err
+	}
+	if len(secret.Data[planner.dnsTSIGKeyFile()]) == 0 {
+		return degraded(fmt.Sprintf("TSIG key secret %s has no %s key",
+			key.Secret, planner.dnsTSIGKeyFile()))
+	}
+	return true, nil
+}
+
+// validateForcedIDs checks that the user and group the files of the share
+// are forced to are valid names. In user mode, they must also be known to
+// the users secret of the security config: samba creates a group for each
+// user, alongside the groups of the secret. If not, the Degraded condition
+// is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateForcedIDs(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	spec := &planner.SmbShare.Spec
+	if spec.ForceUser == "" && spec.ForceGroup == "" {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidForcedID, msg)
+	}
+	mode := planner.securityMode()
+	if spec.ForceUser != "" && !validAccountName(spec.ForceUser, mode) {
+		return degraded(fmt.Sprintf("Invalid forceUser: %q", spec.ForceUser))
+	}
+	if spec.ForceGroup != "" && !validAccountName(spec.ForceGroup, mode) {
+		return degraded(fmt.Sprintf("Invalid forceGroup: %q", spec.ForceGroup))
+	}
+	uss := planner.userSecuritySource()
+	if mode != userMode || !uss.Configured {
+		// domain accounts are resolved by winbind once the share runs
+		return true, nil
+	}
+	users, err := m.getUsersConfig(ctx, planner, ns)
+	if err != nil {
+		return false, err
+	} else if users == nil {
+		return true, nil
+	}
+	userNames := configUserNames(users)
+	groupNames := configGroupNames(planner, users)
+	if spec.ForceUser != "" && !userNames[spec.ForceUser] {
+		return degraded(fmt.Sprintf(
+			"forceUser %s is not a user of users secret %s",
+			spec.ForceUser, uss.Secret))
+	}
+	if spec.ForceGroup != "" && !groupNames[spec.ForceGroup] {
+		return degraded(fmt.Sprintf(
+			"forceGroup %s is not a group of users secret %s",
+			spec.ForceGroup, uss.Secret))
+	}
+	return true, nil
+}
+
+// checkPriorityClass records a warning event if the PriorityClass of the
+// share's pods does not exist. Pods referring to a missing PriorityClass
+// are rejected, so the share's pods will not be created until it does.
+func (m *SmbShareManager) checkPriorityClass(
+	ctx context.Context, planner *sharePlanner) error {
+	// ---
+	name := planner.priorityClassName()
+	if name == "" {
+		return nil
+	}
+	pc := &schedulingv1.PriorityClass{}
+	err := m.client.Get(ctx, types.NamespacedName{Name: name}, pc)
+	if errors.IsNotFound(err) {
+		m.recorder.Eventf(planner.SmbShare,
+			EventWarning,
+			ReasonMissingPriorityClass,
+			"PriorityClass %s not found", name)
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get PriorityClass",
+			"PriorityClass.Name", name)
+		return err
+	}
+	return nil
+}
+
+// pvcAccessModes returns the access modes of the PVC backing the share.
+// For a new PVC these are the modes it will be created with. For an
+// existing PVC the modes are read from the PVC itself.
+func (m *SmbShareManager) pvcAccessModes(
+	ctx context.Context,
+	s *sambaoperatorv1alpha1.SmbShare,
+	ns string) ([]corev1.PersistentVolumeAccessMode, error) {
+	// ---
+	if shareNeedsPvc(s) {
+		return pvcSpecAccessModes(s), nil
+	}
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{
+			Name:      pvcName(s),
+			Namespace: ns,
+		},
+		pvc)
+	if err != nil {
+		m.logger.Error(err, "Failed to get PVC",
+			"pvc.Namespace", ns, "pvc.Name", pvcName(s))
+		return nil, err
+	}
+	return pvc.Spec.AccessModes, nil
+}
+
+// pvcVolumeMode returns the volume mode of the PVC backing the share. For
+// a new PVC this is the mode it will be created with. For an existing PVC
+// the mode is read from the PVC itself, and Filesystem is assumed if the
+// PVC does not exist yet.
+func (m *SmbShareManager) pvcVolumeMode(
+	ctx context.Context,
+	s *sambaoperatorv1alpha1.SmbShare,
+	ns string) (corev1.PersistentVolumeMode, error) {
+	// ---
+	if shareNeedsPvc(s) {
+		return pvcSpecVolumeMode(s), nil
+	}
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{
+			Name:      pvcName(s),
+			Namespace: ns,
+		},
+		pvc)
+	if errors.IsNotFound(err) {
+		return corev1.PersistentVolumeFilesystem, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get PVC",
+			"pvc.Namespace", ns, "pvc.Name", pvcName(s))
+		return "", err
+	}
+	if pvc.Spec.VolumeMode == nil {
+		// the API server defaults to Filesystem
+		return corev1.PersistentVolumeFilesystem, nil
+	}
+	return *pvc.Spec.VolumeMode, nil
+}
+
+// setDegraded records a warning event and sets the Degraded condition
+// on the SmbShare.
+func (m *SmbShareManager) setDegraded(
+	ctx context.Context,
+	s *sambaoperatorv1alpha1.SmbShare,
+	reason, msg string) error {
+	// ---
+	m.logger.Info("SmbShare is degraded", "reason", reason, "message", msg)
+	m.recorder.Event(s, EventWarning, reason, msg)
+	changed := setCondition(
+		&s.Status.Conditions,
+		degradedCondition(s.Generation, reason, msg))
+	if !changed {
+		return nil
+	}
+	return m.client.Status().Update(ctx, s)
+}
+
+// clearDegraded sets the Degraded condition of the SmbShare to false.
+func (m *SmbShareManager) clearDegraded(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	changed := setCondition(
+		&s.Status.Conditions,
+		notDegradedCondition(s.Generation))
+	if !changed {
+		return false, nil
+	}
+	return true, m.client.Status().Update(ctx, s)
+}
+
+// updateSuspendedStatus sets the Suspended condition of the SmbShare to
+// match its spec. Shares that were never suspended get no condition. It
+// returns true if the status was updated.
+func (m *SmbShareManager) updateSuspendedStatus(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	suspended := planner.suspended()
+	cond := findCondition(
+		s.Status.Conditions, sambaoperatorv1alpha1.ConditionSuspended)
+	if cond == nil && !suspended {
+		return false, nil
 	}
-	m.logger.Error(err, "Failed to get PVC")
-	return nil, false, err
+	changed := setCondition(
+		&s.Status.Conditions, suspendedCondition(s.Generation, suspended))
+	if !changed {
+		return false, nil
+	}
+	if err := m.client.Status().Update(ctx, s); err != nil {
+		return false, err
+	}
+	if suspended {
+		m.recorder.Event(s, EventNormal, ReasonSuspended,
+			"Suspended the share, it is no longer served")
+	} else {
+		m.recorder.Event(s, EventNormal, ReasonResumed,
+			"Resumed the share, it is served again")
+	}
+	return true, nil
 }
 
 func (m *SmbShareManager) updateDeploymentSize(
 	ctx context.Context,
+	planner *sharePlanner,
 	deployment *appsv1.Deployment) (bool, error) {
 	// Ensure the deployment size is the same as the spec
-	var size int32 = 1
+	size := planner.replicas()
 	if *deployment.Spec.Replicas != size {
 		deployment.Spec.Replicas = &size
-		err := m.client.Update(ctx, deployment)
+		err := m.writeChild(
+			ctx,
+			deployment,
+			m.deploymentForSmbShare(planner, deployment.Namespace))
 		if err != nil {
 			m.logger.Error(
 				err,
@@ -311,18 +2960,128 @@ func (m *SmbShareManager) updateDeploymentSize(
 	return false, nil
 }
 
+func (m *SmbShareManager) updateDeploymentPodSettings(
+	ctx context.Context,
+	planner *sharePlanner,
+	deployment *appsv1.Deployment,
+	ns string) (bool, error) {
+	// ---
+	desired := m.deploymentForSmbShare(planner, ns)
+	changed := updatePodTemplateSettings(deployment, desired)
+	if updateDeploymentStrategy(deployment, desired) {
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+	err := m.writeChild(ctx, deployment, desired)
+	if err != nil {
+		m.logger.Error(
+			err,
+			"Failed to update Deployment",
+			"Deployment.Namespace", deployment.Namespace,
+			"Deployment.Name", deployment.Name)
+		return false, err
+	}
+	return true, nil
+}
+
+// updatePodDisruptionBudget creates, updates or deletes the
+// PodDisruptionBudget of the share to match the settings of the share's
+// SmbCommonConfig. It returns true if a change was made.
+func (m *SmbShareManager) updatePodDisruptionBudget(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	desired := newPodDisruptionBudgetForSmb(planner, ns)
+	found := &policyv1beta1.PodDisruptionBudget{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{
+			Name:      planner.instanceName(),
+			Namespace: ns,
+		},
+		found)
+	if errors.IsNotFound(err) {
+		if desired == nil {
+			return false, nil
+		}
+		// set the smbshare instance as the owner and controller
+		if err := m.setOwner(planner.SmbShare, desired); err != nil {
+			return false, err
+		}
+		m.logger.Info("Creating a new PodDisruptionBudget",
+			"PodDisruptionBudget.Namespace", desired.Namespace,
+			"PodDisruptionBudget.Name", desired.Name)
+		err := m.client.Create(
+			ctx, desired, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to create new PodDisruptionBudget",
+				"PodDisruptionBudget.Namespace", desired.Namespace,
+				"PodDisruptionBudget.Name", desired.Name)
+			return false, err
+		}
+		m.recorder.Eventf(planner.SmbShare,
+			EventNormal,
+			ReasonCreatedPodDisruptionBudget,
+			"Created PodDisruptionBudget %s for SmbShare", desired.Name)
+		return true, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get PodDisruptionBudget")
+		return false, err
+	}
+
+	if desired == nil {
+		m.logger.Info("Deleting PodDisruptionBudget",
+			"PodDisruptionBudget.Namespace", found.Namespace,
+			"PodDisruptionBudget.Name", found.Name)
+		err = m.client.Delete(ctx, found)
+		if err != nil && !errors.IsNotFound(err) {
+			m.logger.Error(err, "Failed to delete PodDisruptionBudget",
+				"PodDisruptionBudget.Namespace", found.Namespace,
+				"PodDisruptionBudget.Name", found.Name)
+			return false, err
+		}
+		m.recorder.Eventf(planner.SmbShare,
+			EventNormal,
+			ReasonDeleting,
+			"Deleting PodDisruptionBudget %s", found.Name)
+		return true, nil
+	}
+	if !updatePodDisruptionBudget(found, desired) {
+		return false, nil
+	}
+	if err := m.writeChild(ctx, found, desired); err != nil {
+		m.logger.Error(err, "Failed to update PodDisruptionBudget",
+			"PodDisruptionBudget.Namespace", found.Namespace,
+			"PodDisruptionBudget.Name", found.Name)
+		return false, err
+	}
+	m.recorder.Eventf(planner.SmbShare,
+		EventNormal,
+		ReasonUpdatedPodDisruptionBudget,
+		"Updated PodDisruptionBudget %s for SmbShare", found.Name)
+	return true, nil
+}
+
 // deploymentForSmbShare returns a smbshare deployment object
 func (m *SmbShareManager) deploymentForSmbShare(
 	planner *sharePlanner, ns string) *appsv1.Deployment {
 	// labels - do I need them?
-	dep := buildDeployment(
-		m.cfg, planner, planner.SmbShare.Spec.Storage.Pvc.Name, ns)
-	// set the smbshare instance as the owner and controller
-	controllerutil.SetControllerReference(planner.SmbShare, dep, m.scheme)
+	dep := buildDeployment(m.cfg, planner, ownPvcName(planner), ns)
 	return dep
 }
 
-func (m *SmbShareManager) pvcForSmbShare(
+// ownPvcName returns the name of the PVC of the planner's share, or an
+// empty string if the share does not use a PVC.
+func ownPvcName(planner *sharePlanner) string {
+	if pvc := planner.SmbShare.Spec.Storage.Pvc; pvc != nil {
+		return pvc.Name
+	}
+	return ""
+}
+
+// pvcForSmbShare returns the PVC to be created for the share.
+func pvcForSmbShare(
 	s *sambaoperatorv1alpha1.SmbShare,
 	ns string) *corev1.PersistentVolumeClaim {
 	// build a new pvc
@@ -330,14 +3089,59 @@ func (m *SmbShareManager) pvcForSmbShare(
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      pvcName(s),
 			Namespace: ns,
+			Labels: map[string]string{
+				managedByLabelKey: "samba-operator",
+			},
 		},
-		Spec: *s.Spec.Storage.Pvc.Spec,
+		Spec: *s.Spec.Storage.Pvc.Spec.DeepCopy(),
+	}
+	if scName := s.Spec.Storage.Pvc.StorageClassName; scName != "" {
+		pvc.Spec.StorageClassName = &scName
 	}
+	pvc.Spec.AccessModes = pvcSpecAccessModes(s)
+	mode := pvcSpecVolumeMode(s)
+	pvc.Spec.VolumeMode = &mode
+	mergePvcAnnotations(pvc, s)
+	return pvc
+}
 
-	// set the smb share instance as the owner and controller
-	controllerutil.SetControllerReference(s, pvc, m.scheme)
+// invalidPvcAnnotations returns why the annotations of the share's pvc
+// section can not be set on its PVC, or an empty string if they can.
+func invalidPvcAnnotations(s *sambaoperatorv1alpha1.SmbShare) string {
+	annotations := s.Spec.Storage.Pvc.Annotations
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Sprintf("Invalid PVC annotation key %q: %s",
+				k, strings.Join(errs, "; "))
+		}
+		if strings.HasPrefix(k, operatorLabelPrefix) {
+			return fmt.Sprintf(
+				"PVC annotation %s is used by the operator and can not be set", k)
+		}
+	}
+	return ""
+}
 
-	return pvc
+// mergePvcAnnotations sets the annotations of the share's pvc section on a
+// PVC created for the share, removing those set before that the share no
+// longer lists. It returns true if the PVC was changed.
+func mergePvcAnnotations(
+	pvc *corev1.PersistentVolumeClaim,
+	s *sambaoperatorv1alpha1.SmbShare) bool {
+	// ---
+	if pvc.Annotations == nil {
+		pvc.Annotations = map[string]string{}
+	}
+	return mergeTracked(
+		pvc.Annotations,
+		pvc.Annotations,
+		s.Spec.Storage.Pvc.Annotations,
+		pvcAnnotationsAnnotationKey)
 }
 
 func pvcName(s *sambaoperatorv1alpha1.SmbShare) string {
@@ -347,10 +3151,71 @@ func pvcName(s *sambaoperatorv1alpha1.SmbShare) string {
 	return s.Name + "-pvc"
 }
 
+// pvcStorageClassName returns the name of the storage class requested for
+// a new PVC or an empty string if the default storage class is to be used.
+func pvcStorageClassName(s *sambaoperatorv1alpha1.SmbShare) string {
+	pvc := s.Spec.Storage.Pvc
+	if pvc.StorageClassName != "" {
+		return pvc.StorageClassName
+	}
+	if pvc.Spec.StorageClassName != nil {
+		return *pvc.Spec.StorageClassName
+	}
+	return ""
+}
+
+// pvcSpecAccessModes returns the access modes for a new PVC. Modes given
+// directly in the share's pvc section override those of the embedded
+// PVC spec.
+func pvcSpecAccessModes(
+	s *sambaoperatorv1alpha1.SmbShare) []corev1.PersistentVolumeAccessMode {
+	// ---
+	if len(s.Spec.Storage.Pvc.AccessModes) > 0 {
+		return s.Spec.Storage.Pvc.AccessModes
+	}
+	return s.Spec.Storage.Pvc.Spec.AccessModes
+}
+
+// pvcSpecVolumeMode returns the volume mode for a new PVC. A mode given
+// directly in the share's pvc section overrides that of the embedded PVC
+// spec, and Filesystem is used if neither sets one.
+func pvcSpecVolumeMode(
+	s *sambaoperatorv1alpha1.SmbShare) corev1.PersistentVolumeMode {
+	// ---
+	if mode := s.Spec.Storage.Pvc.VolumeMode; mode != nil {
+		return *mode
+	}
+	if mode := s.Spec.Storage.Pvc.Spec.VolumeMode; mode != nil {
+		return *mode
+	}
+	return corev1.PersistentVolumeFilesystem
+}
+
+func hasAccessMode(
+	modes []corev1.PersistentVolumeAccessMode,
+	mode corev1.PersistentVolumeAccessMode) bool {
+	// ---
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+func pvcRetained(s *sambaoperatorv1alpha1.SmbShare) bool {
+	return s.Spec.Storage.Pvc.RetainPolicy == "Retain"
+}
+
 func shareNeedsPvc(s *sambaoperatorv1alpha1.SmbShare) bool {
 	return s.Spec.Storage.Pvc != nil && s.Spec.Storage.Pvc.Spec != nil
 }
 
+// readOnlyMount returns true if the PVC of the share is mounted read-only.
+func readOnlyMount(s *sambaoperatorv1alpha1.SmbShare) bool {
+	return s.Spec.Storage.Pvc != nil && s.Spec.Storage.Pvc.ReadOnlyMount
+}
+
 func (m *SmbShareManager) updateConfiguration(
 	ctx context.Context,
 	cm *corev1.ConfigMap,
@@ -361,6 +3226,44 @@ func (m *SmbShareManager) updateConfiguration(
 		m.logger.Error(err, "unable to read samba container config")
 		return nil, false, err
 	}
+	planner, err := m.newPlanner(ctx, cc, s)
+	if err != nil {
+		return nil, false, err
+	}
+	var changed bool
+	if s.GetDeletionTimestamp() != nil {
+		changed, err = planner.prune()
+	} else {
+		changed, err = planner.update()
+	}
+	if err != nil {
+		m.logger.Error(err, "unable to update samba container config")
+		return nil, false, err
+	}
+	if !changed {
+		return planner, false, nil
+	}
+	err = setContainerConfig(cm, planner.ConfigState)
+	if err != nil {
+		m.logger.Error(err, "unable to set container config in config map")
+		return nil, false, err
+	}
+	err = m.client.Update(ctx, cm)
+	if err != nil {
+		m.logger.Error(err, "failed to update config map")
+		return nil, false, err
+	}
+	return planner, true, nil
+}
+
+// newPlanner returns the planner of the share over the container config,
+// with the share's security config, common config and server group
+// members.
+func (m *SmbShareManager) newPlanner(
+	ctx context.Context,
+	cc *smbcc.SambaContainerConfig,
+	s *sambaoperatorv1alpha1.SmbShare) (*sharePlanner, error) {
+	// ---
 	isDeleting := s.GetDeletionTimestamp() != nil
 	security, err := m.getSecurityConfig(ctx, s)
 	if err != nil {
@@ -375,7 +3278,7 @@ func (m *SmbShareManager) updateConfiguration(
 			security = nil
 		} else {
 			m.logger.Error(err, "failed to get SmbSecurityConfig")
-			return nil, false, err
+			return nil, err
 		}
 	}
 	common, err := m.getCommonConfig(ctx, s)
@@ -388,43 +3291,34 @@ func (m *SmbShareManager) updateConfiguration(
 			common = nil
 		} else {
 			m.logger.Error(err, "failed to get SmbCommonConfig")
-			return nil, false, err
+			return nil, err
 		}
 	}
 
-	// extract config from map
+	var defaultCommon *sambaoperatorv1alpha1.SmbCommonConfig
+	if s.Spec.CommonConfig != "" {
+		defaultCommon, err = m.getDefaultCommonConfig(ctx, s.Namespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	members, err := m.groupMembers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
 	planner := newSharePlanner(
 		InstanceConfiguration{
-			SmbShare:       s,
-			SecurityConfig: security,
-			CommonConfig:   common,
-			GlobalConfig:   m.cfg,
+			SmbShare:            s,
+			SecurityConfig:      security,
+			CommonConfig:        common,
+			GlobalConfig:        m.cfg,
+			GroupShares:         members,
+			DefaultCommonConfig: defaultCommon,
 		},
 		cc)
-	var changed bool
-	if isDeleting {
-		changed, err = planner.prune()
-	} else {
-		changed, err = planner.update()
-	}
-	if err != nil {
-		m.logger.Error(err, "unable to update samba container config")
-		return nil, false, err
-	}
-	if !changed {
-		return planner, false, nil
-	}
-	err = setContainerConfig(cm, planner.ConfigState)
-	if err != nil {
-		m.logger.Error(err, "unable to set container config in config map")
-		return nil, false, err
-	}
-	err = m.client.Update(ctx, cm)
-	if err != nil {
-		m.logger.Error(err, "failed to update config map")
-		return nil, false, err
-	}
-	return planner, true, nil
+	return planner, nil
 }
 
 func (m *SmbShareManager) addFinalizer(
@@ -457,12 +3351,33 @@ func (m *SmbShareManager) getSecurityConfig(
 	return security, nil
 }
 
+// DefaultCommonConfigLabelKey is the label designating the SmbCommonConfig
+// used by the SmbShares of its namespace that do not refer to one, when set
+// to "true".
+const DefaultCommonConfigLabelKey = "samba-operator.samba.org/default-common-config"
+
+// IsDefaultCommonConfig returns true if the object is labeled as the
+// default common config of its namespace.
+func IsDefaultCommonConfig(obj metav1.Object) bool {
+	return obj.GetLabels()[DefaultCommonConfigLabelKey] == "true"
+}
+
+// StorageClassOf returns the name of the storage class requested for the
+// PVC the operator creates for the share, or an empty string if the share
+// has no such PVC or the default storage class is to be used.
+func StorageClassOf(s *sambaoperatorv1alpha1.SmbShare) string {
+	if !shareNeedsPvc(s) {
+		return ""
+	}
+	return pvcStorageClassName(s)
+}
+
 func (m *SmbShareManager) getCommonConfig(
 	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (
 	*sambaoperatorv1alpha1.SmbCommonConfig, error) {
 	// check if the share specifies a common config
 	if s.Spec.CommonConfig == "" {
-		return nil, nil
+		return m.getDefaultCommonConfig(ctx, s.Namespace)
 	}
 
 	nsname := types.NamespacedName{
@@ -477,6 +3392,33 @@ func (m *SmbShareManager) getCommonConfig(
 	return cconfig, nil
 }
 
+// getDefaultCommonConfig returns the default common config of the
+// namespace, or nil if there is none. If several common configs are
+// labeled as the default, the first one by name is used.
+func (m *SmbShareManager) getDefaultCommonConfig(
+	ctx context.Context, ns string) (
+	*sambaoperatorv1alpha1.SmbCommonConfig, error) {
+	// ---
+	l := &sambaoperatorv1alpha1.SmbCommonConfigList{}
+	err := m.client.List(ctx, l,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{DefaultCommonConfigLabelKey: "true"})
+	if err != nil {
+		return nil, err
+	}
+	if len(l.Items) == 0 {
+		return nil, nil
+	}
+	sort.Slice(l.Items, func(i, j int) bool {
+		return l.Items[i].Name < l.Items[j].Name
+	})
+	if len(l.Items) > 1 {
+		m.logger.Info("Several default SmbCommonConfigs, using the first",
+			"namespace", ns, "SmbCommonConfig", l.Items[0].Name)
+	}
+	return &l.Items[0], nil
+}
+
 func (m *SmbShareManager) setServerGroup(
 	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
 	// check to see if there's already a group for this
@@ -485,13 +3427,244 @@ func (m *SmbShareManager) setServerGroup(
 		return false, nil
 	}
 
-	// NOTE: currently the ServerGroup is only assigned the exact name of the
-	// resource. In the future this may change if/when multiple SmbShares can
-	// be hosted by one smbd pod.
-	s.Status.ServerGroup = s.ObjectMeta.Name
+	s.Status.ServerGroup = desiredServerGroup(s)
 	return true, m.client.Status().Update(ctx, s)
 }
 
+// desiredServerGroup returns the name of the server group that is to host
+// the share. Unless the share names a group it is hosted by a group of its
+// own, named after the resource.
+func desiredServerGroup(s *sambaoperatorv1alpha1.SmbShare) string {
+	if s.Spec.ServerGroup != "" {
+		return s.Spec.ServerGroup
+	}
+	return s.ObjectMeta.Name
+}
+
+// groupMembers returns the SmbShares, sorted by name, that are members of
+// the server group of the given share. SmbShares being deleted are not
+// included. The given share is included unless it is being deleted.
+func (m *SmbShareManager) groupMembers(
+	ctx context.Context,
+	s *sambaoperatorv1alpha1.SmbShare) ([]sambaoperatorv1alpha1.SmbShare, error) {
+	// ---
+	l := &sambaoperatorv1alpha1.SmbShareList{}
+	if err := m.client.List(ctx, l, rtclient.InNamespace(s.Namespace)); err != nil {
+		m.logger.Error(err, "Failed to list SmbShares",
+			"namespace", s.Namespace)
+		return nil, err
+	}
+	members := []sambaoperatorv1alpha1.SmbShare{}
+	for _, other := range l.Items {
+		if other.Name == s.Name ||
+			other.Status.ServerGroup != s.Status.ServerGroup ||
+			other.GetDeletionTimestamp() != nil {
+			// ---
+			continue
+		}
+		members = append(members, other)
+	}
+	if s.GetDeletionTimestamp() == nil {
+		members = append(members, *s)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+	return members, nil
+}
+
+// validateServerGroup checks that the share can be hosted by its server
+// group. The group may not have changed since it was assigned and all
+// shares of a group must agree on the configuration of the servers and use
+// distinct share names. If not, the Degraded condition is set on the
+// SmbShare and false is returned.
+func (m *SmbShareManager) validateServerGroup(
+	ctx context.Context, s *sambaoperatorv1alpha1.SmbShare) (bool, error) {
+	// ---
+	if group := desiredServerGroup(s); group != s.Status.ServerGroup {
+		msg := fmt.Sprintf(
+			"The server group can not be changed from %s to %s",
+			s.Status.ServerGroup, group)
+		return false, m.setDegraded(ctx, s, ReasonInvalidServerGroup, msg)
+	}
+	members, err := m.groupMembers(ctx, s)
+	if err != nil {
+		return false, err
+	}
+	for i := range members {
+		other := &members[i]
+		if other.Name == s.Name {
+			continue
+		}
+		var conflict string
+		switch {
+		case other.Spec.SecurityConfig != s.Spec.SecurityConfig:
+			conflict = "securityConfig"
+		case other.Spec.CommonConfig != s.Spec.CommonConfig:
+			conflict = "commonConfig"
+		case !equality.Semantic.DeepEqual(
+			other.Spec.PodSettings, s.Spec.PodSettings):
+			conflict = "podSettings"
+		case !equality.Semantic.DeepEqual(other.Spec.Port, s.Spec.Port):
+			conflict = "port"
+		case !equality.Semantic.DeepEqual(
+			other.Spec.Interfaces, s.Spec.Interfaces):
+			conflict = "interfaces"
+		case sameShareName(other, s):
+			conflict = "share name"
+		case other.Spec.GuestAccount != "" && s.Spec.GuestAccount != "" &&
+			other.Spec.GuestAccount != s.Spec.GuestAccount:
+			// ---
+			conflict = "guestAccount"
+		default:
+			continue
+		}
+		msg := fmt.Sprintf(
+			"SmbShare %s of server group %s has a conflicting %s",
+			other.Name, s.Status.ServerGroup, conflict)
+		return false, m.setDegraded(ctx, s, ReasonInvalidServerGroup, msg)
+	}
+	return true, nil
+}
+
+// updateService updates the type and ports of the service of the server
+// group and the annotations ExternalDNS uses to publish it. It returns true if the
+// service was changed.
+func (m *SmbShareManager) updateService(
+	ctx context.Context,
+	planner *sharePlanner,
+	svc *corev1.Service,
+	ns string) (bool, error) {
+	// ---
+	desired := newServiceForSmb(planner, ns)
+	changed := updateServiceDNSNames(svc, desired)
+	if updateServiceHealthCheck(svc, desired) {
+		changed = true
+	}
+	typeChanged := updateServiceType(svc, desired)
+	if typeChanged {
+		changed = true
+	}
+	if updateServicePorts(svc, desired) {
+		changed = true
+	}
+	if updateServiceSelector(svc, desired) {
+		changed = true
+	}
+	if updateServiceSessionAffinity(svc, desired) {
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+	var err error
+	if typeChanged && svc.Spec.Type == corev1.ServiceTypeClusterIP {
+		// the node ports allocated by the API server are not owned by
+		// the operator, so they are only cleared by an update.
+		err = m.client.Update(ctx, svc, rtclient.FieldOwner(fieldManager))
+	} else {
+		var applied runtime.Object = desired
+		if m.caps.IPFamilyPolicy {
+			// the Service type of the API can not express the IP family
+			// settings, which would be dropped when applying it.
+			applied, err = unstructuredService(planner, desired)
+		}
+		if err == nil {
+			err = m.writeChild(ctx, svc, applied)
+		}
+	}
+	if err != nil {
+		m.logger.Error(
+			err,
+			"Failed to update Service",
+			"Service.Namespace", svc.Namespace,
+			"Service.Name", svc.Name)
+		return false, err
+	}
+	return true, nil
+}
+
+// createService creates the service of the server group. The IP family
+// policy and IP families are set if requested and supported by the cluster.
+func (m *SmbShareManager) createService(
+	ctx context.Context, planner *sharePlanner, svc *corev1.Service) error {
+	// ---
+	if !m.caps.IPFamilyPolicy ||
+		(planner.ipFamilyPolicy() == "" && len(planner.ipFamilies()) == 0) {
+		// ---
+		return m.client.Create(ctx, svc, rtclient.FieldOwner(fieldManager))
+	}
+	u, err := unstructuredService(planner, svc)
+	if err != nil {
+		return err
+	}
+	return m.client.Create(ctx, u, rtclient.FieldOwner(fieldManager))
+}
+
+// updateServiceIPFamilies sets the requested IP family policy on the
+// service of the server group and records a warning event if the service
+// does not have the requested IP families. It returns true if the service
+// was changed.
+func (m *SmbShareManager) updateServiceIPFamilies(
+	ctx context.Context, planner *sharePlanner, svc *corev1.Service) (bool, error) {
+	// ---
+	wantPolicy := planner.ipFamilyPolicy()
+	wantFamilies := planner.ipFamilies()
+	if wantPolicy == "" && len(wantFamilies) == 0 {
+		return false, nil
+	}
+	if !m.caps.IPFamilyPolicy {
+		m.recorder.Event(planner.SmbShare,
+			EventWarning,
+			ReasonIPFamilyUnsupported,
+			"IP family settings require Kubernetes 1.20 or later")
+		return false, nil
+	}
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("Service")
+	err := m.client.Get(ctx,
+		types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}, u)
+	if err != nil {
+		m.logger.Error(err, "Failed to get Service",
+			"Service.Namespace", svc.Namespace,
+			"Service.Name", svc.Name)
+		return false, err
+	}
+	policy, families := serviceIPFamilies(u)
+	if wantPolicy != "" && policy != "" && policy != wantPolicy {
+		patch := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		setServiceIPFamilies(patch, wantPolicy, wantFamilies)
+		data, err := json.Marshal(patch.Object)
+		if err != nil {
+			return false, err
+		}
+		err = m.client.Patch(ctx, u,
+			rtclient.RawPatch(types.MergePatchType, data),
+			rtclient.FieldOwner(fieldManager))
+		if errors.IsInvalid(err) {
+			m.recorder.Eventf(planner.SmbShare,
+				EventWarning,
+				ReasonIPFamilyUnsupported,
+				"Failed to change the IP family policy of the Service: %v", err)
+			return false, nil
+		} else if err != nil {
+			m.logger.Error(err, "Failed to update Service",
+				"Service.Namespace", svc.Namespace,
+				"Service.Name", svc.Name)
+			return false, err
+		}
+		return true, nil
+	}
+	if msg := ipFamiliesProblem(wantPolicy, wantFamilies, policy, families); msg != "" {
+		m.recorder.Event(planner.SmbShare,
+			EventWarning,
+			ReasonIPFamilyUnsupported,
+			msg)
+	}
+	return false, nil
+}
+
 func (m *SmbShareManager) getOrCreateService(
 	ctx context.Context, planner *sharePlanner, ns string) (
 	*corev1.Service, bool, error) {
@@ -512,11 +3685,13 @@ func (m *SmbShareManager) getOrCreateService(
 		// not found - define a new deployment
 		svc := newServiceForSmb(planner, ns)
 		// set the smbshare instance as the owner and controller
-		controllerutil.SetControllerReference(planner.SmbShare, svc, m.scheme)
+		if err := m.setOwner(planner.SmbShare, svc); err != nil {
+			return svc, false, err
+		}
 		m.logger.Info("Creating a new Service",
 			"Service.Namespace", svc.Namespace,
 			"Service.Name", svc.Name)
-		err = m.client.Create(ctx, svc)
+		err = m.createService(ctx, planner, svc)
 		if err != nil {
 			m.logger.Error(err, "Failed to create new Service",
 				"Service.Namespace", svc.Namespace,
@@ -0,0 +1,2088 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func pvcShare(
+	scName string,
+	spec *corev1.PersistentVolumeClaimSpec) *sambaoperatorv1alpha1.SmbShare {
+	// ---
+	return &sambaoperatorv1alpha1.SmbShare{
+		Spec: sambaoperatorv1alpha1.SmbShareSpec{
+			Storage: sambaoperatorv1alpha1.SmbShareStorageSpec{
+				Pvc: &sambaoperatorv1alpha1.SmbSharePvcSpec{
+					StorageClassName: scName,
+					Spec:             spec,
+				},
+			},
+		},
+	}
+}
+
+func TestPvcStorageClassName(t *testing.T) {
+	inner := "slow"
+
+	s := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	assert.Equal(t, "", pvcStorageClassName(s))
+
+	s = pvcShare("", &corev1.PersistentVolumeClaimSpec{
+		StorageClassName: &inner,
+	})
+	assert.Equal(t, "slow", pvcStorageClassName(s))
+
+	s = pvcShare("fast", &corev1.PersistentVolumeClaimSpec{
+		StorageClassName: &inner,
+	})
+	assert.Equal(t, "fast", pvcStorageClassName(s))
+}
+
+func TestPvcSpecAccessModes(t *testing.T) {
+	s := pvcShare("", &corev1.PersistentVolumeClaimSpec{
+		AccessModes: []corev1.PersistentVolumeAccessMode{
+			corev1.ReadWriteOnce,
+		},
+	})
+	modes := pvcSpecAccessModes(s)
+	assert.True(t, hasAccessMode(modes, corev1.ReadWriteOnce))
+	assert.False(t, hasAccessMode(modes, corev1.ReadWriteMany))
+
+	s.Spec.Storage.Pvc.AccessModes = []corev1.PersistentVolumeAccessMode{
+		corev1.ReadWriteMany,
+	}
+	modes = pvcSpecAccessModes(s)
+	assert.False(t, hasAccessMode(modes, corev1.ReadWriteOnce))
+	assert.True(t, hasAccessMode(modes, corev1.ReadWriteMany))
+}
+
+func TestPvcVolumeMode(t *testing.T) {
+	filesystem := corev1.PersistentVolumeFilesystem
+	block := corev1.PersistentVolumeBlock
+	s := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	s.Name = "myshare"
+	pvc := pvcForSmbShare(s, "default")
+	if assert.NotNil(t, pvc.Spec.VolumeMode) {
+		assert.Equal(t, filesystem, *pvc.Spec.VolumeMode)
+	}
+	s.Spec.Storage.Pvc.Spec.VolumeMode = &block
+	assert.Equal(t, block, pvcSpecVolumeMode(s))
+	s.Spec.Storage.Pvc.VolumeMode = &filesystem
+	pvc = pvcForSmbShare(s, "default")
+	if assert.NotNil(t, pvc.Spec.VolumeMode) {
+		assert.Equal(t, filesystem, *pvc.Spec.VolumeMode)
+	}
+}
+
+func TestValidateStorageVolumeMode(t *testing.T) {
+	block := corev1.PersistentVolumeBlock
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.Storage.Pvc.VolumeMode = &block
+	m, recorder := newTestManager(share)
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+	valid, err := m.validateStorage(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	event := <-recorder.Events
+	assert.Contains(t, event, ReasonInvalidVolumeMode)
+	assert.Contains(t, event,
+		"PVC myshare-pvc has volume mode Block: samba serves files, "+
+			"which requires volume mode Filesystem")
+
+	filesystem := corev1.PersistentVolumeFilesystem
+	share.Spec.Storage.Pvc.VolumeMode = &filesystem
+	m, _ = newTestManager(share)
+	valid, err = m.validateStorage(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	// the mode of an existing PVC is checked too
+	existing := pvcShare("", nil)
+	existing.Name = "myshare"
+	existing.Namespace = "default"
+	existing.Spec.Storage.Pvc.Name = "blocks"
+	planner = newSharePlanner(
+		InstanceConfiguration{SmbShare: existing},
+		&smbcc.SambaContainerConfig{})
+	m, _ = newTestManager(existing)
+	valid, err = m.validateStorage(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	m, recorder = newTestManager(existing, &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "blocks", Namespace: "default"},
+		Spec:       corev1.PersistentVolumeClaimSpec{VolumeMode: &block},
+	})
+	valid, err = m.validateStorage(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "PVC blocks has volume mode Block")
+}
+
+func TestPvcAnnotations(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.Storage.Pvc.Annotations = map[string]string{
+		"backup.velero.io/backup-volumes": "data",
+		"example.com/tier":                "gold",
+	}
+	m, recorder := newTestManager(share)
+	ctx := context.TODO()
+
+	// the annotations are set at creation
+	pvc, created, err := m.getOrCreatePvc(ctx, share, "default")
+	require.NoError(t, err)
+	assert.True(t, created)
+	get := func() *corev1.PersistentVolumeClaim {
+		t.Helper()
+		pvc := &corev1.PersistentVolumeClaim{}
+		require.NoError(t, m.client.Get(ctx,
+			types.NamespacedName{Namespace: "default", Name: "myshare-pvc"},
+			pvc))
+		return pvc
+	}
+	pvc = get()
+	assert.Equal(t, "data", pvc.Annotations["backup.velero.io/backup-volumes"])
+	assert.Equal(t, "gold", pvc.Annotations["example.com/tier"])
+	changed, err := m.updatePvcAnnotations(ctx, share, pvc)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// and reconciled once the PVC exists, leaving those of others alone
+	pvc.Annotations["pv.kubernetes.io/bind-completed"] = "yes"
+	require.NoError(t, m.client.Update(ctx, pvc))
+	share.Spec.Storage.Pvc.Annotations = map[string]string{
+		"backup.velero.io/backup-volumes": "data,logs",
+	}
+	changed, err = m.updatePvcAnnotations(ctx, share, get())
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonUpdatedPersistentVolumeClaim)
+	pvc = get()
+	assert.Equal(t, "data,logs", pvc.Annotations["backup.velero.io/backup-volumes"])
+	assert.NotContains(t, pvc.Annotations, "example.com/tier")
+	assert.Equal(t, "yes", pvc.Annotations["pv.kubernetes.io/bind-completed"])
+
+	share.Spec.Storage.Pvc.Annotations = nil
+	changed, err = m.updatePvcAnnotations(ctx, share, get())
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, map[string]string{
+		"pv.kubernetes.io/bind-completed": "yes",
+	}, get().Annotations)
+}
+
+func TestValidateStoragePvcAnnotations(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+	check := func(annotations map[string]string, msg string) {
+		t.Helper()
+		share.Spec.Storage.Pvc.Annotations = annotations
+		m, recorder := newTestManager(share)
+		valid, err := m.validateStorage(context.TODO(), planner, "default")
+		assert.NoError(t, err)
+		if msg == "" {
+			assert.True(t, valid)
+			return
+		}
+		assert.False(t, valid)
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonInvalidPvcAnnotations)
+		assert.Contains(t, event, msg)
+	}
+	check(map[string]string{"backup.velero.io/backup-volumes": "data"}, "")
+	check(map[string]string{"bad key": "x"}, `Invalid PVC annotation key "bad key"`)
+	check(map[string]string{pvcAnnotationsAnnotationKey: "x"},
+		"PVC annotation samba-operator.samba.org/pvc-annotations is used by the operator")
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Info(string, ...interface{})         {}
+func (nopLogger) Error(error, string, ...interface{}) {}
+
+func newTestManager(objs ...runtime.Object) (
+	*SmbShareManager, *record.FakeRecorder) {
+	// ---
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = sambaoperatorv1alpha1.AddToScheme(scheme)
+	recorder := record.NewFakeRecorder(10)
+	m := &SmbShareManager{
+		client:   fake.NewFakeClientWithScheme(scheme, objs...),
+		scheme:   scheme,
+		recorder: recorder,
+		logger:   nopLogger{},
+		cfg:      &conf.OperatorConfig{WorkingNamespace: "default"},
+	}
+	return m, recorder
+}
+
+func TestValidateStorageClass(t *testing.T) {
+	share := pvcShare("fast", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	m, recorder := newTestManager(share)
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+
+	valid, err := m.validateStorage(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidStorageClass)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, corev1.ConditionTrue, cond.Status)
+		assert.Equal(t, ReasonInvalidStorageClass, cond.Reason)
+	}
+
+	m, _ = newTestManager(share, &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "fast"},
+	})
+	valid, err = m.validateStorage(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	// once the PVC is created, the storage class is no longer needed
+	m, recorder = newTestManager(share, &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myshare-pvc",
+			Namespace: "default",
+		},
+	})
+	valid, err = m.validateStorage(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Empty(t, recorder.Events)
+}
+
+func TestCheckImagePullSecrets(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{
+		Spec: sambaoperatorv1alpha1.SmbCommonConfigSpec{
+			PodSettings: &sambaoperatorv1alpha1.SmbCommonPodSettings{
+				ImagePullSecrets: []corev1.LocalObjectReference{
+					{Name: "present"},
+					{Name: "missing"},
+				},
+			},
+		},
+	}
+	m, recorder := newTestManager(share, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "present", Namespace: "default"},
+	})
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share, CommonConfig: common},
+		&smbcc.SambaContainerConfig{})
+
+	err := m.checkImagePullSecrets(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	if assert.Len(t, recorder.Events, 1) {
+		ev := <-recorder.Events
+		assert.Contains(t, ev, ReasonMissingImagePullSecret)
+		assert.Contains(t, ev, "missing")
+	}
+}
+
+func TestValidateAccessControl(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.AccessControl = &sambaoperatorv1alpha1.SmbShareAccessControl{
+		ReadList:  []string{"bob"},
+		WriteList: []string{"alice", "bob"},
+	}
+	m, recorder := newTestManager(share)
+
+	valid, err := m.validateAccessControl(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidAccessControl)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, ReasonInvalidAccessControl, cond.Reason)
+		assert.Contains(t, cond.Message, "bob")
+	}
+
+	share.Spec.AccessControl.ReadList = nil
+	valid, err = m.validateAccessControl(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestFinalizeDeletesChildren(t *testing.T) {
+	now := metav1.Now()
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Finalizers = []string{shareFinalizer}
+	share.DeletionTimestamp = &now
+	share.Status.ServerGroup = "myshare"
+	meta := metav1.ObjectMeta{Name: "myshare", Namespace: "default"}
+	m, recorder := newTestManager(
+		share,
+		&appsv1.Deployment{ObjectMeta: meta},
+		&corev1.Service{ObjectMeta: meta},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+			Name:      "myshare-pvc",
+			Namespace: "default",
+		}},
+	)
+	shareUnschedulable.WithLabelValues("default", "myshare").Set(1)
+	shareInfectedFiles.WithLabelValues("default", "myshare").Set(2)
+
+	var res Result
+	for i := 0; i < 5; i++ {
+		res = m.Finalize(context.TODO(), share)
+		assert.NoError(t, res.Err())
+		if !res.Requeue() {
+			break
+		}
+	}
+	assert.False(t, res.Requeue())
+	assert.NotContains(t, share.Finalizers, shareFinalizer)
+
+	ctx := context.TODO()
+	nsname := types.NamespacedName{Name: "myshare", Namespace: "default"}
+	err := m.client.Get(ctx, nsname, &appsv1.Deployment{})
+	assert.True(t, errors.IsNotFound(err))
+	err = m.client.Get(ctx, nsname, &corev1.Service{})
+	assert.True(t, errors.IsNotFound(err))
+	nsname.Name = "myshare-pvc"
+	err = m.client.Get(ctx, nsname, &corev1.PersistentVolumeClaim{})
+	assert.True(t, errors.IsNotFound(err))
+
+	// the metrics of the share are no longer exported
+	assert.False(t,
+		shareUnschedulable.DeleteLabelValues("default", "myshare"))
+	assert.False(t,
+		shareInfectedFiles.DeleteLabelValues("default", "myshare"))
+
+	events := []string{}
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	if assert.Len(t, events, 4) {
+		assert.Contains(t, events[0], "Deleting Deployment")
+		assert.Contains(t, events[1], "Deleting Service")
+		assert.Contains(t, events[2], "Deleting PersistentVolumeClaim")
+		assert.Contains(t, events[3], ReasonDeleted)
+	}
+}
+
+func TestFinalizeDeletionProtection(t *testing.T) {
+	now := metav1.Now()
+	protect := true
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Finalizers = []string{shareFinalizer}
+	share.DeletionTimestamp = &now
+	share.Status.ServerGroup = "myshare"
+	share.Spec.DeletionProtection = &protect
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myshare-a",
+			Namespace: "default",
+			Labels:    map[string]string{svcSelectorKey: "myshare"},
+		},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	m, recorder := newTestManager(share, pod)
+	ctx := context.TODO()
+	_, _, err := getOrCreateConfigMap(ctx, m.client, "default")
+	assert.NoError(t, err)
+	conns := &fakeConnections{count: map[string]int{"myshare-a": 2}}
+	m.SetConnectionCounter(conns)
+	finalize := func() Result {
+		var res Result
+		for i := 0; i < 5; i++ {
+			res = m.Finalize(ctx, share)
+			assert.NoError(t, res.Err())
+			if !res.Requeue() {
+				break
+			}
+		}
+		return res
+	}
+	events := func() []string {
+		events := []string{}
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		return events
+	}
+
+	// clients are connected
+	res := finalize()
+	assert.Equal(t, deletionRecheckInterval, res.RequeueAfter())
+	assert.Contains(t, share.Finalizers, shareFinalizer)
+	if evts := events(); assert.Len(t, evts, 1) {
+		assert.Contains(t, evts[0], ReasonDeletionBlocked)
+		assert.Contains(t, evts[0], "2 client connections")
+	}
+	cond := findCondition(share.Status.Conditions, "Degraded")
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, ReasonDeletionBlocked, cond.Reason)
+	}
+
+	// deletion can be forced
+	share.Annotations = map[string]string{forceDeleteAnnotation: "true"}
+	res = finalize()
+	assert.False(t, res.Requeue())
+	assert.Zero(t, res.RequeueAfter())
+	assert.NotContains(t, share.Finalizers, shareFinalizer)
+
+	// or proceeds once the clients are gone
+	share.Annotations = nil
+	share.Finalizers = []string{shareFinalizer}
+	share.Status.Conditions = nil
+	m, recorder = newTestManager(share, pod)
+	_, _, err = getOrCreateConfigMap(ctx, m.client, "default")
+	assert.NoError(t, err)
+	m.SetConnectionCounter(conns)
+	res = finalize()
+	assert.Equal(t, deletionRecheckInterval, res.RequeueAfter())
+	conns.count["myshare-a"] = 0
+	res = finalize()
+	assert.Zero(t, res.RequeueAfter())
+	assert.NotContains(t, share.Finalizers, shareFinalizer)
+}
+
+func TestFinalizeRetainsPvc(t *testing.T) {
+	now := metav1.Now()
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Spec.Storage.Pvc.RetainPolicy = "Retain"
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Finalizers = []string{shareFinalizer}
+	share.DeletionTimestamp = &now
+	share.Status.ServerGroup = "myshare"
+	pvcKey := types.NamespacedName{Name: "myshare-pvc", Namespace: "default"}
+	m, _ := newTestManager(
+		share,
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+			Name:      pvcKey.Name,
+			Namespace: pvcKey.Namespace,
+		}},
+	)
+
+	res := m.Finalize(context.TODO(), share)
+	assert.NoError(t, res.Err())
+	assert.False(t, res.Requeue())
+	err := m.client.Get(
+		context.TODO(), pvcKey, &corev1.PersistentVolumeClaim{})
+	assert.NoError(t, err)
+}
+
+func TestValidateKeytab(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	security := &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode: "active-directory",
+			Kerberos: &sambaoperatorv1alpha1.SmbSecurityKerberosSpec{
+				KeytabSecret: "mykeytab",
+			},
+		},
+	}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share, SecurityConfig: security},
+		&smbcc.SambaContainerConfig{})
+
+	m, recorder := newTestManager(share)
+	valid, err := m.validateKeytab(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidKeytab)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "mykeytab", Namespace: "default"},
+		Data:       map[string][]byte{"keytab": []byte("x")},
+	}
+	m, recorder = newTestManager(share, secret)
+	valid, err = m.validateKeytab(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "krb5.keytab")
+
+	secret.Data = map[string][]byte{"krb5.keytab": []byte("x")}
+	m, _ = newTestManager(share, secret)
+	valid, err = m.validateKeytab(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestValidateKrb5Conf(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	security := &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode: "active-directory",
+			Kerberos: &sambaoperatorv1alpha1.SmbSecurityKerberosSpec{
+				Krb5ConfConfigMap: "mykrb5",
+			},
+		},
+	}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share, SecurityConfig: security},
+		&smbcc.SambaContainerConfig{})
+
+	m, recorder := newTestManager(share)
+	valid, err := m.validateKrb5Conf(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events,
+		"Kerberos ConfigMap mykrb5 not found in namespace default")
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "mykrb5", Namespace: "default"},
+		Data:       map[string]string{"krb5": "[libdefaults]"},
+	}
+	m, recorder = newTestManager(share, cm)
+	valid, err = m.validateKrb5Conf(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	event := <-recorder.Events
+	assert.Contains(t, event, ReasonInvalidKrb5Conf)
+	assert.Contains(t, event, "Kerberos ConfigMap mykrb5 has no krb5.conf key")
+
+	cm.Data = map[string]string{"krb5.conf": "[libdefaults]"}
+	m, _ = newTestManager(share, cm)
+	valid, err = m.validateKrb5Conf(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestValidateDNSUpdate(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	dns := &sambaoperatorv1alpha1.SmbSecurityDNSSpec{
+		Register:     "cluster-ip",
+		UpdateMethod: "tsig",
+	}
+	security := &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode:  "active-directory",
+			Realm: "EXAMPLE.COM",
+			DNS:   dns,
+		},
+	}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share, SecurityConfig: security},
+		&smbcc.SambaContainerConfig{})
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "mykey", Namespace: "default"},
+		Data:       map[string][]byte{"tsig.key": []byte("x")},
+	}
+	m, recorder := newTestManager(share, secret)
+	validate := func() bool {
+		valid, err := m.validateDNSUpdate(context.TODO(), planner, "default")
+		assert.NoError(t, err)
+		return valid
+	}
+
+	// tsig requires a key
+	assert.False(t, validate())
+	assert.Contains(t, <-recorder.Events, ReasonInvalidDNSUpdate)
+
+	dns.TSIGKey = &sambaoperatorv1alpha1.SmbSecurityDNSKeySpec{
+		Secret: "mykey",
+		Key:    "other.key",
+	}
+	assert.False(t, validate())
+	assert.Contains(t, <-recorder.Events, "other.key")
+
+	dns.TSIGKey.Key = ""
+	assert.True(t, validate())
+
+	// a key is only used by tsig
+	dns.UpdateMethod = "gss-tsig"
+	assert.False(t, validate())
+	assert.Contains(t, <-recorder.Events, "tsigKey")
+
+	dns.TSIGKey = nil
+	dns.Server = "not a server"
+	assert.False(t, validate())
+	assert.Contains(t, <-recorder.Events, "Invalid DNS server")
+
+	dns.Server = "fd00::53"
+	assert.True(t, validate())
+	dns.Server = "ns1.example.com"
+	assert.True(t, validate())
+}
+
+func TestCheckDNSRegistration(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	security := &sambaoperatorv1alpha1.SmbSecurityConfig{
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode:  "active-directory",
+			Realm: "EXAMPLE.COM",
+			DNS: &sambaoperatorv1alpha1.SmbSecurityDNSSpec{
+				Register: "cluster-ip",
+			},
+		},
+	}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share, SecurityConfig: security},
+		&smbcc.SambaContainerConfig{})
+	pod := func(name string, state corev1.ContainerState) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels: map[string]string{
+					svcSelectorKey: labelValue(planner.instanceName()),
+				},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: dnsRegisterContainerName,
+					LastTerminationState: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{
+							ExitCode: 1,
+							Message:  "update failed: REFUSED",
+						},
+					},
+					State: state,
+				}},
+			},
+		}
+	}
+	running := corev1.ContainerState{
+		Running: &corev1.ContainerStateRunning{},
+	}
+	waiting := corev1.ContainerState{
+		Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+	}
+	m, recorder := newTestManager(
+		share, pod("myshare-a", running), pod("myshare-b", waiting))
+
+	assert.NoError(t, m.checkDNSRegistration(context.TODO(), planner, "default"))
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonDNSRegistrationFailed)
+		assert.Contains(t, event, "Pod myshare-b")
+		assert.Contains(t, event, "update failed: REFUSED")
+	}
+}
+
+func TestValidateFileModes(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.CreateMask = "rw-rw-r--"
+	m, recorder := newTestManager(share)
+
+	valid, err := m.validateFileModes(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidFileMode)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, ReasonInvalidFileMode, cond.Reason)
+		assert.Contains(t, cond.Message, "create mask")
+	}
+
+	share.Spec.CreateMask = "664"
+	valid, err = m.validateFileModes(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestValidateACLs(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.ACLs = &sambaoperatorv1alpha1.SmbShareACLSpec{
+		Mode:           "posix",
+		WindowsEditing: true,
+	}
+	m, recorder := newTestManager(share)
+
+	valid, err := m.validateACLs(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidACLs)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, ReasonInvalidACLs, cond.Reason)
+		assert.Contains(t, cond.Message, "windowsEditing")
+	}
+
+	share.Spec.ACLs.Mode = "windows"
+	valid, err = m.validateACLs(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestValidateDosAttributes(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	archive := true
+	share.Spec.DosAttributeMapping = &sambaoperatorv1alpha1.SmbShareDosAttributeMappingSpec{
+		Archive:  &archive,
+		ReadOnly: "yes",
+	}
+	m, recorder := newTestManager(share)
+
+	// samba stores DOS attributes by default
+	valid, err := m.validateDosAttributes(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidDosAttributes)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, ReasonInvalidDosAttributes, cond.Reason)
+		assert.Contains(t, cond.Message, "archive, readOnly")
+	}
+
+	store := true
+	share.Spec.StoreDosAttributes = &store
+	valid, err = m.validateDosAttributes(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+
+	store = false
+	valid, err = m.validateDosAttributes(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	// attributes that are not mapped are always allowed
+	store = true
+	archive = false
+	share.Spec.DosAttributeMapping.ReadOnly = "no"
+	valid, err = m.validateDosAttributes(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestCheckXattrSupport(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.ACLs = &sambaoperatorv1alpha1.SmbShareACLSpec{Mode: "windows"}
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: pvcName(share), Namespace: "default"},
+		Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv1"},
+	}
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv1"},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				NFS: &corev1.NFSVolumeSource{Server: "nfs1", Path: "/export"},
+			},
+		},
+	}
+	m, recorder := newTestManager(share, pvc, pv)
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		&smbcc.SambaContainerConfig{})
+
+	assert.NoError(t, m.checkXattrSupport(context.TODO(), planner, "default"))
+	if assert.Len(t, recorder.Events, 1) {
+		ev := <-recorder.Events
+		assert.Contains(t, ev, ReasonXattrsUnsupported)
+		assert.Contains(t, ev, "NFS")
+	}
+
+	// posix ACLs do not need extended attributes
+	share.Spec.ACLs.Mode = "posix"
+	assert.NoError(t, m.checkXattrSupport(context.TODO(), planner, "default"))
+	assert.Len(t, recorder.Events, 0)
+
+	// DOS attributes do when requested
+	store := true
+	share.Spec.StoreDosAttributes = &store
+	assert.NoError(t, m.checkXattrSupport(context.TODO(), planner, "default"))
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events,
+			"DOS attributes require extended attributes which NFS volume pv1 may not support")
+	}
+}
+
+func TestCheckPriorityClass(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{
+		Spec: sambaoperatorv1alpha1.SmbCommonConfigSpec{
+			PodSettings: &sambaoperatorv1alpha1.SmbCommonPodSettings{
+				PriorityClassName: "file-servers",
+			},
+		},
+	}
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share, CommonConfig: common},
+		&smbcc.SambaContainerConfig{})
+
+	m, recorder := newTestManager(share)
+	assert.NoError(t, m.checkPriorityClass(context.TODO(), planner))
+	if assert.Len(t, recorder.Events, 1) {
+		ev := <-recorder.Events
+		assert.Contains(t, ev, ReasonMissingPriorityClass)
+		assert.Contains(t, ev, "file-servers")
+	}
+
+	m, recorder = newTestManager(share, &schedulingv1.PriorityClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "file-servers"},
+		Value:      1000000,
+	})
+	assert.NoError(t, m.checkPriorityClass(context.TODO(), planner))
+	assert.Len(t, recorder.Events, 0)
+}
+
+func groupShare(name, group string) *sambaoperatorv1alpha1.SmbShare {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = name
+	share.Namespace = "default"
+	share.UID = types.UID(name + "-uid")
+	share.Spec.ServerGroup = group
+	share.Status.ServerGroup = group
+	return share
+}
+
+func TestValidateServerGroup(t *testing.T) {
+	one := groupShare("one", "grp")
+	two := groupShare("two", "grp")
+	other := groupShare("other", "other")
+	other.Spec.ShareName = "one"
+	m, recorder := newTestManager(one, two, other)
+
+	members, err := m.groupMembers(context.TODO(), one)
+	assert.NoError(t, err)
+	if assert.Len(t, members, 2) {
+		assert.Equal(t, "one", members[0].Name)
+		assert.Equal(t, "two", members[1].Name)
+	}
+	valid, err := m.validateServerGroup(context.TODO(), one)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	two.Spec.ShareName = "one"
+	assert.NoError(t, m.client.Update(context.TODO(), two))
+	valid, err = m.validateServerGroup(context.TODO(), one)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "conflicting share name")
+
+	port := int32(4450)
+	two.Spec.ShareName = ""
+	two.Spec.Port = &port
+	assert.NoError(t, m.client.Update(context.TODO(), two))
+	valid, err = m.validateServerGroup(context.TODO(), one)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "conflicting port")
+
+	two.Spec.Port = nil
+	two.Spec.Interfaces = []string{"net1"}
+	assert.NoError(t, m.client.Update(context.TODO(), two))
+	valid, err = m.validateServerGroup(context.TODO(), one)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "conflicting interfaces")
+
+	// only one guest account can be set for the group
+	two.Spec.Interfaces = nil
+	two.Spec.GuestAccount = "guests"
+	assert.NoError(t, m.client.Update(context.TODO(), two))
+	valid, err = m.validateServerGroup(context.TODO(), one)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	one.Spec.GuestAccount = "dropper"
+	valid, err = m.validateServerGroup(context.TODO(), one)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "conflicting guestAccount")
+	one.Spec.GuestAccount = ""
+
+	one.Spec.ServerGroup = "moved"
+	valid, err = m.validateServerGroup(context.TODO(), one)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "can not be changed")
+}
+
+func TestFinalizeGroupMember(t *testing.T) {
+	now := metav1.Now()
+	one := groupShare("one", "grp")
+	one.Finalizers = []string{shareFinalizer}
+	one.DeletionTimestamp = &now
+	two := groupShare("two", "grp")
+	m, _ := newTestManager(one, two)
+	ctx := context.TODO()
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "grp", Namespace: "default"},
+	}
+	assert.NoError(t,
+		controllerutil.SetControllerReference(one, deployment, m.scheme))
+	assert.NoError(t, m.client.Create(ctx, deployment))
+	assert.NoError(t, m.client.Create(ctx, &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "one-pvc", Namespace: "default"},
+	}))
+
+	var res Result
+	for i := 0; i < 5; i++ {
+		res = m.Finalize(ctx, one)
+		assert.NoError(t, res.Err())
+		if !res.Requeue() {
+			break
+		}
+	}
+	assert.False(t, res.Requeue())
+	assert.NotContains(t, one.Finalizers, shareFinalizer)
+
+	nsname := types.NamespacedName{Name: "grp", Namespace: "default"}
+	found := &appsv1.Deployment{}
+	if assert.NoError(t, m.client.Get(ctx, nsname, found)) {
+		owner := metav1.GetControllerOf(found)
+		if assert.NotNil(t, owner) {
+			assert.Equal(t, two.UID, owner.UID)
+		}
+	}
+	nsname.Name = "one-pvc"
+	err := m.client.Get(ctx, nsname, &corev1.PersistentVolumeClaim{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+// serialClient serializes the writes of a client. The fake client checks
+// the resource version of an updated object, then stores it, without a
+// lock: concurrent updates of the same version could all succeed, rather
+// than conflict as with an API server.
+type serialClient struct {
+	rtclient.Client
+	mu sync.Mutex
+}
+
+func (c *serialClient) Create(
+	ctx context.Context, obj runtime.Object, opts ...rtclient.CreateOption) error {
+	// ---
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *serialClient) Update(
+	ctx context.Context, obj runtime.Object, opts ...rtclient.UpdateOption) error {
+	// ---
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *serialClient) Patch(
+	ctx context.Context,
+	obj runtime.Object,
+	patch rtclient.Patch,
+	opts ...rtclient.PatchOption) error {
+	// ---
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestConcurrentProcess(t *testing.T) {
+	objs := []runtime.Object{}
+	shares := []*sambaoperatorv1alpha1.SmbShare{}
+	for i := 0; i < 24; i++ {
+		name := fmt.Sprintf("share%d", i)
+		group := ""
+		if i < 12 {
+			// four groups of three shares
+			group = fmt.Sprintf("grp%d", i%4)
+		}
+		share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+		share.Name = name
+		share.Namespace = "default"
+		share.UID = types.UID(name + "-uid")
+		share.Spec.ServerGroup = group
+		objs = append(objs, share)
+		shares = append(shares, share)
+	}
+	m, _ := newTestManager(objs...)
+	m.recorder = record.NewFakeRecorder(1000)
+	m.client = &serialClient{Client: m.client}
+
+	var wg sync.WaitGroup
+	results := make(chan Result, len(shares))
+	for _, share := range shares {
+		wg.Add(1)
+		go func(key types.NamespacedName) {
+			defer wg.Done()
+			var res Result
+			for i := 0; i < 100; i++ {
+				res = m.Process(context.TODO(), key)
+				if res.Err() != nil || !res.Requeue() {
+					break
+				}
+			}
+			results <- res
+		}(types.NamespacedName{Namespace: "default", Name: share.Name})
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("shares were not reconciled in time")
+	}
+	close(results)
+	for res := range results {
+		assert.NoError(t, res.Err())
+		assert.False(t, res.Requeue())
+	}
+
+	cm, err := getConfigMap(context.TODO(), m.client, "default")
+	if !assert.NoError(t, err) {
+		return
+	}
+	cc, err := getContainerConfig(cm)
+	assert.NoError(t, err)
+	assert.Len(t, cc.Shares, 24)
+	assert.Len(t, cc.Configs, 16)
+	for i := 0; i < 4; i++ {
+		assert.Len(t, cc.Configs[smbcc.Key(fmt.Sprintf("grp%d", i))].Shares, 3)
+	}
+	deployments := &appsv1.DeploymentList{}
+	assert.NoError(t, m.client.List(context.TODO(), deployments))
+	assert.Len(t, deployments.Items, 16)
+}
+
+func TestValidateExtraMounts(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{}
+	planner := testPlanner(share, common)
+	settings := common.Spec.PodSettings
+
+	m, _ := newTestManager(share)
+	m.cfg.SmbdContainerName = "samba"
+	valid, err := m.validateExtraMounts(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	settings.ExtraMounts = []sambaoperatorv1alpha1.SmbExtraMount{
+		{Name: "scripts", MountPath: "/opt/scripts", ConfigMap: "scripts"},
+		{Name: "tuning", MountPath: "/etc/tuning", Secret: "tuning"},
+	}
+	valid, err = m.validateExtraMounts(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	// a mount within a mount of the operator
+	settings.ExtraMounts[1].MountPath = "/etc/container-config/tuning"
+	m, recorder := newTestManager(share)
+	m.cfg.SmbdContainerName = "samba"
+	valid, err = m.validateExtraMounts(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	event := <-recorder.Events
+	assert.Contains(t, event, ReasonInvalidExtraMount)
+	assert.Contains(t, event, "/etc/container-config/tuning")
+
+	// two extra mounts on the same path
+	settings.ExtraMounts[1].MountPath = "/opt/scripts/"
+	m, recorder = newTestManager(share)
+	valid, err = m.validateExtraMounts(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidExtraMount)
+
+	// a ConfigMap and a Secret
+	settings.ExtraMounts[1].MountPath = "/etc/tuning"
+	settings.ExtraMounts[1].ConfigMap = "tuning"
+	m, recorder = newTestManager(share)
+	valid, err = m.validateExtraMounts(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "exactly one")
+
+	// more than one include
+	settings.ExtraMounts[1].ConfigMap = ""
+	settings.ExtraMounts[0].Include = "a.conf"
+	settings.ExtraMounts[1].Include = "b.conf"
+	m, recorder = newTestManager(share)
+	valid, err = m.validateExtraMounts(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "Only one")
+}
+
+func TestPathsOverlap(t *testing.T) {
+	assert.True(t, pathsOverlap("/etc/a", "/etc/a/"))
+	assert.True(t, pathsOverlap("/etc/a", "/etc/a/b"))
+	assert.True(t, pathsOverlap("/etc/a/b", "/etc/a"))
+	assert.True(t, pathsOverlap("/", "/etc"))
+	assert.False(t, pathsOverlap("/etc/a", "/etc/ab"))
+	assert.False(t, pathsOverlap("/etc/a", "/etc/b"))
+}
+
+func TestValidateGuestAccess(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	m, _ := newTestManager(share)
+	valid, err := m.validateGuestAccess(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share.Spec.GuestAccess = "dropbox"
+	valid, err = m.validateGuestAccess(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share.Spec.ReadOnly = true
+	m, recorder := newTestManager(share)
+	valid, err = m.validateGuestAccess(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidGuestAccess)
+
+	share.Spec.ReadOnly = false
+	share.Spec.CreateMask = "0644"
+	m, recorder = newTestManager(share)
+	valid, err = m.validateGuestAccess(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "createMask")
+
+	// guests are not supported with active directory
+	share.Spec.CreateMask = ""
+	share.Spec.GuestAccess = "read"
+	share.Spec.SecurityConfig = "mysec"
+	security := &sambaoperatorv1alpha1.SmbSecurityConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysec", Namespace: "default"},
+		Spec: sambaoperatorv1alpha1.SmbSecurityConfigSpec{
+			Mode:  "active-directory",
+			Realm: "EXAMPLE.COM",
+		},
+	}
+	m, recorder = newTestManager(share, security)
+	valid, err = m.validateGuestAccess(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "user mode")
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, ReasonInvalidGuestAccess, cond.Reason)
+	}
+
+	security.Spec.Mode = "user"
+	m, _ = newTestManager(share, security)
+	valid, err = m.validateGuestAccess(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share.Spec.GuestAccount = "nobody:x"
+	m, recorder = newTestManager(share, security)
+	valid, err = m.validateGuestAccess(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, `Invalid guest account: "nobody:x"`)
+
+	// a guest account requires guest access
+	share.Spec.GuestAccount = "guests"
+	share.Spec.GuestAccess = ""
+	m, recorder = newTestManager(share, security)
+	valid, err = m.validateGuestAccess(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "guestAccount requires guestAccess")
+}
+
+func TestValidateFilePatterns(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.VetoFiles = []string{"Thumbs.db", "*.tmp"}
+	m, _ := newTestManager(share)
+	valid, err := m.validateFilePatterns(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share.Spec.HideFiles = []string{"/etc/passwd"}
+	m, recorder := newTestManager(share)
+	valid, err = m.validateFilePatterns(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidFilePattern)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t,
+			`Invalid file name patterns: "/etc/passwd"`, cond.Message)
+	}
+}
+
+func TestValidateHosts(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.HostsAllow = []string{
+		"10.0.0.0/8", "192.168.1.20", "fd00::/64", "client1.example.com"}
+	share.Spec.HostsDeny = []string{"10.1.0.0/16", "printer"}
+	m, _ := newTestManager(share)
+	valid, err := m.validateHosts(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share.Spec.HostsDeny = []string{"10.1.0.0/33", "10.1.0.0/16", "bad host"}
+	m, recorder := newTestManager(share)
+	valid, err = m.validateHosts(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidHosts)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t,
+			`Invalid hosts: "10.1.0.0/33", "bad host"`, cond.Message)
+	}
+}
+
+func TestValidateSymlinks(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.WideLinks = true
+	m, _ := newTestManager(share)
+	valid, err := m.validateSymlinks(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	no := false
+	share.Spec.FollowSymlinks = &no
+	m, recorder := newTestManager(share)
+	valid, err = m.validateSymlinks(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidSymlinks)
+}
+
+func TestGetDefaultCommonConfig(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	common := func(name, ns string, isDefault bool) *sambaoperatorv1alpha1.SmbCommonConfig {
+		c := &sambaoperatorv1alpha1.SmbCommonConfig{}
+		c.Name = name
+		c.Namespace = ns
+		if isDefault {
+			c.Labels = map[string]string{DefaultCommonConfigLabelKey: "true"}
+		}
+		return c
+	}
+	ctx := context.TODO()
+
+	m, _ := newTestManager(share, common("plain", "default", false),
+		common("elsewhere", "other", true))
+	found, err := m.getCommonConfig(ctx, share)
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+
+	m, _ = newTestManager(share, common("plain", "default", false),
+		common("org", "default", true), common("zorg", "default", true))
+	found, err = m.getCommonConfig(ctx, share)
+	assert.NoError(t, err)
+	if assert.NotNil(t, found) {
+		assert.Equal(t, "org", found.Name)
+	}
+
+	// an explicit reference wins
+	share.Spec.CommonConfig = "plain"
+	found, err = m.getCommonConfig(ctx, share)
+	assert.NoError(t, err)
+	if assert.NotNil(t, found) {
+		assert.Equal(t, "plain", found.Name)
+	}
+}
+
+func TestValidateHandles(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.DurableHandles = true
+	planner := testPlanner(share, nil)
+	m, _ := newTestManager(share)
+	valid, err := m.validateHandles(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	check := func(msg string) {
+		t.Helper()
+		m, recorder := newTestManager(share)
+		valid, err := m.validateHandles(context.TODO(), planner)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonInvalidHandles)
+		assert.Contains(t, event, msg)
+	}
+	no, yes := false, true
+	share.Spec.KernelOplocks = &yes
+	check("durableHandles can not be used with kernelOplocks")
+	share.Spec.KernelOplocks = nil
+
+	// another share of the group turns leases off
+	other := sambaoperatorv1alpha1.SmbShare{}
+	other.Name = "other"
+	other.Spec.Leases = &no
+	planner.GroupShares = []sambaoperatorv1alpha1.SmbShare{*share, other}
+	check("durableHandles requires leases")
+	planner.GroupShares = nil
+
+	// persistent handles are gated on clustered shares
+	share.Spec.PersistentHandles = true
+	check("persistentHandles requires a clustered share")
+}
+
+func TestWarnWideLinks(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	planner := testPlanner(share, nil)
+	m, recorder := newTestManager(share)
+	m.warnWideLinks(planner)
+	assert.Empty(t, recorder.Events)
+
+	share.Spec.WideLinks = true
+	m.warnWideLinks(planner)
+	event := <-recorder.Events
+	assert.Contains(t, event, EventWarning)
+	assert.Contains(t, event, ReasonWideLinksEnabled)
+}
+
+func TestWarnMultiChannelSingleNetwork(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	m, recorder := newTestManager(share)
+	m.warnMultiChannelSingleNetwork(planner)
+	assert.Empty(t, recorder.Events)
+
+	common.Spec.Network.MultiChannel = true
+	m.warnMultiChannelSingleNetwork(planner)
+	event := <-recorder.Events
+	assert.Contains(t, event, EventWarning)
+	assert.Contains(t, event, ReasonMultiChannelSingleNetwork)
+
+	// pods attached to a secondary network have several interfaces
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		NetworkAttachments: []sambaoperatorv1alpha1.SmbNetworkAttachment{
+			{Name: "storage-macvlan"},
+		},
+	}
+	m.warnMultiChannelSingleNetwork(planner)
+	assert.Empty(t, recorder.Events)
+}
+
+func TestValidateMacOS(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.MacOS = &sambaoperatorv1alpha1.SmbShareMacOSSpec{
+		Fruit:     true,
+		Spotlight: true,
+	}
+	planner := testPlanner(share, nil)
+	m, recorder := newTestManager(share)
+	valid, err := m.validateMacOS(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Empty(t, recorder.Events)
+
+	// without an index, searches return nothing
+	m.warnSpotlightUnavailable(planner)
+	event := <-recorder.Events
+	assert.Contains(t, event, EventWarning)
+	assert.Contains(t, event, ReasonSpotlightUnavailable)
+	share.Spec.MacOS.Elasticsearch = &sambaoperatorv1alpha1.SmbSpotlightElasticsearch{
+		Address: "es.example.com",
+	}
+	m.warnSpotlightUnavailable(planner)
+	assert.Empty(t, recorder.Events)
+
+	share.Spec.MacOS.Fruit = false
+	valid, err = m.validateMacOS(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidMacOS)
+}
+
+func TestValidateForcedIDs(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	share.Spec.ForceUser = "alice"
+	share.Spec.ForceGroup = "staff"
+	planner := testPlanner(share, nil)
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{}
+	planner.SecurityConfig.Spec.Mode = string(userMode)
+	planner.SecurityConfig.Spec.Users = &sambaoperatorv1alpha1.SmbSecurityUsersSpec{
+		Secret: "users",
+		Key:    "demousers",
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "users", Namespace: "default"},
+		Data: map[string][]byte{
+			"demousers": []byte(`{"samba-container-config": "v0",
+				"users": {"all_entries": [{"name": "alice"}, {"name": "bob"}]},
+				"groups": {"all_entries": [{"name": "staff"}]}}`),
+		},
+	}
+	m, _ := newTestManager(share, secret)
+	valid, err := m.validateForcedIDs(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	// each user has a group of the same name
+	share.Spec.ForceGroup = "bob"
+	valid, err = m.validateForcedIDs(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share.Spec.ForceUser = "carol"
+	m, recorder := newTestManager(share, secret)
+	valid, err = m.validateForcedIDs(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidForcedID)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t,
+			"forceUser carol is not a user of users secret users", cond.Message)
+	}
+
+	// domain accounts are only checked for their syntax
+	share.Spec.ForceUser = `CHEM\carol`
+	m, recorder = newTestManager(share, secret)
+	valid, err = m.validateForcedIDs(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidForcedID)
+
+	planner.SecurityConfig.Spec.Mode = string(adMode)
+	m, _ = newTestManager(share)
+	valid, err = m.validateForcedIDs(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestValidateSharePath(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.Storage.Path = "a/b"
+	m, _ := newTestManager(share)
+	valid, err := m.validateSharePath(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share.Spec.Storage.Path = "../b"
+	m, recorder := newTestManager(share)
+	valid, err = m.validateSharePath(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidPath)
+
+	share.Spec.Storage.Path = "{{ .Namespace }}/{{ .Name }}"
+	m, recorder = newTestManager(share)
+	valid, err = m.validateSharePath(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+
+	check := func(p, msg string) {
+		t.Helper()
+		share.Spec.Storage.Path = p
+		m, recorder := newTestManager(share)
+		valid, err := m.validateSharePath(context.TODO(), share)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonInvalidPath)
+		assert.Contains(t, event, msg)
+	}
+	check("../{{ .Name }}",
+		`Invalid path "../myshare", rendered from "../{{ .Name }}",`)
+	check("{{ .Name }}/{{ .Owner }}", `Invalid path template "{{ .Name }}/{{ .Owner }}"`)
+	check("{{ .Name", `Invalid path template "{{ .Name"`)
+}
+
+func TestValidateAuthentication(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := testPlanner(share, nil)
+	m, recorder := newTestManager(share)
+	valid, err := m.validateAuthentication(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{}
+	planner.SecurityConfig.Spec.Mode = "user"
+	planner.SecurityConfig.Spec.Authentication = &sambaoperatorv1alpha1.SmbSecurityAuthenticationSpec{
+		NTLMAuth: "ntlmv1-permitted",
+	}
+	valid, err = m.validateAuthentication(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	// users of user mode can not log in with kerberos
+	planner.SecurityConfig.Spec.Authentication.NTLMAuth = "disabled"
+	valid, err = m.validateAuthentication(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidAuthentication)
+
+	planner.SecurityConfig.Spec.Mode = "active-directory"
+	planner.SecurityConfig.Spec.Realm = "EXAMPLE.COM"
+	valid, err = m.validateAuthentication(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	planner.SecurityConfig.Spec.Authentication.NTLMAuth = ""
+	planner.SecurityConfig.Spec.Authentication.LanmanAuth = true
+	valid, err = m.validateAuthentication(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "lanmanAuth")
+	cond := findCondition(share.Status.Conditions, "Degraded")
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, ReasonInvalidAuthentication, cond.Reason)
+	}
+}
+
+func TestValidateInterfaces(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := testPlanner(share, nil)
+	m, recorder := newTestManager(share)
+	valid, err := m.validateInterfaces(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share.Spec.Interfaces = []string{
+		"net1", "eth0.100", "10.1.0.0/16", "192.0.2.10", "fd00::/64",
+	}
+	valid, err = m.validateInterfaces(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	for _, iface := range []string{
+		"", "net 1", "10.1.0.0/33", "averylonginterfacename", "a,b",
+	} {
+		share.Spec.Interfaces = []string{"net1", iface}
+		valid, err = m.validateInterfaces(context.TODO(), planner)
+		assert.NoError(t, err)
+		assert.False(t, valid, iface)
+		assert.Contains(t, <-recorder.Events, ReasonInvalidInterfaces)
+	}
+}
+
+func TestValidateServerIdentity(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.ServerString = "Accounting files"
+	common.Spec.NetbiosName = "ACCOUNTING-01"
+	common.Spec.Workgroup = "FINANCE"
+	planner := testPlanner(share, common)
+	m, recorder := newTestManager(share)
+	valid, err := m.validateServerIdentity(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	for _, name := range []string{"accounting", "A-VERY-LONG-NAME-1", "-ACCOUNTING", "ACC.FILES"} {
+		common.Spec.NetbiosName = name
+		valid, err = m.validateServerIdentity(context.TODO(), planner)
+		assert.NoError(t, err)
+		assert.False(t, valid, name)
+		assert.Contains(t, <-recorder.Events, "Invalid NetBIOS name")
+	}
+	common.Spec.NetbiosName = ""
+
+	common.Spec.ServerString = "Accounting\nfiles"
+	valid, err = m.validateServerIdentity(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidServerIdentity)
+	common.Spec.ServerString = ""
+
+	// domain members may only repeat the workgroup of their realm
+	planner.SecurityConfig = &sambaoperatorv1alpha1.SmbSecurityConfig{}
+	planner.SecurityConfig.Spec.Mode = string(adMode)
+	planner.SecurityConfig.Spec.Realm = "finance.example.com"
+	common.Spec.Workgroup = "finance"
+	valid, err = m.validateServerIdentity(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	common.Spec.Workgroup = "SALES"
+	valid, err = m.validateServerIdentity(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events,
+		"Workgroup SALES conflicts with the workgroup FINANCE of realm FINANCE.EXAMPLE.COM")
+}
+
+func TestValidatePerformance(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	m, recorder := newTestManager(share)
+	check := func(msg string) {
+		t.Helper()
+		valid, err := m.validatePerformance(context.TODO(), planner)
+		assert.NoError(t, err)
+		if msg == "" {
+			assert.True(t, valid)
+			assert.Len(t, recorder.Events, 0)
+			return
+		}
+		assert.False(t, valid)
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonInvalidPerformance)
+		assert.Contains(t, event, msg)
+	}
+	check("")
+
+	size := int64(128 * 1024)
+	common.Spec.Performance = &sambaoperatorv1alpha1.SmbPerformanceSpec{
+		MinReceivefileSize: &size,
+		AioWriteBehind:     []string{"*.tmp", "~$*"},
+	}
+	check("")
+	size = 16 * mebibyte
+	check("minReceivefileSize 16777216 is larger than the largest write of 8388608 bytes")
+	maxWrite := int64(16 * mebibyte)
+	common.Spec.Performance.SMB2MaxWrite = &maxWrite
+	check("")
+
+	common.Spec.Performance.AioWriteBehind = []string{"*.tmp", "logs/*.log", ""}
+	check(`Invalid aio write behind patterns: "logs/*.log", ""`)
+}
+
+func TestValidateCustomConfig(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	m, recorder := newTestManager(share)
+	valid, err := m.validateCustomConfig(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	common.Spec.CustomConfig = &sambaoperatorv1alpha1.SmbCustomConfig{
+		ConfigMap: "my-smb-conf",
+	}
+	valid, err = m.validateCustomConfig(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "ConfigMap my-smb-conf not found")
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-smb-conf", Namespace: "default"},
+		Data:       map[string]string{"other.conf": "[global]\n"},
+	}
+	m, recorder = newTestManager(share, cm)
+	valid, err = m.validateCustomConfig(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, "has no smb.conf key")
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, ReasonInvalidCustomConfig, cond.Reason)
+	}
+
+	common.Spec.CustomConfig.Key = "other.conf"
+	valid, err = m.validateCustomConfig(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	// the custom smb.conf replaces any included file
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{
+		ExtraMounts: []sambaoperatorv1alpha1.SmbExtraMount{{
+			Name:      "conf",
+			MountPath: "/etc/extra",
+			ConfigMap: "extra",
+			Include:   "extra.conf",
+		}},
+	}
+	valid, err = m.validateCustomConfig(context.TODO(), planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	assert.Contains(t, <-recorder.Events, ReasonInvalidCustomConfig)
+}
+
+func TestSuspendShare(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Status.ServerGroup = "myshare"
+	planner := testPlanner(share, nil)
+	m, recorder := newTestManager(share)
+	ctx := context.TODO()
+	_, created, err := m.getOrCreatePvc(ctx, share, "default")
+	assert.NoError(t, err)
+	assert.True(t, created)
+	dep, created, err := m.getOrCreateDeployment(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, int32(1), *dep.Spec.Replicas)
+
+	// shares that were never suspended have no condition
+	changed, err := m.updateSuspendedStatus(ctx, planner)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Nil(t, findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionSuspended))
+
+	// suspending the share scales its pods to zero
+	share.Spec.Suspended = true
+	changed, err = m.updateDeploymentSize(ctx, planner, dep)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	found := &appsv1.Deployment{}
+	assert.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: dep.Name}, found))
+	assert.Equal(t, int32(0), *found.Spec.Replicas)
+	changed, err = m.updateSuspendedStatus(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonSuspended)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionSuspended)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, corev1.ConditionTrue, cond.Status)
+	}
+
+	// nothing changes while the share stays suspended
+	changed, err = m.updateDeploymentSize(ctx, planner, found)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	changed, err = m.updateSuspendedStatus(ctx, planner)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// the volume is kept
+	pvc := &corev1.PersistentVolumeClaim{}
+	assert.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: pvcName(share)}, pvc))
+
+	// resuming restores the pods
+	share.Spec.Suspended = false
+	changed, err = m.updateDeploymentSize(ctx, planner, found)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, int32(1), *found.Spec.Replicas)
+	changed, err = m.updateSuspendedStatus(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonResumed)
+	assert.Equal(t, corev1.ConditionFalse, findCondition(
+		share.Status.Conditions,
+		sambaoperatorv1alpha1.ConditionSuspended).Status)
+}
+
+func TestUpdateInvalidShareCreatesNothing(t *testing.T) {
+	ctx := context.TODO()
+	check := func(
+		share *sambaoperatorv1alpha1.SmbShare,
+		reason string,
+		objs ...runtime.Object) {
+		// ---
+		t.Helper()
+		share.Name = "myshare"
+		share.Namespace = "default"
+		m, _ := newTestManager(append(objs, share)...)
+		result := Requeue
+		for i := 0; i < 10 && result.Requeue(); i++ {
+			result = m.Update(ctx, share)
+			require.NoError(t, result.Err())
+		}
+		assert.False(t, result.Requeue())
+		cond := findCondition(
+			share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+		if assert.NotNil(t, cond) {
+			assert.Equal(t, corev1.ConditionTrue, cond.Status)
+			assert.Equal(t, reason, cond.Reason)
+		}
+
+		configMaps := &corev1.ConfigMapList{}
+		require.NoError(t, m.client.List(ctx, configMaps))
+		assert.Len(t, configMaps.Items, 0)
+		pvcs := &corev1.PersistentVolumeClaimList{}
+		require.NoError(t, m.client.List(ctx, pvcs))
+		assert.Len(t, pvcs.Items, 0)
+		secrets := &corev1.SecretList{}
+		require.NoError(t, m.client.List(ctx, secrets))
+		for _, secret := range secrets.Items {
+			assert.NotContains(t, secret.Labels, "app.kubernetes.io/managed-by")
+		}
+		deployments := &appsv1.DeploymentList{}
+		require.NoError(t, m.client.List(ctx, deployments))
+		assert.Len(t, deployments.Items, 0)
+		services := &corev1.ServiceList{}
+		require.NoError(t, m.client.List(ctx, services))
+		assert.Len(t, services.Items, 0)
+	}
+
+	// the storage class of the PVC does not exist
+	check(
+		pvcShare("missing", &corev1.PersistentVolumeClaimSpec{}),
+		ReasonInvalidStorageClass)
+
+	// a DFS link refers to an invalid target
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Spec.MSDFS = &sambaoperatorv1alpha1.SmbShareMSDFSSpec{
+		Links: []sambaoperatorv1alpha1.SmbShareMSDFSLinkSpec{{
+			Name:    "archive",
+			Targets: []string{"archive"},
+		}},
+	}
+	check(share, ReasonInvalidMSDFS)
+
+	// an SmbUser of the security config has no password
+	sec := &sambaoperatorv1alpha1.SmbSecurityConfig{}
+	sec.Name = "mysec"
+	sec.Namespace = "default"
+	sec.Spec.Mode = string(userMode)
+	sec.Spec.Users = &sambaoperatorv1alpha1.SmbSecurityUsersSpec{}
+	share = pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Spec.SecurityConfig = "mysec"
+	check(share, ReasonInvalidSmbUser, sec, testSmbUser("alice", "missing"))
+}
+
+func TestValidateReadOnlyMount(t *testing.T) {
+	share := pvcShare("", nil)
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.Storage.Pvc.ReadOnlyMount = true
+	share.Spec.Storage.Path = "data"
+	share.Spec.AccessControl = &sambaoperatorv1alpha1.SmbShareAccessControl{
+		ValidUsers: []string{"alice"},
+	}
+	m, _ := newTestManager(share)
+	valid, err := m.validateReadOnlyMount(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share.Spec.GuestAccess = guestDropBox
+	share.Spec.AccessControl.WriteList = []string{"alice"}
+	share.Spec.Storage.InitPermissions = &sambaoperatorv1alpha1.SmbShareInitPermissionsSpec{}
+	share.Spec.UnicodeNormalization = normalizationNFC
+	m, recorder := newTestManager(share)
+	valid, err = m.validateReadOnlyMount(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	event := <-recorder.Events
+	assert.Contains(t, event, ReasonInvalidReadOnlyMount)
+	assert.Contains(t, event,
+		"readOnlyMount can not be used with guestAccess dropBox, "+
+			"accessControl writeList, storage initPermissions, "+
+			"unicodeNormalization")
+}
+
+func TestValidateSync(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.SyncAlways = true
+	m, _ := newTestManager(share)
+	valid, err := m.validateSync(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	check := func(msg string) {
+		t.Helper()
+		m, recorder := newTestManager(share)
+		valid, err := m.validateSync(context.TODO(), share)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonInvalidSync)
+		assert.Contains(t, event, msg)
+	}
+	no := false
+	share.Spec.StrictSync = &no
+	check("syncAlways requires strictSync")
+	share.Spec.StrictSync = nil
+
+	share.Spec.ReadOnly = true
+	check("syncAlways can not be used on a read-only share")
+	// the users of the write list may write to the share
+	share.Spec.AccessControl = &sambaoperatorv1alpha1.SmbShareAccessControl{
+		WriteList: []string{"alice"},
+	}
+	valid, err = m.validateSync(context.TODO(), share)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{
+		ReadOnlyMount: true,
+	}
+	check("syncAlways can not be used on a read-only share")
+}
+
+func TestResyncCorrectsDrift(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.UID = "myshare-uid"
+	m, _ := newTestManager(share)
+	m.recorder = record.NewFakeRecorder(100)
+	ctx := context.TODO()
+	key := types.NamespacedName{Namespace: "default", Name: "myshare"}
+	processShare(t, m, key)
+
+	getService := func() *corev1.Service {
+		svc := &corev1.Service{}
+		require.NoError(t, m.client.Get(ctx, key, svc))
+		return svc
+	}
+	svc := getService()
+	selector := svc.Spec.Selector
+	require.NotEmpty(t, selector)
+
+	// without resyncs, nothing is reconciled again
+	res := m.Process(ctx, key)
+	require.NoError(t, res.Err())
+	assert.False(t, res.Requeue())
+	assert.Zero(t, res.RequeueAfter())
+
+	// the share is reconciled after the resync interval
+	m.cfg.ResyncInterval = 10 * time.Minute
+	res = m.Process(ctx, key)
+	require.NoError(t, res.Err())
+	assert.Equal(t, 10*time.Minute, res.RequeueAfter())
+
+	// changing the Service out of band is corrected by the next resync,
+	// leaving the changes to fields the operator does not manage
+	svc.Spec.Selector = map[string]string{"app": "elsewhere"}
+	svc.Annotations = map[string]string{"example.com/owner": "ops"}
+	require.NoError(t, m.client.Update(ctx, svc))
+	res = m.Process(ctx, key)
+	require.NoError(t, res.Err())
+	svc = getService()
+	assert.Equal(t, selector, svc.Spec.Selector)
+	assert.Equal(t, "ops", svc.Annotations["example.com/owner"])
+}
+
+func TestResyncPausedShare(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Annotations = map[string]string{pausedAnnotation: "true"}
+	m, _ := newTestManager(share)
+	m.cfg.ResyncInterval = 10 * time.Minute
+	ctx := context.TODO()
+	key := types.NamespacedName{Namespace: "default", Name: "myshare"}
+
+	// paused shares are left alone until resumed, resyncs included
+	for i := 0; i < 2; i++ {
+		result := m.Process(ctx, key)
+		require.NoError(t, result.Err())
+		assert.False(t, result.Requeue())
+		assert.Zero(t, result.RequeueAfter())
+	}
+}
+
+func TestResyncDegradedShare(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Name = "myshare"
+	share.Namespace = "default"
+	share.Spec.Storage.Path = "../escape"
+	m, _ := newTestManager(share)
+	ctx := context.TODO()
+	key := types.NamespacedName{Namespace: "default", Name: "myshare"}
+
+	result := Requeue
+	for i := 0; i < 10 && result.Requeue(); i++ {
+		result = m.Process(ctx, key)
+		require.NoError(t, result.Err())
+	}
+	assert.False(t, result.Requeue())
+	assert.Zero(t, result.RequeueAfter())
+
+	// degraded shares are reconciled after the resync interval too
+	m.cfg.ResyncInterval = 10 * time.Minute
+	result = m.Process(ctx, key)
+	require.NoError(t, result.Err())
+	assert.Equal(t, 10*time.Minute, result.RequeueAfter())
+	require.NoError(t, m.client.Get(ctx, key, share))
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, corev1.ConditionTrue, cond.Status)
+		assert.Equal(t, ReasonInvalidPath, cond.Reason)
+	}
+}
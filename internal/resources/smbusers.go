@@ -0,0 +1,340 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// smbUsersSecretKey is the key of the users config in the Secret generated
+// from the SmbUsers of a security config.
+const smbUsersSecretKey = "users.json"
+
+// smbUsersSecretName returns the name of the Secret holding the users
+// config generated from the SmbUsers of the security config.
+func smbUsersSecretName(sc *sambaoperatorv1alpha1.SmbSecurityConfig) string {
+	return sc.Name + "-smbusers"
+}
+
+// smbUserName returns the name the SmbUser logs in with.
+func smbUserName(u *sambaoperatorv1alpha1.SmbUser) string {
+	if u.Spec.Username != "" {
+		return u.Spec.Username
+	}
+	return u.Name
+}
+
+// smbUserPasswordKey returns the key of the Secret holding the password of
+// the SmbUser.
+func smbUserPasswordKey(u *sambaoperatorv1alpha1.SmbUser) string {
+	if u.Spec.Password.Key != "" {
+		return u.Spec.Password.Key
+	}
+	return "password"
+}
+
+// usesSmbUsers returns true if the users of the share are defined by the
+// SmbUsers referring to its security config, rather than by a users
+// secret or CSI volume.
+func (sp *sharePlanner) usesSmbUsers() bool {
+	return sp.securityMode() == userMode && sp.SecurityConfig != nil &&
+		sp.SecurityConfig.Spec.Users != nil &&
+		sp.SecurityConfig.Spec.Users.Secret == "" &&
+		sp.SecurityConfig.Spec.Users.CSISecretVolume == nil
+}
+
+// listSmbUsers returns the SmbUsers of the share's security config, sorted
+// by user name. SmbUsers being deleted are ignored.
+func (m *SmbShareManager) listSmbUsers(
+	ctx context.Context, planner *sharePlanner) (
+	[]sambaoperatorv1alpha1.SmbUser, error) {
+	// ---
+	sc := planner.SecurityConfig
+	l := &sambaoperatorv1alpha1.SmbUserList{}
+	err := m.client.List(ctx, l, rtclient.InNamespace(sc.Namespace))
+	if err != nil {
+		m.logger.Error(err, "Failed to list SmbUsers", "namespace", sc.Namespace)
+		return nil, err
+	}
+	users := []sambaoperatorv1alpha1.SmbUser{}
+	for _, u := range l.Items {
+		if u.Spec.SecurityConfig == sc.Name && u.DeletionTimestamp == nil {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return smbUserName(&users[i]) < smbUserName(&users[j])
+	})
+	return users, nil
+}
+
+// smbUserPassword returns the password of the SmbUser, or an empty string
+// if its Secret, or the key of the Secret, is missing.
+func (m *SmbShareManager) smbUserPassword(
+	ctx context.Context, u *sambaoperatorv1alpha1.SmbUser) (string, error) {
+	// ---
+	secret := &corev1.Secret{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{Name: u.Spec.Password.Secret, Namespace: u.Namespace},
+		secret)
+	if errors.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get password secret",
+			"Secret.Namespace", u.Namespace, "Secret.Name", u.Spec.Password.Secret)
+		return "", err
+	}
+	return string(secret.Data[smbUserPasswordKey(u)]), nil
+}
+
+// validateSmbUsers checks that the SmbUsers of the share's security config
+// have valid and unique user names, a password and are members of local
+// groups of the security config only. If not, the Degraded condition is set
+// on the SmbShare and false is returned.
+func (m *SmbShareManager) validateSmbUsers(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	if !planner.usesSmbUsers() {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidSmbUser, msg)
+	}
+	users, err := m.listSmbUsers(ctx, planner)
+	if err != nil {
+		return false, err
+	}
+	groups := map[string]bool{}
+	for _, g := range planner.localGroups() {
+		groups[g.Name] = true
+	}
+	seen := map[string]string{}
+	for i := range users {
+		u := &users[i]
+		name := smbUserName(u)
+		if !validAccountName(name, userMode) {
+			return degraded(fmt.Sprintf(
+				"Invalid user name of SmbUser %s: %q", u.Name, name))
+		}
+		if other, found := seen[name]; found {
+			return degraded(fmt.Sprintf(
+				"SmbUsers %s and %s have the same user name %s",
+				other, u.Name, name))
+		}
+		seen[name] = u.Name
+		for _, g := range u.Spec.Groups {
+			if !groups[g] {
+				return degraded(fmt.Sprintf(
+					"Group %s of SmbUser %s is not a local group of security config %s",
+					g, u.Name, planner.SecurityConfig.Name))
+			}
+		}
+		password, err := m.smbUserPassword(ctx, u)
+		if err != nil {
+			return false, err
+		}
+		if password == "" {
+			return degraded(fmt.Sprintf(
+				"SmbUser %s has no password in key %s of Secret %s",
+				u.Name, smbUserPasswordKey(u), u.Spec.Password.Secret))
+		}
+	}
+	return true, nil
+}
+
+// smbUsersConfig returns the users config of the SmbUsers, with their
+// passwords, and of the local groups of the planner's security config. The
+// members of a local group are those listed by the group and the SmbUsers
+// listing the group.
+func smbUsersConfig(
+	planner *sharePlanner,
+	users []sambaoperatorv1alpha1.SmbUser,
+	passwords map[string]string) *smbcc.SambaContainerConfig {
+	// ---
+	cc := &smbcc.SambaContainerConfig{
+		SCCVersion: smbcc.New().SCCVersion,
+		Users:      map[smbcc.Key]smbcc.UserEntries{},
+	}
+	entries := smbcc.UserEntries{}
+	members := map[string][]string{}
+	for i := range users {
+		u := &users[i]
+		name := smbUserName(u)
+		entries = append(entries, smbcc.UserEntry{
+			Name:     name,
+			Uid:      uint(u.Spec.UID),
+			Gid:      uint(u.Spec.GID),
+			Password: passwords[name],
+		})
+		for _, g := range u.Spec.Groups {
+			members[g] = append(members[g], name)
+		}
+	}
+	cc.Users[smbcc.AllEntriesKey] = entries
+	groups := planner.localGroups()
+	if len(groups) == 0 {
+		return cc
+	}
+	gentries := make(smbcc.GroupEntries, 0, len(groups))
+	for _, g := range groups {
+		entry := smbcc.GroupEntry{Name: g.Name, Gid: uint(g.GID)}
+		if names := append(members[g.Name], g.Members...); len(names) > 0 {
+			entry.Members = sortedUnique(names)
+		}
+		gentries = append(gentries, entry)
+	}
+	cc.Groups = map[smbcc.Key]smbcc.GroupEntries{smbcc.AllEntriesKey: gentries}
+	return cc
+}
+
+// generateSmbUsersConfig returns the users config generated from the
+// SmbUsers of the share's security config, and the users it imports.
+func (m *SmbShareManager) generateSmbUsersConfig(
+	ctx context.Context, planner *sharePlanner) (
+	*smbcc.SambaContainerConfig, error) {
+	// ---
+	cc, _, _, err := m.generateSmbUsersImportConfig(ctx, planner)
+	return cc, err
+}
+
+// generateSmbUsersImportConfig returns the users config generated from the
+// SmbUsers of the share's security config and the users it imports, along
+// with the number of imported users and of skipped accounts.
+func (m *SmbShareManager) generateSmbUsersImportConfig(
+	ctx context.Context, planner *sharePlanner) (
+	*smbcc.SambaContainerConfig, int, int, error) {
+	// ---
+	users, err := m.listSmbUsers(ctx, planner)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	passwords := map[string]string{}
+	for i := range users {
+		password, err := m.smbUserPassword(ctx, &users[i])
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		passwords[smbUserName(&users[i])] = password
+	}
+	imported, skipped, err := m.importedUsers(ctx, planner)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	cc := smbUsersConfig(planner, users, passwords)
+	addImportedUsers(cc, imported)
+	return cc, len(imported), skipped, nil
+}
+
+// updateSmbUsersSecret stores the users config generated from the SmbUsers
+// of the share's security config in the Secret mounted by the share's pods.
+// The Secret is controlled by the security config when they are in the same
+// namespace. It returns true if the Secret was created or changed.
+func (m *SmbShareManager) updateSmbUsersSecret(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	if !planner.usesSmbUsers() {
+		return false, nil
+	}
+	s := planner.SmbShare
+	cc, imported, skipped, err := m.generateSmbUsersImportConfig(ctx, planner)
+	if err != nil {
+		return false, err
+	}
+	// we use marshal indent so that the json is semi-human-readable
+	data, err := json.MarshalIndent(cc, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	sc := planner.SecurityConfig
+	desired := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      smbUsersSecretName(sc),
+			Namespace: ns,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "samba-operator",
+			},
+		},
+		Data: map[string][]byte{smbUsersSecretKey: data},
+	}
+	if sc.Namespace == ns {
+		err := controllerutil.SetControllerReference(sc, desired, m.scheme)
+		if err != nil {
+			return false, err
+		}
+	}
+	found := &corev1.Secret{}
+	err = m.client.Get(ctx,
+		types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace},
+		found)
+	if errors.IsNotFound(err) {
+		m.logger.Info("Creating a new Secret",
+			"Secret.Namespace", desired.Namespace,
+			"Secret.Name", desired.Name)
+		err = m.client.Create(
+			ctx, desired, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to create new Secret",
+				"Secret.Namespace", desired.Namespace,
+				"Secret.Name", desired.Name)
+			return false, err
+		}
+		m.recorder.Eventf(s,
+			EventNormal,
+			ReasonCreatedSecret,
+			"Created Secret %s holding the SmbUsers of security config %s",
+			desired.Name, sc.Name)
+		m.importedUsersEvent(planner, imported, skipped)
+		return true, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get Secret",
+			"Secret.Namespace", desired.Namespace,
+			"Secret.Name", desired.Name)
+		return false, err
+	}
+	if !reflect.DeepEqual(found.Data, desired.Data) {
+		found.Data = desired.Data
+		if err := m.writeChild(ctx, found, desired); err != nil {
+			m.logger.Error(err, "Failed to update Secret",
+				"Secret.Namespace", found.Namespace,
+				"Secret.Name", found.Name)
+			return false, err
+		}
+		m.recorder.Eventf(s,
+			EventNormal,
+			ReasonUpdatedSecret,
+			"Updated the SmbUsers of security config %s in Secret %s",
+			sc.Name, found.Name)
+		m.importedUsersEvent(planner, imported, skipped)
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,229 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// smbUsersPlanner returns a planner of a share whose security config, in
+// the default namespace, gets its users from SmbUsers.
+func smbUsersPlanner(
+	share *sambaoperatorv1alpha1.SmbShare,
+	groups ...sambaoperatorv1alpha1.SmbSecurityLocalGroupSpec) *sharePlanner {
+	// ---
+	planner := localGroupsPlanner(share, groups...)
+	planner.SecurityConfig.Name = "mysec"
+	planner.SecurityConfig.Namespace = "default"
+	planner.SecurityConfig.Spec.Users.Secret = ""
+	planner.SecurityConfig.Spec.Users.Key = ""
+	return planner
+}
+
+func testSmbUser(name, secret string, groups ...string) *sambaoperatorv1alpha1.SmbUser {
+	u := &sambaoperatorv1alpha1.SmbUser{}
+	u.Name = name
+	u.Namespace = "default"
+	u.Spec.SecurityConfig = "mysec"
+	u.Spec.Password.Secret = secret
+	u.Spec.Groups = groups
+	return u
+}
+
+func passwordSecret(name string, data map[string]string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Data:       map[string][]byte{},
+	}
+	for k, v := range data {
+		secret.Data[k] = []byte(v)
+	}
+	return secret
+}
+
+func TestSmbUsersSecuritySource(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Spec.Storage.Pvc = &sambaoperatorv1alpha1.SmbSharePvcSpec{}
+	planner := smbUsersPlanner(share, sambaoperatorv1alpha1.SmbSecurityLocalGroupSpec{
+		Name: "staff",
+	})
+	assert.True(t, planner.usesSmbUsers())
+	uss := planner.userSecuritySource()
+	assert.Equal(t, "mysec-smbusers", uss.Secret)
+	assert.Equal(t, "users.json", uss.Key)
+	// the local groups are part of the generated users secret
+	assert.False(t, planner.projectsLocalGroups())
+	assert.Equal(t,
+		"/etc/container-config/config.json:/etc/container-users/users.json",
+		planner.containerConfigPath())
+
+	planner.SecurityConfig.Spec.Users.Secret = "users"
+	assert.False(t, planner.usesSmbUsers())
+	assert.Equal(t, "users", planner.userSecuritySource().Secret)
+	assert.False(t, testPlanner(share, nil).usesSmbUsers())
+}
+
+func TestValidateSmbUsers(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := smbUsersPlanner(share, sambaoperatorv1alpha1.SmbSecurityLocalGroupSpec{
+		Name: "staff",
+	})
+	alice := testSmbUser("alice", "passwords", "staff")
+	bob := testSmbUser("bob", "passwords")
+	bob.Spec.Password.Key = "bob"
+	// users of other security configs are ignored
+	other := testSmbUser("other", "missing", "admins")
+	other.Spec.SecurityConfig = "othersec"
+	passwords := passwordSecret("passwords", map[string]string{
+		"password": "wond3r1and",
+		"bob":      "r0b0t",
+	})
+	ctx := context.TODO()
+
+	m, recorder := newTestManager(share, alice, bob, other, passwords)
+	valid, err := m.validateSmbUsers(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, recorder.Events, 0)
+
+	check := func(msg string, users ...*sambaoperatorv1alpha1.SmbUser) {
+		t.Helper()
+		m, recorder := newTestManager(share, passwords)
+		for _, u := range users {
+			require.NoError(t, m.client.Create(ctx, u))
+		}
+		valid, err := m.validateSmbUsers(ctx, planner)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidSmbUser)
+			assert.Contains(t, event, msg)
+		}
+	}
+	carol := testSmbUser("carol", "passwords")
+	carol.Spec.Password.Key = "carol"
+	check("SmbUser carol has no password in key carol of Secret passwords", carol)
+	check("SmbUser dave has no password in key password of Secret missing",
+		testSmbUser("dave", "missing"))
+	check("Group admins of SmbUser erin is not a local group of security config mysec",
+		testSmbUser("erin", "passwords", "admins"))
+	alias := testSmbUser("alice2", "passwords")
+	alias.Spec.Username = "alice"
+	check("SmbUsers alice and alice2 have the same user name alice",
+		testSmbUser("alice", "passwords"), alias)
+	invalid := testSmbUser("frank", "passwords")
+	invalid.Spec.Username = "frank:x"
+	check(`Invalid user name of SmbUser frank: "frank:x"`, invalid)
+
+	// users of a users secret are not checked
+	planner.SecurityConfig.Spec.Users.Secret = "users"
+	m, _ = newTestManager(share, testSmbUser("dave", "missing"))
+	valid, err = m.validateSmbUsers(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestUpdateSmbUsersSecret(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	staff := sambaoperatorv1alpha1.SmbSecurityLocalGroupSpec{
+		Name:    "staff",
+		GID:     3000,
+		Members: []string{"sambauser"},
+	}
+	planner := smbUsersPlanner(share, staff)
+	alice := testSmbUser("alice", "passwords", "staff")
+	alice.Spec.UID = 1001
+	bob := testSmbUser("robert", "passwords")
+	bob.Spec.Username = "bob"
+	bob.Spec.Password.Key = "bob"
+	sambauser := testSmbUser("sambauser", "passwords")
+	passwords := passwordSecret("passwords", map[string]string{
+		"password": "wond3r1and",
+		"bob":      "r0b0t",
+	})
+	m, recorder := newTestManager(share, alice, bob, sambauser, passwords)
+	ctx := context.TODO()
+
+	changed, err := m.updateSmbUsersSecret(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonCreatedSecret)
+	secret := &corev1.Secret{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "mysec-smbusers"},
+		secret))
+	if assert.Len(t, secret.OwnerReferences, 1) {
+		assert.Equal(t, "mysec", secret.OwnerReferences[0].Name)
+	}
+	cc := &smbcc.SambaContainerConfig{}
+	require.NoError(t, json.Unmarshal(secret.Data[smbUsersSecretKey], cc))
+	assert.Equal(t, smbcc.UserEntries{
+		{Name: "alice", Uid: 1001, Password: "wond3r1and"},
+		{Name: "bob", Password: "r0b0t"},
+		{Name: "sambauser", Password: "wond3r1and"},
+	}, cc.Users[smbcc.AllEntriesKey])
+	assert.Equal(t, smbcc.GroupEntries{
+		{Name: "staff", Gid: 3000, Members: []string{"alice", "sambauser"}},
+	}, cc.Groups[smbcc.AllEntriesKey])
+
+	// the generated users are those of the users config of the share
+	users, err := m.getUsersConfig(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, cc, users)
+	share.Spec.AccessControl = &sambaoperatorv1alpha1.SmbShareAccessControl{
+		ValidUsers: []string{"@staff"},
+	}
+	valid, err := m.validateLocalGroups(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	changed, err = m.updateSmbUsersSecret(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// changing a password updates the secret
+	passwords.Data["bob"] = []byte("b0bb0")
+	require.NoError(t, m.client.Update(ctx, passwords))
+	changed, err = m.updateSmbUsersSecret(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonUpdatedSecret)
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "mysec-smbusers"},
+		secret))
+	assert.Contains(t, string(secret.Data[smbUsersSecretKey]), "b0bb0")
+
+	// no secret is generated for a users secret
+	planner.SecurityConfig.Spec.Users.Secret = "users"
+	m, _ = newTestManager(share, alice, passwords)
+	changed, err = m.updateSmbUsersSecret(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
@@ -0,0 +1,142 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+// socketOptionKind tells which values a socket option takes.
+type socketOptionKind int
+
+const (
+	// socketOptionBool is turned on by its name alone, or set to 0 or 1.
+	socketOptionBool socketOptionKind = iota
+	// socketOptionInt requires an integer value.
+	socketOptionInt
+	// socketOptionOn is turned on by its name and takes no value.
+	socketOptionOn
+)
+
+// knownSocketOptions are the socket options samba sets on Linux.
+var knownSocketOptions = map[string]socketOptionKind{
+	"SO_KEEPALIVE":     socketOptionBool,
+	"SO_REUSEADDR":     socketOptionBool,
+	"SO_REUSEPORT":     socketOptionBool,
+	"SO_BROADCAST":     socketOptionBool,
+	"TCP_NODELAY":      socketOptionBool,
+	"TCP_QUICKACK":     socketOptionBool,
+	"TCP_KEEPCNT":      socketOptionInt,
+	"TCP_KEEPIDLE":     socketOptionInt,
+	"TCP_KEEPINTVL":    socketOptionInt,
+	"TCP_DEFER_ACCEPT": socketOptionInt,
+	"TCP_USER_TIMEOUT": socketOptionInt,
+	"SO_SNDBUF":        socketOptionInt,
+	"SO_RCVBUF":        socketOptionInt,
+	"SO_SNDLOWAT":      socketOptionInt,
+	"SO_RCVLOWAT":      socketOptionInt,
+	"SO_SNDTIMEO":      socketOptionInt,
+	"SO_RCVTIMEO":      socketOptionInt,
+	"IPTOS_LOWDELAY":   socketOptionOn,
+	"IPTOS_THROUGHPUT": socketOptionOn,
+}
+
+// socketOptions returns the socket options of the common config.
+func (sp *sharePlanner) socketOptions() []string {
+	if sp.CommonConfig == nil {
+		return nil
+	}
+	return sp.CommonConfig.Spec.Network.SocketOptions
+}
+
+// socketOptionsParam returns the value of the socket options parameter.
+func (sp *sharePlanner) socketOptionsParam() string {
+	return strings.Join(sp.socketOptions(), " ")
+}
+
+// socketOptionsKey returns the key of the globals section setting the
+// socket options, or an empty key if samba's defaults are used. The key is
+// derived from the options.
+func (sp *sharePlanner) socketOptionsKey() smbcc.Key {
+	if len(sp.socketOptions()) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(sp.socketOptionsParam()))
+	return smbcc.Key(fmt.Sprintf("socket_options_%x", sum)[:23])
+}
+
+// checkSocketOption returns an error if samba does not accept the socket
+// option, given as NAME or NAME=value.
+func checkSocketOption(option string) error {
+	parts := strings.SplitN(option, "=", 2)
+	kind, found := knownSocketOptions[parts[0]]
+	if !found {
+		return fmt.Errorf("unknown socket option %s", parts[0])
+	}
+	if len(parts) == 1 {
+		if kind == socketOptionInt {
+			return fmt.Errorf("socket option %s requires a value", parts[0])
+		}
+		return nil
+	}
+	value := parts[1]
+	switch kind {
+	case socketOptionOn:
+		return fmt.Errorf("socket option %s takes no value", parts[0])
+	case socketOptionBool:
+		if value != "0" && value != "1" {
+			return fmt.Errorf("socket option %s must be 0 or 1", parts[0])
+		}
+	case socketOptionInt:
+		if _, err := strconv.ParseUint(value, 10, 31); err != nil {
+			return fmt.Errorf(
+				"socket option %s requires a non-negative integer", parts[0])
+		}
+	}
+	return nil
+}
+
+// validateSocketOptions checks that samba accepts the socket options of the
+// common config, and that each is set once. If not, the Degraded condition
+// is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateSocketOptions(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidSocketOptions, msg)
+	}
+	seen := map[string]bool{}
+	for _, option := range planner.socketOptions() {
+		if err := checkSocketOption(option); err != nil {
+			return degraded(fmt.Sprintf(
+				"Invalid socket option %q: %v", option, err))
+		}
+		name := strings.SplitN(option, "=", 2)[0]
+		if seen[name] {
+			return degraded(fmt.Sprintf(
+				"Socket option %s is set more than once", name))
+		}
+		seen[name] = true
+	}
+	return true, nil
+}
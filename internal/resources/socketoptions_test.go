@@ -0,0 +1,118 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func TestPlannerSocketOptions(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Status.ServerGroup = "myshare"
+	cc := smbcc.New()
+	planner := newSharePlanner(
+		InstanceConfiguration{SmbShare: share},
+		cc)
+	assert.Equal(t, smbcc.Key(""), planner.socketOptionsKey())
+	planner.CommonConfig = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	assert.Equal(t, smbcc.Key(""), planner.socketOptionsKey())
+
+	planner.CommonConfig.Spec.Network.SocketOptions = []string{
+		"SO_KEEPALIVE", "TCP_KEEPIDLE=60", "TCP_KEEPINTVL=10",
+	}
+	_, err := planner.update()
+	assert.NoError(t, err)
+	key := planner.socketOptionsKey()
+	assert.Equal(t,
+		[]smbcc.Key{smbcc.NoPrintingKey, defaultAuthKey, key},
+		cc.Configs["myshare"].Globals)
+	conf, err := cc.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf,
+		"\tsocket options = SO_KEEPALIVE TCP_KEEPIDLE=60 TCP_KEEPINTVL=10\n")
+	changed, err := planner.update()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// changed options replace the globals section
+	planner.CommonConfig.Spec.Network.SocketOptions = []string{"TCP_NODELAY"}
+	assert.NotEqual(t, key, planner.socketOptionsKey())
+	changed, err = planner.update()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	conf, err = cc.SmbConf("myshare")
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "\tsocket options = TCP_NODELAY\n")
+	assert.NotContains(t, conf, "TCP_KEEPIDLE")
+}
+
+func TestValidateSocketOptions(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	planner := testPlanner(share, common)
+	ctx := context.TODO()
+
+	valid := [][]string{
+		nil,
+		{"SO_KEEPALIVE", "TCP_NODELAY=1", "IPTOS_LOWDELAY"},
+		{"SO_KEEPALIVE=0", "TCP_KEEPIDLE=60", "TCP_KEEPCNT=3", "TCP_USER_TIMEOUT=0"},
+	}
+	for _, options := range valid {
+		common.Spec.Network.SocketOptions = options
+		m, recorder := newTestManager(share)
+		ok, err := m.validateSocketOptions(ctx, planner)
+		assert.NoError(t, err)
+		assert.True(t, ok, options)
+		assert.Len(t, recorder.Events, 0)
+	}
+
+	check := func(msg string, options ...string) {
+		t.Helper()
+		common.Spec.Network.SocketOptions = options
+		m, recorder := newTestManager(share)
+		ok, err := m.validateSocketOptions(ctx, planner)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidSocketOptions)
+			assert.Contains(t, event, msg)
+		}
+	}
+	check(`Invalid socket option "SO_KEEPALIVES": unknown socket option SO_KEEPALIVES`,
+		"SO_KEEPALIVES")
+	check(`Invalid socket option "tcp_nodelay": unknown socket option tcp_nodelay`,
+		"tcp_nodelay")
+	check(`Invalid socket option "TCP_KEEPIDLE": socket option TCP_KEEPIDLE requires a value`,
+		"SO_KEEPALIVE", "TCP_KEEPIDLE")
+	check(`socket option TCP_KEEPIDLE requires a non-negative integer`,
+		"TCP_KEEPIDLE=-1")
+	check(`socket option TCP_KEEPCNT requires a non-negative integer`,
+		"TCP_KEEPCNT=three")
+	check(`socket option SO_KEEPALIVE must be 0 or 1`, "SO_KEEPALIVE=yes")
+	check(`socket option IPTOS_LOWDELAY takes no value`, "IPTOS_LOWDELAY=1")
+	check("Socket option TCP_KEEPIDLE is set more than once",
+		"TCP_KEEPIDLE=60", "TCP_KEEPIDLE=30")
+}
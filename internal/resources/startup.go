@@ -0,0 +1,145 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultStartupTimeout is how long the pods of a share may take to become
+// ready, if neither the operator nor the common config set a timeout.
+const defaultStartupTimeout = 10 * time.Minute
+
+// imagePullReasons are the reasons a container waits for its image.
+var imagePullReasons = map[string]bool{
+	"ErrImagePull":     true,
+	"ImagePullBackOff": true,
+}
+
+// storageEventReasons are the reasons of the pod events recorded while the
+// volumes of a pod can not be attached or mounted.
+var storageEventReasons = map[string]bool{
+	"FailedAttachVolume": true,
+	"FailedMount":        true,
+}
+
+// startupTimeout returns how long the pods of the share may take to become
+// ready before the share is reported as degraded.
+func (m *SmbShareManager) startupTimeout(planner *sharePlanner) time.Duration {
+	cc := planner.CommonConfig
+	if cc != nil && cc.Spec.PodSettings != nil &&
+		cc.Spec.PodSettings.StartupTimeoutSeconds != nil {
+		// ---
+		return time.Duration(*cc.Spec.PodSettings.StartupTimeoutSeconds) *
+			time.Second
+	}
+	if m.cfg.StartupTimeout > 0 {
+		return m.cfg.StartupTimeout
+	}
+	return defaultStartupTimeout
+}
+
+// notReadySince returns the time from which a pod that is not ready has
+// been starting: its creation, or the last time it stopped being ready.
+// False is returned if the pod is ready.
+func notReadySince(pod *corev1.Pod) (time.Time, bool) {
+	since := pod.CreationTimestamp.Time
+	for _, c := range pod.Status.Conditions {
+		if c.Type != corev1.PodReady {
+			continue
+		}
+		if c.Status == corev1.ConditionTrue {
+			return time.Time{}, false
+		}
+		if c.LastTransitionTime.Time.After(since) {
+			since = c.LastTransitionTime.Time
+		}
+	}
+	return since, true
+}
+
+// podStartupPhase returns the reason a scheduled pod is not ready yet, and
+// the description of what it is waiting for. The containers of the pod are
+// checked first, then the most recent event of the pod.
+func (m *SmbShareManager) podStartupPhase(
+	ctx context.Context, pod *corev1.Pod) (string, string, error) {
+	// ---
+	statuses := append(
+		append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if w := cs.State.Waiting; w != nil && imagePullReasons[w.Reason] {
+			return ReasonImagePull, fmt.Sprintf(
+				"pulling image %s of container %s", cs.Image, cs.Name), nil
+		}
+	}
+	for _, cs := range pod.Status.InitContainerStatuses {
+		if cs.Name == joinContainerName && cs.State.Running != nil {
+			return ReasonJoining, "joining the domain", nil
+		}
+	}
+	last, err := m.lastEvent(ctx, pod.Namespace, pod.UID, "")
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case last == nil:
+	case last.Reason == "Pulling":
+		return ReasonImagePull, "pulling its images: " + last.Message, nil
+	case storageEventReasons[last.Reason]:
+		return ReasonWaitingForStorage,
+			"waiting for its volumes: " + last.Message, nil
+	}
+	return ReasonStarting, "starting", nil
+}
+
+// podStartupState returns the state of a scheduled pod of the share that
+// is not ready yet. The pod is stuck once it has been starting for longer
+// than the timeout.
+func (m *SmbShareManager) podStartupState(
+	ctx context.Context,
+	pod *corev1.Pod,
+	now time.Time,
+	timeout time.Duration) (pendingState, error) {
+	// ---
+	since, starting := notReadySince(pod)
+	if !starting {
+		return pendingState{}, nil
+	}
+	reason, desc, err := m.podStartupPhase(ctx, pod)
+	if err != nil {
+		return pendingState{}, err
+	}
+	waited := now.Sub(since)
+	if waited < timeout {
+		return pendingState{
+			reason: reason,
+			waiting: fmt.Sprintf("Pod %s is %s (%s elapsed)",
+				pod.Name, desc, waited.Truncate(time.Second)),
+			recheck: storageRecheck(waited, timeout),
+		}, nil
+	}
+	return pendingState{
+		stuck:  true,
+		reason: ReasonStartupTimeout,
+		message: fmt.Sprintf("Pod %s has not become ready within %s: %s",
+			pod.Name, timeout, desc),
+	}, nil
+}
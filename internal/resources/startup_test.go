@@ -0,0 +1,197 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+// startingPod returns a pod of the share's server group that was scheduled
+// age ago and is not ready yet.
+func startingPod(planner *sharePlanner, age time.Duration) *corev1.Pod {
+	pod := pendingPod(planner, age)
+	pod.UID = "pod-uid"
+	pod.Spec.NodeName = "node1"
+	pod.Status.Conditions = []corev1.PodCondition{{
+		Type:   corev1.PodScheduled,
+		Status: corev1.ConditionTrue,
+	}, {
+		Type:               corev1.PodReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: pod.CreationTimestamp,
+	}}
+	return pod
+}
+
+func TestStartupTimeout(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	m, _ := newTestManager()
+	assert.Equal(t, defaultStartupTimeout, m.startupTimeout(testPlanner(share, nil)))
+	m.cfg.StartupTimeout = 20 * time.Minute
+	assert.Equal(t, 20*time.Minute, m.startupTimeout(testPlanner(share, nil)))
+
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.PodSettings = &sambaoperatorv1alpha1.SmbCommonPodSettings{}
+	seconds := int32(90)
+	common.Spec.PodSettings.StartupTimeoutSeconds = &seconds
+	assert.Equal(t, 90*time.Second, m.startupTimeout(testPlanner(share, common)))
+}
+
+func TestCheckSchedulableStartup(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	planner := testPlanner(share, nil)
+	progressing := func() *sambaoperatorv1alpha1.Condition {
+		return findCondition(
+			share.Status.Conditions,
+			sambaoperatorv1alpha1.ConditionProgressing)
+	}
+	podEvent := func(reason, msg string) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{Name: reason, Namespace: "default"},
+			InvolvedObject: corev1.ObjectReference{
+				Kind: "Pod",
+				Name: "myshare-abc",
+				UID:  "pod-uid",
+			},
+			Reason:        reason,
+			Type:          corev1.EventTypeNormal,
+			Message:       msg,
+			LastTimestamp: metav1.Now(),
+		}
+	}
+
+	check := func(
+		pod *corev1.Pod, event *corev1.Event, reason, msg string) {
+		// ---
+		t.Helper()
+		share.Status.Conditions = nil
+		objs := []runtime.Object{share, pod}
+		if event != nil {
+			objs = append(objs, event)
+		}
+		m, recorder := newTestManager(objs...)
+		m.SetEventReader(m.client)
+		ok, recheck, err := m.checkSchedulable(
+			context.TODO(), planner, "default")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.True(t, recheck > 0 && recheck <= time.Minute)
+		if cond := progressing(); assert.NotNil(t, cond) {
+			assert.Equal(t, corev1.ConditionTrue, cond.Status)
+			assert.Equal(t, reason, cond.Reason)
+			assert.Equal(t, msg, cond.Message)
+		}
+		if assert.Len(t, recorder.Events, 1) {
+			assert.Contains(t, <-recorder.Events, reason)
+		}
+	}
+
+	// the images of the pod are being pulled
+	pod := startingPod(planner, 30*time.Second)
+	check(pod, podEvent("Pulling", `Pulling image "quay.io/samba.org/samba-server:latest"`),
+		ReasonImagePull,
+		`Pod myshare-abc is pulling its images: `+
+			`Pulling image "quay.io/samba.org/samba-server:latest" (30s elapsed)`)
+
+	// pulling an image failed, the kubelet retries
+	pod = startingPod(planner, time.Minute)
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "init",
+		Image: "quay.io/samba.org/samba-server:latest",
+		State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"},
+		},
+	}}
+	check(pod, nil, ReasonImagePull,
+		"Pod myshare-abc is pulling image quay.io/samba.org/samba-server:latest"+
+			" of container init (1m0s elapsed)")
+
+	// the pod joins the domain
+	pod = startingPod(planner, 2*time.Minute)
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		Name: "init",
+		State: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{},
+		},
+	}, {
+		Name: joinContainerName,
+		State: corev1.ContainerState{
+			Running: &corev1.ContainerStateRunning{},
+		},
+	}}
+	check(pod, podEvent("Pulling", "no longer relevant"), ReasonJoining,
+		"Pod myshare-abc is joining the domain (2m0s elapsed)")
+
+	// the volumes of the pod can not be mounted yet
+	pod = startingPod(planner, 3*time.Minute)
+	check(pod, podEvent("FailedMount", "Unable to attach or mount volumes"),
+		ReasonWaitingForStorage,
+		"Pod myshare-abc is waiting for its volumes: "+
+			"Unable to attach or mount volumes (3m0s elapsed)")
+
+	// the pod is running but not ready
+	pod = startingPod(planner, 4*time.Minute)
+	pod.Status.Phase = corev1.PodRunning
+	check(pod, nil, ReasonStarting, "Pod myshare-abc is starting (4m0s elapsed)")
+
+	// the share is degraded once the timeout expires
+	pod = startingPod(planner, 11*time.Minute)
+	m, recorder := newTestManager(share, pod)
+	ok, _, err := m.checkSchedulable(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Contains(t, <-recorder.Events, ReasonStartupTimeout)
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, ReasonStartupTimeout, cond.Reason)
+		assert.Equal(t,
+			"Pod myshare-abc has not become ready within 10m0s: starting",
+			cond.Message)
+	}
+	if cond := progressing(); assert.NotNil(t, cond) {
+		assert.Equal(t, corev1.ConditionFalse, cond.Status)
+		assert.Equal(t, ReasonStartupTimeout, cond.Reason)
+	}
+	gauge := shareUnschedulable.WithLabelValues("default", "myshare")
+	assert.Equal(t, 0.0, testutil.ToFloat64(gauge))
+
+	// a ready pod ends the wait
+	pod.Status.Conditions[1].Status = corev1.ConditionTrue
+	m, _ = newTestManager(share, pod)
+	ok, recheck, err := m.checkSchedulable(context.TODO(), planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), recheck)
+	if cond := progressing(); assert.NotNil(t, cond) {
+		assert.Equal(t, corev1.ConditionFalse, cond.Status)
+		assert.Equal(t, ReasonReconciled, cond.Reason)
+	}
+
+	forgetShareMetrics(share)
+}
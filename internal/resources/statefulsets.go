@@ -0,0 +1,286 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+)
+
+// buildStatefulSet returns a samba server StatefulSet object. Its pods are
+// those of the server deployment, with stable names resolving through the
+// headless service of the server group.
+func buildStatefulSet(cfg *conf.OperatorConfig,
+	planner *sharePlanner, pvcName, ns string) *appsv1.StatefulSet {
+	// ---
+	dep := buildDeployment(cfg, planner, pvcName, ns)
+	return &appsv1.StatefulSet{
+		ObjectMeta: dep.ObjectMeta,
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    dep.Spec.Replicas,
+			Selector:    dep.Spec.Selector,
+			ServiceName: planner.headlessServiceName(),
+			Template:    dep.Spec.Template,
+		},
+	}
+}
+
+// newHeadlessServiceForSmb returns the headless service of the server
+// group, giving each pod of the server StatefulSet a DNS name.
+func newHeadlessServiceForSmb(planner *sharePlanner, ns string) *corev1.Service {
+	labels := labelsForSmbServer(planner.instanceName())
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      planner.headlessServiceName(),
+			Namespace: ns,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Ports: []corev1.ServicePort{{
+				Name:       "smb",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       planner.smbPort(),
+				TargetPort: intstr.FromInt(int(planner.smbPort())),
+			}},
+			Selector: map[string]string{
+				svcSelectorKey: labels[svcSelectorKey],
+			},
+		},
+	}
+}
+
+// validateWorkload checks that the settings of the common config are
+// supported by the workload type of the server pods. If not, the Degraded
+// condition is set on the SmbShare and false is returned.
+func (m *SmbShareManager) validateWorkload(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	if planner.workloadType() != statefulSetWorkload {
+		return true, nil
+	}
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidWorkload, msg)
+	}
+	if planner.CommonConfig.Spec.UpdateStrategy != nil {
+		return degraded("The update strategy requires workload type deployment")
+	}
+	if planner.restartSchedule() != "" {
+		return degraded("Scheduled restarts require workload type deployment")
+	}
+	return true, nil
+}
+
+// otherWorkloads returns the workloads of the server group that are not of
+// the workload type of the planner, along with their headless service.
+func (m *SmbShareManager) otherWorkloads(
+	planner *sharePlanner, ns string) []childResource {
+	// ---
+	meta := metav1.ObjectMeta{Name: planner.instanceName(), Namespace: ns}
+	if planner.workloadType() == statefulSetWorkload {
+		return []childResource{
+			{"Deployment", &appsv1.Deployment{ObjectMeta: meta}},
+		}
+	}
+	return []childResource{
+		{"StatefulSet", &appsv1.StatefulSet{ObjectMeta: meta}},
+		{"Service", &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Name:      planner.headlessServiceName(),
+			Namespace: ns,
+		}}},
+	}
+}
+
+// removeOtherWorkloads deletes the workloads of the server group left
+// behind by a change of workload type. It returns true until they are
+// gone, so that the pods of the old workload stop before those of the new
+// workload are started.
+func (m *SmbShareManager) removeOtherWorkloads(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	for _, child := range m.otherWorkloads(planner, ns) {
+		gone, err := m.deleteChild(ctx, planner.SmbShare, child)
+		if err != nil {
+			return false, err
+		} else if !gone {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// statefulSetForSmbShare returns a smbshare StatefulSet object
+func (m *SmbShareManager) statefulSetForSmbShare(
+	planner *sharePlanner, ns string) *appsv1.StatefulSet {
+	// ---
+	return buildStatefulSet(m.cfg, planner, ownPvcName(planner), ns)
+}
+
+// getOrCreateHeadlessService returns the headless service of the server
+// group, creating it if it does not exist, and updating its port. It
+// returns true if the service was created or changed.
+func (m *SmbShareManager) getOrCreateHeadlessService(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	desired := newHeadlessServiceForSmb(planner, ns)
+	found := &corev1.Service{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{Name: desired.Name, Namespace: ns},
+		found)
+	if errors.IsNotFound(err) {
+		if err := m.setOwner(planner.SmbShare, desired); err != nil {
+			return false, err
+		}
+		m.logger.Info("Creating a new Service",
+			"Service.Namespace", desired.Namespace,
+			"Service.Name", desired.Name)
+		err = m.client.Create(ctx, desired, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to create new Service",
+				"Service.Namespace", desired.Namespace,
+				"Service.Name", desired.Name)
+			return false, err
+		}
+		m.recorder.Eventf(planner.SmbShare,
+			EventNormal,
+			ReasonCreatedService,
+			"Created headless service %s for SmbShare", desired.Name)
+		return true, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get Service",
+			"Service.Namespace", ns, "Service.Name", desired.Name)
+		return false, err
+	}
+	if equality.Semantic.DeepEqual(found.Spec.Ports, desired.Spec.Ports) {
+		return false, nil
+	}
+	found.Spec.Ports = desired.Spec.Ports
+	if err := m.writeChild(ctx, found, desired); err != nil {
+		m.logger.Error(err, "Failed to update Service",
+			"Service.Namespace", found.Namespace,
+			"Service.Name", found.Name)
+		return false, err
+	}
+	return true, nil
+}
+
+// updateStatefulSetWorkload creates the server StatefulSet of the share,
+// and its headless service, or updates its size and pod template. It
+// returns true if a resource was created or changed.
+func (m *SmbShareManager) updateStatefulSetWorkload(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	s := planner.SmbShare
+	changed, err := m.getOrCreateHeadlessService(ctx, planner, ns)
+	if err != nil || changed {
+		return changed, err
+	}
+	desired := m.statefulSetForSmbShare(planner, ns)
+	found := &appsv1.StatefulSet{}
+	err = m.client.Get(
+		ctx,
+		types.NamespacedName{Name: desired.Name, Namespace: ns},
+		found)
+	if errors.IsNotFound(err) {
+		if err := m.setOwner(s, desired); err != nil {
+			return false, err
+		}
+		m.logger.Info("Creating a new StatefulSet",
+			"StatefulSet.Namespace", desired.Namespace,
+			"StatefulSet.Name", desired.Name)
+		err = m.client.Create(ctx, desired, rtclient.FieldOwner(fieldManager))
+		if err != nil {
+			m.logger.Error(err, "Failed to create new StatefulSet",
+				"StatefulSet.Namespace", desired.Namespace,
+				"StatefulSet.Name", desired.Name)
+			return false, err
+		}
+		m.recorder.Eventf(s,
+			EventNormal,
+			ReasonCreatedStatefulSet,
+			"Created statefulset %s for SmbShare", desired.Name)
+		return true, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get StatefulSet",
+			"StatefulSet.Namespace", ns, "StatefulSet.Name", desired.Name)
+		return false, err
+	}
+
+	var msg string
+	if found.Spec.Replicas == nil || *found.Spec.Replicas != *desired.Spec.Replicas {
+		found.Spec.Replicas = desired.Spec.Replicas
+		msg = fmt.Sprintf("Resized statefulset %s to %d replicas",
+			found.Name, *found.Spec.Replicas)
+	} else if updatePodTemplate(&found.Spec.Template, &desired.Spec.Template) {
+		msg = fmt.Sprintf("Updated pod settings of statefulset %s", found.Name)
+	} else {
+		return false, nil
+	}
+	if err := m.writeChild(ctx, found, desired); err != nil {
+		m.logger.Error(err, "Failed to update StatefulSet",
+			"StatefulSet.Namespace", found.Namespace,
+			"StatefulSet.Name", found.Name)
+		return false, err
+	}
+	m.recorder.Event(s, EventNormal, ReasonUpdatedStatefulSet, msg)
+	return true, nil
+}
+
+// leaveGroupStatefulSet updates the StatefulSet of the server group so that
+// it no longer serves the share of the planner. It returns true if the
+// StatefulSet was changed.
+func (m *SmbShareManager) leaveGroupStatefulSet(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	ns := m.cfg.WorkingNamespace
+	found := &appsv1.StatefulSet{}
+	err := m.client.Get(
+		ctx,
+		types.NamespacedName{Name: planner.instanceName(), Namespace: ns},
+		found)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		m.logger.Error(err, "Failed to get StatefulSet",
+			"StatefulSet.Namespace", ns,
+			"StatefulSet.Name", planner.instanceName())
+		return false, err
+	}
+	desired := m.statefulSetForSmbShare(planner, ns)
+	if !updatePodTemplate(&found.Spec.Template, &desired.Spec.Template) {
+		return false, nil
+	}
+	if err := m.writeChild(ctx, found, desired); err != nil {
+		m.logger.Error(err, "Failed to update StatefulSet",
+			"StatefulSet.Namespace", found.Namespace,
+			"StatefulSet.Name", found.Name)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,142 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+)
+
+func statefulSetPlanner(share *sambaoperatorv1alpha1.SmbShare) *sharePlanner {
+	return testPlanner(share, &sambaoperatorv1alpha1.SmbCommonConfig{
+		Spec: sambaoperatorv1alpha1.SmbCommonConfigSpec{
+			WorkloadType: string(statefulSetWorkload),
+		},
+	})
+}
+
+func TestUpdateStatefulSetWorkload(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Namespace = "default"
+	planner := statefulSetPlanner(share)
+	m, recorder := newTestManager(share)
+	ctx := context.TODO()
+
+	// the headless service is created first
+	changed, err := m.updateStatefulSetWorkload(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonCreatedService)
+	svc := &corev1.Service{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare-headless"},
+		svc))
+	assert.Equal(t, corev1.ClusterIPNone, svc.Spec.ClusterIP)
+	assert.Equal(t, "myshare", svc.Spec.Selector[svcSelectorKey])
+
+	changed, err = m.updateStatefulSetWorkload(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonCreatedStatefulSet)
+	sts := &appsv1.StatefulSet{}
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare"}, sts))
+	assert.Equal(t, "myshare-headless", sts.Spec.ServiceName)
+	assert.Equal(t, int32(1), *sts.Spec.Replicas)
+	// the pods are those of the deployment
+	dep := m.deploymentForSmbShare(planner, "default")
+	assert.Equal(t, dep.Spec.Template, sts.Spec.Template)
+
+	changed, err = m.updateStatefulSetWorkload(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	share.Spec.Suspended = true
+	changed, err = m.updateStatefulSetWorkload(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, <-recorder.Events, ReasonUpdatedStatefulSet)
+	require.NoError(t, m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare"}, sts))
+	assert.Equal(t, int32(0), *sts.Spec.Replicas)
+}
+
+func TestRemoveOtherWorkloads(t *testing.T) {
+	share := pvcShare("", &corev1.PersistentVolumeClaimSpec{})
+	share.Namespace = "default"
+	planner := testPlanner(share, nil)
+	m, _ := newTestManager(share)
+	ctx := context.TODO()
+	_, created, err := m.getOrCreateDeployment(ctx, planner, "default")
+	require.NoError(t, err)
+	require.True(t, created)
+
+	// the deployment is the workload of the planner
+	removing, err := m.removeOtherWorkloads(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, removing)
+
+	// switching to a statefulset removes the deployment first
+	planner = statefulSetPlanner(share)
+	removing, err = m.removeOtherWorkloads(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, removing)
+	err = m.client.Get(ctx,
+		types.NamespacedName{Namespace: "default", Name: "myshare"},
+		&appsv1.Deployment{})
+	assert.True(t, errors.IsNotFound(err))
+	removing, err = m.removeOtherWorkloads(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, removing)
+}
+
+func TestValidateWorkload(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Namespace = "default"
+	planner := statefulSetPlanner(share)
+	m, recorder := newTestManager(share)
+	ctx := context.TODO()
+
+	valid, err := m.validateWorkload(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	planner.CommonConfig.Spec.Maintenance = &sambaoperatorv1alpha1.SmbMaintenanceSpec{
+		RestartSchedule: "0 3 * * 0",
+	}
+	valid, err = m.validateWorkload(ctx, planner)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	event := <-recorder.Events
+	assert.Contains(t, event, ReasonInvalidWorkload)
+	assert.Contains(t, event, "Scheduled restarts require workload type deployment")
+
+	// deployments support all settings
+	planner.CommonConfig.Spec.WorkloadType = ""
+	planner.CommonConfig.Spec.UpdateStrategy = &sambaoperatorv1alpha1.SmbUpdateStrategy{}
+	valid, err = m.validateWorkload(ctx, planner)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
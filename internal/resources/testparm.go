@@ -0,0 +1,139 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// checkConfigContainerName is the name of the init container checking the
+// smb.conf of the pod with testparm before the samba servers start.
+const checkConfigContainerName = "check-config"
+
+// checkConfigScript prints the smb.conf generated from the container config
+// and checks it with testparm. Unknown parameters are only reported by
+// testparm, which then ignores them, so they fail the check too. The errors
+// are printed last, so that they become the termination message of the
+// container.
+const checkConfigScript = `
+conf=$(samba-container print-config) || exit 1
+out=$(printf '%s\n' "$conf" | testparm -s /dev/stdin 2>&1 >/dev/null)
+rc=$?
+errors=$(printf '%s\n' "$out" | grep -e 'nknown parameter' -e 'ERROR')
+if [ "$rc" -ne 0 ] || [ -n "$errors" ]; then
+    printf '%s\n' "${errors:-$out}" >&2
+    exit 1
+fi
+`
+
+// checkConfigInitContainer returns the init container checking the smb.conf
+// of the pod. The container sees the configuration as the samba container
+// does, with the same environment and mounts, so that the files included
+// by the configuration are checked too.
+func checkConfigInitContainer(
+	planner *sharePlanner, smbd *corev1.Container) corev1.Container {
+	// ---
+	return corev1.Container{
+		Image:        planner.sambaImage(),
+		Name:         checkConfigContainerName,
+		Command:      []string{"/bin/sh", "-c", checkConfigScript},
+		Env:          smbd.Env,
+		VolumeMounts: smbd.VolumeMounts,
+		// the errors of a failed check are reported in the SmbShare's
+		// conditions.
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+}
+
+// addCheckConfigContainer runs the configuration check as the last init
+// container of the pod, right before the samba servers start.
+func addCheckConfigContainer(
+	podSpec *corev1.PodSpec, planner *sharePlanner, smbdName string) {
+	// ---
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name != smbdName {
+			continue
+		}
+		podSpec.InitContainers = append(podSpec.InitContainers,
+			checkConfigInitContainer(planner, &podSpec.Containers[i]))
+		return
+	}
+}
+
+// podConfigCheckFailure returns the errors reported by the configuration
+// check of the pod if it failed, as it does until the configuration is
+// fixed, or an empty string otherwise.
+func podConfigCheckFailure(pod *corev1.Pod) string {
+	return initContainerFailure(pod, func(name string) bool {
+		return name == checkConfigContainerName
+	})
+}
+
+// initContainerFailure returns the termination message of the first init
+// container of the pod, selected by match, that failed, or an empty string
+// if none did.
+func initContainerFailure(pod *corev1.Pod, match func(string) bool) string {
+	for _, cs := range pod.Status.InitContainerStatuses {
+		if !match(cs.Name) {
+			continue
+		}
+		if t := cs.State.Terminated; t != nil {
+			if t.ExitCode == 0 {
+				continue
+			}
+			return terminationText(t)
+		}
+		// waiting to be restarted, or running again, after a failure
+		if t := cs.LastTerminationState.Terminated; t != nil && t.ExitCode != 0 {
+			return terminationText(t)
+		}
+	}
+	return ""
+}
+
+// checkConfigStatus sets the Degraded condition on the SmbShare, and returns
+// false, if the configuration check of a server pod failed. The pods whose
+// check fails never start their samba servers: a Deployment keeps the pods
+// of the previous revision, running the configuration they were started
+// with, until the new pods are ready.
+func (m *SmbShareManager) checkConfigStatus(
+	ctx context.Context, planner *sharePlanner, ns string) (bool, error) {
+	// ---
+	pods := &corev1.PodList{}
+	err := m.client.List(ctx, pods,
+		rtclient.InNamespace(ns),
+		rtclient.MatchingLabels{
+			svcSelectorKey: labelValue(planner.instanceName()),
+		})
+	if err != nil {
+		m.logger.Error(err, "Failed to list pods", "namespace", ns)
+		return false, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if failure := podConfigCheckFailure(pod); failure != "" {
+			msg := fmt.Sprintf(
+				"Pod %s: smb.conf check failed: %s", pod.Name, failure)
+			return false, m.setDegraded(
+				ctx, planner.SmbShare, ReasonInvalidSmbConf, msg)
+		}
+	}
+	return true, nil
+}
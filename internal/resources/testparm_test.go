@@ -0,0 +1,163 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+)
+
+func TestBuildPodSpecCheckConfig(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.UID = "1234"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.CustomConfig = &sambaoperatorv1alpha1.SmbCustomConfig{
+		ConfigMap: "my-smb-conf",
+	}
+	planner := testPlanner(share, common)
+	cfg := &conf.OperatorConfig{SmbdContainerName: "samba"}
+	podSpec := buildPodSpec(planner, cfg, "mypvc")
+	require.NotEmpty(t, podSpec.InitContainers)
+	check := podSpec.InitContainers[len(podSpec.InitContainers)-1]
+	assert.Equal(t, checkConfigContainerName, check.Name)
+	assert.Equal(t, planner.sambaImage(), check.Image)
+	assert.Equal(t,
+		corev1.TerminationMessageFallbackToLogsOnError,
+		check.TerminationMessagePolicy)
+	// the configuration is checked as the samba container sees it,
+	// including the custom smb.conf
+	smbd := podSpec.Containers[0]
+	assert.Equal(t, smbd.Env, check.Env)
+	assert.Equal(t, smbd.VolumeMounts, check.VolumeMounts)
+	paths := mountPaths(podSpec.InitContainers)[checkConfigContainerName]
+	assert.Equal(t, customConfigDir, paths[customConfigVolName])
+}
+
+func TestCheckConfigScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+	bin, err := ioutil.TempDir("", "checkconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(bin)
+	fake := func(name, script string) {
+		require.NoError(t, ioutil.WriteFile(
+			filepath.Join(bin, name), []byte("#!/bin/sh\n"+script), 0755))
+	}
+	run := func() (string, error) {
+		cmd := exec.Command("/bin/sh", "-c", checkConfigScript)
+		cmd.Env = []string{"PATH=" + bin + ":" + os.Getenv("PATH")}
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+	fake("samba-container", "printf '[global]\\n\\tbogus option = yes\\n'\n")
+
+	fake("testparm", "cat > /dev/null\necho 'Loaded services file OK.' >&2\n")
+	out, err := run()
+	assert.NoError(t, err, out)
+	assert.Empty(t, out)
+
+	// testparm ignores unknown parameters without failing
+	fake("testparm", `cat > /dev/null
+echo 'Unknown parameter encountered: "bogus option"' >&2
+echo 'Ignoring unknown parameter "bogus option"' >&2
+echo 'Loaded services file OK.' >&2
+`)
+	out, err = run()
+	assert.Error(t, err)
+	assert.Equal(t, `Unknown parameter encountered: "bogus option"
+Ignoring unknown parameter "bogus option"
+`, out)
+
+	fake("testparm", "cat > /dev/null\necho 'Error loading services.' >&2\nexit 1\n")
+	out, err = run()
+	assert.Error(t, err)
+	assert.Equal(t, "Error loading services.\n", out)
+}
+
+func TestCheckConfigStatus(t *testing.T) {
+	share := &sambaoperatorv1alpha1.SmbShare{}
+	share.Name = "myshare"
+	share.Namespace = "default"
+	common := &sambaoperatorv1alpha1.SmbCommonConfig{}
+	common.Spec.CustomConfig = &sambaoperatorv1alpha1.SmbCustomConfig{
+		ConfigMap: "my-smb-conf",
+	}
+	planner := testPlanner(share, common)
+	pod := func(name string, cs corev1.ContainerStatus) *corev1.Pod {
+		p := &corev1.Pod{}
+		p.Name = name
+		p.Namespace = "default"
+		p.Labels = labelsForSmbServer("myshare")
+		cs.Name = checkConfigContainerName
+		p.Status.InitContainerStatuses = []corev1.ContainerStatus{cs}
+		return p
+	}
+	// the pod of the previous revision passed its check and keeps serving
+	// the share
+	passed := pod("myshare-old", corev1.ContainerStatus{
+		State: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: 0},
+		},
+	})
+	ctx := context.TODO()
+	m, recorder := newTestManager(share, passed)
+	valid, err := m.checkConfigStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Empty(t, recorder.Events)
+
+	// the new pod never gets to start smbd with the invalid custom config
+	failed := pod("myshare-new", corev1.ContainerStatus{
+		State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+		},
+		LastTerminationState: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{
+				ExitCode: 1,
+				Message:  `Unknown parameter encountered: "bogus option"` + "\n",
+			},
+		},
+	})
+	m, recorder = newTestManager(share, passed, failed)
+	valid, err = m.checkConfigStatus(ctx, planner, "default")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, ReasonInvalidSmbConf)
+		assert.Contains(t, event,
+			`Pod myshare-new: smb.conf check failed: `+
+				`Unknown parameter encountered: "bogus option"`)
+	}
+	cond := findCondition(
+		share.Status.Conditions, sambaoperatorv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, corev1.ConditionTrue, cond.Status)
+		assert.Equal(t, ReasonInvalidSmbConf, cond.Reason)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+const (
+	// vfsObjectsMerge merges the VFS modules of the operator into the
+	// modules listed by the share.
+	vfsObjectsMerge = "merge"
+	// vfsObjectsOverride loads the VFS modules listed by the share only.
+	vfsObjectsOverride = "override"
+)
+
+// knownVfsModules are the VFS modules of samba that shares may list.
+var knownVfsModules = map[string]bool{
+	"acl_tdb":        true,
+	"acl_xattr":      true,
+	"aio_pthread":    true,
+	"audit":          true,
+	"btrfs":          true,
+	"catia":          true,
+	"ceph":           true,
+	"ceph_snapshots": true,
+	"commit":         true,
+	"crossrename":    true,
+	"default_quota":  true,
+	"dirsort":        true,
+	"expand_msdfs":   true,
+	"extd_audit":     true,
+	"fake_perms":     true,
+	"fileid":         true,
+	"fruit":          true,
+	"full_audit":     true,
+	"glusterfs":      true,
+	"glusterfs_fuse": true,
+	"io_uring":       true,
+	"linux_xfs_sgid": true,
+	"media_harmony":  true,
+	"offline":        true,
+	"preopen":        true,
+	"readahead":      true,
+	"readonly":       true,
+	"recycle":        true,
+	"shadow_copy":    true,
+	"shadow_copy2":   true,
+	"shell_snap":     true,
+	"snapper":        true,
+	"streams_depot":  true,
+	"streams_xattr":  true,
+	"syncops":        true,
+	"time_audit":     true,
+	"unityed_media":  true,
+	"virusfilter":    true,
+	"widelinks":      true,
+	"worm":           true,
+	"xattr_tdb":      true,
+}
+
+// vfsObjectsMode returns how the VFS modules listed by the share are
+// combined with those of the operator.
+func (sp *sharePlanner) vfsObjectsMode() string {
+	if sp.SmbShare.Spec.VfsObjectsMode == vfsObjectsOverride {
+		return vfsObjectsOverride
+	}
+	return vfsObjectsMerge
+}
+
+// backendVfsModule returns the VFS module of the share's storage backend,
+// or an empty string if the share uses a PVC.
+func (sp *sharePlanner) backendVfsModule() string {
+	return sp.backendOptions()[smbcc.VfsObjectsParam]
+}
+
+// managedVfsObjects returns the VFS modules the operator loads for the
+// settings of the share, not including the module of the storage backend.
+func (sp *sharePlanner) managedVfsObjects() []string {
+	vfs := []string{}
+	if sp.antivirus() != nil {
+		// virusfilter is stacked first, so that it scans the files before
+		// the modules below it open them.
+		vfs = append(vfs, "virusfilter")
+	}
+	if sp.windowsACLs() {
+		vfs = append(vfs, "acl_xattr")
+	}
+	if sp.macOSFruit() {
+		// fruit must be loaded before streams_xattr, which stores the
+		// streams of macOS clients.
+		vfs = append(vfs, "fruit", "streams_xattr")
+	}
+	return vfs
+}
+
+// vfsObjects returns the VFS modules of the share, in the order they are
+// stacked. The modules listed by the share keep their order, followed by
+// the managed modules they do not list. The VFS module of the storage
+// backend accesses the file system, so it comes last, below the modules
+// stacked on top of it.
+func (sp *sharePlanner) vfsObjects() []string {
+	listed := sp.SmbShare.Spec.VfsObjects
+	if sp.vfsObjectsMode() == vfsObjectsOverride && len(listed) > 0 {
+		return listed
+	}
+	vfs := []string{}
+	seen := map[string]bool{}
+	backend := sp.backendVfsModule()
+	add := func(names ...string) {
+		for _, n := range names {
+			if !seen[n] && n != backend {
+				seen[n] = true
+				vfs = append(vfs, n)
+			}
+		}
+	}
+	add(listed...)
+	add(sp.managedVfsObjects()...)
+	if backend != "" {
+		vfs = append(vfs, backend)
+	}
+	return vfs
+}
+
+// validateVfsObjects checks that the VFS modules listed by the share are
+// known, listed once, and that the module of the storage backend, if
+// listed, comes last. A list overriding the operator's modules must list
+// the module of the storage backend. If not, the Degraded condition is set
+// on the SmbShare and false is returned.
+func (m *SmbShareManager) validateVfsObjects(
+	ctx context.Context, planner *sharePlanner) (bool, error) {
+	// ---
+	degraded := func(msg string) (bool, error) {
+		return false, m.setDegraded(
+			ctx, planner.SmbShare, ReasonInvalidVfsObjects, msg)
+	}
+	listed := planner.SmbShare.Spec.VfsObjects
+	if planner.SmbShare.Spec.VfsObjectsMode == vfsObjectsOverride &&
+		len(listed) == 0 {
+		// ---
+		return degraded("vfsObjectsMode override requires vfsObjects")
+	}
+	seen := map[string]bool{}
+	for _, n := range listed {
+		if !knownVfsModules[n] {
+			return degraded(fmt.Sprintf("Unknown VFS module: %q", n))
+		}
+		if seen[n] {
+			return degraded(fmt.Sprintf(
+				"VFS module %s is listed more than once", n))
+		}
+		seen[n] = true
+	}
+	backend := planner.backendVfsModule()
+	if backend == "" {
+		return true, nil
+	}
+	if seen[backend] && listed[len(listed)-1] != backend {
+		return degraded(fmt.Sprintf(
+			"VFS module %s of the storage backend must be listed last",
+			backend))
+	}
+	if planner.vfsObjectsMode() == vfsObjectsOverride && !seen[backend] {
+		return degraded(fmt.Sprintf(
+			"vfsObjects must list the VFS module %s of the storage backend",
+			backend))
+	}
+	return true, nil
+}
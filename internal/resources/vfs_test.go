@@ -0,0 +1,101 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/smbcc"
+)
+
+func TestPlannerVfsObjects(t *testing.T) {
+	share := cephFSShare()
+	share.Spec.ACLs = &sambaoperatorv1alpha1.SmbShareACLSpec{Mode: "windows"}
+	share.Spec.MacOS = &sambaoperatorv1alpha1.SmbShareMacOSSpec{Fruit: true}
+	planner := testPlanner(share, nil)
+	vfs := func() string {
+		return planner.shareOptions()[smbcc.VfsObjectsParam]
+	}
+	assert.Equal(t, "acl_xattr fruit streams_xattr ceph", vfs())
+
+	// the listed modules come first, in their order, followed by the
+	// managed modules they do not list and the module of the backend
+	share.Spec.VfsObjects = []string{"full_audit", "fruit", "recycle", "acl_xattr"}
+	assert.Equal(t,
+		"full_audit fruit recycle acl_xattr streams_xattr ceph", vfs())
+	share.Spec.VfsObjects = []string{"shadow_copy2", "ceph"}
+	assert.Equal(t,
+		"shadow_copy2 acl_xattr fruit streams_xattr ceph", vfs())
+
+	// an overriding list is used as is
+	share.Spec.VfsObjectsMode = "override"
+	share.Spec.VfsObjects = []string{"recycle", "streams_xattr", "ceph"}
+	assert.Equal(t, "recycle streams_xattr ceph", vfs())
+
+	share.Spec.VfsObjects = nil
+	share.Spec.VfsObjectsMode = ""
+	share.Spec.Storage.Backend = ""
+	share.Spec.MacOS = nil
+	share.Spec.ACLs = nil
+	_, found := planner.shareOptions()[smbcc.VfsObjectsParam]
+	assert.False(t, found)
+}
+
+func TestValidateVfsObjects(t *testing.T) {
+	check := func(share *sambaoperatorv1alpha1.SmbShare, msg string) {
+		t.Helper()
+		m, recorder := newTestManager(share)
+		valid, err := m.validateVfsObjects(
+			context.TODO(), testPlanner(share, nil))
+		assert.NoError(t, err)
+		if msg == "" {
+			assert.True(t, valid)
+			assert.Len(t, recorder.Events, 0)
+			return
+		}
+		assert.False(t, valid)
+		if assert.Len(t, recorder.Events, 1) {
+			event := <-recorder.Events
+			assert.Contains(t, event, ReasonInvalidVfsObjects)
+			assert.Contains(t, event, msg)
+		}
+	}
+	share := cephFSShare()
+	check(share, "")
+	share.Spec.VfsObjects = []string{"recycle", "ceph"}
+	check(share, "")
+	share.Spec.VfsObjects = []string{"vfs_recycle"}
+	check(share, `Unknown VFS module: "vfs_recycle"`)
+	share.Spec.VfsObjects = []string{"recycle", "audit", "recycle"}
+	check(share, "VFS module recycle is listed more than once")
+	share.Spec.VfsObjects = []string{"ceph", "recycle"}
+	check(share, "VFS module ceph of the storage backend must be listed last")
+	share.Spec.VfsObjectsMode = "override"
+	share.Spec.VfsObjects = []string{"recycle"}
+	check(share, "vfsObjects must list the VFS module ceph of the storage backend")
+	share.Spec.VfsObjects = nil
+	check(share, "vfsObjectsMode override requires vfsObjects")
+
+	share = cephFSShare()
+	share.Spec.Storage.Backend = ""
+	share.Spec.VfsObjectsMode = "override"
+	share.Spec.VfsObjects = []string{"recycle"}
+	check(share, "")
+}
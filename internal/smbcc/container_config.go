@@ -61,8 +61,9 @@ type UserEntries []UserEntry
 
 // GroupEntry represents a single "local" group for share access.
 type GroupEntry struct {
-	Name string `json:"name"`
-	Gid  uint   `json:"gid,omitempty"`
+	Name    string   `json:"name"`
+	Gid     uint     `json:"gid,omitempty"`
+	Members []string `json:"members,omitempty"`
 }
 
 // GroupEntries is a slice of GroupEntry values.
@@ -76,6 +77,10 @@ const version0 = "v0"
 const (
 	// NoPrintingKey is used for the standard "noprinting" globals subsection.
 	NoPrintingKey = Key("noprinting")
+	// PrintingKey is used for the globals subsection enabling printing.
+	PrintingKey = Key("printing")
+	// PrintersKey is used for the share of the printers of the server.
+	PrintersKey = Key("printers")
 	// AllEntriesKey is used for the standard "all_entries" default key for
 	// users and groups.
 	AllEntriesKey = Key("all_entries")
@@ -84,6 +89,331 @@ const (
 	BrowseableParam = "browseable"
 	// ReadOnlyParam controls if a share is read only.
 	ReadOnlyParam = "read only"
+	// CommentParam sets the description of a share.
+	CommentParam = "comment"
+	// ValidUsersParam lists the users allowed to access a share.
+	ValidUsersParam = "valid users"
+	// InvalidUsersParam lists the users denied access to a share.
+	InvalidUsersParam = "invalid users"
+	// ReadListParam lists the users given read-only access to a share.
+	ReadListParam = "read list"
+	// WriteListParam lists the users given read-write access to a share.
+	WriteListParam = "write list"
+	// CreateMaskParam masks the permissions of new files.
+	CreateMaskParam = "create mask"
+	// DirectoryMaskParam masks the permissions of new directories.
+	DirectoryMaskParam = "directory mask"
+	// ForceCreateModeParam sets permission bits on new files.
+	ForceCreateModeParam = "force create mode"
+	// ForceDirectoryModeParam sets permission bits on new directories.
+	ForceDirectoryModeParam = "force directory mode"
+	// InheritOwnerParam makes new files owned by the owner of their parent.
+	InheritOwnerParam = "inherit owner"
+	// InheritPermissionsParam makes new files take the permissions of their
+	// parent.
+	InheritPermissionsParam = "inherit permissions"
+	// InheritACLsParam makes new files inherit the ACLs of their parent.
+	InheritACLsParam = "inherit acls"
+	// MapACLInheritParam maps windows ACL inheritance flags.
+	MapACLInheritParam = "map acl inherit"
+	// DosFilemodeParam lets users with write access to a file change its
+	// permissions.
+	DosFilemodeParam = "dos filemode"
+	// ACLGroupControlParam lets the members of the group owning a file
+	// change its ACL.
+	ACLGroupControlParam = "acl group control"
+	// VfsObjectsParam lists the VFS modules loaded for a share.
+	VfsObjectsParam = "vfs objects"
+	// ACLXattrIgnoreSystemACLsParam makes the acl_xattr module ignore the
+	// POSIX ACLs of the file system.
+	ACLXattrIgnoreSystemACLsParam = "acl_xattr:ignore system acls"
+	// RootPreexecParam is a command run as root when connecting to a share.
+	RootPreexecParam = "root preexec"
+	// KerberosMethodParam selects how samba verifies kerberos tickets.
+	KerberosMethodParam = "kerberos method"
+	// SmbPortsParam lists the TCP ports smbd listens on.
+	SmbPortsParam = "smb ports"
+	// MaxDiskSizeParam caps the size of a share reported to clients, in
+	// megabytes.
+	MaxDiskSizeParam = "max disk size"
+	// MaxConnectionsParam limits the number of concurrent connections to
+	// a share.
+	MaxConnectionsParam = "max connections"
+	// MaxSmbdProcessesParam limits the number of smbd processes of a
+	// server.
+	MaxSmbdProcessesParam = "max smbd processes"
+	// SmbdProfilingParam turns on the profiling counters of smbd.
+	SmbdProfilingParam = "smbd profiling"
+	// GuestOkParam allows clients to connect to a share as the guest
+	// user, without a password.
+	GuestOkParam = "guest ok"
+	// GuestOnlyParam makes all clients of a share use the guest user.
+	GuestOnlyParam = "guest only"
+	// HideUnreadableParam hides the files a client can not read.
+	HideUnreadableParam = "hide unreadable"
+	// MapToGuestParam selects which failed logins are mapped to the guest
+	// user.
+	MapToGuestParam = "map to guest"
+	// GuestAccountParam is the user guests are mapped to.
+	GuestAccountParam = "guest account"
+	// VetoFilesParam lists the file names that can not be seen or created.
+	VetoFilesParam = "veto files"
+	// HideFilesParam lists the file names hidden from clients.
+	HideFilesParam = "hide files"
+	// HostsAllowParam lists the clients allowed to connect to a share.
+	HostsAllowParam = "hosts allow"
+	// HostsDenyParam lists the clients refused by a share.
+	HostsDenyParam = "hosts deny"
+	// SMBEncryptParam selects if the connections to a share are
+	// encrypted.
+	SMBEncryptParam = "smb encrypt"
+	// DeleteVetoFilesParam allows deleting directories holding only
+	// vetoed files.
+	DeleteVetoFilesParam = "delete veto files"
+	// DeleteReadonlyParam allows deleting files with the read-only
+	// attribute.
+	DeleteReadonlyParam = "delete readonly"
+	// ACLCheckPermissionsParam controls if the access control list of a
+	// file is checked before it is opened for deletion.
+	ACLCheckPermissionsParam = "acl check permissions"
+	// ForceUnknownACLUserParam maps the unknown users and groups of the
+	// access control lists clients set to the connected user and its
+	// primary group.
+	ForceUnknownACLUserParam = "force unknown acl user"
+	// CaseSensitiveParam controls if file names are matched with regard
+	// to case.
+	CaseSensitiveParam = "case sensitive"
+	// PreserveCaseParam controls if new file names keep their case.
+	PreserveCaseParam = "preserve case"
+	// ShortPreserveCaseParam controls if new 8.3 file names keep their
+	// case.
+	ShortPreserveCaseParam = "short preserve case"
+	// MangledNamesParam selects the file names shown to clients as
+	// mangled 8.3 names.
+	MangledNamesParam = "mangled names"
+	// StoreDosAttributesParam stores the DOS attributes of files in
+	// extended attributes.
+	StoreDosAttributesParam = "store dos attributes"
+	// MapArchiveParam maps the archive attribute to the owner execute
+	// bit.
+	MapArchiveParam = "map archive"
+	// MapHiddenParam maps the hidden attribute to the other execute bit.
+	MapHiddenParam = "map hidden"
+	// MapSystemParam maps the system attribute to the group execute bit.
+	MapSystemParam = "map system"
+	// MapReadonlyParam selects how the read-only attribute is mapped to
+	// the permissions of a file.
+	MapReadonlyParam = "map readonly"
+	// EaSupportParam lets clients set extended attributes of files.
+	EaSupportParam = "ea support"
+	// SpotlightParam enables Spotlight searches of a share by macOS
+	// clients.
+	SpotlightParam = "spotlight"
+	// SpotlightBackendParam selects the index Spotlight searches are
+	// answered from.
+	SpotlightBackendParam = "spotlight backend"
+	// ElasticsearchAddressParam is the address of the Elasticsearch
+	// server of the elasticsearch Spotlight backend.
+	ElasticsearchAddressParam = "elasticsearch:address"
+	// ElasticsearchPortParam is the port of the Elasticsearch server.
+	ElasticsearchPortParam = "elasticsearch:port"
+	// ElasticsearchIndexParam is the Elasticsearch index of a share.
+	ElasticsearchIndexParam = "elasticsearch:index"
+	// FollowSymlinksParam controls if symbolic links may be followed.
+	FollowSymlinksParam = "follow symlinks"
+	// WideLinksParam allows following symbolic links out of a share.
+	WideLinksParam = "wide links"
+	// AllowInsecureWideLinksParam allows wide links even though clients
+	// may create symbolic links with the unix extensions.
+	AllowInsecureWideLinksParam = "allow insecure wide links"
+	// WinbindUseDefaultDomainParam lets the users and groups of the
+	// domain be named without the domain.
+	WinbindUseDefaultDomainParam = "winbind use default domain"
+	// WinbindNSSInfoParam selects where winbind gets the unix attributes,
+	// such as the primary group, of the domain users.
+	WinbindNSSInfoParam = "winbind nss info"
+	// AllowTrustedDomainsParam lets the users of trusted domains access
+	// the shares of a domain member.
+	AllowTrustedDomainsParam = "allow trusted domains"
+	// WinbindScanTrustedDomainsParam has winbind enumerate the domains
+	// trusted by the domain of the member.
+	WinbindScanTrustedDomainsParam = "winbind scan trusted domains"
+	// WinbindRequestTimeoutParam is the number of seconds winbind waits
+	// for the requests of a client.
+	WinbindRequestTimeoutParam = "winbind request timeout"
+	// WinbindMaxClientsParam is the number of clients winbind serves at
+	// once.
+	WinbindMaxClientsParam = "winbind max clients"
+	// WinbindMaxDomainConnectionsParam is the number of connections
+	// winbind opens to the domain controllers of a domain.
+	WinbindMaxDomainConnectionsParam = "winbind max domain connections"
+	// ServerMultiChannelSupportParam turns on SMB3 multichannel.
+	ServerMultiChannelSupportParam = "server multi channel support"
+	// SMB3UnixExtensionsParam advertises the SMB3 POSIX extensions to
+	// clients.
+	SMB3UnixExtensionsParam = "smb3 unix extensions"
+	// HostMSDFSParam turns on DFS support of the samba server.
+	HostMSDFSParam = "host msdfs"
+	// MSDFSRootParam makes a share the root of a DFS namespace.
+	MSDFSRootParam = "msdfs root"
+	// OplocksParam lets clients cache files locally.
+	OplocksParam = "oplocks"
+	// KernelOplocksParam breaks oplocks when other processes access
+	// files.
+	KernelOplocksParam = "kernel oplocks"
+	// Level2OplocksParam lets several clients cache files they read.
+	Level2OplocksParam = "level2 oplocks"
+	// SMB2LeasesParam lets SMB2 clients cache files with leases.
+	SMB2LeasesParam = "smb2 leases"
+	// InterfacesParam lists the network interfaces samba listens on.
+	InterfacesParam = "interfaces"
+	// BindInterfacesOnlyParam makes samba listen only on the listed
+	// interfaces.
+	BindInterfacesOnlyParam = "bind interfaces only"
+	// ForceUserParam names the user files of a share are accessed as.
+	ForceUserParam = "force user"
+	// ForceGroupParam names the primary group files of a share are
+	// accessed as.
+	ForceGroupParam = "force group"
+	// NTLMAuthParam selects the NTLM protocols clients may authenticate
+	// with.
+	NTLMAuthParam = "ntlm auth"
+	// LanmanAuthParam allows clients to authenticate with LANMAN.
+	LanmanAuthParam = "lanman auth"
+	// RawNTLMv2AuthParam allows NTLMv2 authentication without NTLMSSP.
+	RawNTLMv2AuthParam = "raw NTLMv2 auth"
+	// ClientNTLMv2AuthParam makes samba use NTLMv2 when authenticating to
+	// other servers.
+	ClientNTLMv2AuthParam = "client ntlmv2 auth"
+	// ClientLanmanAuthParam allows samba to use LANMAN when authenticating
+	// to other servers.
+	ClientLanmanAuthParam = "client lanman auth"
+	// ClientPlaintextAuthParam allows samba to send plaintext passwords
+	// to other servers.
+	ClientPlaintextAuthParam = "client plaintext auth"
+	// ClientSigningParam selects if samba signs its client connections.
+	ClientSigningParam = "client signing"
+	// ClientSMBEncryptParam selects if samba encrypts its client
+	// connections.
+	ClientSMBEncryptParam = "client smb encrypt"
+	// ClientMaxProtocolParam is the highest protocol version of samba's
+	// client connections.
+	ClientMaxProtocolParam = "client max protocol"
+	// ClientIPCMaxProtocolParam is the highest protocol version of samba's
+	// IPC client connections.
+	ClientIPCMaxProtocolParam = "client ipc max protocol"
+	// IncludeParam includes the parameters of another file.
+	IncludeParam = "include"
+	// DedicatedKeytabFileParam names the keytab used by the dedicated
+	// keytab kerberos method.
+	DedicatedKeytabFileParam = "dedicated keytab file"
+	// CreateKrb5ConfParam makes samba generate the krb5.conf of the
+	// domain it is a member of.
+	CreateKrb5ConfParam = "create krb5 conf"
+	// PanicActionParam is a command run when a samba process panics.
+	PanicActionParam = "panic action"
+	// ServerStringParam is the description of a server shown to clients.
+	ServerStringParam = "server string"
+	// WorkgroupParam is the workgroup, or NetBIOS domain, of a server.
+	WorkgroupParam = "workgroup"
+	// AioReadSizeParam is the size from which reads are asynchronous.
+	AioReadSizeParam = "aio read size"
+	// AioWriteSizeParam is the size from which writes are asynchronous.
+	AioWriteSizeParam = "aio write size"
+	// AioMaxThreadsParam limits the threads serving asynchronous I/O.
+	AioMaxThreadsParam = "aio max threads"
+	// UseSendfileParam lets the kernel send file data to clients.
+	UseSendfileParam = "use sendfile"
+	// ReadRawParam allows the raw reads of SMB1 clients.
+	ReadRawParam = "read raw"
+	// WriteRawParam allows the raw writes of SMB1 clients.
+	WriteRawParam = "write raw"
+	// SMB2MaxReadParam is the largest read of SMB2 clients.
+	SMB2MaxReadParam = "smb2 max read"
+	// SMB2MaxWriteParam is the largest write of SMB2 clients.
+	SMB2MaxWriteParam = "smb2 max write"
+	// MinReceivefileSizeParam is the size from which written data is
+	// received without copies.
+	MinReceivefileSizeParam = "min receivefile size"
+	// AioWriteBehindParam lists the files whose writes are acknowledged
+	// before they are made.
+	AioWriteBehindParam = "aio write behind"
+	// DeadtimeParam is the number of minutes after which idle sessions are
+	// closed.
+	DeadtimeParam = "deadtime"
+	// KeepaliveParam is the number of seconds between client checks.
+	KeepaliveParam = "keepalive"
+	// SocketOptionsParam lists the options set on client connections.
+	SocketOptionsParam = "socket options"
+	// SMB2MaxCreditsParam is the number of credits granted to SMB2 clients.
+	SMB2MaxCreditsParam = "smb2 max credits"
+	// KernelShareModesParam makes samba take kernel share mode locks. They
+	// are not supported by the ceph and glusterfs VFS modules.
+	KernelShareModesParam = "kernel share modes"
+	// DurableHandlesParam lets clients reopen files after disconnecting.
+	DurableHandlesParam = "durable handles"
+	// PosixLockingParam maps the locks of clients to POSIX locks.
+	PosixLockingParam = "posix locking"
+	// ContinuouslyAvailableParam keeps the handles of clients across the
+	// failover of a clustered share.
+	ContinuouslyAvailableParam = "continuously available"
+	// StrictSyncParam makes samba flush files to disk when clients ask it
+	// to.
+	StrictSyncParam = "strict sync"
+	// SyncAlwaysParam makes samba flush every write to disk before
+	// replying.
+	SyncAlwaysParam = "sync always"
+	// LogFileParam is the file samba writes its logs to.
+	LogFileParam = "log file"
+	// MaxLogSizeParam is the size, in kilobytes, at which log files are
+	// rotated.
+	MaxLogSizeParam = "max log size"
+	// PassdbBackendParam selects where the accounts of the users are stored.
+	PassdbBackendParam = "passdb backend"
+	// LDAPSuffixParam is the base DN of the samba entries of an LDAP passdb.
+	LDAPSuffixParam = "ldap suffix"
+	// LDAPUserSuffixParam is the DN below which the users are stored.
+	LDAPUserSuffixParam = "ldap user suffix"
+	// LDAPGroupSuffixParam is the DN below which the groups are stored.
+	LDAPGroupSuffixParam = "ldap group suffix"
+	// LDAPAdminDNParam is the DN samba binds to the LDAP server as.
+	LDAPAdminDNParam = "ldap admin dn"
+	// LDAPSSLParam selects if samba uses StartTLS to connect to LDAP.
+	LDAPSSLParam = "ldap ssl"
+	// CephConfigFileParam is the ceph.conf used by the ceph VFS module.
+	CephConfigFileParam = "ceph:config_file"
+	// CephUserIDParam is the ceph user of the ceph VFS module.
+	CephUserIDParam = "ceph:user_id"
+	// CephFileSystemParam names the file system of the ceph VFS module.
+	CephFileSystemParam = "ceph:filesystem"
+	// GlusterFSVolumeParam names the volume of the glusterfs VFS module.
+	GlusterFSVolumeParam = "glusterfs:volume"
+	// GlusterFSVolfileServerParam lists the servers the glusterfs VFS
+	// module fetches the volume file from.
+	GlusterFSVolfileServerParam = "glusterfs:volfile_server"
+	// VirusFilterScannerParam selects the virus scanner of the
+	// virusfilter VFS module.
+	VirusFilterScannerParam = "virusfilter:scanner"
+	// VirusFilterSocketPathParam is the path of the socket of the virus
+	// scanner.
+	VirusFilterSocketPathParam = "virusfilter:socket path"
+	// VirusFilterScanOnOpenParam scans files when they are opened.
+	VirusFilterScanOnOpenParam = "virusfilter:scan on open"
+	// VirusFilterScanOnCloseParam scans files when they are closed after
+	// being written to.
+	VirusFilterScanOnCloseParam = "virusfilter:scan on close"
+	// VirusFilterInfectedFileActionParam is what is done with infected
+	// files.
+	VirusFilterInfectedFileActionParam = "virusfilter:infected file action"
+	// VirusFilterInfectedFileCommandParam is a command run for each
+	// infected file found.
+	VirusFilterInfectedFileCommandParam = "virusfilter:infected file command"
+	// VirusFilterQuarantineDirectoryParam is the directory infected files
+	// are moved to.
+	VirusFilterQuarantineDirectoryParam = "virusfilter:quarantine directory"
+	// VirusFilterBlockAccessOnErrorParam denies access to the files that
+	// could not be scanned.
+	VirusFilterBlockAccessOnErrorParam = "virusfilter:block access on error"
 
 	// Yes means yes.
 	Yes = "yes"
@@ -113,6 +443,31 @@ func NewNoPrintingGlobals() GlobalConfig {
 	}
 }
 
+// NewPrintingGlobals returns a GlobalConfig that shares the printers of a
+// CUPS server.
+func NewPrintingGlobals() GlobalConfig {
+	return GlobalConfig{
+		Options: SmbOptions{
+			"load printers":   Yes,
+			"printing":        "cups",
+			"printcap name":   "cups",
+			"disable spoolss": No,
+		},
+	}
+}
+
+// NewPrintersShare returns a ShareConfig for the [printers] share, which
+// spools the print jobs of the clients.
+func NewPrintersShare() ShareConfig {
+	return ShareConfig{
+		Options: SmbOptions{
+			"path":       "/var/tmp",
+			"printable":  Yes,
+			"browseable": No,
+		},
+	}
+}
+
 // NewSimpleShare returns a ShareConfig with a simple configuration.
 func NewSimpleShare(path string) ShareConfig {
 	return ShareConfig{
@@ -0,0 +1,73 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smbcc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NetbiosNameParam is the name of the server, set from the instance name
+// of a configuration.
+const NetbiosNameParam = "netbios name"
+
+// SmbConf renders the configuration selected by key in the smb.conf
+// format, as it is loaded by the samba containers. The global sections of
+// the configuration are merged in order, later sections overriding earlier
+// ones. Parameters are sorted by name so that the output is stable.
+func (scc *SambaContainerConfig) SmbConf(key Key) (string, error) {
+	cfg, found := scc.Configs[key]
+	if !found {
+		return "", fmt.Errorf("no configuration named %q", key)
+	}
+	globals := SmbOptions{}
+	if cfg.InstanceName != "" {
+		globals[NetbiosNameParam] = cfg.InstanceName
+	}
+	for _, gkey := range cfg.Globals {
+		g, found := scc.Globals[gkey]
+		if !found {
+			return "", fmt.Errorf("no globals named %q", gkey)
+		}
+		for k, v := range g.Options {
+			globals[k] = v
+		}
+	}
+	b := &strings.Builder{}
+	writeSection(b, "global", globals)
+	for _, skey := range cfg.Shares {
+		s, found := scc.Shares[skey]
+		if !found {
+			return "", fmt.Errorf("no share named %q", skey)
+		}
+		b.WriteString("\n")
+		writeSection(b, string(skey), s.Options)
+	}
+	return b.String(), nil
+}
+
+func writeSection(b *strings.Builder, name string, opts SmbOptions) {
+	params := make([]string, 0, len(opts))
+	for k := range opts {
+		params = append(params, k)
+	}
+	sort.Strings(params)
+	fmt.Fprintf(b, "[%s]\n", name)
+	for _, k := range params {
+		fmt.Fprintf(b, "\t%s = %s\n", k, opts[k])
+	}
+}
@@ -0,0 +1,52 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smbcc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSmbConf(t *testing.T) {
+	scc := New()
+	err := json.Unmarshal([]byte(json1), scc)
+	require.NoError(t, err)
+	conf, err := scc.SmbConf("wbtest")
+	require.NoError(t, err)
+	require.Equal(t, `[global]
+	disable spoolss = yes
+	idmap config * : backend = autorid
+	idmap config * : range = 2000-9999999
+	load printers = no
+	log level = 10
+	netbios name = WB1
+	printcap name = /dev/null
+	printing = bsd
+	realm = FOOBAR.EXAMPLE.ORG
+	security = ads
+	server min protocol = SMB2
+	workgroup = FOOBAR
+
+[share]
+	path = /share
+	read only = no
+`, conf)
+
+	_, err = scc.SmbConf("missing")
+	require.Error(t, err)
+}
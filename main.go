@@ -17,19 +17,36 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	flag "github.com/spf13/pflag"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	sambaoperatorv1beta1 "github.com/samba-in-kubernetes/samba-operator/api/v1beta1"
 	"github.com/samba-in-kubernetes/samba-operator/controllers"
+	"github.com/samba-in-kubernetes/samba-operator/internal/certs"
 	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/health"
+	"github.com/samba-in-kubernetes/samba-operator/internal/leader"
+	"github.com/samba-in-kubernetes/samba-operator/internal/logging"
+	"github.com/samba-in-kubernetes/samba-operator/internal/resources"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -47,18 +64,112 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(sambaoperatorv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(sambaoperatorv1beta1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == renderCommand {
+		if err := runRender(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", renderCommand, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == statusCommand {
+		if err := runStatus(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", statusCommand, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == exportCommand {
+		if err := runExport(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", exportCommand, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == rbacCommand {
+		if err := runRBAC(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", rbacCommand, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	confSource := conf.NewSource()
 	var metricsAddr string
+	var metricsTLS bool
+	var certConfig certs.Config
+	var probeAddr string
 	var enableLeaderElection bool
+	var election leader.Config
+	var maxConcurrentReconciles int
+	var retryBaseDelay, retryMaxDelay time.Duration
+	var watchNamespaces []string
+	var logFormat string
 	flag.StringVar(
 		&metricsAddr,
 		"metrics-addr",
 		":8080",
 		"The address the metric endpoint binds to.")
+	flag.BoolVar(
+		&metricsTLS,
+		"metrics-tls",
+		false,
+		"Serve the metric endpoint over TLS, with the certificate "+
+			"of the webhook server.")
+	flag.StringVar(
+		&certConfig.Source,
+		"cert-source",
+		certs.SourceFiles,
+		"Where the TLS certificate of the webhook server is read from: "+
+			"files of the certificate directory, a secret or a "+
+			"cert-manager Certificate.")
+	flag.StringVar(
+		&certConfig.Dir,
+		"cert-dir",
+		filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs"),
+		"The directory of the tls.crt and tls.key files of the "+
+			"webhook server.")
+	flag.StringVar(
+		&certConfig.Namespace,
+		"cert-namespace",
+		"",
+		"The namespace of the certificate Secret and Certificate. "+
+			"Defaults to the working namespace.")
+	flag.StringVar(
+		&certConfig.SecretName,
+		"cert-secret",
+		"",
+		"The name of the Secret holding the certificate, and of the "+
+			"Certificate issuing it with cert-manager.")
+	flag.StringVar(
+		&certConfig.Issuer,
+		"cert-issuer",
+		"",
+		"The name of the cert-manager issuer of the Certificate.")
+	flag.StringVar(
+		&certConfig.IssuerKind,
+		"cert-issuer-kind",
+		certs.DefaultIssuerKind,
+		"The kind of the cert-manager issuer: Issuer or ClusterIssuer.")
+	flag.StringSliceVar(
+		&certConfig.DNSNames,
+		"cert-dns-names",
+		nil,
+		"The DNS names of the Certificate, comma separated.")
+	flag.DurationVar(
+		&certConfig.RefreshInterval,
+		"cert-refresh-interval",
+		certs.DefaultRefreshInterval,
+		"The time between checks for a rotated certificate.")
+	flag.StringVar(
+		&probeAddr,
+		"health-probe-addr",
+		":8081",
+		"The address the liveness and readiness endpoints bind to.")
 	flag.BoolVar(
 		&enableLeaderElection,
 		"enable-leader-election",
@@ -66,10 +177,67 @@ func main() {
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active "+
 			"controller manager.")
+	flag.StringVar(
+		&election.Namespace,
+		"leader-election-namespace",
+		"",
+		"The namespace of the leader election Lease. "+
+			"Defaults to the working namespace.")
+	flag.DurationVar(
+		&election.LeaseDuration,
+		"leader-election-lease-duration",
+		15*time.Second,
+		"The time other candidates wait before taking over the "+
+			"leadership of a leader that stopped renewing its Lease.")
+	flag.DurationVar(
+		&election.RenewDeadline,
+		"leader-election-renew-deadline",
+		10*time.Second,
+		"The time the leader retries renewing its Lease before it "+
+			"gives up leadership.")
+	flag.DurationVar(
+		&election.RetryPeriod,
+		"leader-election-retry-period",
+		2*time.Second,
+		"The time candidates wait between attempts to acquire or "+
+			"renew the Lease.")
+	flag.StringSliceVar(
+		&watchNamespaces,
+		"watch-namespace",
+		nil,
+		"The namespaces to watch for resources, comma separated. "+
+			"All namespaces are watched if unset.")
+	flag.IntVar(
+		&maxConcurrentReconciles,
+		"max-concurrent-reconciles",
+		1,
+		"The number of SmbShares that may be reconciled at the same time.")
+	flag.DurationVar(
+		&retryBaseDelay,
+		"reconcile-retry-base-delay",
+		controllers.DefaultRetryBaseDelay,
+		"The delay before a SmbShare is reconciled again after a "+
+			"failure. The delay doubles with each further failure.")
+	flag.DurationVar(
+		&retryMaxDelay,
+		"reconcile-retry-max-delay",
+		controllers.DefaultRetryMaxDelay,
+		"The maximum delay before a SmbShare is reconciled again "+
+			"after repeated failures.")
+	flag.StringVar(
+		&logFormat,
+		"log-format",
+		logging.FormatConsole,
+		"The format of the log lines: json or console.")
 	flag.CommandLine.AddFlagSet(confSource.Flags())
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	logger, err := logging.New(logFormat, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	ctrl.SetLogger(logger)
 
 	if err := conf.Load(confSource); err != nil {
 		setupLog.Error(err, "unable to configure")
@@ -79,23 +247,77 @@ func main() {
 		setupLog.Error(err, "invalid configuration")
 		os.Exit(1)
 	}
+	if certConfig.Namespace == "" {
+		certConfig.Namespace = conf.Get().WorkingNamespace
+	}
+	if err := certConfig.Validate(); err != nil {
+		setupLog.Error(err, "invalid certificate configuration")
+		os.Exit(1)
+	}
+	enableWebhooks := os.Getenv("ENABLE_WEBHOOKS") != "false"
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	// leader election is done by the leader package, using a Lease,
+	// rather than by the manager.
+	restConfig := ctrl.GetConfigOrDie()
+	mgrOptions := ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		Port:               9443,
-		LeaderElection:     enableLeaderElection,
-		LeaderElectionID:   "b60bd080.samba.org",
-	})
+		CertDir:            certConfig.Dir,
+	}
+	if metricsTLS {
+		// the metrics are served by setupCerts instead.
+		mgrOptions.MetricsBindAddress = "0"
+	}
+	namespaces := controllers.WatchedNamespaces(
+		watchNamespaces, conf.Get().WorkingNamespace)
+	if len(namespaces) == 0 {
+		setupLog.Info("watching all namespaces")
+	} else {
+		setupLog.Info("watching namespaces", "namespaces", namespaces)
+		controllers.NamespacedCacheOptions(&mgrOptions, namespaces)
+	}
+	mgr, err := ctrl.NewManager(restConfig, mgrOptions)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+
+	caps, err := resources.DetectCapabilities(clientset.Discovery())
+	if err != nil {
+		// optional APIs are assumed to be missing
+		setupLog.Error(err, "unable to detect optional APIs")
+	}
+	setupLog.Info("detected optional APIs",
+		"routes", caps.Routes,
+		"ipFamilyPolicy", caps.IPFamilyPolicy,
+		"serverSideApply", caps.ServerSideApply,
+		"serviceMonitors", caps.ServiceMonitors)
+
 	if err = (&controllers.SmbShareReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("SmbShare"),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("SmbShare"),
+		Scheme:                  mgr.GetScheme(),
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		RateLimiter: controllers.NewRateLimiter(
+			retryBaseDelay, retryMaxDelay),
+		VolumeUsage: resources.NewKubeletVolumeUsage(clientset),
+		Connections: resources.NewSmbstatusConnections(clientset, mgr.GetConfig()),
+		Profiles:    resources.NewSmbstatusProfiles(clientset, mgr.GetConfig()),
+		InfectedFiles: resources.NewPodInfectedFiles(
+			clientset, mgr.GetConfig()),
+		Health:       resources.NewSMBHealthProber(),
+		Groups:       resources.NewWbinfoGroups(clientset, mgr.GetConfig()),
+		Joins:        resources.NewLDAPJoinChecker(),
+		Capabilities: caps,
+		EventReader:  mgr.GetAPIReader(),
+		Reloader:     resources.NewSmbcontrolReloader(clientset, mgr.GetConfig()),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(
 			err,
@@ -125,13 +347,123 @@ func main() {
 			"controller", "SmbCommonConfig")
 		os.Exit(1)
 	}
+	if enableWebhooks {
+		// the webhooks convert between the API versions of the
+		// resources, the operator itself only uses v1alpha1.
+		for _, obj := range []runtime.Object{
+			&sambaoperatorv1beta1.SmbShare{},
+			&sambaoperatorv1beta1.SmbSecurityConfig{},
+			&sambaoperatorv1beta1.SmbCommonConfig{},
+			&sambaoperatorv1beta1.SmbUser{},
+		} {
+			err = ctrl.NewWebhookManagedBy(mgr).For(obj).Complete()
+			if err != nil {
+				setupLog.Error(err, "unable to create webhook")
+				os.Exit(1)
+			}
+		}
+		// shares naming a share already served by their server group are
+		// rejected, rather than silently replacing the other share.
+		mgr.GetWebhookServer().Register(
+			resources.ShareValidatorPath,
+			&webhook.Admission{
+				Handler: resources.NewShareValidator(mgr.GetClient()),
+			})
+	}
 	// +kubebuilder:scaffold:builder
 
+	if certConfig.Source != certs.SourceFiles || metricsTLS {
+		err = setupCerts(
+			mgr, restConfig, clientset, certConfig, metricsTLS, metricsAddr)
+		if err != nil {
+			setupLog.Error(err, "unable to set up TLS certificates")
+			os.Exit(1)
+		}
+	}
+
+	// the probes are served outside of the manager, so that replicas
+	// waiting to be elected leader are live but not ready.
+	cacheSync := health.NewCacheSync(mgr.GetCache())
+	if err = mgr.Add(cacheSync); err != nil {
+		setupLog.Error(err, "unable to add cache sync check")
+		os.Exit(1)
+	}
+	probes := health.NewProbes()
+	probes.AddReadyzCheck("cache", cacheSync.Check)
+
 	setupLog.Info("starting manager",
 		"Version", Version,
 		"CommitID", CommitID)
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	stop := ctrl.SetupSignalHandler()
+	go func() {
+		if err := probes.Serve(stop, probeAddr); err != nil {
+			setupLog.Error(err, "problem serving health probes")
+			os.Exit(1)
+		}
+	}()
+	if !enableLeaderElection {
+		err = mgr.Start(stop)
+	} else {
+		err = runAsLeader(stop, restConfig, election, mgr.Start)
+	}
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// setupCerts loads the TLS certificate of the webhook server before the
+// manager starts it and adds the refresh of the certificate, so that a
+// rotated certificate is reloaded, and the metric endpoint served over TLS
+// if enabled, to the manager.
+func setupCerts(
+	mgr manager.Manager,
+	restConfig *rest.Config,
+	clientset kubernetes.Interface,
+	cfg certs.Config,
+	metricsTLS bool,
+	metricsAddr string) error {
+	// ---
+	dyn, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	store := certs.NewStore(cfg, clientset, dyn, ctrl.Log.WithName("certs"))
+	if err := store.Setup(context.Background()); err != nil {
+		return err
+	}
+	if err := mgr.Add(store); err != nil {
+		return err
+	}
+	if !metricsTLS || metricsAddr == "0" {
+		return nil
+	}
+	// the metrics are served at the path the manager serves them at.
+	mux := http.NewServeMux()
+	mux.Handle("/metrics",
+		promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+	return mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		return store.ServeTLS(stop, metricsAddr, mux)
+	}))
+}
+
+// runAsLeader runs start only while this process is the elected leader
+// of the operator replicas.
+func runAsLeader(
+	stop <-chan struct{},
+	restConfig *rest.Config,
+	election leader.Config,
+	start func(<-chan struct{}) error) error {
+	// ---
+	client, err := kubernetes.NewForConfig(
+		rest.AddUserAgent(restConfig, "leader-election"))
+	if err != nil {
+		return err
+	}
+	election.Name = "b60bd080.samba.org"
+	if election.Namespace == "" {
+		election.Namespace = conf.Get().WorkingNamespace
+	}
+	return leader.Run(
+		stop, client, election, ctrl.Log.WithName("leader"), start)
+}
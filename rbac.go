@@ -0,0 +1,88 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	flag "github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+
+	"github.com/samba-in-kubernetes/samba-operator/controllers"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+)
+
+// rbacCommand is the name of the subcommand generating the RBAC resources
+// of an operator watching some namespaces.
+const rbacCommand = "rbac"
+
+// runRBAC writes the Roles and RoleBindings an operator watching the
+// namespaces named on the command line needs, along with the ClusterRole
+// and ClusterRoleBinding of the cluster scoped resources it reads, to out.
+// Nothing is read from, or written to, the cluster.
+func runRBAC(args []string, out io.Writer) error {
+	fset := flag.NewFlagSet(rbacCommand, flag.ContinueOnError)
+	cfg := controllers.RBACConfig{}
+	fset.StringSliceVar(
+		&cfg.Namespaces,
+		"watch-namespace",
+		nil,
+		"The namespaces the operator watches, comma separated.")
+	fset.StringVar(
+		&cfg.Name,
+		"name",
+		"samba-operator-manager",
+		"The name of the generated roles and bindings.")
+	fset.StringVar(
+		&cfg.ServiceAccount,
+		"service-account",
+		"default",
+		"The name of the ServiceAccount the operator runs as.")
+	fset.StringVar(
+		&cfg.ServiceAccountNamespace,
+		"service-account-namespace",
+		"",
+		"The namespace of the ServiceAccount. "+
+			"Defaults to the working namespace.")
+	confSource := conf.NewSource()
+	fset.AddFlagSet(confSource.Flags())
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if err := conf.Load(confSource); err != nil {
+		return err
+	}
+	cfg.WorkingNamespace = conf.Get().WorkingNamespace
+	if cfg.WorkingNamespace == "" {
+		cfg.WorkingNamespace = defaultWorkingNamespace
+	}
+	if cfg.ServiceAccountNamespace == "" {
+		cfg.ServiceAccountNamespace = cfg.WorkingNamespace
+	}
+	if len(controllers.WatchedNamespaces(cfg.Namespaces, cfg.WorkingNamespace)) == 0 {
+		return fmt.Errorf("no namespaces given, use --watch-namespace")
+	}
+	for _, obj := range controllers.NamespacedRBAC(cfg) {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "---\n%s", data)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+	"sigs.k8s.io/yaml"
+
+	sambaoperatorv1alpha1 "github.com/samba-in-kubernetes/samba-operator/api/v1alpha1"
+	"github.com/samba-in-kubernetes/samba-operator/internal/conf"
+	"github.com/samba-in-kubernetes/samba-operator/internal/resources"
+)
+
+// renderCommand is the name of the subcommand previewing the configuration
+// and resources generated for shares.
+const renderCommand = "render"
+
+// defaultWorkingNamespace is the working namespace the subcommands assume,
+// unless one is configured.
+const defaultWorkingNamespace = "samba-operator-system"
+
+// renderInput holds the resources read from the files given to the render
+// subcommand.
+type renderInput struct {
+	shares   []*sambaoperatorv1alpha1.SmbShare
+	security map[string]*sambaoperatorv1alpha1.SmbSecurityConfig
+	common   map[string]*sambaoperatorv1alpha1.SmbCommonConfig
+}
+
+// runRender renders the SmbShares found in the files named on the command
+// line, along with the SmbSecurityConfigs and SmbCommonConfigs they refer
+// to, and writes the results to out. Nothing is read from, or written to,
+// the cluster.
+func runRender(args []string, out io.Writer) error {
+	fset := flag.NewFlagSet(renderCommand, flag.ContinueOnError)
+	var files []string
+	var smbConfOnly bool
+	fset.StringSliceVarP(
+		&files,
+		"filename",
+		"f",
+		nil,
+		"Files holding the SmbShares to render, and the SmbSecurityConfigs "+
+			"and SmbCommonConfigs they refer to. Use - for stdin.")
+	fset.BoolVar(
+		&smbConfOnly,
+		"smb-conf",
+		false,
+		"Only write the smb.conf of each share, not its resources.")
+	confSource := conf.NewSource()
+	fset.AddFlagSet(confSource.Flags())
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files given, use --filename")
+	}
+	if err := conf.Load(confSource); err != nil {
+		return err
+	}
+	cfg := *conf.Get()
+	if cfg.WorkingNamespace == "" {
+		cfg.WorkingNamespace = defaultWorkingNamespace
+	}
+
+	input := &renderInput{
+		security: map[string]*sambaoperatorv1alpha1.SmbSecurityConfig{},
+		common:   map[string]*sambaoperatorv1alpha1.SmbCommonConfig{},
+	}
+	for _, name := range files {
+		if err := input.readFile(name); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if len(input.shares) == 0 {
+		return fmt.Errorf("no SmbShares found")
+	}
+
+	for _, s := range input.shares {
+		ic, err := input.instanceConfiguration(s)
+		if err != nil {
+			return err
+		}
+		rendered, err := resources.Render(&cfg, ic)
+		if err != nil {
+			return fmt.Errorf("SmbShare %s: %w", s.Name, err)
+		}
+		if smbConfOnly {
+			fmt.Fprintf(out, "# SmbShare %s/%s\n%s", s.Namespace, s.Name,
+				rendered.SmbConf)
+			continue
+		}
+		for _, obj := range rendered.Objects {
+			gvk, err := apiutil.GVKForObject(obj, scheme)
+			if err != nil {
+				return err
+			}
+			obj.GetObjectKind().SetGroupVersionKind(gvk)
+			data, err := yaml.Marshal(obj)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "---\n%s", data)
+		}
+	}
+	return nil
+}
+
+// readFile reads the resources of the named file, which may hold several
+// YAML documents.
+func (in *renderInput) readFile(name string) error {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		u := &unstructured.Unstructured{}
+		err := decoder.Decode(&u.Object)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(u.Object) == 0 {
+			continue
+		}
+		if err := in.add(u); err != nil {
+			return err
+		}
+	}
+}
+
+// add converts a resource to the operator's storage version and keeps it
+// if it is one of the resources used to render shares.
+func (in *renderInput) add(u *unstructured.Unstructured) error {
+	if u.GetNamespace() == "" {
+		u.SetNamespace("default")
+	}
+	if u.GetKind() == "SmbShare" {
+		// defaults that the API server would apply, and that the planner
+		// can not tell from an unset value
+		_, found, _ := unstructured.NestedFieldNoCopy(
+			u.Object, "spec", "browseable")
+		if !found {
+			_ = unstructured.SetNestedField(
+				u.Object, true, "spec", "browseable")
+		}
+	}
+	obj, err := scheme.New(u.GroupVersionKind())
+	if err != nil {
+		// other resources, such as Secrets, are not needed
+		return nil
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj)
+	if err != nil {
+		return err
+	}
+	if c, ok := obj.(conversion.Convertible); ok {
+		// resources of other API versions are converted to the
+		// storage version
+		if obj, err = toHub(c); err != nil || obj == nil {
+			return err
+		}
+	}
+	switch o := obj.(type) {
+	case *sambaoperatorv1alpha1.SmbShare:
+		in.shares = append(in.shares, o)
+	case *sambaoperatorv1alpha1.SmbSecurityConfig:
+		in.security[o.Namespace+"/"+o.Name] = o
+	case *sambaoperatorv1alpha1.SmbCommonConfig:
+		in.common[o.Namespace+"/"+o.Name] = o
+	}
+	return nil
+}
+
+// toHub converts a resource to the storage version of its kind. It returns
+// nil if the kind is not used to render shares.
+func toHub(c conversion.Convertible) (runtime.Object, error) {
+	var hub conversion.Hub
+	switch c.GetObjectKind().GroupVersionKind().Kind {
+	case "SmbShare":
+		hub = &sambaoperatorv1alpha1.SmbShare{}
+	case "SmbSecurityConfig":
+		hub = &sambaoperatorv1alpha1.SmbSecurityConfig{}
+	case "SmbCommonConfig":
+		hub = &sambaoperatorv1alpha1.SmbCommonConfig{}
+	default:
+		return nil, nil
+	}
+	if err := c.ConvertTo(hub); err != nil {
+		return nil, err
+	}
+	return hub, nil
+}
+
+// instanceConfiguration returns the configuration the share is rendered
+// with. The shares read that name the same server group are rendered as
+// the members of the group.
+func (in *renderInput) instanceConfiguration(
+	s *sambaoperatorv1alpha1.SmbShare) (resources.InstanceConfiguration, error) {
+	// ---
+	ic := resources.InstanceConfiguration{SmbShare: s}
+	if name := s.Spec.SecurityConfig; name != "" {
+		ic.SecurityConfig = in.security[s.Namespace+"/"+name]
+		if ic.SecurityConfig == nil {
+			return ic, fmt.Errorf(
+				"SmbShare %s: SmbSecurityConfig %s not found", s.Name, name)
+		}
+	}
+	if name := s.Spec.CommonConfig; name != "" {
+		ic.CommonConfig = in.common[s.Namespace+"/"+name]
+		if ic.CommonConfig == nil {
+			return ic, fmt.Errorf(
+				"SmbShare %s: SmbCommonConfig %s not found", s.Name, name)
+		}
+	}
+	for _, other := range in.shares {
+		if other.Namespace == s.Namespace &&
+			serverGroup(other) == serverGroup(s) {
+			// ---
+			ic.GroupShares = append(ic.GroupShares, *other)
+		}
+	}
+	sort.Slice(ic.GroupShares, func(i, j int) bool {
+		return ic.GroupShares[i].Name < ic.GroupShares[j].Name
+	})
+	return ic, nil
+}
+
+func serverGroup(s *sambaoperatorv1alpha1.SmbShare) string {
+	if s.Spec.ServerGroup != "" {
+		return s.Spec.ServerGroup
+	}
+	return s.Name
+}
@@ -0,0 +1,64 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/samba-in-kubernetes/samba-operator/internal/resources"
+)
+
+// statusCommand is the name of the subcommand reporting the live state of
+// a share.
+const statusCommand = "status"
+
+// runStatus writes a report of the state of the SmbShare named on the
+// command line, read from the cluster of the current kubeconfig, to out.
+// Nothing is changed in the cluster.
+func runStatus(args []string, out io.Writer) error {
+	fset := flag.NewFlagSet(statusCommand, flag.ContinueOnError)
+	var namespace string
+	fset.StringVarP(
+		&namespace,
+		"namespace",
+		"n",
+		"default",
+		"Namespace of the SmbShare.")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 1 {
+		return fmt.Errorf("expected the name of one SmbShare")
+	}
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return err
+	}
+	cl, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	key := types.NamespacedName{Namespace: namespace, Name: fset.Arg(0)}
+	return resources.WriteShareReport(context.Background(), cl, key, out)
+}
@@ -21,4 +21,5 @@ func runSuiteTests(sm map[string]suite.TestingSuite) func(t *testing.T) {
 func TestIntegration(t *testing.T) {
 	t.Run("deploy", runSuiteTests(allDeploySuites()))
 	t.Run("smbShares", runSuiteTests(allSmbShareSuites()))
+	t.Run("smbUsers", runSuiteTests(allSmbUserSuites()))
 }
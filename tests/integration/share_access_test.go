@@ -4,7 +4,9 @@ package integration
 
 import (
 	"context"
+	"fmt"
 	"path"
+	"testing"
 	"time"
 
 	"github.com/stretchr/testify/suite"
@@ -19,6 +21,25 @@ type ShareAccessSuite struct {
 	share     smbclient.Share
 	auths     []smbclient.Auth
 	clientPod string
+	// protocol is the SMB protocol the client uses to reach the share. If
+	// empty, the client negotiates the protocol.
+	protocol smbclient.Protocol
+
+	// readOnly indicates that write operations on the share are
+	// expected to be denied.
+	readOnly bool
+	// existingFile is the path of a file on the share, which must not
+	// be deletable if the share is read-only.
+	existingFile string
+	// hidden indicates that the share is not browseable and must not
+	// appear in the server's share listing.
+	hidden bool
+	// comment is the expected description of the share in the server's
+	// share listing. If empty, the listing is not checked.
+	comment string
+	// waitForHostResolves indicates that the share's host name may not be
+	// immediately resolvable and must be polled before running tests.
+	waitForHostResolves bool
 }
 
 func (s *ShareAccessSuite) SetupSuite() {
@@ -60,11 +81,45 @@ func (s *ShareAccessSuite) SetupSuite() {
 		testNamespace),
 		"smbclient pod not ready",
 	)
+
+	if s.waitForHostResolves {
+		// resolution is checked from within the client pod as the pod
+		// (not the test runner) is what must be able to resolve the name.
+		s.Require().NoError(
+			s.client().
+				WaitForHostResolves(ctx, s.share.Host),
+			"share host name does not resolve",
+		)
+	}
+}
+
+// client returns the smbclient of the client pod, using the protocol of
+// the suite.
+func (s *ShareAccessSuite) client() smbclient.SmbClient {
+	return smbclient.MustPodProtocolClient(testNamespace, s.clientPod, s.protocol)
+}
+
+// runShareAccessSuites runs the share access tests of sas once for each of
+// the protocols, or for each of smbclient.Protocols if none are given. The
+// tests of each protocol are run as a sub-test named after the protocol.
+func runShareAccessSuites(
+	t *testing.T, sas ShareAccessSuite, protocols []smbclient.Protocol) {
+	// ---
+	if len(protocols) == 0 {
+		protocols = smbclient.Protocols
+	}
+	for _, p := range protocols {
+		ps := sas
+		ps.protocol = p
+		t.Run(string(p), func(t *testing.T) {
+			suite.Run(t, &ps)
+		})
+	}
 }
 
 // TestLogin verifies that users can log into the share.
 func (s *ShareAccessSuite) TestLogin() {
-	smbclient := smbclient.MustPodClient(testNamespace, s.clientPod)
+	smbclient := s.client()
 	err := smbclient.CacheFlush(context.TODO())
 	s.Require().NoError(err)
 	for _, auth := range s.auths {
@@ -78,7 +133,10 @@ func (s *ShareAccessSuite) TestLogin() {
 }
 
 func (s *ShareAccessSuite) TestPutFile() {
-	smbclient := smbclient.MustPodClient(testNamespace, s.clientPod)
+	if s.readOnly {
+		s.T().Skip("writes to the share are denied, see TestWriteAccess")
+	}
+	smbclient := s.client()
 	err := smbclient.CacheFlush(context.TODO())
 	s.Require().NoError(err)
 	auth := s.auths[0]
@@ -96,3 +154,111 @@ func (s *ShareAccessSuite) TestPutFile() {
 	s.Require().NoError(err)
 	s.Require().Contains(string(out), "profile.jpeg")
 }
+
+// TestDirectoryTree verifies that a nested directory tree can be copied
+// to the share and back again without changes.
+func (s *ShareAccessSuite) TestDirectoryTree() {
+	if s.readOnly {
+		s.T().Skip("writes to the share are denied, see TestWriteAccess")
+	}
+	ctx := context.TODO()
+	require := s.Require()
+	client := s.client()
+	err := client.CacheFlush(ctx)
+	require.NoError(err)
+
+	base := fmt.Sprintf("/tmp/tree-%d", time.Now().UnixNano())
+	src := path.Join(base, "src")
+	dst := path.Join(base, "dst")
+	files := []smbclient.TreeFile{
+		{Path: "top.txt", Content: "top level file\n"},
+		{Path: "a/one.txt", Content: "one\n"},
+		{Path: "a/b/two.txt", Content: "two\n"},
+		{Path: "a/b/c/three.txt", Content: "three\n"},
+	}
+	require.NoError(client.MakeLocalTree(ctx, src, files))
+
+	auth := s.auths[0]
+	remoteDir := path.Base(base)
+	put, err := client.MPut(ctx, s.share, auth, src, remoteDir)
+	require.NoError(err)
+	require.Len(put, len(files))
+
+	got, err := client.MGet(ctx, s.share, auth, remoteDir, dst)
+	require.NoError(err)
+	require.Len(got, len(files))
+
+	require.NoError(client.DiffLocalTrees(ctx, src, dst))
+}
+
+// TestWriteAccess verifies that directories and files can be created and
+// deleted on the share, or, if the share is read-only, that those
+// operations are denied.
+func (s *ShareAccessSuite) TestWriteAccess() {
+	ctx := context.TODO()
+	require := s.Require()
+	client := s.client()
+	require.NoError(client.CacheFlush(ctx))
+	auth := s.auths[0]
+
+	dir := fmt.Sprintf("wtest-%d", time.Now().UnixNano())
+	fpath := dir + "/profile.jpeg"
+	if s.readOnly {
+		require.NoError(smbclient.CheckDenied(
+			client.MakeDir(ctx, s.share, auth, dir)))
+		require.NoError(smbclient.CheckDenied(
+			client.PutFile(ctx, s.share, auth, "profile.jpeg", dir+".jpeg")))
+		require.NotEmpty(s.existingFile, "no file to delete on the share")
+		require.NoError(smbclient.CheckDenied(
+			client.DeleteFile(ctx, s.share, auth, s.existingFile)))
+		return
+	}
+	require.NoError(client.MakeDir(ctx, s.share, auth, dir))
+	require.NoError(client.PutFile(ctx, s.share, auth, "profile.jpeg", fpath))
+	require.NoError(client.DeleteFile(ctx, s.share, auth, fpath))
+}
+
+// TestShareComment verifies that the share is listed by the server with
+// the expected comment.
+func (s *ShareAccessSuite) TestShareComment() {
+	if s.comment == "" {
+		s.T().Skip("no share comment expected")
+	}
+	ctx := context.TODO()
+	require := s.Require()
+	client := s.client()
+	require.NoError(client.CacheFlush(ctx))
+
+	entries, err := client.ListShares(ctx, s.share.Host, s.auths[0])
+	require.NoError(err)
+	for _, e := range entries {
+		if e.Name == s.share.Name {
+			require.Equal(s.comment, e.Comment)
+			return
+		}
+	}
+	require.Failf("share not listed", "share %q not found in %v",
+		s.share.Name, entries)
+}
+
+// TestShareBrowseable verifies that the share appears in the server's share
+// listing only if it is browseable. Hidden shares remain accessible by name,
+// as checked by the other tests of the suite.
+func (s *ShareAccessSuite) TestShareBrowseable() {
+	ctx := context.TODO()
+	require := s.Require()
+	client := s.client()
+	require.NoError(client.CacheFlush(ctx))
+
+	entries, err := client.ListShares(ctx, s.share.Host, s.auths[0])
+	require.NoError(err)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if s.hidden {
+		require.NotContains(names, s.share.Name)
+	} else {
+		require.Contains(names, s.share.Name)
+	}
+}
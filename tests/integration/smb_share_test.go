@@ -5,13 +5,17 @@ package integration
 import (
 	"context"
 	"fmt"
+	"os/exec"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/stretchr/testify/suite"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/samba-in-kubernetes/samba-operator/tests/utils/kube"
@@ -24,7 +28,24 @@ type SmbShareSuite struct {
 	fileSources      []kube.FileSource
 	smbShareResource types.NamespacedName
 	shareName        string
-	testAuths        []smbclient.Auth
+	shareComment     string
+	shareHidden      bool
+	// shareReadOnly indicates that the share is read-only. A file is
+	// added to the share from the server to check that it can not be
+	// deleted by clients.
+	shareReadOnly bool
+	testAuths     []smbclient.Auth
+	// serverGroup is the server group of the share, if it differs from
+	// the name of the SmbShare.
+	serverGroup string
+	// port is the port the share is served on, if it is not the default.
+	port int
+	// protocols are the SMB protocols the share is accessed with by the
+	// share access tests. All of smbclient.Protocols are used if unset.
+	protocols []smbclient.Protocol
+	// workloadType is the workload type of the share's server group, if
+	// it is not a deployment.
+	workloadType string
 
 	// cached values
 	tc *kube.TestClient
@@ -43,6 +64,11 @@ func (s *SmbShareSuite) SetupSuite() {
 	}
 	require.NoError(s.waitForPodExist(), "smb server pod does not exist")
 	require.NoError(s.waitForPodReady(), "smb server pod is not ready")
+	if s.shareReadOnly {
+		_, err := s.sambaExec(context.TODO(), fmt.Sprintf(
+			"cd /mnt/* && echo seeded > %s", readOnlySeedFile))
+		require.NoError(err, "failed to add a file to the share")
+	}
 }
 
 func (s *SmbShareSuite) TearDownSuite() {
@@ -55,6 +81,61 @@ func (s *SmbShareSuite) TearDownSuite() {
 	}
 }
 
+// readOnlySeedFile is the file added to read-only shares from the server.
+const readOnlySeedFile = "seeded.txt"
+
+// existingFile returns the path of a file known to be on the share, or an
+// empty string if there is none.
+func (s *SmbShareSuite) existingFile() string {
+	if s.shareReadOnly {
+		return readOnlySeedFile
+	}
+	return ""
+}
+
+// serverGroupName returns the name of the server group of the share.
+func (s *SmbShareSuite) serverGroupName() string {
+	if s.serverGroup != "" {
+		return s.serverGroup
+	}
+	return s.smbShareResource.Name
+}
+
+// host returns the smbclient host used to reach the share on the given
+// address.
+func (s *SmbShareSuite) host(addr string) smbclient.Host {
+	if s.port != 0 {
+		return smbclient.HostPort(addr, s.port)
+	}
+	return smbclient.Host(addr)
+}
+
+// sambaExec runs the shell command in the samba container of the share's
+// pod and returns its trimmed output.
+func (s *SmbShareSuite) sambaExec(
+	ctx context.Context, script string) (string, error) {
+	// ---
+	pod, err := s.tc.GetPodByLabel(
+		ctx,
+		fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName()),
+		testNamespace)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx,
+		"kubectl", "exec",
+		"--namespace", testNamespace,
+		"--container", "samba",
+		pod.Name,
+		"--",
+		"sh", "-c", script)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to run %q: %w: %s", script, err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
 func (s *SmbShareSuite) waitForPodExist() error {
 	ctx, cancel := context.WithDeadline(
 		context.TODO(),
@@ -63,26 +144,31 @@ func (s *SmbShareSuite) waitForPodExist() error {
 	return kube.WaitForPodExistsByLabel(
 		ctx,
 		s.tc,
-		fmt.Sprintf("samba-operator.samba.org/service=%s", s.smbShareResource.Name),
+		fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName()),
 		testNamespace)
 }
 
+// waitForPodReady waits for the share's pod to be ready. The readiness probe
+// of smbd only passes once the SMB port accepts connections and, for domain
+// members, the domain trust is verified, so a ready pod serves the share.
 func (s *SmbShareSuite) waitForPodReady() error {
 	ctx, cancel := context.WithDeadline(
 		context.TODO(),
-		time.Now().Add(60*time.Second))
+		time.Now().Add(120*time.Second))
 	defer cancel()
 	return kube.WaitForPodReadyByLabel(
 		ctx,
 		s.tc,
-		fmt.Sprintf("samba-operator.samba.org/service=%s", s.smbShareResource.Name),
+		fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName()),
 		testNamespace)
 }
 
+// getPodIP returns the primary address of the share's pod. On IPv6 and
+// IPv6-primary dual-stack clusters this is an IPv6 address.
 func (s *SmbShareSuite) getPodIP() (string, error) {
 	pod, err := s.tc.GetPodByLabel(
 		context.TODO(),
-		fmt.Sprintf("samba-operator.samba.org/service=%s", s.smbShareResource.Name),
+		fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName()),
 		testNamespace)
 	if err != nil {
 		return "", err
@@ -97,28 +183,36 @@ func (s *SmbShareSuite) TestPodsReady() {
 func (s *SmbShareSuite) TestShareAccessByIP() {
 	ip, err := s.getPodIP()
 	s.Require().NoError(err)
-	shareAccessSuite := &ShareAccessSuite{
+	shareAccessSuite := ShareAccessSuite{
 		share: smbclient.Share{
-			Host: smbclient.Host(ip),
+			Host: s.host(ip),
 			Name: s.shareName,
 		},
-		auths: s.testAuths,
+		auths:        s.testAuths,
+		comment:      s.shareComment,
+		hidden:       s.shareHidden,
+		readOnly:     s.shareReadOnly,
+		existingFile: s.existingFile(),
 	}
-	suite.Run(s.T(), shareAccessSuite)
+	runShareAccessSuites(s.T(), shareAccessSuite, s.protocols)
 }
 
 func (s *SmbShareSuite) TestShareAccessByServiceName() {
 	svcname := fmt.Sprintf("%s.%s.svc.cluster.local",
-		s.smbShareResource.Name,
+		s.serverGroupName(),
 		testNamespace)
-	shareAccessSuite := &ShareAccessSuite{
+	shareAccessSuite := ShareAccessSuite{
 		share: smbclient.Share{
-			Host: smbclient.Host(svcname),
+			Host: s.host(svcname),
 			Name: s.shareName,
 		},
-		auths: s.testAuths,
+		auths:        s.testAuths,
+		comment:      s.shareComment,
+		hidden:       s.shareHidden,
+		readOnly:     s.shareReadOnly,
+		existingFile: s.existingFile(),
 	}
-	suite.Run(s.T(), shareAccessSuite)
+	runShareAccessSuites(s.T(), shareAccessSuite, s.protocols)
 }
 
 func (s *SmbShareSuite) TestShareEvents() {
@@ -145,53 +239,163 @@ func (s *SmbShareSuite) TestShareEvents() {
 		})
 	s.Require().NoError(err)
 	s.Require().GreaterOrEqual(len(l.Items), 1)
+	createdWorkload := "CreatedDeployment"
+	numServices := 1
+	if s.workloadType == "statefulset" {
+		// a statefulset comes with a headless service
+		createdWorkload = "CreatedStatefulSet"
+		numServices = 2
+	}
 	numCreatedPVC := 0
-	numCreatedDeployment := 0
+	numCreatedWorkload := 0
+	numCreatedService := 0
 	for _, event := range l.Items {
 		if event.Reason == "CreatedPersistentVolumeClaim" {
 			numCreatedPVC++
 		}
-		if event.Reason == "CreatedDeployment" {
-			numCreatedDeployment++
+		if event.Reason == createdWorkload {
+			numCreatedWorkload++
+		}
+		if event.Reason == "CreatedService" {
+			numCreatedService++
 		}
 	}
 	s.Require().Equal(1, numCreatedPVC)
-	s.Require().Equal(1, numCreatedDeployment)
+	if s.serverGroup != "" {
+		// the workload and services are created by one of the group's
+		// shares
+		s.Require().LessOrEqual(numCreatedWorkload, 1)
+		s.Require().LessOrEqual(numCreatedService, numServices)
+	} else {
+		s.Require().Equal(1, numCreatedWorkload)
+		s.Require().Equal(numServices, numCreatedService)
+	}
+}
+
+type SmbShareStatefulSetSuite struct {
+	SmbShareSuite
+}
+
+// TestStablePodName verifies that the pod of a statefulset has a stable
+// name, resolving through the headless service of the server group.
+func (s *SmbShareStatefulSetSuite) TestStablePodName() {
+	pod, err := s.tc.GetPodByLabel(
+		context.TODO(),
+		fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName()),
+		testNamespace)
+	s.Require().NoError(err)
+	s.Require().Equal(s.serverGroupName()+"-0", pod.Name)
+
+	shareAccessSuite := ShareAccessSuite{
+		share: smbclient.Share{
+			Host: s.host(fmt.Sprintf("%s.%s-headless.%s.svc.cluster.local",
+				pod.Name, s.serverGroupName(), testNamespace)),
+			Name: s.shareName,
+		},
+		auths: s.testAuths,
+	}
+	runShareAccessSuites(s.T(), shareAccessSuite, s.protocols)
 }
 
 type SmbShareWithDNSSuite struct {
 	SmbShareSuite
+
+	// dnsAliases are the host names in the domain registered as aliases
+	// of the share's server.
+	dnsAliases []string
+	// kerberosAuths are domain users logging into the share with a
+	// kerberos ticket.
+	kerberosAuths []smbclient.Auth
 }
 
-func (s *SmbShareWithDNSSuite) TestShareAccessByDomainName() {
-	// HACK: sleep for a short bit before running the smbclient command.  This
-	// test works often but is flaky, and that appears due to the dns name not
-	// always resolving. This hack adds a small delay to try and reduce the
-	// test flakes. Obviously, a sleep is poor way to improve a test case. In
-	// the future we should poll-with-a-timeout for the dns name, but that
-	// needs to be done in-cluster/in-the-pod and that's a bunch of yak shaving
-	// - so for now: a hack.
-	time.Sleep(400 * time.Millisecond)
+// TestKerberosLogin verifies that domain users can log into the share with
+// a kerberos ticket, reaching the server by its name in the domain.
+func (s *SmbShareWithDNSSuite) TestKerberosLogin() {
+	if len(s.kerberosAuths) == 0 {
+		s.T().Skip("no kerberos users")
+	}
+	ctx, cancel := context.WithDeadline(
+		context.TODO(),
+		time.Now().Add(120*time.Second))
+	defer cancel()
+	require := s.Require()
+	share := smbclient.Share{
+		Host: smbclient.Host(fmt.Sprintf("%s-cluster.domain1.sink.test",
+			s.serverGroupName())),
+		Name: s.shareName,
+	}
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.WaitForHostResolves(ctx, share.Host),
+		"share host name does not resolve")
+	for _, auth := range s.kerberosAuths {
+		require.NoError(client.Kinit(ctx, auth),
+			"failed to obtain a kerberos ticket for %s", auth.Username)
+		require.NoError(client.Command(ctx, share, auth, []string{"ls"}),
+			"failed to access the share with the kerberos ticket of %s",
+			auth.Username)
+	}
+}
 
+func (s *SmbShareWithDNSSuite) TestShareAccessByDomainName() {
 	dnsname := fmt.Sprintf("%s-cluster.domain1.sink.test",
-		s.smbShareResource.Name)
-	shareAccessSuite := &ShareAccessSuite{
+		s.serverGroupName())
+	shareAccessSuite := ShareAccessSuite{
 		share: smbclient.Share{
 			Host: smbclient.Host(dnsname),
 			Name: s.shareName,
 		},
-		auths: s.testAuths,
+		auths:   s.testAuths,
+		comment: s.shareComment,
+		hidden:  s.shareHidden,
+		// the dns name is registered asynchronously by the dns-register
+		// container.
+		waitForHostResolves: true,
+	}
+	runShareAccessSuites(s.T(), shareAccessSuite, s.protocols)
+}
+
+func (s *SmbShareWithDNSSuite) TestShareAccessByDNSAlias() {
+	s.Require().NotEmpty(s.dnsAliases)
+	for _, alias := range s.dnsAliases {
+		shareAccessSuite := ShareAccessSuite{
+			share: smbclient.Share{
+				Host: smbclient.Host(alias + ".domain1.sink.test"),
+				Name: s.shareName,
+			},
+			auths:               s.testAuths,
+			comment:             s.shareComment,
+			hidden:              s.shareHidden,
+			waitForHostResolves: true,
+		}
+		runShareAccessSuites(s.T(), shareAccessSuite, s.protocols)
+	}
+}
+
+// operatorContainers returns the containers of the pod that the operator
+// defines, leaving out the extra containers of the common config, which the
+// pod template lists in its extra-containers annotation.
+func operatorContainers(pod *corev1.Pod) []corev1.Container {
+	extra := map[string]bool{}
+	a := pod.Annotations["samba-operator.samba.org/extra-containers"]
+	for _, name := range strings.Split(a, ",") {
+		extra[name] = true
+	}
+	containers := []corev1.Container{}
+	for _, c := range pod.Spec.Containers {
+		if !extra[c.Name] {
+			containers = append(containers, c)
+		}
 	}
-	suite.Run(s.T(), shareAccessSuite)
+	return containers
 }
 
 func (s *SmbShareWithDNSSuite) TestPodForDNSContainers() {
 	pod, err := s.tc.GetPodByLabel(
 		context.TODO(),
-		fmt.Sprintf("samba-operator.samba.org/service=%s", s.smbShareResource.Name),
+		fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName()),
 		testNamespace)
 	s.Require().NoError(err)
-	s.Require().Equal(4, len(pod.Spec.Containers))
+	s.Require().Equal(4, len(operatorContainers(pod)))
 	names := []string{}
 	for _, cstatus := range pod.Status.ContainerStatuses {
 		names = append(names, cstatus.Name)
@@ -203,10 +407,13 @@ func (s *SmbShareWithDNSSuite) TestPodForDNSContainers() {
 
 type SmbShareWithExternalNetSuite struct {
 	SmbShareSuite
+
+	// dnsName is the name the share is published under by ExternalDNS.
+	dnsName string
 }
 
 func (s *SmbShareWithExternalNetSuite) TestServiceIsLoadBalancer() {
-	lbl := fmt.Sprintf("samba-operator.samba.org/service=%s", s.smbShareResource.Name)
+	lbl := fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName())
 	l, err := s.tc.Clientset().CoreV1().Services(testNamespace).List(
 		context.TODO(),
 		metav1.ListOptions{
@@ -225,105 +432,2295 @@ func (s *SmbShareWithExternalNetSuite) TestServiceIsLoadBalancer() {
 	)
 }
 
-func allSmbShareSuites() map[string]suite.TestingSuite {
-	m := map[string]suite.TestingSuite{}
-	m["users1"] = &SmbShareSuite{
-		fileSources: []kube.FileSource{
-			{
-				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
-				Namespace: testNamespace,
-			},
-			{
-				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
-				Namespace: testNamespace,
-			},
-			{
-				Path:      path.Join(testFilesDir, "smbshare1.yaml"),
-				Namespace: testNamespace,
-			},
-		},
-		smbShareResource: types.NamespacedName{testNamespace, "tshare1"},
-		shareName:        "My Share",
-		testAuths: []smbclient.Auth{{
-			Username: "sambauser",
-			Password: "1nsecurely",
-		}},
+// TestExternalDNSName verifies that the share's Service is annotated for
+// ExternalDNS and that the published name is reported in the status.
+func (s *SmbShareWithExternalNetSuite) TestExternalDNSName() {
+	require := s.Require()
+	svc, err := s.tc.Clientset().CoreV1().Services(testNamespace).Get(
+		context.TODO(),
+		s.serverGroupName(),
+		metav1.GetOptions{})
+	require.NoError(err)
+	require.Equal(
+		s.dnsName,
+		svc.Annotations["external-dns.alpha.kubernetes.io/hostname"])
+
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("samba-operator.samba.org/v1alpha1")
+	u.SetKind("SmbShare")
+	dc, err := s.tc.DynamicClientset(u)
+	require.NoError(err)
+	u, err = dc.Namespace(s.smbShareResource.Namespace).Get(
+		context.TODO(),
+		s.smbShareResource.Name,
+		metav1.GetOptions{})
+	require.NoError(err)
+	name, _, err := unstructured.NestedString(
+		u.Object, "status", "publishedDNSName")
+	require.NoError(err)
+	require.Equal(s.dnsName, name)
+}
+
+// TestPodDrainsConnections verifies that the samba container of the share's
+// pod waits for clients before it is stopped, for the grace period given
+// by the common config.
+func (s *SmbShareWithExternalNetSuite) TestPodDrainsConnections() {
+	require := s.Require()
+	pod, err := s.tc.GetPodByLabel(
+		context.TODO(),
+		fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName()),
+		testNamespace)
+	require.NoError(err)
+	require.NotNil(pod.Spec.TerminationGracePeriodSeconds)
+	require.Equal(int64(45), *pod.Spec.TerminationGracePeriodSeconds)
+	var smbd *corev1.Container
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == "samba" {
+			smbd = &pod.Spec.Containers[i]
+		}
 	}
+	require.NotNil(smbd)
+	require.NotNil(smbd.Lifecycle)
+	require.NotNil(smbd.Lifecycle.PreStop)
+	require.NotNil(smbd.Lifecycle.PreStop.Exec)
+}
 
-	m["domainMember1"] = &SmbShareWithDNSSuite{SmbShareSuite{
-		fileSources: []kube.FileSource{
-			{
-				Path:      path.Join(testFilesDir, "joinsecret1.yaml"),
-				Namespace: testNamespace,
-			},
-			{
-				Path:      path.Join(testFilesDir, "smbsecurityconfig2.yaml"),
-				Namespace: testNamespace,
-			},
-			{
-				Path:      path.Join(testFilesDir, "smbshare2.yaml"),
-				Namespace: testNamespace,
-			},
-		},
-		smbShareResource: types.NamespacedName{testNamespace, "tshare2"},
-		shareName:        "My Kingdom",
-		testAuths: []smbclient.Auth{{
-			Username: "DOMAIN1\\bwayne",
-			Password: "1115Rose.",
-		}},
-	}}
+// TestPodDisruptionBudget verifies that the share's pod is protected by a
+// PodDisruptionBudget, as requested by the common config.
+func (s *SmbShareWithExternalNetSuite) TestPodDisruptionBudget() {
+	pdb, err := s.tc.Clientset().PolicyV1beta1().PodDisruptionBudgets(testNamespace).Get(
+		context.TODO(),
+		s.serverGroupName(),
+		metav1.GetOptions{})
+	s.Require().NoError(err)
+	s.Require().NotNil(pdb.Spec.MinAvailable)
+	s.Require().Equal(1, pdb.Spec.MinAvailable.IntValue())
+	s.Require().Nil(pdb.Spec.MaxUnavailable)
+	s.Require().Equal(
+		s.serverGroupName(),
+		pdb.Spec.Selector.MatchLabels["samba-operator.samba.org/service"])
+}
 
-	// Test that the operator functions when the SmbShare resources are created
-	// in a different ns (for example, "default").
-	// IMPORTANT: the secrets MUST be in the same namespace as the pods.
-	m["smbSharesInDefault"] = &SmbShareSuite{
-		fileSources: []kube.FileSource{
-			{
-				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
-				Namespace: testNamespace,
-			},
-			{
-				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
-				Namespace: "default",
-			},
-			{
-				Path:      path.Join(testFilesDir, "smbshare3.yaml"),
-				Namespace: "default",
-			},
-		},
-		smbShareResource: types.NamespacedName{"default", "tshare3"},
-		shareName:        "My Other Share",
-		testAuths: []smbclient.Auth{{
-			Username: "sambauser",
-			Password: "1nsecurely",
-		}},
+// TestUpdateStrategy verifies that the update strategy of the common config
+// is applied to the share's deployment.
+func (s *SmbShareWithExternalNetSuite) TestUpdateStrategy() {
+	dep, err := s.tc.Clientset().AppsV1().Deployments(testNamespace).Get(
+		context.TODO(),
+		s.serverGroupName(),
+		metav1.GetOptions{})
+	s.Require().NoError(err)
+	s.Require().Equal(
+		appsv1.RecreateDeploymentStrategyType,
+		dep.Spec.Strategy.Type)
+	s.Require().Nil(dep.Spec.Strategy.RollingUpdate)
+}
+
+type SmbShareWithAccessControlSuite struct {
+	SmbShareSuite
+
+	writer  smbclient.Auth
+	reader  smbclient.Auth
+	invalid smbclient.Auth
+}
+
+func (s *SmbShareWithAccessControlSuite) share() smbclient.Share {
+	ip, err := s.getPodIP()
+	s.Require().NoError(err)
+	return smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
 	}
+}
 
-	m["smbSharesExternal"] = &SmbShareWithExternalNetSuite{SmbShareSuite{
-		fileSources: []kube.FileSource{
-			{
-				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
-				Namespace: testNamespace,
-			},
-			{
-				Path:      path.Join(testFilesDir, "commonconfig1.yaml"),
-				Namespace: testNamespace,
-			},
-			{
-				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+func (s *SmbShareWithAccessControlSuite) TestWriteListGrantsWrite() {
+	ctx := context.TODO()
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	s.Require().NoError(client.CacheFlush(ctx))
+	fname := fmt.Sprintf("writer-%d.jpeg", time.Now().UnixNano())
+	s.Require().NoError(
+		client.PutFile(ctx, s.share(), s.writer, "profile.jpeg", fname))
+}
+
+func (s *SmbShareWithAccessControlSuite) TestReadOnlyUserDenied() {
+	ctx := context.TODO()
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	s.Require().NoError(client.CacheFlush(ctx))
+	s.Require().NoError(client.Command(ctx, s.share(), s.reader, []string{"ls"}))
+	fname := fmt.Sprintf("reader-%d.jpeg", time.Now().UnixNano())
+	s.Require().NoError(smbclient.CheckDenied(
+		client.PutFile(ctx, s.share(), s.reader, "profile.jpeg", fname)))
+}
+
+func (s *SmbShareWithAccessControlSuite) TestInvalidUserDenied() {
+	ctx := context.TODO()
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	s.Require().NoError(client.CacheFlush(ctx))
+	s.Require().Error(client.Command(ctx, s.share(), s.invalid, []string{"ls"}))
+}
+
+type SmbShareWithLocalGroupSuite struct {
+	SmbShareSuite
+
+	member    smbclient.Auth
+	nonMember smbclient.Auth
+}
+
+// TestGroupMemberAllowed verifies that a share only valid for a local group
+// of the security config can be used by the members of the group.
+func (s *SmbShareWithLocalGroupSuite) TestGroupMemberAllowed() {
+	ctx := context.TODO()
+	ip, err := s.getPodIP()
+	s.Require().NoError(err)
+	share := smbclient.Share{Host: smbclient.Host(ip), Name: s.shareName}
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	s.Require().NoError(client.CacheFlush(ctx))
+	fname := fmt.Sprintf("member-%d.jpeg", time.Now().UnixNano())
+	s.Require().NoError(
+		client.PutFile(ctx, share, s.member, "profile.jpeg", fname))
+	s.Require().Error(client.Command(ctx, share, s.nonMember, []string{"ls"}))
+}
+
+type SmbShareWithFileModesSuite struct {
+	SmbShareSuite
+
+	// fileMode is the octal mode new files are expected to have on the
+	// share's volume.
+	fileMode string
+}
+
+// serverStat returns the octal mode of the named file, relative to the
+// share's directory, as seen from within the smbd container.
+func (s *SmbShareWithFileModesSuite) serverStat(
+	ctx context.Context, name string) (string, error) {
+	// ---
+	pod, err := s.tc.GetPodByLabel(
+		ctx,
+		fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName()),
+		testNamespace)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx,
+		"kubectl", "exec",
+		"--namespace", testNamespace,
+		"--container", "samba",
+		pod.Name,
+		"--",
+		"sh", "-c", fmt.Sprintf("stat -c %%a /mnt/*/%s", name))
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// TestCreateMask verifies that a file written over SMB has the mode set by
+// the share's createMask and forceCreateMode on the underlying volume.
+func (s *SmbShareWithFileModesSuite) TestCreateMask() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	fname := fmt.Sprintf("mode-%d.jpeg", time.Now().UnixNano())
+	require.NoError(
+		client.PutFile(ctx, share, s.testAuths[0], "profile.jpeg", fname))
+	mode, err := s.serverStat(ctx, fname)
+	require.NoError(err)
+	require.Equal(s.fileMode, mode)
+}
+
+type SmbShareWithSymlinksSuite struct {
+	SmbShareSuite
+
+	// wideLinks is true if the share allows following symbolic links out
+	// of the share.
+	wideLinks bool
+}
+
+// linkOutside creates, on the share's volume, a symbolic link named name
+// pointing to a directory outside of the share.
+func (s *SmbShareWithSymlinksSuite) linkOutside(
+	ctx context.Context, name string) error {
+	// ---
+	pod, err := s.tc.GetPodByLabel(
+		ctx,
+		fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName()),
+		testNamespace)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx,
+		"kubectl", "exec",
+		"--namespace", testNamespace,
+		"--container", "samba",
+		pod.Name,
+		"--",
+		"sh", "-c", fmt.Sprintf("ln -sfn /etc /mnt/*/%s", name))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to link %s: %w: %s", name, err, out)
+	}
+	return nil
+}
+
+// TestLinkOutsideShare verifies that a file reached through a symbolic
+// link pointing outside of the share can only be read if the share allows
+// wide links.
+func (s *SmbShareWithSymlinksSuite) TestLinkOutsideShare() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	require.NoError(s.linkOutside(ctx, "outside"))
+	err = client.GetFile(
+		ctx, share, s.testAuths[0], "outside/hostname", "/tmp/hostname")
+	if s.wideLinks {
+		require.NoError(err)
+	} else {
+		require.Error(err)
+	}
+}
+
+type SmbShareForceUserSuite struct {
+	SmbShareSuite
+
+	// forceUser is the user files of the share are owned by.
+	forceUser string
+}
+
+// fileOwner returns the name of the user owning the named file on the
+// share's volume.
+func (s *SmbShareSuite) fileOwner(
+	ctx context.Context, name string) (string, error) {
+	// ---
+	pod, err := s.tc.GetPodByLabel(
+		ctx,
+		fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName()),
+		testNamespace)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx,
+		"kubectl", "exec",
+		"--namespace", testNamespace,
+		"--container", "samba",
+		pod.Name,
+		"--",
+		"sh", "-c", fmt.Sprintf("stat -c %%U /mnt/*/%s", name))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w: %s", name, err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// TestFileOwnedByForcedUser verifies that a file written by a user other
+// than the forced user is owned by the forced user on the volume.
+func (s *SmbShareForceUserSuite) TestFileOwnedByForcedUser() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	auth := s.testAuths[0]
+	require.NotEqual(s.forceUser, auth.Username)
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	fname := fmt.Sprintf("forced-%d.jpeg", time.Now().UnixNano())
+	require.NoError(client.PutFile(ctx, share, auth, "profile.jpeg", fname))
+	owner, err := s.fileOwner(ctx, fname)
+	require.NoError(err)
+	require.Equal(s.forceUser, owner)
+}
+
+type SmbShareInheritOwnerSuite struct {
+	SmbShareSuite
+}
+
+// TestFileInheritsGroup verifies that a file written to a directory owned
+// by a group other than the user's is owned by that group.
+func (s *SmbShareInheritOwnerSuite) TestFileInheritsGroup() {
+	ctx := context.TODO()
+	require := s.Require()
+	dir := fmt.Sprintf("team-%d", time.Now().UnixNano())
+	_, err := s.sambaExec(ctx, fmt.Sprintf(
+		"cd /mnt/* && mkdir %s && chgrp 2345 %s && chmod 2777 %s",
+		dir, dir, dir))
+	require.NoError(err)
+
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+	fname := path.Join(dir, "shared.jpeg")
+	require.NoError(client.PutFile(
+		ctx, share, s.testAuths[0], "profile.jpeg", fname))
+	group, err := s.sambaExec(ctx, fmt.Sprintf("stat -c %%g /mnt/*/%s", fname))
+	require.NoError(err)
+	require.Equal("2345", group)
+}
+
+type SmbShareMSDFSSuite struct {
+	SmbShareSuite
+}
+
+// TestLinkListed verifies that the DFS link of a DFS root share is listed
+// by clients, as the directory they are referred from.
+func (s *SmbShareMSDFSSuite) TestLinkListed() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+	out, err := client.CommandOutput(ctx, share, s.testAuths[0], []string{"ls"})
+	require.NoError(err)
+	require.Regexp(`(?m)^\s+team\s+D`, string(out))
+}
+
+type SmbShareWithConnectionsSuite struct {
+	SmbShareSuite
+}
+
+// activeConnections returns the connection count in the status of the
+// SmbShare, and false if it is not set.
+func (s *SmbShareWithConnectionsSuite) activeConnections(
+	ctx context.Context) (int64, bool, error) {
+	// ---
+	return s.statusCount(ctx, "activeConnections")
+}
+
+// statusCount returns the count at the given path of the status of the
+// SmbShare, and false if it is not set.
+func (s *SmbShareWithConnectionsSuite) statusCount(
+	ctx context.Context, fields ...string) (int64, bool, error) {
+	// ---
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("samba-operator.samba.org/v1alpha1")
+	u.SetKind("SmbShare")
+	dc, err := s.tc.DynamicClientset(u)
+	if err != nil {
+		return 0, false, err
+	}
+	u, err = dc.Namespace(s.smbShareResource.Namespace).Get(
+		ctx,
+		s.smbShareResource.Name,
+		metav1.GetOptions{})
+	if err != nil {
+		return 0, false, err
+	}
+	return unstructured.NestedInt64(
+		u.Object, append([]string{"status"}, fields...)...)
+}
+
+// TestActiveConnections verifies that the connections to the share are
+// counted in its status once a client has connected.
+func (s *SmbShareWithConnectionsSuite) TestActiveConnections() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+	fname := fmt.Sprintf("conn-%d.jpeg", time.Now().UnixNano())
+	require.NoError(
+		client.PutFile(ctx, share, s.testAuths[0], "profile.jpeg", fname))
+
+	// connections are counted every minute by default
+	deadline := time.Now().Add(3 * time.Minute)
+	for {
+		count, found, err := s.activeConnections(ctx)
+		require.NoError(err)
+		if found {
+			require.GreaterOrEqual(count, int64(0))
+			return
+		}
+		require.True(time.Now().Before(deadline),
+			"status.activeConnections not set")
+		time.Sleep(5 * time.Second)
+	}
+}
+
+type SmbShareWithEncryptionSuite struct {
+	SmbShareWithConnectionsSuite
+}
+
+// TestEncryptionInEffect verifies that the encrypted connections to a
+// share requiring encryption are counted in its status while a client is
+// connected.
+func (s *SmbShareWithEncryptionSuite) TestEncryptionInEffect() {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+	require.NoError(client.Connect(ctx, share, s.testAuths[0]))
+
+	// connections are counted every minute by default
+	deadline := time.Now().Add(3 * time.Minute)
+	for {
+		count, found, err := s.statusCount(
+			ctx, "encryptionInEffect", "encrypted")
+		require.NoError(err)
+		if found && count > 0 {
+			unencrypted, _, err := s.statusCount(
+				ctx, "encryptionInEffect", "unencrypted")
+			require.NoError(err)
+			require.Equal(int64(0), unencrypted)
+			return
+		}
+		require.True(time.Now().Before(deadline),
+			"status.encryptionInEffect.encrypted not set")
+		time.Sleep(5 * time.Second)
+	}
+}
+
+type SmbShareWithAuthenticationSuite struct {
+	SmbShareSuite
+}
+
+// TestNTLMv1Refused verifies that a client only offering NTLMv1 can not
+// log in, while the same user logs in with NTLMv2.
+func (s *SmbShareWithAuthenticationSuite) TestNTLMv1Refused() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	auth := s.testAuths[0]
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+	require.NoError(client.Command(ctx, share, auth, []string{"ls"}))
+
+	cmd := exec.CommandContext(ctx,
+		"kubectl", "exec",
+		"--namespace", testNamespace,
+		"smbclient",
+		"--",
+		"smbclient",
+		fmt.Sprintf("-U%s%%%s", auth.Username, auth.Password),
+		"--option=client ntlmv2 auth=no",
+		share.String(),
+		"-c", "ls")
+	out, err := cmd.CombinedOutput()
+	require.Error(err, "NTLMv1 login succeeded")
+	require.Contains(string(out), "NT_STATUS_LOGON_FAILURE")
+}
+
+type SmbShareWithCustomConfigSuite struct {
+	SmbShareSuite
+
+	// generatedShareName is the share name of the SmbShare, that the
+	// custom smb.conf does not define.
+	generatedShareName string
+}
+
+// TestCustomConfigUsed verifies that the share is reported as using an
+// unmanaged config and that the server only serves the shares of the
+// custom smb.conf.
+func (s *SmbShareWithCustomConfigSuite) TestCustomConfigUsed() {
+	ctx := context.TODO()
+	require := s.Require()
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("samba-operator.samba.org/v1alpha1")
+	u.SetKind("SmbShare")
+	dc, err := s.tc.DynamicClientset(u)
+	require.NoError(err)
+	u, err = dc.Namespace(s.smbShareResource.Namespace).Get(
+		ctx,
+		s.smbShareResource.Name,
+		metav1.GetOptions{})
+	require.NoError(err)
+	mode, _, err := unstructured.NestedString(u.Object, "status", "configMode")
+	require.NoError(err)
+	require.Equal("Unmanaged", mode)
+
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+	entries, err := client.ListShares(ctx, smbclient.Host(ip), s.testAuths[0])
+	require.NoError(err)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	require.Contains(names, s.shareName)
+	require.NotContains(names, s.generatedShareName)
+}
+
+type SmbShareWithServerIdentitySuite struct {
+	SmbShareSuite
+
+	// serverString is the server string of the share's SmbCommonConfig.
+	serverString string
+}
+
+// TestServerStringListed verifies that the server describes itself with
+// the server string of the common config when listing its shares.
+func (s *SmbShareWithServerIdentitySuite) TestServerStringListed() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+	entries, err := client.ListShares(ctx, smbclient.Host(ip), s.testAuths[0])
+	require.NoError(err)
+	comments := []string{}
+	for _, e := range entries {
+		if e.Type == "IPC" {
+			comments = append(comments, e.Comment)
+		}
+	}
+	// samba describes the IPC$ share as "IPC Service (<server string>)"
+	require.Contains(comments, fmt.Sprintf("IPC Service (%s)", s.serverString))
+}
+
+type SmbShareWithSecurityUpdateSuite struct {
+	SmbShareSuite
+
+	// updatedAuths are the users able to log in once the users of the
+	// SmbSecurityConfig have been replaced.
+	updatedAuths []smbclient.Auth
+}
+
+// securityConfigHash returns the digest of the SmbSecurityConfig recorded in
+// the pod template of the share's deployment.
+func (s *SmbShareWithSecurityUpdateSuite) securityConfigHash(
+	ctx context.Context) (string, error) {
+	// ---
+	d, err := s.tc.GetDeploymentByLabel(
+		ctx,
+		fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName()),
+		testNamespace)
+	if err != nil {
+		return "", err
+	}
+	annotations := d.Spec.Template.Annotations
+	return annotations["samba-operator.samba.org/security-config-hash"], nil
+}
+
+// TestSecurityConfigUpdated verifies that replacing the users of the
+// SmbSecurityConfig rolls the pods of the share and that the new users can
+// log in once the update has completed.
+func (s *SmbShareWithSecurityUpdateSuite) TestSecurityConfigUpdated() {
+	ctx := context.TODO()
+	require := s.Require()
+	require.NoError(s.waitForPodReady())
+	before, err := s.securityConfigHash(ctx)
+	require.NoError(err)
+	require.NotEmpty(before)
+
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("samba-operator.samba.org/v1alpha1")
+	u.SetKind("SmbSecurityConfig")
+	dc, err := s.tc.DynamicClientset(u)
+	require.NoError(err)
+	_, err = dc.Namespace(testNamespace).Patch(
+		ctx,
+		"sharesec4",
+		types.MergePatchType,
+		[]byte(`{"spec":{"users":{"secret":"users2"}}}`),
+		metav1.PatchOptions{})
+	require.NoError(err)
+
+	deadline := time.Now().Add(2 * time.Minute)
+	for {
+		after, err := s.securityConfigHash(ctx)
+		require.NoError(err)
+		if after != before {
+			break
+		}
+		require.True(time.Now().Before(deadline),
+			"deployment not updated for the new security config")
+		time.Sleep(time.Second)
+	}
+	wctx, cancel := context.WithDeadline(ctx, time.Now().Add(2*time.Minute))
+	defer cancel()
+	require.NoError(kube.WaitForDeploymentReadyByLabel(
+		wctx,
+		s.tc,
+		fmt.Sprintf("samba-operator.samba.org/service=%s", s.serverGroupName()),
+		testNamespace))
+
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+	for _, auth := range s.updatedAuths {
+		require.NoError(client.Command(ctx, share, auth, []string{"ls"}))
+	}
+}
+
+type SmbShareWithACLsSuite struct {
+	SmbShareSuite
+}
+
+// TestACLPreserved verifies that an ACL entry set on a file over SMB is
+// stored and returned by later connections to the share.
+func (s *SmbShareWithACLsSuite) TestACLPreserved() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	auth := s.testAuths[0]
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	fname := fmt.Sprintf("acl-%d.jpeg", time.Now().UnixNano())
+	require.NoError(client.PutFile(ctx, share, auth, "profile.jpeg", fname))
+	// grant read access to the well known Everyone SID
+	require.NoError(client.AddACL(
+		ctx, share, auth, fname, "ACL:S-1-1-0:ALLOWED/0x0/READ"))
+
+	aces, err := client.GetACL(ctx, share, auth, fname)
+	require.NoError(err)
+	found := false
+	for _, ace := range aces {
+		if strings.HasPrefix(ace, "ACL:S-1-1-0:ALLOWED/") {
+			found = true
+		}
+	}
+	require.True(found, "ACL entry not preserved: %v", aces)
+}
+
+type SmbShareWithWindowsEditingSuite struct {
+	SmbShareSuite
+}
+
+// TestPermissionChangePersists verifies that an ACL entry set on a file over
+// SMB is stored on the share's volume, and returned by the pod replacing
+// the share's pod.
+func (s *SmbShareWithWindowsEditingSuite) TestPermissionChangePersists() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	auth := s.testAuths[0]
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	fname := fmt.Sprintf("acl-%d.jpeg", time.Now().UnixNano())
+	require.NoError(client.PutFile(ctx, share, auth, "profile.jpeg", fname))
+	// grant read access to the well known Everyone SID
+	require.NoError(client.AddACL(
+		ctx, share, auth, fname, "ACL:S-1-1-0:ALLOWED/0x0/READ"))
+
+	label := fmt.Sprintf(
+		"samba-operator.samba.org/service=%s", s.serverGroupName())
+	pod, err := s.tc.GetPodByLabel(ctx, label, testNamespace)
+	require.NoError(err)
+	require.NoError(s.tc.Clientset().CoreV1().Pods(testNamespace).Delete(
+		ctx, pod.Name, metav1.DeleteOptions{}))
+	require.Eventually(func() bool {
+		p, err := s.tc.GetPodByLabel(ctx, label, testNamespace)
+		return err == nil && p.Name != pod.Name && kube.PodIsReady(p)
+	}, 3*time.Minute, 2*time.Second, "pod %s not replaced", pod.Name)
+
+	ip, err = s.getPodIP()
+	require.NoError(err)
+	share.Host = smbclient.Host(ip)
+	aces, err := client.GetACL(ctx, share, auth, fname)
+	require.NoError(err)
+	found := false
+	for _, ace := range aces {
+		if strings.HasPrefix(ace, "ACL:S-1-1-0:ALLOWED/") {
+			found = true
+		}
+	}
+	require.True(found, "ACL entry not persisted: %v", aces)
+}
+
+type SmbShareWithDosAttributesSuite struct {
+	SmbShareSuite
+}
+
+// TestDosAttributesPreserved verifies that a DOS attribute set on a file
+// over SMB is stored and returned by later connections to the share.
+func (s *SmbShareWithDosAttributesSuite) TestDosAttributesPreserved() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	auth := s.testAuths[0]
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	fname := fmt.Sprintf("dos-%d.jpeg", time.Now().UnixNano())
+	require.NoError(client.PutFile(ctx, share, auth, "profile.jpeg", fname))
+	require.NoError(client.SetMode(ctx, share, auth, fname, "+h"))
+
+	attrs, err := client.GetAttributes(ctx, share, auth, fname)
+	require.NoError(err)
+	require.Contains(attrs, "H", "hidden attribute not preserved")
+}
+
+// TestArchiveBitPersisted verifies that the archive attribute of a file can
+// be set and cleared over SMB, as backup tools relying on it do, and that
+// later connections see the change.
+func (s *SmbShareWithDosAttributesSuite) TestArchiveBitPersisted() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	auth := s.testAuths[0]
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	fname := fmt.Sprintf("archive-%d.jpeg", time.Now().UnixNano())
+	require.NoError(client.PutFile(ctx, share, auth, "profile.jpeg", fname))
+
+	require.NoError(client.SetMode(ctx, share, auth, fname, "-a"))
+	attrs, err := client.GetAttributes(ctx, share, auth, fname)
+	require.NoError(err)
+	require.NotContains(attrs, "A", "archive attribute not cleared")
+
+	require.NoError(client.SetMode(ctx, share, auth, fname, "+a"))
+	attrs, err = client.GetAttributes(ctx, share, auth, fname)
+	require.NoError(err)
+	require.Contains(attrs, "A", "archive attribute not set")
+
+	require.NoError(client.SetMode(ctx, share, auth, fname, "-a"))
+	attrs, err = client.GetAttributes(ctx, share, auth, fname)
+	require.NoError(err)
+	require.NotContains(attrs, "A", "archive attribute set again")
+}
+
+type SmbSharePosixExtensionsSuite struct {
+	SmbShareSuite
+}
+
+// TestExtensionsAdvertised verifies that the server of a share with the
+// POSIX extensions is configured to advertise them to clients.
+func (s *SmbSharePosixExtensionsSuite) TestExtensionsAdvertised() {
+	ctx := context.TODO()
+	require := s.Require()
+	out, err := s.sambaExec(ctx,
+		"samba-container print-config | grep -i 'smb3 unix extensions'")
+	require.NoError(err)
+	require.Contains(strings.ToLower(out), "smb3 unix extensions = yes")
+}
+
+type SmbShareDeleteReadonlySuite struct {
+	SmbShareSuite
+
+	// deleteReadonly is true if the share sets deleteReadonly.
+	deleteReadonly bool
+}
+
+// TestDeleteReadonlyFile verifies that a file with the read-only attribute
+// can be deleted over SMB only if the share sets deleteReadonly.
+func (s *SmbShareDeleteReadonlySuite) TestDeleteReadonlyFile() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	auth := s.testAuths[0]
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	fname := fmt.Sprintf("readonly-%d.jpeg", time.Now().UnixNano())
+	require.NoError(client.PutFile(ctx, share, auth, "profile.jpeg", fname))
+	require.NoError(client.SetMode(ctx, share, auth, fname, "+r"))
+	attrs, err := client.GetAttributes(ctx, share, auth, fname)
+	require.NoError(err)
+	require.Contains(attrs, "R", "read-only attribute not set")
+
+	err = client.DeleteFile(ctx, share, auth, fname)
+	if s.deleteReadonly {
+		require.NoError(err, "read-only file not deleted")
+		return
+	}
+	require.Error(err, "read-only file deleted")
+	require.NoError(client.SetMode(ctx, share, auth, fname, "-r"))
+	require.NoError(client.DeleteFile(ctx, share, auth, fname))
+}
+
+type SmbShareWithAntivirusSuite struct {
+	SmbShareSuite
+}
+
+// TestInfectedFileBlocked verifies that a file the scanner finds infected,
+// here a mock clamd finding every file named infected-* infected, is
+// quarantined once uploaded, so that clients can no longer read it, and is
+// logged for the operator, while clean files can be read back.
+func (s *SmbShareWithAntivirusSuite) TestInfectedFileBlocked() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	auth := s.testAuths[0]
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	now := time.Now().UnixNano()
+	clean := fmt.Sprintf("clean-%d.jpeg", now)
+	require.NoError(client.PutFile(ctx, share, auth, "profile.jpeg", clean))
+	require.NoError(client.GetFile(ctx, share, auth, clean, "/tmp/"+clean),
+		"clean file not readable")
+
+	infected := fmt.Sprintf("infected-%d.jpeg", now)
+	// the upload is scanned when it is closed
+	_ = client.PutFile(ctx, share, auth, "profile.jpeg", infected)
+	err = client.GetFile(ctx, share, auth, infected, "/tmp/"+infected)
+	require.Error(err, "infected file readable")
+
+	out, err := s.sambaExec(ctx, "cat /run/antivirus/tshare40.infected")
+	require.NoError(err)
+	require.Contains(out, infected)
+	require.Contains(out, "Mock-Test-Signature")
+}
+
+type SmbShareWithHostsAllowSuite struct {
+	SmbShareSuite
+}
+
+// TestShareAccessByIP replaces the common share access tests, as the test
+// clients are not allowed by the share.
+func (s *SmbShareWithHostsAllowSuite) TestShareAccessByIP() {
+	s.T().Skip("the test clients are not allowed to connect to the share")
+}
+
+// TestShareAccessByServiceName replaces the common share access tests.
+func (s *SmbShareWithHostsAllowSuite) TestShareAccessByServiceName() {
+	s.T().Skip("the test clients are not allowed to connect to the share")
+}
+
+// TestClientRefused verifies that a client missing from the hosts allowed
+// by the share is refused, even with valid credentials.
+func (s *SmbShareWithHostsAllowSuite) TestClientRefused() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	err = client.PutFile(ctx, share, s.testAuths[0], "profile.jpeg", "refused.jpeg")
+	require.Error(err)
+	require.True(smbclient.IsAccessDenied(err),
+		"expected access to be denied: %v", err)
+}
+
+type SmbShareHomesSuite struct {
+	SmbShareSuite
+
+	// users each with their own home directory.
+	users []smbclient.Auth
+}
+
+func (s *SmbShareHomesSuite) home(user string) smbclient.Share {
+	ip, err := s.getPodIP()
+	s.Require().NoError(err)
+	return smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: user,
+	}
+}
+
+// TestOwnHomeOnly verifies that each user sees only the files in their own
+// home directory.
+func (s *SmbShareHomesSuite) TestOwnHomeOnly() {
+	ctx := context.TODO()
+	require := s.Require()
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	for _, auth := range s.users {
+		fname := fmt.Sprintf("%s.jpeg", auth.Username)
+		require.NoError(client.PutFile(
+			ctx, s.home(auth.Username), auth, "profile.jpeg", fname))
+	}
+	for _, auth := range s.users {
+		out, err := client.CommandOutput(
+			ctx, s.home(auth.Username), auth, []string{"ls"})
+		require.NoError(err)
+		for _, other := range s.users {
+			fname := fmt.Sprintf("%s.jpeg", other.Username)
+			if other.Username == auth.Username {
+				require.Contains(string(out), fname)
+			} else {
+				require.NotContains(string(out), fname)
+			}
+		}
+	}
+}
+
+// TestOtherHomeDenied verifies that users can not connect to the home
+// directories of other users.
+func (s *SmbShareHomesSuite) TestOtherHomeDenied() {
+	ctx := context.TODO()
+	require := s.Require()
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	a, b := s.users[0], s.users[1]
+	require.NoError(smbclient.CheckDenied(
+		client.PutFile(ctx, s.home(b.Username), a, "profile.jpeg", "x.jpeg")))
+	require.NoError(smbclient.CheckDenied(
+		client.PutFile(ctx, s.home(a.Username), b, "profile.jpeg", "x.jpeg")))
+}
+
+type SmbShareWithVetoFilesSuite struct {
+	SmbShareSuite
+}
+
+// TestVetoedFileNotCreated verifies that files matching the veto patterns
+// of the share can not be created, and that hidden files are not listed.
+func (s *SmbShareWithVetoFilesSuite) TestVetoedFileNotCreated() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	auth := s.testAuths[0]
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	for _, fname := range []string{"Thumbs.db", "upload.tmp"} {
+		require.Error(client.PutFile(ctx, share, auth, "profile.jpeg", fname))
+	}
+	require.NoError(
+		client.PutFile(ctx, share, auth, "profile.jpeg", "desktop.ini"))
+	out, err := client.CommandOutput(ctx, share, auth, []string{"ls"})
+	require.NoError(err)
+	require.NotContains(string(out), "Thumbs.db")
+	require.NotContains(string(out), "upload.tmp")
+	require.NotContains(string(out), "desktop.ini")
+}
+
+type SmbShareCaseInsensitiveSuite struct {
+	SmbShareSuite
+}
+
+// TestNamesDifferingByCase verifies that, on a case insensitive share,
+// writing a file whose name differs from an existing file's only by case
+// replaces the existing file, which keeps the case of its original name.
+func (s *SmbShareCaseInsensitiveSuite) TestNamesDifferingByCase() {
+	ctx := context.TODO()
+	require := s.Require()
+	ip, err := s.getPodIP()
+	require.NoError(err)
+	share := smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+	auth := s.testAuths[0]
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	require.NoError(client.PutFile(ctx, share, auth, "profile.jpeg", "File.txt"))
+	require.NoError(client.PutFile(ctx, share, auth, "profile.jpeg", "file.txt"))
+	out, err := client.CommandOutput(ctx, share, auth, []string{"ls"})
+	require.NoError(err)
+	require.Contains(string(out), "File.txt")
+	require.NotContains(string(out), "file.txt")
+}
+
+type SmbShareDropBoxSuite struct {
+	SmbShareSuite
+}
+
+func (s *SmbShareDropBoxSuite) share() smbclient.Share {
+	ip, err := s.getPodIP()
+	s.Require().NoError(err)
+	return smbclient.Share{
+		Host: smbclient.Host(ip),
+		Name: s.shareName,
+	}
+}
+
+// TestShareAccessByIP replaces the common share access tests, which read
+// back the files they write.
+func (s *SmbShareDropBoxSuite) TestShareAccessByIP() {
+	s.T().Skip("files can not be read back from a dropbox share")
+}
+
+// TestShareAccessByServiceName replaces the common share access tests.
+func (s *SmbShareDropBoxSuite) TestShareAccessByServiceName() {
+	s.T().Skip("files can not be read back from a dropbox share")
+}
+
+// TestAnonymousWrite verifies that anonymous clients can add files to the
+// share, but can neither read nor list the files added.
+func (s *SmbShareDropBoxSuite) TestAnonymousWrite() {
+	ctx := context.TODO()
+	require := s.Require()
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+	share := s.share()
+	anon := smbclient.Auth{}
+
+	fname := fmt.Sprintf("drop-%d.jpeg", time.Now().UnixNano())
+	require.NoError(client.PutFile(ctx, share, anon, "profile.jpeg", fname))
+	require.NoError(smbclient.CheckDenied(
+		client.GetFile(ctx, share, anon, fname, "/tmp/"+fname)))
+	out, err := client.CommandOutput(ctx, share, anon, []string{"ls"})
+	require.NoError(err)
+	require.NotContains(string(out), fname)
+
+	// users logging in are treated as guests as well
+	for _, auth := range s.testAuths {
+		require.NoError(smbclient.CheckDenied(
+			client.GetFile(ctx, share, auth, fname, "/tmp/"+fname)))
+	}
+}
+
+type SmbShareGuestAccountSuite struct {
+	SmbShareDropBoxSuite
+
+	// guestAccount is the user guests are mapped to.
+	guestAccount string
+}
+
+// TestAnonymousFilesOwnedByGuestAccount verifies that the files anonymous
+// clients add to the share are owned by the guest account on the volume.
+func (s *SmbShareGuestAccountSuite) TestAnonymousFilesOwnedByGuestAccount() {
+	ctx := context.TODO()
+	require := s.Require()
+	client := smbclient.MustPodClient(testNamespace, "smbclient")
+	require.NoError(client.CacheFlush(ctx))
+
+	fname := fmt.Sprintf("guest-%d.jpeg", time.Now().UnixNano())
+	require.NoError(client.PutFile(
+		ctx, s.share(), smbclient.Auth{}, "profile.jpeg", fname))
+	owner, err := s.fileOwner(ctx, fname)
+	require.NoError(err)
+	require.Equal(s.guestAccount, owner)
+}
+
+type SmbShareGroupSuite struct {
+	SmbShareSuite
+
+	// otherShareName is the name of a second share served by the same
+	// server group.
+	otherShareName string
+}
+
+// TestSingleDeployment verifies that the shares of the server group are
+// served by a single deployment named after the group.
+func (s *SmbShareGroupSuite) TestSingleDeployment() {
+	l, err := s.tc.Clientset().AppsV1().Deployments(testNamespace).List(
+		context.TODO(),
+		metav1.ListOptions{
+			LabelSelector: fmt.Sprintf(
+				"samba-operator.samba.org/service=%s", s.serverGroupName()),
+		})
+	s.Require().NoError(err)
+	s.Require().Len(l.Items, 1)
+	s.Require().Equal(s.serverGroupName(), l.Items[0].Name)
+}
+
+func (s *SmbShareGroupSuite) TestOtherShareAccess() {
+	ip, err := s.getPodIP()
+	s.Require().NoError(err)
+	shareAccessSuite := ShareAccessSuite{
+		share: smbclient.Share{
+			Host: smbclient.Host(ip),
+			Name: s.otherShareName,
+		},
+		auths: s.testAuths,
+	}
+	runShareAccessSuites(s.T(), shareAccessSuite, s.protocols)
+}
+
+type SmbShareDeleteSuite struct {
+	SmbShareSuite
+}
+
+// TestDeleteCleansUp verifies that deleting an SmbShare removes all of the
+// resources the operator created for it.
+func (s *SmbShareDeleteSuite) TestDeleteCleansUp() {
+	require := s.Require()
+	ctx, cancel := context.WithDeadline(
+		context.TODO(),
+		time.Now().Add(120*time.Second))
+	defer cancel()
+
+	shareGVK := schema.GroupVersionKind{
+		Group:   "samba-operator.samba.org",
+		Version: "v1alpha1",
+		Kind:    "SmbShare",
+	}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(shareGVK)
+	dc, err := s.tc.DynamicClientset(u)
+	require.NoError(err)
+	err = dc.Namespace(s.smbShareResource.Namespace).Delete(
+		ctx, s.smbShareResource.Name, metav1.DeleteOptions{})
+	require.NoError(err)
+
+	children := []struct {
+		gvk  schema.GroupVersionKind
+		name string
+	}{
+		{appsv1.SchemeGroupVersion.WithKind("Deployment"), s.smbShareResource.Name},
+		{corev1.SchemeGroupVersion.WithKind("Service"), s.smbShareResource.Name},
+		{
+			corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"),
+			s.smbShareResource.Name + "-pvc",
+		},
+	}
+	for _, c := range children {
+		require.NoError(kube.WaitForResourceDeleted(
+			ctx, s.tc, c.gvk,
+			types.NamespacedName{Namespace: testNamespace, Name: c.name}))
+	}
+	require.NoError(kube.WaitForResourceDeleted(
+		ctx, s.tc, shareGVK, s.smbShareResource))
+}
+
+func allSmbShareSuites() map[string]suite.TestingSuite {
+	m := map[string]suite.TestingSuite{}
+	m["users1"] = &SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare1.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare1"},
+		shareName:        "My Share",
+		shareHidden:      true,
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}
+
+	m["domainMember1"] = &SmbShareWithDNSSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "joinsecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig2.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare2.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare2"},
+			shareName:        "My Kingdom",
+			testAuths: []smbclient.Auth{{
+				Username: "DOMAIN1\\bwayne",
+				Password: "1115Rose.",
+			}},
+		},
+		dnsAliases: []string{"tshare2-alias"},
+		kerberosAuths: []smbclient.Auth{{
+			Username:    "bwayne@DOMAIN1.SINK.TEST",
+			Password:    "1115Rose.",
+			UseKerberos: true,
+		}},
+	}
+
+	// trusted domains allowed, with the ID ranges of the domains listed.
+	// The test AD has no trusted forest, so only the users of the domain
+	// of the realm are authenticated.
+	m["domainMemberTrustedDomains"] = &SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "joinsecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig8.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare37.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare37"},
+		shareName:        "Trusted",
+		testAuths: []smbclient.Auth{{
+			Username: "DOMAIN1\\bwayne",
+			Password: "1115Rose.",
+		}},
+	}
+
+	// access granted through a domain group, resolved by winbind
+	m["domainMemberGroup"] = &SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "joinsecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig2.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare32.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare32"},
+		shareName:        "Domain Users",
+		testAuths: []smbclient.Auth{{
+			Username: "DOMAIN1\\bwayne",
+			Password: "1115Rose.",
+		}},
+	}
+
+	// Test that the operator functions when the SmbShare resources are created
+	// in a different ns (for example, "default").
+	// IMPORTANT: the secrets MUST be in the same namespace as the pods.
+	m["smbSharesInDefault"] = &SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: "default",
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare3.yaml"),
+				Namespace: "default",
+			},
+		},
+		smbShareResource: types.NamespacedName{"default", "tshare3"},
+		shareName:        "My Other Share",
+		shareHidden:      true,
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}
+
+	m["shareWithComment"] = &SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare5.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare5"},
+		shareName:        "Described",
+		shareComment:     "Team files — Büro 4",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}
+
+	m["shareReadOnly"] = &SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare41.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare41"},
+		shareName:        "Read Only",
+		shareReadOnly:    true,
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}
+
+	m["shareWithAccessControl"] = &SmbShareWithAccessControlSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare6.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare6"},
+			shareName:        "Restricted",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		},
+		writer:  smbclient.Auth{Username: "alice", Password: "wond3r1and"},
+		reader:  smbclient.Auth{Username: "bob", Password: "r0b0t"},
+		invalid: smbclient.Auth{Username: "carol", Password: "Xm4sd4y"},
+	}
+
+	m["shareWithLocalGroup"] = &SmbShareWithLocalGroupSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig5.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare24.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare24"},
+			shareName:        "Staff Only",
+			testAuths: []smbclient.Auth{{
+				Username: "alice",
+				Password: "wond3r1and",
+			}},
+		},
+		member:    smbclient.Auth{Username: "bob", Password: "r0b0t"},
+		nonMember: smbclient.Auth{Username: "carol", Password: "Xm4sd4y"},
+	}
+
+	m["shareWithSmbUsers"] = &SmbShareWithLocalGroupSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "smbusers1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig6.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare25.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare25"},
+			shareName:        "Editors",
+			testAuths: []smbclient.Auth{{
+				Username: "erin",
+				Password: "3r1n-pw",
+			}},
+		},
+		member:    smbclient.Auth{Username: "erin", Password: "3r1n-pw"},
+		nonMember: smbclient.Auth{Username: "frank", Password: "fr4nk-pw"},
+	}
+
+	// users imported from an smbpasswd file keep their passwords
+	m["shareWithImportedUsers"] = &SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig7.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare34.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare34"},
+		shareName:        "Migrated",
+		testAuths: []smbclient.Auth{
+			{
+				Username: "alice",
+				Password: "wond3r1and",
+			},
+			{
+				Username: "bob",
+				Password: "r0b0t",
+			},
+		},
+	}
+
+	m["shareWithFileModes"] = &SmbShareWithFileModesSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare8.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare8"},
+			shareName:        "Shared Modes",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		},
+		fileMode: "664",
+	}
+
+	m["shareWithWideLinks"] = &SmbShareWithSymlinksSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare16.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare16"},
+			shareName:        "Wide Links",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		},
+		wideLinks: true,
+	}
+
+	m["shareWithoutWideLinks"] = &SmbShareWithSymlinksSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare17.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare17"},
+			shareName:        "Narrow Links",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		},
+		wideLinks: false,
+	}
+
+	m["shareWithForceUser"] = &SmbShareForceUserSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare18.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare18"},
+			shareName:        "Forced",
+			testAuths: []smbclient.Auth{{
+				Username: "alice",
+				Password: "wond3r1and",
+			}},
+		},
+		forceUser: "sambauser",
+	}
+
+	m["shareWithInheritOwner"] = &SmbShareInheritOwnerSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare30.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare30"},
+		shareName:        "Team",
+		testAuths: []smbclient.Auth{{
+			Username: "alice",
+			Password: "wond3r1and",
+		}},
+	}}
+
+	m["shareWithMSDFS"] = &SmbShareMSDFSSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare31.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare31"},
+		shareName:        "Namespace",
+		testAuths: []smbclient.Auth{{
+			Username: "alice",
+			Password: "wond3r1and",
+		}},
+	}}
+
+	m["shareWithAuthentication"] = &SmbShareWithAuthenticationSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig3.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare21.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare21"},
+		shareName:        "Hardened",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}}
+
+	m["shareWithCustomConfig"] = &SmbShareWithCustomConfigSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "customconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "commonconfig2.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare22.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare22"},
+			shareName:        "Custom",
+			shareComment:     "Served from a custom smb.conf",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		},
+		generatedShareName: "Generated",
+	}
+
+	m["shareWithSecurityUpdate"] = &SmbShareWithSecurityUpdateSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "userssecret2.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig4.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare23.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare23"},
+			shareName:        "Updated",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		},
+		updatedAuths: []smbclient.Auth{{
+			Username: "dave",
+			Password: "d1amond",
+		}},
+	}
+
+	m["shareWithConnections"] = &SmbShareWithConnectionsSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare19.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare19"},
+		shareName:        "Counted",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}}
+
+	m["shareWithEncryption"] = &SmbShareWithEncryptionSuite{
+		SmbShareWithConnectionsSuite{SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare33.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare33"},
+			shareName:        "Encrypted",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		}},
+	}
+
+	m["shareWithACLs"] = &SmbShareWithACLsSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare9.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare9"},
+		shareName:        "With ACLs",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}}
+
+	m["shareWithWindowsEditing"] = &SmbShareWithWindowsEditingSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare35.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare35"},
+		shareName:        "Windows Editing",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}}
+
+	m["shareWithPort"] = &SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare12.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare12"},
+		shareName:        "Other Port",
+		port:             4450,
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}
+
+	// the share's directory is created on the new, empty, volume
+	m["shareWithPath"] = &SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare20.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare20"},
+		shareName:        "Nested",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}
+
+	m["shareWithHomes"] = &SmbShareHomesSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare10.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare10"},
+			// a user's home is shared under their own name
+			shareName: "sambauser",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		},
+		users: []smbclient.Auth{
+			{Username: "alice", Password: "wond3r1and"},
+			{Username: "bob", Password: "r0b0t"},
+		},
+	}
+
+	m["shareWithVetoFiles"] = &SmbShareWithVetoFilesSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare14.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare14"},
+		shareName:        "Vetoed",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}}
+
+	m["shareCaseInsensitive"] = &SmbShareCaseInsensitiveSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare15.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare15"},
+		shareName:        "No Case",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}}
+
+	m["shareDropBox"] = &SmbShareDropBoxSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare13.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare13"},
+		shareName:        "Drop Box",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}}
+
+	m["shareGuestAccount"] = &SmbShareGuestAccountSuite{
+		SmbShareDropBoxSuite: SmbShareDropBoxSuite{SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare36.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare36"},
+			shareName:        "Guest Drop",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		}},
+		guestAccount: "alice",
+	}
+
+	m["shareGroup"] = &SmbShareGroupSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare11.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare11a"},
+			serverGroup:      "tgroup1",
+			shareName:        "Group A",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		},
+		otherShareName: "Group B",
+	}
+
+	m["deleteShare"] = &SmbShareDeleteSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare7.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare7"},
+		shareName:        "Short Lived",
+	}}
+
+	m["smbSharesExternal"] = &SmbShareWithExternalNetSuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "commonconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare4.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare4"},
+			shareName:        "Since When",
+			shareHidden:      true,
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		},
+		dnsName: "tshare4.files.example.test",
+	}
+
+	m["shareWithDosAttributes"] = &SmbShareWithDosAttributesSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare27.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare27"},
+		shareName:        "Attributes",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}}
+
+	m["shareWithPosixExtensions"] = &SmbSharePosixExtensionsSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare38.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare38"},
+		shareName:        "Posix",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}}
+
+	m["shareWithDeleteReadonly"] = &SmbShareDeleteReadonlySuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare39.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare39"},
+			shareName:        "Readonly",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		},
+		deleteReadonly: true,
+	}
+
+	// the share of the DOS attributes suite keeps the default
+	m["shareWithoutDeleteReadonly"] = &SmbShareDeleteReadonlySuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare27.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare27"},
+			shareName:        "Attributes",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		},
+	}
+
+	m["shareWithAntivirus"] = &SmbShareWithAntivirusSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "commonconfig5.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare40.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare40"},
+		shareName:        "Scanned",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}}
+
+	m["shareWithHostsAllow"] = &SmbShareWithHostsAllowSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbshare28.yaml"),
+				Namespace: testNamespace,
+			},
+		},
+		smbShareResource: types.NamespacedName{testNamespace, "tshare28"},
+		shareName:        "Restricted",
+		testAuths: []smbclient.Auth{{
+			Username: "sambauser",
+			Password: "1nsecurely",
+		}},
+	}}
+
+	m["shareWithServerIdentity"] = &SmbShareWithServerIdentitySuite{
+		SmbShareSuite: SmbShareSuite{
+			fileSources: []kube.FileSource{
+				{
+					Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "commonconfig3.yaml"),
+					Namespace: testNamespace,
+				},
+				{
+					Path:      path.Join(testFilesDir, "smbshare26.yaml"),
+					Namespace: testNamespace,
+				},
+			},
+			smbShareResource: types.NamespacedName{testNamespace, "tshare26"},
+			shareName:        "Ledgers",
+			testAuths: []smbclient.Auth{{
+				Username: "sambauser",
+				Password: "1nsecurely",
+			}},
+		},
+		serverString: "Accounting files",
+	}
+
+	m["shareStatefulSet"] = &SmbShareStatefulSetSuite{SmbShareSuite{
+		fileSources: []kube.FileSource{
+			{
+				Path:      path.Join(testFilesDir, "userssecret1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "smbsecurityconfig1.yaml"),
+				Namespace: testNamespace,
+			},
+			{
+				Path:      path.Join(testFilesDir, "commonconfig4.yaml"),
 				Namespace: testNamespace,
 			},
 			{
-				Path:      path.Join(testFilesDir, "smbshare4.yaml"),
+				Path:      path.Join(testFilesDir, "smbshare29.yaml"),
 				Namespace: testNamespace,
 			},
 		},
-		smbShareResource: types.NamespacedName{testNamespace, "tshare4"},
-		shareName:        "Since When",
+		smbShareResource: types.NamespacedName{testNamespace, "tshare29"},
+		shareName:        "Stable",
 		testAuths: []smbclient.Auth{{
 			Username: "sambauser",
 			Password: "1nsecurely",
 		}},
+		workloadType: "statefulset",
 	}}
 
 	return m
@@ -0,0 +1,84 @@
+// +build integration
+
+package integration
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/suite"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/samba-in-kubernetes/samba-operator/tests/utils/kube"
+)
+
+type SmbUserSuite struct {
+	suite.Suite
+
+	// cached values
+	tc *kube.TestClient
+}
+
+func (s *SmbUserSuite) SetupSuite() {
+	s.tc = kube.NewTestClient("")
+}
+
+// TestInvalidSmbUserRejected verifies that the API server rejects SmbUsers
+// that the CRD schema does not allow.
+func (s *SmbUserSuite) TestInvalidSmbUserRejected() {
+	require := s.Require()
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "samba-operator.samba.org",
+		Version: "v1alpha1",
+		Kind:    "SmbUser",
+	})
+	dc, err := s.tc.DynamicClientset(u)
+	require.NoError(err)
+
+	password := map[string]interface{}{"secret": "smbuser-passwords"}
+	invalid := map[string]map[string]interface{}{
+		"no-security-config": {
+			"password": password,
+		},
+		"no-password": {
+			"securityConfig": "sharesec6",
+		},
+		"no-password-secret": {
+			"securityConfig": "sharesec6",
+			"password":       map[string]interface{}{"key": "erin"},
+		},
+		"bad-username": {
+			"securityConfig": "sharesec6",
+			"username":       "erin:x",
+			"password":       password,
+		},
+		"long-username": {
+			"securityConfig": "sharesec6",
+			"username":       "a-user-name-longer-than-32-characters",
+			"password":       password,
+		},
+		"bad-uid": {
+			"securityConfig": "sharesec6",
+			"uid":            int64(0),
+			"password":       password,
+		},
+	}
+	for name, spec := range invalid {
+		obj := u.DeepCopy()
+		obj.SetName(name)
+		obj.Object["spec"] = spec
+		_, err := dc.Namespace(testNamespace).Create(
+			context.TODO(), obj, metav1.CreateOptions{})
+		s.Truef(kerrors.IsInvalid(err),
+			"SmbUser %s not rejected as invalid: %v", name, err)
+	}
+}
+
+func allSmbUserSuites() map[string]suite.TestingSuite {
+	m := map[string]suite.TestingSuite{}
+	m["validation"] = &SmbUserSuite{}
+	return m
+}
@@ -3,8 +3,10 @@ package kube
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -19,6 +21,15 @@ var (
 	// ErrMultipleMatchingPods indicates a selector should have matched
 	// fewer pods than were selected.
 	ErrMultipleMatchingPods = errors.New("too many pods match selector")
+
+	// ErrNoMatchingDeployments indicates a selector didn't match any
+	// deployments.
+	ErrNoMatchingDeployments = errors.New("no deployments match selector")
+
+	// ErrMultipleMatchingDeployments indicates a selector should have
+	// matched fewer deployments than were selected.
+	ErrMultipleMatchingDeployments = errors.New(
+		"too many deployments match selector")
 )
 
 // TestClient is a helper for doing common things for our tests
@@ -53,6 +64,28 @@ func (tc *TestClient) GetPodByLabel(
 	return &l.Items[0], nil
 }
 
+// GetDeploymentByLabel gets a single unique deployment given a label selector
+// and namespace.
+func (tc *TestClient) GetDeploymentByLabel(
+	ctx context.Context, labelSelector string, ns string) (
+	*appsv1.Deployment, error) {
+	// ---
+	opts := metav1.ListOptions{
+		LabelSelector: labelSelector,
+	}
+	l, err := tc.Clientset().AppsV1().Deployments(ns).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(l.Items) > 1 {
+		return nil, ErrMultipleMatchingDeployments
+	}
+	if len(l.Items) == 0 {
+		return nil, ErrNoMatchingDeployments
+	}
+	return &l.Items[0], nil
+}
+
 // NewTestClient return a new kube util test client.
 func NewTestClient(kubeconfig string) *TestClient {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
@@ -130,3 +163,45 @@ func WaitForPodExistsByLabel(
 	}
 	return nil
 }
+
+// DeploymentIsReady returns true if all of the desired replicas of the
+// deployment's current generation are ready.
+func DeploymentIsReady(d *appsv1.Deployment) bool {
+	var desired int32 = 1
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	return d.Status.ObservedGeneration >= d.Generation &&
+		d.Status.UpdatedReplicas == desired &&
+		d.Status.ReadyReplicas == desired
+}
+
+// WaitForDeploymentReadyByLabel will wait for a deployment to be ready, up
+// to the deadline specified by the context, if the context lacks a deadline
+// the call will block indefinitely. The label given must match only one
+// deployment, or an error will be returned.
+func WaitForDeploymentReadyByLabel(
+	ctx context.Context, tc *TestClient, label, ns string) error {
+	// ---
+	for {
+		d, err := tc.GetDeploymentByLabel(ctx, label, ns)
+		if err != nil && !errors.Is(err, ErrNoMatchingDeployments) {
+			return err
+		}
+		if err == nil && DeploymentIsReady(d) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			if d == nil {
+				return fmt.Errorf(
+					"no deployment matching %q in %s: %w", label, ns, err)
+			}
+			return fmt.Errorf(
+				"deployment %s/%s not ready (%d/%d replicas ready): %w",
+				d.Namespace, d.Name,
+				d.Status.ReadyReplicas, d.Status.Replicas, err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return nil
+}
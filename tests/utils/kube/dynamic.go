@@ -3,8 +3,10 @@ package kube
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"time"
 
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -265,3 +267,33 @@ func useNamespace(
 	}
 	return nri
 }
+
+// WaitForResourceDeleted will wait for the resource of the given kind and
+// name to no longer exist, up to the deadline specified by the context, if
+// the context lacks a deadline the call will block indefinitely.
+func WaitForResourceDeleted(
+	ctx context.Context, tc *TestClient,
+	gvk schema.GroupVersionKind, nsname types.NamespacedName) error {
+	// ---
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	dr, mapping, err := tc.dynamicClientsetMapping(u)
+	if err != nil {
+		return err
+	}
+	ri := useNamespace(dr, mapping, chooseNamespace(nsname.Namespace))
+	for {
+		_, err := ri.Get(ctx, nsname.Name, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%s %s still exists: %w", gvk.Kind, nsname, err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package smbclient
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var (
+	// ErrAccessDenied indicates the server refused the operation due to
+	// insufficient permissions (including writes to read-only shares).
+	ErrAccessDenied = errors.New("access denied")
+
+	// ErrConnectionFailed indicates the client could not establish or
+	// maintain a connection to the server.
+	ErrConnectionFailed = errors.New("connection failed")
+
+	// ErrLogonFailed indicates the server rejected the credentials.
+	ErrLogonFailed = errors.New("logon failed")
+
+	// ErrTicketFailed indicates that no kerberos ticket could be obtained
+	// for the user, before connecting to the server.
+	ErrTicketFailed = errors.New("kerberos ticket acquisition failed")
+)
+
+var ntStatusRE = regexp.MustCompile(`NT_STATUS_[A-Z0-9_]+`)
+
+// statusClasses maps NT_STATUS codes, as reported by smbclient, to the
+// general error categories tests are expected to care about.
+var statusClasses = map[string]error{
+	"NT_STATUS_ACCESS_DENIED":           ErrAccessDenied,
+	"NT_STATUS_MEDIA_WRITE_PROTECTED":   ErrAccessDenied,
+	"NT_STATUS_NETWORK_ACCESS_DENIED":   ErrAccessDenied,
+	"NT_STATUS_CANNOT_DELETE":           ErrAccessDenied,
+	"NT_STATUS_LOGON_FAILURE":           ErrLogonFailed,
+	"NT_STATUS_ACCOUNT_DISABLED":        ErrLogonFailed,
+	"NT_STATUS_CONNECTION_REFUSED":      ErrConnectionFailed,
+	"NT_STATUS_CONNECTION_RESET":        ErrConnectionFailed,
+	"NT_STATUS_CONNECTION_DISCONNECTED": ErrConnectionFailed,
+	"NT_STATUS_HOST_UNREACHABLE":        ErrConnectionFailed,
+	"NT_STATUS_NETWORK_UNREACHABLE":     ErrConnectionFailed,
+	"NT_STATUS_IO_TIMEOUT":              ErrConnectionFailed,
+	"NT_STATUS_UNSUCCESSFUL":            ErrConnectionFailed,
+	"NT_STATUS_BAD_NETWORK_NAME":        ErrConnectionFailed,
+}
+
+// Error is returned by smb operations that fail, carrying the NT_STATUS
+// code reported by smbclient, if any.
+type Error struct {
+	// Status is the NT_STATUS code found in the smbclient output.
+	Status string
+	// Output is the combined output of the smbclient command.
+	Output string
+	// Err is the error returned executing the command.
+	Err error
+
+	class error
+}
+
+func (e *Error) Error() string {
+	s := e.Status
+	if s == "" {
+		s = "unknown status"
+	}
+	return fmt.Sprintf("smb operation failed: %s: %v [stdio: %s]",
+		s, e.Err, e.Output)
+}
+
+// Unwrap returns the error category, allowing the use of errors.Is with
+// ErrAccessDenied, ErrConnectionFailed, etc.
+func (e *Error) Unwrap() error {
+	if e.class != nil {
+		return e.class
+	}
+	return e.Err
+}
+
+func newError(out []byte, err error) *Error {
+	e := &Error{Output: string(out), Err: err}
+	// use the last status in the output as it is typically the one
+	// associated with the final (failing) command.
+	if found := ntStatusRE.FindAllString(e.Output, -1); len(found) > 0 {
+		e.Status = found[len(found)-1]
+		e.class = statusClasses[e.Status]
+	}
+	return e
+}
+
+// IsAccessDenied returns true if the error was caused by the server
+// denying access to a resource.
+func IsAccessDenied(err error) bool {
+	return errors.Is(err, ErrAccessDenied)
+}
+
+// IsConnectionFailed returns true if the error was caused by a failure to
+// connect to the server.
+func IsConnectionFailed(err error) bool {
+	return errors.Is(err, ErrConnectionFailed)
+}
+
+// IsTicketFailed returns true if the error was caused by a failure to
+// obtain a kerberos ticket, rather than by the server.
+func IsTicketFailed(err error) bool {
+	return errors.Is(err, ErrTicketFailed)
+}
+
+// CheckDenied returns nil if err indicates that the operation was denied
+// by the server. Otherwise it returns an error describing what happened
+// instead, including if the operation unexpectedly succeeded.
+func CheckDenied(err error) error {
+	switch {
+	case err == nil:
+		return errors.New("operation succeeded but was expected to be denied")
+	case IsAccessDenied(err):
+		return nil
+	default:
+		return fmt.Errorf("operation failed for a reason other than access denied: %w", err)
+	}
+}
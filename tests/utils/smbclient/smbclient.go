@@ -3,9 +3,14 @@ package smbclient
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Listing of services from smbclient.
@@ -14,8 +19,64 @@ type Listing []string
 // Host name or ip address for a share.
 type Host string
 
+// HostPort returns a Host for a server listening on a port other than the
+// standard SMB port.
+func HostPort(host string, port int) Host {
+	return Host(net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// split returns the name or address of the host and its port, if any.
+func (h Host) split() (string, string) {
+	name, port, err := net.SplitHostPort(string(h))
+	if err != nil {
+		return string(h), ""
+	}
+	return name, port
+}
+
 func (h Host) String() string {
-	return "//" + string(h)
+	name, _ := h.split()
+	// IPv6 addresses are enclosed in brackets to separate them from the
+	// share name.
+	if ip := net.ParseIP(name); ip != nil && ip.To4() == nil {
+		return "//[" + name + "]"
+	}
+	return "//" + name
+}
+
+// portArgs returns the arguments selecting the port of the host for the
+// samba client tools.
+func (h Host) portArgs() []string {
+	if _, port := h.split(); port != "" {
+		return []string{"--option=smb ports=" + port}
+	}
+	return nil
+}
+
+// Protocol is an SMB protocol dialect, named as by the client min and max
+// protocol parameters of samba.
+type Protocol string
+
+const (
+	// SMB2 is the SMB 2.1 dialect.
+	SMB2 = Protocol("SMB2_10")
+	// SMB3 is the SMB 3.0 dialect.
+	SMB3 = Protocol("SMB3_00")
+	// SMB311 is the SMB 3.1.1 dialect.
+	SMB311 = Protocol("SMB3_11")
+)
+
+// Protocols are the SMB protocols shares are tested with by default.
+var Protocols = []Protocol{SMB2, SMB3, SMB311}
+
+// args returns the arguments making the samba client tools use exactly
+// the protocol. No arguments are needed to let the tools negotiate the
+// protocol.
+func (p Protocol) args() []string {
+	if p == "" {
+		return nil
+	}
+	return []string{"-m", string(p), "--option=client min protocol=" + string(p)}
 }
 
 // Share represents the host and name of an smb share.
@@ -32,21 +93,109 @@ func (s Share) String() string {
 type Auth struct {
 	Username string
 	Password string
+
+	// UseKerberos authenticates with a kerberos ticket, obtained by Kinit,
+	// instead of the password. The Username is then the principal of the
+	// user, for example: bwayne@DOMAIN1.SINK.TEST.
+	UseKerberos bool
+	// Keytab is the path, in the client pod, of a keytab Kinit obtains the
+	// ticket with instead of the password.
+	Keytab string
+	// CCache is the path, in the client pod, of the credentials cache
+	// holding the ticket. A cache of the principal is used if unset.
+	CCache string
+}
+
+// ccache returns the credentials cache holding the kerberos ticket of the
+// user.
+func (a Auth) ccache() string {
+	if a.CCache != "" {
+		return a.CCache
+	}
+	return "/tmp/krb5cc_" + strings.NewReplacer("@", "_", "/", "_", "\\", "_").
+		Replace(a.Username)
+}
+
+// ShareEntry describes a single share listed by a server.
+type ShareEntry struct {
+	// Type of the share, for example: Disk or IPC.
+	Type string
+	// Name of the share.
+	Name string
+	// Comment describing the share.
+	Comment string
+}
+
+// TransferList is a list of the (local) file paths transferred by a
+// recursive get or put.
+type TransferList []string
+
+// TreeFile describes a single file within a local directory tree.
+type TreeFile struct {
+	// Path of the file relative to the top of the tree.
+	Path string
+	// Content of the file.
+	Content string
 }
 
 // SmbClient is an interface that covers common methods for interacting
 // with smbclient when testing.
 type SmbClient interface {
 	List(ctx context.Context, host Host, auth Auth) (Listing, error)
+	// ListShares enumerates the shares advertised by the host.
+	ListShares(ctx context.Context, host Host, auth Auth) ([]ShareEntry, error)
 	Command(ctx context.Context, share Share, auth Auth, cmd []string) error
 	CommandOutput(ctx context.Context, share Share, auth Auth, cmd []string) ([]byte, error)
 	CacheFlush(ctx context.Context) error
+	// MPut recursively copies the local directory localDir into remoteDir
+	// on the share.
+	MPut(ctx context.Context, share Share, auth Auth, localDir, remoteDir string) (TransferList, error)
+	// MGet recursively copies remoteDir on the share to the local
+	// directory localDir.
+	MGet(ctx context.Context, share Share, auth Auth, remoteDir, localDir string) (TransferList, error)
+	// MakeLocalTree creates a new directory tree, local to the smbclient
+	// command, populated with the given files.
+	MakeLocalTree(ctx context.Context, dir string, files []TreeFile) error
+	// DiffLocalTrees returns an error if the contents of the two local
+	// directory trees differ.
+	DiffLocalTrees(ctx context.Context, a, b string) error
+	// PutFile copies the local file localPath to remotePath on the share.
+	PutFile(ctx context.Context, share Share, auth Auth, localPath, remotePath string) error
+	// GetFile copies remotePath on the share to the local file localPath.
+	GetFile(ctx context.Context, share Share, auth Auth, remotePath, localPath string) error
+	// DeleteFile removes remotePath from the share.
+	DeleteFile(ctx context.Context, share Share, auth Auth, remotePath string) error
+	// MakeDir creates the directory remotePath on the share.
+	MakeDir(ctx context.Context, share Share, auth Auth, remotePath string) error
+	// GetACL returns the access control entries of remotePath on the share.
+	// Trustees are given as SIDs.
+	GetACL(ctx context.Context, share Share, auth Auth, remotePath string) ([]string, error)
+	// AddACL adds the access control entry ace, in smbcacls format, to
+	// remotePath on the share.
+	AddACL(ctx context.Context, share Share, auth Auth, remotePath, ace string) error
+	// Kinit obtains the kerberos ticket of a user authenticating with
+	// kerberos in the environment of smbclient. Failures to obtain the
+	// ticket are reported as ErrTicketFailed.
+	Kinit(ctx context.Context, auth Auth) error
+	// SetMode changes the DOS attributes of remotePath on the share. For
+	// example, a mode of "+h" sets the hidden attribute.
+	SetMode(ctx context.Context, share Share, auth Auth, remotePath, mode string) error
+	// GetAttributes returns the DOS attributes of remotePath on the share,
+	// as the letters printed by smbclient, for example "HA".
+	GetAttributes(ctx context.Context, share Share, auth Auth, remotePath string) (string, error)
+	// WaitForHostResolves waits for the name of the host to be resolvable
+	// from the same environment as smbclient.
+	WaitForHostResolves(ctx context.Context, host Host) error
+	// Connect starts a client connecting to the share and keeps its
+	// connection open, idle, until the context is done.
+	Connect(ctx context.Context, share Share, auth Auth) error
 }
 
 type kubectlSmbClientCli struct {
 	kubeconfig string
 	pod        string
 	namespace  string
+	protocol   Protocol
 	prefix     []string
 }
 
@@ -67,14 +216,28 @@ func (ksc *kubectlSmbClientCli) kubectlExecArgs() []string {
 }
 
 func (ksc *kubectlSmbClientCli) baseArgs(auth Auth) []string {
+	return ksc.toolArgs("smbclient", auth)
+}
+
+// toolArgs returns the arguments needed to run one of the samba client
+// tools, that authenticate like smbclient, in the client pod.
+func (ksc *kubectlSmbClientCli) toolArgs(tool string, auth Auth) []string {
 	cmd := ksc.kubectlExecArgs()
-	cmd = append(cmd, "smbclient")
+	if auth.UseKerberos {
+		// the tools find the ticket obtained by kinit in the cache
+		cmd = append(cmd, "env", "KRB5CCNAME="+auth.ccache(), tool, "-k")
+		return append(cmd, ksc.protocol.args()...)
+	}
+	cmd = append(cmd, tool)
 	if auth.Username != "" && auth.Password != "" {
 		cmd = append(cmd, fmt.Sprintf("-U%s%%%s", auth.Username, auth.Password))
 	} else if auth.Username != "" {
 		cmd = append(cmd, fmt.Sprintf("-U%s", auth.Username))
+	} else {
+		// log in anonymously, without prompting for a password
+		cmd = append(cmd, "-N")
 	}
-	return cmd
+	return append(cmd, ksc.protocol.args()...)
 }
 
 func (ksc *kubectlSmbClientCli) smbclientCmd(
@@ -92,7 +255,7 @@ func (ksc *kubectlSmbClientCli) Command(
 	// ---
 	cstring := strings.Join(shareCmd, "; ")
 	cmd := ksc.smbclientCmd(
-		ctx, auth, []string{share.String(), "-c", cstring})
+		ctx, auth, append(share.Host.portArgs(), share.String(), "-c", cstring))
 	oe, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf(
@@ -108,7 +271,7 @@ func (ksc *kubectlSmbClientCli) CommandOutput(
 	// ---
 	cstring := strings.Join(shareCmd, "; ")
 	cmd := ksc.smbclientCmd(
-		ctx, auth, []string{share.String(), "-c", cstring})
+		ctx, auth, append(share.Host.portArgs(), share.String(), "-c", cstring))
 	o, err := cmd.Output()
 	if err != nil {
 		return o, fmt.Errorf("failed to execute smbclient command: %v: %w",
@@ -117,11 +280,76 @@ func (ksc *kubectlSmbClientCli) CommandOutput(
 	return o, nil
 }
 
+// Connect implements SmbClient. smbclient waits for commands on its
+// standard input, which is left open until the context is done.
+func (ksc *kubectlSmbClientCli) Connect(
+	ctx context.Context, share Share, auth Auth) error {
+	// ---
+	cmd := ksc.smbclientCmd(
+		ctx, auth, append(share.Host.portArgs(), share.String()))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to execute smbclient command: %v: %w",
+			cmd.Args, err)
+	}
+	go func() {
+		<-ctx.Done()
+		stdin.Close()
+		_ = cmd.Wait()
+	}()
+	return nil
+}
+
+// shareOp runs a single smbclient command against the share, returning
+// an *Error on failure.
+func (ksc *kubectlSmbClientCli) shareOp(
+	ctx context.Context, share Share, auth Auth, shareCmd string) error {
+	// ---
+	cmd := ksc.smbclientCmd(
+		ctx, auth, append(share.Host.portArgs(), share.String(), "-c", shareCmd))
+	oe, err := cmd.CombinedOutput()
+	if err != nil {
+		return newError(oe, err)
+	}
+	return nil
+}
+
+func (ksc *kubectlSmbClientCli) PutFile(
+	ctx context.Context, share Share, auth Auth, localPath, remotePath string) error {
+	// ---
+	return ksc.shareOp(ctx, share, auth,
+		fmt.Sprintf("put \"%s\" \"%s\"", localPath, remotePath))
+}
+
+func (ksc *kubectlSmbClientCli) GetFile(
+	ctx context.Context, share Share, auth Auth, remotePath, localPath string) error {
+	// ---
+	return ksc.shareOp(ctx, share, auth,
+		fmt.Sprintf("get \"%s\" \"%s\"", remotePath, localPath))
+}
+
+func (ksc *kubectlSmbClientCli) DeleteFile(
+	ctx context.Context, share Share, auth Auth, remotePath string) error {
+	// ---
+	return ksc.shareOp(ctx, share, auth,
+		fmt.Sprintf("del \"%s\"", remotePath))
+}
+
+func (ksc *kubectlSmbClientCli) MakeDir(
+	ctx context.Context, share Share, auth Auth, remotePath string) error {
+	// ---
+	return ksc.shareOp(ctx, share, auth,
+		fmt.Sprintf("mkdir \"%s\"", remotePath))
+}
+
 func (ksc *kubectlSmbClientCli) List(
 	ctx context.Context, host Host, auth Auth) (Listing, error) {
 	// ---
 	cmd := ksc.smbclientCmd(
-		ctx, auth, []string{"--list", host.String()})
+		ctx, auth, append(host.portArgs(), "--list", host.String()))
 	err := cmd.Run()
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute smbclient command: %v: %w",
@@ -131,20 +359,308 @@ func (ksc *kubectlSmbClientCli) List(
 	return lst, nil
 }
 
+func (ksc *kubectlSmbClientCli) ListShares(
+	ctx context.Context, host Host, auth Auth) ([]ShareEntry, error) {
+	// ---
+	cmd := ksc.smbclientCmd(
+		ctx, auth, append(host.portArgs(), "--grepable", "--list", host.String()))
+	oe, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, newError(oe, err)
+	}
+	return parseShareList(oe), nil
+}
+
+// parseShareList parses the output of a grepable (-g) share listing.
+// Lines that do not describe a share, such as those describing the
+// server or workgroup, are skipped.
+func parseShareList(out []byte) []ShareEntry {
+	entries := []ShareEntry{}
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.SplitN(strings.TrimRight(line, "\r"), "|", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		switch parts[0] {
+		case "Disk", "IPC", "Printer":
+		default:
+			continue
+		}
+		entries = append(entries, ShareEntry{
+			Type:    parts[0],
+			Name:    parts[1],
+			Comment: parts[2],
+		})
+	}
+	return entries
+}
+
+// smbcaclsCmd returns a command running smbcacls against remotePath on the
+// share. SIDs are not resolved to names.
+func (ksc *kubectlSmbClientCli) smbcaclsCmd(
+	ctx context.Context,
+	share Share,
+	auth Auth,
+	remotePath string,
+	args ...string) *exec.Cmd {
+	// ---
+	argv := append(ksc.prefix, ksc.toolArgs("smbcacls", auth)...)
+	argv = append(argv, share.Host.portArgs()...)
+	argv = append(argv, "--numeric", share.String(), remotePath)
+	argv = append(argv, args...)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = nil // avoid blocking on any input
+	return cmd
+}
+
+func (ksc *kubectlSmbClientCli) GetACL(
+	ctx context.Context, share Share, auth Auth, remotePath string) (
+	[]string, error) {
+	// ---
+	cmd := ksc.smbcaclsCmd(ctx, share, auth, remotePath)
+	oe, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, newError(oe, err)
+	}
+	return parseACL(oe), nil
+}
+
+func (ksc *kubectlSmbClientCli) AddACL(
+	ctx context.Context, share Share, auth Auth, remotePath, ace string) error {
+	// ---
+	cmd := ksc.smbcaclsCmd(ctx, share, auth, remotePath, "-a", ace)
+	oe, err := cmd.CombinedOutput()
+	if err != nil {
+		return newError(oe, err)
+	}
+	return nil
+}
+
+// parseACL returns the access control entries, including the "ACL:"
+// prefix, found in the output of smbcacls. Other lines, such as the owner
+// and group of the file, are skipped.
+func parseACL(out []byte) []string {
+	aces := []string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "ACL:") {
+			aces = append(aces, line)
+		}
+	}
+	return aces
+}
+
+func (ksc *kubectlSmbClientCli) SetMode(
+	ctx context.Context, share Share, auth Auth, remotePath, mode string) error {
+	// ---
+	return ksc.shareOp(ctx, share, auth,
+		fmt.Sprintf("setmode \"%s\" %s", remotePath, mode))
+}
+
+func (ksc *kubectlSmbClientCli) GetAttributes(
+	ctx context.Context, share Share, auth Auth, remotePath string) (
+	string, error) {
+	// ---
+	cmd := ksc.smbclientCmd(ctx, auth, append(
+		share.Host.portArgs(),
+		share.String(), "-c", fmt.Sprintf("allinfo \"%s\"", remotePath)))
+	oe, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", newError(oe, err)
+	}
+	return parseAttributes(oe), nil
+}
+
+// parseAttributes returns the attribute letters of the "attributes:" line
+// printed by the allinfo command of smbclient, for example "HA" for the
+// line "attributes: HA (22)".
+func parseAttributes(out []byte) string {
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "attributes:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "attributes:"))
+		if len(fields) > 0 && !strings.HasPrefix(fields[0], "(") {
+			return fields[0]
+		}
+		return ""
+	}
+	return ""
+}
+
+// kinitArgs returns the command obtaining the kerberos ticket of the user,
+// with the keytab of the user or by passing the password to kinit.
+func kinitArgs(auth Auth) []string {
+	if auth.Keytab != "" {
+		return []string{
+			"kinit", "-k", "-t", auth.Keytab, "-c", auth.ccache(), auth.Username,
+		}
+	}
+	return []string{
+		"sh", "-c", `printf '%s\n' "$0" | kinit -c "$1" "$2"`,
+		auth.Password, auth.ccache(), auth.Username,
+	}
+}
+
+func (ksc *kubectlSmbClientCli) Kinit(ctx context.Context, auth Auth) error {
+	if !auth.UseKerberos {
+		return fmt.Errorf("%w: %s does not authenticate with kerberos",
+			ErrTicketFailed, auth.Username)
+	}
+	cmd := ksc.podCmd(ctx, kinitArgs(auth)...)
+	oe, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: kinit %s: %v [stdio: %s]",
+			ErrTicketFailed, auth.Username, err, string(oe))
+	}
+	return nil
+}
+
 // CacheFlush removes any persistent caches used by smbclient.
 func (ksc *kubectlSmbClientCli) CacheFlush(ctx context.Context) error {
+	//cmd := ksc.podCmd(ctx, "net", "cache", "flush")
+	cmd := ksc.podCmd(ctx, "rm", "-f", "/var/lib/samba/lock/gencache.tdb")
+	err := cmd.Run()
+	return err
+}
+
+// podCmd returns a command that will run the given arguments in the
+// same environment as smbclient.
+func (ksc *kubectlSmbClientCli) podCmd(
+	ctx context.Context, args ...string) *exec.Cmd {
+	// ---
 	argv := append(ksc.prefix, ksc.kubectlExecArgs()...)
-	//argv = append(argv, "net", "cache", "flush")
-	argv = append(argv, "rm", "-f", "/var/lib/samba/lock/gencache.tdb")
+	argv = append(argv, args...)
 	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
 	cmd.Stdin = nil // avoid blocking on any input
-	err := cmd.Run()
-	return err
+	return cmd
+}
+
+// transferRE matches the lines smbclient prints for each file it copies
+// during an mput or mget. The local path is captured.
+var transferRE = regexp.MustCompile(
+	`^(?:putting file (\S+) as |getting file \S+ of size \d+ as (\S+))`)
+
+func parseTransfers(out []byte) TransferList {
+	tl := TransferList{}
+	for _, line := range strings.Split(string(out), "\n") {
+		m := transferRE.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		if m[1] != "" {
+			tl = append(tl, m[1])
+		} else {
+			tl = append(tl, m[2])
+		}
+	}
+	return tl
+}
+
+func recursiveCmds(localDir, remoteDir, op string) []string {
+	cmds := []string{"prompt OFF", "recurse ON", "lcd " + localDir}
+	if remoteDir != "" {
+		cmds = append(cmds, fmt.Sprintf("cd \"%s\"", remoteDir))
+	}
+	return append(cmds, op+" *")
+}
+
+func (ksc *kubectlSmbClientCli) MPut(
+	ctx context.Context, share Share, auth Auth, localDir, remoteDir string) (
+	TransferList, error) {
+	// ---
+	if remoteDir != "" {
+		// mkdir fails if the dir already exists, so it is run as a
+		// separate command and any error ignored. If the directory is
+		// really missing the mput will fail.
+		_ = ksc.Command(ctx, share, auth,
+			[]string{fmt.Sprintf("mkdir \"%s\"", remoteDir)})
+	}
+	out, err := ksc.CommandOutput(ctx, share, auth,
+		recursiveCmds(localDir, remoteDir, "mput"))
+	return parseTransfers(out), err
+}
+
+func (ksc *kubectlSmbClientCli) MGet(
+	ctx context.Context, share Share, auth Auth, remoteDir, localDir string) (
+	TransferList, error) {
+	// ---
+	cmd := ksc.podCmd(ctx, "mkdir", "-p", localDir)
+	if oe, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf(
+			"failed to create local dir: %v: %w [stdio: %s]",
+			cmd.Args, err, string(oe))
+	}
+	out, err := ksc.CommandOutput(ctx, share, auth,
+		recursiveCmds(localDir, remoteDir, "mget"))
+	return parseTransfers(out), err
+}
+
+func (ksc *kubectlSmbClientCli) MakeLocalTree(
+	ctx context.Context, dir string, files []TreeFile) error {
+	// ---
+	// positional args are used to avoid any need for shell quoting of
+	// the paths and content.
+	script := `mkdir -p "$(dirname "$1")" && printf '%s' "$2" > "$1"`
+	for _, f := range files {
+		cmd := ksc.podCmd(ctx,
+			"sh", "-c", script, "sh", path.Join(dir, f.Path), f.Content)
+		if oe, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf(
+				"failed to create local file: %v: %w [stdio: %s]",
+				cmd.Args, err, string(oe))
+		}
+	}
+	return nil
+}
+
+func (ksc *kubectlSmbClientCli) DiffLocalTrees(
+	ctx context.Context, a, b string) error {
+	// ---
+	cmd := ksc.podCmd(ctx, "diff", "-r", a, b)
+	if oe, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf(
+			"local trees differ: %v: %w [stdio: %s]",
+			cmd.Args, err, string(oe))
+	}
+	return nil
+}
+
+// WaitForHostResolves will wait for the host name to resolve, up to the
+// deadline specified by the context. If the context lacks a deadline the
+// call will block indefinitely. Resolution is performed within the pod
+// such that the result reflects the pod's view of DNS.
+func (ksc *kubectlSmbClientCli) WaitForHostResolves(
+	ctx context.Context, host Host) error {
+	// ---
+	var lastErr error
+	for {
+		cmd := ksc.podCmd(ctx, "getent", "hosts", string(host))
+		oe, err := cmd.CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		lastErr = fmt.Errorf("%w [stdio: %s]", err, string(oe))
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf(
+				"timed out waiting for %q to resolve: %v (last error: %v)",
+				string(host), err, lastErr)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
 }
 
 // MustPodClient returns an SmbClient based on the given pod name and the
 // test environment. It panics if the environment is not set up.
 func MustPodClient(namespace, pod string) SmbClient {
+	return MustPodProtocolClient(namespace, pod, "")
+}
+
+// MustPodProtocolClient returns an SmbClient, like MustPodClient, that
+// connects to servers using exactly the given protocol. An empty protocol
+// lets the client negotiate the protocol.
+func MustPodProtocolClient(namespace, pod string, protocol Protocol) SmbClient {
 	// this is a tad hacky, but in an effort not to boil the ocean at this
 	// very minute I'd rather do this than build a lot more comprehensive
 	// configuration for the test utilities.
@@ -156,5 +672,6 @@ func MustPodClient(namespace, pod string) SmbClient {
 		kubeconfig: kc,
 		pod:        pod,
 		namespace:  namespace,
+		protocol:   protocol,
 	}
 }
@@ -2,11 +2,47 @@ package smbclient
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+func TestHostString(t *testing.T) {
+	assert.Equal(t, "//files.example.com", Host("files.example.com").String())
+	assert.Equal(t, "//10.0.0.5", Host("10.0.0.5").String())
+	assert.Equal(t, "//[fd00:10::5]", Host("fd00:10::5").String())
+	assert.Equal(t,
+		"//[fd00:10::5]/Stuff",
+		Share{Host("fd00:10::5"), "Stuff"}.String())
+}
+
+func TestHostPort(t *testing.T) {
+	h := HostPort("files.example.com", 4450)
+	assert.Equal(t, "//files.example.com", h.String())
+	assert.Equal(t, []string{"--option=smb ports=4450"}, h.portArgs())
+	h = HostPort("fd00:10::5", 4450)
+	assert.Equal(t, "//[fd00:10::5]", h.String())
+	assert.Equal(t, []string{"--option=smb ports=4450"}, h.portArgs())
+	assert.Nil(t, Host("fd00:10::5").portArgs())
+	assert.Nil(t, Host("files.example.com").portArgs())
+
+	c := &kubectlSmbClientCli{
+		kubeconfig: "/tmp/my/kubeconfig",
+		pod:        "smbclient-pod",
+		namespace:  "foo",
+		prefix:     []string{"echo"},
+	}
+	out, err := c.CommandOutput(
+		context.TODO(),
+		Share{HostPort("localhost", 4450), "Stuff"},
+		Auth{Username: "bob", Password: "passw0rd"},
+		[]string{"ls"})
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "--option=smb ports=4450 //localhost/Stuff -c ls")
+}
+
 func TestBaseArgs(t *testing.T) {
 	c := &kubectlSmbClientCli{
 		kubeconfig: "/tmp/my/kubeconfig",
@@ -14,7 +50,7 @@ func TestBaseArgs(t *testing.T) {
 		namespace:  "foo",
 	}
 	var cmd []string
-	cmd = c.baseArgs(Auth{"bob", "passw0rd"})
+	cmd = c.baseArgs(Auth{Username: "bob", Password: "passw0rd"})
 	assert.Equal(t,
 		[]string{
 			"kubectl",
@@ -29,7 +65,7 @@ func TestBaseArgs(t *testing.T) {
 			"-Ubob%passw0rd",
 		},
 		cmd)
-	cmd = c.baseArgs(Auth{"fred", ""})
+	cmd = c.baseArgs(Auth{Username: "fred", Password: ""})
 	assert.Equal(t,
 		[]string{
 			"kubectl",
@@ -44,6 +80,82 @@ func TestBaseArgs(t *testing.T) {
 			"-Ufred",
 		},
 		cmd)
+	cmd = c.baseArgs(Auth{})
+	assert.Equal(t, "-N", cmd[len(cmd)-1])
+}
+
+func TestProtocolArgs(t *testing.T) {
+	c := &kubectlSmbClientCli{
+		pod:       "smbclient-pod",
+		namespace: "foo",
+		protocol:  SMB311,
+	}
+	assert.Equal(t,
+		[]string{
+			"kubectl",
+			"exec",
+			"--namespace",
+			"foo",
+			"-it",
+			"smbclient-pod",
+			"--",
+			"smbclient",
+			"-Ubob%passw0rd",
+			"-m",
+			"SMB3_11",
+			"--option=client min protocol=SMB3_11",
+		},
+		c.baseArgs(Auth{Username: "bob", Password: "passw0rd"}))
+	// the samba tools authenticating like smbclient use the protocol too
+	cmd := c.toolArgs("smbcacls", Auth{Username: "bob", Password: "passw0rd"})
+	assert.Equal(t, "--option=client min protocol=SMB3_11", cmd[len(cmd)-1])
+	assert.Nil(t, Protocol("").args())
+}
+
+func TestKerberosAuth(t *testing.T) {
+	ctx := context.TODO()
+	c := &kubectlSmbClientCli{
+		pod:       "smbclient-pod",
+		namespace: "foo",
+		prefix:    []string{"echo"},
+	}
+	auth := Auth{
+		Username:    "bwayne@DOMAIN1.SINK.TEST",
+		Password:    "1115Rose.",
+		UseKerberos: true,
+	}
+	assert.Equal(t,
+		[]string{
+			"kubectl", "exec", "--namespace", "foo", "-it", "smbclient-pod",
+			"--", "env", "KRB5CCNAME=/tmp/krb5cc_bwayne_DOMAIN1.SINK.TEST",
+			"smbclient", "-k",
+		},
+		c.baseArgs(auth))
+	assert.Equal(t,
+		[]string{
+			"sh", "-c", `printf '%s\n' "$0" | kinit -c "$1" "$2"`,
+			"1115Rose.", "/tmp/krb5cc_bwayne_DOMAIN1.SINK.TEST",
+			"bwayne@DOMAIN1.SINK.TEST",
+		},
+		kinitArgs(auth))
+	assert.NoError(t, c.Kinit(ctx, auth))
+
+	auth.Keytab = "/etc/bwayne.keytab"
+	auth.CCache = "/tmp/bwayne.ccache"
+	assert.Equal(t,
+		[]string{
+			"kinit", "-k", "-t", "/etc/bwayne.keytab", "-c", "/tmp/bwayne.ccache",
+			"bwayne@DOMAIN1.SINK.TEST",
+		},
+		kinitArgs(auth))
+
+	// failing to get a ticket is not a failure of the server
+	c.prefix = []string{"/usr/bin/false"}
+	err := c.Kinit(ctx, auth)
+	assert.True(t, IsTicketFailed(err))
+	assert.False(t, IsConnectionFailed(err))
+	err = c.Kinit(ctx, Auth{Username: "bob", Password: "passw0rd"})
+	assert.True(t, IsTicketFailed(err))
 }
 
 func TestCmd(t *testing.T) {
@@ -57,7 +169,7 @@ func TestCmd(t *testing.T) {
 	share := Share{Host("localhost"), "Stuff"}
 	cmd := c.smbclientCmd(
 		ctx,
-		Auth{"bob", "passw0rd"},
+		Auth{Username: "bob", Password: "passw0rd"},
 		[]string{share.String(), "-c", "ls"})
 	assert.NotNil(t, cmd)
 }
@@ -73,7 +185,7 @@ func TestCommand(t *testing.T) {
 	err := c.Command(
 		ctx,
 		Share{Host("localhost"), "Stuff"},
-		Auth{"bob", "passw0rd"},
+		Auth{Username: "bob", Password: "passw0rd"},
 		[]string{"ls"})
 	assert.NoError(t, err)
 
@@ -81,7 +193,233 @@ func TestCommand(t *testing.T) {
 	err = c.Command(
 		ctx,
 		Share{Host("localhost"), "Stuff"},
-		Auth{"bob", "passw0rd"},
+		Auth{Username: "bob", Password: "passw0rd"},
 		[]string{"ls"})
 	assert.Error(t, err)
 }
+
+func TestConnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	c := &kubectlSmbClientCli{
+		kubeconfig: "/tmp/my/kubeconfig",
+		pod:        "smbclient-pod",
+		namespace:  "foo",
+		prefix:     []string{"echo"},
+	}
+	err := c.Connect(
+		ctx,
+		Share{Host("localhost"), "Stuff"},
+		Auth{Username: "bob", Password: "passw0rd"})
+	assert.NoError(t, err)
+
+	c.prefix = []string{"/nonexistent/smbclient"}
+	err = c.Connect(
+		ctx,
+		Share{Host("localhost"), "Stuff"},
+		Auth{Username: "bob", Password: "passw0rd"})
+	assert.Error(t, err)
+}
+
+func TestParseTransfers(t *testing.T) {
+	out := []byte(`Domain=[SAMBA] OS=[] Server=[]
+putting file ./a.txt as \tree\a.txt (0.0 kb/s) (average 0.0 kb/s)
+putting file ./sub/b.txt as \tree\sub\b.txt (0.5 kb/s) (average 0.3 kb/s)
+`)
+	assert.Equal(t,
+		TransferList{"./a.txt", "./sub/b.txt"},
+		parseTransfers(out))
+
+	out = []byte(`getting file \tree\a.txt of size 3 as ./a.txt (1.0 KiloBytes/sec)
+getting file \tree\sub\b.txt of size 6 as ./sub/b.txt (2.9 KiloBytes/sec)
+`)
+	assert.Equal(t,
+		TransferList{"./a.txt", "./sub/b.txt"},
+		parseTransfers(out))
+
+	assert.Len(t, parseTransfers([]byte("NT_STATUS_ACCESS_DENIED\n")), 0)
+}
+
+func TestMPutMGet(t *testing.T) {
+	ctx := context.TODO()
+	c := &kubectlSmbClientCli{
+		kubeconfig: "/tmp/my/kubeconfig",
+		pod:        "smbclient-pod",
+		namespace:  "foo",
+		prefix:     []string{"echo"},
+	}
+	share := Share{Host("localhost"), "Stuff"}
+	auth := Auth{Username: "bob", Password: "passw0rd"}
+
+	tl, err := c.MPut(ctx, share, auth, "/tmp/tree1", "tree")
+	assert.NoError(t, err)
+	assert.Len(t, tl, 0)
+
+	tl, err = c.MGet(ctx, share, auth, "tree", "/tmp/tree2")
+	assert.NoError(t, err)
+	assert.Len(t, tl, 0)
+
+	c.prefix = []string{"/usr/bin/false"}
+	_, err = c.MPut(ctx, share, auth, "/tmp/tree1", "tree")
+	assert.Error(t, err)
+	_, err = c.MGet(ctx, share, auth, "tree", "/tmp/tree2")
+	assert.Error(t, err)
+	err = c.MakeLocalTree(ctx, "/tmp/tree1", []TreeFile{{"a.txt", "aaa"}})
+	assert.Error(t, err)
+	err = c.DiffLocalTrees(ctx, "/tmp/tree1", "/tmp/tree2")
+	assert.Error(t, err)
+}
+
+func TestRecursiveCmds(t *testing.T) {
+	assert.Equal(t,
+		[]string{"prompt OFF", "recurse ON", "lcd /tmp/x", `cd "a b"`, "mput *"},
+		recursiveCmds("/tmp/x", "a b", "mput"))
+	assert.Equal(t,
+		[]string{"prompt OFF", "recurse ON", "lcd /tmp/x", "mget *"},
+		recursiveCmds("/tmp/x", "", "mget"))
+}
+
+func TestErrorClassification(t *testing.T) {
+	err := newError(
+		[]byte("putting file x as \\x\nNT_STATUS_ACCESS_DENIED opening remote file \\x\n"),
+		errors.New("exit status 1"))
+	assert.Equal(t, "NT_STATUS_ACCESS_DENIED", err.Status)
+	assert.True(t, IsAccessDenied(err))
+	assert.False(t, IsConnectionFailed(err))
+	assert.NoError(t, CheckDenied(err))
+
+	err = newError(
+		[]byte("do_connect: Connection to foo failed (Error NT_STATUS_CONNECTION_REFUSED)\n"),
+		errors.New("exit status 1"))
+	assert.Equal(t, "NT_STATUS_CONNECTION_REFUSED", err.Status)
+	assert.False(t, IsAccessDenied(err))
+	assert.True(t, IsConnectionFailed(err))
+	assert.Error(t, CheckDenied(err))
+
+	err = newError([]byte("oops\n"), errors.New("exit status 1"))
+	assert.Equal(t, "", err.Status)
+	assert.False(t, IsAccessDenied(err))
+	assert.False(t, IsConnectionFailed(err))
+	assert.Error(t, CheckDenied(err))
+
+	assert.Error(t, CheckDenied(nil))
+}
+
+func TestFileOps(t *testing.T) {
+	ctx := context.TODO()
+	c := &kubectlSmbClientCli{
+		kubeconfig: "/tmp/my/kubeconfig",
+		pod:        "smbclient-pod",
+		namespace:  "foo",
+		prefix:     []string{"echo"},
+	}
+	share := Share{Host("localhost"), "Stuff"}
+	auth := Auth{Username: "bob", Password: "passw0rd"}
+	assert.NoError(t, c.MakeDir(ctx, share, auth, "d1"))
+	assert.NoError(t, c.PutFile(ctx, share, auth, "profile.jpeg", "d1/p.jpeg"))
+	assert.NoError(t, c.DeleteFile(ctx, share, auth, "d1/p.jpeg"))
+
+	c.prefix = []string{"/usr/bin/false"}
+	err := c.PutFile(ctx, share, auth, "profile.jpeg", "d1/p.jpeg")
+	assert.Error(t, err)
+	var serr *Error
+	assert.True(t, errors.As(err, &serr))
+}
+
+func TestWaitForHostResolves(t *testing.T) {
+	c := &kubectlSmbClientCli{
+		kubeconfig: "/tmp/my/kubeconfig",
+		pod:        "smbclient-pod",
+		namespace:  "foo",
+		prefix:     []string{"echo"},
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), 2*time.Second)
+	defer cancel()
+	assert.NoError(t, c.WaitForHostResolves(ctx, Host("foo.example.test")))
+
+	c.prefix = []string{"/usr/bin/false"}
+	ctx2, cancel2 := context.WithTimeout(context.TODO(), 500*time.Millisecond)
+	defer cancel2()
+	err := c.WaitForHostResolves(ctx2, Host("foo.example.test"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "foo.example.test")
+}
+
+func TestParseShareList(t *testing.T) {
+	out := []byte(`Disk|My Share|Büro files — shared
+Disk|Plain|
+IPC|IPC$|IPC Service (Samba 4.13.3)
+Server|STORAGE|
+Workgroup|WORKGROUP|
+`)
+	entries := parseShareList(out)
+	assert.Equal(t,
+		[]ShareEntry{
+			{Type: "Disk", Name: "My Share", Comment: "Büro files — shared"},
+			{Type: "Disk", Name: "Plain", Comment: ""},
+			{Type: "IPC", Name: "IPC$", Comment: "IPC Service (Samba 4.13.3)"},
+		},
+		entries)
+}
+
+func TestListShares(t *testing.T) {
+	ctx := context.TODO()
+	c := &kubectlSmbClientCli{
+		pod:       "smbclient-pod",
+		namespace: "foo",
+		prefix:    []string{"echo"},
+	}
+	entries, err := c.ListShares(ctx, Host("localhost"), Auth{Username: "bob", Password: "x"})
+	assert.NoError(t, err)
+	// echo output is not a share listing
+	assert.Len(t, entries, 0)
+}
+
+func TestParseACL(t *testing.T) {
+	out := []byte(`REVISION:1
+CONTROL:SR|DP
+OWNER:S-1-22-1-1000
+GROUP:S-1-22-2-1000
+ACL:S-1-22-1-1000:ALLOWED/0x0/0x001f01ff
+ACL:S-1-1-0:ALLOWED/0x0/0x001200a9
+`)
+	assert.Equal(t,
+		[]string{
+			"ACL:S-1-22-1-1000:ALLOWED/0x0/0x001f01ff",
+			"ACL:S-1-1-0:ALLOWED/0x0/0x001200a9",
+		},
+		parseACL(out))
+}
+
+func TestParseAttributes(t *testing.T) {
+	out := []byte(`altname: A.TXT
+create_time:    Thu Oct  1 10:00:00 AM 2026 UTC
+write_time:     Thu Oct  1 10:00:00 AM 2026 UTC
+attributes: HA (22)
+stream: [::$DATA], 12 bytes
+`)
+	assert.Equal(t, "HA", parseAttributes(out))
+	assert.Equal(t, "", parseAttributes([]byte("attributes:  (80)\n")))
+	assert.Equal(t, "", parseAttributes([]byte("NT_STATUS_OBJECT_NAME_NOT_FOUND\n")))
+}
+
+func TestAddACL(t *testing.T) {
+	ctx := context.TODO()
+	c := &kubectlSmbClientCli{
+		pod:       "smbclient-pod",
+		namespace: "foo",
+		prefix:    []string{"echo"},
+	}
+	share := Share{Host: Host("localhost"), Name: "files"}
+	cmd := c.smbcaclsCmd(ctx, share, Auth{Username: "bob", Password: "x"}, "a.txt",
+		"-a", "ACL:S-1-1-0:ALLOWED/0x0/READ")
+	assert.Equal(t,
+		[]string{
+			"echo", "kubectl", "exec", "--namespace", "foo", "-it",
+			"smbclient-pod", "--", "smbcacls", "-Ubob%x", "--numeric",
+			"//localhost/files", "a.txt", "-a", "ACL:S-1-1-0:ALLOWED/0x0/READ",
+		},
+		cmd.Args)
+	assert.NoError(t, c.AddACL(ctx, share, Auth{Username: "bob", Password: "x"}, "a.txt",
+		"ACL:S-1-1-0:ALLOWED/0x0/READ"))
+}